@@ -0,0 +1,284 @@
+// Package agent serves resolved configs over a local unix socket so that
+// repeated puff invocations can share one process's decrypted files instead
+// of each decrypting them again.
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/teamcurri/puff/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// SocketEnv is the environment variable clients read the agent's socket path from
+const SocketEnv = "PUFF_AGENT_SOCK"
+
+// ErrUnavailable is returned by the client when no agent is listening on the socket
+var ErrUnavailable = errors.New("puff agent is not available")
+
+// ResolveFunc loads and resolves the config for a context
+type ResolveFunc func(ctx config.LoadContext) (map[string]interface{}, error)
+
+// maxHostEnvRounds bounds the requests a client makes while the agent asks
+// for more of its environment
+const maxHostEnvRounds = 8
+
+// DefaultSocketPath returns the socket path used when none is configured:
+// in $XDG_RUNTIME_DIR, which only the user can access, or else in a
+// per-user directory in the temp directory
+func DefaultSocketPath() string {
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		return filepath.Join(runtimeDir, "puff", "agent.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("puff-agent-%d", os.Getuid()), "agent.sock")
+}
+
+// Listen creates the unix socket at socketPath, accessible only by the
+// current user. The socket's directory is created if needed; an existing
+// one must belong to the current user and be closed to others, so another
+// user can't create it first and take over the socket. A stale socket left
+// by an agent that exited uncleanly is replaced.
+func Listen(socketPath string) (net.Listener, error) {
+	dir := filepath.Dir(socketPath)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+	if err := checkSocketDir(dir); err != nil {
+		return nil, err
+	}
+
+	if info, err := os.Lstat(socketPath); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", socketPath)
+		}
+		if conn, err := net.Dial("unix", socketPath); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("an agent is already listening on %s", socketPath)
+		}
+		if err := os.Remove(socketPath); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+
+	listener, err := listenPrivate(socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", socketPath, err)
+	}
+	return listener, nil
+}
+
+// resolveRequest is the body of a resolve request. HostEnv holds the
+// variables of the client's environment the agent asked for, so ${env:NAME}
+// references see the caller's environment rather than the agent's;
+// HostEnvNames lists every variable the client looked up, including those
+// it doesn't have set.
+type resolveRequest struct {
+	Root         string            `json:"root"`
+	App          string            `json:"app"`
+	Env          string            `json:"env"`
+	Target       string            `json:"target"`
+	Dimensions   map[string]string `json:"dimensions,omitempty"`
+	NoHostEnv    bool              `json:"no_host_env"`
+	HostEnv      map[string]string `json:"host_env"`
+	HostEnvNames []string          `json:"host_env_names,omitempty"`
+}
+
+// hostEnvResponse is the body of a 428 response, naming the variables of
+// the client's environment the config references and the request lacked
+type hostEnvResponse struct {
+	HostEnv []string `json:"host_env"`
+}
+
+// Handler returns the HTTP handler that serves resolved configs as YAML.
+// YAML preserves the value types a local load would produce.
+func Handler(resolve ResolveFunc) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/resolve", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req resolveRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		ctx := config.LoadContext{
+			RootDir:    req.Root,
+			App:        req.App,
+			Env:        req.Env,
+			Target:     req.Target,
+			Dimensions: req.Dimensions,
+			NoHostEnv:  req.NoHostEnv,
+		}
+		if !filepath.IsAbs(ctx.RootDir) {
+			http.Error(w, "root must be an absolute path", http.StatusBadRequest)
+			return
+		}
+
+		// The agent's own environment is never used. Variables the client
+		// wasn't asked for are collected and requested from it.
+		var mu sync.Mutex
+		var missing []string
+		answered := make(map[string]bool, len(req.HostEnvNames))
+		for _, name := range req.HostEnvNames {
+			answered[name] = true
+		}
+		if !req.NoHostEnv {
+			ctx.LookupHostEnv = func(name string) (string, bool) {
+				mu.Lock()
+				defer mu.Unlock()
+				if value, ok := req.HostEnv[name]; ok {
+					return value, true
+				}
+				if !answered[name] && !slices.Contains(missing, name) {
+					missing = append(missing, name)
+				}
+				return "", false
+			}
+		}
+
+		resolved, err := resolve(ctx)
+		if len(missing) > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusPreconditionRequired)
+			json.NewEncoder(w).Encode(hostEnvResponse{HostEnv: missing})
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+
+		data, err := yaml.Marshal(resolved)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to marshal config: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(data)
+	})
+	return mux
+}
+
+// Client requests resolved configs from an agent
+type Client struct {
+	http *http.Client
+}
+
+// NewClient creates a client for the agent listening on socketPath
+func NewClient(socketPath string) *Client {
+	return &Client{
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", socketPath)
+				},
+			},
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// Resolve returns the resolved config for ctx. It returns an error wrapping
+// ErrUnavailable if the agent can't be reached. Only the variables of the
+// environment that the config references are sent to the agent, as it asks
+// for them.
+func (c *Client) Resolve(ctx config.LoadContext) (map[string]interface{}, error) {
+	rootDir, err := filepath.Abs(ctx.RootDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve root directory: %w", err)
+	}
+	lookupEnv := ctx.LookupHostEnv
+	if lookupEnv == nil {
+		lookupEnv = os.LookupEnv
+	}
+
+	req := resolveRequest{
+		Root:       rootDir,
+		App:        ctx.App,
+		Env:        ctx.Env,
+		Target:     ctx.Target,
+		Dimensions: ctx.Dimensions,
+		NoHostEnv:  ctx.NoHostEnv,
+		HostEnv:    map[string]string{},
+	}
+	var body []byte
+	for round := 0; ; round++ {
+		status, respBody, err := c.post(req)
+		if err != nil {
+			return nil, err
+		}
+		if status == http.StatusOK {
+			body = respBody
+			break
+		}
+		if status != http.StatusPreconditionRequired {
+			return nil, errors.New(strings.TrimSpace(string(respBody)))
+		}
+
+		var asked hostEnvResponse
+		if err := json.Unmarshal(respBody, &asked); err != nil {
+			return nil, fmt.Errorf("failed to parse agent response: %w", err)
+		}
+		added := false
+		for _, name := range asked.HostEnv {
+			if slices.Contains(req.HostEnvNames, name) {
+				continue
+			}
+			added = true
+			req.HostEnvNames = append(req.HostEnvNames, name)
+			if value, ok := lookupEnv(name); ok {
+				req.HostEnv[name] = value
+			}
+		}
+		if !added || round >= maxHostEnvRounds {
+			return nil, fmt.Errorf("agent kept asking for environment variables: %s", strings.Join(asked.HostEnv, ", "))
+		}
+	}
+
+	resolved := make(map[string]interface{})
+	if err := yaml.Unmarshal(body, &resolved); err != nil {
+		return nil, fmt.Errorf("failed to parse agent response: %w", err)
+	}
+
+	return resolved, nil
+}
+
+// post sends a resolve request and returns the response's status and body
+func (c *Client) post(req resolveRequest) (int, []byte, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to encode agent request: %w", err)
+	}
+
+	// The host is ignored; requests always go to the socket
+	resp, err := c.http.Post("http://puff-agent/resolve", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read agent response: %w", err)
+	}
+	return resp.StatusCode, body, nil
+}
@@ -0,0 +1,137 @@
+package agent
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/teamcurri/puff/internal/config"
+)
+
+// shortSocketPath returns a socket path short enough for the platform's
+// sun_path limit, which t.TempDir() can exceed on macOS
+func shortSocketPath(t *testing.T) string {
+	dir, err := os.MkdirTemp("", "puff")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "agent.sock")
+}
+
+func TestClientResolve(t *testing.T) {
+	socketPath := shortSocketPath(t)
+	listener, err := Listen(socketPath)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+
+	var requested config.LoadContext
+	var hostEnv map[string]string
+	server := &http.Server{Handler: Handler(func(ctx config.LoadContext) (map[string]interface{}, error) {
+		requested = ctx
+		if ctx.App == "missing" {
+			return nil, errors.New("app not found")
+		}
+		// The app references two variables of the host environment
+		hostEnv = map[string]string{}
+		if ctx.App == "hostenv" && ctx.LookupHostEnv != nil {
+			for _, name := range []string{"PUFF_TEST_HOST", "PUFF_TEST_UNSET"} {
+				if value, ok := ctx.LookupHostEnv(name); ok {
+					hostEnv[name] = value
+				}
+			}
+		}
+		return map[string]interface{}{"PORT": 8080, "HOST": "localhost"}, nil
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	client := NewClient(socketPath)
+	resolved, err := client.Resolve(config.LoadContext{RootDir: ".", App: "api", Env: "dev"})
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+
+	if resolved["PORT"] != 8080 || resolved["HOST"] != "localhost" {
+		t.Errorf("Expected types to be preserved, got %#v", resolved)
+	}
+	if !filepath.IsAbs(requested.RootDir) || requested.App != "api" || requested.Env != "dev" {
+		t.Errorf("Expected an absolute root and the request context, got %+v", requested)
+	}
+
+	// ${env:NAME} references must see the client's environment, not the
+	// agent's, and only the variables referenced are sent
+	t.Setenv("PUFF_TEST_HOST", "laptop")
+	t.Setenv("PUFF_TEST_UNRELATED", "s3cret")
+	if _, err := client.Resolve(config.LoadContext{RootDir: ".", App: "hostenv", Env: "dev"}); err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if len(hostEnv) != 1 || hostEnv["PUFF_TEST_HOST"] != "laptop" {
+		t.Errorf("Expected the client's environment to be used, got %v", hostEnv)
+	}
+	if _, ok := requested.LookupHostEnv("PUFF_TEST_UNRELATED"); ok {
+		t.Error("Expected variables the config doesn't reference not to be sent")
+	}
+	if _, err := client.Resolve(config.LoadContext{RootDir: ".", App: "hostenv", Env: "dev", NoHostEnv: true}); err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if !requested.NoHostEnv || requested.LookupHostEnv != nil || len(hostEnv) != 0 {
+		t.Errorf("Expected no environment to be sent with NoHostEnv, got %+v", requested)
+	}
+
+	_, err = client.Resolve(config.LoadContext{RootDir: ".", App: "missing", Env: "dev"})
+	if err == nil || err.Error() != "app not found" {
+		t.Errorf("Expected the resolution error, got %v", err)
+	}
+}
+
+func TestClientResolveUnavailable(t *testing.T) {
+	_, err := NewClient(shortSocketPath(t)).Resolve(config.LoadContext{RootDir: "."})
+	if !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Expected ErrUnavailable, got %v", err)
+	}
+}
+
+func TestListenRefusesRunningAgent(t *testing.T) {
+	socketPath := shortSocketPath(t)
+	listener, err := Listen(socketPath)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer listener.Close()
+
+	if _, err := Listen(socketPath); err == nil {
+		t.Error("Expected an error when an agent is already listening")
+	}
+}
+
+func TestListenRefusesUnsafeDirectory(t *testing.T) {
+	socketPath := shortSocketPath(t)
+	dir := filepath.Dir(socketPath)
+
+	// A directory others can access could have been created by them
+	os.Chmod(dir, 0755)
+	if _, err := Listen(socketPath); err == nil || !strings.Contains(err.Error(), "must be 0700") {
+		t.Errorf("Expected a directory open to others to be refused, got %v", err)
+	}
+
+	os.Chmod(dir, 0700)
+	link := filepath.Join(dir, "link")
+	os.Symlink(dir, link)
+	if _, err := Listen(filepath.Join(link, "agent.sock")); err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Errorf("Expected a symlinked directory to be refused, got %v", err)
+	}
+
+	listener, err := Listen(socketPath)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer listener.Close()
+	if info, err := os.Stat(socketPath); err != nil || info.Mode().Perm()&0077 != 0 {
+		t.Errorf("Expected the socket to be closed to others, got %v (%v)", info.Mode(), err)
+	}
+}
@@ -0,0 +1,27 @@
+//go:build !unix
+
+package agent
+
+import (
+	"fmt"
+	"net"
+	"os"
+)
+
+// checkSocketDir checks that dir is a directory and not a symlink. File
+// ownership and modes aren't checked where they don't apply.
+func checkSocketDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return fmt.Errorf("failed to check socket directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("socket directory %s is not a directory", dir)
+	}
+	return nil
+}
+
+// listenPrivate creates a unix socket
+func listenPrivate(socketPath string) (net.Listener, error) {
+	return net.Listen("unix", socketPath)
+}
@@ -0,0 +1,38 @@
+//go:build unix
+
+package agent
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// checkSocketDir checks that dir is a directory, not a symlink, owned by the
+// current user and closed to everyone else
+func checkSocketDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return fmt.Errorf("failed to check socket directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("socket directory %s is not a directory", dir)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("socket directory %s is owned by another user", dir)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("socket directory %s is accessible by other users (mode %04o; it must be 0700)", dir, info.Mode().Perm())
+	}
+	return nil
+}
+
+// listenPrivate creates a unix socket only the current user can connect to.
+// The umask applies when the socket is created, so it is never open to
+// others, even briefly.
+func listenPrivate(socketPath string) (net.Listener, error) {
+	oldMask := syscall.Umask(0177)
+	defer syscall.Umask(oldMask)
+	return net.Listen("unix", socketPath)
+}
@@ -0,0 +1,202 @@
+// Package audit keeps an append-only log of the changes puff commands make
+// to a config directory. Records are stored as JSON lines in one file per
+// month, so logs written on different branches rarely conflict.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/getsops/sops/v3/decrypt"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/keys"
+	"gopkg.in/yaml.v3"
+)
+
+// fileExtension is the extension of the monthly log files. It keeps them out
+// of the walks that look for .yml config files.
+const fileExtension = ".jsonl"
+
+// Record describes one change made by a command
+type Record struct {
+	Time    time.Time `json:"time"`
+	Actor   string    `json:"actor"`
+	Command string    `json:"command"`
+	// File is the changed config file, relative to the config root
+	File string `json:"file,omitempty"`
+	Key  string `json:"key,omitempty"`
+	// Recipient is the encryption key added or removed by keys add/rm
+	Recipient string `json:"recipient,omitempty"`
+	// Env is the environment keys add/rm were limited to
+	Env string `json:"env,omitempty"`
+	// OldHash and NewHash are hashes of the value before and after the
+	// change (see Hash). They are empty if the key didn't exist, and are only
+	// kept in encrypted records.
+	OldHash string `json:"old_hash,omitempty"`
+	NewHash string `json:"new_hash,omitempty"`
+}
+
+// encryptedLine is how an encrypted record is stored: a SOPS-encrypted YAML
+// document holding the record's JSON, base64-encoded
+type encryptedLine struct {
+	Encrypted string `json:"encrypted"`
+}
+
+// Hash returns the hash recorded in place of a value; values other than
+// strings are hashed as JSON. Low-entropy values can be guessed from an
+// unkeyed hash, so hashes must only be written to encrypted records.
+func Hash(value interface{}) string {
+	data, ok := value.(string)
+	if !ok {
+		encoded, _ := json.Marshal(value)
+		data = string(encoded)
+	}
+	sum := sha256.Sum256([]byte(data))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Append adds records to the log file for the month of the first record.
+// If recipients are given, each record is encrypted with them.
+func Append(rootDir string, records []Record, recipients []string) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to marshal audit record: %w", err)
+		}
+		if len(recipients) > 0 {
+			if line, err = encryptRecord(line, recipients); err != nil {
+				return err
+			}
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	dir := filepath.Join(rootDir, config.AuditDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create audit directory: %w", err)
+	}
+	path := filepath.Join(dir, records[0].Time.UTC().Format("2006-01")+fileExtension)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return f.Close()
+}
+
+// Read returns every record in the log, oldest first, and the number of
+// encrypted records that couldn't be decrypted with the available keys
+func Read(rootDir string) ([]Record, int, error) {
+	paths, err := filepath.Glob(filepath.Join(rootDir, config.AuditDir, "*"+fileExtension))
+	if err != nil {
+		return nil, 0, err
+	}
+	sort.Strings(paths)
+
+	var records []Record
+	unreadable := 0
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read audit log: %w", err)
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(nil, 1<<20)
+		for lineNumber := 1; scanner.Scan(); lineNumber++ {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			record, ok, err := parseLine(line)
+			if err != nil {
+				return nil, 0, fmt.Errorf("invalid audit record at %s:%d: %w", filepath.Base(path), lineNumber, err)
+			}
+			if !ok {
+				unreadable++
+				continue
+			}
+			records = append(records, record)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, 0, fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+		}
+	}
+
+	// Records from merged branches may be out of order within a file
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Time.Before(records[j].Time)
+	})
+	return records, unreadable, nil
+}
+
+// parseLine parses one line of the log. ok is false if the record is
+// encrypted and can't be decrypted.
+func parseLine(line []byte) (record Record, ok bool, err error) {
+	var encrypted encryptedLine
+	if err := json.Unmarshal(line, &encrypted); err != nil {
+		return Record{}, false, err
+	}
+	if encrypted.Encrypted != "" {
+		if line, err = decryptRecord(encrypted.Encrypted); err != nil {
+			return Record{}, false, nil
+		}
+	}
+	if err := json.Unmarshal(line, &record); err != nil {
+		return Record{}, false, err
+	}
+	return record, true, nil
+}
+
+// encryptRecord encrypts a record's JSON with SOPS and returns its line
+func encryptRecord(record []byte, recipients []string) ([]byte, error) {
+	document, err := yaml.Marshal(map[string]string{"record": string(record)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal audit record: %w", err)
+	}
+	encrypted, err := keys.EncryptData(document, config.AuditDir+".yml", recipients)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt audit record: %w", err)
+	}
+	return json.Marshal(encryptedLine{Encrypted: base64.StdEncoding.EncodeToString(encrypted)})
+}
+
+// decryptRecord returns the JSON of an encrypted record
+func decryptRecord(encrypted string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = decrypt.Data(data, "yaml"); err != nil {
+		return nil, err
+	}
+	var document map[string]string
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+	return []byte(strings.TrimSpace(document["record"])), nil
+}
@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppendAndRead(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// A missing log has no records
+	records, unreadable, err := Read(tmpDir)
+	if err != nil || len(records) != 0 || unreadable != 0 {
+		t.Fatalf("Expected an empty log, got %v, %d, %v", records, unreadable, err)
+	}
+
+	october := time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)
+	september := time.Date(2026, 9, 30, 23, 0, 0, 0, time.UTC)
+	if err := Append(tmpDir, []Record{
+		{Time: october, Actor: "alice", Command: "set", File: "dev/api.yml", Key: "PORT", NewHash: Hash("8080")},
+		{Time: october, Actor: "alice", Command: "unset", File: "dev/api.yml", Key: "HOST", OldHash: Hash("db")},
+	}, nil); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if err := Append(tmpDir, []Record{{Time: september, Actor: "bob", Command: "keys add", Recipient: "age1abc"}}, nil); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+
+	for _, name := range []string{"2026-09.jsonl", "2026-10.jsonl"} {
+		if _, err := os.Stat(filepath.Join(tmpDir, "audit", name)); err != nil {
+			t.Errorf("Expected log file %s: %v", name, err)
+		}
+	}
+
+	records, unreadable, err = Read(tmpDir)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if unreadable != 0 || len(records) != 3 {
+		t.Fatalf("Expected 3 readable records, got %d (%d unreadable)", len(records), unreadable)
+	}
+	if records[0].Command != "keys add" || records[1].Key != "PORT" || records[2].OldHash != Hash("db") {
+		t.Errorf("Unexpected records: %+v", records)
+	}
+	if !records[1].Time.Equal(october) {
+		t.Errorf("Expected time %v, got %v", october, records[1].Time)
+	}
+
+	os.WriteFile(filepath.Join(tmpDir, "audit", "2026-11.jsonl"), []byte("not json\n"), 0600)
+	if _, _, err := Read(tmpDir); err == nil || !strings.Contains(err.Error(), "2026-11.jsonl:1") {
+		t.Errorf("Expected an error naming the invalid line, got %v", err)
+	}
+}
+
+func TestHash(t *testing.T) {
+	// sha256 of "secret", as printed by `printf %s secret | sha256sum`
+	if got := Hash("secret"); got != "sha256:2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b" {
+		t.Errorf("Unexpected hash of a string: %s", got)
+	}
+	if Hash(8080) != Hash(8080) || Hash(8080) == Hash("8081") {
+		t.Error("Expected non-string values to hash by their JSON encoding")
+	}
+}
@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/agent"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/resolve"
+	"github.com/urfave/cli/v2"
+)
+
+// AgentCommand creates the agent command for serving resolved configs over a unix socket
+func AgentCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "agent",
+		Usage: "Serve resolved configs over a local unix socket, caching decrypted files in memory",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "socket",
+				Usage:   "Unix socket path to listen on (defaults to a per-user path in $XDG_RUNTIME_DIR or the temp directory)",
+				EnvVars: []string{agent.SocketEnv},
+			},
+		},
+		Action: agentAction,
+	}
+}
+
+func agentAction(c *cli.Context) error {
+	socketPath := c.String("socket")
+	if socketPath == "" {
+		socketPath = agent.DefaultSocketPath()
+	}
+
+	listener, err := agent.Listen(socketPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(socketPath)
+
+	// Decrypted files are kept until they change on disk
+	cache := config.NewFileCache()
+	server := &http.Server{
+		Handler: agent.Handler(func(ctx config.LoadContext) (map[string]interface{}, error) {
+			ctx.Cache = cache
+			return resolve.Config(ctx)
+		}),
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		<-signals
+		server.Close()
+	}()
+
+	color.Green("puff agent listening on %s", socketPath)
+	fmt.Printf("export %s=%s\n", agent.SocketEnv, socketPath)
+
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("agent failed: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,490 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/audit"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/safefile"
+	"github.com/teamcurri/puff/internal/store"
+	"github.com/teamcurri/puff/internal/templating"
+	"github.com/urfave/cli/v2"
+)
+
+// appNamePattern matches the names app create and app rename accept
+var appNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// AppCommand creates the app parent command for managing apps as a whole
+func AppCommand() *cli.Command {
+	rootFlag := &cli.StringFlag{
+		Name:    "root",
+		Aliases: []string{"r"},
+		Usage:   "Root directory for config files",
+		Value:   ".",
+	}
+
+	return &cli.Command{
+		Name:  "app",
+		Usage: "Create, remove, and rename apps across every env and target",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "create",
+				Usage:     "Create an app, optionally as a copy of every file of another app",
+				ArgsUsage: "NAME",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "from",
+						Usage: "App to copy the base, env, and target files of",
+					},
+					rootFlag,
+				},
+				Action: appCreateAction,
+			},
+			{
+				Name:      "rm",
+				Usage:     "Delete an app's files across every env and target",
+				ArgsUsage: "NAME",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "confirm",
+						Usage: "Delete the files (without it, the files are only listed)",
+					},
+					rootFlag,
+				},
+				Action: appRmAction,
+			},
+			{
+				Name:      "rename",
+				Usage:     "Rename an app's files across every env and target",
+				ArgsUsage: "OLD NEW",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "update-refs",
+						Usage: "Rewrite ${app:OLD:KEY} template references in all config files",
+					},
+					rootFlag,
+				},
+				Action: appRenameAction,
+			},
+		},
+	}
+}
+
+func appCreateAction(c *cli.Context) error {
+	args, err := positionalArgs(c)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("expected an app NAME")
+	}
+	name := args[0]
+	from := c.String("from")
+	rootDir := c.String("root")
+
+	if err := validateAppName(name); err != nil {
+		return err
+	}
+
+	// Plan the files first, so they're locked before checking that the app
+	// doesn't exist yet
+	var sources, targets []string
+	if from == "" {
+		// An app starts with an empty base file, so it shows up in 'puff apps'
+		file, err := store.LevelFile(rootDir, name, "", "")
+		if err != nil {
+			return err
+		}
+		targets = append(targets, file)
+	} else {
+		if sources, err = appFiles(rootDir, from); err != nil {
+			return err
+		}
+		if len(sources) == 0 {
+			return fmt.Errorf("app not found: %s", from)
+		}
+		for _, source := range sources {
+			file, err := appLevelFile(rootDir, source, name)
+			if err != nil {
+				return err
+			}
+			targets = append(targets, file)
+		}
+	}
+	var directoryAgeKeys []string
+	if from == "" {
+		if directoryAgeKeys, err = store.DirectoryKeys(rootDir); err != nil {
+			return fmt.Errorf("failed to check directory encryption: %w", err)
+		}
+		if len(directoryAgeKeys) == 0 {
+			return fmt.Errorf("no encryption keys found in directory - run 'puff init' first to initialize with encryption keys")
+		}
+	}
+	lock, err := safefile.Acquire(targets...)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	if existing, err := appFiles(rootDir, name); err != nil {
+		return err
+	} else if len(existing) > 0 {
+		return fmt.Errorf("app %s already exists in %d file(s)", name, len(existing))
+	}
+
+	var created []string
+	if from == "" {
+		file := targets[0]
+		if err := store.Write(file, map[string]interface{}{}, directoryAgeKeys); err != nil {
+			return fmt.Errorf("%s: %w", relativeSource(rootDir, file), err)
+		}
+		created = append(created, file)
+	} else {
+		// Encrypted files are copied as they are, so the copies keep the
+		// recipients and key groups of the originals without being decrypted
+		for i, source := range sources {
+			data, err := os.ReadFile(source)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", relativeSource(rootDir, source), err)
+			}
+			file := targets[i]
+			if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+				return fmt.Errorf("failed to create directory for %s: %w", relativeSource(rootDir, file), err)
+			}
+			if err := os.WriteFile(file, data, 0600); err != nil {
+				return fmt.Errorf("failed to write %s: %w", relativeSource(rootDir, file), err)
+			}
+			created = append(created, file)
+		}
+	}
+
+	var records []audit.Record
+	for _, file := range created {
+		color.Cyan("  created %s", relativeSource(rootDir, file))
+		records = append(records, audit.Record{File: relativeSource(rootDir, file)})
+	}
+	if from != "" {
+		color.Green("Created app %s from %s in %d file(s)", name, from, len(created))
+	} else {
+		color.Green("Created app %s", name)
+	}
+
+	return store.RecordAudit(rootDir, "app create", records...)
+}
+
+func appRmAction(c *cli.Context) error {
+	args, err := positionalArgs(c)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("expected an app NAME")
+	}
+	name := args[0]
+	rootDir := c.String("root")
+
+	files, err := appFiles(rootDir, name)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("app not found: %s", name)
+	}
+
+	refs, unreadable, err := appReferences(rootDir, name, files)
+	if err != nil {
+		return err
+	}
+
+	if !c.Bool("confirm") {
+		for _, file := range files {
+			fmt.Printf("  %s\n", relativeSource(rootDir, file))
+		}
+		printAppReferences(rootDir, name, refs, unreadable)
+		return fmt.Errorf("refusing to delete %d file(s) of app %s without --confirm", len(files), name)
+	}
+
+	lock, err := safefile.Acquire(files...)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	var records []audit.Record
+	for _, file := range files {
+		if err := os.Remove(file); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", relativeSource(rootDir, file), err)
+		}
+		color.Cyan("  deleted %s", relativeSource(rootDir, file))
+		records = append(records, audit.Record{File: relativeSource(rootDir, file)})
+	}
+	color.Green("Removed app %s (%d file(s))", name, len(files))
+	printAppReferences(rootDir, name, refs, unreadable)
+
+	return store.RecordAudit(rootDir, "app rm", records...)
+}
+
+func appRenameAction(c *cli.Context) error {
+	args, err := positionalArgs(c)
+	if err != nil {
+		return err
+	}
+	if len(args) != 2 {
+		return fmt.Errorf("expected OLD and NEW app names")
+	}
+	oldName, newName := args[0], args[1]
+	rootDir := c.String("root")
+	updateRefs := c.Bool("update-refs")
+
+	if err := validateAppName(newName); err != nil {
+		return err
+	}
+	files, err := appFiles(rootDir, oldName)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("app not found: %s", oldName)
+	}
+	if existing, err := appFiles(rootDir, newName); err != nil {
+		return err
+	} else if len(existing) > 0 {
+		return fmt.Errorf("app %s already exists in %d file(s)", newName, len(existing))
+	}
+
+	// Any config file may reference the app, so all of them are locked, with
+	// the files the app's files are renamed to
+	locked, err := listConfigFiles(rootDir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		newFile, err := appLevelFile(rootDir, file, newName)
+		if err != nil {
+			return err
+		}
+		locked = append(locked, newFile)
+	}
+	lock, err := safefile.Acquire(locked...)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	// Plan every change before writing anything, so references that can't be
+	// rewritten don't leave the app half-renamed
+	refs, unreadable, err := appReferences(rootDir, oldName, nil)
+	if err != nil {
+		return err
+	}
+	if len(refs) > 0 && !updateRefs {
+		printAppReferences(rootDir, oldName, refs, nil)
+		return fmt.Errorf("%d file(s) reference app %s (use --update-refs to rewrite them)", len(refs), oldName)
+	}
+
+	var directoryAgeKeys []string
+	if len(refs) > 0 {
+		if directoryAgeKeys, err = store.DirectoryKeys(rootDir); err != nil {
+			return fmt.Errorf("failed to check directory encryption: %w", err)
+		}
+		if len(directoryAgeKeys) == 0 {
+			return fmt.Errorf("no encryption keys found in directory - run 'puff init' first to initialize with encryption keys")
+		}
+	}
+
+	renamed := make(map[string]string)
+	var records []audit.Record
+	for _, file := range files {
+		newFile, err := appLevelFile(rootDir, file, newName)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(newFile), 0700); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", relativeSource(rootDir, newFile), err)
+		}
+		if err := os.Rename(file, newFile); err != nil {
+			return fmt.Errorf("failed to rename %s: %w", relativeSource(rootDir, file), err)
+		}
+		renamed[file] = newFile
+		color.Cyan("  renamed %s to %s", relativeSource(rootDir, file), relativeSource(rootDir, newFile))
+		records = append(records, audit.Record{File: relativeSource(rootDir, file)}, audit.Record{File: relativeSource(rootDir, newFile)})
+	}
+
+	for _, file := range sortedFiles(refs) {
+		values := refs[file]
+		for key, value := range values {
+			values[key] = renameAppRefs(value, oldName, newName)
+		}
+		// The app's own files may reference it too, and have moved
+		if newFile, ok := renamed[file]; ok {
+			file = newFile
+		}
+		if err := store.Write(file, values, directoryAgeKeys); err != nil {
+			return fmt.Errorf("%s: %w", relativeSource(rootDir, file), err)
+		}
+		color.Cyan("  updated %s", relativeSource(rootDir, file))
+	}
+
+	// Layouts with a directory per app leave the old one empty, once the
+	// lock files are gone
+	lock.Release()
+	for file := range renamed {
+		os.Remove(filepath.Dir(file))
+	}
+
+	color.Green("Renamed app %s to %s in %d file(s)", oldName, newName, len(files))
+	if len(unreadable) > 0 {
+		color.Yellow("%d file(s) could not be decrypted to check for ${app:%s:...} references: %s",
+			len(unreadable), oldName, strings.Join(unreadable, ", "))
+	}
+
+	return store.RecordAudit(rootDir, "app rename", records...)
+}
+
+// validateAppName checks that a name can be used for an app's files
+func validateAppName(name string) error {
+	if name == "shared" || name == "base" || !appNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid app name: %s (use letters, digits, '-', and '_')", name)
+	}
+	return nil
+}
+
+// appFiles returns the config files of an app at every level, in path order
+func appFiles(rootDir, app string) ([]string, error) {
+	project, err := config.LoadProject(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	files, err := listConfigFiles(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	for _, file := range files {
+		if level, ok := project.FileLevel(relativeSource(rootDir, file)); ok && level.App == app {
+			result = append(result, file)
+		}
+	}
+	return result, nil
+}
+
+// appLevelFile returns the file another app has at the level of an app's
+// file, with the same extension
+func appLevelFile(rootDir, file, app string) (string, error) {
+	project, err := config.LoadProject(rootDir)
+	if err != nil {
+		return "", err
+	}
+	level, ok := project.FileLevel(relativeSource(rootDir, file))
+	if !ok {
+		return "", fmt.Errorf("%s is not an app file", relativeSource(rootDir, file))
+	}
+	level.App = app
+	return config.TrimConfigExt(project.LevelFile(rootDir, level)) + filepath.Ext(file), nil
+}
+
+// appReferences returns the decrypted values of the config files that
+// reference an app's keys as ${app:NAME:KEY}, other than the excluded files,
+// and the files that could not be decrypted to check
+func appReferences(rootDir, app string, exclude []string) (map[string]map[string]interface{}, []string, error) {
+	files, err := listConfigFiles(rootDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	excluded := make(map[string]bool)
+	for _, file := range exclude {
+		excluded[file] = true
+	}
+
+	refs := make(map[string]map[string]interface{})
+	var unreadable []string
+	for _, file := range files {
+		if excluded[file] {
+			continue
+		}
+		values, err := store.Read(file)
+		if err != nil {
+			unreadable = append(unreadable, relativeSource(rootDir, file))
+			continue
+		}
+		if referencesApp(values, app) {
+			refs[file] = values
+		}
+	}
+	return refs, unreadable, nil
+}
+
+// referencesApp reports whether a value, or any value nested in it,
+// references an app's keys
+func referencesApp(value interface{}, app string) bool {
+	switch v := value.(type) {
+	case string:
+		for _, name := range templating.References(v) {
+			if strings.HasPrefix(name, "app:"+app+":") {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, nested := range v {
+			if referencesApp(nested, app) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, nested := range v {
+			if referencesApp(nested, app) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// renameAppRefs rewrites ${app:OLD:KEY} references in a value and the values
+// nested in it
+func renameAppRefs(value interface{}, oldApp, newApp string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return templating.RenameApp(v, oldApp, newApp)
+	case map[string]interface{}:
+		for key, nested := range v {
+			v[key] = renameAppRefs(nested, oldApp, newApp)
+		}
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = renameAppRefs(nested, oldApp, newApp)
+		}
+	}
+	return value
+}
+
+// printAppReferences warns about the files that reference an app's keys,
+// and the files that couldn't be checked
+func printAppReferences(rootDir, app string, refs map[string]map[string]interface{}, unreadable []string) {
+	if len(refs) > 0 {
+		color.Yellow("%d file(s) reference app %s with ${app:%s:...}:", len(refs), app, app)
+		for _, file := range sortedFiles(refs) {
+			color.Yellow("  %s", relativeSource(rootDir, file))
+		}
+	}
+	if len(unreadable) > 0 {
+		color.Yellow("%d file(s) could not be decrypted to check for references: %s", len(unreadable), strings.Join(unreadable, ", "))
+	}
+}
+
+// sortedFiles returns the files of a map of file values in path order
+func sortedFiles(files map[string]map[string]interface{}) []string {
+	result := make([]string, 0, len(files))
+	for file := range files {
+		result = append(result, file)
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,166 @@
+package commands
+
+import (
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/kube"
+	"github.com/teamcurri/puff/internal/output"
+	"github.com/urfave/cli/v2"
+)
+
+// ApplyCommand creates the apply command for pushing config to a Kubernetes Secret
+func ApplyCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "apply",
+		Usage: "Apply resolved config to a Kubernetes Secret without writing it to disk",
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:     "app",
+				Aliases:  []string{"a"},
+				Usage:    "Application name",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "env",
+				Aliases:  []string{"e"},
+				Usage:    "Environment name",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "target",
+				Aliases: []string{"t"},
+				Usage:   "Target platform (optional)",
+			},
+			&cli.StringFlag{
+				Name:     "secret-name",
+				Usage:    "Kubernetes secret name",
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:  "prune",
+				Usage: "Delete keys from the secret that are not in the config",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "show-values",
+				Usage: "Show values in the change summary instead of masking them",
+				Value: false,
+			},
+			noHostEnvFlag(),
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		}, kubeFlags()...),
+		Action: applyAction,
+	}
+}
+
+// kubeFlags returns the flags that select the Kubernetes cluster and namespace
+func kubeFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "namespace",
+			Aliases: []string{"n"},
+			Usage:   "Kubernetes namespace (defaults to the context's namespace)",
+		},
+		&cli.StringFlag{
+			Name:  "kubeconfig",
+			Usage: "Path to the kubeconfig file (defaults to $KUBECONFIG or ~/.kube/config)",
+		},
+		&cli.StringFlag{
+			Name:  "context",
+			Usage: "Kubeconfig context to use (defaults to the current context)",
+		},
+	}
+}
+
+// kubeClientOptions reads the kubeFlags from the command line
+func kubeClientOptions(c *cli.Context) kube.ClientOptions {
+	return kube.ClientOptions{
+		Kubeconfig: c.String("kubeconfig"),
+		Context:    c.String("context"),
+		Namespace:  c.String("namespace"),
+	}
+}
+
+func applyAction(c *cli.Context) error {
+	app := c.String("app")
+	env := c.String("env")
+	target := c.String("target")
+	prune := c.Bool("prune")
+	showValues := c.Bool("show-values")
+	rootDir := c.String("root")
+
+	secretName, err := kubeSecretName(c, rootDir, app, env, target)
+	if err != nil {
+		return err
+	}
+
+	values, err := exportedValues(config.LoadContext{
+		RootDir:    rootDir,
+		App:        app,
+		Env:        env,
+		Target:     target,
+		Dimensions: dimensionValues(c),
+		NoHostEnv:  c.Bool("no-host-env"),
+	})
+	if err != nil {
+		return err
+	}
+	desired := output.StringValues(values)
+
+	client, namespace, err := kube.NewClient(kubeClientOptions(c))
+	if err != nil {
+		return err
+	}
+
+	live, found, err := kube.GetSecretData(c.Context, client, namespace, secretName)
+	if err != nil {
+		return err
+	}
+
+	// Keys only in the cluster are left alone unless pruning
+	var changes []valueChange
+	kept := 0
+	for _, change := range diffValues(stringMap(live), stringMap(desired)) {
+		if change.Kind == changeRemoved && !prune {
+			kept++
+			continue
+		}
+		changes = append(changes, change)
+	}
+
+	if found && len(changes) == 0 {
+		color.Green("Secret %s/%s is up to date", namespace, secretName)
+	} else {
+		printChanges(changes, showValues)
+
+		if err := kube.ApplySecret(c.Context, client, namespace, secretName, desired, prune); err != nil {
+			return err
+		}
+
+		if found {
+			color.Green("Applied %d change(s) to secret %s/%s", len(changes), namespace, secretName)
+		} else {
+			color.Green("Created secret %s/%s with %d key(s)", namespace, secretName, len(desired))
+		}
+	}
+
+	if kept > 0 {
+		color.Yellow("%d key(s) in the secret are not in the config (use --prune to delete them)", kept)
+	}
+
+	return nil
+}
+
+// stringMap converts a map of strings to a map of config values
+func stringMap(values map[string]string) map[string]interface{} {
+	result := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		result[key] = value
+	}
+	return result
+}
@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// positionalArgs returns a command's positional arguments, first setting the
+// command's flags given after them. urfave/cli stops parsing flags at the
+// first positional argument, so 'puff app create payments --from api' would
+// otherwise read --from and api as names. A "--" ends the flags.
+func positionalArgs(c *cli.Context) ([]string, error) {
+	var args []string
+	rest := c.Args().Slice()
+	for i := 0; i < len(rest); i++ {
+		arg := rest[i]
+		if arg == "--" {
+			return append(args, rest[i+1:]...), nil
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			args = append(args, arg)
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		flag := commandFlag(c.Command, name)
+		if flag == nil {
+			return nil, fmt.Errorf("flag provided but not defined: %s", arg)
+		}
+		if valueFlag, ok := flag.(cli.DocGenerationFlag); ok && !valueFlag.TakesValue() {
+			if !hasValue {
+				value = "true"
+			}
+		} else if !hasValue {
+			if i+1 == len(rest) {
+				return nil, fmt.Errorf("flag needs an argument: %s", arg)
+			}
+			i++
+			value = rest[i]
+		}
+		if err := c.Set(name, value); err != nil {
+			return nil, fmt.Errorf("invalid value %q for flag %s: %w", value, arg, err)
+		}
+	}
+	return args, nil
+}
+
+// commandFlag returns the flag of a command with a name or alias, or nil
+func commandFlag(command *cli.Command, name string) cli.Flag {
+	for _, flag := range command.Flags {
+		for _, flagName := range flag.Names() {
+			if flagName == name {
+				return flag
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/audit"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/urfave/cli/v2"
+)
+
+// AuditCommand creates the audit parent command for the audit log of changes
+func AuditCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "audit",
+		Usage: "Query the audit log of changes made by puff commands",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "show",
+				Usage: "Show audit records, oldest first",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "key",
+						Aliases: []string{"k"},
+						Usage:   "Only show changes to this key",
+					},
+					&cli.StringFlag{
+						Name:  "file",
+						Usage: "Only show changes to this file (relative to the config root)",
+					},
+					&cli.StringFlag{
+						Name:  "actor",
+						Usage: "Only show changes made by actors containing this text",
+					},
+					&cli.StringFlag{
+						Name:  "command",
+						Usage: "Only show changes made by this command (e.g. set, 'keys add')",
+					},
+					&cli.StringFlag{
+						Name:  "since",
+						Usage: "Only show changes on or after this date (YYYY-MM-DD)",
+					},
+					&cli.IntFlag{
+						Name:    "limit",
+						Aliases: []string{"n"},
+						Usage:   "Only show the most recent N records",
+					},
+					&cli.StringFlag{
+						Name:    "format",
+						Aliases: []string{"f"},
+						Usage:   "Output format: table or json",
+						Value:   "table",
+					},
+					&cli.StringFlag{
+						Name:    "root",
+						Aliases: []string{"r"},
+						Usage:   "Root directory for config files",
+						Value:   ".",
+					},
+				},
+				Action: auditShowAction,
+			},
+		},
+	}
+}
+
+func auditShowAction(c *cli.Context) error {
+	format := reportFormat(c)
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unsupported audit format %q (use table or json)", format)
+	}
+	var since time.Time
+	if c.IsSet("since") {
+		var err error
+		if since, err = time.Parse(config.DateFormat, c.String("since")); err != nil {
+			return fmt.Errorf("invalid --since %q (expected YYYY-MM-DD)", c.String("since"))
+		}
+	}
+
+	records, unreadable, err := audit.Read(c.String("root"))
+	if err != nil {
+		return err
+	}
+
+	matches := []audit.Record{}
+	for _, record := range records {
+		switch {
+		case c.IsSet("key") && record.Key != c.String("key"),
+			c.IsSet("file") && record.File != c.String("file"),
+			c.IsSet("actor") && !strings.Contains(record.Actor, c.String("actor")),
+			c.IsSet("command") && record.Command != c.String("command"),
+			record.Time.Before(since):
+			continue
+		}
+		matches = append(matches, record)
+	}
+	if limit := c.Int("limit"); limit > 0 && len(matches) > limit {
+		matches = matches[len(matches)-limit:]
+	}
+
+	if format == "json" {
+		data, err := json.MarshalIndent(matches, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal audit records: %w", err)
+		}
+		fmt.Println(string(data))
+	} else if len(matches) == 0 {
+		color.Yellow("No audit records found")
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tACTOR\tCOMMAND\tTARGET\tOLD\tNEW")
+		for _, record := range matches {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", record.Time.Local().Format("2006-01-02 15:04:05"), record.Actor,
+				record.Command, auditTarget(record), shortHash(record.OldHash), shortHash(record.NewHash))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if unreadable > 0 {
+		printWarning(format == "json", "%d record(s) could not be decrypted with the available keys", unreadable)
+	}
+	return nil
+}
+
+// auditTarget describes what a record changed: a key in a file, a whole
+// file, or an encryption key
+func auditTarget(record audit.Record) string {
+	switch {
+	case record.Recipient != "" && record.Env != "":
+		return fmt.Sprintf("%s (env %s)", record.Recipient, record.Env)
+	case record.Recipient != "":
+		return record.Recipient
+	case record.Key != "":
+		return fmt.Sprintf("%s:%s", record.File, record.Key)
+	default:
+		return record.File
+	}
+}
+
+// shortHash abbreviates a value hash for display, or shows "-" if the value
+// didn't exist
+func shortHash(hash string) string {
+	if hash == "" {
+		return "-"
+	}
+	if len(hash) > 19 {
+		return hash[:19]
+	}
+	return hash
+}
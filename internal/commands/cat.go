@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/getsops/sops/v3/decrypt"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// CatCommand creates the cat command for printing a decrypted file
+func CatCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "cat",
+		Usage: "Print a decrypted file to stdout (no .dec file is created)",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "file",
+				Aliases:  []string{"f"},
+				Usage:    "File to print",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "path",
+				Aliases: []string{"p"},
+				Usage:   "Only print the value at a key or dotted path, e.g. DB_CONFIG.credentials",
+			},
+		},
+		Action: catAction,
+	}
+}
+
+func catAction(c *cli.Context) error {
+	absPath, err := filepath.Abs(c.String("file"))
+	if err != nil {
+		return fmt.Errorf("failed to resolve path: %w", err)
+	}
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("file does not exist: %s", absPath)
+		}
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var yamlData map[string]interface{}
+	if err := yaml.Unmarshal(data, &yamlData); err != nil {
+		return fmt.Errorf("file is not valid YAML: %w", err)
+	}
+
+	// Decrypt in memory; plaintext files, such as the plaintext stores of
+	// split levels, are printed as they are
+	if _, hasSops := yamlData["sops"]; hasSops {
+		data, err = decrypt.Data(data, "yaml")
+		if err != nil {
+			return fmt.Errorf("failed to decrypt file: %w", err)
+		}
+	}
+
+	path := c.String("path")
+	if path == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	value, exists := config.Lookup(values, path)
+	if !exists {
+		return fmt.Errorf("path not found in %s: %s", absPath, path)
+	}
+
+	// Scalars are printed bare for piping, maps and lists as YAML
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		out, err := yaml.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("failed to marshal YAML: %w", err)
+		}
+		_, err = os.Stdout.Write(out)
+		return err
+	default:
+		fmt.Println(displayValue(value))
+		return nil
+	}
+}
@@ -0,0 +1,339 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/keys"
+	"github.com/teamcurri/puff/internal/safefile"
+	"github.com/teamcurri/puff/internal/scan"
+	"github.com/urfave/cli/v2"
+)
+
+// Exit codes of ci-check, one for each check, growing with the severity of
+// the failure. A run that fails several checks exits with the highest, so a
+// pipeline can warn below a threshold and fail above it. Exit code 1 means
+// puff itself failed, e.g. on a bad flag.
+const (
+	ciLintExitCode   = 2
+	ciSchemaExitCode = 3
+	ciVerifyExitCode = 4
+	ciScanExitCode   = 5
+)
+
+// ciFinding is a problem found by one of the checks of ci-check
+type ciFinding struct {
+	Check    string `json:"check"`
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"` // error or warning
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Message  string `json:"message"`
+	// fails is set for findings that fail the check: errors, and warnings
+	// with --strict
+	fails bool
+}
+
+// ciCheckResult is the outcome of one check
+type ciCheckResult struct {
+	Name     string      `json:"name"`
+	Files    int         `json:"files"` // Files checked
+	Failed   bool        `json:"failed"`
+	Findings []ciFinding `json:"findings"`
+}
+
+// ciReport is the result of ci-check. ExitCode is 0 if every check passed.
+type ciReport struct {
+	Checks   []ciCheckResult `json:"checks"`
+	ExitCode int             `json:"exit_code"`
+}
+
+// ciCheck is one of the checks ci-check runs, in order
+type ciCheck struct {
+	name     string
+	exitCode int
+	run      func(c *cli.Context, rootDir string) (ciCheckResult, error)
+}
+
+// ciChecks are the checks of ci-check, in the order they run
+var ciChecks = []ciCheck{
+	{name: "schema", exitCode: ciSchemaExitCode, run: ciSchemaCheck},
+	{name: "verify", exitCode: ciVerifyExitCode, run: ciVerifyCheck},
+	{name: "lint", exitCode: ciLintExitCode, run: ciLintCheck},
+	{name: "scan", exitCode: ciScanExitCode, run: ciScanCheck},
+}
+
+// CICheckCommand creates the ci-check command, which runs every check a
+// pipeline needs and reports them together
+func CICheckCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "ci-check",
+		Usage: "Run the schema, verify, lint, and plaintext scan checks for CI, with a JUnit or SARIF report",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"f"},
+				Usage:   "Report format: text, junit, sarif, or json",
+				Value:   "text",
+			},
+			&cli.StringFlag{
+				Name:  "report-file",
+				Usage: "Write the report to a file and print a text summary instead",
+			},
+			&cli.StringSliceFlag{
+				Name:  "skip",
+				Usage: "Skip a check: schema, verify, lint, or scan (repeatable)",
+			},
+			&cli.BoolFlag{
+				Name:  "strict",
+				Usage: "Fail the lint check on warnings too",
+			},
+			&cli.BoolFlag{
+				Name:  "allow-missing-recipients",
+				Usage: "Accept files that aren't encrypted to every key in .sops.yaml",
+			},
+			&cli.StringFlag{
+				Name:  "min-severity",
+				Usage: "Only report plaintext secrets at least this severe: low, medium, high, or critical",
+				Value: string(scan.SeverityLow),
+			},
+			&cli.StringSliceFlag{
+				Name:  "exclude",
+				Usage: "Skip files and directories matching this glob in the plaintext scan (repeatable)",
+			},
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: ciCheckAction,
+	}
+}
+
+func ciCheckAction(c *cli.Context) error {
+	rootDir := c.String("root")
+	format := reportFormat(c)
+	if format != "text" && format != "junit" && format != "sarif" && format != "json" {
+		return fmt.Errorf("unsupported report format %q (use text, junit, sarif, or json)", format)
+	}
+	reportFile := c.String("report-file")
+	if reportFile != "" && format == "text" {
+		return fmt.Errorf("--report-file needs --format junit, sarif, or json")
+	}
+	skip := c.StringSlice("skip")
+	for _, name := range skip {
+		if !slices.ContainsFunc(ciChecks, func(check ciCheck) bool { return check.name == name }) {
+			return fmt.Errorf("unknown check %q (use schema, verify, lint, or scan)", name)
+		}
+	}
+	if _, err := scan.ParseSeverity(c.String("min-severity")); err != nil {
+		return err
+	}
+
+	report := &ciReport{Checks: []ciCheckResult{}}
+	for _, check := range ciChecks {
+		if slices.Contains(skip, check.name) {
+			continue
+		}
+		result, err := check.run(c, rootDir)
+		if err != nil {
+			// A check that can't run fails, and the others still run
+			result = ciCheckResult{Findings: []ciFinding{{Rule: "error", Severity: config.LintError, Message: err.Error(), fails: true}}}
+		}
+		result.Name = check.name
+		for i := range result.Findings {
+			result.Findings[i].Check = check.name
+			result.Failed = result.Failed || result.Findings[i].fails
+		}
+		if result.Failed {
+			report.ExitCode = max(report.ExitCode, check.exitCode)
+		}
+		report.Checks = append(report.Checks, result)
+	}
+
+	var output []byte
+	var err error
+	switch format {
+	case "junit":
+		output, err = ciJUnitReport(report)
+	case "sarif":
+		output, err = ciSARIFReport(report, rootDir, c.App.Version)
+	case "json":
+		output, err = ciJSONReport(report)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case reportFile != "":
+		if err := safefile.Write(reportFile, output, 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", reportFile, err)
+		}
+		printCIReport(report)
+		fmt.Printf("Report written to %s\n", reportFile)
+	case format == "text":
+		printCIReport(report)
+	default:
+		os.Stdout.Write(output)
+	}
+
+	if report.ExitCode != 0 {
+		return cli.Exit("", report.ExitCode)
+	}
+	return nil
+}
+
+// ciSchemaCheck checks that the project's own files parse and hold valid
+// settings: .puff.yaml, .sops.yaml, keys.yml, and meta.yml. Only .sops.yaml
+// is required.
+func ciSchemaCheck(c *cli.Context, rootDir string) (ciCheckResult, error) {
+	result := ciCheckResult{Findings: []ciFinding{}}
+	invalid := func(file, message string) {
+		result.Findings = append(result.Findings, ciFinding{Rule: "invalid", Severity: config.LintError, File: file, Message: message, fails: true})
+	}
+
+	loaders := []struct {
+		file     string
+		required bool
+		load     func() error
+	}{
+		{config.ProjectFile, false, func() error { _, err := config.LoadProject(rootDir); return err }},
+		{".sops.yaml", true, func() error {
+			sopsConfig, err := keys.LoadSOPSConfig(rootDir)
+			if err != nil {
+				return err
+			}
+			for _, rule := range sopsConfig.CreationRules {
+				if _, err := regexp.Compile(rule.PathRegex); err != nil {
+					return fmt.Errorf("invalid path_regex %q: %w", rule.PathRegex, err)
+				}
+			}
+			return nil
+		}},
+		{keys.RegistryFile, false, func() error { _, err := keys.LoadRegistry(rootDir); return err }},
+		{config.MetadataFile, false, func() error { _, err := config.LoadMetadata(rootDir); return err }},
+	}
+	for _, loader := range loaders {
+		if _, err := os.Stat(filepath.Join(rootDir, loader.file)); os.IsNotExist(err) {
+			if loader.required {
+				invalid(loader.file, "missing; run 'puff init' to create it")
+			}
+			continue
+		}
+		result.Files++
+		if err := loader.load(); err != nil {
+			invalid(loader.file, err.Error())
+		}
+	}
+	return result, nil
+}
+
+// ciVerifyCheck runs verify on the working tree
+func ciVerifyCheck(c *cli.Context, rootDir string) (ciCheckResult, error) {
+	report, err := verifyWorkingTree(rootDir, c.Bool("allow-missing-recipients"))
+	if err != nil {
+		return ciCheckResult{}, err
+	}
+	result := ciCheckResult{Files: report.FilesChecked, Findings: []ciFinding{}}
+	for _, problem := range report.Problems {
+		result.Findings = append(result.Findings, ciFinding{Rule: problem.Kind, Severity: config.LintError, File: problem.Path, Message: problem.Detail, fails: true})
+	}
+	return result, nil
+}
+
+// ciLintCheck runs lint, failing on errors, or on warnings too with --strict
+func ciLintCheck(c *cli.Context, rootDir string) (ciCheckResult, error) {
+	findings, fileCount, err := runLint(rootDir)
+	if err != nil {
+		return ciCheckResult{}, err
+	}
+	result := ciCheckResult{Files: fileCount, Findings: []ciFinding{}}
+	for _, finding := range findings {
+		result.Findings = append(result.Findings, ciFinding{
+			Rule:     finding.Rule,
+			Severity: finding.Severity,
+			File:     finding.File,
+			Message:  finding.Message,
+			fails:    finding.Severity == config.LintError || c.Bool("strict"),
+		})
+	}
+	return result, nil
+}
+
+// ciScanCheck scans every file under the root directory for plaintext
+// secrets
+func ciScanCheck(c *cli.Context, rootDir string) (ciCheckResult, error) {
+	minSeverity, _ := scan.ParseSeverity(c.String("min-severity"))
+	excludes := c.StringSlice("exclude")
+	for _, pattern := range excludes {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return ciCheckResult{}, fmt.Errorf("invalid --exclude pattern %q: %w", pattern, err)
+		}
+	}
+
+	findings, filesScanned, err := scanFiles(rootDir, minSeverity, excludes)
+	if err != nil {
+		return ciCheckResult{}, err
+	}
+	result := ciCheckResult{Files: filesScanned, Findings: []ciFinding{}}
+	for _, finding := range findings {
+		result.Findings = append(result.Findings, ciFinding{
+			Rule:     finding.Rule,
+			Severity: config.LintError,
+			File:     finding.File,
+			Line:     finding.Line,
+			Message:  fmt.Sprintf("suspected %s secret %s", finding.Severity, finding.Match),
+			fails:    true,
+		})
+	}
+	return result, nil
+}
+
+// printCIReport prints the outcome of each check and its findings
+func printCIReport(report *ciReport) {
+	for _, check := range report.Checks {
+		switch {
+		case check.Failed:
+			color.Red("✗ %s: %d problem(s) in %d file(s)", check.Name, len(check.Findings), check.Files)
+		case len(check.Findings) > 0:
+			color.Yellow("✓ %s: %d warning(s) in %d file(s)", check.Name, len(check.Findings), check.Files)
+		default:
+			color.Green("✓ %s: %d file(s) checked, no problems found", check.Name, check.Files)
+		}
+		for _, finding := range check.Findings {
+			fmt.Printf("  %s: %s (%s)\n", ciLocation(finding), finding.Message, finding.Rule)
+		}
+	}
+
+	if report.ExitCode == 0 {
+		color.Green("\nAll checks passed")
+		return
+	}
+	var failed []string
+	for _, check := range report.Checks {
+		if check.Failed {
+			failed = append(failed, check.Name)
+		}
+	}
+	color.Red("\nFailed checks: %s (exit code %d)", strings.Join(failed, ", "), report.ExitCode)
+}
+
+// ciLocation returns where a finding is, as file or file:line
+func ciLocation(finding ciFinding) string {
+	switch {
+	case finding.File == "":
+		return finding.Check
+	case finding.Line > 0:
+		return fmt.Sprintf("%s:%d", finding.File, finding.Line)
+	}
+	return finding.File
+}
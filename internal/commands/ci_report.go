@@ -0,0 +1,190 @@
+package commands
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// JUnit XML as read by CI servers: a test suite for each check, and a test
+// case for each finding. Warnings that don't fail the check are passing test
+// cases with the warning as output.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func ciJUnitReport(report *ciReport) ([]byte, error) {
+	suites := junitTestSuites{Name: "puff ci-check"}
+	for _, check := range report.Checks {
+		suite := junitTestSuite{Name: check.Name}
+		for _, finding := range check.Findings {
+			testCase := junitTestCase{Name: ciLocation(finding), ClassName: "puff." + check.Name + "." + finding.Rule}
+			text := fmt.Sprintf("%s: %s (%s)", ciLocation(finding), finding.Message, finding.Rule)
+			if finding.fails {
+				testCase.Failure = &junitFailure{Message: finding.Message, Type: finding.Rule, Text: text}
+				suite.Failures++
+			} else {
+				testCase.SystemOut = text
+			}
+			suite.Cases = append(suite.Cases, testCase)
+		}
+		if len(suite.Cases) == 0 {
+			suite.Cases = append(suite.Cases, junitTestCase{
+				Name:      fmt.Sprintf("%d file(s) checked", check.Files),
+				ClassName: "puff." + check.Name,
+			})
+		}
+		suite.Tests = len(suite.Cases)
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Suites = append(suites.Suites, suite)
+	}
+
+	data, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal JUnit report: %w", err)
+	}
+	return append(append([]byte(xml.Header), data...), '\n'), nil
+}
+
+// SARIF 2.1.0, the format code scanning tools such as GitHub's read. Only
+// the fields puff fills in are declared.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// ciSARIFReport returns the findings as a SARIF log. Rules are named
+// check/rule, and file locations are relative to the working directory, as
+// code scanning expects them relative to the repository root.
+func ciSARIFReport(report *ciReport, rootDir, version string) ([]byte, error) {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "puff",
+			Version:        version,
+			InformationURI: "https://github.com/teamcurri/puff",
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+	}
+	rules := make(map[string]bool)
+	for _, check := range report.Checks {
+		for _, finding := range check.Findings {
+			ruleID := check.Name + "/" + finding.Rule
+			rules[ruleID] = true
+			level := "warning"
+			if finding.fails {
+				level = "error"
+			}
+			result := sarifResult{RuleID: ruleID, Level: level, Message: sarifMessage{Text: finding.Message}}
+			if finding.File != "" {
+				location := sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(filepath.Join(rootDir, finding.File))}}
+				if finding.Line > 0 {
+					location.Region = &sarifRegion{StartLine: finding.Line}
+				}
+				result.Locations = []sarifLocation{{PhysicalLocation: location}}
+			}
+			run.Results = append(run.Results, result)
+		}
+	}
+	for ruleID := range rules {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: ruleID})
+	}
+	sort.Slice(run.Tool.Driver.Rules, func(i, j int) bool {
+		return run.Tool.Driver.Rules[i].ID < run.Tool.Driver.Rules[j].ID
+	})
+
+	log := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}
+	data, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal SARIF report: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+func ciJSONReport(report *ciReport) ([]byte, error) {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal CI report: %w", err)
+	}
+	return append(data, '\n'), nil
+}
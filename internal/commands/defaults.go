@@ -0,0 +1,158 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/urfave/cli/v2"
+)
+
+// defaultRoot is the config root used when -r/--root isn't given: $PUFF_ROOT,
+// or the root found by walking up from the working directory. It is set by
+// ApplyDefaults.
+var defaultRoot = "."
+
+// initRoot is the directory init sets up when --dir isn't given: $PUFF_ROOT,
+// or the root set by defaults.root in the working directory's .puff.yaml.
+// init doesn't walk up, since it creates a root.
+var initRoot = "."
+
+// ApplyDefaults finds the config root, reads the defaults in its .puff.yaml,
+// and uses them as the default values of the matching flags, so flags given
+// on the command line still override them. It must run before
+// AddDimensionFlags, which reads .puff.yaml from the default root.
+func ApplyDefaults(commands []*cli.Command, args []string) error {
+	if _, ok := flagArg(args, "r", "root"); !ok {
+		if root := os.Getenv(config.RootEnvVar); root != "" {
+			defaultRoot, initRoot = root, root
+		} else {
+			var err error
+			if defaultRoot, err = config.FindRoot("."); err != nil {
+				return err
+			}
+			if initRoot, err = config.ResolveRoot("."); err != nil {
+				return err
+			}
+		}
+	}
+	project, err := config.LoadProject(rootFromArgs(args))
+	if err != nil {
+		return err
+	}
+
+	for _, cmd := range commands {
+		applyCommandDefaults(cmd, project, dimensionCommands[cmd.Name])
+	}
+	return nil
+}
+
+// applyCommandDefaults sets the default values of a command's flags, and of
+// its subcommands' flags, from the project's defaults. The default env only
+// applies to commands that load a context, since elsewhere (e.g. keys add)
+// --env limits what a command changes.
+func applyCommandDefaults(cmd *cli.Command, project *config.Project, loadsContext bool) {
+	for _, flag := range cmd.Flags {
+		switch f := flag.(type) {
+		case *cli.StringFlag:
+			switch {
+			case f.Name == "root" && cmd.Name != "scan":
+				// scan searches the whole repository, not just the config root
+				f.Value = defaultRoot
+				f.EnvVars = []string{config.RootEnvVar}
+			case f.Name == "dir" && cmd.Name == "init":
+				f.Value = initRoot
+				f.EnvVars = []string{config.RootEnvVar}
+			case f.Name == "env" && loadsContext && project.Defaults.Env != "":
+				f.Value = project.Defaults.Env
+				f.Required = false
+			case f.Name == "secret-name" && project.Kubernetes.SecretName != "":
+				// The name depends on the context, so the command applies
+				// the naming convention itself
+				f.Required = false
+			}
+		case *cli.StringSliceFlag:
+			if f.Name == "format" && cmd.Name == "generate" && project.Defaults.Format != "" {
+				f.Value = cli.NewStringSlice(splitList(project.Defaults.Format)...)
+				f.Required = false
+			}
+		}
+	}
+	for _, sub := range cmd.Subcommands {
+		applyCommandDefaults(sub, project, loadsContext)
+	}
+}
+
+// kubeSecretName returns --secret-name, or the name the kubernetes.secret_name
+// convention in .puff.yaml gives the context
+func kubeSecretName(c *cli.Context, rootDir, app, env, target string) (string, error) {
+	if name := c.String("secret-name"); name != "" {
+		return name, nil
+	}
+	project, err := config.LoadProject(rootDir)
+	if err != nil {
+		return "", err
+	}
+	if name := project.Kubernetes.SecretNameFor(app, env, target); name != "" {
+		return name, nil
+	}
+	return "", fmt.Errorf("--secret-name is required (or set kubernetes.secret_name in %s)", config.ProjectFile)
+}
+
+// ApplyProfile adds the --profile flag to the commands that load a context
+// and, if a profile is selected in args, uses its values as the default
+// values of the matching flags. It must run after AddDimensionFlags, since
+// profiles can set dimensions.
+func ApplyProfile(commands []*cli.Command, args []string) error {
+	for _, cmd := range commands {
+		if dimensionCommands[cmd.Name] {
+			cmd.Flags = append(cmd.Flags, &cli.StringFlag{
+				Name:  "profile",
+				Usage: fmt.Sprintf("Named set of flags from %s (flags given on the command line override it)", config.ProjectFile),
+			})
+		}
+	}
+
+	name, ok := flagArg(args, "profile")
+	if !ok {
+		return nil
+	}
+	project, err := config.LoadProject(rootFromArgs(args))
+	if err != nil {
+		return err
+	}
+	profile, err := project.Profile(name)
+	if err != nil {
+		return err
+	}
+	values := profile.Flags()
+	for _, cmd := range commands {
+		if dimensionCommands[cmd.Name] {
+			applyProfileValues(cmd, values)
+		}
+	}
+	return nil
+}
+
+// applyProfileValues sets the default values of a command's flags, and of its
+// subcommands' flags, from a profile's values
+func applyProfileValues(cmd *cli.Command, values map[string]string) {
+	for _, flag := range cmd.Flags {
+		value, ok := values[flag.Names()[0]]
+		// The format of other commands, such as get, takes other values
+		if !ok || (flag.Names()[0] == "format" && cmd.Name != "generate") {
+			continue
+		}
+		switch f := flag.(type) {
+		case *cli.StringFlag:
+			f.Value = value
+			f.Required = false
+		case *cli.StringSliceFlag:
+			f.Value = cli.NewStringSlice(splitList(value)...)
+			f.Required = false
+		}
+	}
+	for _, sub := range cmd.Subcommands {
+		applyProfileValues(sub, values)
+	}
+}
@@ -0,0 +1,272 @@
+package commands
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/git"
+	"github.com/teamcurri/puff/internal/resolve"
+	"github.com/urfave/cli/v2"
+)
+
+// changeKind describes how a key differs between two configs
+type changeKind string
+
+const (
+	changeAdded   changeKind = "added"
+	changeRemoved changeKind = "removed"
+	changeChanged changeKind = "changed"
+)
+
+// valueChange describes a single key that differs between two configs
+type valueChange struct {
+	Key  string      `json:"key"`
+	Kind changeKind  `json:"kind"`
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+// diffReport is the JSON output of diff. Values are only included with
+// --show-values.
+type diffReport struct {
+	From    string        `json:"from"`
+	To      string        `json:"to"`
+	Changes []valueChange `json:"changes"`
+}
+
+// DiffCommand creates the diff command for comparing two environments, or an
+// environment with a past git revision of itself
+func DiffCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "diff",
+		Usage: "Compare resolved config for an app between two environments or against a git revision",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "app",
+				Aliases: []string{"a"},
+				Usage:   "Application name",
+			},
+			&cli.StringFlag{
+				Name:  "from",
+				Usage: "Environment to compare from",
+			},
+			&cli.StringFlag{
+				Name:  "to",
+				Usage: "Environment to compare to",
+			},
+			&cli.StringFlag{
+				Name:  "git",
+				Usage: "Compare the working tree against this git revision (e.g. HEAD~5) instead of another environment",
+			},
+			&cli.StringFlag{
+				Name:    "env",
+				Aliases: []string{"e"},
+				Usage:   "Environment to compare with --git",
+			},
+			&cli.StringFlag{
+				Name:    "target",
+				Aliases: []string{"t"},
+				Usage:   "Target platform (applied to both environments)",
+			},
+			&cli.BoolFlag{
+				Name:  "show-values",
+				Usage: "Show values instead of masking them",
+				Value: false,
+			},
+			noHostEnvFlag(),
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: diffAction,
+	}
+}
+
+func diffAction(c *cli.Context) error {
+	if c.IsSet("git") {
+		if c.IsSet("from") || c.IsSet("to") {
+			return fmt.Errorf("--git compares one environment (-e) with its past; it cannot be used with --from and --to")
+		}
+		return diffGitAction(c)
+	}
+	if !c.IsSet("from") || !c.IsSet("to") {
+		return fmt.Errorf("either --from and --to, or --git, is required")
+	}
+	if c.IsSet("env") {
+		return fmt.Errorf("--env is only used with --git; use --from and --to to compare environments")
+	}
+
+	app := c.String("app")
+	fromEnv := c.String("from")
+	toEnv := c.String("to")
+	target := c.String("target")
+	showValues := c.Bool("show-values")
+	rootDir := c.String("root")
+
+	// Files shared by both environments, such as base/shared.yml, are
+	// decrypted once
+	cache := config.NewFileCache()
+	from, err := loadResolvedConfig(config.LoadContext{
+		RootDir:    rootDir,
+		App:        app,
+		Env:        fromEnv,
+		Target:     target,
+		Dimensions: dimensionValues(c),
+		NoHostEnv:  c.Bool("no-host-env"),
+		Cache:      cache,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", fromEnv, err)
+	}
+
+	to, err := loadResolvedConfig(config.LoadContext{
+		RootDir:    rootDir,
+		App:        app,
+		Env:        toEnv,
+		Target:     target,
+		Dimensions: dimensionValues(c),
+		NoHostEnv:  c.Bool("no-host-env"),
+		Cache:      cache,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", toEnv, err)
+	}
+
+	changes := diffValues(from, to)
+	if jsonOutput(c) {
+		return printDiffJSON(fromEnv, toEnv, changes, showValues)
+	}
+	if len(changes) == 0 {
+		color.Green("No differences between %s and %s", fromEnv, toEnv)
+		return nil
+	}
+
+	printChanges(changes, showValues)
+
+	return nil
+}
+
+// diffGitAction compares the resolved config in the working tree with the
+// same config at a git revision
+func diffGitAction(c *cli.Context) error {
+	rootDir := c.String("root")
+	revision := c.String("git")
+
+	repo, err := git.Open(rootDir)
+	if err != nil {
+		return err
+	}
+	sha, err := repo.ResolveRevision(revision)
+	if err != nil {
+		return err
+	}
+
+	ctx := config.LoadContext{
+		RootDir:    rootDir,
+		App:        c.String("app"),
+		Env:        c.String("env"),
+		Target:     c.String("target"),
+		Dimensions: dimensionValues(c),
+		NoHostEnv:  c.Bool("no-host-env"),
+	}
+	current, err := loadResolvedConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("working tree: %w", err)
+	}
+
+	// The agent only reads the working tree, so resolve the past locally
+	ctx.ReadFile = repo.ReadFileAt(sha)
+	past, err := resolve.Config(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", revision, err)
+	}
+
+	changes := diffValues(past, current)
+	if jsonOutput(c) {
+		return printDiffJSON(revision, "working tree", changes, c.Bool("show-values"))
+	}
+	if len(changes) == 0 {
+		color.Green("No differences between %s and the working tree", revision)
+		return nil
+	}
+
+	printChanges(changes, c.Bool("show-values"))
+
+	return nil
+}
+
+// diffValues compares two sets of config values and returns the keys that
+// were added, removed, or changed going from 'from' to 'to', sorted by key
+func diffValues(from, to map[string]interface{}) []valueChange {
+	var changes []valueChange
+
+	for key, fromValue := range from {
+		toValue, exists := to[key]
+		if !exists {
+			changes = append(changes, valueChange{Key: key, Kind: changeRemoved, From: fromValue})
+		} else if !reflect.DeepEqual(fromValue, toValue) {
+			changes = append(changes, valueChange{Key: key, Kind: changeChanged, From: fromValue, To: toValue})
+		}
+	}
+
+	for key, toValue := range to {
+		if _, exists := from[key]; !exists {
+			changes = append(changes, valueChange{Key: key, Kind: changeAdded, To: toValue})
+		}
+	}
+
+	sortChanges(changes)
+
+	return changes
+}
+
+// sortChanges sorts changes by key
+func sortChanges(changes []valueChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+}
+
+// printDiffJSON prints changes as a diffReport, without values unless
+// showValues is set
+func printDiffJSON(from, to string, changes []valueChange, showValues bool) error {
+	report := diffReport{From: from, To: to, Changes: []valueChange{}}
+	for _, change := range changes {
+		if !showValues {
+			change.From, change.To = nil, nil
+		}
+		report.Changes = append(report.Changes, change)
+	}
+	return printJSON(report, "diff")
+}
+
+// printChanges prints a list of changes, masking values unless showValues is set
+func printChanges(changes []valueChange, showValues bool) {
+	show := func(value interface{}) string {
+		if !showValues {
+			return maskedValue
+		}
+		return displayValue(value)
+	}
+
+	for _, change := range changes {
+		switch change.Kind {
+		case changeAdded:
+			color.Green("+ %s: %s", change.Key, show(change.To))
+		case changeRemoved:
+			color.Red("- %s: %s", change.Key, show(change.From))
+		case changeChanged:
+			if showValues {
+				color.Yellow("~ %s: %s -> %s", change.Key, show(change.From), show(change.To))
+			} else {
+				color.Yellow("~ %s", change.Key)
+			}
+		}
+	}
+}
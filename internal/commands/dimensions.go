@@ -0,0 +1,96 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/urfave/cli/v2"
+)
+
+// dimensionCommands are the commands that load a context and so take a flag
+// for each dimension declared in .puff.yaml
+var dimensionCommands = map[string]bool{
+	"get": true, "list": true, "explain": true, "history": true, "diff": true, "set": true, "unset": true,
+	"generate": true, "template": true, "sample": true, "run": true, "mask": true, "apply": true, "drift": true, "sync": true,
+}
+
+// projectDimensions are the dimensions declared in .puff.yaml, loaded by
+// AddDimensionFlags before the command line is parsed
+var projectDimensions []config.Dimension
+
+// AddDimensionFlags reads .puff.yaml from the root directory given in args
+// and adds a flag for each dimension it declares (e.g. --region) to the
+// commands that load a context
+func AddDimensionFlags(commands []*cli.Command, args []string) error {
+	project, err := config.LoadProject(rootFromArgs(args))
+	if err != nil {
+		return err
+	}
+	projectDimensions = project.Dimensions
+
+	for _, cmd := range commands {
+		if !dimensionCommands[cmd.Name] {
+			continue
+		}
+		for _, dim := range project.Dimensions {
+			for _, flag := range cmd.Flags {
+				for _, name := range flag.Names() {
+					if name == dim.Name {
+						return fmt.Errorf("dimension %s in %s conflicts with the --%s flag of %s", dim.Name, config.ProjectFile, name, cmd.Name)
+					}
+				}
+			}
+			cmd.Flags = append(cmd.Flags, &cli.StringFlag{
+				Name:  dim.Name,
+				Usage: fmt.Sprintf("Value of the %s dimension (from %s)", dim.Name, config.ProjectFile),
+			})
+		}
+	}
+	return nil
+}
+
+// rootFromArgs returns the value of the -r/--root flag in args, which is
+// needed before the command line is parsed, or the default root
+func rootFromArgs(args []string) string {
+	if root, ok := flagArg(args, "r", "root"); ok {
+		return root
+	}
+	return defaultRoot
+}
+
+// flagArg returns the value of a flag in args, which is needed before the
+// command line is parsed, reporting false if it isn't given
+func flagArg(args []string, names ...string) (string, bool) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		for _, name := range names {
+			for _, flag := range []string{"-" + name, "--" + name} {
+				if arg == flag && i+1 < len(args) {
+					return args[i+1], true
+				}
+				if value, ok := strings.CutPrefix(arg, flag+"="); ok {
+					return value, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// dimensionValues returns the dimension values given on the command line,
+// or nil if there are none
+func dimensionValues(c *cli.Context) map[string]string {
+	var values map[string]string
+	for _, dim := range projectDimensions {
+		if value := c.String(dim.Name); value != "" {
+			if values == nil {
+				values = make(map[string]string)
+			}
+			values[dim.Name] = value
+		}
+	}
+	return values
+}
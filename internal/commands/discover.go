@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/urfave/cli/v2"
+)
+
+// AppsCommand creates the apps command for listing apps found in the repo
+func AppsCommand() *cli.Command {
+	return discoverCommand("apps", "List apps found in the config directory", func(l *config.Layout) []string {
+		return l.Apps
+	})
+}
+
+// EnvsCommand creates the envs command for listing environments found in the repo
+func EnvsCommand() *cli.Command {
+	return discoverCommand("envs", "List environments found in the config directory", func(l *config.Layout) []string {
+		return l.Envs
+	})
+}
+
+// TargetsCommand creates the targets command for listing targets found in the repo
+func TargetsCommand() *cli.Command {
+	return discoverCommand("targets", "List targets found in target-overrides/", func(l *config.Layout) []string {
+		return l.Targets
+	})
+}
+
+// discoverCommand builds a command that prints one dimension of the repo layout
+func discoverCommand(name, usage string, selectNames func(*config.Layout) []string) *cli.Command {
+	return &cli.Command{
+		Name:  name,
+		Usage: usage,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "Output as a JSON array",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			layout, err := config.Discover(c.String("root"))
+			if err != nil {
+				return err
+			}
+
+			names := selectNames(layout)
+
+			if c.Bool("json") || jsonOutput(c) {
+				jsonBytes, err := json.Marshal(names)
+				if err != nil {
+					return fmt.Errorf("failed to marshal JSON: %w", err)
+				}
+				fmt.Println(string(jsonBytes))
+				return nil
+			}
+
+			for _, n := range names {
+				fmt.Println(n)
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,177 @@
+package commands
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/urfave/cli/v2"
+)
+
+// dataDictionary is the output of docs: every key of an app across its
+// environments
+type dataDictionary struct {
+	App  string            `json:"app"`
+	Envs []string          `json:"envs"`
+	Keys []dictionaryEntry `json:"keys"`
+}
+
+// dictionaryEntry documents a key. DefinedIn lists the files that set it,
+// relative to the config root, in precedence order; OverriddenIn lists the
+// environments whose own files set it.
+type dictionaryEntry struct {
+	Key          string   `json:"key"`
+	Description  string   `json:"description,omitempty"`
+	Owner        string   `json:"owner,omitempty"`
+	Sensitivity  string   `json:"sensitivity,omitempty"`
+	DefinedIn    []string `json:"defined_in"`
+	OverriddenIn []string `json:"overridden_in"`
+}
+
+// DocsCommand creates the docs command, which renders a data dictionary of
+// an app's keys
+func DocsCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "docs",
+		Usage: "Print a data dictionary of an app's keys: descriptions from meta.yml, the files that define them, and the environments that override them",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "app",
+				Aliases:  []string{"a"},
+				Usage:    "Application name",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "target",
+				Aliases: []string{"t"},
+				Usage:   "Target platform (optional)",
+			},
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"f"},
+				Usage:   "Output format: markdown or json",
+				Value:   "markdown",
+			},
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: docsAction,
+	}
+}
+
+func docsAction(c *cli.Context) error {
+	format := reportFormat(c)
+	if format != "markdown" && format != "json" {
+		return fmt.Errorf("unsupported docs format %q (use markdown or json)", format)
+	}
+
+	dictionary, err := buildDataDictionary(c.String("root"), c.String("app"), c.String("target"))
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		return printJSON(dictionary, "data dictionary")
+	}
+	printDataDictionaryMarkdown(dictionary)
+	return nil
+}
+
+// buildDataDictionary loads an app in every environment of the config root
+// and collects, for each key, the files that define it and the environments
+// whose own files do
+func buildDataDictionary(rootDir, app, target string) (*dataDictionary, error) {
+	layout, err := config.Discover(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	project, err := config.LoadProject(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	metadata, err := config.LoadMetadata(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	envs := append([]string(nil), layout.Envs...)
+	sort.Strings(envs)
+
+	entries := make(map[string]*dictionaryEntry)
+	for _, env := range envs {
+		cfg, err := config.Load(config.LoadContext{RootDir: rootDir, App: app, Env: env, Target: target})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load config for %s: %w", env, err)
+		}
+		for _, key := range cfg.ExportKeys() {
+			entry := entries[key]
+			if entry == nil {
+				meta, _ := metadata.Get(key)
+				entry = &dictionaryEntry{
+					Key:          key,
+					Description:  meta.Description,
+					Owner:        meta.Owner,
+					Sensitivity:  meta.Sensitivity,
+					DefinedIn:    []string{},
+					OverriddenIn: []string{},
+				}
+				entries[key] = entry
+			}
+			overridden := false
+			for _, definition := range cfg.Definitions(key) {
+				file := relativeSource(rootDir, definition.File)
+				if !slices.Contains(entry.DefinedIn, file) {
+					entry.DefinedIn = append(entry.DefinedIn, file)
+				}
+				if level, ok := project.FileLevel(file); ok && level.Env == env {
+					overridden = true
+				}
+			}
+			if overridden {
+				entry.OverriddenIn = append(entry.OverriddenIn, env)
+			}
+		}
+	}
+
+	dictionary := &dataDictionary{App: app, Envs: envs, Keys: make([]dictionaryEntry, 0, len(entries))}
+	for _, entry := range entries {
+		dictionary.Keys = append(dictionary.Keys, *entry)
+	}
+	sort.Slice(dictionary.Keys, func(i, j int) bool {
+		return dictionary.Keys[i].Key < dictionary.Keys[j].Key
+	})
+	return dictionary, nil
+}
+
+func printDataDictionaryMarkdown(dictionary *dataDictionary) {
+	row := func(cells ...string) {
+		for i, cell := range cells {
+			cells[i] = strings.ReplaceAll(strings.ReplaceAll(cell, "|", "\\|"), "\n", " ")
+		}
+		fmt.Printf("| %s |\n", strings.Join(cells, " | "))
+	}
+	list := func(values []string) string {
+		if len(values) == 0 {
+			return "-"
+		}
+		return strings.Join(values, ", ")
+	}
+
+	fmt.Printf("# %s configuration\n", dictionary.App)
+	fmt.Println()
+	if len(dictionary.Keys) == 0 {
+		fmt.Println("No keys found.")
+		return
+	}
+	row("Key", "Description", "Owner", "Sensitivity", "Defined in", "Overridden in")
+	row("---", "---", "---", "---", "---", "---")
+	for _, entry := range dictionary.Keys {
+		row("`"+entry.Key+"`", entry.Description, entry.Owner, entry.Sensitivity, list(entry.DefinedIn), list(entry.OverriddenIn))
+	}
+}
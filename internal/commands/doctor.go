@@ -0,0 +1,308 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/getsops/sops/v3/decrypt"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/keys"
+	"github.com/teamcurri/puff/internal/store"
+	"github.com/urfave/cli/v2"
+)
+
+// doctorExitCode is the exit code used when doctor finds a problem
+const doctorExitCode = 1
+
+// Outcomes of a doctor check
+const (
+	doctorOK      = "ok"
+	doctorWarning = "warning"
+	doctorError   = "error"
+	doctorSkipped = "skipped"
+)
+
+// doctorCheck is the outcome of one check, with how to fix it
+type doctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	Fix    string `json:"fix,omitempty"`
+}
+
+// doctorReport is the JSON output of doctor
+type doctorReport struct {
+	Checks []doctorCheck `json:"checks"`
+}
+
+// DoctorCommand creates the doctor command for diagnosing why config can't
+// be decrypted on this machine
+func DoctorCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "doctor",
+		Usage: "Check this machine's keys and the config root for problems, and suggest fixes",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"f"},
+				Usage:   "Output format: table or json",
+				Value:   "table",
+			},
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: doctorAction,
+	}
+}
+
+func doctorAction(c *cli.Context) error {
+	format := reportFormat(c)
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unsupported doctor format %q (use table or json)", format)
+	}
+
+	checks := doctorChecks(c.String("root"))
+	failed := slices.ContainsFunc(checks, func(check doctorCheck) bool { return check.Status == doctorError })
+
+	if format == "json" {
+		if err := printJSON(doctorReport{Checks: checks}, "doctor report"); err != nil {
+			return err
+		}
+	} else {
+		printDoctorChecks(checks)
+	}
+
+	if failed {
+		return cli.Exit("", doctorExitCode)
+	}
+	return nil
+}
+
+// doctorChecks runs every check against the config root and this machine's
+// age identities
+func doctorChecks(rootDir string) []doctorCheck {
+	identities := keys.FindIdentities()
+	var checks []doctorCheck
+
+	// Age identities SOPS can find
+	var recipients []string
+	var found []string
+	for _, source := range identities {
+		if source.Err != nil {
+			checks = append(checks, doctorCheck{
+				Name:   "identity",
+				Status: doctorError,
+				Detail: fmt.Sprintf("%s can't be read: %v", source.Name, source.Err),
+				Fix:    fmt.Sprintf("Fix or unset %s; it should hold age keys as written by age-keygen", source.Name),
+			})
+			continue
+		}
+		recipients = append(recipients, source.Recipients...)
+		found = append(found, fmt.Sprintf("%s (%d key(s))", source.Name, max(len(source.Recipients), 1)))
+	}
+	defaultFile, _ := keys.DefaultIdentityFile()
+	if len(found) == 0 {
+		checks = append(checks, doctorCheck{
+			Name:   "identity",
+			Status: doctorError,
+			Detail: "no age identity found in SOPS_AGE_KEY, SOPS_AGE_KEY_FILE, " + defaultFile + ", or ~/.ssh",
+			Fix:    fmt.Sprintf("Create a key with 'age-keygen -o %s' (or set SOPS_AGE_KEY), then ask a teammate to run 'puff keys add -k <public key>'", defaultFile),
+		})
+	} else {
+		checks = append(checks, doctorCheck{Name: "identity", Status: doctorOK, Detail: "found " + strings.Join(found, ", ")})
+	}
+
+	// Key files readable by others
+	for _, source := range identities {
+		if source.Path == "" || source.Err != nil {
+			continue
+		}
+		if info, err := os.Stat(source.Path); err == nil && info.Mode().Perm()&0077 != 0 {
+			checks = append(checks, doctorCheck{
+				Name:   "permissions",
+				Status: doctorWarning,
+				Detail: fmt.Sprintf("%s is readable by other users (%04o)", source.Path, info.Mode().Perm()),
+				Fix:    "chmod 600 " + source.Path,
+			})
+		}
+	}
+
+	// Repository format
+	checks = append(checks, formatCheck(rootDir))
+
+	// .sops.yaml
+	sopsConfig, err := keys.LoadSOPSConfig(rootDir)
+	if err != nil {
+		fix := "Fix the YAML syntax of .sops.yaml"
+		if errors.Is(err, os.ErrNotExist) {
+			fix = "Run puff from the config root or pass --root; 'puff init' creates a new one"
+		}
+		checks = append(checks, doctorCheck{Name: "sops_config", Status: doctorError, Detail: err.Error(), Fix: fix})
+		return append(checks,
+			doctorCheck{Name: "recipient", Status: doctorSkipped, Detail: "needs a valid .sops.yaml"},
+			doctorCheck{Name: "decrypt", Status: doctorSkipped, Detail: "needs a valid .sops.yaml"})
+	}
+	configured := sopsConfig.AllKeys()
+	if len(configured) == 0 {
+		checks = append(checks, doctorCheck{
+			Name:   "sops_config",
+			Status: doctorError,
+			Detail: ".sops.yaml has no keys in its creation rules",
+			Fix:    "Add a key with 'puff keys add -k <public key>'",
+		})
+	} else {
+		checks = append(checks, doctorCheck{Name: "sops_config", Status: doctorOK, Detail: fmt.Sprintf(".sops.yaml is valid with %d key(s)", len(configured))})
+	}
+
+	// Whether any of this machine's keys is a recipient
+	checks = append(checks, recipientCheck(configured, recipients))
+
+	// Decrypting a file
+	checks = append(checks, decryptCheck(rootDir, recipients))
+
+	// Decrypted copies lying around
+	if decrypted := decryptedFiles(rootDir); len(decrypted) > 0 {
+		checks = append(checks, doctorCheck{
+			Name:   "permissions",
+			Status: doctorWarning,
+			Detail: fmt.Sprintf("decrypted files left in the config root: %s", strings.Join(decrypted, ", ")),
+			Fix:    "Delete them, or re-encrypt edits with 'puff encrypt'; 'puff cat' and 'puff edit' don't leave plaintext behind",
+		})
+	}
+
+	return checks
+}
+
+// formatCheck checks that the repository is at the format this version of
+// puff writes
+func formatCheck(rootDir string) doctorCheck {
+	project, err := config.LoadProject(rootDir)
+	switch {
+	case err != nil:
+		return doctorCheck{Name: "format", Status: doctorError, Detail: err.Error(), Fix: "Fix " + config.ProjectFile + ", or upgrade puff if the repository was migrated by a newer version"}
+	case project.Format < config.CurrentFormat:
+		return doctorCheck{
+			Name:   "format",
+			Status: doctorWarning,
+			Detail: fmt.Sprintf("the repository is at format %d; the current format is %d", project.Format, config.CurrentFormat),
+			Fix:    "puff migrate",
+		}
+	}
+	return doctorCheck{Name: "format", Status: doctorOK, Detail: fmt.Sprintf("the repository is at format %d", project.Format)}
+}
+
+// recipientCheck checks that one of this machine's keys is in .sops.yaml.
+// Repositories encrypted only to cloud KMS keys don't need an age identity.
+func recipientCheck(configured, recipients []string) doctorCheck {
+	ageKeys := 0
+	for _, key := range configured {
+		if keys.TypeOf(key) == keys.KeyTypeAge {
+			ageKeys++
+			if slices.Contains(recipients, key) {
+				return doctorCheck{Name: "recipient", Status: doctorOK, Detail: fmt.Sprintf("%s is a recipient in .sops.yaml", key)}
+			}
+		}
+	}
+	switch {
+	case ageKeys == 0:
+		return doctorCheck{Name: "recipient", Status: doctorSkipped, Detail: ".sops.yaml has no age keys; cloud KMS access comes from your cloud credentials"}
+	case len(recipients) == 0:
+		return doctorCheck{Name: "recipient", Status: doctorSkipped, Detail: "no public keys known for your identities"}
+	}
+	return doctorCheck{
+		Name:   "recipient",
+		Status: doctorError,
+		Detail: "none of your keys are recipients in .sops.yaml",
+		Fix:    fmt.Sprintf("Ask a teammate who can decrypt to run 'puff keys add -k %s -c \"<your name>\"', then pull", recipients[0]),
+	}
+}
+
+// decryptCheck decrypts a probe file: the base shared file if it is
+// encrypted, otherwise the first encrypted file
+func decryptCheck(rootDir string, recipients []string) doctorCheck {
+	probe := ""
+	candidates, err := listConfigFiles(rootDir)
+	if err != nil {
+		return doctorCheck{Name: "decrypt", Status: doctorError, Detail: err.Error()}
+	}
+	if shared, err := store.LevelFile(rootDir, "", "", ""); err == nil {
+		candidates = append([]string{shared}, candidates...)
+	}
+	for _, file := range candidates {
+		if data, err := os.ReadFile(file); err == nil && isEncryptedYAML(data) {
+			probe = file
+			break
+		}
+	}
+	if probe == "" {
+		return doctorCheck{Name: "decrypt", Status: doctorSkipped, Detail: "no encrypted files to try"}
+	}
+
+	name := relativeSource(rootDir, probe)
+	if _, err := decrypt.File(probe, "yaml"); err != nil {
+		fix := "Set up an age identity (see above)"
+		if len(recipients) > 0 {
+			fix = fmt.Sprintf("%s isn't encrypted to your key: ask a teammate to run 'puff keys add -k %s', or 'puff reencrypt' if .sops.yaml already lists it", name, recipients[0])
+		}
+		return doctorCheck{Name: "decrypt", Status: doctorError, Detail: fmt.Sprintf("failed to decrypt %s: %v", name, err), Fix: fix}
+	}
+	return doctorCheck{Name: "decrypt", Status: doctorOK, Detail: "decrypted " + name}
+}
+
+// decryptedFiles returns the decrypted copies under the root directory,
+// relative to it
+func decryptedFiles(rootDir string) []string {
+	var files []string
+	filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if path != rootDir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isDecryptedFile(path) {
+			files = append(files, relativeSource(rootDir, path))
+		}
+		return nil
+	})
+	return files
+}
+
+// printDoctorChecks prints each check with its fix, then a summary
+func printDoctorChecks(checks []doctorCheck) {
+	problems := 0
+	for _, check := range checks {
+		switch check.Status {
+		case doctorOK:
+			color.Green("✓ %s: %s", check.Name, check.Detail)
+		case doctorSkipped:
+			fmt.Printf("- %s: %s\n", check.Name, check.Detail)
+		case doctorWarning:
+			color.Yellow("! %s: %s", check.Name, check.Detail)
+		default:
+			problems++
+			color.Red("✗ %s: %s", check.Name, check.Detail)
+		}
+		if check.Fix != "" {
+			fmt.Printf("    fix: %s\n", check.Fix)
+		}
+	}
+
+	if problems > 0 {
+		color.Red("\n%d problem(s) found", problems)
+	} else {
+		color.Green("\nNo problems found")
+	}
+}
@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/kube"
+	"github.com/teamcurri/puff/internal/output"
+	"github.com/urfave/cli/v2"
+)
+
+// driftExitCode is the exit code used when the live Secret differs from the config
+const driftExitCode = 1
+
+// DriftCommand creates the drift command for comparing a live Kubernetes Secret with the config
+func DriftCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "drift",
+		Usage: "Compare a live Kubernetes Secret against the resolved config",
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:     "app",
+				Aliases:  []string{"a"},
+				Usage:    "Application name",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "env",
+				Aliases:  []string{"e"},
+				Usage:    "Environment name",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "target",
+				Aliases: []string{"t"},
+				Usage:   "Target platform (optional)",
+			},
+			&cli.StringFlag{
+				Name:     "secret-name",
+				Usage:    "Kubernetes secret name",
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:  "show-values",
+				Usage: "Show values instead of masking them",
+				Value: false,
+			},
+			noHostEnvFlag(),
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		}, kubeFlags()...),
+		Action: driftAction,
+	}
+}
+
+func driftAction(c *cli.Context) error {
+	app := c.String("app")
+	env := c.String("env")
+	target := c.String("target")
+	showValues := c.Bool("show-values")
+	rootDir := c.String("root")
+
+	secretName, err := kubeSecretName(c, rootDir, app, env, target)
+	if err != nil {
+		return err
+	}
+
+	values, err := exportedValues(config.LoadContext{
+		RootDir:    rootDir,
+		App:        app,
+		Env:        env,
+		Target:     target,
+		Dimensions: dimensionValues(c),
+		NoHostEnv:  c.Bool("no-host-env"),
+	})
+	if err != nil {
+		return err
+	}
+
+	client, namespace, err := kube.NewClient(kubeClientOptions(c))
+	if err != nil {
+		return err
+	}
+
+	live, found, err := kube.GetSecretData(c.Context, client, namespace, secretName)
+	if err != nil {
+		return err
+	}
+
+	// Changes are reported from the cluster's point of view: "+" keys are in
+	// the config but missing from the cluster, "-" keys only exist in the cluster
+	changes := diffValues(stringMap(live), stringMap(output.StringValues(values)))
+
+	if !found {
+		color.Red("Secret %s/%s does not exist", namespace, secretName)
+		printChanges(changes, showValues)
+		return cli.Exit("", driftExitCode)
+	}
+
+	if len(changes) == 0 {
+		color.Green("No drift: secret %s/%s matches the config", namespace, secretName)
+		return nil
+	}
+
+	printChanges(changes, showValues)
+	color.Yellow("Secret %s/%s has drifted: %d key(s) differ from the config", namespace, secretName, len(changes))
+
+	return cli.Exit("", driftExitCode)
+}
@@ -0,0 +1,53 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/keys"
+	"github.com/teamcurri/puff/internal/store"
+	"github.com/urfave/cli/v2"
+)
+
+// dryRunFlag creates the --dry-run flag of commands that change files
+func dryRunFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "Show the files, keys, and recipients that would change without writing anything",
+	}
+}
+
+// printDryRunDone ends the report of a dry run
+func printDryRunDone() {
+	color.Yellow("Dry run: nothing was changed")
+}
+
+// printRecipients prints who a file would be encrypted to when written, as
+// store.Write picks them. Plaintext stores have no recipients.
+func printRecipients(rootDir, filePath string, ageKeys []string) error {
+	groups, plain, err := store.Groups(filePath, ageKeys)
+	if err != nil || plain {
+		return err
+	}
+	registry, err := keys.LoadRegistry(rootDir)
+	if err != nil {
+		return err
+	}
+	comments := keyComments(rootDir, registry)
+
+	labels := make([]string, 0, len(groups.Groups))
+	for _, group := range groups.Groups {
+		groupLabels := make([]string, 0, len(group))
+		for _, key := range group {
+			groupLabels = append(groupLabels, recipientLabel(key, comments))
+		}
+		labels = append(labels, strings.Join(groupLabels, ", "))
+	}
+	if groups.IsShamir() {
+		fmt.Printf("  Encrypted to %d of %d groups: %s\n", groups.EffectiveThreshold(), len(groups.Groups), strings.Join(labels, "; "))
+	} else {
+		fmt.Printf("  Encrypted to: %s\n", strings.Join(labels, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/getsops/sops/v3/decrypt"
+	"github.com/teamcurri/puff/internal/keys"
+	"github.com/teamcurri/puff/internal/safefile"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultEditor is used when neither $VISUAL nor $EDITOR is set
+const defaultEditor = "vi"
+
+// EditCommand creates the edit command for editing encrypted files in place
+func EditCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "edit",
+		Usage: "Edit an encrypted file in $EDITOR without leaving plaintext in the repo",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "file",
+				Aliases:  []string{"f"},
+				Usage:    "Encrypted file to edit",
+				Required: true,
+			},
+		},
+		Action: editAction,
+	}
+}
+
+func editAction(c *cli.Context) error {
+	filePath := c.String("file")
+
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path: %w", err)
+	}
+
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("file does not exist: %s", absPath)
+		}
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var yamlData map[string]interface{}
+	if err := yaml.Unmarshal(data, &yamlData); err != nil {
+		return fmt.Errorf("file is not valid YAML: %w", err)
+	}
+
+	if _, hasSops := yamlData["sops"]; !hasSops {
+		return fmt.Errorf("file is not SOPS-encrypted: %s", absPath)
+	}
+
+	// Re-encrypt with the same key groups the file already has
+	groups := keys.ExtractKeyGroups(yamlData)
+	if len(keys.ExtractKeys(yamlData)) == 0 {
+		return fmt.Errorf("no encryption keys found in %s", absPath)
+	}
+
+	decrypted, err := decrypt.File(absPath, "yaml")
+	if err != nil {
+		return fmt.Errorf("failed to decrypt file: %w", err)
+	}
+
+	// Plaintext goes to the system temp directory, never next to the original
+	tmpFile, err := os.CreateTemp("", "puff-edit-*.yml")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmpFile.Write(decrypted); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	if err := runEditor(tmpPath); err != nil {
+		return err
+	}
+
+	edited, err := os.ReadFile(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to read edited file: %w", err)
+	}
+
+	if bytes.Equal(edited, decrypted) {
+		color.Yellow("No changes made to %s", absPath)
+		return nil
+	}
+
+	// Validate before touching the encrypted file
+	var editedYaml map[string]interface{}
+	if err := yaml.Unmarshal(edited, &editedYaml); err != nil {
+		return fmt.Errorf("edited file is not valid YAML, %s left unchanged: %w", absPath, err)
+	}
+	if _, hasSops := editedYaml["sops"]; hasSops {
+		return fmt.Errorf("edited file must not contain a top-level 'sops' key, %s left unchanged", absPath)
+	}
+
+	encrypted, err := keys.EncryptDataWithGroups(edited, absPath, groups)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt file: %w", err)
+	}
+
+	if err := safefile.Write(absPath, encrypted, 0600); err != nil {
+		return err
+	}
+
+	color.Green("Updated %s (encrypted)", absPath)
+
+	return nil
+}
+
+// runEditor opens the given file in the user's editor and waits for it to exit
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = defaultEditor
+	}
+
+	// Allow editors with arguments, e.g. EDITOR="code --wait"
+	parts := strings.Fields(editor)
+	cmd := exec.Command(parts[0], append(parts[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor exited with error: %w", err)
+	}
+
+	return nil
+}
@@ -7,7 +7,10 @@ import (
 	"strings"
 
 	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/audit"
 	"github.com/teamcurri/puff/internal/keys"
+	"github.com/teamcurri/puff/internal/safefile"
+	"github.com/teamcurri/puff/internal/store"
 	"github.com/urfave/cli/v2"
 	"gopkg.in/yaml.v3"
 )
@@ -24,6 +27,12 @@ func EncryptCommand() *cli.Command {
 				Usage:    "Decrypted file to encrypt (must have .dec extension)",
 				Required: true,
 			},
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files, where changes are audited",
+				Value:   ".",
+			},
 		},
 		Action: encryptAction,
 	}
@@ -54,8 +63,14 @@ func encryptAction(c *cli.Context) error {
 		return fmt.Errorf("unexpected file extension: %s", decFilePath)
 	}
 
+	lock, err := safefile.Acquire(encFilePath)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
 	// Get encryption keys from the original file if it exists, otherwise from directory
-	var ageKeys []string
+	var groups keys.KeyGroups
 	if _, err := os.Stat(encFilePath); err == nil {
 		// Original file exists, extract its keys
 		data, err := os.ReadFile(encFilePath)
@@ -68,25 +83,25 @@ func encryptAction(c *cli.Context) error {
 			return fmt.Errorf("failed to parse original file: %w", err)
 		}
 
-		ageKeys = keys.ExtractAgeKeys(yamlData)
+		groups = keys.ExtractKeyGroups(yamlData)
 	}
 
 	// If no keys found from original file, get from directory
-	if len(ageKeys) == 0 {
+	if len(groups.Groups) == 0 || len(groups.Groups[0]) == 0 {
 		rootDir := filepath.Dir(filepath.Dir(encFilePath)) // Go up to root
 		if rootDir == "." {
 			rootDir, _ = os.Getwd()
 		}
 
-		var err error
-		ageKeys, err = getDirectoryEncryptionKeys(rootDir)
+		recipients, err := store.DirectoryKeys(rootDir)
 		if err != nil {
 			return fmt.Errorf("failed to get encryption keys: %w", err)
 		}
 
-		if len(ageKeys) == 0 {
+		if len(recipients) == 0 {
 			return fmt.Errorf("no encryption keys found - cannot encrypt file")
 		}
+		groups = keys.SingleGroup(recipients)
 	}
 
 	// Read decrypted content
@@ -101,15 +116,20 @@ func encryptAction(c *cli.Context) error {
 		return fmt.Errorf("decrypted file is not valid YAML: %w", err)
 	}
 
-	// Write to original location (will be encrypted)
-	if err := os.WriteFile(encFilePath, decData, 0600); err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+	// Read the current values, if possible, to audit what changed
+	oldValues, oldErr := store.Read(encFilePath)
+	if os.IsNotExist(oldErr) {
+		oldValues, oldErr = map[string]interface{}{}, nil
 	}
 
-	// Encrypt the file
-	if err := keys.EncryptFile(encFilePath, ageKeys); err != nil {
+	// Encrypt in memory and replace the original in one step
+	encrypted, err := keys.EncryptDataWithGroups(decData, encFilePath, groups)
+	if err != nil {
 		return fmt.Errorf("failed to encrypt file: %w", err)
 	}
+	if err := safefile.Write(encFilePath, encrypted, 0600); err != nil {
+		return err
+	}
 
 	// Remove the .dec file - critical for security
 	if err := os.Remove(decFilePath); err != nil {
@@ -121,5 +141,29 @@ func encryptAction(c *cli.Context) error {
 	color.Green("Encrypted %s to %s", decFilePath, encFilePath)
 	color.Green("Removed temporary decrypted file")
 
-	return nil
+	rootDir := c.String("root")
+	file := relativeSource(rootDir, encFilePath)
+	if oldErr != nil {
+		// The previous values are unknown, so record the file as a whole
+		return store.RecordAudit(rootDir, "encrypt", audit.Record{File: file, NewHash: audit.Hash(string(decData))})
+	}
+	delete(testYaml, "sops")
+	return store.RecordAudit(rootDir, "encrypt", changeRecords(file, oldValues, testYaml)...)
+}
+
+// changeRecords returns an audit record for each key whose value differs
+// between the old and new values of a file, in key order
+func changeRecords(file string, oldValues, newValues map[string]interface{}) []audit.Record {
+	var records []audit.Record
+	for _, change := range diffValues(oldValues, newValues) {
+		record := audit.Record{File: file, Key: change.Key}
+		if change.Kind != changeAdded {
+			record.OldHash = audit.Hash(change.From)
+		}
+		if change.Kind != changeRemoved {
+			record.NewHash = audit.Hash(change.To)
+		}
+		records = append(records, record)
+	}
+	return records
 }
@@ -0,0 +1,280 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/audit"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/keys"
+	"github.com/teamcurri/puff/internal/safefile"
+	"github.com/teamcurri/puff/internal/store"
+	"github.com/urfave/cli/v2"
+)
+
+// EnvCommand creates the env parent command for managing environments as a whole
+func EnvCommand() *cli.Command {
+	rootFlag := &cli.StringFlag{
+		Name:    "root",
+		Aliases: []string{"r"},
+		Usage:   "Root directory for config files",
+		Value:   ".",
+	}
+
+	return &cli.Command{
+		Name:  "env",
+		Usage: "Create and remove environments, optionally with their own encryption keys",
+		Subcommands: []*cli.Command{
+			{
+				Name:      "create",
+				Usage:     "Create an environment directory, optionally encrypted to its own keys",
+				ArgsUsage: "NAME",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:    "keys",
+						Aliases: []string{"k"},
+						Usage:   "Keys the environment's files are encrypted to instead of the default keys (comma-separated or repeatable)",
+					},
+					rootFlag,
+				},
+				Action: envCreateAction,
+			},
+			{
+				Name:      "rm",
+				Usage:     "Delete an environment's files, including its target overrides, and its keys in .sops.yaml",
+				ArgsUsage: "NAME",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "confirm",
+						Usage: "Delete the files (without it, the files are only listed)",
+					},
+					rootFlag,
+				},
+				Action: envRmAction,
+			},
+		},
+	}
+}
+
+func envCreateAction(c *cli.Context) error {
+	args, err := positionalArgs(c)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("expected an environment NAME")
+	}
+	name := args[0]
+	rootDir := c.String("root")
+
+	if err := validateEnvNames([]string{name}); err != nil {
+		return err
+	}
+	envKeys := make([]string, 0, len(c.StringSlice("keys")))
+	for _, key := range c.StringSlice("keys") {
+		key = keys.NormalizeKey(strings.TrimSpace(key))
+		if err := keys.ValidateKey(key); err != nil {
+			if keys.TypeOf(key) != keys.KeyTypeAge {
+				return err
+			}
+			return fmt.Errorf("invalid age key: %w", err)
+		}
+		envKeys = append(envKeys, key)
+	}
+
+	layout, err := config.Discover(rootDir)
+	if err != nil {
+		return err
+	}
+	if len(envKeys) > 0 {
+		project, err := config.LoadProject(rootDir)
+		if err != nil {
+			return err
+		}
+		if project.Layout.Custom() {
+			return fmt.Errorf("environments with their own keys need the standard layout; the layout in %s isn't supported by their creation rules", config.ProjectFile)
+		}
+	}
+	for _, env := range layout.Envs {
+		if env == name {
+			return fmt.Errorf("environment %s already exists", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(rootDir, name)); err == nil {
+		return fmt.Errorf("environment %s already exists", name)
+	}
+
+	directoryAgeKeys, err := store.DirectoryKeys(rootDir)
+	if err != nil {
+		return fmt.Errorf("failed to check directory encryption: %w", err)
+	}
+	if len(directoryAgeKeys) == 0 {
+		return fmt.Errorf("no encryption keys found in directory - run 'puff init' first to initialize with encryption keys")
+	}
+
+	// Locking creates the environment's directory, so a process creating the
+	// same environment meanwhile shows up as its first file
+	file, err := store.LevelFile(rootDir, "", name, "")
+	if err != nil {
+		return err
+	}
+	lock, err := safefile.Acquire(file, filepath.Join(rootDir, ".sops.yaml"))
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+	if _, err := os.Stat(file); err == nil {
+		return fmt.Errorf("environment %s already exists", name)
+	}
+
+	// The creation rule goes in first, so the environment's first file is
+	// already encrypted to its keys
+	var records []audit.Record
+	if len(envKeys) > 0 {
+		sopsConfig, err := keys.LoadSOPSConfig(rootDir)
+		if err != nil {
+			return err
+		}
+		if err := sopsConfig.AddEnvRule(name, envKeys); err != nil {
+			return err
+		}
+		if err := keys.SaveSOPSConfig(rootDir, sopsConfig); err != nil {
+			return err
+		}
+		color.Cyan("  added a creation rule for %s to .sops.yaml", name)
+		records = append(records, audit.Record{File: ".sops.yaml"})
+	}
+
+	// An environment starts with an empty shared file, so the directory is
+	// tracked by git and shows up in 'puff envs'
+	if err := store.Write(file, map[string]interface{}{}, directoryAgeKeys); err != nil {
+		return fmt.Errorf("%s: %w", relativeSource(rootDir, file), err)
+	}
+	color.Cyan("  created %s", relativeSource(rootDir, file))
+	records = append(records, audit.Record{File: relativeSource(rootDir, file)})
+
+	if len(envKeys) > 0 {
+		color.Green("Created environment %s encrypted to %d key(s) of its own", name, len(envKeys))
+	} else {
+		color.Green("Created environment %s", name)
+	}
+
+	return store.RecordAudit(rootDir, "env create", records...)
+}
+
+func envRmAction(c *cli.Context) error {
+	args, err := positionalArgs(c)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("expected an environment NAME")
+	}
+	name := args[0]
+	rootDir := c.String("root")
+
+	files, err := envFiles(rootDir, name)
+	if err != nil {
+		return err
+	}
+	sopsConfig, err := keys.LoadSOPSConfig(rootDir)
+	if err != nil {
+		return err
+	}
+	_, hasRule := sopsConfig.EnvKeys(name)
+	if len(files) == 0 && !hasRule {
+		return fmt.Errorf("environment not found: %s", name)
+	}
+
+	if !c.Bool("confirm") {
+		for _, file := range files {
+			fmt.Printf("  %s\n", relativeSource(rootDir, file))
+		}
+		if hasRule {
+			fmt.Printf("  .sops.yaml creation rule for %s\n", name)
+		}
+		return fmt.Errorf("refusing to delete %d file(s) of environment %s without --confirm", len(files), name)
+	}
+
+	lock, err := safefile.Acquire(append([]string{filepath.Join(rootDir, ".sops.yaml")}, files...)...)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	var records []audit.Record
+	dirs := map[string]bool{filepath.Join(rootDir, name): true}
+	for _, file := range files {
+		if err := os.Remove(file); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", relativeSource(rootDir, file), err)
+		}
+		dirs[filepath.Dir(file)] = true
+		color.Cyan("  deleted %s", relativeSource(rootDir, file))
+		records = append(records, audit.Record{File: relativeSource(rootDir, file)})
+	}
+	if hasRule {
+		sopsConfig.RemoveEnvRule(name)
+		if err := keys.SaveSOPSConfig(rootDir, sopsConfig); err != nil {
+			return err
+		}
+		color.Cyan("  removed the creation rule for %s from .sops.yaml", name)
+		records = append(records, audit.Record{File: ".sops.yaml"})
+	}
+
+	// Directories left holding anything other than config files are kept, so
+	// nothing but config is deleted. The lock files go first.
+	lock.Release()
+	var kept []string
+	for _, dir := range sortedDirs(dirs) {
+		if err := os.Remove(dir); err != nil && !os.IsNotExist(err) {
+			kept = append(kept, relativeSource(rootDir, dir))
+		}
+	}
+	color.Green("Removed environment %s (%d file(s))", name, len(files))
+	if len(kept) > 0 {
+		color.Yellow("Kept %d directory(ies) that still hold other files: %s", len(kept), strings.Join(kept, ", "))
+	}
+
+	return store.RecordAudit(rootDir, "env rm", records...)
+}
+
+// envFiles returns the config files of an environment at every level,
+// including its target overrides, in path order
+func envFiles(rootDir, env string) ([]string, error) {
+	project, err := config.LoadProject(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	files, err := listConfigFiles(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	for _, file := range files {
+		if level, ok := project.FileLevel(relativeSource(rootDir, file)); ok && level.Env == env {
+			result = append(result, file)
+		}
+	}
+	return result, nil
+}
+
+// sortedDirs returns a set of directories deepest first, so nested
+// directories are removed before their parents
+func sortedDirs(dirs map[string]bool) []string {
+	result := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		result = append(result, dir)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if depthI, depthJ := strings.Count(result[i], string(filepath.Separator)), strings.Count(result[j], string(filepath.Separator)); depthI != depthJ {
+			return depthI > depthJ
+		}
+		return result[i] < result[j]
+	})
+	return result
+}
@@ -0,0 +1,239 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/resolve"
+	"github.com/urfave/cli/v2"
+)
+
+// ExplainCommand creates the explain command for showing how a value was resolved
+func ExplainCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "explain",
+		Usage:     "Show every file that defines a key, which one wins, and how its templates expand",
+		ArgsUsage: "KEY",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "key",
+				Aliases: []string{"k"},
+				Usage:   "Key to explain (or pass it as an argument)",
+			},
+			&cli.StringFlag{
+				Name:    "app",
+				Aliases: []string{"a"},
+				Usage:   "Application name",
+			},
+			&cli.StringFlag{
+				Name:    "env",
+				Aliases: []string{"e"},
+				Usage:   "Environment name",
+			},
+			&cli.StringFlag{
+				Name:    "target",
+				Aliases: []string{"t"},
+				Usage:   "Target platform",
+			},
+			&cli.BoolFlag{
+				Name:  "show-values",
+				Usage: "Show values instead of masking them",
+				Value: false,
+			},
+			noHostEnvFlag(),
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: explainAction,
+	}
+}
+
+func explainAction(c *cli.Context) error {
+	key := c.String("key")
+	switch {
+	case key == "" && c.Args().Len() == 1:
+		key = c.Args().First()
+	case key == "" && c.Args().Len() == 0:
+		return fmt.Errorf("a key is required")
+	case c.Args().Len() > 1 || (key != "" && c.Args().Len() > 0):
+		return fmt.Errorf("unexpected arguments: %s (flags must come before KEY)", strings.Join(c.Args().Slice(), " "))
+	}
+	rootDir := c.String("root")
+	showValues := c.Bool("show-values")
+	show := func(value interface{}) string {
+		if !showValues {
+			return maskedValue
+		}
+		return displayValue(value)
+	}
+
+	ctx := config.LoadContext{
+		RootDir:    rootDir,
+		App:        c.String("app"),
+		Env:        c.String("env"),
+		Target:     c.String("target"),
+		Dimensions: dimensionValues(c),
+		NoHostEnv:  c.Bool("no-host-env"),
+	}
+	cfg, err := config.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	definitions := cfg.Definitions(key)
+	if len(definitions) == 0 {
+		return fmt.Errorf("key not found: %s", key)
+	}
+
+	if jsonOutput(c) {
+		return printExplainJSON(ctx, cfg, key, showValues)
+	}
+
+	color.Cyan("%s", key)
+	if strings.HasPrefix(key, "_") {
+		fmt.Println("Internal variable: available to templates but not exported")
+	}
+
+	fmt.Println("\nDefined in (lowest to highest precedence):")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for i, definition := range definitions {
+		winner := ""
+		if i == len(definitions)-1 {
+			winner = "(wins)"
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\n", relativeSource(rootDir, definition.File), show(definition.Value), winner)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	// Resolve the key alone, recording each substitution
+	value, steps, err := resolve.Explain(ctx, cfg, key)
+
+	if len(steps) > 0 {
+		fmt.Println("\nExpansion:")
+		for _, step := range steps {
+			location := ""
+			if step.Depth > 0 {
+				location = fmt.Sprintf(" (in %s)", step.Key)
+			}
+			fmt.Printf("%s%s -> %s%s\n", strings.Repeat("  ", step.Depth+1), step.Reference, show(step.Value), location)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to resolve templates: %w", err)
+	}
+
+	fmt.Printf("\nValue: %s\n", show(value))
+
+	metadata, err := config.LoadMetadata(rootDir)
+	if err != nil {
+		return err
+	}
+	if meta, ok := metadata.Get(key); ok {
+		printKeyMetadata(meta)
+	}
+
+	return nil
+}
+
+// explainReport is the JSON output of explain. Values are only included with
+// --show-values.
+type explainReport struct {
+	Key         string              `json:"key"`
+	Internal    bool                `json:"internal"`
+	Definitions []explainDefinition `json:"definitions"`
+	Expansion   []explainStep       `json:"expansion"`
+	Value       interface{}         `json:"value,omitempty"`
+	Metadata    *config.KeyMetadata `json:"metadata,omitempty"`
+}
+
+// explainDefinition is a file defining the key, lowest precedence first
+type explainDefinition struct {
+	File  string      `json:"file"`
+	Value interface{} `json:"value,omitempty"`
+	Wins  bool        `json:"wins"`
+}
+
+// explainStep is a template reference substituted while resolving the key
+type explainStep struct {
+	Depth     int    `json:"depth"`
+	Key       string `json:"key"`
+	Reference string `json:"reference"`
+	Value     string `json:"value,omitempty"`
+}
+
+// printExplainJSON prints the explanation of a key as an explainReport
+func printExplainJSON(ctx config.LoadContext, cfg *config.Config, key string, showValues bool) error {
+	value, steps, err := resolve.Explain(ctx, cfg, key)
+	if err != nil {
+		return fmt.Errorf("failed to resolve templates: %w", err)
+	}
+
+	report := explainReport{Key: key, Internal: strings.HasPrefix(key, "_"), Expansion: []explainStep{}}
+	definitions := cfg.Definitions(key)
+	for i, definition := range definitions {
+		entry := explainDefinition{File: relativeSource(ctx.RootDir, definition.File), Wins: i == len(definitions)-1}
+		if showValues {
+			entry.Value = definition.Value
+		}
+		report.Definitions = append(report.Definitions, entry)
+	}
+	for _, step := range steps {
+		entry := explainStep{Depth: step.Depth, Key: step.Key, Reference: step.Reference}
+		if showValues {
+			entry.Value = step.Value
+		}
+		report.Expansion = append(report.Expansion, entry)
+	}
+	if showValues {
+		report.Value = value
+	}
+
+	metadata, err := config.LoadMetadata(ctx.RootDir)
+	if err != nil {
+		return err
+	}
+	if meta, ok := metadata.Get(key); ok {
+		report.Metadata = &meta
+	}
+
+	return printJSON(report, "explanation")
+}
+
+// printKeyMetadata prints the metadata recorded for a key in meta.yml
+func printKeyMetadata(meta config.KeyMetadata) {
+	fmt.Printf("\nMetadata (%s):\n", config.MetadataFile)
+	for _, field := range []struct{ name, value string }{
+		{"Description", meta.Description},
+		{"Owner", meta.Owner},
+		{"Sensitivity", meta.Sensitivity},
+	} {
+		if field.value != "" {
+			fmt.Printf("  %s: %s\n", field.name, field.value)
+		}
+	}
+
+	due, ok := meta.RotationDue()
+	if !ok {
+		return
+	}
+	rotation := fmt.Sprintf("every %s, never rotated", meta.Rotation)
+	if !due.IsZero() {
+		rotation = fmt.Sprintf("every %s, last rotated %s, due %s", meta.Rotation, meta.LastRotated, due.Format(config.DateFormat))
+	}
+	if meta.Overdue(time.Now()) {
+		color.Red("  Rotation: %s (overdue)", rotation)
+	} else {
+		fmt.Printf("  Rotation: %s\n", rotation)
+	}
+}
@@ -0,0 +1,172 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/safefile"
+	"github.com/urfave/cli/v2"
+)
+
+// defaultPlaceholder replaces values that have no example in meta.yml
+const defaultPlaceholder = "CHANGEME"
+
+// exportedSettings are the files copied as they are into a redacted export,
+// as they describe the structure of the config but hold no values
+var exportedSettings = []string{config.ProjectFile, config.MetadataFile}
+
+// ExportCommand creates the export command, which writes a copy of the config
+// root that can be shared without its values
+func ExportCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "export",
+		Usage: "Write a copy of the config root with every value redacted, to share its structure without its values",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "redact",
+				Usage: "Replace every value with its example in meta.yml, or with the placeholder (required)",
+			},
+			&cli.StringFlag{
+				Name:     "output",
+				Aliases:  []string{"o"},
+				Usage:    "Directory to write the copy to",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "placeholder",
+				Usage: "Value for keys without an example in meta.yml",
+				Value: defaultPlaceholder,
+			},
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "Overwrite files that already exist in the output directory",
+			},
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: exportAction,
+	}
+}
+
+func exportAction(c *cli.Context) error {
+	// Only redacted copies are written, so an export can never leak values
+	if !c.Bool("redact") {
+		return fmt.Errorf("export only writes redacted copies; pass --redact")
+	}
+	rootDir := c.String("root")
+	outDir := c.String("output")
+
+	metadata, err := config.LoadMetadata(rootDir)
+	if err != nil {
+		return err
+	}
+	examples := metadata.Examples()
+
+	files, err := listConfigFiles(rootDir)
+	if err != nil {
+		return err
+	}
+
+	// A copy inside the root would itself be read as config
+	inside := false
+	rel, err := relativeTo(rootDir, outDir)
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		return fmt.Errorf("the output directory must not be the config root")
+	}
+	if filepath.IsLocal(rel) {
+		inside = true
+		prefix := rel + string(filepath.Separator)
+		kept := files[:0]
+		for _, file := range files {
+			if fileRel, err := filepath.Rel(rootDir, file); err != nil || !strings.HasPrefix(fileRel, prefix) {
+				kept = append(kept, file)
+			}
+		}
+		files = kept
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no config files found in %s", rootDir)
+	}
+
+	// Every file is redacted before anything is written, so a file that
+	// can't be parsed leaves the output untouched
+	outputs := make(map[string][]byte)
+	var names []string
+	for _, file := range files {
+		rel, err := filepath.Rel(rootDir, file)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", rel, err)
+		}
+		redacted, err := config.Redact(data, c.String("placeholder"), examples)
+		if err != nil {
+			return fmt.Errorf("failed to redact %s: %w", rel, err)
+		}
+		outputs[rel] = redacted
+		names = append(names, rel)
+	}
+	for _, name := range exportedSettings {
+		data, err := os.ReadFile(filepath.Join(rootDir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		outputs[name] = data
+		names = append(names, name)
+	}
+
+	if !c.Bool("force") {
+		for _, name := range names {
+			if _, err := os.Stat(filepath.Join(outDir, name)); err == nil {
+				return fmt.Errorf("%s already exists in %s (use --force to overwrite it)", name, outDir)
+			}
+		}
+	}
+	for _, name := range names {
+		path := filepath.Join(outDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", name, err)
+		}
+		if err := safefile.Write(path, outputs[name], 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+
+	if inside {
+		color.Yellow("%s is inside the config root, so puff will read it as config; move it elsewhere before committing", outDir)
+	}
+	color.Green("✓ Exported %d config file(s) to %s with values redacted", len(files), outDir)
+	return nil
+}
+
+// relativeTo returns the path of target relative to base, resolving both to
+// absolute paths first
+func relativeTo(base, target string) (string, error) {
+	absBase, err := filepath.Abs(base)
+	if err != nil {
+		return "", err
+	}
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(absBase, absTarget)
+}
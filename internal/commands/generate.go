@@ -1,13 +1,19 @@
 package commands
 
 import (
+	"encoding/base64"
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/git"
 	"github.com/teamcurri/puff/internal/output"
-	"github.com/teamcurri/puff/internal/templating"
 	"github.com/urfave/cli/v2"
 )
 
@@ -18,10 +24,14 @@ func GenerateCommand() *cli.Command {
 		Usage: "Generate full config for specified app/env/target in specified format",
 		Flags: []cli.Flag{
 			&cli.StringFlag{
-				Name:     "app",
-				Aliases:  []string{"a"},
-				Usage:    "Application name",
-				Required: true,
+				Name:    "app",
+				Aliases: []string{"a"},
+				Usage:   "Application name (required unless --all-apps is set)",
+			},
+			&cli.BoolFlag{
+				Name:  "all-apps",
+				Usage: "Generate config for every app in the environment (requires --out-dir)",
+				Value: false,
 			},
 			&cli.StringFlag{
 				Name:     "env",
@@ -34,10 +44,10 @@ func GenerateCommand() *cli.Command {
 				Aliases: []string{"t"},
 				Usage:   "Target platform (optional)",
 			},
-			&cli.StringFlag{
+			&cli.StringSliceFlag{
 				Name:     "format",
 				Aliases:  []string{"f"},
-				Usage:    "Output format (env, json, yaml, k8s)",
+				Usage:    "Output format (env, json, yaml, k8s, external-secret, push-secret, tfvars, tfvars-json, ecs, nomad, github-env, template, plugin:NAME); comma-separate or repeat for several formats (requires --out-dir)",
 				Required: true,
 			},
 			&cli.StringFlag{
@@ -45,15 +55,106 @@ func GenerateCommand() *cli.Command {
 				Aliases: []string{"o"},
 				Usage:   "Output file (defaults to stdout)",
 			},
+			&cli.StringFlag{
+				Name:  "out-dir",
+				Usage: "Write one output file per app into this directory",
+			},
+			&cli.StringFlag{
+				Name:  "extract-files",
+				Usage: "Decode binary values (see set --binary) into files named after their keys in this directory, leaving them out of the output; with --all-apps, into a subdirectory per app",
+			},
+			&cli.StringFlag{
+				Name:  "template-file",
+				Usage: "Go template file to render values with (required for template format)",
+			},
+			&cli.StringFlag{
+				Name:  "nest-delimiter",
+				Usage: "Split keys on this delimiter into nested objects (json and yaml formats only, e.g. \"__\")",
+			},
+			&cli.BoolFlag{
+				Name:  "annotate-sources",
+				Usage: "Write a comment above each key naming the file it came from (env and yaml formats only)",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "stamp",
+				Usage: "Prefix the output with the app, env, target, git commit, and time it was generated, and add them as annotations to Kubernetes manifests (env, yaml, tfvars, k8s, external-secret, and push-secret formats only)",
+				Value: false,
+			},
 			&cli.StringFlag{
 				Name:  "secret-name",
-				Usage: "Kubernetes secret name (required for k8s format)",
+				Usage: "Kubernetes secret name (required for k8s, external-secret, and push-secret formats; defaults to the app name with --all-apps)",
+			},
+			&cli.StringFlag{
+				Name:    "namespace",
+				Aliases: []string{"n"},
+				Usage:   "Namespace of the generated Kubernetes manifests or Nomad variable (k8s, external-secret, push-secret, and nomad formats)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "label",
+				Usage: "Add a KEY=VALUE label to the generated Kubernetes manifests (repeatable)",
+			},
+			&cli.StringSliceFlag{
+				Name:  "annotation",
+				Usage: "Add a KEY=VALUE annotation to the generated Kubernetes manifests (repeatable)",
+			},
+			&cli.BoolFlag{
+				Name:  "checksum-annotation",
+				Usage: "Annotate generated Secrets with the SHA-256 of their data, for triggering rollouts (k8s and push-secret formats)",
+			},
+			&cli.StringFlag{
+				Name:  "secret-store",
+				Usage: "External Secrets SecretStore name (required for external-secret and push-secret formats)",
+			},
+			&cli.StringFlag{
+				Name:  "secret-store-kind",
+				Usage: "External Secrets store kind (SecretStore or ClusterSecretStore)",
+				Value: "SecretStore",
+			},
+			&cli.StringFlag{
+				Name:  "remote-key-prefix",
+				Usage: "Prefix for key names in the external secret store",
 			},
 			&cli.BoolFlag{
 				Name:  "base64",
 				Usage: "Base64 encode values for k8s secrets",
 				Value: false,
 			},
+			&cli.StringFlag{
+				Name:  "type",
+				Usage: "Kubernetes secret type for k8s format: Opaque, kubernetes.io/tls, or kubernetes.io/dockerconfigjson (built from the keys set in .puff.yaml)",
+				Value: output.SecretTypeOpaque,
+			},
+			&cli.StringFlag{
+				Name:  "nomad-kind",
+				Usage: "What the nomad format writes: var (a Nomad Variables spec for nomad var put) or template (a job spec template block)",
+				Value: output.NomadVariable,
+			},
+			&cli.StringFlag{
+				Name:  "nomad-path",
+				Usage: "Path of the Nomad variable (nomad format; defaults to nomad/jobs/APP, which the job APP can read)",
+			},
+			&cli.StringFlag{
+				Name:  "nomad-destination",
+				Usage: "File the Nomad template block writes the values to (nomad format; defaults to secrets/APP.env)",
+			},
+			&cli.StringFlag{
+				Name:  "secret-keys",
+				Usage: "Comma-separated keys or glob patterns to emit as ECS secrets instead of environment values",
+			},
+			&cli.StringFlag{
+				Name:  "mask-keys",
+				Usage: "Comma-separated keys or glob patterns to hide in GitHub Actions logs with ::add-mask:: (github-env format only, requires --output or --out-dir)",
+			},
+			&cli.StringFlag{
+				Name:  "ssm-arn-prefix",
+				Usage: "SSM parameter ARN prefix for ECS secrets (e.g. arn:aws:ssm:us-east-1:123456789012:parameter/prod/api/)",
+			},
+			&cli.StringFlag{
+				Name:  "git-ref",
+				Usage: "Read the config files from this git branch, tag, or commit instead of the working tree",
+			},
+			noHostEnvFlag(),
 			&cli.StringFlag{
 				Name:    "root",
 				Aliases: []string{"r"},
@@ -68,48 +169,507 @@ func GenerateCommand() *cli.Command {
 func generateAction(c *cli.Context) error {
 	// Get parameters
 	app := c.String("app")
+	allApps := c.Bool("all-apps")
 	env := c.String("env")
 	target := c.String("target")
-	formatStr := c.String("format")
+	formatStrs := c.StringSlice("format")
 	outputFile := c.String("output")
+	outDir := c.String("out-dir")
 	secretName := c.String("secret-name")
 	base64 := c.Bool("base64")
+	secretType := c.String("type")
+	secretStore := c.String("secret-store")
+	secretStoreKind := c.String("secret-store-kind")
+	remoteKeyPrefix := c.String("remote-key-prefix")
+	ssmArnPrefix := c.String("ssm-arn-prefix")
+	nestDelimiter := c.String("nest-delimiter")
+	templateFile := c.String("template-file")
+	annotateSources := c.Bool("annotate-sources")
+	stamp := c.Bool("stamp")
+	extractDir := c.String("extract-files")
+	gitRef := c.String("git-ref")
 	rootDir := c.String("root")
 
-	// Validate format
-	var format output.Format
+	switch {
+	case allApps && app != "":
+		return fmt.Errorf("--app and --all-apps cannot be used together")
+	case !allApps && app == "":
+		return fmt.Errorf("--app is required unless --all-apps is set")
+	case allApps && outDir == "":
+		return fmt.Errorf("--out-dir is required with --all-apps")
+	case outputFile != "" && outDir != "":
+		return fmt.Errorf("--output and --out-dir cannot be used together")
+	}
+
+	// With --git-ref, config files are read from git instead of the working
+	// tree, so nothing needs to be checked out
+	readFile := os.ReadFile
+	var repo *git.Repo
+	var refCommit string
+	if gitRef != "" {
+		var err error
+		if repo, err = git.Open(rootDir); err != nil {
+			return err
+		}
+		if refCommit, err = repo.ResolveRevision(gitRef); err != nil {
+			return err
+		}
+		readFile = repo.ReadFileAt(refCommit)
+	}
+
+	// With --all-apps, each app's secret is named after the app by default
+	project, err := config.LoadProjectWith(rootDir, readFile)
+	if err != nil {
+		return err
+	}
+	requireSecretName := secretName == "" && !allApps && project.Kubernetes.SecretName == ""
+
+	metadata, err := config.LoadMetadataWith(rootDir, readFile)
+	if err != nil {
+		return err
+	}
+	binaryKeys := metadata.BinaryKeys()
+
+	secretKeys := splitList(c.String("secret-keys"))
+	maskKeys := splitList(c.String("mask-keys"))
+
+	// Validate formats
+	var formats []output.Format
+	for _, formatStr := range formatStrs {
+		for _, name := range strings.Split(formatStr, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			format, err := parseFormat(name, generateFormatFlags{
+				requireSecretName: requireSecretName,
+				secretStore:       secretStore,
+				secretStoreKind:   secretStoreKind,
+				secretKeys:        secretKeys,
+				ssmArnPrefix:      ssmArnPrefix,
+				templateFile:      templateFile,
+			})
+			if err != nil {
+				return err
+			}
+			if !slices.Contains(formats, format) {
+				formats = append(formats, format)
+			}
+		}
+	}
+	if len(formats) == 0 {
+		return fmt.Errorf("--format is required")
+	}
+	if len(formats) > 1 {
+		if outDir == "" {
+			return fmt.Errorf("--out-dir is required when generating multiple formats")
+		}
+		extensions := make(map[string]output.Format)
+		for _, format := range formats {
+			ext := outputExtension(format, templateFile)
+			if other, exists := extensions[ext]; exists {
+				return fmt.Errorf("formats %s and %s would both write %q files", other, format, "APP"+ext)
+			}
+			extensions[ext] = format
+		}
+	}
+
+	if len(maskKeys) > 0 {
+		if !slices.Contains(formats, output.FormatGitHubEnv) {
+			return fmt.Errorf("--mask-keys is only supported for github-env format")
+		}
+		// The ::add-mask:: commands go to stdout, so the env file can't
+		if outputFile == "" && outDir == "" {
+			return fmt.Errorf("--mask-keys requires --output or --out-dir")
+		}
+	}
+
+	var templateText string
+	if templateFile != "" {
+		data, err := os.ReadFile(templateFile)
+		if err != nil {
+			return fmt.Errorf("failed to read template file: %w", err)
+		}
+		templateText = string(data)
+	}
+
+	if secretType != output.SecretTypeOpaque {
+		if !slices.Contains(output.SecretTypes, secretType) {
+			return fmt.Errorf("unsupported secret type %q (use %s)", secretType, strings.Join(output.SecretTypes, ", "))
+		}
+		if !slices.Contains(formats, output.FormatK8s) {
+			return fmt.Errorf("--type is only supported for k8s format")
+		}
+	}
+	labels, err := keyValueFlag(c, "label")
+	if err != nil {
+		return err
+	}
+	annotations, err := keyValueFlag(c, "annotation")
+	if err != nil {
+		return err
+	}
+	manifests := []output.Format{output.FormatK8s, output.FormatExternalSecret, output.FormatPushSecret}
+	hasManifest := slices.ContainsFunc(formats, func(format output.Format) bool { return slices.Contains(manifests, format) })
+	if (labels != nil || annotations != nil || c.Bool("checksum-annotation")) && !hasManifest {
+		return fmt.Errorf("--label, --annotation, and --checksum-annotation are only supported for k8s, external-secret, and push-secret formats")
+	}
+	if c.IsSet("namespace") && !hasManifest && !slices.Contains(formats, output.FormatNomad) {
+		return fmt.Errorf("--namespace is only supported for k8s, external-secret, push-secret, and nomad formats")
+	}
+
+	nomadKind := c.String("nomad-kind")
+	if !slices.Contains(output.NomadKinds, nomadKind) {
+		return fmt.Errorf("unsupported --nomad-kind %q (use %s)", nomadKind, strings.Join(output.NomadKinds, " or "))
+	}
+	if (c.IsSet("nomad-kind") || c.IsSet("nomad-path") || c.IsSet("nomad-destination")) && !slices.Contains(formats, output.FormatNomad) {
+		return fmt.Errorf("--nomad-kind, --nomad-path, and --nomad-destination are only supported for nomad format")
+	}
+
+	tlsKeys := project.Kubernetes.TLS.WithDefaults()
+	dockerKeys := project.Kubernetes.DockerConfig.WithDefaults()
+	typeKeys := output.SecretTypeKeys{
+		TLSCert:        tlsKeys.Cert,
+		TLSKey:         tlsKeys.Key,
+		DockerRegistry: dockerKeys.Registry,
+		DockerUsername: dockerKeys.Username,
+		DockerPassword: dockerKeys.Password,
+		DockerEmail:    dockerKeys.Email,
+	}
+
+	if nestDelimiter != "" && !slices.Contains(formats, output.FormatJSON) && !slices.Contains(formats, output.FormatYAML) {
+		return fmt.Errorf("--nest-delimiter is only supported for json and yaml formats")
+	}
+
+	if annotateSources {
+		if !slices.Contains(formats, output.FormatEnv) && !slices.Contains(formats, output.FormatYAML) {
+			return fmt.Errorf("--annotate-sources is only supported for env and yaml formats")
+		}
+		if nestDelimiter != "" {
+			return fmt.Errorf("--annotate-sources cannot be used with --nest-delimiter")
+		}
+	}
+
+	// Every file generated in one run carries the same stamp
+	var commit string
+	var generated time.Time
+	if stamp {
+		if !slices.ContainsFunc(formats, output.CanStamp) {
+			return fmt.Errorf("--stamp is only supported for env, yaml, tfvars, k8s, external-secret, and push-secret formats")
+		}
+		commit = refCommit
+		if commit == "" {
+			commit = stampCommit(rootDir)
+		}
+		if generated, err = stampTime(); err != nil {
+			return err
+		}
+	}
+
+	apps := []string{app}
+	if allApps {
+		if repo != nil {
+			files, err := repo.FilesAt(refCommit)
+			if err != nil {
+				return err
+			}
+			apps = config.AppsInFiles(project, files, env, target)
+		} else if apps, err = config.AppsInEnv(rootDir, env, target); err != nil {
+			return err
+		}
+		if len(apps) == 0 {
+			return fmt.Errorf("no apps found for environment %s", env)
+		}
+	}
+
+	// Files such as base/shared.yml are part of every app's config, so share
+	// one cache across apps to decrypt them only once
+	cache := config.NewFileCache()
+
+	for _, appName := range apps {
+		appSecretName := secretName
+		if appSecretName == "" {
+			appSecretName = project.Kubernetes.SecretNameFor(appName, env, target)
+		}
+		if appSecretName == "" {
+			appSecretName = appName
+		}
+
+		ctx := config.LoadContext{
+			RootDir:    rootDir,
+			App:        appName,
+			Env:        env,
+			Target:     target,
+			Dimensions: dimensionValues(c),
+			Cache:      cache,
+			NoHostEnv:  c.Bool("no-host-env"),
+		}
+		if repo != nil {
+			ctx.ReadFile = readFile
+		}
+
+		// Load and resolve once, then format the same values for every format
+		values, err := exportedValues(ctx)
+		if err != nil {
+			if allApps {
+				return fmt.Errorf("%s: %w", appName, err)
+			}
+			return err
+		}
+
+		if extractDir != "" {
+			dir := extractDir
+			if allApps {
+				dir = filepath.Join(extractDir, appName)
+			}
+			if err := extractBinaryFiles(values, binaryKeys, dir); err != nil {
+				if allApps {
+					return fmt.Errorf("%s: %w", appName, err)
+				}
+				return err
+			}
+		}
+
+		var sources map[string]string
+		if annotateSources {
+			if sources, err = relativeSources(ctx); err != nil {
+				return err
+			}
+		}
+
+		for _, format := range formats {
+			opts := output.FormatOptions{
+				Format:          format,
+				SecretName:      appSecretName,
+				Base64:          base64,
+				BinaryKeys:      binaryKeys,
+				SecretStore:     secretStore,
+				SecretStoreKind: secretStoreKind,
+				RemoteKeyPrefix: remoteKeyPrefix,
+				SensitiveKeys:   secretKeys,
+				SSMArnPrefix:    ssmArnPrefix,
+				Template:        templateText,
+				PluginEnv: []string{
+					"PUFF_APP=" + appName,
+					"PUFF_ENV=" + env,
+					"PUFF_TARGET=" + target,
+					"PUFF_SECRET_NAME=" + appSecretName,
+				},
+			}
+			if format == output.FormatJSON || format == output.FormatYAML {
+				opts.NestDelimiter = nestDelimiter
+			}
+			if format == output.FormatK8s {
+				opts.SecretType = secretType
+				opts.TypeKeys = typeKeys
+			}
+			if format == output.FormatK8s || format == output.FormatExternalSecret || format == output.FormatPushSecret {
+				opts.Namespace = c.String("namespace")
+				opts.Labels = labels
+				opts.Annotations = annotations
+				opts.Checksum = c.Bool("checksum-annotation")
+			}
+			if format == output.FormatNomad {
+				opts.Namespace = c.String("namespace")
+				opts.NomadKind = nomadKind
+				opts.NomadPath = c.String("nomad-path")
+				if opts.NomadPath == "" {
+					opts.NomadPath = "nomad/jobs/" + appName
+				}
+				opts.NomadDestination = c.String("nomad-destination")
+				if opts.NomadDestination == "" {
+					opts.NomadDestination = "secrets/" + appName + ".env"
+				}
+			}
+			if format == output.FormatEnv || format == output.FormatYAML {
+				opts.Sources = sources
+			}
+			if stamp && output.CanStamp(format) {
+				opts.Stamp = &output.Stamp{App: appName, Env: env, Target: target, Commit: commit, Generated: generated}
+			}
+
+			formatted, err := output.FormatOutput(values, opts)
+			if err != nil {
+				if allApps {
+					return fmt.Errorf("%s: failed to format output: %w", appName, err)
+				}
+				return fmt.Errorf("failed to format output: %w", err)
+			}
+
+			if format == output.FormatGitHubEnv && len(maskKeys) > 0 {
+				commands, err := output.GitHubMaskCommands(values, maskKeys)
+				if err != nil {
+					return err
+				}
+				for _, command := range commands {
+					fmt.Println(command)
+				}
+			}
+
+			// Write output
+			// NOTE: Output files are intentionally UNENCRYPTED as they are deployment
+			// configurations consumed by runtime systems (Docker, Kubernetes, etc.).
+			// These files contain the final, resolved configuration values after decryption
+			// and template processing. Encryption at this stage would prevent deployment
+			// systems from reading the configuration.
+			//
+			// Security Considerations:
+			// - Source config files remain encrypted at rest
+			// - This output is for deployment environments only
+			// - Handle output files according to your deployment security practices
+			// - For Kubernetes: pipe to kubectl, don't save to disk
+			// - For Docker: use docker secrets or environment injection
+			// - For sensitive data: use runtime encryption (Vault, AWS Secrets Manager, etc.)
+			path := outputFile
+			if outDir != "" {
+				if err := os.MkdirAll(outDir, 0755); err != nil {
+					return fmt.Errorf("failed to create output directory: %w", err)
+				}
+				path = filepath.Join(outDir, appName+outputExtension(format, templateFile))
+			}
+
+			if path != "" {
+				if err := os.WriteFile(path, []byte(formatted), 0644); err != nil {
+					return fmt.Errorf("failed to write output file: %w", err)
+				}
+				color.Green("Config generated and written to %s", path)
+			} else {
+				fmt.Println(formatted)
+			}
+		}
+	}
+
+	return nil
+}
+
+// extractBinaryFiles decodes the binary values among values into files named
+// after their keys in dir, and removes them from values. The files are only
+// readable by their owner, as they usually hold keys and keystores. Keys that
+// aren't plain file names are refused, so no file is written outside dir.
+func extractBinaryFiles(values map[string]interface{}, binaryKeys []string, dir string) error {
+	for _, key := range binaryKeys {
+		if _, ok := values[key]; ok && (key == "." || key == ".." || strings.ContainsAny(key, `/\`) || !filepath.IsLocal(key)) {
+			return fmt.Errorf("can't extract %s: binary keys must be plain file names", key)
+		}
+	}
+	for _, key := range binaryKeys {
+		value, ok := values[key]
+		if !ok {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(displayValue(value))
+		if err != nil {
+			return fmt.Errorf("%s is marked binary but isn't valid base64: %w", key, err)
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+		path := filepath.Join(dir, key)
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		delete(values, key)
+		color.New(color.FgGreen).Fprintf(os.Stderr, "Extracted %s to %s\n", key, path)
+	}
+	return nil
+}
+
+// keyValueFlag parses the KEY=VALUE entries of a repeatable flag, or returns
+// nil if it isn't given
+func keyValueFlag(c *cli.Context, name string) (map[string]string, error) {
+	var entries map[string]string
+	for _, entry := range c.StringSlice(name) {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("expected KEY=VALUE for --%s, got %q", name, entry)
+		}
+		if entries == nil {
+			entries = make(map[string]string)
+		}
+		entries[strings.TrimSpace(key)] = value
+	}
+	return entries, nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if trimmed := strings.TrimSpace(item); trimmed != "" {
+			items = append(items, trimmed)
+		}
+	}
+	return items
+}
+
+// generateFormatFlags holds the flags that parseFormat validates formats against
+type generateFormatFlags struct {
+	requireSecretName bool
+	secretStore       string
+	secretStoreKind   string
+	secretKeys        []string
+	ssmArnPrefix      string
+	templateFile      string
+}
+
+// parseFormat converts a format name to an output format, checking that the
+// flags the format requires are set
+func parseFormat(formatStr string, flags generateFormatFlags) (output.Format, error) {
 	switch formatStr {
 	case "env":
-		format = output.FormatEnv
+		return output.FormatEnv, nil
 	case "json":
-		format = output.FormatJSON
+		return output.FormatJSON, nil
 	case "yaml":
-		format = output.FormatYAML
+		return output.FormatYAML, nil
 	case "k8s":
-		format = output.FormatK8s
-		if secretName == "" {
-			return fmt.Errorf("--secret-name is required for k8s format")
+		if flags.requireSecretName {
+			return "", fmt.Errorf("--secret-name is required for k8s format")
+		}
+		return output.FormatK8s, nil
+	case "external-secret", "push-secret":
+		if flags.requireSecretName {
+			return "", fmt.Errorf("--secret-name is required for %s format", formatStr)
+		}
+		if flags.secretStore == "" {
+			return "", fmt.Errorf("--secret-store is required for %s format", formatStr)
+		}
+		if flags.secretStoreKind != "SecretStore" && flags.secretStoreKind != "ClusterSecretStore" {
+			return "", fmt.Errorf("invalid --secret-store-kind: %s (must be SecretStore or ClusterSecretStore)", flags.secretStoreKind)
 		}
+		return output.Format(formatStr), nil
+	case "tfvars":
+		return output.FormatTfvars, nil
+	case "tfvars-json":
+		return output.FormatTfvarsJSON, nil
+	case "ecs":
+		if len(flags.secretKeys) > 0 && flags.ssmArnPrefix == "" {
+			return "", fmt.Errorf("--ssm-arn-prefix is required when --secret-keys is set")
+		}
+		return output.FormatECS, nil
+	case "nomad":
+		return output.FormatNomad, nil
+	case "github-env":
+		return output.FormatGitHubEnv, nil
+	case "template":
+		if flags.templateFile == "" {
+			return "", fmt.Errorf("--template-file is required for template format")
+		}
+		return output.FormatTemplate, nil
 	default:
-		return fmt.Errorf("unknown format: %s (valid formats: env, json, yaml, k8s)", formatStr)
-	}
-
-	// Load configuration
-	cfg, err := config.Load(config.LoadContext{
-		RootDir: rootDir,
-		App:     app,
-		Env:     env,
-		Target:  target,
-	})
-	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+		if name, ok := strings.CutPrefix(formatStr, "plugin:"); ok {
+			return output.PluginFormat(name), nil
+		}
+		return "", fmt.Errorf("unknown format: %s (valid formats: env, json, yaml, k8s, external-secret, push-secret, tfvars, tfvars-json, ecs, nomad, github-env, template, plugin:NAME)", formatStr)
 	}
+}
 
-	// Resolve template variables
-	resolver := templating.NewResolver(cfg.Values)
-	resolved, err := resolver.Resolve()
+// exportedValues loads and resolves the config for ctx and returns the
+// values to export, without underscore-prefixed internal variables
+func exportedValues(ctx config.LoadContext) (map[string]interface{}, error) {
+	// Load configuration and resolve template variables
+	resolved, err := loadResolvedConfig(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to resolve templates: %w", err)
+		return nil, err
 	}
 
 	// Filter out underscore-prefixed variables
@@ -120,38 +680,80 @@ func generateAction(c *cli.Context) error {
 		}
 	}
 
-	// Format output
-	formatted, err := output.FormatOutput(exportValues, output.FormatOptions{
-		Format:     format,
-		SecretName: secretName,
-		Base64:     base64,
-	})
+	return exportValues, nil
+}
+
+// stampCommit returns the commit of the config root for a stamp, with a
+// -dirty suffix if the config root has uncommitted changes. It returns "" if
+// the config root isn't in a git repository or has no commits.
+func stampCommit(rootDir string) string {
+	repo, err := git.Open(rootDir)
+	if err != nil {
+		return ""
+	}
+	sha, err := repo.ResolveRevision("HEAD")
 	if err != nil {
-		return fmt.Errorf("failed to format output: %w", err)
-	}
-
-	// Write output
-	// NOTE: Output files are intentionally UNENCRYPTED as they are deployment
-	// configurations consumed by runtime systems (Docker, Kubernetes, etc.).
-	// These files contain the final, resolved configuration values after decryption
-	// and template processing. Encryption at this stage would prevent deployment
-	// systems from reading the configuration.
-	//
-	// Security Considerations:
-	// - Source config files remain encrypted at rest
-	// - This output is for deployment environments only
-	// - Handle output files according to your deployment security practices
-	// - For Kubernetes: pipe to kubectl, don't save to disk
-	// - For Docker: use docker secrets or environment injection
-	// - For sensitive data: use runtime encryption (Vault, AWS Secrets Manager, etc.)
-	if outputFile != "" {
-		if err := os.WriteFile(outputFile, []byte(formatted), 0644); err != nil {
-			return fmt.Errorf("failed to write output file: %w", err)
-		}
-		color.Green("Config generated and written to %s", outputFile)
-	} else {
-		fmt.Println(formatted)
+		return ""
 	}
+	if modified, err := repo.Modified(); err != nil || modified {
+		return sha + "-dirty"
+	}
+	return sha
+}
 
-	return nil
+// stampTime returns the generation time for a stamp: SOURCE_DATE_EPOCH if it
+// is set, for reproducible builds, or the current time
+func stampTime() (time.Time, error) {
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+	if epoch == "" {
+		return time.Now().UTC().Truncate(time.Second), nil
+	}
+	seconds, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: must be a Unix timestamp", epoch)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// relativeSources returns the file each key of the config for ctx comes
+// from, relative to the config root
+func relativeSources(ctx config.LoadContext) (map[string]string, error) {
+	sources, err := config.Sources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for key, source := range sources {
+		sources[key] = relativeSource(ctx.RootDir, source)
+	}
+	return sources, nil
+}
+
+// outputExtension returns the file extension used for a format when writing
+// one file per app into --out-dir
+func outputExtension(format output.Format, templateFile string) string {
+	switch format {
+	case output.FormatEnv:
+		return ".env"
+	case output.FormatJSON, output.FormatECS:
+		return ".json"
+	case output.FormatYAML, output.FormatK8s, output.FormatExternalSecret, output.FormatPushSecret:
+		return ".yaml"
+	case output.FormatTfvars:
+		return ".tfvars"
+	case output.FormatTfvarsJSON:
+		return ".tfvars.json"
+	case output.FormatNomad:
+		return ".hcl"
+	case output.FormatGitHubEnv:
+		return ".github.env"
+	case output.FormatTemplate:
+		// app.conf.tmpl renders to app.conf, so use the extension that remains
+		name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(templateFile), ".tmpl"), ".tpl")
+		return filepath.Ext(name)
+	default:
+		if name, ok := strings.CutPrefix(string(format), "plugin:"); ok {
+			return "." + name
+		}
+		return ""
+	}
 }
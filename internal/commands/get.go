@@ -1,10 +1,17 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
 
+	"github.com/teamcurri/puff/internal/agent"
 	"github.com/teamcurri/puff/internal/config"
-	"github.com/teamcurri/puff/internal/templating"
+	"github.com/teamcurri/puff/internal/output"
+	"github.com/teamcurri/puff/internal/resolve"
 	"github.com/urfave/cli/v2"
 )
 
@@ -12,14 +19,23 @@ import (
 func GetCommand() *cli.Command {
 	return &cli.Command{
 		Name:  "get",
-		Usage: "Get a config value for specified app/env/target",
+		Usage: "Get config values for specified app/env/target",
 		Flags: []cli.Flag{
-			&cli.StringFlag{
+			&cli.StringSliceFlag{
 				Name:     "key",
 				Aliases:  []string{"k"},
-				Usage:    "Key to retrieve",
+				Usage:    "Key to retrieve, or a glob pattern such as 'DB_*' (repeatable)",
 				Required: true,
 			},
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"f"},
+				Usage:   "Output format: value, env, or json (defaults to value for a single key and env otherwise)",
+			},
+			&cli.BoolFlag{
+				Name:  "raw",
+				Usage: "Print values as stored, without expanding ${...} references",
+			},
 			&cli.StringFlag{
 				Name:    "app",
 				Aliases: []string{"a"},
@@ -35,6 +51,7 @@ func GetCommand() *cli.Command {
 				Aliases: []string{"t"},
 				Usage:   "Target platform",
 			},
+			noHostEnvFlag(),
 			&cli.StringFlag{
 				Name:    "root",
 				Aliases: []string{"r"},
@@ -47,38 +64,139 @@ func GetCommand() *cli.Command {
 }
 
 func getAction(c *cli.Context) error {
-	key := c.String("key")
+	patterns := c.StringSlice("key")
 	app := c.String("app")
 	env := c.String("env")
 	target := c.String("target")
 	rootDir := c.String("root")
 
-	// Load configuration
-	cfg, err := config.Load(config.LoadContext{
-		RootDir: rootDir,
-		App:     app,
-		Env:     env,
-		Target:  target,
-	})
+	format := reportFormat(c)
+	if format == "" {
+		format = "env"
+		if len(patterns) == 1 && !isKeyPattern(patterns[0]) {
+			format = "value"
+		}
+	}
+	if format != "value" && format != "env" && format != "json" {
+		return fmt.Errorf("unsupported format %q (use value, env, or json)", format)
+	}
+
+	ctx := config.LoadContext{
+		RootDir:    rootDir,
+		App:        app,
+		Env:        env,
+		Target:     target,
+		Dimensions: dimensionValues(c),
+		NoHostEnv:  c.Bool("no-host-env"),
+	}
+	var merged map[string]interface{}
+	if c.Bool("raw") {
+		cfg, err := config.Load(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		merged = cfg.Values
+	} else {
+		var err error
+		if merged, err = loadResolvedConfig(ctx); err != nil {
+			return err
+		}
+	}
+
+	values, err := selectKeys(merged, patterns)
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+		return err
 	}
 
-	// Resolve template variables
-	resolver := templating.NewResolver(cfg.Values)
-	resolved, err := resolver.Resolve()
+	if format == "value" {
+		if len(values) != 1 {
+			return fmt.Errorf("--format value prints a single key, but %d keys matched (use --format env or json)", len(values))
+		}
+		for _, value := range values {
+			fmt.Println(displayValue(value))
+		}
+		return nil
+	}
+
+	// Several keys are printed the way generate prints them
+	formatted, err := output.FormatOutput(values, output.FormatOptions{Format: output.Format(format)})
 	if err != nil {
-		return fmt.Errorf("failed to resolve templates: %w", err)
+		return err
 	}
+	fmt.Println(formatted)
+	return nil
+}
+
+// isKeyPattern reports whether a --key value is a glob pattern
+func isKeyPattern(key string) bool {
+	return strings.ContainsAny(key, "*?[")
+}
 
-	// Get the value
-	value, exists := resolved[key]
-	if !exists {
-		return fmt.Errorf("key not found: %s", key)
+// selectKeys returns the values of the keys named or matched by patterns.
+// Named keys must exist and may be dotted paths to nested values. Patterns
+// match top-level keys and must match at least one. Like shell globs and
+// dotfiles, patterns only match internal variables when they start with an
+// underscore themselves.
+func selectKeys(values map[string]interface{}, patterns []string) (map[string]interface{}, error) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
 
-	// Print the value
-	fmt.Printf("%v\n", value)
+	selected := make(map[string]interface{})
+	for _, pattern := range patterns {
+		if !isKeyPattern(pattern) {
+			value, exists := config.Lookup(values, pattern)
+			if !exists {
+				return nil, fmt.Errorf("key not found: %s", pattern)
+			}
+			selected[pattern] = value
+			continue
+		}
 
-	return nil
+		matched := false
+		for _, key := range keys {
+			if strings.HasPrefix(key, "_") && !strings.HasPrefix(pattern, "_") {
+				continue
+			}
+			ok, err := path.Match(pattern, key)
+			if err != nil {
+				return nil, fmt.Errorf("invalid key pattern %q: %w", pattern, err)
+			}
+			if ok {
+				selected[key] = values[key]
+				matched = true
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("no keys match %s", pattern)
+		}
+	}
+	return selected, nil
+}
+
+// noHostEnvFlag disables ${env:NAME} template references for hermetic builds
+func noHostEnvFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:    "no-host-env",
+		Usage:   "Don't read ${env:NAME} template references from the environment; only their defaults apply (for hermetic builds)",
+		EnvVars: []string{"PUFF_NO_HOST_ENV"},
+	}
+}
+
+// loadResolvedConfig loads the merged configuration for a context and
+// resolves all template variables in it. If a puff agent is running, the
+// agent resolves it from its cache of decrypted files instead, unless files
+// are read with ctx.ReadFile, as the agent only reads the working tree.
+func loadResolvedConfig(ctx config.LoadContext) (map[string]interface{}, error) {
+	if socketPath := os.Getenv(agent.SocketEnv); socketPath != "" && ctx.ReadFile == nil {
+		resolved, err := agent.NewClient(socketPath).Resolve(ctx)
+		if !errors.Is(err, agent.ErrUnavailable) {
+			return resolved, err
+		}
+		fmt.Fprintf(os.Stderr, "Warning: %v, decrypting locally\n", err)
+	}
+
+	return resolve.Config(ctx)
 }
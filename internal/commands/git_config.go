@@ -0,0 +1,440 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/getsops/sops/v3/decrypt"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/git"
+	"github.com/teamcurri/puff/internal/keys"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// gitDriverName is the name of the diff and merge drivers puff registers
+const gitDriverName = "puff"
+
+// gitAttributesComment marks the lines puff adds to .gitattributes
+const gitAttributesComment = "# puff: decrypt SOPS files for git diff and merge"
+
+// gitAttributesLines assign the puff drivers to config files, with either
+// extension
+var gitAttributesLines = []string{
+	fmt.Sprintf("*.yml diff=%s merge=%s", gitDriverName, gitDriverName),
+	fmt.Sprintf("*.yaml diff=%s merge=%s", gitDriverName, gitDriverName),
+}
+
+// GitConfigCommand creates the git-config command for registering puff's
+// git diff and merge drivers
+func GitConfigCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "git-config",
+		Usage: "Set up git to show decrypted diffs and merge encrypted files by their values",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "install",
+				Usage: "Register the drivers in the repository's git config and .gitattributes",
+			},
+			&cli.BoolFlag{
+				Name:  "uninstall",
+				Usage: "Remove the drivers from the repository's git config and .gitattributes",
+			},
+			&cli.StringFlag{
+				Name:  "command",
+				Usage: "Command git runs to invoke puff (defaults to the path of this binary)",
+			},
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: gitConfigAction,
+	}
+}
+
+// GitTextconvCommand creates the hidden command git runs to show a file
+// decrypted in diffs
+func GitTextconvCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "git-textconv",
+		Usage:     "Print a file decrypted, for git diff (used by the git-config driver)",
+		ArgsUsage: "FILE",
+		Hidden:    true,
+		Action:    gitTextconvAction,
+	}
+}
+
+// GitMergeCommand creates the hidden command git runs to merge two versions
+// of an encrypted file
+func GitMergeCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "git-merge",
+		Usage:     "Merge two versions of an encrypted file (used by the git-config driver)",
+		ArgsUsage: "BASE CURRENT OTHER PATH",
+		Hidden:    true,
+		Action:    gitMergeAction,
+	}
+}
+
+func gitConfigAction(c *cli.Context) error {
+	rootDir := c.String("root")
+	if c.Bool("install") && c.Bool("uninstall") {
+		return fmt.Errorf("--install and --uninstall cannot be used together")
+	}
+
+	repo, err := git.Open(rootDir)
+	if err != nil {
+		return err
+	}
+	attributesPath := filepath.Join(rootDir, ".gitattributes")
+
+	switch {
+	case c.Bool("install"):
+		command := c.String("command")
+		if command == "" {
+			if command, err = os.Executable(); err != nil {
+				return fmt.Errorf("failed to find the puff binary (use --command): %w", err)
+			}
+			command = shellQuote(command)
+		}
+		settings := [][2]string{
+			{"diff." + gitDriverName + ".textconv", command + " git-textconv"},
+			{"merge." + gitDriverName + ".name", "puff SOPS merge driver"},
+			{"merge." + gitDriverName + ".driver", command + " git-merge %O %A %B %P"},
+		}
+		for _, setting := range settings {
+			if err := repo.SetConfig(setting[0], setting[1]); err != nil {
+				return fmt.Errorf("failed to set %s: %w", setting[0], err)
+			}
+		}
+		if err := addGitAttributes(attributesPath); err != nil {
+			return err
+		}
+		color.Green("Installed the puff diff and merge drivers")
+		fmt.Printf("git diff now shows decrypted values to anyone who can decrypt, and merges re-encrypt.\n")
+		fmt.Printf("Commit %s so the drivers apply for everyone; each clone needs 'puff git-config --install'.\n", relativeSource(rootDir, attributesPath))
+
+	case c.Bool("uninstall"):
+		for _, section := range []string{"diff." + gitDriverName, "merge." + gitDriverName} {
+			if err := repo.RemoveConfigSection(section); err != nil {
+				return fmt.Errorf("failed to remove %s: %w", section, err)
+			}
+		}
+		if err := removeGitAttributes(attributesPath); err != nil {
+			return err
+		}
+		color.Green("Uninstalled the puff diff and merge drivers")
+
+	default:
+		_, textconv := repo.Config("diff." + gitDriverName + ".textconv")
+		_, merge := repo.Config("merge." + gitDriverName + ".driver")
+		attributes, err := hasGitAttributes(attributesPath)
+		if err != nil {
+			return err
+		}
+		for _, check := range []struct {
+			name string
+			ok   bool
+		}{
+			{"diff driver (git config)", textconv},
+			{"merge driver (git config)", merge},
+			{relativeSource(rootDir, attributesPath), attributes},
+		} {
+			if check.ok {
+				color.Green("✓ %s", check.name)
+			} else {
+				color.Yellow("✗ %s", check.name)
+			}
+		}
+		if !textconv || !merge || !attributes {
+			fmt.Println("\nRun 'puff git-config --install' to set up the drivers")
+		}
+	}
+
+	return nil
+}
+
+// shellQuote quotes a path for use in a command git passes to the shell
+func shellQuote(path string) string {
+	if !strings.ContainsAny(path, " \t'\"\\$`!*?[]{}()<>|&;#~") {
+		return path
+	}
+	return "'" + strings.ReplaceAll(path, "'", `'\''`) + "'"
+}
+
+// hasGitAttributes reports whether .gitattributes assigns the puff drivers
+// to config files with either extension
+func hasGitAttributes(path string) (bool, error) {
+	missing, err := missingGitAttributes(path)
+	return len(missing) == 0, err
+}
+
+// missingGitAttributes returns the lines assigning the puff drivers that
+// .gitattributes doesn't have
+func missingGitAttributes(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return gitAttributesLines, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .gitattributes: %w", err)
+	}
+	present := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		present[strings.TrimSpace(line)] = true
+	}
+	var missing []string
+	for _, line := range gitAttributesLines {
+		if !present[line] {
+			missing = append(missing, line)
+		}
+	}
+	return missing, nil
+}
+
+// addGitAttributes assigns the puff drivers to config files in
+// .gitattributes, adding the lines it doesn't have yet
+func addGitAttributes(path string) error {
+	missing, err := missingGitAttributes(path)
+	if err != nil || len(missing) == 0 {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read .gitattributes: %w", err)
+	}
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		data = append(data, '\n')
+	}
+	if len(missing) == len(gitAttributesLines) {
+		data = append(data, []byte(gitAttributesComment+"\n")...)
+	}
+	data = append(data, []byte(strings.Join(missing, "\n")+"\n")...)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write .gitattributes: %w", err)
+	}
+	return nil
+}
+
+// removeGitAttributes removes the lines added by addGitAttributes, and the
+// file itself if nothing else is left in it
+func removeGitAttributes(path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read .gitattributes: %w", err)
+	}
+
+	var kept []string
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if trimmed := strings.TrimSpace(line); trimmed != gitAttributesComment && !slices.Contains(gitAttributesLines, trimmed) {
+			kept = append(kept, line)
+		}
+	}
+	if strings.TrimSpace(strings.Join(kept, "")) == "" {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove .gitattributes: %w", err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(kept, "\n")+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write .gitattributes: %w", err)
+	}
+	return nil
+}
+
+// gitTextconvAction prints a file decrypted. Files that aren't encrypted,
+// or can't be decrypted with the available keys, are printed as they are so
+// git diff still works.
+func gitTextconvAction(c *cli.Context) error {
+	if c.Args().Len() != 1 {
+		return fmt.Errorf("usage: puff git-textconv FILE")
+	}
+	data, err := os.ReadFile(c.Args().First())
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	if isEncryptedYAML(data) {
+		if decrypted, err := decrypt.Data(data, "yaml"); err == nil {
+			data = decrypted
+		}
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+// gitMergeAction merges the other version of a file into the current one by
+// comparing values, writing the re-encrypted result over the current
+// version. Keys changed differently on both sides keep the current value and
+// are reported as conflicts, so no plaintext is left in the working tree.
+func gitMergeAction(c *cli.Context) error {
+	if c.Args().Len() != 4 {
+		return fmt.Errorf("usage: puff git-merge BASE CURRENT OTHER PATH")
+	}
+	basePath, currentPath, otherPath, path := c.Args().Get(0), c.Args().Get(1), c.Args().Get(2), c.Args().Get(3)
+
+	versions := make([][]byte, 3)
+	for i, file := range []string{basePath, currentPath, otherPath} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		versions[i] = data
+	}
+	base, current, other := versions[0], versions[1], versions[2]
+
+	// Plain files, such as keys.yml and meta.yml, merge line by line
+	if !isEncryptedYAML(current) && !isEncryptedYAML(other) {
+		conflicts, err := git.MergeFile(currentPath, basePath, otherPath, [3]string{"ours", "base", "theirs"})
+		if err != nil {
+			return err
+		}
+		if conflicts {
+			return fmt.Errorf("conflicts merging %s", path)
+		}
+		return nil
+	}
+
+	values := make([]map[string]interface{}, 3)
+	for i, data := range versions {
+		if len(bytes.TrimSpace(data)) == 0 {
+			// The file was added on both sides
+			values[i] = map[string]interface{}{}
+			continue
+		}
+		parsed, err := config.ParseData(data, path)
+		if err != nil {
+			return fmt.Errorf("cannot merge %s: %w", path, err)
+		}
+		values[i] = parsed
+	}
+	merged, conflicts := mergeValues(values[0], values[1], values[2])
+
+	groups, err := mergeKeyGroups(base, current, other)
+	if err != nil {
+		return fmt.Errorf("cannot merge %s: %w", path, err)
+	}
+	plain, err := yaml.Marshal(merged)
+	if err != nil {
+		return fmt.Errorf("failed to marshal YAML: %w", err)
+	}
+	encrypted, err := keys.EncryptDataWithGroups(plain, path, groups)
+	if err != nil {
+		return fmt.Errorf("cannot merge %s: %w", path, err)
+	}
+	if err := os.WriteFile(currentPath, encrypted, 0600); err != nil {
+		return fmt.Errorf("failed to write merged file: %w", err)
+	}
+
+	if len(conflicts) > 0 {
+		return fmt.Errorf("%s: %s changed on both sides; kept our value (resolve with 'puff set', then git add)",
+			path, strings.Join(conflicts, ", "))
+	}
+	return nil
+}
+
+// isEncryptedYAML reports whether data is a SOPS-encrypted YAML file
+func isEncryptedYAML(data []byte) bool {
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return false
+	}
+	_, hasSops := values["sops"]
+	return hasSops
+}
+
+// mergeValues merges the changes made to each key between base and other
+// into current. Keys changed differently on both sides keep the current
+// value and are returned as conflicts, in key order.
+func mergeValues(base, current, other map[string]interface{}) (map[string]interface{}, []string) {
+	keySet := make(map[string]bool)
+	for _, values := range []map[string]interface{}{base, current, other} {
+		for key := range values {
+			keySet[key] = true
+		}
+	}
+
+	merged := make(map[string]interface{})
+	var conflicts []string
+	for key := range keySet {
+		baseValue, inBase := base[key]
+		currentValue, inCurrent := current[key]
+		otherValue, inOther := other[key]
+		same := func(a interface{}, inA bool, b interface{}, inB bool) bool {
+			return inA == inB && reflect.DeepEqual(a, b)
+		}
+
+		value, exists := currentValue, inCurrent
+		switch {
+		case same(currentValue, inCurrent, otherValue, inOther), same(otherValue, inOther, baseValue, inBase):
+			// Unchanged on the other side, or changed the same way
+		case same(currentValue, inCurrent, baseValue, inBase):
+			value, exists = otherValue, inOther
+		default:
+			conflicts = append(conflicts, key)
+		}
+		if exists {
+			merged[key] = value
+		}
+	}
+
+	sort.Strings(conflicts)
+	return merged, conflicts
+}
+
+// mergeKeyGroups returns the keys to encrypt a merged file with. With a
+// single group, keys added on either side are kept and keys removed on
+// either side are dropped; Shamir groups must match or be unchanged on one
+// side.
+func mergeKeyGroups(base, current, other []byte) (keys.KeyGroups, error) {
+	groups := make([]keys.KeyGroups, 3)
+	for i, data := range [][]byte{base, current, other} {
+		var values map[string]interface{}
+		if err := yaml.Unmarshal(data, &values); err == nil {
+			groups[i] = keys.ExtractKeyGroups(values)
+		}
+	}
+	baseGroups, currentGroups, otherGroups := groups[0], groups[1], groups[2]
+
+	switch {
+	case len(otherGroups.Groups) == 0 || reflect.DeepEqual(currentGroups, otherGroups) || reflect.DeepEqual(otherGroups, baseGroups):
+		if len(currentGroups.Groups) == 0 {
+			return otherGroups, nil
+		}
+		return currentGroups, nil
+	case len(currentGroups.Groups) == 0 || reflect.DeepEqual(currentGroups, baseGroups):
+		return otherGroups, nil
+	case currentGroups.IsShamir() || otherGroups.IsShamir():
+		return keys.KeyGroups{}, fmt.Errorf("key groups changed on both sides")
+	}
+
+	var baseKeys []string
+	if len(baseGroups.Groups) == 1 {
+		baseKeys = baseGroups.Groups[0]
+	}
+	removed := make(map[string]bool)
+	for _, key := range baseKeys {
+		removed[key] = !slices.Contains(currentGroups.Groups[0], key) || !slices.Contains(otherGroups.Groups[0], key)
+	}
+	var merged []string
+	seen := make(map[string]bool)
+	for _, key := range append(append([]string{}, currentGroups.Groups[0]...), otherGroups.Groups[0]...) {
+		if !removed[key] && !seen[key] {
+			merged = append(merged, key)
+			seen[key] = true
+		}
+	}
+	return keys.SingleGroup(merged), nil
+}
@@ -0,0 +1,189 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"github.com/getsops/sops/v3/decrypt"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// grepExitCode is the exit code used when grep finds nothing, as with grep(1)
+const grepExitCode = 1
+
+// grepMatch is a key matching the pattern
+type grepMatch struct {
+	File  string `json:"file"` // Relative to the config root
+	Level string `json:"level"`
+	App   string `json:"app"` // "shared" for shared.yml
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+// GrepCommand creates the grep command for searching every config file
+func GrepCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "grep",
+		Usage:     "Search key names, and optionally values, across every app, env, and target",
+		ArgsUsage: "PATTERN",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "values",
+				Usage: "Also search values (requires decrypting the files)",
+			},
+			&cli.BoolFlag{
+				Name:    "ignore-case",
+				Aliases: []string{"i"},
+				Usage:   "Match the pattern case-insensitively",
+			},
+			&cli.BoolFlag{
+				Name:  "show-values",
+				Usage: "Show the values of matching keys",
+			},
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"f"},
+				Usage:   "Output format: table or json",
+				Value:   "table",
+			},
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: grepAction,
+	}
+}
+
+func grepAction(c *cli.Context) error {
+	if c.Args().Len() != 1 {
+		return fmt.Errorf("expected a PATTERN (flags must come before it)")
+	}
+	rootDir := c.String("root")
+	searchValues := c.Bool("values")
+	showValues := c.Bool("show-values")
+	format := reportFormat(c)
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unsupported report format %q (use table or json)", format)
+	}
+
+	pattern := c.Args().First()
+	if c.Bool("ignore-case") {
+		pattern = "(?i)" + pattern
+	}
+	patternRegex, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	project, err := config.LoadProject(rootDir)
+	if err != nil {
+		return err
+	}
+	files, err := listConfigFiles(rootDir)
+	if err != nil {
+		return err
+	}
+
+	matches := []grepMatch{}
+	var undecryptable []string
+	for _, file := range files {
+		name := relativeSource(rootDir, file)
+		level, ok := project.FileLevel(name)
+		if !ok {
+			continue
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		// SOPS leaves key names in plain text, so keys can be searched in
+		// files that can't be decrypted
+		decrypted := true
+		if isEncryptedYAML(data) && (searchValues || showValues) {
+			if plain, err := decrypt.Data(data, "yaml"); err == nil {
+				data = plain
+			} else {
+				decrypted = false
+				undecryptable = append(undecryptable, name)
+			}
+		}
+		var values map[string]interface{}
+		if err := yaml.Unmarshal(data, &values); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		delete(values, "sops")
+
+		app := level.App
+		if app == "" {
+			app = "shared"
+		}
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value := displayValue(values[key])
+			if !patternRegex.MatchString(key) && !(searchValues && decrypted && patternRegex.MatchString(value)) {
+				continue
+			}
+			match := grepMatch{File: name, Level: level.String(), App: app, Key: key}
+			if showValues {
+				match.Value = maskedValue
+				if decrypted {
+					match.Value = value
+				}
+			}
+			matches = append(matches, match)
+		}
+	}
+
+	if format == "json" {
+		data, err := json.MarshalIndent(matches, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal grep matches: %w", err)
+		}
+		fmt.Println(string(data))
+	} else if len(matches) == 0 {
+		color.Yellow("No matches found")
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		if showValues {
+			fmt.Fprintln(w, "FILE\tLEVEL\tAPP\tKEY\tVALUE")
+		} else {
+			fmt.Fprintln(w, "FILE\tLEVEL\tAPP\tKEY")
+		}
+		for _, match := range matches {
+			if showValues {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", match.File, match.Level, match.App, match.Key, match.Value)
+			} else {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", match.File, match.Level, match.App, match.Key)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(undecryptable) > 0 {
+		printWarning(format == "json", "Only key names were searched in %d file(s) that could not be decrypted with the available keys: %s",
+			len(undecryptable), strings.Join(undecryptable, ", "))
+	}
+
+	if len(matches) == 0 {
+		return cli.Exit("", grepExitCode)
+	}
+	return nil
+}
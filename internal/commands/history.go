@@ -0,0 +1,167 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/git"
+	"github.com/teamcurri/puff/internal/store"
+	"github.com/urfave/cli/v2"
+)
+
+// keyChange is a commit that changed a key's value in a file
+type keyChange struct {
+	commit git.Commit
+	change string // added, changed, removed, or unreadable
+	value  interface{}
+}
+
+// HistoryCommand creates the history command for showing how a key changed over time
+func HistoryCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "history",
+		Usage: "Show the git commits that changed a key in the config file for specified app/env/target",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "key",
+				Aliases:  []string{"k"},
+				Usage:    "Key to show the history of",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "app",
+				Aliases: []string{"a"},
+				Usage:   "Application name",
+			},
+			&cli.StringFlag{
+				Name:    "env",
+				Aliases: []string{"e"},
+				Usage:   "Environment name",
+			},
+			&cli.StringFlag{
+				Name:    "target",
+				Aliases: []string{"t"},
+				Usage:   "Target platform",
+			},
+			&cli.BoolFlag{
+				Name:  "show-values",
+				Usage: "Show values instead of masking them",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: historyAction,
+	}
+}
+
+func historyAction(c *cli.Context) error {
+	key := c.String("key")
+	rootDir := c.String("root")
+	showValues := c.Bool("show-values")
+
+	filePath, err := store.ContextFile(rootDir, c.String("app"), c.String("env"), c.String("target"), dimensionValues(c))
+	if err != nil {
+		return err
+	}
+
+	repo, err := git.Open(rootDir)
+	if err != nil {
+		return err
+	}
+	commits, err := repo.Log(filePath)
+	if err != nil {
+		return err
+	}
+	if len(commits) == 0 {
+		return fmt.Errorf("no git history for %s", relativeSource(rootDir, filePath))
+	}
+
+	changes, err := keyHistory(repo, filePath, key, commits)
+	if err != nil {
+		return err
+	}
+
+	color.Cyan("History of %s in %s:", key, relativeSource(rootDir, filePath))
+	if len(changes) == 0 {
+		fmt.Printf("%s was never set in this file\n", key)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "COMMIT\tDATE\tAUTHOR\tCHANGE\tVALUE\tMESSAGE")
+	unreadable := 0
+	for _, change := range changes {
+		value := ""
+		switch {
+		case change.change == "unreadable":
+			unreadable++
+		case change.change != "removed" && showValues:
+			value = displayValue(change.value)
+		case change.change != "removed":
+			value = maskedValue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", change.commit.Short(), change.commit.Date, change.commit.Author, change.change, value, change.commit.Subject)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if unreadable > 0 {
+		color.Yellow("\n%d revision(s) could not be decrypted with the available keys", unreadable)
+	}
+	return nil
+}
+
+// keyHistory walks the commits that touched a file, oldest first, and
+// returns the ones that changed the key, newest first. Revisions that can't
+// be decrypted are reported as unreadable.
+func keyHistory(repo *git.Repo, filePath, key string, commits []git.Commit) ([]keyChange, error) {
+	var changes []keyChange
+	var previous interface{}
+	existed := false
+
+	for i := len(commits) - 1; i >= 0; i-- {
+		commit := commits[i]
+
+		var values map[string]interface{}
+		data, err := repo.Show(commit.SHA, filePath)
+		switch {
+		case errors.Is(err, git.ErrNotFound):
+			// The file was deleted in this commit
+		case err != nil:
+			return nil, err
+		default:
+			if values, err = config.ParseData(data, filePath); err != nil {
+				changes = append(changes, keyChange{commit: commit, change: "unreadable"})
+				continue
+			}
+		}
+
+		value, exists := values[key]
+		switch {
+		case exists && !existed:
+			changes = append(changes, keyChange{commit: commit, change: "added", value: value})
+		case !exists && existed:
+			changes = append(changes, keyChange{commit: commit, change: "removed"})
+		case exists && !reflect.DeepEqual(value, previous):
+			changes = append(changes, keyChange{commit: commit, change: "changed", value: value})
+		}
+		previous, existed = value, exists
+	}
+
+	// Newest first, like git log
+	for i, j := 0, len(changes)-1; i < j; i, j = i+1, j-1 {
+		changes[i], changes[j] = changes[j], changes[i]
+	}
+	return changes, nil
+}
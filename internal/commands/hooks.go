@@ -0,0 +1,132 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/git"
+	"github.com/urfave/cli/v2"
+)
+
+// hookMarker identifies hooks written by puff, so they can be replaced or
+// removed without touching hooks written by anyone else
+const hookMarker = "# Installed by 'puff hooks install'"
+
+// HooksCommand creates the hooks parent command for managing git hooks
+func HooksCommand() *cli.Command {
+	rootFlag := &cli.StringFlag{
+		Name:    "root",
+		Aliases: []string{"r"},
+		Usage:   "Root directory for config files",
+		Value:   ".",
+	}
+
+	return &cli.Command{
+		Name:  "hooks",
+		Usage: "Manage the git pre-commit hook that rejects plaintext config",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "install",
+				Usage: "Write a pre-commit hook running 'puff verify --staged'",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "command",
+						Usage: "Command the hook runs to invoke puff (defaults to the path of this binary)",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "Replace an existing pre-commit hook that wasn't written by puff",
+					},
+					rootFlag,
+				},
+				Action: hooksInstallAction,
+			},
+			{
+				Name:   "uninstall",
+				Usage:  "Remove the pre-commit hook written by 'puff hooks install'",
+				Flags:  []cli.Flag{rootFlag},
+				Action: hooksUninstallAction,
+			},
+		},
+	}
+}
+
+func hooksInstallAction(c *cli.Context) error {
+	hookPath, err := installPreCommitHook(c.String("root"), c.String("command"), c.Bool("force"))
+	if err != nil {
+		return err
+	}
+
+	color.Green("Installed pre-commit hook: %s", hookPath)
+	fmt.Println("Commits with unencrypted config files or decrypted .dec files will be rejected.")
+	return nil
+}
+
+// installPreCommitHook writes the pre-commit hook for the repository holding
+// the config root and returns its path. An empty command runs this binary.
+func installPreCommitHook(rootDir, command string, force bool) (string, error) {
+	repo, hookPath, err := preCommitHookPath(rootDir)
+	if err != nil {
+		return "", err
+	}
+
+	if existing, err := os.ReadFile(hookPath); err == nil && !strings.Contains(string(existing), hookMarker) && !force {
+		return "", fmt.Errorf("%s already exists and wasn't written by puff (use --force to replace it)", hookPath)
+	}
+
+	if command == "" {
+		if command, err = os.Executable(); err != nil {
+			return "", fmt.Errorf("failed to find the puff binary (use --command): %w", err)
+		}
+		command = shellQuote(command)
+	}
+
+	// Hooks run from the top-level directory of the repository
+	hook := fmt.Sprintf("#!/bin/sh\n%s\nexec %s verify --staged -r %s\n", hookMarker, command, shellQuote(repo.Prefix()))
+	if err := os.MkdirAll(filepath.Dir(hookPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create hooks directory: %w", err)
+	}
+	if err := os.WriteFile(hookPath, []byte(hook), 0755); err != nil {
+		return "", fmt.Errorf("failed to write pre-commit hook: %w", err)
+	}
+	return hookPath, nil
+}
+
+func hooksUninstallAction(c *cli.Context) error {
+	_, hookPath, err := preCommitHookPath(c.String("root"))
+	if err != nil {
+		return err
+	}
+
+	existing, err := os.ReadFile(hookPath)
+	if os.IsNotExist(err) || (err == nil && !strings.Contains(string(existing), hookMarker)) {
+		color.Yellow("No pre-commit hook written by puff found")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read pre-commit hook: %w", err)
+	}
+	if err := os.Remove(hookPath); err != nil {
+		return fmt.Errorf("failed to remove pre-commit hook: %w", err)
+	}
+
+	color.Green("Removed pre-commit hook: %s", hookPath)
+	return nil
+}
+
+// preCommitHookPath returns the repository holding the config root and the
+// path of its pre-commit hook
+func preCommitHookPath(rootDir string) (*git.Repo, string, error) {
+	repo, err := git.Open(rootDir)
+	if err != nil {
+		return nil, "", err
+	}
+	hooksDir, err := repo.HooksDir()
+	if err != nil {
+		return nil, "", err
+	}
+	return repo, filepath.Join(hooksDir, "pre-commit"), nil
+}
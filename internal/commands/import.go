@@ -0,0 +1,186 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/dotenv"
+	"github.com/teamcurri/puff/internal/safefile"
+	"github.com/teamcurri/puff/internal/store"
+	"github.com/urfave/cli/v2"
+)
+
+// ImportCommand creates the import command for ingesting existing .env files
+func ImportCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "import",
+		Usage: "Import all keys from a .env file into specified app/env/target",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "file",
+				Aliases:  []string{"f"},
+				Usage:    ".env file to import",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "app",
+				Aliases: []string{"a"},
+				Usage:   "Application name",
+			},
+			&cli.StringFlag{
+				Name:    "env",
+				Aliases: []string{"e"},
+				Usage:   "Environment name",
+			},
+			&cli.StringFlag{
+				Name:    "target",
+				Aliases: []string{"t"},
+				Usage:   "Target platform",
+			},
+			&cli.BoolFlag{
+				Name:  "overwrite",
+				Usage: "Overwrite keys that already exist with a different value",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Show the keys that would be imported and who they'd be encrypted to without writing anything",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: importAction,
+	}
+}
+
+func importAction(c *cli.Context) error {
+	envFile := c.String("file")
+	app := c.String("app")
+	env := c.String("env")
+	target := c.String("target")
+	overwrite := c.Bool("overwrite")
+	dryRun := c.Bool("dry-run")
+	rootDir := c.String("root")
+
+	f, err := os.Open(envFile)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", envFile, err)
+	}
+	entries, err := dotenv.Parse(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", envFile, err)
+	}
+
+	if len(entries) == 0 {
+		color.Yellow("No keys found in %s", envFile)
+		return nil
+	}
+
+	// Get encryption keys from the directory - ALWAYS required
+	directoryAgeKeys, err := store.DirectoryKeys(rootDir)
+	if err != nil {
+		return fmt.Errorf("failed to check directory encryption: %w", err)
+	}
+	if len(directoryAgeKeys) == 0 {
+		return fmt.Errorf("no encryption keys found in directory - run 'puff init' first to initialize with encryption keys")
+	}
+
+	filePath, err := store.LevelFile(rootDir, app, env, target)
+	if err != nil {
+		return err
+	}
+
+	// A split level's keys go to its stores by the naming convention in
+	// .puff.yaml, as with set
+	project, err := config.LoadProject(rootDir)
+	if err != nil {
+		return err
+	}
+	files, err := store.LevelStores(rootDir, filePath)
+	if err != nil {
+		return err
+	}
+	if !dryRun {
+		lock, err := safefile.Acquire(files...)
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+	}
+	stores, _, err := store.ReadStores(files)
+	if err != nil {
+		return err
+	}
+	existing, _ := mergeStores(stores)
+
+	// Later entries in the .env file win, as they would when sourced
+	imported := make(map[string]interface{})
+	for _, entry := range entries {
+		imported[entry.Key] = entry.Value
+	}
+
+	var changes, conflicts []valueChange
+	for _, change := range diffValues(existing, imported) {
+		switch change.Kind {
+		case changeAdded:
+			changes = append(changes, change)
+		case changeChanged:
+			conflicts = append(conflicts, change)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		if overwrite {
+			changes = append(changes, conflicts...)
+		} else {
+			color.Red("%d key(s) already exist in %s with a different value:", len(conflicts), filePath)
+			for _, conflict := range conflicts {
+				fmt.Printf("  %s\n", conflict.Key)
+			}
+			if !dryRun {
+				return fmt.Errorf("import aborted due to conflicts - use --overwrite to replace existing values")
+			}
+		}
+	}
+
+	if len(changes) == 0 {
+		if len(conflicts) > 0 {
+			return nil
+		}
+		color.Green("Nothing to import - all keys already present in %s", filePath)
+		return nil
+	}
+
+	sortChanges(changes)
+
+	if dryRun {
+		color.Cyan("Dry run - would import %d key(s) into %s:", len(changes), filePath)
+		printChanges(changes, false)
+		return printRecipients(rootDir, filePath, directoryAgeKeys)
+	}
+
+	updates := newStoreUpdates(files, stores)
+	for _, change := range changes {
+		index := len(files) - 1
+		if project.Stores.Split && !project.Stores.IsSecret(change.Key) {
+			index = 0
+		}
+		updates.set(index, change.Key, change.To)
+	}
+	if err := store.WriteFiles(rootDir, updates.updates(), directoryAgeKeys); err != nil {
+		return err
+	}
+
+	printChanges(changes, false)
+	color.Green("Imported %d key(s) from %s into %s", len(changes), envFile, filePath)
+
+	return nil
+}
@@ -1,13 +1,19 @@
 package commands
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/git"
 	"github.com/teamcurri/puff/internal/keys"
+	"github.com/teamcurri/puff/internal/store"
 	"github.com/urfave/cli/v2"
 )
 
@@ -24,53 +30,133 @@ func InitCommand() *cli.Command {
 				Value:   ".",
 			},
 			&cli.StringFlag{
-				Name:     "age-keys",
-				Aliases:  []string{"k"},
-				Usage:    "Comma-separated list of age public keys for encryption (required)",
-				Required: true,
+				Name:    "age-keys",
+				Aliases: []string{"k"},
+				Usage:   "Comma-separated list of age public keys (or ssh-ed25519/ssh-rsa public keys) for encryption",
+			},
+			&cli.StringFlag{
+				Name:  "pgp",
+				Usage: "Comma-separated list of PGP key fingerprints for encryption",
+			},
+			&cli.StringFlag{
+				Name:  "kms",
+				Usage: "Comma-separated list of AWS KMS key ARNs for encryption (append +ROLE_ARN to assume a role)",
+			},
+			&cli.StringFlag{
+				Name:  "gcp-kms",
+				Usage: "Comma-separated list of GCP KMS key resource IDs for encryption",
+			},
+			&cli.StringFlag{
+				Name:  "azure-kv",
+				Usage: "Comma-separated list of Azure Key Vault key URLs for encryption",
+			},
+			&cli.BoolFlag{
+				Name:    "interactive",
+				Aliases: []string{"i"},
+				Usage:   "Ask for a new age key pair, environments to create, .gitignore entries, and the git pre-commit hook",
 			},
 		},
 		Action: initAction,
 	}
 }
 
+// keyTypeFlags maps init's PGP and cloud KMS flags to the key type each accepts
+var keyTypeFlags = []struct {
+	flag    string
+	keyType keys.KeyType
+}{
+	{"pgp", keys.KeyTypePGP},
+	{"kms", keys.KeyTypeKMS},
+	{"gcp-kms", keys.KeyTypeGCPKMS},
+	{"azure-kv", keys.KeyTypeAzureKV},
+}
+
+// initGitignoreEntries keep decrypted files and generated .env output out of git
+var initGitignoreEntries = []string{"*.dec", "*.dec.*", ".env", "*.env"}
+
+// initAnswers holds the answers given to 'puff init --interactive'
+type initAnswers struct {
+	identityFile string // Where to save a new age private key; empty for none
+	ageKeys      []string
+	envs         []string
+	gitignore    bool
+	hook         bool
+}
+
 func initAction(c *cli.Context) error {
 	dir := c.String("dir")
-	ageKeysStr := c.String("age-keys")
+	ageKeys := splitList(c.String("age-keys"))
 
-	// Parse age keys
-	ageKeys := []string{}
-	for _, key := range strings.Split(ageKeysStr, ",") {
-		trimmed := strings.TrimSpace(key)
-		if trimmed != "" {
-			ageKeys = append(ageKeys, trimmed)
+	var answers initAnswers
+	if c.Bool("interactive") {
+		haveKeys := len(ageKeys) > 0
+		for _, f := range keyTypeFlags {
+			haveKeys = haveKeys || c.String(f.flag) != ""
 		}
-	}
+		var err error
+		if answers, err = askInit(bufio.NewReader(c.App.Reader), dir, haveKeys); err != nil {
+			return err
+		}
+		ageKeys = append(ageKeys, answers.ageKeys...)
 
-	if len(ageKeys) == 0 {
-		return fmt.Errorf("at least one age public key is required for encryption")
+		// The private key is only written once every question is answered
+		if answers.identityFile != "" {
+			publicKey, err := keys.GenerateIdentity(answers.identityFile, time.Now().UTC())
+			if err != nil {
+				return err
+			}
+			color.Green("Saved the age private key to %s", answers.identityFile)
+			fmt.Printf("Public key: %s\n", publicKey)
+			if defaultFile, err := keys.DefaultIdentityFile(); err == nil && filepath.Clean(answers.identityFile) != filepath.Clean(defaultFile) {
+				color.Yellow("SOPS only reads this key with: export SOPS_AGE_KEY_FILE=%s", answers.identityFile)
+			}
+			ageKeys = append(ageKeys, publicKey)
+		}
 	}
 
-	// Validate age keys format
-	for _, key := range ageKeys {
-		if !strings.HasPrefix(key, "age1") {
-			return fmt.Errorf("invalid age key format: %s (must start with 'age1')", key)
+	// Validate age keys format. SSH public keys are age recipients too, so
+	// team members can use the keys they already have.
+	for i, key := range ageKeys {
+		if strings.HasPrefix(key, "ssh-") {
+			ageKeys[i] = keys.NormalizeKey(key)
+			if err := keys.ValidateKey(ageKeys[i]); err != nil {
+				return fmt.Errorf("invalid SSH key: %w", err)
+			}
+		} else if !strings.HasPrefix(key, "age1") {
+			return fmt.Errorf("invalid age key format: %s (must start with 'age1' or be an ssh-ed25519 or ssh-rsa public key)", key)
 		}
 	}
 
-	// Create base directory structure
-	dirs := []string{
-		filepath.Join(dir, "base"),
+	// PGP and cloud KMS keys share one key group with the age keys, so any of
+	// them can decrypt (e.g. an age key kept for break-glass access)
+	allKeys := ageKeys
+	typedKeys := make(map[keys.KeyType][]string)
+	for _, f := range keyTypeFlags {
+		for _, key := range splitList(c.String(f.flag)) {
+			if keys.TypeOf(key) != f.keyType {
+				return fmt.Errorf("invalid --%s key: %s", f.flag, key)
+			}
+			if err := keys.ValidateKey(key); err != nil {
+				return err
+			}
+			typedKeys[f.keyType] = append(typedKeys[f.keyType], key)
+			allKeys = append(allKeys, key)
+		}
 	}
 
-	for _, d := range dirs {
-		if err := os.MkdirAll(d, 0700); err != nil {
-			return fmt.Errorf("failed to create directory %s: %w", d, err)
-		}
+	if len(allKeys) == 0 {
+		return fmt.Errorf("at least one age public key (--age-keys) PGP fingerprint (--pgp), or cloud KMS key (--kms, --gcp-kms, --azure-kv) is required for encryption")
 	}
 
-	// Create base/shared.yml with example content
-	sharedYml := filepath.Join(dir, "base", "shared.yml")
+	// Create base/shared.yml, or where the layout in .puff.yaml puts it,
+	// with example content
+	sharedYml, err := store.LevelFile(dir, "", "", "")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(sharedYml), 0700); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", filepath.Dir(sharedYml), err)
+	}
 	if _, err := os.Stat(sharedYml); os.IsNotExist(err) {
 		// Create a valid YAML file with at least one key-value pair
 		content := `# Global shared configuration
@@ -83,38 +169,235 @@ _PUFF_INITIALIZED: "true"
 		}
 
 		// Encrypt the file
-		if err := keys.EncryptFile(sharedYml, ageKeys); err != nil {
+		if err := keys.EncryptFile(sharedYml, allKeys); err != nil {
 			return fmt.Errorf("failed to encrypt %s: %w", sharedYml, err)
 		}
 
 		color.Green("Created %s (encrypted)", sharedYml)
 	}
 
-	// Create .sops.yaml with the provided age keys
+	// Create .sops.yaml with the provided keys
 	sopsYml := filepath.Join(dir, ".sops.yaml")
 	if _, err := os.Stat(sopsYml); os.IsNotExist(err) {
-		// Build age keys list for SOPS config
-		ageKeysList := strings.Join(ageKeys, ",\n      ")
-		content := fmt.Sprintf(`# SOPS configuration for Puff
+		// Build key lists for SOPS config
+		content := `# SOPS configuration for Puff
 # This file was automatically generated during init
+# Config files live in subdirectories (base/, environments,
+# target-overrides/); .puff.yaml, keys.yml and meta.yml at the root aren't
+# encrypted
 creation_rules:
-  - path_regex: .*\.yml$
-    age: >-
-      %s
-`, ageKeysList)
+  - path_regex: ^[^./][^/]*/.+\.ya?ml$
+`
+		if len(ageKeys) > 0 {
+			content += fmt.Sprintf("    age: >-\n      %s\n", strings.Join(ageKeys, ",\n      "))
+		}
+		for _, f := range keyTypeFlags {
+			if len(typedKeys[f.keyType]) > 0 {
+				content += fmt.Sprintf("    %s: %s\n", f.keyType, strings.Join(typedKeys[f.keyType], ","))
+			}
+		}
 		// Write with restricted permissions (0600) as this contains encryption configuration
 		if err := os.WriteFile(sopsYml, []byte(content), 0600); err != nil {
 			return fmt.Errorf("failed to create %s: %w", sopsYml, err)
 		}
 		color.Green("Created %s", sopsYml)
+
+		// Only a new repository is at the current format; an existing one
+		// is upgraded with 'puff migrate'
+		project, err := config.LoadProject(dir)
+		if err != nil {
+			return err
+		}
+		if project.Format == 0 {
+			projectYml := filepath.Join(dir, config.ProjectFile)
+			_, statErr := os.Stat(projectYml)
+			if err := config.WriteFormat(dir, config.CurrentFormat); err != nil {
+				return err
+			}
+			if os.IsNotExist(statErr) {
+				color.Green("Created %s", projectYml)
+			}
+		}
+	}
+
+	for _, env := range answers.envs {
+		envDir := filepath.Join(dir, env)
+		if _, err := os.Stat(envDir); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(envDir, 0700); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", envDir, err)
+		}
+		color.Green("Created %s", envDir)
+	}
+
+	if answers.gitignore {
+		added, err := addGitignoreEntries(filepath.Join(dir, ".gitignore"), initGitignoreEntries)
+		if err != nil {
+			return err
+		}
+		if len(added) > 0 {
+			color.Green("Added %s to %s", strings.Join(added, ", "), filepath.Join(dir, ".gitignore"))
+		}
+	}
+
+	if answers.hook {
+		hookPath, err := installPreCommitHook(dir, "", false)
+		if err != nil {
+			return err
+		}
+		color.Green("Installed pre-commit hook: %s", hookPath)
 	}
 
 	color.Green("\nPuff configuration directory initialized with encryption!")
-	color.Cyan("\nAll configuration files will be encrypted with the provided age keys.")
+	color.Cyan("\nAll configuration files will be encrypted with the provided keys.")
 	color.Cyan("\nNext steps:")
-	color.Cyan("1. Create environment directories: mkdir %s/dev %s/prod", dir, dir)
-	color.Cyan("2. Add configuration: puff set -k KEY -v VALUE -r %s", dir)
-	color.Cyan("3. For bulk edits: puff decrypt <file> (edit) puff encrypt <file>")
+	step := 1
+	if len(answers.envs) == 0 {
+		color.Cyan("%d. Create environment directories: mkdir %s/dev %s/prod", step, dir, dir)
+		step++
+	}
+	color.Cyan("%d. Add configuration: puff set -k KEY -v VALUE -r %s", step, dir)
+	color.Cyan("%d. For bulk edits: puff decrypt <file> (edit) puff encrypt <file>", step+1)
 
 	return nil
 }
+
+// askInit asks the questions of 'puff init --interactive'. A new key pair is
+// offered by default when no keys were given as flags, and the pre-commit
+// hook is only offered inside a git repository.
+func askInit(reader *bufio.Reader, dir string, haveKeys bool) (initAnswers, error) {
+	var answers initAnswers
+
+	if askYesNo(reader, "Generate a new age key pair?", !haveKeys) {
+		defaultFile, err := keys.DefaultIdentityFile()
+		if err != nil {
+			return answers, err
+		}
+		answers.identityFile = expandHome(ask(reader, fmt.Sprintf("Save the private key to [%s]: ", defaultFile), defaultFile))
+	}
+
+	for {
+		answers.ageKeys = splitList(ask(reader, "Other age or SSH public keys to encrypt for, comma-separated (optional): ", ""))
+		err := validateAgeKeys(answers.ageKeys)
+		if err == nil {
+			break
+		}
+		color.Red("%v", err)
+	}
+
+	for {
+		answers.envs = splitList(ask(reader, "Environments to create, comma-separated [dev,prod]: ", "dev,prod"))
+		err := validateEnvNames(answers.envs)
+		if err == nil {
+			break
+		}
+		color.Red("%v", err)
+	}
+
+	answers.gitignore = askYesNo(reader, "Add decrypted files and .env output to .gitignore?", true)
+
+	if _, err := git.Open(dir); err == nil {
+		answers.hook = askYesNo(reader, "Install a git pre-commit hook that rejects plaintext config?", true)
+	}
+
+	return answers, nil
+}
+
+// ask prints a prompt and returns the trimmed answer, or def when the answer
+// is empty or the input has ended
+func ask(reader *bufio.Reader, prompt, def string) string {
+	fmt.Print(prompt)
+	line, err := reader.ReadString('\n')
+	if err == io.EOF {
+		fmt.Println()
+	}
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer
+	}
+	return def
+}
+
+// askYesNo asks a yes/no question, returning def for an empty answer
+func askYesNo(reader *bufio.Reader, question string, def bool) bool {
+	options := "[y/N]"
+	if def {
+		options = "[Y/n]"
+	}
+	for {
+		switch strings.ToLower(ask(reader, question+" "+options+" ", "")) {
+		case "":
+			return def
+		case "y", "yes":
+			return true
+		case "n", "no":
+			return false
+		}
+	}
+}
+
+// expandHome expands a leading ~/ to the home directory
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	return path
+}
+
+// validateAgeKeys checks that keys are age or SSH public keys
+func validateAgeKeys(ageKeys []string) error {
+	for _, key := range ageKeys {
+		if keys.TypeOf(key) != keys.KeyTypeAge {
+			return fmt.Errorf("invalid age key format: %s (must start with 'age1' or be an ssh-ed25519 or ssh-rsa public key)", key)
+		}
+		if err := keys.ValidateKey(keys.NormalizeKey(key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateEnvNames checks that names can be used as environment directories
+func validateEnvNames(envs []string) error {
+	for _, env := range envs {
+		if env == "base" || env == "target-overrides" || strings.HasPrefix(env, ".") || strings.ContainsAny(env, `/\`) {
+			return fmt.Errorf("invalid environment name: %s", env)
+		}
+	}
+	return nil
+}
+
+// addGitignoreEntries appends the entries missing from a .gitignore file,
+// creating it if needed, and returns the entries added
+func addGitignoreEntries(path string, entries []string) ([]string, error) {
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	present := make(map[string]bool)
+	for _, line := range strings.Split(string(existing), "\n") {
+		present[strings.TrimSpace(line)] = true
+	}
+
+	var added []string
+	for _, entry := range entries {
+		if !present[entry] {
+			added = append(added, entry)
+		}
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	content := string(existing)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	content += "# Decrypted config and generated output (added by 'puff init')\n" + strings.Join(added, "\n") + "\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return added, nil
+}
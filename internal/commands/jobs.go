@@ -0,0 +1,25 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/teamcurri/puff/internal/parallel"
+	"github.com/urfave/cli/v2"
+)
+
+// JobsFlag creates the global --jobs flag, which bounds how many files are
+// decrypted or re-encrypted at once
+func JobsFlag() cli.Flag {
+	return &cli.IntFlag{
+		Name:    "jobs",
+		Usage:   "Number of files to decrypt or re-encrypt at once (default: number of CPUs)",
+		EnvVars: []string{"PUFF_JOBS"},
+		Action: func(c *cli.Context, jobs int) error {
+			if jobs < 1 {
+				return fmt.Errorf("--jobs must be at least 1, got %d", jobs)
+			}
+			parallel.Jobs = jobs
+			return nil
+		},
+	}
+}
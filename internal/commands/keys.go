@@ -1,10 +1,20 @@
 package commands
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/audit"
 	"github.com/teamcurri/puff/internal/keys"
+	"github.com/teamcurri/puff/internal/store"
 	"github.com/urfave/cli/v2"
 )
 
@@ -17,6 +27,84 @@ func KeysCommand() *cli.Command {
 			keysAddCommand(),
 			keysRmCommand(),
 			keysListCommand(),
+			keysRotateCommand(),
+			keysGroupCommand(),
+			keysAuditCommand(),
+			keysMatrixCommand(),
+		},
+	}
+}
+
+func keysGroupCommand() *cli.Command {
+	envFlag := &cli.StringFlag{
+		Name:    "env",
+		Aliases: []string{"e"},
+		Usage:   "Only update files in specific environment",
+	}
+	rootFlag := &cli.StringFlag{
+		Name:    "root",
+		Aliases: []string{"r"},
+		Usage:   "Root directory for config files",
+		Value:   ".",
+	}
+	thresholdFlag := &cli.IntFlag{
+		Name:    "threshold",
+		Aliases: []string{"t"},
+		Usage:   "Number of key groups required to decrypt (defaults to keeping the current threshold)",
+	}
+
+	return &cli.Command{
+		Name:  "group",
+		Usage: "Manage Shamir key groups (threshold decryption)",
+		Subcommands: []*cli.Command{
+			{
+				Name:   "list",
+				Usage:  "List the key groups and threshold of each encrypted file",
+				Flags:  []cli.Flag{envFlag, rootFlag},
+				Action: keysGroupListAction,
+			},
+			{
+				Name:  "add",
+				Usage: "Add a key group and re-split the data key of each file",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "keys",
+						Aliases:  []string{"k"},
+						Usage:    "Comma-separated keys in the new group (age, SSH, PGP, or cloud KMS)",
+						Required: true,
+					},
+					thresholdFlag, envFlag, rootFlag,
+				},
+				Action: keysGroupAddAction,
+			},
+			{
+				Name:  "rm",
+				Usage: "Remove a key group and re-split the data key of each file",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:     "group",
+						Aliases:  []string{"g"},
+						Usage:    "Number of the key group to remove, as shown by 'keys group list'",
+						Required: true,
+					},
+					thresholdFlag, envFlag, rootFlag,
+				},
+				Action: keysGroupRmAction,
+			},
+			{
+				Name:  "threshold",
+				Usage: "Set the number of key groups required to decrypt",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:     "threshold",
+						Aliases:  []string{"t"},
+						Usage:    "Number of key groups required to decrypt",
+						Required: true,
+					},
+					envFlag, rootFlag,
+				},
+				Action: keysGroupThresholdAction,
+			},
 		},
 	}
 }
@@ -24,24 +112,44 @@ func KeysCommand() *cli.Command {
 func keysAddCommand() *cli.Command {
 	return &cli.Command{
 		Name:  "add",
-		Usage: "Add an age key and re-encrypt all files",
+		Usage: "Add an age or SSH key, PGP fingerprint, or cloud KMS key and re-encrypt all files",
 		Flags: []cli.Flag{
 			&cli.StringFlag{
-				Name:     "key",
-				Aliases:  []string{"k"},
-				Usage:    "Age public key to add",
-				Required: true,
+				Name:    "key",
+				Aliases: []string{"k"},
+				Usage:   "Age public key, SSH public key, PGP fingerprint, or cloud KMS key (AWS KMS ARN, GCP KMS resource ID, Azure Key Vault URL) to add",
+			},
+			&cli.StringFlag{
+				Name:  "from-file",
+				Usage: "Add every key in an age recipients file (one key per line, '#' comments)",
+			},
+			&cli.StringFlag{
+				Name:  "from-url",
+				Usage: "Add every key in an age recipients file downloaded over HTTPS",
 			},
 			&cli.StringFlag{
 				Name:    "comment",
 				Aliases: []string{"c"},
-				Usage:   "Comment for the key (e.g., 'Bob's laptop')",
+				Usage:   "Comment for the key (e.g., 'Bob's laptop'); with --from-file/--from-url, for keys without one",
+			},
+			&cli.StringFlag{
+				Name:  "owner",
+				Usage: "Person responsible for the key, recorded in keys.yml",
+			},
+			&cli.StringFlag{
+				Name:  "team",
+				Usage: "Team the key belongs to, recorded in keys.yml",
+			},
+			&cli.StringFlag{
+				Name:  "expires",
+				Usage: "Date the key should be rotated out (YYYY-MM-DD), recorded in keys.yml",
 			},
 			&cli.StringFlag{
 				Name:    "env",
 				Aliases: []string{"e"},
 				Usage:   "Only update files in specific environment",
 			},
+			dryRunFlag(),
 			&cli.StringFlag{
 				Name:    "root",
 				Aliases: []string{"r"},
@@ -56,12 +164,12 @@ func keysAddCommand() *cli.Command {
 func keysRmCommand() *cli.Command {
 	return &cli.Command{
 		Name:  "rm",
-		Usage: "Remove an age key and re-encrypt all files",
+		Usage: "Remove an age or SSH key, PGP fingerprint, or cloud KMS key and re-encrypt all files",
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:     "key",
 				Aliases:  []string{"k"},
-				Usage:    "Age public key to remove",
+				Usage:    "Age public key, SSH public key, PGP fingerprint, or cloud KMS key to remove",
 				Required: true,
 			},
 			&cli.StringFlag{
@@ -69,6 +177,11 @@ func keysRmCommand() *cli.Command {
 				Aliases: []string{"e"},
 				Usage:   "Only update files in specific environment",
 			},
+			&cli.BoolFlag{
+				Name:  "rotate",
+				Usage: "Also rotate the data keys of the updated files (see 'keys rotate')",
+			},
+			dryRunFlag(),
 			&cli.StringFlag{
 				Name:    "root",
 				Aliases: []string{"r"},
@@ -80,6 +193,27 @@ func keysRmCommand() *cli.Command {
 	}
 }
 
+func keysRotateCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "rotate",
+		Usage: "Re-encrypt all files under fresh data keys",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "env",
+				Aliases: []string{"e"},
+				Usage:   "Only rotate files in specific environment",
+			},
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: keysRotateAction,
+	}
+}
+
 func keysListCommand() *cli.Command {
 	return &cli.Command{
 		Name:  "list",
@@ -97,17 +231,67 @@ func keysListCommand() *cli.Command {
 }
 
 func keysAddAction(c *cli.Context) error {
-	key := c.String("key")
 	comment := c.String("comment")
 	env := c.String("env")
 	rootDir := c.String("root")
 
-	color.Yellow("Adding key to encrypted files...")
+	recipients, err := recipientsToAdd(c)
+	if err != nil {
+		return err
+	}
+
+	registry, err := keys.LoadRegistry(rootDir)
+	if err != nil {
+		return err
+	}
+	for _, recipient := range recipients {
+		entry := keys.RegistryEntry{
+			Key:     recipient.Key,
+			Comment: recipient.Comment,
+			Owner:   c.String("owner"),
+			Team:    c.String("team"),
+			Added:   time.Now().Format(keys.DateFormat),
+			Expires: c.String("expires"),
+		}
+		if err := registry.Put(entry); err != nil {
+			return err
+		}
+	}
+
+	if c.Bool("dry-run") {
+		return planAddKeys(rootDir, recipients, env)
+	}
+
+	if c.IsSet("key") {
+		color.Yellow("Adding key to encrypted files...")
+	} else {
+		color.Yellow("Adding %d key(s) to encrypted files...", len(recipients))
+	}
 
-	if err := keys.AddKey(rootDir, key, comment, env); err != nil {
+	if err := keys.AddKeys(rootDir, recipients, env); err != nil {
 		return fmt.Errorf("failed to add key: %w", err)
 	}
 
+	if err := registry.Save(rootDir); err != nil {
+		return err
+	}
+
+	records := make([]audit.Record, 0, len(recipients))
+	for _, recipient := range recipients {
+		records = append(records, audit.Record{Recipient: recipient.Key, Env: env})
+	}
+	if err := store.RecordAudit(rootDir, "keys add", records...); err != nil {
+		return err
+	}
+
+	if !c.IsSet("key") {
+		for _, recipient := range recipients {
+			fmt.Printf("  %s\n", recipientLabel(recipient.Key, map[string]string{recipient.Key: recipient.Comment}))
+		}
+		color.Green("Successfully added %d key(s) to %s", len(recipients), filesDescription(env))
+		return nil
+	}
+
 	if env != "" {
 		color.Green("Successfully added key to files in environment: %s", env)
 	} else {
@@ -121,26 +305,244 @@ func keysAddAction(c *cli.Context) error {
 	return nil
 }
 
+// planAddKeys reports the keys keys add would add and the files it would
+// update, without changing anything
+func planAddKeys(rootDir string, recipients []keys.Recipient, env string) error {
+	files, err := keys.PlanAddKeys(rootDir, recipients, env)
+	if err != nil {
+		return fmt.Errorf("failed to add key: %w", err)
+	}
+
+	comments := make(map[string]string, len(recipients))
+	for _, recipient := range recipients {
+		comments[recipient.Key] = recipient.Comment
+	}
+	color.Cyan("Would add %d key(s) to .sops.yaml and %s:", len(recipients), keys.RegistryFile)
+	for _, recipient := range recipients {
+		fmt.Printf("  %s\n", recipientLabel(recipient.Key, comments))
+	}
+	printPlannedFiles(rootDir, files)
+	printDryRunDone()
+	return nil
+}
+
+// printPlannedFiles lists the files a dry run would update
+func printPlannedFiles(rootDir string, files []string) {
+	if len(files) == 0 {
+		fmt.Println("No encrypted files would change")
+		return
+	}
+	color.Cyan("Would update %d encrypted file(s):", len(files))
+	for _, file := range files {
+		fmt.Printf("  %s\n", relativeSource(rootDir, file))
+	}
+}
+
+// maxRecipientsSize limits the size of a downloaded recipients file
+const maxRecipientsSize = 1 << 20
+
+// recipientsToAdd returns the keys passed to keys add, either as --key or
+// read from a recipients file. --comment applies to keys without a comment.
+func recipientsToAdd(c *cli.Context) ([]keys.Recipient, error) {
+	sources := 0
+	for _, name := range []string{"key", "from-file", "from-url"} {
+		if c.IsSet(name) {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, fmt.Errorf("exactly one of --key, --from-file, or --from-url is required")
+	}
+
+	comment := c.String("comment")
+	if c.IsSet("key") {
+		return []keys.Recipient{{Key: keys.NormalizeKey(c.String("key")), Comment: comment}}, nil
+	}
+
+	var source string
+	var data []byte
+	var err error
+	if c.IsSet("from-file") {
+		source = c.String("from-file")
+		data, err = os.ReadFile(source)
+	} else {
+		source = c.String("from-url")
+		data, err = fetchRecipients(c.Context, source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keys from %s: %w", source, err)
+	}
+
+	recipients, err := keys.ParseRecipients(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", source, err)
+	}
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("no keys found in %s", source)
+	}
+	for i := range recipients {
+		if recipients[i].Comment == "" {
+			recipients[i].Comment = comment
+		}
+	}
+
+	return recipients, nil
+}
+
+// fetchRecipients downloads a recipients file. Plain HTTP is only allowed to
+// the local machine, since anyone able to tamper with the download could
+// add their own key.
+func fetchRecipients(ctx context.Context, rawURL string) ([]byte, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme != "https" && !(parsed.Scheme == "http" && isLoopbackHost(parsed.Hostname())) {
+		return nil, fmt.Errorf("refusing to download keys over %s (use an https:// URL)", parsed.Scheme)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRecipientsSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxRecipientsSize {
+		return nil, fmt.Errorf("recipients file is larger than %d bytes", maxRecipientsSize)
+	}
+	return data, nil
+}
+
+// isLoopbackHost reports whether host refers to the local machine
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
 func keysRmAction(c *cli.Context) error {
-	key := c.String("key")
+	key := keys.NormalizeKey(c.String("key"))
 	env := c.String("env")
 	rootDir := c.String("root")
 
+	if c.Bool("dry-run") {
+		return planRemoveKey(rootDir, key, env, c.Bool("rotate"))
+	}
+
 	color.Yellow("Removing key from encrypted files...")
 
 	if err := keys.RemoveKey(rootDir, key, env); err != nil {
 		return fmt.Errorf("failed to remove key: %w", err)
 	}
 
+	// Keys removed from a single environment may still be in use elsewhere
+	if env == "" {
+		registry, err := keys.LoadRegistry(rootDir)
+		if err != nil {
+			return err
+		}
+		if registry.Exists() && registry.Get(key) != nil {
+			registry.Remove(key)
+			if err := registry.Save(rootDir); err != nil {
+				return err
+			}
+		}
+	}
+
 	if env != "" {
 		color.Green("Successfully removed key from files in environment: %s", env)
 	} else {
 		color.Green("Successfully removed key from all encrypted files")
 	}
 
+	if err := store.RecordAudit(rootDir, "keys rm", audit.Record{Recipient: key, Env: env}); err != nil {
+		return err
+	}
+
+	if c.Bool("rotate") {
+		return rotateDataKeys(rootDir, env)
+	}
+
 	return nil
 }
 
+// planRemoveKey reports the files keys rm would update, without changing
+// anything
+func planRemoveKey(rootDir, key, env string, rotate bool) error {
+	files, err := keys.PlanRemoveKey(rootDir, key, env)
+	if err != nil {
+		return fmt.Errorf("failed to remove key: %w", err)
+	}
+	registry, err := keys.LoadRegistry(rootDir)
+	if err != nil {
+		return err
+	}
+
+	updated := ".sops.yaml"
+	if env == "" && registry.Exists() && registry.Get(key) != nil {
+		updated += " and " + keys.RegistryFile
+	}
+	color.Cyan("Would remove %s from %s", recipientLabel(key, keyComments(rootDir, registry)), updated)
+	printPlannedFiles(rootDir, files)
+	if rotate {
+		color.Cyan("Would then rotate the data keys of %s", filesDescription(env))
+	}
+	printDryRunDone()
+	return nil
+}
+
+func keysRotateAction(c *cli.Context) error {
+	return rotateDataKeys(c.String("root"), c.String("env"))
+}
+
+// rotateDataKeys rotates the data keys of the encrypted files in rootDir,
+// optionally filtered by environment, and reports the rotated files
+func rotateDataKeys(rootDir, env string) error {
+	color.Yellow("Rotating data keys...")
+
+	files, err := keys.RotateDataKeys(rootDir, env)
+	if err != nil {
+		return fmt.Errorf("failed to rotate data keys: %w", err)
+	}
+
+	for _, file := range files {
+		fmt.Printf("  %s\n", relativeSource(rootDir, file))
+	}
+	color.Green("Rotated data keys of %d file(s)", len(files))
+
+	return nil
+}
+
+// keyListEntry is an encryption key in the JSON output of keys list. Envs
+// lists the environments with files encrypted to the key, and Declared
+// whether .sops.yaml lists it.
+type keyListEntry struct {
+	Key      string   `json:"key"`
+	Comment  string   `json:"comment,omitempty"`
+	Owner    string   `json:"owner,omitempty"`
+	Team     string   `json:"team,omitempty"`
+	Added    string   `json:"added,omitempty"`
+	Expires  string   `json:"expires,omitempty"`
+	Envs     []string `json:"envs"`
+	Declared bool     `json:"declared"`
+	Warnings []string `json:"warnings"`
+}
+
 func keysListAction(c *cli.Context) error {
 	rootDir := c.String("root")
 
@@ -149,21 +551,162 @@ func keysListAction(c *cli.Context) error {
 		return fmt.Errorf("failed to list keys: %w", err)
 	}
 
-	if len(keyList) == 0 {
+	if len(keyList) == 0 && !jsonOutput(c) {
 		color.Yellow("No encryption keys found")
 		return nil
 	}
 
+	registry, err := keys.LoadRegistry(rootDir)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	if jsonOutput(c) {
+		entries := make([]keyListEntry, 0, len(keyList))
+		for _, keyInfo := range keyList {
+			entry := keyListEntry{Key: keyInfo.Key, Comment: keyInfo.Comment, Envs: keyInfo.Envs, Declared: keyInfo.Declared, Warnings: keyWarnings(keyInfo, registry, now)}
+			if registryEntry := registry.Get(keyInfo.Key); registryEntry != nil {
+				entry.Owner = registryEntry.Owner
+				entry.Team = registryEntry.Team
+				entry.Added = registryEntry.Added
+				entry.Expires = registryEntry.Expires
+			}
+			entries = append(entries, entry)
+		}
+		return printJSON(entries, "key list")
+	}
+
 	color.Cyan("\nEncryption keys:")
 	for i, keyInfo := range keyList {
 		fmt.Printf("\n%d. %s\n", i+1, keyInfo.Key)
 		if keyInfo.Comment != "" {
 			fmt.Printf("   Comment: %s\n", keyInfo.Comment)
 		}
+		if entry := registry.Get(keyInfo.Key); entry != nil {
+			if entry.Owner != "" {
+				fmt.Printf("   Owner: %s\n", entry.Owner)
+			}
+			if entry.Team != "" {
+				fmt.Printf("   Team: %s\n", entry.Team)
+			}
+			if entry.Added != "" {
+				fmt.Printf("   Added: %s\n", entry.Added)
+			}
+			if entry.Expires != "" {
+				fmt.Printf("   Expires: %s\n", entry.Expires)
+			}
+		}
 		if len(keyInfo.Envs) > 0 {
 			fmt.Printf("   Environments: %v\n", keyInfo.Envs)
 		}
+		for _, warning := range keyWarnings(keyInfo, registry, now) {
+			color.Red("   Warning: %s", warning)
+		}
+	}
+
+	return nil
+}
+
+// keyWarnings describes problems with a key: declared in .sops.yaml but
+// unused, used but undeclared, and once keys.yml exists, the problems the
+// registry finds
+func keyWarnings(keyInfo keys.KeyInfo, registry *keys.Registry, now time.Time) []string {
+	warnings := []string{}
+	switch {
+	case keyInfo.Unused():
+		warnings = append(warnings, "declared in .sops.yaml but no files are encrypted to it")
+	case keyInfo.Undeclared():
+		warnings = append(warnings, "files are encrypted to it but it isn't declared in .sops.yaml")
+	}
+	if registry.Exists() {
+		warnings = append(warnings, registry.Warnings(keyInfo.Key, now)...)
+	}
+	return warnings
+}
+
+// keyComments returns the comment for each key, preferring keys.yml over the
+// comments in .sops.yaml
+func keyComments(rootDir string, registry *keys.Registry) map[string]string {
+	sopsConfig, _ := keys.LoadSOPSConfig(rootDir)
+	return keys.Comments(sopsConfig, registry)
+}
+
+func keysGroupListAction(c *cli.Context) error {
+	rootDir := c.String("root")
+
+	files, err := keys.ListKeyGroups(rootDir, c.String("env"))
+	if err != nil {
+		return fmt.Errorf("failed to list key groups: %w", err)
+	}
+
+	if len(files) == 0 {
+		color.Yellow("No encrypted files found")
+		return nil
+	}
+
+	for _, file := range files {
+		color.Cyan("\n%s", relativeSource(rootDir, file.Path))
+		if file.IsShamir() {
+			fmt.Printf("   Threshold: %d of %d groups\n", file.EffectiveThreshold(), len(file.Groups))
+		}
+		for i, group := range file.Groups {
+			fmt.Printf("   Group %d: %s\n", i+1, strings.Join(group, ", "))
+		}
+	}
+
+	return nil
+}
+
+func keysGroupAddAction(c *cli.Context) error {
+	groupKeys := splitList(c.String("keys"))
+	for i, key := range groupKeys {
+		groupKeys[i] = keys.NormalizeKey(key)
+	}
+	env := c.String("env")
+
+	color.Yellow("Adding key group to encrypted files...")
+
+	if err := keys.AddKeyGroup(c.String("root"), groupKeys, c.Int("threshold"), env); err != nil {
+		return fmt.Errorf("failed to add key group: %w", err)
+	}
+
+	color.Green("Successfully added key group to %s", filesDescription(env))
+	return nil
+}
+
+func keysGroupRmAction(c *cli.Context) error {
+	env := c.String("env")
+
+	color.Yellow("Removing key group from encrypted files...")
+
+	if err := keys.RemoveKeyGroup(c.String("root"), c.Int("group"), c.Int("threshold"), env); err != nil {
+		return fmt.Errorf("failed to remove key group: %w", err)
 	}
 
+	color.Green("Successfully removed key group %d from %s", c.Int("group"), filesDescription(env))
 	return nil
 }
+
+func keysGroupThresholdAction(c *cli.Context) error {
+	threshold := c.Int("threshold")
+	if threshold < 1 {
+		return fmt.Errorf("invalid threshold: %d", threshold)
+	}
+	env := c.String("env")
+
+	if err := keys.SetThreshold(c.String("root"), threshold, env); err != nil {
+		return fmt.Errorf("failed to set threshold: %w", err)
+	}
+
+	color.Green("Set threshold to %d for %s", threshold, filesDescription(env))
+	return nil
+}
+
+// filesDescription describes the files a key command updated
+func filesDescription(env string) string {
+	if env != "" {
+		return fmt.Sprintf("files in environment: %s", env)
+	}
+	return "all encrypted files"
+}
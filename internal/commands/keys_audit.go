@@ -0,0 +1,215 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/keys"
+	"github.com/urfave/cli/v2"
+)
+
+// auditExitCode is the exit code used when the audit finds a problem
+const auditExitCode = 1
+
+func keysAuditCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "audit",
+		Usage: "Show which keys can decrypt which files and flag missing or unconfigured recipients",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "require",
+				Aliases: []string{"q"},
+				Usage:   "Comma-separated keys (or their comments) every file must be encrypted to",
+			},
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"f"},
+				Usage:   "Output format: table, json, or markdown",
+				Value:   "table",
+			},
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: keysAuditAction,
+	}
+}
+
+func keysAuditAction(c *cli.Context) error {
+	rootDir := c.String("root")
+	format := reportFormat(c)
+	if format != "table" && format != "json" && format != "markdown" {
+		return fmt.Errorf("unsupported audit format %q (use table, json, or markdown)", format)
+	}
+
+	failed, err := forEachRoot(rootDir, format == "json", "audit report", func(rootDir string) (interface{}, bool, error) {
+		registry, err := keys.LoadRegistry(rootDir)
+		if err != nil {
+			return nil, false, err
+		}
+		comments := keyComments(rootDir, registry)
+
+		required, err := resolveRequiredKeys(splitList(c.String("require")), comments)
+		if err != nil {
+			return nil, false, err
+		}
+
+		report, err := keys.Audit(rootDir, required)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to audit keys: %w", err)
+		}
+
+		switch format {
+		case "markdown":
+			printAuditMarkdown(report, comments)
+		case "table":
+			if err := printAuditTable(report, comments); err != nil {
+				return nil, false, err
+			}
+		}
+		return report, report.HasFindings(), nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if failed {
+		return cli.Exit("", auditExitCode)
+	}
+	return nil
+}
+
+// resolveRequiredKeys maps each required value to a key, accepting either
+// the key itself or its comment from keys.yml or .sops.yaml
+func resolveRequiredKeys(values []string, comments map[string]string) ([]string, error) {
+	required := make([]string, 0, len(values))
+	for _, value := range values {
+		var matches []string
+		for key, comment := range comments {
+			if comment == value {
+				matches = append(matches, key)
+			}
+		}
+		switch len(matches) {
+		case 0:
+			required = append(required, keys.NormalizeKey(value))
+		case 1:
+			required = append(required, matches[0])
+		default:
+			return nil, fmt.Errorf("comment %q matches %d keys; pass the key instead", value, len(matches))
+		}
+	}
+	return required, nil
+}
+
+// auditCells returns the access matrix row for a file: an "x" for each
+// recipient that can decrypt it
+func auditCells(report *keys.AuditReport, file keys.AuditFile) []string {
+	cells := []string{file.Path, file.Env}
+	for _, recipient := range report.Recipients {
+		if file.HasRecipient(recipient) {
+			cells = append(cells, "x")
+		} else {
+			cells = append(cells, "-")
+		}
+	}
+	return cells
+}
+
+// auditLabels returns readable labels for a list of keys
+func auditLabels(keyList []string, comments map[string]string) []string {
+	labels := make([]string, 0, len(keyList))
+	for _, key := range keyList {
+		labels = append(labels, recipientLabel(key, comments))
+	}
+	return labels
+}
+
+func printAuditTable(report *keys.AuditReport, comments map[string]string) error {
+	color.Cyan("Access matrix:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := append([]string{"FILE", "ENV"}, auditLabels(report.Recipients, comments)...)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, file := range report.Files {
+		fmt.Fprintln(w, strings.Join(auditCells(report, file), "\t"))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	missing := 0
+	for _, file := range report.Files {
+		if len(file.Missing) == 0 {
+			continue
+		}
+		if missing == 0 {
+			color.Red("\nFiles missing required recipients:")
+		}
+		missing++
+		fmt.Printf("  %s: %s\n", file.Path, strings.Join(auditLabels(file.Missing, comments), ", "))
+	}
+
+	if len(report.Unconfigured) > 0 {
+		color.Red("\nRecipients not in .sops.yaml:")
+		for _, key := range report.Unconfigured {
+			fmt.Printf("  %s (%s)\n", recipientLabel(key, comments), key)
+		}
+	}
+
+	if !report.HasFindings() {
+		color.Green("\nNo audit findings")
+	}
+	return nil
+}
+
+func printAuditMarkdown(report *keys.AuditReport, comments map[string]string) {
+	row := func(cells []string) {
+		for i, cell := range cells {
+			cells[i] = strings.ReplaceAll(cell, "|", "\\|")
+		}
+		fmt.Printf("| %s |\n", strings.Join(cells, " | "))
+	}
+
+	fmt.Println("# Key audit")
+	fmt.Println()
+	header := append([]string{"File", "Env"}, auditLabels(report.Recipients, comments)...)
+	row(header)
+	separator := make([]string, len(header))
+	for i := range separator {
+		separator[i] = "---"
+	}
+	row(separator)
+	for _, file := range report.Files {
+		row(auditCells(report, file))
+	}
+
+	fmt.Println()
+	fmt.Println("## Files missing required recipients")
+	fmt.Println()
+	missing := 0
+	for _, file := range report.Files {
+		if len(file.Missing) > 0 {
+			missing++
+			fmt.Printf("- `%s`: %s\n", file.Path, strings.Join(auditLabels(file.Missing, comments), ", "))
+		}
+	}
+	if missing == 0 {
+		fmt.Println("None")
+	}
+
+	fmt.Println()
+	fmt.Println("## Recipients not in .sops.yaml")
+	fmt.Println()
+	for _, key := range report.Unconfigured {
+		fmt.Printf("- %s (`%s`)\n", recipientLabel(key, comments), key)
+	}
+	if len(report.Unconfigured) == 0 {
+		fmt.Println("None")
+	}
+}
@@ -0,0 +1,175 @@
+package commands
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/teamcurri/puff/internal/git"
+	"github.com/teamcurri/puff/internal/keys"
+	"github.com/urfave/cli/v2"
+)
+
+// keyMatrix is the output of keys matrix: which recipients can decrypt
+// the files of which environments
+type keyMatrix struct {
+	Envs []string       `json:"envs"`
+	Keys []keyMatrixRow `json:"keys"`
+}
+
+// keyMatrixRow is a recipient in the access matrix. FirstSeen is the date of
+// the first commit that added the key, empty outside git or if the key
+// hasn't been committed.
+type keyMatrixRow struct {
+	Key       string   `json:"key"`
+	Comment   string   `json:"comment,omitempty"`
+	Owner     string   `json:"owner,omitempty"`
+	Team      string   `json:"team,omitempty"`
+	FirstSeen string   `json:"first_seen,omitempty"`
+	Envs      []string `json:"envs"`
+}
+
+func keysMatrixCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "matrix",
+		Usage: "Print a recipients by environments grid for access reviews",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"f"},
+				Usage:   "Output format: markdown, csv, or json",
+				Value:   "markdown",
+			},
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: keysMatrixAction,
+	}
+}
+
+func keysMatrixAction(c *cli.Context) error {
+	format := reportFormat(c)
+	if format != "markdown" && format != "csv" && format != "json" {
+		return fmt.Errorf("unsupported matrix format %q (use markdown, csv, or json)", format)
+	}
+
+	matrix, err := buildKeyMatrix(c.String("root"))
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "json":
+		return printJSON(matrix, "key matrix")
+	case "csv":
+		return printKeyMatrixCSV(matrix)
+	}
+	printKeyMatrixMarkdown(matrix)
+	return nil
+}
+
+// buildKeyMatrix collects the keys of a config root with their comments,
+// owners, and the environments they can decrypt. Environments are sorted,
+// with base first.
+func buildKeyMatrix(rootDir string) (*keyMatrix, error) {
+	keyList, err := keys.ListKeys(rootDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys: %w", err)
+	}
+	registry, err := keys.LoadRegistry(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	// First-seen dates are left out outside git
+	repo, _ := git.Open(rootDir)
+
+	matrix := &keyMatrix{Envs: []string{}, Keys: make([]keyMatrixRow, 0, len(keyList))}
+	seen := make(map[string]bool)
+	for _, keyInfo := range keyList {
+		row := keyMatrixRow{Key: keyInfo.Key, Comment: keyInfo.Comment, Envs: keyInfo.Envs}
+		if entry := registry.Get(keyInfo.Key); entry != nil {
+			row.Owner = entry.Owner
+			row.Team = entry.Team
+		}
+		if repo != nil {
+			if row.FirstSeen, err = repo.FirstSeen(keyInfo.Key); err != nil {
+				return nil, err
+			}
+		}
+		for _, env := range keyInfo.Envs {
+			if !seen[env] {
+				seen[env] = true
+				matrix.Envs = append(matrix.Envs, env)
+			}
+		}
+		matrix.Keys = append(matrix.Keys, row)
+	}
+	sort.Slice(matrix.Envs, func(i, j int) bool {
+		if matrix.Envs[i] == "base" || matrix.Envs[j] == "base" {
+			return matrix.Envs[i] == "base" && matrix.Envs[j] != "base"
+		}
+		return matrix.Envs[i] < matrix.Envs[j]
+	})
+	return matrix, nil
+}
+
+// keyMatrixCells returns the cells of a row: the key's details, then a mark
+// for each environment, yes if the key can decrypt it and no if not
+func keyMatrixCells(matrix *keyMatrix, row keyMatrixRow, yes, no string) []string {
+	cells := []string{row.Key, row.Comment, row.Owner, row.Team, row.FirstSeen}
+	for _, env := range matrix.Envs {
+		mark := no
+		for _, keyEnv := range row.Envs {
+			if keyEnv == env {
+				mark = yes
+				break
+			}
+		}
+		cells = append(cells, mark)
+	}
+	return cells
+}
+
+func printKeyMatrixCSV(matrix *keyMatrix) error {
+	w := csv.NewWriter(os.Stdout)
+	if err := w.Write(append([]string{"key", "comment", "owner", "team", "first_seen"}, matrix.Envs...)); err != nil {
+		return err
+	}
+	for _, row := range matrix.Keys {
+		if err := w.Write(keyMatrixCells(matrix, row, "x", "")); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func printKeyMatrixMarkdown(matrix *keyMatrix) {
+	row := func(cells []string) {
+		for i, cell := range cells {
+			cells[i] = strings.ReplaceAll(cell, "|", "\\|")
+		}
+		fmt.Printf("| %s |\n", strings.Join(cells, " | "))
+	}
+
+	fmt.Println("# Key access matrix")
+	fmt.Println()
+	header := append([]string{"Key", "Comment", "Owner", "Team", "First seen"}, matrix.Envs...)
+	row(header)
+	separator := make([]string, len(header))
+	for i := range separator {
+		separator[i] = "---"
+	}
+	row(separator)
+	for _, keyRow := range matrix.Keys {
+		cells := keyMatrixCells(matrix, keyRow, "x", "-")
+		cells[0] = "`" + cells[0] + "`"
+		row(cells)
+	}
+}
@@ -0,0 +1,188 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/lint"
+	"github.com/teamcurri/puff/internal/store"
+	"github.com/urfave/cli/v2"
+)
+
+// lintExitCode is the exit code used when lint finds an error
+const lintExitCode = 1
+
+// LintCommand creates the lint command for checking config conventions
+func LintCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "lint",
+		Usage: "Check config files for naming, duplicated, unused, and overridden keys, and empty files",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "strict",
+				Usage: "Exit with an error on warnings too",
+			},
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"f"},
+				Usage:   "Output format: table or json",
+				Value:   "table",
+			},
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: lintAction,
+	}
+}
+
+func lintAction(c *cli.Context) error {
+	rootDir := c.String("root")
+	format := reportFormat(c)
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unsupported report format %q (use table or json)", format)
+	}
+
+	findings, fileCount, err := runLint(rootDir)
+	if err != nil {
+		return err
+	}
+
+	errorCount, warningCount := 0, 0
+	for _, finding := range findings {
+		if finding.Severity == config.LintError {
+			errorCount++
+		} else {
+			warningCount++
+		}
+	}
+
+	if format == "json" {
+		data, err := json.MarshalIndent(findings, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal lint findings: %w", err)
+		}
+		fmt.Println(string(data))
+	} else if len(findings) == 0 {
+		color.Green("✓ %d config file(s) linted, no problems found", fileCount)
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SEVERITY\tFILE\tRULE\tMESSAGE")
+		for _, finding := range findings {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", finding.Severity, finding.File, finding.Rule, finding.Message)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		summary := fmt.Sprintf("\n%d error(s), %d warning(s) in %d config file(s)", errorCount, warningCount, fileCount)
+		if errorCount > 0 {
+			color.Red(summary)
+		} else {
+			color.Yellow(summary)
+		}
+	}
+
+	if errorCount > 0 || (c.Bool("strict") && warningCount > 0) {
+		return cli.Exit("", lintExitCode)
+	}
+	return nil
+}
+
+// runLint lints the config files under the root directory with the rules
+// configured in .puff.yaml, and returns the findings and the number of files
+// linted
+func runLint(rootDir string) ([]lint.Finding, int, error) {
+	project, err := config.LoadProject(rootDir)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	files, chains, err := loadLintFiles(rootDir)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	findings, err := lint.Run(files, chains, project.Lint)
+	if err != nil {
+		return nil, 0, err
+	}
+	return findings, len(files), nil
+}
+
+// loadLintFiles reads and decrypts every config file, and returns them with
+// the files that make up each config context
+func loadLintFiles(rootDir string) ([]lint.File, [][]string, error) {
+	paths, err := listConfigFiles(rootDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	project, err := config.LoadProject(rootDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var files []lint.File
+	exists := make(map[string]bool)
+	for _, path := range paths {
+		name := relativeSource(rootDir, path)
+		values, err := store.Read(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", name, err)
+		}
+		file := lint.File{Path: filepath.ToSlash(name), Values: values}
+		if level, ok := project.FileLevel(name); ok {
+			level.App = ""
+			file.Shared = filepath.ToSlash(relativeSource(rootDir, project.LevelFile(rootDir, level)))
+		}
+		files = append(files, file)
+		exists[path] = true
+	}
+
+	chains, err := lintChains(rootDir, exists)
+	if err != nil {
+		return nil, nil, err
+	}
+	return files, chains, nil
+}
+
+// lintChains returns the existing files that make up the config of every
+// app in every environment, with and without each target, as paths relative
+// to the root directory
+func lintChains(rootDir string, exists map[string]bool) ([][]string, error) {
+	layout, err := config.Discover(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	envs := layout.Envs
+	if len(envs) == 0 {
+		envs = []string{""}
+	}
+	targets := append([]string{""}, layout.Targets...)
+
+	var chains [][]string
+	for _, app := range layout.Apps {
+		for _, env := range envs {
+			for _, target := range targets {
+				files, err := config.Chain(config.LoadContext{RootDir: rootDir, App: app, Env: env, Target: target})
+				if err != nil {
+					return nil, err
+				}
+				var chain []string
+				for _, file := range files {
+					if exists[file] {
+						chain = append(chain, filepath.ToSlash(relativeSource(rootDir, file)))
+					}
+				}
+				chains = append(chains, chain)
+			}
+		}
+	}
+	return chains, nil
+}
@@ -0,0 +1,158 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/urfave/cli/v2"
+)
+
+// maskedValue is displayed in place of values unless --show-values is set
+const maskedValue = "********"
+
+// ListCommand creates the list command for showing all keys in a context
+func ListCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "list",
+		Usage: "List all keys for specified app/env/target and where they come from",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "app",
+				Aliases: []string{"a"},
+				Usage:   "Application name",
+			},
+			&cli.StringFlag{
+				Name:    "env",
+				Aliases: []string{"e"},
+				Usage:   "Environment name",
+			},
+			&cli.StringFlag{
+				Name:    "target",
+				Aliases: []string{"t"},
+				Usage:   "Target platform",
+			},
+			&cli.BoolFlag{
+				Name:  "show-values",
+				Usage: "Show values instead of masking them",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: listAction,
+	}
+}
+
+func listAction(c *cli.Context) error {
+	app := c.String("app")
+	env := c.String("env")
+	target := c.String("target")
+	showValues := c.Bool("show-values")
+	rootDir := c.String("root")
+
+	// Load configuration
+	cfg, err := config.Load(config.LoadContext{
+		RootDir:    rootDir,
+		App:        app,
+		Env:        env,
+		Target:     target,
+		Dimensions: dimensionValues(c),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	keys := cfg.Keys()
+	if len(keys) == 0 && !jsonOutput(c) {
+		color.Yellow("No keys found")
+		return nil
+	}
+	sort.Strings(keys)
+
+	metadata, err := config.LoadMetadata(rootDir)
+	if err != nil {
+		return err
+	}
+
+	if jsonOutput(c) {
+		entries := make([]listEntry, 0, len(keys))
+		for _, key := range keys {
+			source, _ := cfg.Source(key)
+			meta, _ := metadata.Get(key)
+			entry := listEntry{Key: key, Source: relativeSource(rootDir, source), KeyMetadata: meta}
+			if showValues {
+				entry.Value, _ = cfg.Get(key)
+			}
+			entries = append(entries, entry)
+		}
+		return printJSON(entries, "key list")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if metadata.Exists() {
+		fmt.Fprintln(w, "KEY\tVALUE\tSOURCE\tOWNER\tSENSITIVITY\tDESCRIPTION")
+	} else {
+		fmt.Fprintln(w, "KEY\tVALUE\tSOURCE")
+	}
+	for _, key := range keys {
+		value := maskedValue
+		if showValues {
+			raw, _ := cfg.Get(key)
+			value = displayValue(raw)
+		}
+
+		source, _ := cfg.Source(key)
+		if !metadata.Exists() {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", key, value, relativeSource(rootDir, source))
+			continue
+		}
+		meta, _ := metadata.Get(key)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", key, value, relativeSource(rootDir, source), meta.Owner, meta.Sensitivity, meta.Description)
+	}
+
+	return w.Flush()
+}
+
+// listEntry is a key in the JSON output of list. The value is only included
+// with --show-values.
+type listEntry struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value,omitempty"`
+	Source string      `json:"source"`
+	config.KeyMetadata
+}
+
+// displayValue converts a config value to a single-line string for display.
+// Nested structures are shown as JSON.
+func displayValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		jsonBytes, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(jsonBytes)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// relativeSource returns a source file path relative to the root directory
+func relativeSource(rootDir, source string) string {
+	if rel, err := filepath.Rel(rootDir, source); err == nil {
+		return rel
+	}
+	return source
+}
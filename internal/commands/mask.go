@@ -0,0 +1,172 @@
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/output"
+	"github.com/teamcurri/puff/internal/resolve"
+	"github.com/teamcurri/puff/internal/templating"
+	"github.com/urfave/cli/v2"
+)
+
+// MaskCommand creates the mask command, which prints the sensitive values of
+// a context so CI systems can hide them in logs
+func MaskCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "mask",
+		Usage: "Print the sensitive resolved values for CI systems to redact from logs",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "app",
+				Aliases:  []string{"a"},
+				Usage:    "Application name",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "env",
+				Aliases:  []string{"e"},
+				Usage:    "Environment name",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "target",
+				Aliases: []string{"t"},
+				Usage:   "Target platform (optional)",
+			},
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"f"},
+				Usage:   "Output format: lines (one value per line), github (::add-mask:: commands), or shell (echo commands printing them)",
+				Value:   "lines",
+			},
+			&cli.IntFlag{
+				Name:  "min-length",
+				Usage: "Skip values shorter than this, which would mask common words and numbers all over the logs",
+				Value: 6,
+			},
+			noHostEnvFlag(),
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: maskAction,
+	}
+}
+
+func maskAction(c *cli.Context) error {
+	format := c.String("format")
+	if format != "lines" && format != "github" && format != "shell" {
+		return fmt.Errorf("unsupported mask format %q (use lines, github, or shell)", format)
+	}
+
+	ctx := config.LoadContext{
+		RootDir:    c.String("root"),
+		App:        c.String("app"),
+		Env:        c.String("env"),
+		Target:     c.String("target"),
+		Dimensions: dimensionValues(c),
+		NoHostEnv:  c.Bool("no-host-env"),
+	}
+	values, err := maskValues(ctx, c.Int("min-length"))
+	if err != nil {
+		return err
+	}
+
+	for _, value := range values {
+		switch format {
+		case "github":
+			fmt.Println(output.GitHubMaskCommand(value))
+		case "shell":
+			fmt.Println("echo " + shellQuote(output.GitHubMaskCommand(value)))
+		default:
+			fmt.Println(value)
+		}
+	}
+	return nil
+}
+
+// maskValues returns the resolved values of a context's sensitive keys,
+// including internal ones, which can show up in logs inside other values.
+// Each line of a multi-line value is returned separately, as CI systems mask
+// line by line. Values shorter than minLength are left out.
+func maskValues(ctx config.LoadContext, minLength int) ([]string, error) {
+	cfg, err := config.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	resolved, err := resolve.Loaded(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	project, err := config.LoadProject(ctx.RootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	sensitive := sensitiveKeys(ctx.RootDir, project, cfg)
+	keys := make([]string, 0, len(sensitive))
+	for key := range sensitive {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	values := []string{}
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		value, ok := resolved[key]
+		if !ok {
+			continue
+		}
+		for _, line := range strings.Split(displayValue(value), "\n") {
+			line = strings.TrimSpace(line)
+			if len(line) < max(minLength, 1) || seen[line] {
+				continue
+			}
+			seen[line] = true
+			values = append(values, line)
+		}
+	}
+	return values, nil
+}
+
+// sensitiveKeys returns the keys of a loaded config whose values are secret:
+// those from encrypted files, and those whose values reference a secret or
+// another app's config. With split stores, values from the plaintext stores
+// aren't secret unless they reference one.
+func sensitiveKeys(rootDir string, project *config.Project, cfg *config.Config) map[string]bool {
+	sensitive := make(map[string]bool)
+	for _, key := range cfg.Keys() {
+		source, _ := cfg.Source(key)
+		if level, ok := project.FileLevel(relativeSource(rootDir, source)); !ok || !level.Plain {
+			sensitive[key] = true
+		}
+	}
+
+	// Follow references until no more keys turn out to be sensitive
+	for changed := true; changed; {
+		changed = false
+		for _, key := range cfg.Keys() {
+			if sensitive[key] {
+				continue
+			}
+			value, _ := cfg.Get(key)
+			for _, name := range templating.References(displayValue(value)) {
+				if strings.HasPrefix(name, "env:") {
+					continue
+				}
+				if sensitive[name] || strings.Contains(name, ":") {
+					sensitive[key] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	return sensitive
+}
@@ -0,0 +1,120 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/urfave/cli/v2"
+)
+
+// migration upgrades a repository from one format to the next
+type migration struct {
+	// from is the format the migration upgrades from
+	from        int
+	description string
+	// apply changes the repository's files, or is nil if recording the new
+	// format is all it takes. The new format is recorded in .puff.yaml once
+	// it succeeds.
+	apply func(rootDir string) error
+}
+
+// migrations upgrade repositories format by format, oldest first. Each must
+// be safe to run again, since a migration that fails partway is retried by
+// the next run.
+var migrations = []migration{
+	{
+		from:        0,
+		description: "record the repository format in " + config.ProjectFile,
+	},
+}
+
+// MigrateCommand creates the migrate command for upgrading repositories
+// created by older versions of puff
+func MigrateCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "migrate",
+		Usage: fmt.Sprintf("Upgrade the repository's layout and metadata to the current format (%d)", config.CurrentFormat),
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Show the migrations that would run without changing anything",
+			},
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: migrateAction,
+	}
+}
+
+func migrateAction(c *cli.Context) error {
+	rootDir := c.String("root")
+	dryRun := c.Bool("dry-run")
+
+	if _, err := os.Stat(filepath.Join(rootDir, ".sops.yaml")); err != nil {
+		return fmt.Errorf("%s is not a config root (no .sops.yaml)", rootDir)
+	}
+	project, err := config.LoadProject(rootDir)
+	if err != nil {
+		return err
+	}
+	if project.Format == config.CurrentFormat {
+		color.Green("Repository is already at format %d", config.CurrentFormat)
+		return nil
+	}
+
+	pending, err := pendingMigrations(project.Format)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Repository is at format %d; the current format is %d\n", project.Format, config.CurrentFormat)
+	for _, m := range pending {
+		if dryRun {
+			fmt.Printf("  %d -> %d: %s\n", m.from, m.from+1, m.description)
+			continue
+		}
+		if m.apply != nil {
+			if err := m.apply(rootDir); err != nil {
+				return fmt.Errorf("failed to migrate from format %d: %w", m.from, err)
+			}
+		}
+		// Record each step, so a failed run resumes where it stopped
+		if err := config.WriteFormat(rootDir, m.from+1); err != nil {
+			return err
+		}
+		color.Green("  %d -> %d: %s", m.from, m.from+1, m.description)
+	}
+
+	if dryRun {
+		color.Yellow("Dry run: nothing was changed")
+		return nil
+	}
+	color.Green("Migrated to format %d", config.CurrentFormat)
+	return nil
+}
+
+// pendingMigrations returns the migrations from a format to the current one,
+// in order
+func pendingMigrations(format int) ([]migration, error) {
+	var pending []migration
+	for next := format; next < config.CurrentFormat; next++ {
+		found := false
+		for _, m := range migrations {
+			if m.from == next {
+				pending = append(pending, m)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no migration from format %d", next)
+		}
+	}
+	return pending, nil
+}
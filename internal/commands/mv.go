@@ -0,0 +1,128 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/store"
+	"github.com/urfave/cli/v2"
+)
+
+// MvCommand creates the mv command for moving keys between levels
+func MvCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "mv",
+		Usage: "Move keys from one level's file to another, such as from an app file into shared.yml",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:     "key",
+				Aliases:  []string{"k"},
+				Usage:    "Key to move (repeatable)",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "from",
+				Usage:    "Level to move the keys from, as flags (e.g. '-a api -e dev'; '' for base/shared.yml)",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "to",
+				Usage:    "Level to move the keys to, as flags (e.g. '-e dev')",
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "Overwrite keys the destination already has with a different value",
+			},
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: mvAction,
+	}
+}
+
+func mvAction(c *cli.Context) error {
+	moveKeys := c.StringSlice("key")
+	rootDir := c.String("root")
+
+	fromPath, err := levelFilePath(rootDir, c.String("from"))
+	if err != nil {
+		return fmt.Errorf("--from: %w", err)
+	}
+	toPath, err := levelFilePath(rootDir, c.String("to"))
+	if err != nil {
+		return fmt.Errorf("--to: %w", err)
+	}
+	fromName, toName := relativeSource(rootDir, fromPath), relativeSource(rootDir, toPath)
+	if fromPath == toPath {
+		return fmt.Errorf("--from and --to are the same file: %s", fromName)
+	}
+
+	records, err := store.Move(rootDir, fromPath, toPath, moveKeys, c.Bool("force"))
+	if err != nil {
+		return err
+	}
+
+	color.Green("Moved %s from %s to %s", strings.Join(moveKeys, ", "), fromName, toName)
+	project, err := config.LoadProject(rootDir)
+	if err != nil {
+		return err
+	}
+	fromLevel, fromOK := project.FileLevel(fromName)
+	toLevel, _ := project.FileLevel(toName)
+	if fromOK && fromLevel.App == "" && toLevel.App != "" {
+		color.Yellow("Other apps no longer inherit %s from %s", strings.Join(moveKeys, ", "), fromName)
+	}
+
+	return store.RecordAudit(rootDir, "mv", records...)
+}
+
+// levelFilePath returns the config file a level given as flags addresses,
+// such as "-a api -e dev" for dev/api.yml. Dimensions declared in .puff.yaml
+// can be given as well (e.g. "-e prod --region eu").
+func levelFilePath(rootDir, level string) (string, error) {
+	flags := flag.NewFlagSet("level", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	var app, env, target string
+	for _, name := range []string{"a", "app"} {
+		flags.StringVar(&app, name, "", "")
+	}
+	for _, name := range []string{"e", "env"} {
+		flags.StringVar(&env, name, "", "")
+	}
+	for _, name := range []string{"t", "target"} {
+		flags.StringVar(&target, name, "", "")
+	}
+	dimensions := make(map[string]*string)
+	for _, dim := range projectDimensions {
+		if flags.Lookup(dim.Name) == nil {
+			dimensions[dim.Name] = flags.String(dim.Name, "", "")
+		}
+	}
+
+	if err := flags.Parse(strings.Fields(level)); err != nil {
+		return "", fmt.Errorf("invalid level %q: %w", level, err)
+	}
+	if flags.NArg() > 0 {
+		return "", fmt.Errorf("invalid level %q: unexpected %q (use -a, -e, -t, or a dimension flag)", level, flags.Arg(0))
+	}
+
+	var values map[string]string
+	for name, value := range dimensions {
+		if *value != "" {
+			if values == nil {
+				values = make(map[string]string)
+			}
+			values[name] = *value
+		}
+	}
+	return store.ContextFile(rootDir, app, env, target, values)
+}
@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+)
+
+// Output modes selected by the global --output flag
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// OutputFlag creates the global --output flag, which makes informational
+// commands print JSON for CI and bots instead of colored text
+func OutputFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    "output",
+		Aliases: []string{"o"},
+		Usage:   "Output of informational commands: text, or json for machine-readable results",
+		Value:   outputText,
+		EnvVars: []string{"PUFF_OUTPUT"},
+		Action: func(c *cli.Context, output string) error {
+			if output != outputText && output != outputJSON {
+				return fmt.Errorf("unsupported output %q (use text or json)", output)
+			}
+			return nil
+		},
+	}
+}
+
+// jsonOutput reports whether the global --output json was given
+func jsonOutput(c *cli.Context) bool {
+	return c.String("output") == outputJSON
+}
+
+// reportFormat returns the value of a command's own --format flag, or json
+// if the global --output json was given
+func reportFormat(c *cli.Context) string {
+	if jsonOutput(c) {
+		return "json"
+	}
+	return c.String("format")
+}
+
+// printJSON prints a value as indented JSON; what names it in errors
+func printJSON(value interface{}, what string) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", what, err)
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// printWarning prints a warning after a report. With JSON output it goes to
+// stderr, so stdout stays valid JSON.
+func printWarning(asJSON bool, format string, args ...interface{}) {
+	if asJSON {
+		color.New(color.FgYellow).Fprintf(os.Stderr, format+"\n", args...)
+		return
+	}
+	color.Yellow(format, args...)
+}
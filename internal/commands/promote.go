@@ -0,0 +1,180 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/safefile"
+	"github.com/teamcurri/puff/internal/store"
+	"github.com/urfave/cli/v2"
+)
+
+// PromoteCommand creates the promote command for copying keys between environments
+func PromoteCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "promote",
+		Usage: "Copy keys from one environment's file to another",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "app",
+				Aliases: []string{"a"},
+				Usage:   "Application name",
+			},
+			&cli.StringFlag{
+				Name:     "from",
+				Usage:    "Environment to copy from",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "to",
+				Usage:    "Environment to copy to",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "target",
+				Aliases: []string{"t"},
+				Usage:   "Target platform (applied to both environments)",
+			},
+			&cli.StringFlag{
+				Name:  "keys",
+				Usage: "Comma-separated list of keys to copy (defaults to all keys)",
+			},
+			&cli.BoolFlag{
+				Name:  "show-values",
+				Usage: "Show values instead of masking them",
+				Value: false,
+			},
+			dryRunFlag(),
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: promoteAction,
+	}
+}
+
+func promoteAction(c *cli.Context) error {
+	app := c.String("app")
+	fromEnv := c.String("from")
+	toEnv := c.String("to")
+	target := c.String("target")
+	keysStr := c.String("keys")
+	showValues := c.Bool("show-values")
+	rootDir := c.String("root")
+
+	if fromEnv == toEnv {
+		return fmt.Errorf("--from and --to must be different environments")
+	}
+
+	fromPath, err := store.LevelFile(rootDir, app, fromEnv, target)
+	if err != nil {
+		return err
+	}
+	toPath, err := store.LevelFile(rootDir, app, toEnv, target)
+	if err != nil {
+		return err
+	}
+
+	// A split level's keys are promoted from both of its stores, and each
+	// goes to the store of the same kind in the destination
+	fromStores, err := store.LevelStores(rootDir, fromPath)
+	if err != nil {
+		return err
+	}
+	toStores, err := store.LevelStores(rootDir, toPath)
+	if err != nil {
+		return err
+	}
+	if !c.Bool("dry-run") {
+		lock, err := safefile.Acquire(append(append([]string(nil), fromStores...), toStores...)...)
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+	}
+	sourceStores, found, err := store.ReadStores(fromStores)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("config file does not exist: %s", fromPath)
+	}
+	source, sourceIndex := mergeStores(sourceStores)
+
+	// Select which keys to copy
+	selected := make(map[string]interface{})
+	if keysStr == "" {
+		for key, value := range source {
+			selected[key] = value
+		}
+	} else {
+		for _, key := range strings.Split(keysStr, ",") {
+			key = strings.TrimSpace(key)
+			if key == "" {
+				continue
+			}
+			value, exists := source[key]
+			if !exists {
+				return fmt.Errorf("key not found in %s: %s", fromPath, key)
+			}
+			selected[key] = value
+		}
+	}
+
+	if len(selected) == 0 {
+		color.Yellow("No keys to promote from %s", fromPath)
+		return nil
+	}
+
+	// Get encryption keys from the directory - ALWAYS required
+	directoryAgeKeys, err := store.DirectoryKeys(rootDir)
+	if err != nil {
+		return fmt.Errorf("failed to check directory encryption: %w", err)
+	}
+	if len(directoryAgeKeys) == 0 {
+		return fmt.Errorf("no encryption keys found in directory - run 'puff init' first to initialize with encryption keys")
+	}
+
+	destStores, _, err := store.ReadStores(toStores)
+	if err != nil {
+		return err
+	}
+	dest, _ := mergeStores(destStores)
+
+	// Only additions and changes matter - keys missing from the selection
+	// are left alone in the destination
+	var changes []valueChange
+	for _, change := range diffValues(dest, selected) {
+		if change.Kind != changeRemoved {
+			changes = append(changes, change)
+		}
+	}
+
+	if len(changes) == 0 {
+		color.Green("%s is already up to date with %s", toPath, fromPath)
+		return nil
+	}
+
+	if c.Bool("dry-run") {
+		color.Cyan("Dry run - would promote %d key(s) from %s to %s:", len(changes), fromPath, toPath)
+		printChanges(changes, showValues)
+		return printRecipients(rootDir, toPath, directoryAgeKeys)
+	}
+
+	updates := newStoreUpdates(toStores, destStores)
+	for _, change := range changes {
+		updates.set(sourceIndex[change.Key], change.Key, change.To)
+	}
+	if err := store.WriteFiles(rootDir, updates.updates(), directoryAgeKeys); err != nil {
+		return err
+	}
+
+	printChanges(changes, showValues)
+	color.Green("Promoted %d key(s) from %s to %s", len(changes), fromPath, toPath)
+
+	return nil
+}
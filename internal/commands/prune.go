@@ -0,0 +1,189 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/audit"
+	"github.com/teamcurri/puff/internal/lint"
+	"github.com/teamcurri/puff/internal/safefile"
+	"github.com/teamcurri/puff/internal/store"
+	"github.com/urfave/cli/v2"
+)
+
+// PruneCommand creates the prune command for removing dead config
+func PruneCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "prune",
+		Usage: "Remove keys that are overridden in every context and internal variables that are never referenced",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Show the keys that would be removed without changing anything",
+			},
+			&cli.BoolFlag{
+				Name:    "interactive",
+				Aliases: []string{"i"},
+				Usage:   "Ask before removing each key",
+			},
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: pruneAction,
+	}
+}
+
+func pruneAction(c *cli.Context) error {
+	rootDir := c.String("root")
+	dryRun := c.Bool("dry-run")
+	interactive := c.Bool("interactive")
+	if dryRun && interactive {
+		return fmt.Errorf("--dry-run and --interactive cannot be combined")
+	}
+
+	// Every config file may lose keys, so all of them are locked before
+	// they're read
+	if !dryRun {
+		paths, err := listConfigFiles(rootDir)
+		if err != nil {
+			return err
+		}
+		lock, err := safefile.Acquire(paths...)
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+	}
+
+	files, chains, err := loadLintFiles(rootDir)
+	if err != nil {
+		return err
+	}
+	values := make(map[string]map[string]interface{})
+	for _, file := range files {
+		values[file.Path] = file.Values
+	}
+
+	// Removing a key can leave the internal variables it referenced unused,
+	// so keep looking until nothing more can be removed. Keys kept when
+	// asked stay in place and keep what they reference alive.
+	var removed []lint.Finding
+	var records []audit.Record
+	kept := make(map[string]bool)
+	found := false
+	removeAll := !interactive
+	reader := bufio.NewReader(c.App.Reader)
+rounds:
+	for {
+		var candidates []lint.Finding
+		for _, candidate := range lint.Removable(files, chains) {
+			if !kept[candidate.File+":"+candidate.Key] {
+				candidates = append(candidates, candidate)
+			}
+		}
+		if len(candidates) == 0 {
+			break
+		}
+		found = true
+
+		for _, candidate := range candidates {
+			if !removeAll {
+				switch askPrune(reader, candidate) {
+				case "y":
+				case "a":
+					removeAll = true
+				case "q":
+					break rounds
+				default:
+					kept[candidate.File+":"+candidate.Key] = true
+					continue
+				}
+			}
+			records = append(records, audit.Record{File: filepath.FromSlash(candidate.File), Key: candidate.Key, OldHash: audit.Hash(values[candidate.File][candidate.Key])})
+			delete(values[candidate.File], candidate.Key)
+			removed = append(removed, candidate)
+		}
+	}
+
+	if !found {
+		color.Green("✓ No unused keys found")
+		return nil
+	}
+	if len(removed) == 0 {
+		color.Yellow("No keys removed")
+		return nil
+	}
+
+	if dryRun {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "FILE\tKEY\tREASON")
+		for _, finding := range removed {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", finding.File, finding.Key, finding.Message)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		color.Yellow("\n%d key(s) would be removed (dry run, nothing changed)", len(removed))
+		return nil
+	}
+
+	// Get encryption keys from the directory - ALWAYS required
+	directoryAgeKeys, err := store.DirectoryKeys(rootDir)
+	if err != nil {
+		return fmt.Errorf("failed to check directory encryption: %w", err)
+	}
+	if len(directoryAgeKeys) == 0 {
+		return fmt.Errorf("no encryption keys found in directory - run 'puff init' first to initialize with encryption keys")
+	}
+
+	changed := make(map[string]bool)
+	for _, finding := range removed {
+		changed[finding.File] = true
+	}
+	order := make([]string, 0, len(changed))
+	for file := range changed {
+		order = append(order, file)
+	}
+	sort.Strings(order)
+
+	for _, file := range order {
+		if err := store.Write(filepath.Join(rootDir, filepath.FromSlash(file)), values[file], directoryAgeKeys); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	for _, finding := range removed {
+		color.Cyan("  removed %s from %s", finding.Key, finding.File)
+	}
+
+	color.Green("Pruned %d key(s) from %d file(s) (encrypted)", len(removed), len(order))
+
+	return store.RecordAudit(rootDir, "prune", records...)
+}
+
+// askPrune asks whether to remove a key and returns the answer: y to remove
+// it, n to keep it, a to remove it and every remaining key, or q to stop.
+// Anything else keeps the key, and the end of input stops.
+func askPrune(reader *bufio.Reader, candidate lint.Finding) string {
+	fmt.Printf("%s: %s\nRemove %s from %s? [y/n/a/q] ", candidate.File, candidate.Message, candidate.Key, candidate.File)
+	line, err := reader.ReadString('\n')
+	if err == io.EOF && line == "" {
+		fmt.Println()
+		return "q"
+	}
+	answer := strings.ToLower(strings.TrimSpace(line))
+	if answer == "yes" || answer == "all" || answer == "quit" {
+		answer = answer[:1]
+	}
+	return answer
+}
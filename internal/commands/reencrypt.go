@@ -0,0 +1,132 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/audit"
+	"github.com/teamcurri/puff/internal/keys"
+	"github.com/teamcurri/puff/internal/store"
+	"github.com/urfave/cli/v2"
+)
+
+// reencryptExitCode is the exit code used when a file can't be re-encrypted
+const reencryptExitCode = 1
+
+// reencryptReport is the JSON output of reencrypt
+type reencryptReport struct {
+	Files []keys.ReencryptResult `json:"files"`
+}
+
+// ReencryptCommand creates the reencrypt command for bringing the recipients
+// of every file in line with .sops.yaml
+func ReencryptCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "reencrypt",
+		Usage: "Re-encrypt all files to the recipients declared in .sops.yaml",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "env",
+				Aliases: []string{"e"},
+				Usage:   "Only re-encrypt files in specific environment",
+			},
+			&cli.BoolFlag{
+				Name:  "rotate",
+				Usage: "Also regenerate the data key of every file (see 'keys rotate')",
+			},
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"f"},
+				Usage:   "Output format: table or json",
+				Value:   "table",
+			},
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: reencryptAction,
+	}
+}
+
+func reencryptAction(c *cli.Context) error {
+	rootDir := c.String("root")
+	env := c.String("env")
+	format := reportFormat(c)
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unsupported reencrypt format %q (use table or json)", format)
+	}
+
+	results, err := keys.Reencrypt(rootDir, env, c.Bool("rotate"))
+	if err != nil {
+		return fmt.Errorf("failed to re-encrypt files: %w", err)
+	}
+
+	var records []audit.Record
+	failed := 0
+	for _, result := range results {
+		switch result.Status {
+		case keys.ReencryptFailed:
+			failed++
+		case keys.ReencryptUpdated, keys.ReencryptRotated:
+			records = append(records, audit.Record{File: result.Path, Env: env})
+		}
+	}
+	if err := store.RecordAudit(rootDir, "reencrypt", records...); err != nil {
+		return err
+	}
+
+	if format == "json" {
+		if err := printJSON(reencryptReport{Files: results}, "reencrypt report"); err != nil {
+			return err
+		}
+	} else {
+		registry, err := keys.LoadRegistry(rootDir)
+		if err != nil {
+			return err
+		}
+		printReencryptResults(results, keyComments(rootDir, registry))
+	}
+
+	if failed > 0 {
+		return cli.Exit("", reencryptExitCode)
+	}
+	return nil
+}
+
+// printReencryptResults reports what happened to each file, then a summary
+func printReencryptResults(results []keys.ReencryptResult, comments map[string]string) {
+	counts := make(map[string]int)
+	for _, result := range results {
+		counts[result.Status]++
+		switch result.Status {
+		case keys.ReencryptFailed:
+			color.Red("✗ %s: %s", result.Path, result.Error)
+		case keys.ReencryptUnchanged:
+			fmt.Printf("  %s: unchanged\n", result.Path)
+		default:
+			var changes []string
+			for _, key := range result.Added {
+				changes = append(changes, "+"+recipientLabel(key, comments))
+			}
+			for _, key := range result.Removed {
+				changes = append(changes, "-"+recipientLabel(key, comments))
+			}
+			if len(changes) > 0 {
+				color.Green("✓ %s: %s (%s)", result.Path, result.Status, strings.Join(changes, ", "))
+			} else {
+				color.Green("✓ %s: %s", result.Path, result.Status)
+			}
+		}
+	}
+
+	summary := fmt.Sprintf("\n%d updated, %d rotated, %d unchanged, %d failed", counts[keys.ReencryptUpdated], counts[keys.ReencryptRotated], counts[keys.ReencryptUnchanged], counts[keys.ReencryptFailed])
+	if counts[keys.ReencryptFailed] > 0 {
+		color.Red(summary)
+	} else {
+		color.Green(summary)
+	}
+}
@@ -0,0 +1,224 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/safefile"
+	"github.com/teamcurri/puff/internal/store"
+	"github.com/teamcurri/puff/internal/templating"
+	"github.com/urfave/cli/v2"
+)
+
+// RenameCommand creates the rename command for renaming config keys
+func RenameCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "rename",
+		Usage: "Rename a config key for specified app/env/target or across all levels",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "key",
+				Aliases:  []string{"k"},
+				Usage:    "Key to rename",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "to",
+				Usage:    "New key name",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "app",
+				Aliases: []string{"a"},
+				Usage:   "Application name",
+			},
+			&cli.StringFlag{
+				Name:    "env",
+				Aliases: []string{"e"},
+				Usage:   "Environment name",
+			},
+			&cli.StringFlag{
+				Name:    "target",
+				Aliases: []string{"t"},
+				Usage:   "Target platform",
+			},
+			&cli.BoolFlag{
+				Name:  "all-levels",
+				Usage: "Rename the key in every config file that defines it",
+				Value: false,
+			},
+			&cli.BoolFlag{
+				Name:  "update-refs",
+				Usage: "Rewrite ${OLD_KEY} template references in all config files",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: renameAction,
+	}
+}
+
+func renameAction(c *cli.Context) error {
+	oldKey := c.String("key")
+	newKey := c.String("to")
+	app := c.String("app")
+	env := c.String("env")
+	target := c.String("target")
+	allLevels := c.Bool("all-levels")
+	updateRefs := c.Bool("update-refs")
+	rootDir := c.String("root")
+
+	if oldKey == newKey {
+		return fmt.Errorf("new key name must differ from the old one")
+	}
+
+	// Files the key itself is renamed in: both stores of a split level
+	filePath, err := store.LevelFile(rootDir, app, env, target)
+	if err != nil {
+		return err
+	}
+	renameFiles, err := store.LevelStores(rootDir, filePath)
+	if err != nil {
+		return err
+	}
+	allFiles, err := listConfigFiles(rootDir)
+	if err != nil {
+		return err
+	}
+	if allLevels {
+		renameFiles = allFiles
+	}
+
+	// Files template references are rewritten in
+	refFiles := []string{}
+	if updateRefs {
+		refFiles = allFiles
+	}
+
+	project, err := config.LoadProject(rootDir)
+	if err != nil {
+		return err
+	}
+	// level returns the level a file belongs to, the same for both stores
+	// of a split level, which share their keys
+	level := func(file string) string {
+		if !project.Stores.Split {
+			return file
+		}
+		return strings.TrimSuffix(config.TrimConfigExt(file), config.PlainStoreSuffix)
+	}
+
+	lock, err := safefile.Acquire(append(append([]string(nil), renameFiles...), refFiles...)...)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	shouldRename := make(map[string]bool)
+	for _, file := range renameFiles {
+		shouldRename[file] = true
+	}
+
+	files := make(map[string]map[string]interface{})
+	hasNewKey := make(map[string]bool)
+	for _, file := range append(renameFiles, refFiles...) {
+		if _, seen := files[file]; seen {
+			continue
+		}
+		values, err := store.Read(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		files[file] = values
+		if _, exists := values[newKey]; exists && shouldRename[file] {
+			hasNewKey[level(file)] = true
+		}
+	}
+
+	// Plan every change before writing anything, so a conflict in one file
+	// doesn't leave the repo half-renamed
+	updated := make(map[string]map[string]interface{})
+	var order []string
+	renamed := 0
+
+	for _, file := range append(renameFiles, refFiles...) {
+		values, ok := files[file]
+		if _, seen := updated[file]; seen || !ok {
+			continue
+		}
+
+		changed := false
+
+		if shouldRename[file] {
+			if value, exists := values[oldKey]; exists {
+				if hasNewKey[level(file)] {
+					return fmt.Errorf("cannot rename in %s: key %s already exists", file, newKey)
+				}
+				delete(values, oldKey)
+				values[newKey] = value
+				renamed++
+				changed = true
+			}
+		}
+
+		if updateRefs {
+			for key, value := range values {
+				if str, ok := value.(string); ok {
+					if rewritten := templating.RenameVariable(str, oldKey, newKey); rewritten != str {
+						values[key] = rewritten
+						changed = true
+					}
+				}
+			}
+		}
+
+		if changed {
+			updated[file] = values
+			order = append(order, file)
+		} else {
+			updated[file] = nil
+		}
+	}
+
+	if renamed == 0 {
+		if allLevels {
+			return fmt.Errorf("key not found in any config file: %s", oldKey)
+		}
+		return fmt.Errorf("key not found in %s: %s", filePath, oldKey)
+	}
+
+	// Get encryption keys from the directory - ALWAYS required
+	directoryAgeKeys, err := store.DirectoryKeys(rootDir)
+	if err != nil {
+		return fmt.Errorf("failed to check directory encryption: %w", err)
+	}
+	if len(directoryAgeKeys) == 0 {
+		return fmt.Errorf("no encryption keys found in directory - run 'puff init' first to initialize with encryption keys")
+	}
+
+	updates := make([]store.Update, 0, len(order))
+	for _, file := range order {
+		updates = append(updates, store.Update{Path: file, Values: updated[file]})
+	}
+	if err := store.WriteFiles(rootDir, updates, directoryAgeKeys); err != nil {
+		return err
+	}
+	for _, file := range order {
+		color.Cyan("  updated %s", relativeSource(rootDir, file))
+	}
+
+	color.Green("Renamed %s to %s in %d file(s)", oldKey, newKey, renamed)
+
+	return nil
+}
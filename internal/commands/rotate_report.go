@@ -0,0 +1,160 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/urfave/cli/v2"
+)
+
+// rotateReportExitCode is the exit code used when a key is overdue for rotation
+const rotateReportExitCode = 1
+
+// rotationStatus is one row of the rotation report
+type rotationStatus struct {
+	Key         string `json:"key"`
+	Owner       string `json:"owner,omitempty"`
+	Rotation    string `json:"rotation"`
+	LastRotated string `json:"last_rotated,omitempty"`
+	Due         string `json:"due,omitempty"` // Empty if never rotated
+	Overdue     bool   `json:"overdue"`
+}
+
+// RotateReportCommand creates the rotate-report command for listing secrets
+// that are overdue for rotation
+func RotateReportCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "rotate-report",
+		Usage: "List keys in meta.yml that are overdue for rotation",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "all",
+				Usage: "Include keys that are not yet due",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"f"},
+				Usage:   "Output format: table or json",
+				Value:   "table",
+			},
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: rotateReportAction,
+	}
+}
+
+func rotateReportAction(c *cli.Context) error {
+	format := reportFormat(c)
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unsupported report format %q (use table or json)", format)
+	}
+
+	metadata, err := config.LoadMetadata(c.String("root"))
+	if err != nil {
+		return err
+	}
+
+	statuses, overdue := rotationStatuses(metadata, time.Now(), c.Bool("all"))
+
+	if format == "json" {
+		data, err := json.MarshalIndent(statuses, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal rotation report: %w", err)
+		}
+		fmt.Println(string(data))
+	} else if err := printRotationTable(statuses, overdue, c.Bool("all")); err != nil {
+		return err
+	}
+
+	if overdue > 0 {
+		return cli.Exit("", rotateReportExitCode)
+	}
+	return nil
+}
+
+// rotationStatuses returns the rotation status of every key with a rotation
+// period, overdue keys first, and the number of overdue keys. Keys that are
+// not yet due are only included if all is set.
+func rotationStatuses(metadata *config.Metadata, now time.Time, all bool) ([]rotationStatus, int) {
+	statuses := []rotationStatus{}
+	overdue := 0
+	for key, meta := range metadata.Keys {
+		due, ok := meta.RotationDue()
+		if !ok {
+			continue
+		}
+
+		status := rotationStatus{
+			Key:         key,
+			Owner:       meta.Owner,
+			Rotation:    meta.Rotation,
+			LastRotated: meta.LastRotated,
+			Overdue:     meta.Overdue(now),
+		}
+		if !due.IsZero() {
+			status.Due = due.Format(config.DateFormat)
+		}
+		if status.Overdue {
+			overdue++
+		} else if !all {
+			continue
+		}
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Overdue != statuses[j].Overdue {
+			return statuses[i].Overdue
+		}
+		if statuses[i].Due != statuses[j].Due {
+			return statuses[i].Due < statuses[j].Due
+		}
+		return statuses[i].Key < statuses[j].Key
+	})
+	return statuses, overdue
+}
+
+func printRotationTable(statuses []rotationStatus, overdue int, all bool) error {
+	if len(statuses) == 0 {
+		if all {
+			color.Yellow("No keys have a rotation period in %s", config.MetadataFile)
+		} else {
+			color.Green("No keys are overdue for rotation")
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tOWNER\tROTATION\tLAST ROTATED\tDUE\tSTATUS")
+	for _, status := range statuses {
+		lastRotated, due := status.LastRotated, status.Due
+		if lastRotated == "" {
+			lastRotated, due = "never", "now"
+		}
+		state := "ok"
+		if status.Overdue {
+			state = "overdue"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", status.Key, status.Owner, status.Rotation, lastRotated, due, state)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if overdue > 0 {
+		color.Red("\n%d key(s) overdue for rotation", overdue)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/urfave/cli/v2"
+)
+
+// RunCommand creates the run command for executing a command with injected config
+func RunCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "run",
+		Usage:     "Run a command with the resolved config injected into its environment",
+		ArgsUsage: "-- COMMAND [ARGS...]",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "app",
+				Aliases:  []string{"a"},
+				Usage:    "Application name",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "env",
+				Aliases:  []string{"e"},
+				Usage:    "Environment name",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "target",
+				Aliases: []string{"t"},
+				Usage:   "Target platform (optional)",
+			},
+			noHostEnvFlag(),
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: runAction,
+	}
+}
+
+func runAction(c *cli.Context) error {
+	app := c.String("app")
+	env := c.String("env")
+	target := c.String("target")
+	rootDir := c.String("root")
+
+	args := c.Args().Slice()
+	if len(args) == 0 {
+		return fmt.Errorf("no command specified (usage: puff run -a APP -e ENV -- COMMAND [ARGS...])")
+	}
+
+	resolved, err := loadResolvedConfig(config.LoadContext{
+		RootDir:    rootDir,
+		App:        app,
+		Env:        env,
+		Target:     target,
+		Dimensions: dimensionValues(c),
+		NoHostEnv:  c.Bool("no-host-env"),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Config values override the inherited environment. Internal
+	// underscore-prefixed variables are not exported, same as generate.
+	environ := os.Environ()
+	for key, value := range resolved {
+		if len(key) > 0 && key[0] != '_' {
+			environ = append(environ, fmt.Sprintf("%s=%s", key, displayValue(value)))
+		}
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = environ
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start command: %w", err)
+	}
+
+	// Forward termination signals to the child so it can shut down cleanly
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	go func() {
+		for sig := range signals {
+			_ = cmd.Process.Signal(sig)
+		}
+	}()
+
+	if err := cmd.Wait(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			// Propagate the child's exit code without an extra error message
+			return cli.Exit("", exitErr.ExitCode())
+		}
+		return fmt.Errorf("command failed: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/output"
+	"github.com/teamcurri/puff/internal/safefile"
+	"github.com/urfave/cli/v2"
+)
+
+// SampleCommand creates the sample command, which writes a .env.example
+// listing the keys of a context without their values
+func SampleCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "sample",
+		Usage: "Write a .env.example with every exported key, its description, and its example value from meta.yml",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "app",
+				Aliases:  []string{"a"},
+				Usage:    "Application name",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "env",
+				Aliases:  []string{"e"},
+				Usage:    "Environment name",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "target",
+				Aliases: []string{"t"},
+				Usage:   "Target platform (optional)",
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "Output file (defaults to stdout)",
+			},
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: sampleAction,
+	}
+}
+
+func sampleAction(c *cli.Context) error {
+	rootDir := c.String("root")
+
+	cfg, err := config.Load(config.LoadContext{
+		RootDir:    rootDir,
+		App:        c.String("app"),
+		Env:        c.String("env"),
+		Target:     c.String("target"),
+		Dimensions: dimensionValues(c),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	metadata, err := config.LoadMetadata(rootDir)
+	if err != nil {
+		return err
+	}
+
+	// Only key names are taken from the config; values come from meta.yml
+	values := make(map[string]interface{})
+	comments := make(map[string]string)
+	for _, key := range cfg.ExportKeys() {
+		meta, _ := metadata.Get(key)
+		values[key] = meta.Example
+		if meta.Description != "" {
+			comments[key] = meta.Description
+		}
+	}
+
+	formatted, err := output.FormatOutput(values, output.FormatOptions{Format: output.FormatEnv, Comments: comments})
+	if err != nil {
+		return err
+	}
+	sample := sampleHeader(c) + formatted + "\n"
+
+	outputFile := c.String("output")
+	if outputFile == "" {
+		fmt.Print(sample)
+		return nil
+	}
+	if err := safefile.Write(outputFile, []byte(sample), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", outputFile, err)
+	}
+	color.Green("✓ Wrote %d key(s) to %s", len(values), outputFile)
+	return nil
+}
+
+// sampleHeader returns the comment at the top of a sample, naming the
+// command that regenerates it
+func sampleHeader(c *cli.Context) string {
+	args := []string{"puff sample", "-a", c.String("app"), "-e", c.String("env")}
+	if target := c.String("target"); target != "" {
+		args = append(args, "-t", target)
+	}
+	for _, dimension := range projectDimensions {
+		if value := c.String(dimension.Name); value != "" {
+			args = append(args, "--"+dimension.Name, value)
+		}
+	}
+	return fmt.Sprintf("# Generated by %s. Descriptions and example values come from meta.yml.\n\n", strings.Join(args, " "))
+}
@@ -0,0 +1,169 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/scan"
+	"github.com/urfave/cli/v2"
+)
+
+// scanExitCode is the exit code used when scan finds a suspected secret
+const scanExitCode = 1
+
+// scanMaxFileSize is the size above which files aren't scanned
+const scanMaxFileSize = 1 << 20
+
+// ScanCommand creates the scan command for finding secrets committed outside
+// the encrypted config files
+func ScanCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "scan",
+		Usage: "Search every file in the repository for plaintext secrets such as cloud keys, tokens, and private keys",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "min-severity",
+				Usage: "Only report findings at least this severe: low, medium, high, or critical",
+				Value: string(scan.SeverityLow),
+			},
+			&cli.StringSliceFlag{
+				Name:  "exclude",
+				Usage: "Skip files and directories whose name or relative path matches this glob (repeatable)",
+			},
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"f"},
+				Usage:   "Output format: table or json",
+				Value:   "table",
+			},
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Directory to scan",
+				Value:   ".",
+			},
+		},
+		Action: scanAction,
+	}
+}
+
+func scanAction(c *cli.Context) error {
+	rootDir := c.String("root")
+	format := reportFormat(c)
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unsupported report format %q (use table or json)", format)
+	}
+	minSeverity, err := scan.ParseSeverity(c.String("min-severity"))
+	if err != nil {
+		return err
+	}
+	excludes := c.StringSlice("exclude")
+	for _, pattern := range excludes {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid --exclude pattern %q: %w", pattern, err)
+		}
+	}
+
+	findings, filesScanned, err := scanFiles(rootDir, minSeverity, excludes)
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		data, err := json.MarshalIndent(findings, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal scan findings: %w", err)
+		}
+		fmt.Println(string(data))
+	} else if len(findings) == 0 {
+		color.Green("✓ %d file(s) scanned, no secrets found", filesScanned)
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SEVERITY\tLOCATION\tRULE\tMATCH")
+		for _, finding := range findings {
+			fmt.Fprintf(w, "%s\t%s:%d\t%s\t%s\n", finding.Severity, finding.File, finding.Line, finding.Rule, finding.Match)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		color.Red("\n%d suspected secret(s) found in %d file(s) scanned", len(findings), filesScanned)
+		fmt.Printf("Move secrets into encrypted config with 'puff set', or mark false positives with a '%s' comment.\n", scan.AllowComment)
+	}
+
+	if len(findings) > 0 {
+		return cli.Exit("", scanExitCode)
+	}
+	return nil
+}
+
+// scanFiles searches the files under a directory for plaintext secrets at
+// least as severe as minSeverity, skipping encrypted config files and files
+// matching an --exclude glob. It returns the findings in file order and the
+// number of files scanned.
+func scanFiles(rootDir string, minSeverity scan.Severity, excludes []string) ([]scan.Finding, int, error) {
+	findings := []scan.Finding{}
+	filesScanned := 0
+	err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := relativeSource(rootDir, path)
+		if path != rootDir && scanExcluded(name, info.Name(), excludes) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || info.Size() > scanMaxFileSize {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		// Encrypted config files hold secrets the way they should
+		if scan.IsBinary(data) || isEncryptedYAML(data) {
+			return nil
+		}
+		filesScanned++
+		for _, finding := range scan.Scan(name, data) {
+			if finding.Severity.AtLeast(minSeverity) {
+				findings = append(findings, finding)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to scan files: %w", err)
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].File < findings[j].File
+	})
+	return findings, filesScanned, nil
+}
+
+// scanExcluded reports whether a file or directory matches an --exclude glob
+// by name or by path relative to the scanned directory
+func scanExcluded(relPath, name string, excludes []string) bool {
+	for _, pattern := range excludes {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+		if matched, _ := filepath.Match(pattern, relPath); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -1,34 +1,67 @@
 package commands
 
 import (
+	"encoding/base64"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/fatih/color"
-	"github.com/getsops/sops/v3/decrypt"
+	"github.com/teamcurri/puff/internal/audit"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/dotenv"
 	"github.com/teamcurri/puff/internal/keys"
+	"github.com/teamcurri/puff/internal/store"
 	"github.com/urfave/cli/v2"
-	"gopkg.in/yaml.v3"
+	"golang.org/x/term"
 )
 
 // SetCommand creates the set command for setting config values
 func SetCommand() *cli.Command {
 	return &cli.Command{
-		Name:  "set",
-		Usage: "Set a config value for specified app/env/target",
+		Name:      "set",
+		Usage:     "Set config values for specified app/env/target",
+		ArgsUsage: "[KEY=VALUE ...]",
 		Flags: []cli.Flag{
 			&cli.StringFlag{
-				Name:     "key",
-				Aliases:  []string{"k"},
-				Usage:    "Key to set",
-				Required: true,
+				Name:    "key",
+				Aliases: []string{"k"},
+				Usage:   "Key to set",
 			},
 			&cli.StringFlag{
-				Name:     "value",
-				Aliases:  []string{"v"},
-				Usage:    "Value to set",
-				Required: true,
+				Name:    "value",
+				Aliases: []string{"v"},
+				Usage:   "Value to set",
+			},
+			&cli.BoolFlag{
+				Name:  "value-stdin",
+				Usage: "Read the value from stdin (keeps it out of shell history and ps output)",
+			},
+			&cli.StringFlag{
+				Name:  "from-file",
+				Usage: "Read the value from a file, such as a certificate or JSON document",
+			},
+			&cli.BoolFlag{
+				Name:  "binary",
+				Usage: "Store the bytes read with --from-file or --value-stdin base64-encoded, and mark the key binary in meta.yml (for keystores and other binary files)",
+			},
+			&cli.BoolFlag{
+				Name:  "prompt",
+				Usage: "Ask for the value on the terminal without echoing it, then ask again to confirm",
+			},
+			&cli.StringFlag{
+				Name:  "pairs-file",
+				Usage: "Set every KEY=VALUE line of a .env-style file (- for stdin)",
+			},
+			&cli.BoolFlag{
+				Name:  "secret",
+				Usage: "Write to the encrypted store of a split level (see stores in .puff.yaml)",
+			},
+			&cli.BoolFlag{
+				Name:  "plain",
+				Usage: "Write to the plaintext store of a split level (see stores in .puff.yaml)",
 			},
 			&cli.StringFlag{
 				Name:    "app",
@@ -45,6 +78,7 @@ func SetCommand() *cli.Command {
 				Aliases: []string{"t"},
 				Usage:   "Target platform",
 			},
+			dryRunFlag(),
 			&cli.StringFlag{
 				Name:    "root",
 				Aliases: []string{"r"},
@@ -57,174 +91,364 @@ func SetCommand() *cli.Command {
 }
 
 func setAction(c *cli.Context) error {
-	key := c.String("key")
-	value := c.String("value")
-	app := c.String("app")
-	env := c.String("env")
-	target := c.String("target")
-	rootDir := c.String("root")
-
-	// Get encryption keys from the directory - ALWAYS required
-	directoryAgeKeys, err := getDirectoryEncryptionKeys(rootDir)
+	pairs, source, err := pairsToSet(c)
 	if err != nil {
-		return fmt.Errorf("failed to check directory encryption: %w", err)
+		return err
 	}
-	if len(directoryAgeKeys) == 0 {
-		return fmt.Errorf("no encryption keys found in directory - run 'puff init' first to initialize with encryption keys")
+	rootDir := c.String("root")
+	placement, err := setPlacement(c)
+	if err != nil {
+		return err
 	}
 
 	// Determine which file to update based on the flags
-	var filePath string
+	filePath, err := store.ContextFile(rootDir, c.String("app"), c.String("env"), c.String("target"), dimensionValues(c))
+	if err != nil {
+		return err
+	}
 
-	if target != "" {
-		// Target-specific config: target-overrides/{target}/{env}/{app}.yml
-		// Env is optional for targets - defaults to "base" if not specified
-		targetEnv := env
-		if targetEnv == "" {
-			targetEnv = "base"
+	if c.Bool("dry-run") {
+		if c.Bool("binary") {
+			if err := planMarkBinary(rootDir, pairs[0].Key); err != nil {
+				return err
+			}
 		}
+		return planSet(rootDir, filePath, pairs, placement)
+	}
 
-		targetDir := filepath.Join(rootDir, "target-overrides", target, targetEnv)
-		if err := os.MkdirAll(targetDir, 0700); err != nil {
-			return fmt.Errorf("failed to create target directory: %w", err)
+	changes, records, err := store.Set(rootDir, filePath, pairs, placement)
+	for _, change := range changes {
+		if len(change.Set) > 0 {
+			printSet(change.Set, source, change.Path, change.Plain)
 		}
-
-		if app != "" {
-			filePath = filepath.Join(targetDir, fmt.Sprintf("%s.yml", app))
-		} else {
-			filePath = filepath.Join(targetDir, "shared.yml")
+		for _, key := range change.Moved {
+			color.Cyan("  moved %s out of %s", key, change.Path)
 		}
-	} else if env != "" {
-		// Environment-specific config
-		envDir := filepath.Join(rootDir, env)
-		if err := os.MkdirAll(envDir, 0700); err != nil {
-			return fmt.Errorf("failed to create environment directory: %w", err)
+		for _, key := range change.Unchanged {
+			color.Yellow("%s already has that value in %s; left unchanged", key, change.Path)
 		}
+	}
+	if err != nil {
+		return err
+	}
 
-		if app != "" {
-			filePath = filepath.Join(envDir, fmt.Sprintf("%s.yml", app))
-		} else {
-			filePath = filepath.Join(envDir, "shared.yml")
+	if c.Bool("binary") {
+		key := pairs[0].Key
+		marked, err := config.MarkBinary(rootDir, key)
+		if err != nil {
+			return err
+		}
+		if marked {
+			color.Cyan("  marked %s as binary in %s", key, config.MetadataFile)
+			records = append(records, audit.Record{File: config.MetadataFile, Key: key})
 		}
-	} else if app != "" {
-		// Base app-specific config
-		filePath = filepath.Join(rootDir, "base", fmt.Sprintf("%s.yml", app))
-	} else {
-		// Base shared config
-		filePath = filepath.Join(rootDir, "base", "shared.yml")
 	}
 
-	// Load existing config or create new one
-	var config map[string]interface{}
+	return store.RecordAudit(rootDir, "set", records...)
+}
+
+// planMarkBinary reports that set --binary would mark a key binary in
+// meta.yml, unless it already is
+func planMarkBinary(rootDir, key string) error {
+	metadata, err := config.LoadMetadata(rootDir)
+	if err != nil {
+		return err
+	}
+	if meta, _ := metadata.Get(key); meta.Encoding != config.EncodingBase64 {
+		color.Cyan("Would mark %s as binary in %s", key, config.MetadataFile)
+	}
+	return nil
+}
 
-	data, err := os.ReadFile(filePath)
+// planSet reports the files set would write, the keys it would change in
+// each, and who each file would be encrypted to. Values aren't shown.
+func planSet(rootDir, filePath string, pairs []dotenv.Entry, placement store.Placement) error {
+	changes, err := store.PlanSet(rootDir, filePath, pairs, placement)
 	if err != nil {
-		if os.IsNotExist(err) {
-			config = make(map[string]interface{})
-		} else {
-			return fmt.Errorf("failed to read file: %w", err)
+		return err
+	}
+	ageKeys, err := store.DirectoryKeys(rootDir)
+	if err != nil {
+		return fmt.Errorf("failed to check directory encryption: %w", err)
+	}
+
+	for _, change := range changes {
+		for _, key := range change.Unchanged {
+			color.Yellow("%s already has that value in %s; left unchanged", key, change.Path)
 		}
-	} else {
-		// Check if file is SOPS-encrypted
-		var checkMap map[string]interface{}
-		if err := yaml.Unmarshal(data, &checkMap); err != nil {
-			return fmt.Errorf("failed to parse YAML: %w", err)
-		}
-		if _, hasSops := checkMap["sops"]; hasSops {
-			// Decrypt the file
-			decryptedData, err := decrypt.File(filePath, "yaml")
-			if err != nil {
-				return fmt.Errorf("failed to decrypt file: %w", err)
-			}
-			data = decryptedData
+		if len(change.Set) == 0 && len(change.Moved) == 0 {
+			continue
 		}
+		how := "encrypted"
+		if change.Plain {
+			how = "plaintext"
+		}
+		color.Cyan("Would write %s (%s):", change.Path, how)
+		for _, pair := range change.Set {
+			fmt.Printf("  set %s\n", pair.Key)
+		}
+		for _, key := range change.Moved {
+			fmt.Printf("  move %s out\n", key)
+		}
+		if err := printRecipients(rootDir, change.Path, ageKeys); err != nil {
+			return err
+		}
+	}
+	printDryRunDone()
+	return nil
+}
+
+// setPlacement returns the store of a split level chosen with --secret or
+// --plain, if either is given
+func setPlacement(c *cli.Context) (store.Placement, error) {
+	if !c.Bool("secret") && !c.Bool("plain") {
+		return store.PlaceByName, nil
+	}
+	project, err := config.LoadProject(c.String("root"))
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case !project.Stores.Split:
+		return 0, fmt.Errorf("--secret and --plain need stores.split in %s", config.ProjectFile)
+	case c.Bool("secret") && c.Bool("plain"):
+		return 0, fmt.Errorf("only one of --secret and --plain can be given")
+	case c.Bool("secret"):
+		return store.PlaceSecret, nil
+	default:
+		return store.PlacePlain, nil
+	}
+}
 
-		// Parse the (possibly decrypted) YAML
-		if err := yaml.Unmarshal(data, &config); err != nil {
-			return fmt.Errorf("failed to parse YAML: %w", err)
+// printSet reports the pairs set in a file. Values read from stdin, a file,
+// or the terminal are usually secrets, so they aren't echoed.
+func printSet(pairs []dotenv.Entry, source, filePath string, plain bool) {
+	how := "encrypted"
+	if plain {
+		how = "plaintext"
+	}
+	switch {
+	case len(pairs) > 1:
+		color.Green("Set %d keys in %s (%s)", len(pairs), filePath, how)
+		for _, pair := range pairs {
+			color.Cyan("  %s", pair.Key)
+		}
+	case source != "":
+		color.Green("Set %s from %s in %s (%s)", pairs[0].Key, source, filePath, how)
+	default:
+		color.Green("Set %s=%s in %s (%s)", pairs[0].Key, pairs[0].Value, filePath, how)
+	}
+}
+
+// pairsToSet returns the keys and values passed to set: one key with --key,
+// or KEY=VALUE arguments, or the entries of --pairs-file. Keys given twice
+// take the last value. The source is where values were read from, if they
+// weren't given on the command line.
+func pairsToSet(c *cli.Context) ([]dotenv.Entry, string, error) {
+	args := c.Args().Slice()
+	modes := 0
+	for _, set := range []bool{c.IsSet("key"), len(args) > 0, c.IsSet("pairs-file")} {
+		if set {
+			modes++
 		}
-		if config == nil {
-			config = make(map[string]interface{})
+	}
+	if modes != 1 {
+		return nil, "", fmt.Errorf("exactly one of --key, KEY=VALUE arguments, or --pairs-file is required")
+	}
+	if !c.IsSet("key") {
+		for _, name := range []string{"value", "value-stdin", "from-file", "prompt", "binary"} {
+			if c.IsSet(name) {
+				return nil, "", fmt.Errorf("--%s requires --key", name)
+			}
 		}
-		// Remove SOPS metadata if it exists
-		delete(config, "sops")
 	}
 
-	// Set the value
-	config[key] = value
+	var entries []dotenv.Entry
+	var source string
+	switch {
+	case c.IsSet("key"):
+		// A dotted key is a path into nested maps, so a binary value would
+		// land in a map that isn't a file --extract-files can write
+		if key := c.String("key"); c.Bool("binary") && strings.Contains(key, ".") {
+			return nil, "", fmt.Errorf("--binary keys can't contain dots, which nest values in maps: use a name such as %s", strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key)))
+		}
+		value, valueSource, err := valueToSet(c)
+		if err != nil {
+			return nil, "", err
+		}
+		return []dotenv.Entry{{Key: c.String("key"), Value: value}}, valueSource, nil
+	case len(args) > 0:
+		for _, arg := range args {
+			key, value, ok := strings.Cut(arg, "=")
+			if !ok || key == "" {
+				return nil, "", fmt.Errorf("expected KEY=VALUE, got %q (flags must come before the pairs)", arg)
+			}
+			entries = append(entries, dotenv.Entry{Key: key, Value: value})
+		}
+	default:
+		source = c.String("pairs-file")
+		reader := c.App.Reader
+		if source == "-" {
+			source = "stdin"
+		} else {
+			f, err := os.Open(source)
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to open %s: %w", source, err)
+			}
+			defer f.Close()
+			reader = f
+		}
+		var err error
+		if entries, err = dotenv.Parse(reader); err != nil {
+			return nil, "", fmt.Errorf("failed to parse %s: %w", source, err)
+		}
+		if len(entries) == 0 {
+			return nil, "", fmt.Errorf("no keys found in %s", source)
+		}
+	}
 
-	// Write back to file
-	yamlData, err := yaml.Marshal(config)
-	if err != nil {
-		return fmt.Errorf("failed to marshal YAML: %w", err)
+	// Keep the last value of repeated keys, in the order keys first appear
+	var pairs []dotenv.Entry
+	index := make(map[string]int)
+	for _, entry := range entries {
+		if i, seen := index[entry.Key]; seen {
+			pairs[i].Value = entry.Value
+			continue
+		}
+		index[entry.Key] = len(pairs)
+		pairs = append(pairs, entry)
 	}
+	return pairs, source, nil
+}
 
-	// Ensure parent directory exists
-	dir := filepath.Dir(filePath)
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
+// valueToSet returns the value passed to set as --value, or read from stdin,
+// a file, or the terminal together with where it was read from. A single
+// trailing newline, as added by echo or an editor, is dropped from values
+// read from stdin or a file, unless they are base64-encoded with --binary.
+func valueToSet(c *cli.Context) (string, string, error) {
+	sources := 0
+	for _, name := range []string{"value", "value-stdin", "from-file", "prompt"} {
+		if c.IsSet(name) {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return "", "", fmt.Errorf("exactly one of --value, --value-stdin, --from-file, or --prompt is required")
 	}
 
-	// Write the plain YAML first
-	if err := os.WriteFile(filePath, yamlData, 0600); err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+	if c.Bool("binary") && !c.IsSet("from-file") && !c.IsSet("value-stdin") {
+		return "", "", fmt.Errorf("--binary needs --from-file or --value-stdin")
 	}
 
-	// ALWAYS encrypt - encryption is mandatory
-	if err := keys.EncryptFile(filePath, directoryAgeKeys); err != nil {
-		return fmt.Errorf("failed to encrypt file: %w", err)
+	if c.IsSet("value") {
+		return c.String("value"), "", nil
+	}
+	if c.Bool("prompt") {
+		value, err := promptValue(c.String("key"))
+		return value, "terminal", err
 	}
 
-	color.Green("Set %s=%s in %s (encrypted)", key, value, filePath)
+	var source string
+	var data []byte
+	var err error
+	if c.Bool("value-stdin") {
+		source = "stdin"
+		data, err = io.ReadAll(c.App.Reader)
+	} else {
+		source = c.String("from-file")
+		data, err = os.ReadFile(source)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read value from %s: %w", source, err)
+	}
+	if c.Bool("binary") {
+		return base64.StdEncoding.EncodeToString(data), source, nil
+	}
 
-	return nil
+	value := strings.TrimSuffix(string(data), "\n")
+	return strings.TrimSuffix(value, "\r"), source, nil
 }
 
-// getDirectoryEncryptionKeys scans the directory for any encrypted files and returns their age keys
-func getDirectoryEncryptionKeys(rootDir string) ([]string, error) {
-	keySet := make(map[string]bool)
+// promptValue reads a value from the terminal twice with echo disabled and
+// checks that both entries match. Prompts go to stderr, like passwd(1).
+func promptValue(key string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("--prompt needs a terminal (use --value-stdin to pipe a value)")
+	}
 
-	err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
+	var entries [2]string
+	for i, prompt := range []string{"Value for %s: ", "Confirm value for %s: "} {
+		fmt.Fprintf(os.Stderr, prompt, key)
+		entry, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
 		if err != nil {
-			return err
+			return "", fmt.Errorf("failed to read value: %w", err)
 		}
+		entries[i] = string(entry)
+	}
 
-		// Skip directories, non-yml files, and .sops.yaml
-		if info.IsDir() || filepath.Ext(path) != ".yml" || filepath.Base(path) == ".sops.yaml" {
-			return nil
-		}
+	if entries[0] == "" {
+		return "", fmt.Errorf("no value entered")
+	}
+	if entries[0] != entries[1] {
+		return "", fmt.Errorf("values don't match")
+	}
+	return entries[0], nil
+}
 
-		// Check if file is SOPS-encrypted
-		data, err := os.ReadFile(path)
-		if err != nil {
-			return nil // Skip files we can't read
-		}
+// listConfigFiles returns all config files under the root directory in
+// lexical order, skipping hidden directories, .sops.yaml, the keys.yml registry
+// and decrypted .dec files
+func listConfigFiles(rootDir string) ([]string, error) {
+	var files []string
 
-		var yamlData map[string]interface{}
-		if err := yaml.Unmarshal(data, &yamlData); err != nil {
-			return nil // Skip files that aren't valid YAML
+	err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
 		}
 
-		// If this is a SOPS file, extract its keys
-		if _, hasSops := yamlData["sops"]; hasSops {
-			fileKeys := keys.ExtractAgeKeys(yamlData)
-			for _, key := range fileKeys {
-				keySet[key] = true
+		if info.IsDir() {
+			if path != rootDir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
 			}
+			return nil
 		}
 
+		if isConfigFile(rootDir, path) {
+			files = append(files, path)
+		}
 		return nil
 	})
-
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to scan config files: %w", err)
+	}
+
+	return files, nil
+}
+
+// isConfigFile reports whether a file under the root directory holds config
+// values: a .yml or .yaml file other than a decrypted .dec file, a hidden
+// file such as .sops.yaml, the keys.yml registry, or the key metadata. Files
+// in hidden directories are not config.
+func isConfigFile(rootDir, path string) bool {
+	if !config.IsConfigFileName(filepath.Base(path)) {
+		return false
 	}
 
-	// Convert set to slice
-	result := make([]string, 0, len(keySet))
-	for key := range keySet {
-		result = append(result, key)
+	// The key registry and key metadata are plain metadata, not config
+	if path == filepath.Join(rootDir, keys.RegistryFile) || path == filepath.Join(rootDir, config.MetadataFile) {
+		return false
 	}
 
-	return result, nil
+	rel, err := filepath.Rel(rootDir, path)
+	if err != nil {
+		return false
+	}
+	for _, dir := range strings.Split(filepath.Dir(rel), string(filepath.Separator)) {
+		if strings.HasPrefix(dir, ".") && dir != "." {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,145 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/keys"
+	"github.com/teamcurri/puff/internal/safefile"
+	"github.com/teamcurri/puff/internal/snapshot"
+	"github.com/urfave/cli/v2"
+)
+
+// SnapshotCommand creates the snapshot command, which backs up the config
+// root to a single encrypted archive
+func SnapshotCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "snapshot",
+		Usage: "Write every file of the config root to a single age-encrypted archive, for backups independent of git hosting",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "output",
+				Aliases:  []string{"o"},
+				Usage:    "Archive file to write (e.g. backup.tar.age)",
+				Required: true,
+			},
+			&cli.StringSliceFlag{
+				Name:  "dr-recipient",
+				Usage: "Disaster-recovery age or SSH public key that can decrypt the archive and every encrypted file in it (repeatable)",
+			},
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: snapshotAction,
+	}
+}
+
+func snapshotAction(c *cli.Context) error {
+	rootDir := c.String("root")
+	outputFile := c.String("output")
+	drKeys := c.StringSlice("dr-recipient")
+
+	drRecipients, invalid := snapshot.ParseRecipients(drKeys)
+	if len(invalid) > 0 {
+		return fmt.Errorf("--dr-recipient must be an age or SSH public key, got %s", invalid[0])
+	}
+
+	// Anyone who can decrypt the config can decrypt its snapshot
+	sopsConfig, err := keys.LoadSOPSConfig(rootDir)
+	if err != nil {
+		return err
+	}
+	recipients, skipped := snapshot.ParseRecipients(sopsConfig.AllKeys())
+	recipients = append(recipients, drRecipients...)
+	if len(recipients) == 0 {
+		return fmt.Errorf("no age or SSH keys in .sops.yaml to encrypt the snapshot to; pass --dr-recipient")
+	}
+
+	var archive bytes.Buffer
+	files, err := snapshot.Create(rootDir, &archive, snapshot.Options{
+		Recipients: recipients,
+		ExtraKeys:  drKeys,
+		Exclude:    outputFile,
+	})
+	if err != nil {
+		return err
+	}
+	if err := safefile.Write(outputFile, archive.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", outputFile, err)
+	}
+
+	if len(skipped) > 0 {
+		color.Yellow("Keys that can't decrypt an age archive were skipped: %s", strings.Join(skipped, ", "))
+	}
+	color.Green("✓ Wrote %d file(s) to %s, encrypted to %d recipient(s)", len(files), outputFile, len(recipients))
+	if len(drKeys) > 0 {
+		fmt.Println("Encrypted files in the snapshot can also be decrypted with the disaster-recovery key(s)")
+	}
+	return nil
+}
+
+// RestoreCommand creates the restore command, which unpacks an archive
+// written by snapshot
+func RestoreCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "restore",
+		Usage:     "Unpack an archive written by snapshot into the config root",
+		ArgsUsage: "ARCHIVE",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:  "identity",
+				Usage: "age identity file to decrypt the archive with, such as a disaster-recovery key (repeatable; SOPS_AGE_KEY, SOPS_AGE_KEY_FILE, and the user's keys.txt are also tried)",
+			},
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "Overwrite files that already exist",
+			},
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Directory to restore the config root into",
+				Value:   ".",
+			},
+		},
+		Action: restoreAction,
+	}
+}
+
+func restoreAction(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("expected an ARCHIVE to restore")
+	}
+	archiveFile := c.Args().First()
+	rootDir := c.String("root")
+
+	identities, err := keys.LoadIdentities(c.StringSlice("identity"))
+	if err != nil {
+		return err
+	}
+
+	archive, err := os.Open(archiveFile)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer archive.Close()
+
+	// The whole archive is read before anything is written, so a corrupt
+	// or truncated archive leaves the root untouched
+	files, err := snapshot.Read(archive, identities)
+	if err != nil {
+		return err
+	}
+	if err := snapshot.Restore(rootDir, files, c.Bool("force")); err != nil {
+		return err
+	}
+
+	color.Green("✓ Restored %d file(s) from %s to %s", len(files), archiveFile, rootDir)
+	return nil
+}
@@ -0,0 +1,315 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/keys"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// fileStatus summarizes a single config file without decrypting it
+type fileStatus struct {
+	Path       string   `json:"path"`
+	Level      string   `json:"level,omitempty"`
+	App        string   `json:"app,omitempty"`
+	Keys       int      `json:"keys"`
+	Encrypted  bool     `json:"encrypted"`
+	Plain      bool     `json:"plain,omitempty"`
+	Recipients []string `json:"recipients"`
+}
+
+// statusReport is the JSON output of status. Paths are relative to the
+// config root, and key warnings are only reported once the repo keeps a key
+// registry.
+type statusReport struct {
+	Files          []fileStatus `json:"files"`
+	KeyWarnings    []keyWarning `json:"key_warnings"`
+	DecryptedFiles []string     `json:"decrypted_files"`
+}
+
+// keyWarning lists what is wrong with a recipient of the config files
+type keyWarning struct {
+	Recipient string   `json:"recipient"`
+	Warnings  []string `json:"warnings"`
+}
+
+// StatusCommand creates the status command for an overview of the config repo
+func StatusCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "status",
+		Usage: "Show an overview of config files, key counts, recipients, and stray decrypted files",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: statusAction,
+	}
+}
+
+func statusAction(c *cli.Context) error {
+	_, err := forEachRoot(c.String("root"), jsonOutput(c), "status", func(rootDir string) (interface{}, bool, error) {
+		report, err := printStatus(rootDir, jsonOutput(c))
+		return report, false, err
+	})
+	return err
+}
+
+// printStatus gives an overview of a config root. With JSON output it prints
+// nothing and returns the report instead.
+func printStatus(rootDir string, asJSON bool) (*statusReport, error) {
+	layout, err := config.Discover(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := listConfigFiles(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make(map[string]*fileStatus)
+	for _, file := range files {
+		status, err := readFileStatus(file)
+		if err != nil {
+			return nil, err
+		}
+		statuses[file] = status
+	}
+
+	// Key comments from keys.yml and .sops.yaml make recipients readable
+	registry, err := keys.LoadRegistry(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	comments := keyComments(rootDir, registry)
+
+	// Decrypted files left behind by decrypt/encrypt
+	strays, err := findDecryptedFiles(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	project, err := config.LoadProject(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if asJSON {
+		report := statusReport{Files: []fileStatus{}, KeyWarnings: []keyWarning{}, DecryptedFiles: []string{}}
+		for _, file := range files {
+			status := *statuses[file]
+			status.Path = relativeSource(rootDir, file)
+			if level, ok := project.FileLevel(status.Path); ok {
+				status.Level = level.String()
+				status.Plain = level.Plain
+				status.App = level.App
+				if status.App == "" {
+					status.App = "shared"
+				}
+			}
+			if status.Recipients == nil {
+				status.Recipients = []string{}
+			}
+			report.Files = append(report.Files, status)
+		}
+		if registry.Exists() {
+			report.KeyWarnings = append(report.KeyWarnings, recipientWarnings(registry, files, statuses)...)
+		}
+		for _, stray := range strays {
+			report.DecryptedFiles = append(report.DecryptedFiles, relativeSource(rootDir, stray))
+		}
+		return &report, nil
+	}
+
+	// App x environment matrix of key counts
+	color.Cyan("Keys per app and environment:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	columns := append([]string{"base"}, layout.Envs...)
+	fmt.Fprintf(w, "APP\t%s\n", strings.Join(columns, "\t"))
+	for _, app := range append([]string{"shared"}, layout.Apps...) {
+		cells := []string{app}
+		for _, env := range columns {
+			cellApp := app
+			if app == "shared" {
+				cellApp = ""
+			}
+			cellEnv := env
+			if env == "base" {
+				cellEnv = ""
+			}
+			// A split level's count covers both of its stores
+			levels := []config.Level{{App: cellApp, Env: cellEnv}}
+			if project.Stores.Split {
+				levels = append(levels, config.Level{App: cellApp, Env: cellEnv, Plain: true})
+			}
+			count, found := 0, false
+			for _, level := range levels {
+				if status, ok := statuses[project.LevelFile(rootDir, level)]; ok {
+					count += status.Keys
+					found = true
+				}
+			}
+			if found {
+				cells = append(cells, fmt.Sprintf("%d", count))
+			} else {
+				cells = append(cells, "-")
+			}
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+
+	// Per-file details, including target overrides
+	color.Cyan("\nConfig files:")
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tKEYS\tENCRYPTED\tRECIPIENTS")
+	for _, file := range files {
+		status := statuses[file]
+		encrypted := "yes"
+		if level, ok := project.FileLevel(relativeSource(rootDir, file)); ok && level.Plain && !status.Encrypted {
+			encrypted = "plain"
+		} else if !status.Encrypted {
+			encrypted = "NO"
+		}
+		recipients := make([]string, 0, len(status.Recipients))
+		for _, recipient := range status.Recipients {
+			recipients = append(recipients, recipientLabel(recipient, comments))
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", relativeSource(rootDir, file), status.Keys, encrypted, strings.Join(recipients, ", "))
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+
+	// Expired and unowned keys, once the repo keeps a key registry
+	if registry.Exists() {
+		printKeyWarnings(registry, files, statuses, comments)
+	}
+
+	if len(strays) > 0 {
+		color.Red("\nStray decrypted files (encrypt or delete these):")
+		for _, stray := range strays {
+			fmt.Printf("  %s\n", relativeSource(rootDir, stray))
+		}
+	} else {
+		color.Green("\nNo stray decrypted files")
+	}
+
+	return nil, nil
+}
+
+// printKeyWarnings reports recipients of the config files that are past
+// their expiry date or have no owner in keys.yml
+func printKeyWarnings(registry *keys.Registry, files []string, statuses map[string]*fileStatus, comments map[string]string) {
+	warnings := recipientWarnings(registry, files, statuses)
+	if len(warnings) == 0 {
+		color.Green("\nAll keys are owned and unexpired")
+		return
+	}
+	color.Red("\nKey warnings:")
+	for _, warning := range warnings {
+		fmt.Printf("  %s: %s\n", recipientLabel(warning.Recipient, comments), strings.Join(warning.Warnings, ", "))
+	}
+}
+
+// recipientWarnings returns the recipients of the config files that are past
+// their expiry date or have no owner in keys.yml, in the order they are found
+func recipientWarnings(registry *keys.Registry, files []string, statuses map[string]*fileStatus) []keyWarning {
+	now := time.Now()
+	seen := make(map[string]bool)
+	var warnings []keyWarning
+	for _, file := range files {
+		for _, recipient := range statuses[file].Recipients {
+			if seen[recipient] {
+				continue
+			}
+			seen[recipient] = true
+			if problems := registry.Warnings(recipient, now); len(problems) > 0 {
+				warnings = append(warnings, keyWarning{Recipient: recipient, Warnings: problems})
+			}
+		}
+	}
+	return warnings
+}
+
+// readFileStatus reads key counts and recipients from a config file.
+// SOPS leaves keys in plaintext, so no decryption is needed.
+func readFileStatus(path string) (*fileStatus, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var yamlData map[string]interface{}
+	if err := yaml.Unmarshal(data, &yamlData); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	_, encrypted := yamlData["sops"]
+	keyCount := len(yamlData)
+	if encrypted {
+		keyCount--
+	}
+
+	return &fileStatus{
+		Path:       path,
+		Keys:       keyCount,
+		Encrypted:  encrypted,
+		Recipients: keys.ExtractKeys(yamlData),
+	}, nil
+}
+
+// recipientLabel returns the .sops.yaml comment for a recipient, or an
+// abbreviated key if it has none
+func recipientLabel(recipient string, comments map[string]string) string {
+	if comment := comments[recipient]; comment != "" {
+		return comment
+	}
+	if len(recipient) > 16 {
+		return recipient[:10] + "..." + recipient[len(recipient)-4:]
+	}
+	return recipient
+}
+
+// findDecryptedFiles returns all .dec files under the root directory
+func findDecryptedFiles(rootDir string) ([]string, error) {
+	var files []string
+
+	err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if path != rootDir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		name := info.Name()
+		if strings.Contains(name, ".dec.") || strings.HasSuffix(name, ".dec") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan for decrypted files: %w", err)
+	}
+
+	return files, nil
+}
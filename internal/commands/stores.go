@@ -0,0 +1,72 @@
+package commands
+
+import (
+	"github.com/teamcurri/puff/internal/store"
+)
+
+// mergeStores merges the values of a level's stores, as read by
+// store.ReadStores, and returns the store each key is in. A key in both
+// stores of a split level takes its value from the secret store, the last
+// one, as when the config is loaded.
+func mergeStores(stores []map[string]interface{}) (map[string]interface{}, map[string]int) {
+	merged := make(map[string]interface{})
+	index := make(map[string]int)
+	for i, values := range stores {
+		for key, value := range values {
+			merged[key] = value
+			index[key] = i
+		}
+	}
+	return merged, index
+}
+
+// storeUpdates tracks changes to the stores of a level and the order they
+// are written in: stores gaining keys come before those keys move out of,
+// so a failed write never loses a value
+type storeUpdates struct {
+	paths   []string
+	values  []map[string]interface{}
+	gained  []bool
+	changed []bool
+}
+
+func newStoreUpdates(paths []string, values []map[string]interface{}) *storeUpdates {
+	return &storeUpdates{
+		paths:   paths,
+		values:  values,
+		gained:  make([]bool, len(paths)),
+		changed: make([]bool, len(paths)),
+	}
+}
+
+// set sets a key in the store at index and removes it from the level's
+// other store
+func (u *storeUpdates) set(index int, key string, value interface{}) {
+	u.values[index][key] = value
+	u.gained[index], u.changed[index] = true, true
+	u.remove(index, key)
+}
+
+// remove removes a key from every store but the one at index
+func (u *storeUpdates) remove(index int, key string) {
+	for i := range u.values {
+		if _, exists := u.values[i][key]; exists && i != index {
+			delete(u.values[i], key)
+			u.changed[i] = true
+		}
+	}
+}
+
+// updates returns the changed stores in the order they're written
+func (u *storeUpdates) updates() []store.Update {
+	var gaining, losing []store.Update
+	for i, path := range u.paths {
+		switch {
+		case u.gained[i]:
+			gaining = append(gaining, store.Update{Path: path, Values: u.values[i]})
+		case u.changed[i]:
+			losing = append(losing, store.Update{Path: path, Values: u.values[i]})
+		}
+	}
+	return append(gaining, losing...)
+}
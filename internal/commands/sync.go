@@ -0,0 +1,868 @@
+package commands
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/output"
+	"github.com/teamcurri/puff/internal/remote"
+	"github.com/urfave/cli/v2"
+)
+
+// SyncCommand creates the sync parent command for pushing config to external stores
+func SyncCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "sync",
+		Usage: "Push resolved config to an external secret store",
+		Subcommands: []*cli.Command{
+			syncSSMCommand(),
+			syncAzureKVCommand(),
+			syncVaultCommand(),
+			syncConsulCommand(),
+			syncNomadCommand(),
+			syncGitLabCommand(),
+			syncFlyCommand(),
+			syncHerokuCommand(),
+			syncLambdaCommand(),
+			syncECSCommand(),
+			syncCloudRunCommand(),
+		},
+	}
+}
+
+// syncFlags returns the flags shared by all sync subcommands
+func syncFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:     "app",
+			Aliases:  []string{"a"},
+			Usage:    "Application name",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:     "env",
+			Aliases:  []string{"e"},
+			Usage:    "Environment name",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:    "target",
+			Aliases: []string{"t"},
+			Usage:   "Target platform (optional)",
+		},
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "Show what would change without writing to the store",
+			Value: false,
+		},
+		&cli.BoolFlag{
+			Name:  "show-values",
+			Usage: "Show values in the change summary instead of masking them",
+			Value: false,
+		},
+		noHostEnvFlag(),
+		&cli.StringFlag{
+			Name:    "root",
+			Aliases: []string{"r"},
+			Usage:   "Root directory for config files",
+			Value:   ".",
+		},
+	}
+}
+
+func syncSSMCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "ssm",
+		Usage: "Sync resolved config to AWS SSM Parameter Store as SecureString parameters",
+		Flags: append(syncFlags(),
+			&cli.StringFlag{
+				Name:     "path",
+				Usage:    "Parameter path prefix (e.g. /app/prod/)",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "kms-key-id",
+				Usage: "KMS key ID, ARN, or alias to encrypt parameters with (defaults to aws/ssm)",
+			},
+			&cli.StringFlag{
+				Name:  "region",
+				Usage: "AWS region (defaults to AWS_REGION or the profile's region)",
+			},
+		),
+		Action: syncSSMAction,
+	}
+}
+
+func syncSSMAction(c *cli.Context) error {
+	tags := map[string]string{
+		"app": c.String("app"),
+		"env": c.String("env"),
+	}
+	if target := c.String("target"); target != "" {
+		tags["target"] = target
+	}
+
+	store, err := remote.NewSSMStore(c.Context, remote.SSMOptions{
+		Path:     c.String("path"),
+		KMSKeyID: c.String("kms-key-id"),
+		Region:   c.String("region"),
+		Tags:     tags,
+	})
+	if err != nil {
+		return err
+	}
+
+	return syncToStore(c, store, fmt.Sprintf("SSM path %s", c.String("path")), false)
+}
+
+func syncAzureKVCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "azure-kv",
+		Usage: "Sync resolved config to Azure Key Vault secrets",
+		Flags: append(syncFlags(),
+			&cli.StringFlag{
+				Name:     "vault",
+				Usage:    "Key Vault name or URL",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "prefix",
+				Usage: "Prefix for secret names (e.g. api-prod-)",
+			},
+			&cli.StringFlag{
+				Name:  "naming",
+				Usage: "Secret naming convention: dashes (DB-PASSWORD) or lower-dashes (db-password)",
+				Value: string(remote.AzureNamingDashes),
+			},
+			&cli.BoolFlag{
+				Name:  "prune",
+				Usage: "Delete secrets written by puff for this app and env that are no longer in the config",
+				Value: false,
+			},
+		),
+		Action: syncAzureKVAction,
+	}
+}
+
+func syncAzureKVAction(c *cli.Context) error {
+	tags := map[string]string{
+		"app": c.String("app"),
+		"env": c.String("env"),
+	}
+	if target := c.String("target"); target != "" {
+		tags["target"] = target
+	}
+
+	store, err := remote.NewAzureKVStore(remote.AzureKVOptions{
+		Vault:  c.String("vault"),
+		Prefix: c.String("prefix"),
+		Naming: remote.AzureNaming(c.String("naming")),
+		Tags:   tags,
+	})
+	if err != nil {
+		return err
+	}
+
+	return syncToStore(c, store, fmt.Sprintf("Key Vault %s", c.String("vault")), c.Bool("prune"))
+}
+
+func syncVaultCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "vault",
+		Usage: "Sync resolved config to a HashiCorp Vault KV v2 secret",
+		Flags: append(syncFlags(),
+			&cli.StringFlag{
+				Name:     "mount",
+				Usage:    "KV v2 secrets engine mount path (e.g. kv)",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "path",
+				Usage:    "Secret path within the mount (e.g. apps/api/prod)",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "address",
+				Usage: "Vault address (defaults to VAULT_ADDR)",
+			},
+		),
+		Action: syncVaultAction,
+	}
+}
+
+func syncVaultAction(c *cli.Context) error {
+	store, err := remote.NewVaultKVStore(remote.VaultKVOptions{
+		Address: c.String("address"),
+		Mount:   c.String("mount"),
+		Path:    c.String("path"),
+	})
+	if err != nil {
+		return err
+	}
+
+	return syncToStore(c, store, fmt.Sprintf("Vault secret %s/%s", c.String("mount"), c.String("path")), false)
+}
+
+func syncConsulCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "consul",
+		Usage: "Sync resolved config to Consul KV entries under a prefix, for consul-template",
+		Flags: append(syncFlags(),
+			&cli.StringFlag{
+				Name:     "prefix",
+				Usage:    "Key prefix (e.g. apps/api/prod)",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "address",
+				Usage:   "Consul HTTP address",
+				EnvVars: []string{"CONSUL_HTTP_ADDR"},
+				Value:   remote.DefaultConsulAddress,
+			},
+			&cli.StringFlag{
+				Name:    "token",
+				Usage:   "Consul ACL token with write access to the prefix",
+				EnvVars: []string{"CONSUL_HTTP_TOKEN"},
+			},
+			&cli.StringFlag{
+				Name:  "datacenter",
+				Usage: "Datacenter to write to (defaults to the agent's)",
+			},
+			&cli.BoolFlag{
+				Name:  "prune",
+				Usage: "Delete entries under the prefix whose keys are no longer in the config",
+				Value: false,
+			},
+		),
+		Action: syncConsulAction,
+	}
+}
+
+func syncConsulAction(c *cli.Context) error {
+	store, err := remote.NewConsulKVStore(remote.ConsulKVOptions{
+		Address:    c.String("address"),
+		Token:      c.String("token"),
+		Datacenter: c.String("datacenter"),
+		Prefix:     c.String("prefix"),
+	})
+	if err != nil {
+		return err
+	}
+
+	return syncToStore(c, store, fmt.Sprintf("Consul prefix %s", c.String("prefix")), c.Bool("prune"))
+}
+
+func syncNomadCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "nomad",
+		Usage: "Sync resolved config to the items of a Nomad variable",
+		Flags: append(syncFlags(),
+			&cli.StringFlag{
+				Name:  "path",
+				Usage: "Variable path (defaults to nomad/jobs/APP, which the job APP can read)",
+			},
+			&cli.StringFlag{
+				Name:    "address",
+				Usage:   "Nomad HTTP address",
+				EnvVars: []string{"NOMAD_ADDR"},
+				Value:   remote.DefaultNomadAddress,
+			},
+			&cli.StringFlag{
+				Name:    "token",
+				Usage:   "Nomad ACL token with write access to the variable",
+				EnvVars: []string{"NOMAD_TOKEN"},
+			},
+			&cli.StringFlag{
+				Name:    "namespace",
+				Usage:   "Namespace of the variable",
+				EnvVars: []string{"NOMAD_NAMESPACE"},
+			},
+			&cli.StringFlag{
+				Name:    "region",
+				Usage:   "Region to write to (defaults to the agent's)",
+				EnvVars: []string{"NOMAD_REGION"},
+			},
+		),
+		Action: syncNomadAction,
+	}
+}
+
+func syncNomadAction(c *cli.Context) error {
+	path := c.String("path")
+	if path == "" {
+		path = "nomad/jobs/" + c.String("app")
+	}
+
+	store, err := remote.NewNomadVariableStore(remote.NomadVariableOptions{
+		Address:   c.String("address"),
+		Token:     c.String("token"),
+		Namespace: c.String("namespace"),
+		Region:    c.String("region"),
+		Path:      path,
+	})
+	if err != nil {
+		return err
+	}
+
+	return syncToStore(c, store, fmt.Sprintf("Nomad variable %s", path), false)
+}
+
+func syncFlyCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "fly",
+		Usage: "Sync resolved config to the secrets of a Fly.io app, in a single release",
+		Flags: append(syncFlags(),
+			&cli.StringFlag{
+				Name:  "fly-app",
+				Usage: "Fly.io app name (defaults to the app name)",
+			},
+			&cli.BoolFlag{
+				Name:  "prune",
+				Usage: "Delete secrets that are no longer in the config, including ones set outside puff",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:  "fly-api-url",
+				Usage: "Fly.io API URL",
+				Value: remote.DefaultFlyAPIURL,
+			},
+			&cli.StringFlag{
+				Name:    "token",
+				Usage:   "Fly.io access token",
+				EnvVars: []string{"FLY_API_TOKEN", "FLY_ACCESS_TOKEN"},
+			},
+		),
+		Action: syncFlyAction,
+	}
+}
+
+func syncFlyAction(c *cli.Context) error {
+	app := c.String("fly-app")
+	if app == "" {
+		app = c.String("app")
+	}
+
+	store, err := remote.NewFlyStore(remote.FlyOptions{
+		APIURL: c.String("fly-api-url"),
+		Token:  c.String("token"),
+		App:    app,
+	})
+	if err != nil {
+		return err
+	}
+
+	return syncToStore(c, store, fmt.Sprintf("Fly.io app %s", app), c.Bool("prune"))
+}
+
+func syncHerokuCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "heroku",
+		Usage: "Sync resolved config to the config vars of a Heroku app, in a single release",
+		Flags: append(syncFlags(),
+			&cli.StringFlag{
+				Name:  "heroku-app",
+				Usage: "Heroku app name (defaults to the app name)",
+			},
+			&cli.BoolFlag{
+				Name:  "prune",
+				Usage: "Delete config vars that are no longer in the config, including ones set by add-ons",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:  "heroku-api-url",
+				Usage: "Heroku Platform API URL",
+				Value: remote.DefaultHerokuAPIURL,
+			},
+			&cli.StringFlag{
+				Name:    "token",
+				Usage:   "Heroku API key",
+				EnvVars: []string{"HEROKU_API_KEY"},
+			},
+		),
+		Action: syncHerokuAction,
+	}
+}
+
+func syncHerokuAction(c *cli.Context) error {
+	app := c.String("heroku-app")
+	if app == "" {
+		app = c.String("app")
+	}
+
+	store, err := remote.NewHerokuStore(remote.HerokuOptions{
+		APIURL: c.String("heroku-api-url"),
+		Token:  c.String("token"),
+		App:    app,
+	})
+	if err != nil {
+		return err
+	}
+
+	return syncToStore(c, store, fmt.Sprintf("Heroku app %s", app), c.Bool("prune"))
+}
+
+func syncLambdaCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "lambda",
+		Usage: "Sync resolved config to the environment variables of an AWS Lambda function, optionally keeping large or sensitive values in SSM",
+		Flags: append(syncFlags(), append([]cli.Flag{
+			&cli.StringFlag{
+				Name:     "function-name",
+				Usage:    "Function name or ARN",
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:  "prune",
+				Usage: "Delete environment variables that are no longer in the config, including ones set outside puff",
+				Value: false,
+			},
+		}, ssmRoutingFlags()...)...),
+		Action: syncLambdaAction,
+	}
+}
+
+func syncLambdaAction(c *cli.Context) error {
+	desired, err := syncValues(c)
+	if err != nil {
+		return err
+	}
+
+	if _, err := routeToSSM(c, desired); err != nil {
+		return err
+	}
+
+	if size := remote.LambdaEnvironmentSize(desired); size > remote.LambdaEnvironmentLimit {
+		return fmt.Errorf("the environment of %s would be %d bytes, over the Lambda limit of %d; keep large values in SSM with --ssm-path and --ssm-keys or --ssm-min-size", c.String("function-name"), size, remote.LambdaEnvironmentLimit)
+	}
+
+	store, err := remote.NewLambdaStore(c.Context, remote.LambdaOptions{
+		FunctionName: c.String("function-name"),
+		Region:       c.String("region"),
+	})
+	if err != nil {
+		return err
+	}
+
+	return syncDesired(c, store, fmt.Sprintf("Lambda function %s", c.String("function-name")), c.Bool("prune"), desired)
+}
+
+func syncECSCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "ecs",
+		Usage: "Sync resolved config to the environment of an ECS service's container and deploy it, optionally keeping large or sensitive values in SSM",
+		Flags: append(syncFlags(), append([]cli.Flag{
+			&cli.StringFlag{
+				Name:     "service",
+				Usage:    "Service name or ARN",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "cluster",
+				Usage: "Cluster name or ARN (defaults to the default cluster)",
+			},
+			&cli.StringFlag{
+				Name:  "container",
+				Usage: "Container to configure (defaults to the task's only container)",
+			},
+			&cli.BoolFlag{
+				Name:  "prune",
+				Usage: "Delete environment variables and secrets that are no longer in the config, including ones set outside puff",
+				Value: false,
+			},
+		}, ssmRoutingFlags()...)...),
+		Action: syncECSAction,
+	}
+}
+
+func syncECSAction(c *cli.Context) error {
+	desired, err := syncValues(c)
+	if err != nil {
+		return err
+	}
+
+	// Values kept in SSM become container secrets, which ECS resolves when
+	// it starts the task
+	secretKeys, err := routeToSSM(c, desired)
+	if err != nil {
+		return err
+	}
+
+	store, err := remote.NewECSServiceStore(c.Context, remote.ECSServiceOptions{
+		Cluster:    c.String("cluster"),
+		Service:    c.String("service"),
+		Container:  c.String("container"),
+		Region:     c.String("region"),
+		SecretKeys: secretKeys,
+	})
+	if err != nil {
+		return err
+	}
+
+	return syncDesired(c, store, fmt.Sprintf("ECS service %s", c.String("service")), c.Bool("prune"), desired)
+}
+
+func syncCloudRunCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "cloudrun",
+		Usage: "Sync resolved config to the environment variables of a Cloud Run service and roll out a new revision",
+		Flags: append(syncFlags(),
+			&cli.StringFlag{
+				Name:     "service",
+				Usage:    "Service name",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "project",
+				Usage:   "Google Cloud project ID",
+				EnvVars: []string{"CLOUDSDK_CORE_PROJECT", "GOOGLE_CLOUD_PROJECT"},
+			},
+			&cli.StringFlag{
+				Name:    "region",
+				Usage:   "Region of the service (e.g. us-central1)",
+				EnvVars: []string{"CLOUDSDK_RUN_REGION"},
+			},
+			&cli.StringFlag{
+				Name:  "container",
+				Usage: "Container to configure (defaults to the service's only container)",
+			},
+			&cli.BoolFlag{
+				Name:  "prune",
+				Usage: "Delete environment variables that are no longer in the config, including ones set outside puff (Secret Manager references are kept)",
+				Value: false,
+			},
+			&cli.StringFlag{
+				Name:    "token",
+				Usage:   "OAuth access token, e.g. from gcloud auth print-access-token (defaults to Application Default Credentials)",
+				EnvVars: []string{"CLOUDSDK_AUTH_ACCESS_TOKEN"},
+			},
+			&cli.StringFlag{
+				Name:  "cloudrun-api-url",
+				Usage: "Cloud Run Admin API URL",
+				Value: remote.DefaultCloudRunAPIURL,
+			},
+		),
+		Action: syncCloudRunAction,
+	}
+}
+
+func syncCloudRunAction(c *cli.Context) error {
+	if c.String("project") == "" {
+		return fmt.Errorf("--project is required (or set CLOUDSDK_CORE_PROJECT)")
+	}
+	if c.String("region") == "" {
+		return fmt.Errorf("--region is required (or set CLOUDSDK_RUN_REGION)")
+	}
+
+	store, err := remote.NewCloudRunStore(c.Context, remote.CloudRunOptions{
+		APIURL:    c.String("cloudrun-api-url"),
+		Token:     c.String("token"),
+		Project:   c.String("project"),
+		Region:    c.String("region"),
+		Service:   c.String("service"),
+		Container: c.String("container"),
+	})
+	if err != nil {
+		return err
+	}
+
+	return syncToStore(c, store, fmt.Sprintf("Cloud Run service %s", c.String("service")), c.Bool("prune"))
+}
+
+// ssmRoutingFlags returns the flags for keeping selected values in SSM and
+// passing only their parameter names to the compute service
+func ssmRoutingFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:  "ssm-path",
+			Usage: "Parameter path prefix to keep the values selected by --ssm-keys and --ssm-min-size in (e.g. /app/prod/)",
+		},
+		&cli.StringFlag{
+			Name:  "ssm-keys",
+			Usage: "Comma-separated keys or glob patterns whose values are kept in SSM, with only the parameter name in the environment",
+		},
+		&cli.IntFlag{
+			Name:  "ssm-min-size",
+			Usage: "Keep values of at least this many bytes in SSM (0 to disable)",
+		},
+		&cli.StringFlag{
+			Name:  "kms-key-id",
+			Usage: "KMS key ID, ARN, or alias to encrypt SSM parameters with (defaults to aws/ssm)",
+		},
+		&cli.StringFlag{
+			Name:  "region",
+			Usage: "AWS region (defaults to AWS_REGION or the profile's region)",
+		},
+	}
+}
+
+// routeToSSM syncs the values selected by --ssm-keys and --ssm-min-size to
+// SSM under --ssm-path, replacing them in desired with their parameter names,
+// and returns the keys it replaced. The parameters are synced first, so the
+// service never references a parameter that doesn't exist yet.
+func routeToSSM(c *cli.Context, desired map[string]string) (map[string]bool, error) {
+	ssmPath := c.String("ssm-path")
+	ssmKeys := splitList(c.String("ssm-keys"))
+	minSize := c.Int("ssm-min-size")
+	for _, pattern := range ssmKeys {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid key pattern %q: %w", pattern, err)
+		}
+	}
+	if (len(ssmKeys) > 0 || minSize > 0) && ssmPath == "" {
+		return nil, fmt.Errorf("--ssm-path is required with --ssm-keys or --ssm-min-size")
+	}
+
+	routed := make(map[string]bool)
+	if ssmPath == "" {
+		return routed, nil
+	}
+
+	tags := map[string]string{
+		"app": c.String("app"),
+		"env": c.String("env"),
+	}
+	if target := c.String("target"); target != "" {
+		tags["target"] = target
+	}
+	ssmStore, err := remote.NewSSMStore(c.Context, remote.SSMOptions{
+		Path:     ssmPath,
+		KMSKeyID: c.String("kms-key-id"),
+		Region:   c.String("region"),
+		Tags:     tags,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	parameters := make(map[string]string)
+	for key, value := range desired {
+		if matchesAnyKey(key, ssmKeys) || (minSize > 0 && len(value) >= minSize) {
+			parameters[key] = value
+			desired[key] = ssmStore.ParameterName(key)
+			routed[key] = true
+		}
+	}
+	if len(parameters) > 0 {
+		if err := syncDesired(c, ssmStore, fmt.Sprintf("SSM path %s", ssmPath), false, parameters); err != nil {
+			return nil, err
+		}
+	}
+	return routed, nil
+}
+
+// matchesAnyKey reports whether key matches any of the given glob patterns.
+// Patterns must have been validated with path.Match.
+func matchesAnyKey(key string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, key); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func syncGitLabCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "gitlab",
+		Usage: "Sync resolved config to GitLab CI/CD variables scoped to an environment",
+		Flags: append(syncFlags(),
+			&cli.StringFlag{
+				Name:  "project",
+				Usage: "Project ID or path (e.g. group/project)",
+			},
+			&cli.StringFlag{
+				Name:  "group",
+				Usage: "Group ID or path, to write group variables instead of project variables",
+			},
+			&cli.StringFlag{
+				Name:  "environment-scope",
+				Usage: "Environment scope of the variables (defaults to the env name)",
+			},
+			&cli.StringFlag{
+				Name:  "masked-keys",
+				Usage: "Comma-separated keys or glob patterns to mark as masked",
+				Value: "*_PASSWORD,*_SECRET,*_TOKEN,*_KEY",
+			},
+			&cli.StringFlag{
+				Name:  "protected-keys",
+				Usage: "Comma-separated keys or glob patterns to mark as protected",
+			},
+			&cli.StringFlag{
+				Name:    "gitlab-url",
+				Usage:   "GitLab instance URL",
+				EnvVars: []string{"CI_SERVER_URL"},
+				Value:   remote.DefaultGitLabURL,
+			},
+			&cli.StringFlag{
+				Name:    "token",
+				Usage:   "GitLab access token with api scope",
+				EnvVars: []string{"GITLAB_TOKEN"},
+			},
+		),
+		Action: syncGitLabAction,
+	}
+}
+
+func syncGitLabAction(c *cli.Context) error {
+	scope := c.String("environment-scope")
+	if scope == "" {
+		scope = c.String("env")
+	}
+
+	store, err := remote.NewGitLabStore(remote.GitLabOptions{
+		URL:              c.String("gitlab-url"),
+		Token:            c.String("token"),
+		Project:          c.String("project"),
+		Group:            c.String("group"),
+		EnvironmentScope: scope,
+		MaskedKeys:       splitList(c.String("masked-keys")),
+		ProtectedKeys:    splitList(c.String("protected-keys")),
+	})
+	if err != nil {
+		return err
+	}
+
+	owner := "project " + c.String("project")
+	if c.String("group") != "" {
+		owner = "group " + c.String("group")
+	}
+
+	return syncToStore(c, store, fmt.Sprintf("GitLab %s (scope %s)", owner, scope), false)
+}
+
+// syncToStore compares the resolved config with the values in store and
+// writes the keys that were added or changed, deleting keys that are no
+// longer in the config if prune is set. Stores that hold all values in a
+// single secret are replaced as a whole, which always removes such keys.
+// Stores on release-based platforms get every change in a single release.
+// storeName describes the destination in messages.
+func syncToStore(c *cli.Context, store remote.Store, storeName string, prune bool) error {
+	desired, err := syncValues(c)
+	if err != nil {
+		return err
+	}
+	return syncDesired(c, store, storeName, prune, desired)
+}
+
+// syncValues loads and resolves the config to sync, as strings
+func syncValues(c *cli.Context) (map[string]string, error) {
+	values, err := exportedValues(config.LoadContext{
+		RootDir:    c.String("root"),
+		App:        c.String("app"),
+		Env:        c.String("env"),
+		Target:     c.String("target"),
+		Dimensions: dimensionValues(c),
+		NoHostEnv:  c.Bool("no-host-env"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output.StringValues(values), nil
+}
+
+// syncDesired syncs store with desired as syncToStore does, for commands
+// that change the resolved values before syncing them
+func syncDesired(c *cli.Context, store remote.Store, storeName string, prune bool, desired map[string]string) error {
+	replacer, replaces := store.(remote.Replacer)
+	releaser, releases := store.(remote.Releaser)
+	pruner, canPrune := store.(remote.Pruner)
+	if prune && !canPrune && !replaces && !releases {
+		return fmt.Errorf("%s does not support pruning", storeName)
+	}
+
+	current, err := store.Values(c.Context)
+	if err != nil {
+		return err
+	}
+
+	// The values of write-only stores can't be compared, so every key in
+	// the config counts as changed unless the store's digest of it matches
+	existing := stringMap(current)
+	_, writeOnly := store.(remote.WriteOnly)
+	digester, digests := store.(remote.Digester)
+	if writeOnly {
+		for key, digest := range current {
+			if value, ok := desired[key]; ok && digests && digester.MatchesDigest(digest, value) {
+				existing[key] = value
+				continue
+			}
+			existing[key] = unreadableValue{}
+		}
+	}
+
+	// Keys only in the store are left alone unless pruning
+	var changes []valueChange
+	for _, change := range diffValues(existing, stringMap(desired)) {
+		if writeOnly && change.From != nil {
+			change.From = maskedValue
+		}
+		if change.Kind != changeRemoved || prune || replaces {
+			changes = append(changes, change)
+		}
+	}
+
+	if len(changes) == 0 {
+		color.Green("%s is up to date", storeName)
+		return nil
+	}
+
+	if writeOnly && !digests {
+		color.Yellow("%s doesn't return its values, so every key is written", storeName)
+	}
+	printChanges(changes, c.Bool("show-values"))
+
+	if c.Bool("dry-run") {
+		color.Yellow("Dry run: %d change(s) would be written to %s", len(changes), storeName)
+		return nil
+	}
+
+	switch {
+	case replaces:
+		if err := replacer.Replace(c.Context, desired); err != nil {
+			return err
+		}
+	case releases:
+		set := make(map[string]string)
+		var remove []string
+		for _, change := range changes {
+			if change.Kind == changeRemoved {
+				remove = append(remove, change.Key)
+			} else {
+				set[change.Key] = desired[change.Key]
+			}
+		}
+		// Write-only stores remove keys by replacing all their values, so
+		// they need every key in the config
+		if writeOnly && len(remove) > 0 {
+			set = desired
+		}
+		if err := releaser.Release(c.Context, set, remove); err != nil {
+			return err
+		}
+	default:
+		writer, ok := store.(remote.KeyWriter)
+		if !ok {
+			return fmt.Errorf("%s does not support writing", storeName)
+		}
+		for _, change := range changes {
+			if change.Kind == changeRemoved {
+				if err := pruner.Delete(c.Context, change.Key); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := writer.Put(c.Context, change.Key, desired[change.Key]); err != nil {
+				return err
+			}
+		}
+	}
+
+	color.Green("Wrote %d change(s) to %s", len(changes), storeName)
+	return nil
+}
+
+// unreadableValue stands in for the values of write-only stores, and never
+// equals a config value
+type unreadableValue struct{}
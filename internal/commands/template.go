@@ -0,0 +1,143 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/output"
+	"github.com/teamcurri/puff/internal/safefile"
+	"github.com/urfave/cli/v2"
+)
+
+// TemplateCommand creates the template command, which renders arbitrary
+// files, such as nginx.conf.tmpl, with the resolved config
+func TemplateCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "template",
+		Usage:     "Render template files with the resolved config, e.g. nginx.conf.tmpl into nginx.conf",
+		ArgsUsage: "TEMPLATE [TEMPLATE ...]",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "app",
+				Aliases:  []string{"a"},
+				Usage:    "Application name",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "env",
+				Aliases:  []string{"e"},
+				Usage:    "Environment name",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "target",
+				Aliases: []string{"t"},
+				Usage:   "Target platform (optional)",
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Usage:   "Output file for a single template (defaults to stdout)",
+			},
+			&cli.StringFlag{
+				Name:  "out-dir",
+				Usage: "Write each rendered template into this directory, named after the template without its .tmpl or .tpl extension",
+			},
+			noHostEnvFlag(),
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: templateAction,
+	}
+}
+
+func templateAction(c *cli.Context) error {
+	templates := c.Args().Slice()
+	outputFile := c.String("output")
+	outDir := c.String("out-dir")
+	switch {
+	case len(templates) == 0:
+		return fmt.Errorf("expected at least one TEMPLATE file")
+	case outputFile != "" && outDir != "":
+		return fmt.Errorf("--output and --out-dir cannot be used together")
+	case len(templates) > 1 && outDir == "":
+		return fmt.Errorf("--out-dir is required when rendering several templates")
+	}
+
+	// Every template is read before rendering, so a missing one fails
+	// before anything is written
+	texts := make([]string, len(templates))
+	names := make(map[string]string)
+	for i, file := range templates {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read template: %w", err)
+		}
+		texts[i] = string(data)
+		if other, exists := names[renderedName(file)]; exists && outDir != "" {
+			return fmt.Errorf("templates %s and %s would both write %s", other, file, renderedName(file))
+		}
+		names[renderedName(file)] = file
+	}
+
+	// Load and resolve once, then render every template with the same values
+	values, err := exportedValues(config.LoadContext{
+		RootDir:    c.String("root"),
+		App:        c.String("app"),
+		Env:        c.String("env"),
+		Target:     c.String("target"),
+		Dimensions: dimensionValues(c),
+		NoHostEnv:  c.Bool("no-host-env"),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Render everything before writing, so a broken template leaves no
+	// file half-updated
+	rendered := make([]string, len(templates))
+	for i, file := range templates {
+		rendered[i], err = output.FormatOutput(values, output.FormatOptions{Format: output.FormatTemplate, Template: texts[i]})
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	if outputFile == "" && outDir == "" {
+		fmt.Print(rendered[0])
+		return nil
+	}
+	if outDir != "" {
+		if err := os.MkdirAll(outDir, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+	}
+	for i, file := range templates {
+		path := outputFile
+		if outDir != "" {
+			path = filepath.Join(outDir, renderedName(file))
+		}
+		// Written atomically, so a service reloading the file never reads
+		// half of it
+		if err := safefile.Write(path, []byte(rendered[i]), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		color.Green("Rendered %s to %s", file, path)
+	}
+	return nil
+}
+
+// renderedName returns the name of the file a template renders to: its name
+// without the .tmpl or .tpl extension
+func renderedName(templateFile string) string {
+	name := filepath.Base(templateFile)
+	return strings.TrimSuffix(strings.TrimSuffix(name, ".tmpl"), ".tpl")
+}
@@ -0,0 +1,149 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/audit"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/safefile"
+	"github.com/teamcurri/puff/internal/store"
+	"github.com/urfave/cli/v2"
+)
+
+// UnsetCommand creates the unset command for removing config values
+func UnsetCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "unset",
+		Usage: "Remove a config value for specified app/env/target",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "key",
+				Aliases:  []string{"k"},
+				Usage:    "Key to remove",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:    "app",
+				Aliases: []string{"a"},
+				Usage:   "Application name",
+			},
+			&cli.StringFlag{
+				Name:    "env",
+				Aliases: []string{"e"},
+				Usage:   "Environment name",
+			},
+			&cli.StringFlag{
+				Name:    "target",
+				Aliases: []string{"t"},
+				Usage:   "Target platform",
+			},
+			dryRunFlag(),
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: unsetAction,
+	}
+}
+
+func unsetAction(c *cli.Context) error {
+	key := c.String("key")
+	app := c.String("app")
+	env := c.String("env")
+	target := c.String("target")
+	rootDir := c.String("root")
+	dryRun := c.Bool("dry-run")
+
+	filePath, err := store.ContextFile(rootDir, app, env, target, dimensionValues(c))
+	if err != nil {
+		return err
+	}
+
+	// A split level may hold the key in either of its stores
+	files := []string{filePath}
+	project, err := config.LoadProject(rootDir)
+	if err != nil {
+		return err
+	}
+	if project.Stores.Split {
+		plainPath, err := store.PlainFile(project, rootDir, filePath)
+		if err != nil {
+			return err
+		}
+		files = []string{plainPath, filePath}
+	}
+	if !dryRun {
+		lock, err := safefile.Acquire(files...)
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+	}
+
+	stores := make(map[string]map[string]interface{})
+	for _, file := range files {
+		values, err := store.Read(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		if _, exists := values[key]; exists {
+			stores[file] = values
+		}
+	}
+	if len(stores) == 0 {
+		if _, err := os.Stat(filePath); os.IsNotExist(err) && !project.Stores.Split {
+			return fmt.Errorf("config file does not exist: %s", filePath)
+		}
+		return fmt.Errorf("key not found in %s: %s", filePath, key)
+	}
+
+	// Get encryption keys from the directory - ALWAYS required
+	directoryAgeKeys, err := store.DirectoryKeys(rootDir)
+	if err != nil {
+		return fmt.Errorf("failed to check directory encryption: %w", err)
+	}
+	if len(directoryAgeKeys) == 0 {
+		return fmt.Errorf("no encryption keys found in directory - run 'puff init' first to initialize with encryption keys")
+	}
+
+	var records []audit.Record
+	for _, file := range files {
+		values, ok := stores[file]
+		if !ok {
+			continue
+		}
+		how := "encrypted"
+		if file != filePath {
+			how = "plaintext"
+		}
+		if dryRun {
+			color.Cyan("Would remove %s from %s (%s)", key, file, how)
+			if err := printRecipients(rootDir, file, directoryAgeKeys); err != nil {
+				return err
+			}
+			continue
+		}
+
+		records = append(records, audit.Record{File: relativeSource(rootDir, file), Key: key, OldHash: audit.Hash(values[key])})
+		delete(values, key)
+
+		if err := store.Write(file, values, directoryAgeKeys); err != nil {
+			return err
+		}
+		color.Green("Removed %s from %s (%s)", key, file, how)
+	}
+	if dryRun {
+		printDryRunDone()
+		return nil
+	}
+
+	return store.RecordAudit(rootDir, "unset", records...)
+}
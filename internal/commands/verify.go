@@ -0,0 +1,289 @@
+package commands
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/getsops/sops/v3/decrypt"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/git"
+	"github.com/teamcurri/puff/internal/keys"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// verifyExitCode is the exit code used when verify finds a problem
+const verifyExitCode = 1
+
+// Kinds of problem verify reports
+const (
+	problemPlaintext             = "plaintext"
+	problemSecretInPlaintext     = "secret_in_plaintext"
+	problemInvalidYAML           = "invalid_yaml"
+	problemDecryptedFile         = "decrypted_file"
+	problemUndecryptable         = "undecryptable"
+	problemMACMismatch           = "mac_mismatch"
+	problemUnconfiguredRecipient = "unconfigured_recipient"
+	problemMissingRecipient      = "missing_recipient"
+)
+
+// verifyProblem is a problem with one file
+type verifyProblem struct {
+	Path   string `json:"path"` // Relative to the config root
+	Kind   string `json:"kind"`
+	Detail string `json:"detail"`
+}
+
+// verifyReport is the result of checking the config files
+type verifyReport struct {
+	FilesChecked int             `json:"files_checked"`
+	Problems     []verifyProblem `json:"problems"`
+}
+
+// verifyOptions selects the checks run on encrypted files
+type verifyOptions struct {
+	// plaintextOnly skips decrypting files and checking their recipients
+	plaintextOnly bool
+	// configured holds the keys in .sops.yaml
+	configured []string
+	// allowMissing accepts files that aren't encrypted to every key in
+	// .sops.yaml
+	allowMissing bool
+}
+
+// VerifyCommand creates the verify command for checking the integrity of
+// the encrypted config files
+func VerifyCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "verify",
+		Usage: "Check that every config file is encrypted, decryptable, intact, and encrypted to the keys in .sops.yaml",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "staged",
+				Usage: "Only check the files staged for commit for plaintext (used by the pre-commit hook)",
+			},
+			&cli.BoolFlag{
+				Name:  "allow-missing-recipients",
+				Usage: "Accept files that aren't encrypted to every key in .sops.yaml, e.g. with keys added for one environment",
+			},
+			&cli.StringFlag{
+				Name:    "format",
+				Aliases: []string{"f"},
+				Usage:   "Output format: table or json",
+				Value:   "table",
+			},
+			&cli.StringFlag{
+				Name:    "root",
+				Aliases: []string{"r"},
+				Usage:   "Root directory for config files",
+				Value:   ".",
+			},
+		},
+		Action: verifyAction,
+	}
+}
+
+func verifyAction(c *cli.Context) error {
+	rootDir := c.String("root")
+	format := reportFormat(c)
+	if format != "table" && format != "json" {
+		return fmt.Errorf("unsupported report format %q (use table or json)", format)
+	}
+
+	failed, err := forEachRoot(rootDir, format == "json", "verify report", func(rootDir string) (interface{}, bool, error) {
+		var report *verifyReport
+		var err error
+		if c.Bool("staged") {
+			report, err = verifyStaged(rootDir)
+		} else {
+			report, err = verifyWorkingTree(rootDir, c.Bool("allow-missing-recipients"))
+		}
+		if err != nil {
+			return nil, false, err
+		}
+
+		if format == "json" {
+			return report, len(report.Problems) > 0, nil
+		}
+		if len(report.Problems) == 0 {
+			color.Green("✓ %d config file(s) checked, no problems found", report.FilesChecked)
+		} else {
+			for _, problem := range report.Problems {
+				color.Red("✗ %s: %s", problem.Path, problem.Detail)
+			}
+			color.Red("\n%d problem(s) found in %d config file(s)", len(report.Problems), report.FilesChecked)
+		}
+		return report, len(report.Problems) > 0, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if failed {
+		return cli.Exit("", verifyExitCode)
+	}
+	return nil
+}
+
+// verifyWorkingTree runs every check on the files under the root directory
+func verifyWorkingTree(rootDir string, allowMissing bool) (*verifyReport, error) {
+	var files []string
+	err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != rootDir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan config files: %w", err)
+	}
+
+	sopsConfig, err := keys.LoadSOPSConfig(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	options := verifyOptions{configured: sopsConfig.Keys(), allowMissing: allowMissing}
+
+	return verifyFiles(rootDir, files, os.ReadFile, options)
+}
+
+// verifyStaged checks the files under the root directory that are staged for
+// commit for plaintext, as they are in the index. It needs no keys, so it
+// works for every committer.
+func verifyStaged(rootDir string) (*verifyReport, error) {
+	repo, err := git.Open(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	files, err := repo.StagedFiles()
+	if err != nil {
+		return nil, err
+	}
+	return verifyFiles(rootDir, files, repo.ReadStaged, verifyOptions{plaintextOnly: true})
+}
+
+// verifyFiles checks decrypted .dec files and config files, in path order
+func verifyFiles(rootDir string, files []string, readFile func(string) ([]byte, error), options verifyOptions) (*verifyReport, error) {
+	sort.Strings(files)
+	project, err := config.LoadProject(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &verifyReport{Problems: []verifyProblem{}}
+	for _, file := range files {
+		name := relativeSource(rootDir, file)
+		switch {
+		case isDecryptedFile(file):
+			report.FilesChecked++
+			report.Problems = append(report.Problems, verifyProblem{Path: name, Kind: problemDecryptedFile, Detail: "decrypted file left behind"})
+		case isConfigFile(rootDir, file):
+			report.FilesChecked++
+			data, err := readFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", name, err)
+			}
+			problems := verifyEncryptedFile(data, options)
+			if level, ok := project.FileLevel(name); ok && level.Plain && project.Stores.Split {
+				problems = verifyPlainStore(data, project)
+			}
+			for _, problem := range problems {
+				problem.Path = name
+				report.Problems = append(report.Problems, problem)
+			}
+		}
+	}
+	return report, nil
+}
+
+// verifyEncryptedFile checks that a config file is encrypted and, unless
+// only plaintext is checked, that it decrypts with the available keys, its
+// MAC is valid, and it is encrypted to exactly the keys in .sops.yaml
+func verifyEncryptedFile(data []byte, options verifyOptions) []verifyProblem {
+	if !isEncryptedYAML(data) {
+		return []verifyProblem{{Kind: problemPlaintext, Detail: "not encrypted"}}
+	}
+	if options.plaintextOnly {
+		return nil
+	}
+
+	var problems []verifyProblem
+	if _, err := decrypt.Data(data, "yaml"); err != nil {
+		kind := problemUndecryptable
+		if strings.Contains(err.Error(), "Failed to verify data integrity") {
+			kind = problemMACMismatch
+		}
+		problems = append(problems, verifyProblem{Kind: kind, Detail: err.Error()})
+	}
+
+	var values map[string]interface{}
+	yaml.Unmarshal(data, &values)
+	recipients := make(map[string]bool)
+	for _, group := range keys.ExtractKeyGroups(values).Groups {
+		for _, key := range group {
+			recipients[key] = true
+		}
+	}
+	configured := make(map[string]bool)
+	for _, key := range options.configured {
+		configured[key] = true
+		if !recipients[key] && !options.allowMissing {
+			problems = append(problems, verifyProblem{Kind: problemMissingRecipient, Detail: "not encrypted to " + key})
+		}
+	}
+	var unconfigured []string
+	for key := range recipients {
+		if !configured[key] {
+			unconfigured = append(unconfigured, key)
+		}
+	}
+	sort.Strings(unconfigured)
+	for _, key := range unconfigured {
+		problems = append(problems, verifyProblem{Kind: problemUnconfiguredRecipient, Detail: "encrypted to " + key + ", which is not in .sops.yaml"})
+	}
+
+	return problems
+}
+
+// verifyPlainStore checks that the plaintext store of a split level holds no
+// keys that the naming convention in .puff.yaml says are secrets
+func verifyPlainStore(data []byte, project *config.Project) []verifyProblem {
+	if isEncryptedYAML(data) {
+		return nil
+	}
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return []verifyProblem{{Kind: problemInvalidYAML, Detail: err.Error()}}
+	}
+	if project.Stores.SecretKeys == "" {
+		return nil
+	}
+
+	var problems []verifyProblem
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		if project.Stores.IsSecret(key) {
+			problems = append(problems, verifyProblem{Kind: problemSecretInPlaintext, Detail: key + " looks like a secret but is in the plaintext store"})
+		}
+	}
+	return problems
+}
+
+// isDecryptedFile reports whether a file is a decrypted copy written by
+// 'puff decrypt', such as api.dec.yml
+func isDecryptedFile(path string) bool {
+	base := filepath.Base(path)
+	return strings.Contains(base, ".dec.") || strings.HasSuffix(base, ".dec")
+}
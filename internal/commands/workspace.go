@@ -0,0 +1,62 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/teamcurri/puff/internal/config"
+)
+
+// rootReport is one config root's report in the JSON output of a workspace
+type rootReport struct {
+	Root   string      `json:"root"`
+	Report interface{} `json:"report"`
+}
+
+// workspaceReport is the JSON output of a report run across a workspace
+type workspaceReport struct {
+	Roots []rootReport `json:"roots"`
+}
+
+// forEachRoot runs a report on the config root or, if rootDir is a workspace
+// listing several roots in its .puff.yaml, on each of them in turn. run prints
+// its own text output and returns the report printed as JSON and whether it
+// found a problem; forEachRoot reports whether any root did.
+func forEachRoot(rootDir string, asJSON bool, what string, run func(rootDir string) (interface{}, bool, error)) (bool, error) {
+	roots, err := config.WorkspaceRoots(rootDir)
+	if err != nil {
+		return false, err
+	}
+	if roots == nil {
+		report, failed, err := run(rootDir)
+		if err != nil {
+			return false, err
+		}
+		if asJSON {
+			return failed, printJSON(report, what)
+		}
+		return failed, nil
+	}
+
+	anyFailed := false
+	workspace := workspaceReport{Roots: []rootReport{}}
+	for i, root := range roots {
+		name := relativeSource(rootDir, root)
+		if !asJSON {
+			if i > 0 {
+				fmt.Println()
+			}
+			color.Cyan("== %s ==", name)
+		}
+		report, failed, err := run(root)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", name, err)
+		}
+		anyFailed = anyFailed || failed
+		workspace.Roots = append(workspace.Roots, rootReport{Root: name, Report: report})
+	}
+	if asJSON {
+		return anyFailed, printJSON(workspace, what)
+	}
+	return anyFailed, nil
+}
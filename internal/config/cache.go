@@ -0,0 +1,123 @@
+package config
+
+import (
+	"crypto/sha256"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileCache holds the parsed contents of config files so that loading several
+// contexts that share files (e.g. base/shared.yml for every app) only reads
+// and decrypts each file once. An entry is discarded when the file's size or
+// modification time changes. Files read with LoadContext.ReadFile, such as
+// past revisions, are keyed by their contents, so a file that is the same in
+// two revisions is decrypted once. A FileCache is safe for concurrent use,
+// and a file loaded by several goroutines at once is decrypted by only one.
+type FileCache struct {
+	mu    sync.Mutex
+	files map[cacheKey]*cachedFile
+}
+
+// cacheKey identifies a cached file
+type cacheKey struct {
+	path string
+	// sum is the SHA-256 of the contents of a file read with
+	// LoadContext.ReadFile. It is zero for files on disk, which are checked
+	// by size and modification time instead.
+	sum [sha256.Size]byte
+}
+
+// cachedFile is a parsed file along with the stat info it was parsed at
+type cachedFile struct {
+	ready   chan struct{} // Closed once values and err are set
+	values  map[string]interface{}
+	err     error
+	size    int64
+	modTime time.Time
+}
+
+// NewFileCache creates an empty FileCache
+func NewFileCache() *FileCache {
+	return &FileCache{
+		files: make(map[cacheKey]*cachedFile),
+	}
+}
+
+// file returns a copy of the values of a file on disk, parsing it unless it
+// is cached and unchanged. A copy is returned because merging modifies
+// nested maps in place.
+func (fc *FileCache) file(path string, decrypt func([]byte) ([]byte, error)) (map[string]interface{}, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return fc.load(cacheKey{path: path}, info.Size(), info.ModTime(), func() (map[string]interface{}, error) {
+		return parseFile(path, decrypt)
+	})
+}
+
+// data returns a copy of the values of a file read with
+// LoadContext.ReadFile, parsing it unless the same contents are cached
+func (fc *FileCache) data(path string, data []byte, decrypt func([]byte) ([]byte, error)) (map[string]interface{}, error) {
+	key := cacheKey{path: path, sum: sha256.Sum256(data)}
+	return fc.load(key, int64(len(data)), time.Time{}, func() (map[string]interface{}, error) {
+		return parseData(data, path, decrypt)
+	})
+}
+
+// load returns a copy of the cached values under key, calling parse unless
+// an entry with the same size and modification time is cached or being
+// parsed. Failures aren't cached, so a later load tries again.
+func (fc *FileCache) load(key cacheKey, size int64, modTime time.Time, parse func() (map[string]interface{}, error)) (map[string]interface{}, error) {
+	fc.mu.Lock()
+	entry, ok := fc.files[key]
+	if ok && entry.size == size && entry.modTime.Equal(modTime) {
+		fc.mu.Unlock()
+		<-entry.ready
+	} else {
+		entry = &cachedFile{ready: make(chan struct{}), size: size, modTime: modTime}
+		fc.files[key] = entry
+		fc.mu.Unlock()
+
+		entry.values, entry.err = parse()
+		if entry.err != nil {
+			fc.mu.Lock()
+			if fc.files[key] == entry {
+				delete(fc.files, key)
+			}
+			fc.mu.Unlock()
+		}
+		close(entry.ready)
+	}
+
+	if entry.err != nil {
+		return nil, entry.err
+	}
+	return copyMap(entry.values), nil
+}
+
+// copyMap deep copies a map, including nested maps and slices
+func copyMap(values map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		result[key] = copyValue(value)
+	}
+	return result
+}
+
+// copyValue deep copies a parsed YAML value
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return copyMap(v)
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = copyValue(item)
+		}
+		return result
+	default:
+		return v
+	}
+}
@@ -3,10 +3,10 @@ package config
 import (
 	"fmt"
 	"os"
-	"path/filepath"
 	"sync"
 
 	"github.com/getsops/sops/v3/decrypt"
+	"github.com/teamcurri/puff/internal/parallel"
 	"gopkg.in/yaml.v3"
 )
 
@@ -14,9 +14,17 @@ import (
 // Config is safe for concurrent read access via Get methods,
 // but Load() should not be called concurrently.
 type Config struct {
-	Values map[string]interface{}
-	mu     sync.RWMutex
-	files  []string // Track which files contributed to this config
+	Values      map[string]interface{}
+	mu          sync.RWMutex
+	files       []string                // Track which files contributed to this config
+	sources     map[string]string       // Track which file each top-level key came from
+	definitions map[string][]Definition // Track every file that defines each top-level key
+}
+
+// Definition is the value a single file gives a key
+type Definition struct {
+	File  string
+	Value interface{}
 }
 
 // LoadContext defines the parameters for loading config
@@ -25,13 +33,63 @@ type LoadContext struct {
 	App     string
 	Env     string
 	Target  string
+
+	// Dimensions holds the values of the extra precedence dimensions
+	// declared in .puff.yaml, such as a region, keyed by dimension name
+	Dimensions map[string]string
+
+	// Cache, if set, is used to avoid re-reading and re-decrypting files
+	// shared between several loads
+	Cache *FileCache
+
+	// NoHostEnv disables ${env:NAME} template references to the invoking
+	// process's environment, for hermetic builds
+	NoHostEnv bool
+
+	// LookupHostEnv, if set, is used for ${env:NAME} references instead of
+	// this process's environment, e.g. when an agent resolves for a client
+	LookupHostEnv func(name string) (string, bool)
+
+	// ReadFile, if set, reads config files and .puff.yaml instead of the
+	// file system, e.g. to load them from a past git revision. Missing files
+	// must yield an error satisfying os.IsNotExist. With Cache, files are
+	// cached by their contents.
+	ReadFile func(path string) ([]byte, error)
+
+	// Decrypt, if set, decrypts SOPS-encrypted files instead of SOPS's own
+	// key lookup, e.g. with an identity that applies to this load only. A
+	// Cache shouldn't be shared between contexts with different Decrypt.
+	Decrypt func(data []byte) ([]byte, error)
+}
+
+// readFile reads a file with ctx.ReadFile, or from the file system
+func (ctx LoadContext) readFile(path string) ([]byte, error) {
+	if ctx.ReadFile != nil {
+		return ctx.ReadFile(path)
+	}
+	return os.ReadFile(path)
+}
+
+// existingVariant returns file, or the same file with the other extension
+// (.yml or .yaml) if only that one exists
+func (ctx LoadContext) existingVariant(file string) string {
+	return existingVariant(file, func(file string) bool {
+		if ctx.ReadFile != nil {
+			_, err := ctx.ReadFile(file)
+			return err == nil
+		}
+		_, err := os.Stat(file)
+		return err == nil
+	})
 }
 
 // New creates a new empty Config
 func New() *Config {
 	return &Config{
-		Values: make(map[string]interface{}),
-		files:  make([]string, 0),
+		Values:      make(map[string]interface{}),
+		files:       make([]string, 0),
+		sources:     make(map[string]string),
+		definitions: make(map[string][]Definition),
 	}
 }
 
@@ -43,75 +101,184 @@ func New() *Config {
 // 4. {env}/{app}.yml
 // 5. target-overrides/{target}/shared.yml
 // 6. target-overrides/{target}/{app}.yml
+//
+// Dimensions declared in .puff.yaml add their shared and app files directly
+// after the base, env, or target layers.
 func Load(ctx LoadContext) (*Config, error) {
 	cfg := New()
 
-	// Build list of files to load in precedence order
+	filesToLoad, err := Chain(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read and decrypt the files in parallel, then merge them in order
+	values := make([]map[string]interface{}, len(filesToLoad))
+	err = parallel.Each(len(filesToLoad), func(i int) error {
+		fileValues, err := readValues(filesToLoad[i], ctx)
+		if err != nil {
+			// If file doesn't exist, that's okay - just skip it
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return fmt.Errorf("error loading %s: %w", filesToLoad[i], err)
+		}
+		values[i] = fileValues
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, file := range filesToLoad {
+		if values[i] != nil {
+			cfg.mergeFile(file, values[i])
+		}
+	}
+
+	return cfg, nil
+}
+
+// Chain returns the files that make up the config for ctx in precedence
+// order (see Load), whether or not they exist
+func Chain(ctx LoadContext) ([]string, error) {
+	project, err := loadProject(ctx.RootDir, ctx.readFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := project.checkValues(ctx.Dimensions); err != nil {
+		return nil, err
+	}
+
+	// Build list of files to load in precedence order. The files are laid
+	// out as .puff.yaml maps them, with the standard layout shown here.
 	filesToLoad := []string{}
+	levelFile := func(app, env, target string) string {
+		return ctx.existingVariant(project.levelFile(ctx.RootDir, Level{App: app, Env: env, Target: target}))
+	}
 
 	// 1. base/shared.yml
-	filesToLoad = append(filesToLoad, filepath.Join(ctx.RootDir, "base", "shared.yml"))
+	filesToLoad = append(filesToLoad, levelFile("", "", ""))
 
 	// 2. base/{app}.yml
 	if ctx.App != "" {
-		filesToLoad = append(filesToLoad, filepath.Join(ctx.RootDir, "base", fmt.Sprintf("%s.yml", ctx.App)))
+		filesToLoad = append(filesToLoad, levelFile(ctx.App, "", ""))
 	}
+	filesToLoad = append(filesToLoad, project.layerFiles(ctx, AfterBase)...)
 
 	// 3. {env}/shared.yml
 	if ctx.Env != "" {
-		filesToLoad = append(filesToLoad, filepath.Join(ctx.RootDir, ctx.Env, "shared.yml"))
+		filesToLoad = append(filesToLoad, levelFile("", ctx.Env, ""))
 	}
 
 	// 4. {env}/{app}.yml
 	if ctx.Env != "" && ctx.App != "" {
-		filesToLoad = append(filesToLoad, filepath.Join(ctx.RootDir, ctx.Env, fmt.Sprintf("%s.yml", ctx.App)))
+		filesToLoad = append(filesToLoad, levelFile(ctx.App, ctx.Env, ""))
 	}
+	filesToLoad = append(filesToLoad, project.layerFiles(ctx, AfterEnv)...)
 
-	// 5. target-overrides/{target}/{env}/shared.yml
+	// 5. target-overrides/{target}/{env}/shared.yml, with the "base"
+	// directory if no env is given
 	if ctx.Target != "" {
-		targetEnv := ctx.Env
-		if targetEnv == "" {
-			targetEnv = "base"
-		}
-		filesToLoad = append(filesToLoad, filepath.Join(ctx.RootDir, "target-overrides", ctx.Target, targetEnv, "shared.yml"))
+		filesToLoad = append(filesToLoad, levelFile("", ctx.Env, ctx.Target))
 	}
 
 	// 6. target-overrides/{target}/{env}/{app}.yml
 	if ctx.Target != "" && ctx.App != "" {
-		targetEnv := ctx.Env
-		if targetEnv == "" {
-			targetEnv = "base"
+		filesToLoad = append(filesToLoad, levelFile(ctx.App, ctx.Env, ctx.Target))
+	}
+	filesToLoad = append(filesToLoad, project.layerFiles(ctx, AfterTarget)...)
+
+	// Split levels load their plaintext store first, so secrets win
+	if project.Stores.Split {
+		withPlain := make([]string, 0, 2*len(filesToLoad))
+		for _, file := range filesToLoad {
+			withPlain = append(withPlain, ctx.existingVariant(plainStore(file)), file)
 		}
-		filesToLoad = append(filesToLoad, filepath.Join(ctx.RootDir, "target-overrides", ctx.Target, targetEnv, fmt.Sprintf("%s.yml", ctx.App)))
+		filesToLoad = withPlain
 	}
 
-	// Load and merge each file
-	for _, file := range filesToLoad {
-		if err := cfg.loadFile(file); err != nil {
-			// If file doesn't exist, that's okay - just skip it
-			if !os.IsNotExist(err) {
-				return nil, fmt.Errorf("error loading %s: %w", file, err)
+	return filesToLoad, nil
+}
+
+// Sources returns the file that provides each top-level key of the config
+// for ctx. SOPS leaves key names in plain text, so nothing is decrypted.
+func Sources(ctx LoadContext) (map[string]string, error) {
+	files, err := Chain(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make(map[string]string)
+	for _, file := range files {
+		data, err := ctx.readFile(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", file, err)
+		}
+
+		var values map[string]yaml.Node
+		if err := yaml.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("error parsing YAML in %s: %w", file, err)
+		}
+		for key := range values {
+			if key != "sops" {
+				sources[key] = file
 			}
 		}
 	}
 
-	return cfg, nil
+	return sources, nil
 }
 
-// loadFile loads a single YAML file and merges it into the config
-// If the file is SOPS-encrypted, it will be decrypted automatically
-func (c *Config) loadFile(path string) error {
+// readValues reads a single YAML file, decrypting it if it is SOPS-encrypted,
+// with ctx.ReadFile if it is set, and through ctx.Cache if that is set
+func readValues(path string, ctx LoadContext) (map[string]interface{}, error) {
+	if ctx.Cache != nil && ctx.ReadFile == nil {
+		return ctx.Cache.file(path, ctx.Decrypt)
+	}
+
+	data, err := ctx.readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Cache != nil {
+		return ctx.Cache.data(path, data, ctx.Decrypt)
+	}
+	return parseData(data, path, ctx.Decrypt)
+}
+
+// parseFile reads a single YAML file, decrypting it if it is SOPS-encrypted,
+// with decryptFn if it is set, and returns its values without the SOPS metadata
+func parseFile(path string, decryptFn func([]byte) ([]byte, error)) (map[string]interface{}, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return parseData(data, path, decryptFn)
+}
+
+// ParseData parses the contents of a config file, such as a past revision of
+// it, decrypting it if it is SOPS-encrypted. path is used in errors.
+func ParseData(data []byte, path string) (map[string]interface{}, error) {
+	return parseData(data, path, nil)
+}
+
+// parseData is ParseData, decrypting with decryptFn if it is set
+func parseData(data []byte, path string, decryptFn func([]byte) ([]byte, error)) (map[string]interface{}, error) {
+	if decryptFn == nil {
+		decryptFn = func(data []byte) ([]byte, error) {
+			return decrypt.Data(data, "yaml")
+		}
 	}
 
 	// Try to detect and decrypt SOPS-encrypted files
 	// SOPS files contain "sops:" in the YAML structure
 	if isSopsEncrypted(data) {
-		decrypted, err := decrypt.File(path, "yaml")
+		decrypted, err := decryptFn(data)
 		if err != nil {
-			return fmt.Errorf("error decrypting SOPS file %s: %w", path, err)
+			return nil, fmt.Errorf("error decrypting SOPS file %s: %w", path, err)
 		}
 		data = decrypted
 	}
@@ -119,21 +286,36 @@ func (c *Config) loadFile(path string) error {
 	// Parse YAML once
 	var values map[string]interface{}
 	if err := yaml.Unmarshal(data, &values); err != nil {
-		return fmt.Errorf("error parsing YAML in %s: %w", path, err)
+		return nil, fmt.Errorf("error parsing YAML in %s: %w", path, err)
 	}
 
 	// Remove the 'sops' metadata key if it exists (shouldn't be merged into config)
 	delete(values, "sops")
 
+	return values, nil
+}
+
+// mergeFile merges the values of a single file into the config and records
+// the file as their source
+func (c *Config) mergeFile(path string, values map[string]interface{}) {
+	// Record each file's own values before merging, which updates nested
+	// maps in place
+	c.mu.Lock()
+	for key, value := range values {
+		c.definitions[key] = append(c.definitions[key], Definition{File: path, Value: copyValue(value)})
+	}
+	c.mu.Unlock()
+
 	// Merge the values
 	c.merge(values)
 
-	// Protect files slice access with mutex
+	// Protect files slice and sources map access with mutex
 	c.mu.Lock()
 	c.files = append(c.files, path)
+	for key := range values {
+		c.sources[key] = path
+	}
 	c.mu.Unlock()
-
-	return nil
 }
 
 // isSopsEncrypted checks if data contains SOPS metadata using a simple heuristic
@@ -258,3 +440,22 @@ func (c *Config) Files() []string {
 	// Return a copy to prevent external modification
 	return append([]string(nil), c.files...)
 }
+
+// Source returns the file that provided the final value of the given key.
+// Later files in the precedence order override earlier ones, so this is the
+// highest-precedence file that defines the key.
+func (c *Config) Source(key string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	source, ok := c.sources[key]
+	return source, ok
+}
+
+// Definitions returns every file that defines the given key with the value
+// it gives, in precedence order. The last definition is the one that wins,
+// apart from nested maps, which are merged.
+func (c *Config) Definitions(key string) []Definition {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]Definition(nil), c.definitions[key]...)
+}
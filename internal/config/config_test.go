@@ -1,9 +1,13 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestLoad(t *testing.T) {
@@ -88,6 +92,134 @@ func TestLoad(t *testing.T) {
 	}
 }
 
+func TestSource(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "puff-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	os.MkdirAll(filepath.Join(tmpDir, "base"), 0755)
+	os.MkdirAll(filepath.Join(tmpDir, "dev"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "base", "shared.yml"), []byte("GLOBAL: base\nOVERRIDE: base"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "dev", "api.yml"), []byte("OVERRIDE: dev_api"), 0644)
+
+	cfg, err := Load(LoadContext{RootDir: tmpDir, App: "api", Env: "dev"})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	tests := []struct {
+		key      string
+		expected string
+	}{
+		{"GLOBAL", filepath.Join(tmpDir, "base", "shared.yml")},
+		{"OVERRIDE", filepath.Join(tmpDir, "dev", "api.yml")},
+	}
+
+	for _, tt := range tests {
+		if source, ok := cfg.Source(tt.key); !ok || source != tt.expected {
+			t.Errorf("Key %s: expected source %s, got %s (exists: %v)", tt.key, tt.expected, source, ok)
+		}
+	}
+
+	if _, ok := cfg.Source("MISSING"); ok {
+		t.Error("Expected no source for missing key")
+	}
+}
+
+func TestLoadWithCache(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "puff-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	os.MkdirAll(filepath.Join(tmpDir, "base"), 0755)
+	os.MkdirAll(filepath.Join(tmpDir, "dev"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "base", "shared.yml"), []byte("DB:\n  host: base\n  port: 5432"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "dev", "api.yml"), []byte("DB:\n  host: api"), 0644)
+
+	cache := NewFileCache()
+
+	apiCfg, err := Load(LoadContext{RootDir: tmpDir, App: "api", Env: "dev", Cache: cache})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if db := apiCfg.Values["DB"].(map[string]interface{}); db["host"] != "api" {
+		t.Errorf("Expected api DB host, got %v", db["host"])
+	}
+
+	// Rewrite the shared file with the same size and modification time, so
+	// the second load can only see the old content through the cache
+	sharedPath := filepath.Join(tmpDir, "base", "shared.yml")
+	info, _ := os.Stat(sharedPath)
+	os.WriteFile(sharedPath, []byte("DB:\n  host: BASE\n  port: 5432"), 0644)
+	os.Chtimes(sharedPath, info.ModTime(), info.ModTime())
+
+	workerCfg, err := Load(LoadContext{RootDir: tmpDir, App: "worker", Env: "dev", Cache: cache})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	db, ok := workerCfg.Values["DB"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Expected DB from cached base/shared.yml")
+	}
+	// Merging api.yml into the first load must not leak into the cached values
+	if db["host"] != "base" || db["port"] != 5432 {
+		t.Errorf("Expected cached base DB values, got %v", db)
+	}
+
+	// Changing the file invalidates the cached entry
+	os.WriteFile(sharedPath, []byte("DB:\n  host: changed"), 0644)
+
+	workerCfg, err = Load(LoadContext{RootDir: tmpDir, App: "worker", Env: "dev", Cache: cache})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if db := workerCfg.Values["DB"].(map[string]interface{}); db["host"] != "changed" {
+		t.Errorf("Expected changed file to be re-read, got %v", db)
+	}
+}
+
+func TestLoadWithReadFile(t *testing.T) {
+	root := filepath.Join("config", "root")
+	files := map[string]string{
+		ProjectFile:         "dimensions:\n  - name: region",
+		"base/shared.yml":   "LEVEL: base",
+		"prod/api.yml":      "LEVEL: prod",
+		"region/eu/api.yml": "LEVEL: region",
+	}
+	readFile := func(path string) ([]byte, error) {
+		rel, _ := filepath.Rel(root, path)
+		content, ok := files[filepath.ToSlash(rel)]
+		if !ok {
+			return nil, &os.PathError{Op: "read", Path: path, Err: os.ErrNotExist}
+		}
+		return []byte(content), nil
+	}
+
+	// Files and .puff.yaml come from ReadFile, not the file system
+	cfg, err := Load(LoadContext{RootDir: root, App: "api", Env: "prod", Dimensions: map[string]string{"region": "eu"}, ReadFile: readFile})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if level, _ := cfg.GetString("LEVEL"); level != "region" {
+		t.Errorf("Expected LEVEL from the region layer, got %q", level)
+	}
+	if len(cfg.Files()) != 3 {
+		t.Errorf("Expected 3 files, got %v", cfg.Files())
+	}
+
+	sources, err := Sources(LoadContext{RootDir: root, App: "api", Env: "prod", ReadFile: readFile})
+	if err != nil {
+		t.Fatalf("Sources failed: %v", err)
+	}
+	if sources["LEVEL"] != filepath.Join(root, "prod", "api.yml") {
+		t.Errorf("Unexpected source: %v", sources)
+	}
+}
+
 func TestMerge(t *testing.T) {
 	cfg := New()
 
@@ -146,3 +278,99 @@ func TestExportKeys(t *testing.T) {
 		t.Errorf("Expected 2 public variables in export keys, got %d", foundPublic)
 	}
 }
+
+func TestDefinitions(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "puff-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	os.MkdirAll(filepath.Join(tmpDir, "base"), 0755)
+	os.MkdirAll(filepath.Join(tmpDir, "dev"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "base", "shared.yml"), []byte("PORT: 80\nDB:\n  host: base"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "dev", "api.yml"), []byte("PORT: 8080\nDB:\n  name: dev"), 0644)
+
+	cfg, err := Load(LoadContext{RootDir: tmpDir, App: "api", Env: "dev"})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	definitions := cfg.Definitions("PORT")
+	if len(definitions) != 2 ||
+		definitions[0].File != filepath.Join(tmpDir, "base", "shared.yml") || definitions[0].Value != 80 ||
+		definitions[1].File != filepath.Join(tmpDir, "dev", "api.yml") || definitions[1].Value != 8080 {
+		t.Errorf("Unexpected definitions: %v", definitions)
+	}
+
+	// Each definition keeps the file's own value of a merged map
+	db := cfg.Definitions("DB")
+	if len(db) != 2 || len(db[0].Value.(map[string]interface{})) != 1 {
+		t.Errorf("Unexpected definitions: %v", db)
+	}
+
+	if len(cfg.Definitions("MISSING")) != 0 {
+		t.Error("Expected no definitions for a missing key")
+	}
+}
+
+func TestFileCacheDecryptsOnce(t *testing.T) {
+	cache := NewFileCache()
+
+	// Concurrent loads of the same file wait for a single parse
+	var parses atomic.Int32
+	parse := func() (map[string]interface{}, error) {
+		parses.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		return map[string]interface{}{"KEY": "value"}, nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			values, err := cache.load(cacheKey{path: "shared.yml"}, 1, time.Time{}, parse)
+			if err != nil || values["KEY"] != "value" {
+				t.Errorf("Expected cached values, got %v (%v)", values, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := parses.Load(); n != 1 {
+		t.Errorf("Expected one parse, got %d", n)
+	}
+
+	// Files read with ReadFile are cached by their contents
+	reads := 0
+	contents := "KEY: old"
+	ctx := LoadContext{Cache: cache, ReadFile: func(path string) ([]byte, error) {
+		reads++
+		return []byte(contents), nil
+	}}
+	for i := 0; i < 2; i++ {
+		values, err := readValues("base/shared.yml", ctx)
+		if err != nil || values["KEY"] != "old" {
+			t.Fatalf("Expected old value, got %v (%v)", values, err)
+		}
+		values["KEY"] = "modified"
+	}
+	if len(cache.files) != 2 {
+		t.Errorf("Expected the same contents to share an entry, got %d entries", len(cache.files))
+	}
+	contents = "KEY: new"
+	if values, err := readValues("base/shared.yml", ctx); err != nil || values["KEY"] != "new" {
+		t.Errorf("Expected new contents to be parsed, got %v (%v)", values, err)
+	}
+	if reads != 3 {
+		t.Errorf("Expected ReadFile to be called for every load, got %d", reads)
+	}
+
+	// Failures aren't cached
+	failing := func() (map[string]interface{}, error) { return nil, fmt.Errorf("failed to decrypt") }
+	if _, err := cache.load(cacheKey{path: "broken.yml"}, 1, time.Time{}, failing); err == nil {
+		t.Error("Expected the parse error")
+	}
+	if values, err := cache.load(cacheKey{path: "broken.yml"}, 1, time.Time{}, parse); err != nil || values["KEY"] != "value" {
+		t.Errorf("Expected a failed file to be parsed again, got %v (%v)", values, err)
+	}
+}
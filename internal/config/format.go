@@ -0,0 +1,75 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/teamcurri/puff/internal/safefile"
+)
+
+// CurrentFormat is the repository format written by init. Raise it along
+// with a migration in 'puff migrate' when the layout or metadata of
+// repositories changes incompatibly.
+const CurrentFormat = 1
+
+// formatLineRegex matches the top-level format setting of .puff.yaml
+var formatLineRegex = regexp.MustCompile(`(?m)^format:[^\n]*`)
+
+// checkFormat rejects repositories written by a newer puff, which this one
+// could misread or damage
+func checkFormat(format int) error {
+	switch {
+	case format < 0:
+		return fmt.Errorf("%d is not a format version", format)
+	case format > CurrentFormat:
+		return fmt.Errorf("the repository uses format %d, but this version of puff only supports up to format %d; upgrade puff", format, CurrentFormat)
+	}
+	return nil
+}
+
+// WriteFormat records the repository format in the .puff.yaml of the config
+// root, creating the file if needed. The rest of the file is left as it is.
+func WriteFormat(rootDir string, format int) error {
+	path := filepath.Join(rootDir, ProjectFile)
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read %s: %w", ProjectFile, err)
+	}
+
+	line := fmt.Sprintf("format: %d", format)
+	content := string(data)
+	switch {
+	case formatLineRegex.MatchString(content):
+		replaced := false
+		content = formatLineRegex.ReplaceAllStringFunc(content, func(match string) string {
+			if replaced {
+				return match
+			}
+			replaced = true
+			return line
+		})
+	case strings.TrimSpace(content) == "":
+		content = "# Puff project configuration\n" + line + "\n"
+	default:
+		// Keep a leading comment block at the top of the file
+		lines := strings.SplitAfter(content, "\n")
+		i := 0
+		for i < len(lines) && strings.HasPrefix(lines[i], "#") {
+			i++
+		}
+		if i > 0 && !strings.HasSuffix(lines[i-1], "\n") {
+			lines[i-1] += "\n"
+		}
+		content = strings.Join(lines[:i], "") + line + "\n" + strings.Join(lines[i:], "")
+	}
+
+	if err := safefile.Write(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", ProjectFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,514 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Layout describes the apps, environments, and targets found in a config directory
+type Layout struct {
+	Apps    []string
+	Envs    []string
+	Targets []string
+}
+
+// Discover scans the directory structure under rootDir and returns the apps,
+// environments, and targets it contains. The "base" directory and the shared
+// files are part of every context, so they are not reported as an env or app.
+// Directories holding the dimensions declared in .puff.yaml, and the audit log
+// when it is enabled, aren't envs either.
+func Discover(rootDir string) (*Layout, error) {
+	entries, err := os.ReadDir(rootDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", rootDir, err)
+	}
+
+	project, err := LoadProject(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	if project.Layout.Custom() {
+		return discoverLevels(rootDir, project)
+	}
+	dimensionDirs := project.TopLevelDirs()
+	if project.Audit.Enabled {
+		dimensionDirs[AuditDir] = true
+	}
+
+	apps := make(map[string]bool)
+	envs := make(map[string]bool)
+	targets := make(map[string]bool)
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || strings.HasPrefix(name, ".") || dimensionDirs[name] {
+			continue
+		}
+
+		switch name {
+		case "base":
+			if err := project.collectApps(filepath.Join(rootDir, name), apps); err != nil {
+				return nil, err
+			}
+		case "target-overrides":
+			targetEntries, err := os.ReadDir(filepath.Join(rootDir, name))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", name, err)
+			}
+			for _, targetEntry := range targetEntries {
+				if !targetEntry.IsDir() || strings.HasPrefix(targetEntry.Name(), ".") {
+					continue
+				}
+				targets[targetEntry.Name()] = true
+
+				targetDir := filepath.Join(rootDir, name, targetEntry.Name())
+				envEntries, err := os.ReadDir(targetDir)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read %s: %w", targetDir, err)
+				}
+				for _, envEntry := range envEntries {
+					if !envEntry.IsDir() || strings.HasPrefix(envEntry.Name(), ".") {
+						continue
+					}
+					if envEntry.Name() != "base" {
+						envs[envEntry.Name()] = true
+					}
+					if err := project.collectApps(filepath.Join(targetDir, envEntry.Name()), apps); err != nil {
+						return nil, err
+					}
+				}
+			}
+		default:
+			envs[name] = true
+			if err := project.collectApps(filepath.Join(rootDir, name), apps); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &Layout{
+		Apps:    sortedKeys(apps),
+		Envs:    sortedKeys(envs),
+		Targets: sortedKeys(targets),
+	}, nil
+}
+
+// AppsInEnv returns the apps that have a config file in any directory that
+// contributes to the given environment and (optional) target: base/, the
+// environment directory, and the target's base and environment overrides.
+func AppsInEnv(rootDir, env, target string) ([]string, error) {
+	project, err := LoadProject(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	if project.Layout.Custom() {
+		levels, err := fileLevels(rootDir, project)
+		if err != nil {
+			return nil, err
+		}
+		return appsInLevels(levels, env, target), nil
+	}
+
+	dirs := []string{
+		filepath.Join(rootDir, "base"),
+		filepath.Join(rootDir, env),
+	}
+	if target != "" {
+		dirs = append(dirs,
+			filepath.Join(rootDir, "target-overrides", target, "base"),
+			filepath.Join(rootDir, "target-overrides", target, env),
+		)
+	}
+
+	apps := make(map[string]bool)
+	for _, dir := range dirs {
+		if err := project.collectApps(dir, apps); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	return sortedKeys(apps), nil
+}
+
+// AppsInFiles returns the apps that have config for an environment and
+// optional target among files, given by their paths relative to the config
+// root, such as the files of a git revision
+func AppsInFiles(project *Project, files []string, env, target string) []string {
+	var levels []Level
+	for _, file := range files {
+		if level, ok := project.FileLevel(file); ok && level.Dimension == "" {
+			levels = append(levels, level)
+		}
+	}
+	return appsInLevels(levels, env, target)
+}
+
+// appsInLevels returns the apps of the levels that are part of an
+// environment and optional target
+func appsInLevels(levels []Level, env, target string) []string {
+	apps := make(map[string]bool)
+	for _, level := range levels {
+		if level.App != "" && (level.Env == "" || level.Env == env) && (level.Target == "" || level.Target == target) {
+			apps[level.App] = true
+		}
+	}
+	return sortedKeys(apps)
+}
+
+// discoverLevels returns the apps, environments, and targets of the config
+// files of a custom layout
+func discoverLevels(rootDir string, project *Project) (*Layout, error) {
+	levels, err := fileLevels(rootDir, project)
+	if err != nil {
+		return nil, err
+	}
+
+	apps := make(map[string]bool)
+	envs := make(map[string]bool)
+	targets := make(map[string]bool)
+	for _, level := range levels {
+		if level.App != "" {
+			apps[level.App] = true
+		}
+		if level.Env != "" {
+			envs[level.Env] = true
+		}
+		if level.Target != "" {
+			targets[level.Target] = true
+		}
+	}
+
+	return &Layout{
+		Apps:    sortedKeys(apps),
+		Envs:    sortedKeys(envs),
+		Targets: sortedKeys(targets),
+	}, nil
+}
+
+// fileLevels returns the levels of the config files under rootDir, other
+// than those of dimension layers and the audit log. Hidden directories are
+// skipped.
+func fileLevels(rootDir string, project *Project) ([]Level, error) {
+	skipped := project.TopLevelDirs()
+	if project.Audit.Enabled {
+		skipped[AuditDir] = true
+	}
+
+	var levels []Level
+	err := filepath.WalkDir(rootDir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(rootDir, file)
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if file != rootDir && (strings.HasPrefix(entry.Name(), ".") || skipped[filepath.ToSlash(rel)]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if level, ok := project.FileLevel(rel); ok && level.Dimension == "" {
+			levels = append(levels, level)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", rootDir, err)
+	}
+	return levels, nil
+}
+
+// collectApps adds the app names of all config files in dir to apps
+func (p *Project) collectApps(dir string, apps map[string]bool) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !IsConfigFileName(name) {
+			continue
+		}
+		app := TrimConfigExt(name)
+		if p.Stores.Split {
+			app = strings.TrimSuffix(app, PlainStoreSuffix)
+		}
+		if app != "shared" {
+			apps[app] = true
+		}
+	}
+
+	return nil
+}
+
+// Level is the place of a config file in the precedence hierarchy
+type Level struct {
+	// App is empty for shared.yml
+	App string
+	// Env is empty for the base layer
+	Env    string
+	Target string
+	// Dimension and Value are set for the layers of dimensions declared in
+	// .puff.yaml
+	Dimension string
+	Value     string
+	// Plain is set for the plaintext store of a level, when .puff.yaml
+	// splits levels into stores
+	Plain bool
+}
+
+// String describes the layer, such as "base", "env=dev", or
+// "target=aws env=prod"
+func (l Level) String() string {
+	var parts []string
+	if l.Dimension != "" {
+		parts = append(parts, l.Dimension+"="+l.Value)
+	}
+	if l.Target != "" {
+		parts = append(parts, "target="+l.Target)
+	}
+	if l.Env != "" {
+		parts = append(parts, "env="+l.Env)
+	}
+	if len(parts) == 0 {
+		return "base"
+	}
+	return strings.Join(parts, " ")
+}
+
+// IsConfigFileName reports whether a file name is that of a config file: a
+// .yml or .yaml file other than a hidden file, such as .sops.yaml, or a
+// decrypted .dec copy
+func IsConfigFileName(name string) bool {
+	if strings.HasPrefix(name, ".") || strings.Contains(name, ".dec.") {
+		return false
+	}
+	ext := path.Ext(name)
+	return (ext == ".yml" || ext == ".yaml") && len(name) > len(ext)
+}
+
+// TrimConfigExt removes the .yml or .yaml extension from a file name or path
+func TrimConfigExt(name string) string {
+	if ext := path.Ext(name); ext == ".yml" || ext == ".yaml" {
+		return strings.TrimSuffix(name, ext)
+	}
+	return name
+}
+
+// LevelFile returns the config file of a level. If only a file with the other
+// extension (.yml or .yaml) exists, that file is returned.
+func (p *Project) LevelFile(rootDir string, level Level) string {
+	return existingVariant(p.levelFile(rootDir, level), func(file string) bool {
+		_, err := os.Stat(file)
+		return err == nil
+	})
+}
+
+// levelFile returns the config file of a level, with the extension new files
+// get. The level's dimension must be declared.
+func (p *Project) levelFile(rootDir string, level Level) string {
+	name := "shared"
+	if level.App != "" {
+		name = level.App
+	}
+	if level.Dimension != "" {
+		file := filepath.Join(p.Dimension(level.Dimension).Path(rootDir, level.Env, level.Value), name+p.Layout.extension())
+		if level.Plain {
+			return plainStore(file)
+		}
+		return file
+	}
+
+	env := level.Env
+	if env == "" {
+		env = "base"
+	}
+	patterns := p.Layout.patterns()
+	var pattern string
+	switch {
+	case level.Target != "" && level.App != "":
+		pattern = patterns[1].pattern
+	case level.Target != "":
+		pattern = patterns[0].pattern
+	case level.App != "":
+		pattern = patterns[3].pattern
+	default:
+		pattern = patterns[2].pattern
+	}
+	file := strings.NewReplacer("{app}", level.App, "{env}", env, "{target}", level.Target).Replace(pattern)
+	file = filepath.Join(rootDir, filepath.FromSlash(file))
+	if level.Plain {
+		return plainStore(file)
+	}
+	return file
+}
+
+// plainStore returns the plaintext store of a level's encrypted file
+func plainStore(file string) string {
+	return TrimConfigExt(file) + PlainStoreSuffix + filepath.Ext(file)
+}
+
+// IsPlainStore reports whether a file is the plaintext store of a level in
+// a config root that splits its levels into stores. The config root is the
+// nearest directory above the file holding .sops.yaml.
+func IsPlainStore(file string) (bool, error) {
+	if !strings.HasSuffix(TrimConfigExt(filepath.Base(file)), PlainStoreSuffix) {
+		return false, nil
+	}
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return false, err
+	}
+	for dir := filepath.Dir(absFile); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, ".sops.yaml")); err == nil {
+			project, err := LoadProject(dir)
+			if err != nil || !project.Stores.Split {
+				return false, err
+			}
+			rel, err := filepath.Rel(dir, absFile)
+			if err != nil {
+				return false, err
+			}
+			level, ok := project.FileLevel(rel)
+			return ok && level.Plain, nil
+		}
+		if filepath.Dir(dir) == dir {
+			return false, nil
+		}
+	}
+}
+
+// existingVariant returns file, or the same file with the other extension
+// (.yml or .yaml) if only that one exists
+func existingVariant(file string, exists func(string) bool) string {
+	if exists(file) {
+		return file
+	}
+	other := TrimConfigExt(file) + ".yaml"
+	if filepath.Ext(file) == ".yaml" {
+		other = TrimConfigExt(file) + ".yml"
+	}
+	if exists(other) {
+		return other
+	}
+	return file
+}
+
+// FileLevel returns the level of a config file, given by its path relative
+// to the config root. It returns false for files outside the hierarchy.
+func (p *Project) FileLevel(relPath string) (Level, bool) {
+	relPath = filepath.ToSlash(relPath)
+	name := path.Base(relPath)
+	if !IsConfigFileName(name) {
+		return Level{}, false
+	}
+	// The plaintext store has the level of the encrypted file beside it
+	plain := p.Stores.Split && strings.HasSuffix(TrimConfigExt(name), PlainStoreSuffix)
+	if plain {
+		name = strings.TrimSuffix(TrimConfigExt(name), PlainStoreSuffix) + path.Ext(name)
+		relPath = path.Join(path.Dir(relPath), name)
+	}
+	level := Level{App: TrimConfigExt(name), Plain: plain}
+	if level.App == "shared" {
+		level.App = ""
+	}
+
+	for _, dim := range p.Dimensions {
+		pattern := regexp.QuoteMeta(dim.Dir)
+		pattern = strings.Replace(pattern, regexp.QuoteMeta("{"+dim.Name+"}"), "(?P<value>[^/]+)", 1)
+		pattern = strings.Replace(pattern, regexp.QuoteMeta("{env}"), "(?P<env>[^/]+)", 1)
+		dirRegex := regexp.MustCompile("^" + pattern + "$")
+		match := dirRegex.FindStringSubmatch(path.Dir(relPath))
+		if match == nil {
+			continue
+		}
+		level.Dimension = dim.Name
+		for i, group := range dirRegex.SubexpNames() {
+			switch group {
+			case "value":
+				level.Value = match[i]
+			case "env":
+				level.Env = baseEnv(match[i])
+			}
+		}
+		return level, true
+	}
+
+	// A placeholder can't take the name of a top-level directory that holds
+	// other files, such as target-overrides or a dimension's layers
+	patterns := p.Layout.patterns()
+	reserved := p.TopLevelDirs()
+	for _, pattern := range patterns {
+		if first := strings.Split(pattern.pattern, "/")[0]; !placeholderRegex.MatchString(first) {
+			reserved[first] = true
+		}
+	}
+	stem := TrimConfigExt(relPath)
+	for _, pattern := range patterns {
+		values, ok := matchPattern(TrimConfigExt(pattern.pattern), stem)
+		if !ok || values["app"] == "shared" {
+			continue
+		}
+		if first := strings.Split(pattern.pattern, "/")[0]; placeholderRegex.MatchString(first) && reserved[strings.Split(stem, "/")[0]] {
+			continue
+		}
+		return Level{App: values["app"], Env: baseEnv(values["env"]), Target: values["target"], Plain: plain}, true
+	}
+	return Level{}, false
+}
+
+// matchPattern matches a path against a layout pattern, both without their
+// extension, and returns the values of the pattern's placeholders
+func matchPattern(pattern, relPath string) (map[string]string, bool) {
+	var expr strings.Builder
+	expr.WriteString("^")
+	last := 0
+	for _, loc := range placeholderRegex.FindAllStringSubmatchIndex(pattern, -1) {
+		expr.WriteString(regexp.QuoteMeta(pattern[last:loc[0]]))
+		expr.WriteString("(?P<" + pattern[loc[2]:loc[3]] + ">[^/]+)")
+		last = loc[1]
+	}
+	expr.WriteString(regexp.QuoteMeta(pattern[last:]) + "$")
+
+	patternRegex := regexp.MustCompile(expr.String())
+	match := patternRegex.FindStringSubmatch(relPath)
+	if match == nil {
+		return nil, false
+	}
+	values := make(map[string]string)
+	for i, group := range patternRegex.SubexpNames() {
+		if group != "" {
+			values[group] = match[i]
+		}
+	}
+	return values, true
+}
+
+// baseEnv returns the environment a directory name stands for: none for
+// "base"
+func baseEnv(env string) string {
+	if env == "base" {
+		return ""
+	}
+	return env
+}
+
+// sortedKeys returns the keys of a set in sorted order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
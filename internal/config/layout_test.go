@@ -0,0 +1,279 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiscover(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "puff-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	files := []string{
+		"base/shared.yml",
+		"base/api.yml",
+		"dev/shared.yml",
+		"dev/worker.yml",
+		"dev/api.dec.yml",
+		"prod/api.yml",
+		"target-overrides/local/base/shared.yml",
+		"target-overrides/local/dev/frontend.yml",
+		"target-overrides/k8s/staging/api.yml",
+		".git/config.yml",
+	}
+	for _, file := range files {
+		path := filepath.Join(tmpDir, file)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("KEY: value"), 0644)
+	}
+
+	layout, err := Discover(tmpDir)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+
+	expected := &Layout{
+		Apps:    []string{"api", "frontend", "worker"},
+		Envs:    []string{"dev", "prod", "staging"},
+		Targets: []string{"k8s", "local"},
+	}
+
+	if !reflect.DeepEqual(layout, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, layout)
+	}
+}
+
+func TestAppsInEnv(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "puff-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	files := []string{
+		"base/shared.yml",
+		"base/api.yml",
+		"dev/worker.yml",
+		"prod/billing.yml",
+		"target-overrides/local/dev/frontend.yml",
+	}
+	for _, file := range files {
+		path := filepath.Join(tmpDir, file)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("KEY: value"), 0644)
+	}
+
+	tests := []struct {
+		env      string
+		target   string
+		expected []string
+	}{
+		{"dev", "", []string{"api", "worker"}},
+		{"dev", "local", []string{"api", "frontend", "worker"}},
+		{"prod", "", []string{"api", "billing"}},
+		{"staging", "", []string{"api"}},
+	}
+
+	for _, tt := range tests {
+		apps, err := AppsInEnv(tmpDir, tt.env, tt.target)
+		if err != nil {
+			t.Fatalf("AppsInEnv(%s, %s) failed: %v", tt.env, tt.target, err)
+		}
+		if !reflect.DeepEqual(apps, tt.expected) {
+			t.Errorf("AppsInEnv(%s, %s): expected %v, got %v", tt.env, tt.target, tt.expected, apps)
+		}
+		// The same files listed from a git revision give the same apps
+		if apps := AppsInFiles(&Project{}, files, tt.env, tt.target); !reflect.DeepEqual(apps, tt.expected) {
+			t.Errorf("AppsInFiles(%s, %s): expected %v, got %v", tt.env, tt.target, tt.expected, apps)
+		}
+	}
+}
+
+func TestFileLevel(t *testing.T) {
+	project := &Project{Dimensions: []Dimension{
+		{Name: "region", Dir: "region/{region}", After: AfterEnv},
+		{Name: "cluster", Dir: "{env}/clusters/{cluster}", After: AfterTarget},
+	}}
+
+	tests := []struct {
+		path     string
+		expected Level
+		level    string
+	}{
+		{"base/shared.yml", Level{}, "base"},
+		{"base/api.yml", Level{App: "api"}, "base"},
+		{"dev/api.yml", Level{App: "api", Env: "dev"}, "env=dev"},
+		{"target-overrides/aws/base/shared.yml", Level{Target: "aws"}, "target=aws"},
+		{"target-overrides/aws/prod/api.yml", Level{App: "api", Env: "prod", Target: "aws"}, "target=aws env=prod"},
+		{"region/eu-west-1/api.yml", Level{App: "api", Dimension: "region", Value: "eu-west-1"}, "region=eu-west-1"},
+		{"prod/clusters/blue/shared.yml", Level{Env: "prod", Dimension: "cluster", Value: "blue"}, "cluster=blue env=prod"},
+		{"dev/worker.yaml", Level{App: "worker", Env: "dev"}, "env=dev"},
+	}
+	for _, tt := range tests {
+		level, ok := project.FileLevel(tt.path)
+		if !ok || level != tt.expected || level.String() != tt.level {
+			t.Errorf("%s: expected %+v (%s), got %+v (%s), %v", tt.path, tt.expected, tt.level, level, level.String(), ok)
+		}
+	}
+
+	for _, path := range []string{"api.yml", "region/api.yml", "dev/nested/api.yml", "dev/notes.txt", "dev/api.dec.yml", "target-overrides/api.yml", "dev/.sops.yaml"} {
+		if level, ok := project.FileLevel(path); ok {
+			t.Errorf("%s: expected no level, got %+v", path, level)
+		}
+	}
+}
+
+func TestCustomLayout(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, ProjectFile), []byte(`layout:
+  shared: shared/{env}.yml
+  app: apps/{app}/{env}.yml
+  target_shared: targets/{target}/{env}.yml
+  target_app: targets/{target}/{app}/{env}.yml
+`), 0644)
+	files := []string{
+		"shared/base.yml",
+		"shared/dev.yml",
+		"apps/api/base.yml",
+		"apps/api/dev.yaml",
+		"apps/worker/prod.yml",
+		"targets/k8s/api/prod.yml",
+		"notes/readme.yml",
+	}
+	for _, file := range files {
+		path := filepath.Join(tmpDir, file)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("KEY: value"), 0644)
+	}
+
+	project, err := LoadProject(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadProject failed: %v", err)
+	}
+	if !project.Layout.Custom() {
+		t.Error("Expected the layout to be custom")
+	}
+	levels := map[string]Level{
+		"shared/base.yml":          {},
+		"shared/dev.yml":           {Env: "dev"},
+		"apps/api/dev.yaml":        {App: "api", Env: "dev"},
+		"targets/k8s/prod.yml":     {Env: "prod", Target: "k8s"},
+		"targets/k8s/api/prod.yml": {App: "api", Env: "prod", Target: "k8s"},
+	}
+	for path, expected := range levels {
+		if level, ok := project.FileLevel(path); !ok || level != expected {
+			t.Errorf("%s: expected %+v, got %+v (%v)", path, expected, level, ok)
+		}
+		if file := project.LevelFile(tmpDir, expected); file != filepath.Join(tmpDir, path) {
+			t.Errorf("LevelFile(%+v): expected %s, got %s", expected, path, file)
+		}
+	}
+	if level, ok := project.FileLevel("notes/readme.yml"); ok {
+		t.Errorf("Expected notes/readme.yml to have no level, got %+v", level)
+	}
+
+	layout, err := Discover(tmpDir)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	expected := &Layout{Apps: []string{"api", "worker"}, Envs: []string{"dev", "prod"}, Targets: []string{"k8s"}}
+	if !reflect.DeepEqual(layout, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, layout)
+	}
+	if apps, err := AppsInEnv(tmpDir, "dev", ""); err != nil || !reflect.DeepEqual(apps, []string{"api"}) {
+		t.Errorf("Expected [api] in dev, got %v (%v)", apps, err)
+	}
+
+	// The chain picks up files with either extension
+	chain, err := Chain(LoadContext{RootDir: tmpDir, App: "api", Env: "dev", Target: "k8s"})
+	if err != nil {
+		t.Fatalf("Chain failed: %v", err)
+	}
+	var relChain []string
+	for _, file := range chain {
+		rel, _ := filepath.Rel(tmpDir, file)
+		relChain = append(relChain, filepath.ToSlash(rel))
+	}
+	expectedChain := []string{"shared/base.yml", "apps/api/base.yml", "shared/dev.yml", "apps/api/dev.yaml", "targets/k8s/dev.yml", "targets/k8s/api/dev.yml"}
+	if !reflect.DeepEqual(relChain, expectedChain) {
+		t.Errorf("Expected %v, got %v", expectedChain, relChain)
+	}
+}
+
+func TestSplitStores(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, ProjectFile), []byte("stores:\n  split: true\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, ".sops.yaml"), []byte("creation_rules: []\n"), 0644)
+	files := map[string]string{
+		"base/shared.config.yml": "LOG_LEVEL: info\nDB_HOST: localhost\n",
+		"base/shared.yml":        "DB_HOST: secret-host\n",
+		"dev/api.config.yml":     "PORT: \"8080\"\n",
+		"dev/api.yml":            "API_KEY: dev-key\n",
+	}
+	for file, content := range files {
+		path := filepath.Join(tmpDir, file)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+
+	project, err := LoadProject(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadProject failed: %v", err)
+	}
+	levels := map[string]Level{
+		"base/shared.config.yml": {Plain: true},
+		"dev/api.config.yml":     {App: "api", Env: "dev", Plain: true},
+		"dev/api.yml":            {App: "api", Env: "dev"},
+	}
+	for path, expected := range levels {
+		if level, ok := project.FileLevel(path); !ok || level != expected {
+			t.Errorf("%s: expected %+v, got %+v (%v)", path, expected, level, ok)
+		}
+		if file := project.LevelFile(tmpDir, expected); file != filepath.Join(tmpDir, path) {
+			t.Errorf("LevelFile(%+v): expected %s, got %s", expected, path, file)
+		}
+	}
+	if plain, err := IsPlainStore(filepath.Join(tmpDir, "dev/api.config.yml")); err != nil || !plain {
+		t.Errorf("Expected dev/api.config.yml to be a plaintext store (%v)", err)
+	}
+	if plain, err := IsPlainStore(filepath.Join(tmpDir, "dev/api.yml")); err != nil || plain {
+		t.Errorf("Expected dev/api.yml to be encrypted (%v)", err)
+	}
+
+	// The config stores don't show up as apps
+	layout, err := Discover(tmpDir)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	if !reflect.DeepEqual(layout.Apps, []string{"api"}) {
+		t.Errorf("Expected apps [api], got %v", layout.Apps)
+	}
+
+	// Each plaintext store comes before its level's secrets, which win
+	chain, err := Chain(LoadContext{RootDir: tmpDir, App: "api", Env: "dev"})
+	if err != nil {
+		t.Fatalf("Chain failed: %v", err)
+	}
+	var relChain []string
+	for _, file := range chain {
+		rel, _ := filepath.Rel(tmpDir, file)
+		relChain = append(relChain, filepath.ToSlash(rel))
+	}
+	expectedChain := []string{"base/shared.config.yml", "base/shared.yml", "base/api.config.yml", "base/api.yml", "dev/shared.config.yml", "dev/shared.yml", "dev/api.config.yml", "dev/api.yml"}
+	if !reflect.DeepEqual(relChain, expectedChain) {
+		t.Errorf("Expected %v, got %v", expectedChain, relChain)
+	}
+	cfg, err := Load(LoadContext{RootDir: tmpDir, App: "api", Env: "dev"})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	expected := map[string]interface{}{"LOG_LEVEL": "info", "DB_HOST": "secret-host", "PORT": "8080", "API_KEY": "dev-key"}
+	if !reflect.DeepEqual(cfg.Values, expected) {
+		t.Errorf("Expected %v, got %v", expected, cfg.Values)
+	}
+}
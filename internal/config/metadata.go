@@ -0,0 +1,266 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/teamcurri/puff/internal/safefile"
+	"gopkg.in/yaml.v3"
+)
+
+// MetadataFile is the name of the per-key metadata file in the config root
+const MetadataFile = "meta.yml"
+
+// DateFormat is the format of dates in the metadata file
+const DateFormat = "2006-01-02"
+
+// EncodingBase64 is the encoding of keys holding binary values, such as
+// keystores, which are stored base64-encoded
+const EncodingBase64 = "base64"
+
+// rotationRegex matches rotation periods such as 90d, 12w, 6m or 1y
+var rotationRegex = regexp.MustCompile(`^([0-9]+)([dwmy])$`)
+
+// KeyMetadata describes a config key. It applies to the key at every level
+// of the hierarchy.
+type KeyMetadata struct {
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	Owner       string `yaml:"owner,omitempty" json:"owner,omitempty"`
+	Sensitivity string `yaml:"sensitivity,omitempty" json:"sensitivity,omitempty"`
+	// Rotation is how often the value must be rotated, e.g. 90d or 6m
+	Rotation    string `yaml:"rotation,omitempty" json:"rotation,omitempty"`
+	LastRotated string `yaml:"last_rotated,omitempty" json:"last_rotated,omitempty"`
+	// Encoding is base64 for keys holding binary values
+	Encoding string `yaml:"encoding,omitempty" json:"encoding,omitempty"`
+	// Example is a safe sample value, used in place of the real one by
+	// export --redact
+	Example string `yaml:"example,omitempty" json:"example,omitempty"`
+}
+
+// Metadata is the per-key metadata recorded in meta.yml
+type Metadata struct {
+	Keys map[string]KeyMetadata `yaml:"keys"`
+
+	// exists is false if meta.yml has not been created
+	exists bool
+}
+
+// LoadMetadata reads meta.yml from the config root. A missing file yields
+// empty metadata.
+func LoadMetadata(rootDir string) (*Metadata, error) {
+	return LoadMetadataWith(rootDir, os.ReadFile)
+}
+
+// LoadMetadataWith reads meta.yml with the given function, e.g. from a git
+// revision. Missing files must yield an error satisfying os.IsNotExist.
+func LoadMetadataWith(rootDir string, readFile func(string) ([]byte, error)) (*Metadata, error) {
+	data, err := readFile(filepath.Join(rootDir, MetadataFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Metadata{Keys: map[string]KeyMetadata{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", MetadataFile, err)
+	}
+
+	var metadata Metadata
+	if err := yaml.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", MetadataFile, err)
+	}
+	if metadata.Keys == nil {
+		metadata.Keys = map[string]KeyMetadata{}
+	}
+	for key, meta := range metadata.Keys {
+		if err := meta.validate(); err != nil {
+			return nil, fmt.Errorf("invalid metadata for %s in %s: %w", key, MetadataFile, err)
+		}
+	}
+	metadata.exists = true
+
+	return &metadata, nil
+}
+
+// Exists reports whether meta.yml has been created
+func (m *Metadata) Exists() bool {
+	return m.exists
+}
+
+// Get returns the metadata for a key
+func (m *Metadata) Get(key string) (KeyMetadata, bool) {
+	meta, ok := m.Keys[key]
+	return meta, ok
+}
+
+// Examples returns the example values of the keys that have one
+func (m *Metadata) Examples() map[string]string {
+	examples := make(map[string]string)
+	for key, meta := range m.Keys {
+		if meta.Example != "" {
+			examples[key] = meta.Example
+		}
+	}
+	return examples
+}
+
+// BinaryKeys returns the keys holding base64-encoded binary values
+func (m *Metadata) BinaryKeys() []string {
+	var keys []string
+	for key, meta := range m.Keys {
+		if meta.Encoding == EncodingBase64 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// MarkBinary records in meta.yml that a key holds base64-encoded binary
+// values, creating the file if needed. The rest of the file, including its
+// comments, is left as it is. It reports false if the key was already marked.
+func MarkBinary(rootDir, key string) (bool, error) {
+	path := filepath.Join(rootDir, MetadataFile)
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, fmt.Errorf("failed to read %s: %w", MetadataFile, err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return false, fmt.Errorf("failed to parse %s: %w", MetadataFile, err)
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	keyNode, err := mappingEntry(doc.Content[0], "keys")
+	if err == nil {
+		keyNode, err = mappingEntry(keyNode, key)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to update %s: %w", MetadataFile, err)
+	}
+
+	for i := 0; i+1 < len(keyNode.Content); i += 2 {
+		if keyNode.Content[i].Value == "encoding" {
+			if keyNode.Content[i+1].Value == EncodingBase64 {
+				return false, nil
+			}
+			keyNode.Content[i+1].SetString(EncodingBase64)
+			return true, writeYAML(path, &doc)
+		}
+	}
+	keyNode.Content = append(keyNode.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Value: "encoding"},
+		&yaml.Node{Kind: yaml.ScalarNode, Value: EncodingBase64})
+	return true, writeYAML(path, &doc)
+}
+
+// mappingEntry returns the mapping under a name in a YAML mapping, adding it
+// if it is missing or empty
+func mappingEntry(mapping *yaml.Node, name string) (*yaml.Node, error) {
+	if mapping.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("expected a mapping at line %d", mapping.Line)
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != name {
+			continue
+		}
+		value := mapping.Content[i+1]
+		if value.Kind == yaml.ScalarNode && value.Tag == "!!null" {
+			*value = yaml.Node{Kind: yaml.MappingNode}
+		}
+		if value.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("expected a mapping for %s at line %d", name, value.Line)
+		}
+		return value, nil
+	}
+	value := &yaml.Node{Kind: yaml.MappingNode}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, value)
+	return value, nil
+}
+
+// writeYAML writes a YAML document with two-space indentation
+func writeYAML(path string, doc *yaml.Node) error {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", filepath.Base(path), err)
+	}
+	if err := safefile.Write(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// RotationDue returns the date by which the key must next be rotated. ok is
+// false if the key has no rotation period; a key that was never rotated is
+// due immediately, which is reported as the zero time.
+func (k KeyMetadata) RotationDue() (due time.Time, ok bool) {
+	if k.Rotation == "" {
+		return time.Time{}, false
+	}
+	if k.LastRotated == "" {
+		return time.Time{}, true
+	}
+
+	lastRotated, _ := time.Parse(DateFormat, k.LastRotated)
+	years, months, days, _ := parseRotation(k.Rotation)
+	return lastRotated.AddDate(years, months, days), true
+}
+
+// Overdue reports whether the key's rotation is due as of now. The due date
+// itself still counts as overdue.
+func (k KeyMetadata) Overdue(now time.Time) bool {
+	due, ok := k.RotationDue()
+	return ok && !now.Before(due)
+}
+
+// parseRotation splits a rotation period into years, months and days
+func parseRotation(rotation string) (years, months, days int, err error) {
+	match := rotationRegex.FindStringSubmatch(rotation)
+	if match == nil {
+		return 0, 0, 0, fmt.Errorf("invalid rotation %q (expected a number followed by d, w, m, or y, e.g. 90d)", rotation)
+	}
+	n, _ := strconv.Atoi(match[1])
+	if n == 0 {
+		return 0, 0, 0, fmt.Errorf("invalid rotation %q (must be greater than zero)", rotation)
+	}
+
+	switch match[2] {
+	case "d":
+		days = n
+	case "w":
+		days = 7 * n
+	case "m":
+		months = n
+	case "y":
+		years = n
+	}
+	return years, months, days, nil
+}
+
+// validate checks that the rotation period, date, and encoding are
+// well-formed
+func (k KeyMetadata) validate() error {
+	if k.Rotation != "" {
+		if _, _, _, err := parseRotation(k.Rotation); err != nil {
+			return err
+		}
+	}
+	if k.LastRotated != "" {
+		if _, err := time.Parse(DateFormat, k.LastRotated); err != nil {
+			return fmt.Errorf("invalid last_rotated %q (expected YYYY-MM-DD)", k.LastRotated)
+		}
+	}
+	if k.Encoding != "" && k.Encoding != EncodingBase64 {
+		return fmt.Errorf("invalid encoding %q (only %s is supported)", k.Encoding, EncodingBase64)
+	}
+	return nil
+}
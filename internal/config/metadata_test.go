@@ -0,0 +1,139 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadMetadata(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "puff-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	metadata, err := LoadMetadata(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadMetadata failed: %v", err)
+	}
+	if metadata.Exists() || len(metadata.Keys) != 0 {
+		t.Errorf("Expected empty metadata without %s", MetadataFile)
+	}
+
+	os.WriteFile(filepath.Join(tmpDir, MetadataFile), []byte(`keys:
+  DB_PASSWORD:
+    description: Primary database password
+    owner: platform
+    sensitivity: secret
+    rotation: 90d
+    last_rotated: "2026-01-01"
+`), 0644)
+	metadata, err = LoadMetadata(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadMetadata failed: %v", err)
+	}
+	meta, ok := metadata.Get("DB_PASSWORD")
+	if !metadata.Exists() || !ok || meta.Owner != "platform" || meta.Sensitivity != "secret" {
+		t.Errorf("Unexpected metadata: %+v", meta)
+	}
+
+	invalid := map[string]string{
+		"rotation: 90":             "invalid rotation",
+		"rotation: 0d":             "must be greater than zero",
+		"last_rotated: 01/02/2026": "invalid last_rotated",
+		"encoding: hex":            "invalid encoding",
+	}
+	for field, want := range invalid {
+		os.WriteFile(filepath.Join(tmpDir, MetadataFile), []byte("keys:\n  KEY:\n    "+field+"\n"), 0644)
+		if _, err := LoadMetadata(tmpDir); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: expected error containing %q, got %v", field, want, err)
+		}
+	}
+}
+
+func TestMarkBinary(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	changed, err := MarkBinary(tmpDir, "TLS_KEYSTORE")
+	if err != nil || !changed {
+		t.Fatalf("MarkBinary failed: changed=%v err=%v", changed, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(tmpDir, MetadataFile)); string(data) != "keys:\n  TLS_KEYSTORE:\n    encoding: base64\n" {
+		t.Errorf("Unexpected %s:\n%s", MetadataFile, data)
+	}
+
+	// Existing metadata and comments are kept
+	os.WriteFile(filepath.Join(tmpDir, MetadataFile), []byte(`# Owned by platform
+keys:
+  DB_PASSWORD:
+    owner: platform # on call
+  TLS_KEYSTORE:
+    encoding: base64
+`), 0644)
+	if changed, err := MarkBinary(tmpDir, "TLS_KEYSTORE"); err != nil || changed {
+		t.Errorf("Expected a marked key to be left unchanged, got changed=%v err=%v", changed, err)
+	}
+	if changed, err := MarkBinary(tmpDir, "DB_PASSWORD"); err != nil || !changed {
+		t.Fatalf("MarkBinary failed: changed=%v err=%v", changed, err)
+	}
+	data, _ := os.ReadFile(filepath.Join(tmpDir, MetadataFile))
+	if !strings.Contains(string(data), "# Owned by platform") || !strings.Contains(string(data), "owner: platform # on call") {
+		t.Errorf("Expected comments to be kept:\n%s", data)
+	}
+	metadata, err := LoadMetadata(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadMetadata failed: %v", err)
+	}
+	if binary := metadata.BinaryKeys(); strings.Join(binary, ",") != "DB_PASSWORD,TLS_KEYSTORE" {
+		t.Errorf("Expected both keys to be binary, got %v", binary)
+	}
+
+	os.WriteFile(filepath.Join(tmpDir, MetadataFile), []byte("keys: [DB_PASSWORD]\n"), 0644)
+	if _, err := MarkBinary(tmpDir, "DB_PASSWORD"); err == nil {
+		t.Error("Expected an error for keys that aren't a mapping")
+	}
+}
+
+func TestKeyMetadataRotation(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.Parse(DateFormat, s)
+		return d
+	}
+
+	tests := []struct {
+		name    string
+		meta    KeyMetadata
+		now     string
+		due     string
+		overdue bool
+	}{
+		{"days", KeyMetadata{Rotation: "90d", LastRotated: "2026-01-01"}, "2026-03-31", "2026-04-01", false},
+		{"due date is overdue", KeyMetadata{Rotation: "90d", LastRotated: "2026-01-01"}, "2026-04-01", "2026-04-01", true},
+		{"weeks", KeyMetadata{Rotation: "2w", LastRotated: "2026-01-01"}, "2026-01-20", "2026-01-15", true},
+		{"months", KeyMetadata{Rotation: "6m", LastRotated: "2026-01-31"}, "2026-06-01", "2026-07-31", false},
+		{"years", KeyMetadata{Rotation: "1y", LastRotated: "2025-05-01"}, "2026-05-02", "2026-05-01", true},
+		{"never rotated", KeyMetadata{Rotation: "30d"}, "2026-01-01", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			due, ok := tt.meta.RotationDue()
+			if !ok {
+				t.Fatal("Expected a rotation due date")
+			}
+			if (tt.due == "" && !due.IsZero()) || (tt.due != "" && !due.Equal(day(tt.due))) {
+				t.Errorf("Expected due %q, got %v", tt.due, due)
+			}
+			if got := tt.meta.Overdue(day(tt.now)); got != tt.overdue {
+				t.Errorf("Expected overdue %v, got %v", tt.overdue, got)
+			}
+		})
+	}
+
+	if _, ok := (KeyMetadata{Owner: "platform"}).RotationDue(); ok {
+		t.Error("Expected no rotation without a rotation period")
+	}
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PathSeparator separates the keys in the path of a nested value, such as
+// DB_CONFIG.credentials.user
+const PathSeparator = "."
+
+// Lookup returns the value of a top-level key or, if no top-level key has
+// that name, the nested value at a dotted path. Keys containing dots are
+// taken literally when they exist, so existing flat keys keep working.
+func Lookup(values map[string]interface{}, key string) (interface{}, bool) {
+	if value, ok := values[key]; ok {
+		return value, true
+	}
+	parts, ok := splitPath(key)
+	if !ok {
+		return nil, false
+	}
+
+	var current interface{} = values
+	for _, part := range parts {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// SetPath sets a top-level key or, if no top-level key has that name, the
+// nested value at a dotted path, creating intermediate maps as needed. It
+// returns an error if part of the path holds a value that isn't a map.
+func SetPath(values map[string]interface{}, key string, value interface{}) error {
+	if _, ok := values[key]; ok || !strings.Contains(key, PathSeparator) {
+		values[key] = value
+		return nil
+	}
+	parts, ok := splitPath(key)
+	if !ok {
+		return fmt.Errorf("invalid key path %q: empty segment", key)
+	}
+
+	current := values
+	for i, part := range parts[:len(parts)-1] {
+		existing, exists := current[part]
+		if !exists {
+			child := make(map[string]interface{})
+			current[part] = child
+			current = child
+			continue
+		}
+		child, ok := existing.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("cannot set %s: %s is not a map", key, strings.Join(parts[:i+1], PathSeparator))
+		}
+		current = child
+	}
+	current[parts[len(parts)-1]] = value
+	return nil
+}
+
+// DeletePath removes a top-level key or, if no top-level key has that name,
+// the nested value at a dotted path, along with the maps the removal leaves
+// empty. It reports whether a value was removed.
+func DeletePath(values map[string]interface{}, key string) bool {
+	if _, ok := values[key]; ok {
+		delete(values, key)
+		return true
+	}
+	parts, ok := splitPath(key)
+	if !ok {
+		return false
+	}
+
+	// Walk down the path, remembering each map so empty parents can go
+	maps := []map[string]interface{}{values}
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := maps[len(maps)-1][part].(map[string]interface{})
+		if !ok {
+			return false
+		}
+		maps = append(maps, child)
+	}
+	last := maps[len(maps)-1]
+	if _, ok := last[parts[len(parts)-1]]; !ok {
+		return false
+	}
+	delete(last, parts[len(parts)-1])
+	for i := len(maps) - 1; i > 0 && len(maps[i]) == 0; i-- {
+		delete(maps[i-1], parts[i-1])
+	}
+	return true
+}
+
+// splitPath splits a dotted path into its keys, reporting false for keys
+// that aren't paths or have an empty segment
+func splitPath(key string) ([]string, bool) {
+	parts := strings.Split(key, PathSeparator)
+	if len(parts) < 2 {
+		return nil, false
+	}
+	for _, part := range parts {
+		if part == "" {
+			return nil, false
+		}
+	}
+	return parts, true
+}
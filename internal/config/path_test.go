@@ -0,0 +1,133 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	values := map[string]interface{}{
+		"DB_CONFIG": map[string]interface{}{
+			"host": "localhost",
+			"credentials": map[string]interface{}{
+				"user": "app",
+			},
+		},
+		"spring.datasource.url": "jdbc:postgresql://db",
+		"PORT":                  8080,
+	}
+
+	tests := []struct {
+		key      string
+		expected interface{}
+		found    bool
+	}{
+		{"PORT", 8080, true},
+		{"DB_CONFIG.host", "localhost", true},
+		{"DB_CONFIG.credentials.user", "app", true},
+		{"DB_CONFIG.credentials", map[string]interface{}{"user": "app"}, true},
+		{"spring.datasource.url", "jdbc:postgresql://db", true},
+		{"DB_CONFIG.missing", nil, false},
+		{"DB_CONFIG.host.name", nil, false},
+		{"PORT.value", nil, false},
+		{"DB_CONFIG..host", nil, false},
+		{"MISSING", nil, false},
+	}
+	for _, tt := range tests {
+		value, found := Lookup(values, tt.key)
+		if found != tt.found || !reflect.DeepEqual(value, tt.expected) {
+			t.Errorf("Lookup(%q) = %v, %v; expected %v, %v", tt.key, value, found, tt.expected, tt.found)
+		}
+	}
+}
+
+func TestSetPath(t *testing.T) {
+	values := map[string]interface{}{
+		"DB_CONFIG": map[string]interface{}{
+			"host": "localhost",
+		},
+		"spring.datasource.url": "jdbc:postgresql://db",
+		"PORT":                  8080,
+	}
+
+	for key, value := range map[string]interface{}{
+		"DB_CONFIG.credentials.user": "app",
+		"DB_CONFIG.host":             "db.internal",
+		"CACHE.ttl":                  60,
+		"spring.datasource.url":      "jdbc:postgresql://replica",
+		"PORT":                       9090,
+	} {
+		if err := SetPath(values, key, value); err != nil {
+			t.Fatalf("SetPath(%q) failed: %v", key, err)
+		}
+	}
+
+	expected := map[string]interface{}{
+		"DB_CONFIG": map[string]interface{}{
+			"host": "db.internal",
+			"credentials": map[string]interface{}{
+				"user": "app",
+			},
+		},
+		"CACHE":                 map[string]interface{}{"ttl": 60},
+		"spring.datasource.url": "jdbc:postgresql://replica",
+		"PORT":                  9090,
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Unexpected values after SetPath:\n%v\nexpected:\n%v", values, expected)
+	}
+
+	if err := SetPath(values, "PORT.value", 1); err == nil {
+		t.Error("Expected an error setting a path under a plain value")
+	}
+	if err := SetPath(values, "DB_CONFIG..host", 1); err == nil {
+		t.Error("Expected an error for a path with an empty segment")
+	}
+}
+
+func TestDeletePath(t *testing.T) {
+	values := func() map[string]interface{} {
+		return map[string]interface{}{
+			"DB": map[string]interface{}{
+				"host":        "localhost",
+				"credentials": map[string]interface{}{"password": "hunter2"},
+			},
+			"spring.datasource.url": "jdbc:postgresql://db",
+			"PORT":                  8080,
+		}
+	}
+
+	tests := []struct {
+		key      string
+		removed  bool
+		expected map[string]interface{}
+	}{
+		{"PORT", true, map[string]interface{}{
+			"DB":                    map[string]interface{}{"host": "localhost", "credentials": map[string]interface{}{"password": "hunter2"}},
+			"spring.datasource.url": "jdbc:postgresql://db",
+		}},
+		{"spring.datasource.url", true, map[string]interface{}{
+			"DB":   map[string]interface{}{"host": "localhost", "credentials": map[string]interface{}{"password": "hunter2"}},
+			"PORT": 8080,
+		}},
+		// Maps left empty are removed with the value
+		{"DB.credentials.password", true, map[string]interface{}{
+			"DB":                    map[string]interface{}{"host": "localhost"},
+			"spring.datasource.url": "jdbc:postgresql://db",
+			"PORT":                  8080,
+		}},
+		{"DB.missing", false, values()},
+		{"PORT.value", false, values()},
+	}
+	for _, tt := range tests {
+		got := values()
+		if removed := DeletePath(got, tt.key); removed != tt.removed || !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("DeletePath(%q) = %v, leaving %v; expected %v, leaving %v", tt.key, removed, got, tt.removed, tt.expected)
+		}
+	}
+
+	got := map[string]interface{}{"DB": map[string]interface{}{"password": "hunter2"}}
+	if !DeletePath(got, "DB.password") || len(got) != 0 {
+		t.Errorf("Expected DB to be removed once empty, got %v", got)
+	}
+}
@@ -0,0 +1,693 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectFile is the name of the optional repo-level config in the config root
+const ProjectFile = ".puff.yaml"
+
+// RootEnvVar is the environment variable that sets the config root when
+// -r/--root isn't given
+const RootEnvVar = "PUFF_ROOT"
+
+// AuditDir is the directory in the config root holding the audit log
+const AuditDir = "audit"
+
+// Positions a dimension can take in the precedence order: directly after
+// the base, env, or target-override layers
+const (
+	AfterBase   = "base"
+	AfterEnv    = "env"
+	AfterTarget = "target"
+)
+
+var (
+	// dimensionNameRegex matches valid dimension names, which double as
+	// command line flags
+	dimensionNameRegex = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+	// placeholderRegex matches {name} placeholders in a dimension's dir
+	placeholderRegex = regexp.MustCompile(`\{([^}]*)\}`)
+)
+
+// reservedDimensionNames can't be used as dimension names because they
+// already mean something in the hierarchy
+var reservedDimensionNames = map[string]bool{
+	"app": true, "env": true, "target": true, "base": true, "shared": true, "root": true,
+}
+
+// Project is the repo-level config in .puff.yaml
+type Project struct {
+	// Format is the version of the repository's layout and metadata, written
+	// by init and raised by 'puff migrate'. Repositories created before it
+	// was recorded are format 0.
+	Format int `yaml:"format"`
+	// Dimensions are extra precedence layers, such as a region or cluster
+	Dimensions []Dimension `yaml:"dimensions"`
+	// Audit controls the audit log of changes made by puff commands
+	Audit AuditSettings `yaml:"audit"`
+	// Lint configures the rules checked by 'puff lint'
+	Lint LintSettings `yaml:"lint"`
+	// Defaults are used for command line flags that aren't given
+	Defaults Defaults `yaml:"defaults"`
+	// Kubernetes configures the k8s formats and the apply and drift commands
+	Kubernetes KubernetesSettings `yaml:"kubernetes"`
+	// Profiles are named sets of flags selected with --profile
+	Profiles map[string]Profile `yaml:"profiles"`
+	// Layout maps the levels of the hierarchy to files
+	Layout FileLayout `yaml:"layout"`
+	// Stores splits each level into a plaintext and an encrypted store
+	Stores StoreSettings `yaml:"stores"`
+	// Workspace lists the config roots of a monorepo, relative to the
+	// directory holding .puff.yaml, so verify, keys audit, and status check
+	// them all at once. Entries can be glob patterns (e.g. infra/puff-*).
+	Workspace []string `yaml:"workspace"`
+}
+
+// Profile bundles the flags of a command line under a name, so CI jobs can
+// share them. Flags given on the command line override the profile's.
+type Profile struct {
+	App    string `yaml:"app,omitempty"`
+	Env    string `yaml:"env,omitempty"`
+	Target string `yaml:"target,omitempty"`
+	// Format is the output format of generate, comma-separated for several
+	Format     string `yaml:"format,omitempty"`
+	SecretName string `yaml:"secret_name,omitempty"`
+	// Output is the file generate writes to
+	Output string `yaml:"output,omitempty"`
+	// Dimensions are the values of dimensions declared in .puff.yaml
+	Dimensions map[string]string `yaml:"dimensions,omitempty"`
+}
+
+// FileLayout maps the levels of the hierarchy to files, for repos laid out
+// differently, such as apps/{app}/{env}.yml. In the patterns, {env} is "base"
+// for the base layer. Files are read with either extension, .yml or .yaml.
+type FileLayout struct {
+	// Extension of the files puff creates: yml (the default) or yaml
+	Extension string `yaml:"extension,omitempty"`
+	// Shared is an environment's shared file. Defaults to {env}/shared.yml.
+	Shared string `yaml:"shared,omitempty"`
+	// App is an app's file in an environment. Defaults to {env}/{app}.yml.
+	App string `yaml:"app,omitempty"`
+	// TargetShared is a target's shared file for an environment. Defaults to
+	// target-overrides/{target}/{env}/shared.yml.
+	TargetShared string `yaml:"target_shared,omitempty"`
+	// TargetApp is a target's app file for an environment. Defaults to
+	// target-overrides/{target}/{env}/{app}.yml.
+	TargetApp string `yaml:"target_app,omitempty"`
+}
+
+// PlainStoreSuffix marks the plaintext store of a level in split mode, such
+// as dev/api.config.yml beside the encrypted dev/api.yml
+const PlainStoreSuffix = ".config"
+
+// StoreSettings splits each level into a plaintext store, reviewable in pull
+// requests, and an encrypted store for secrets. Both are loaded, with the
+// encrypted store taking precedence.
+type StoreSettings struct {
+	// Split enables the plaintext stores
+	Split bool `yaml:"split"`
+	// SecretKeys is a regular expression matching the names of keys that
+	// belong in the encrypted store when set doesn't say. Without it, keys
+	// are secret unless set is given --plain.
+	SecretKeys string `yaml:"secret_keys,omitempty"`
+}
+
+// IsSecret reports whether a key belongs in the encrypted store by the
+// naming convention
+func (s StoreSettings) IsSecret(key string) bool {
+	if s.SecretKeys == "" {
+		return true
+	}
+	return regexp.MustCompile(s.SecretKeys).MatchString(key)
+}
+
+// validate checks the secret key pattern
+func (s StoreSettings) validate() error {
+	if s.SecretKeys == "" {
+		return nil
+	}
+	if !s.Split {
+		return fmt.Errorf("secret_keys needs split: true")
+	}
+	if _, err := regexp.Compile(s.SecretKeys); err != nil {
+		return fmt.Errorf("invalid secret_keys: %w", err)
+	}
+	return nil
+}
+
+// layoutPattern is one of the patterns of a FileLayout
+type layoutPattern struct {
+	name    string
+	pattern string
+	// placeholders are the placeholders the pattern must hold
+	placeholders []string
+	// standard is the pattern of the standard layout, without an extension
+	standard string
+}
+
+// Defaults are values used for command line flags that aren't given
+type Defaults struct {
+	// Root is the config root, relative to the directory holding .puff.yaml.
+	// It is only read from the .puff.yaml in the working directory, and the
+	// other settings then come from the config root's own .puff.yaml.
+	Root string `yaml:"root,omitempty"`
+	// Env is the environment of the commands that load a context
+	Env string `yaml:"env,omitempty"`
+	// Format is the output format of generate, comma-separated for several
+	Format string `yaml:"format,omitempty"`
+}
+
+// KubernetesSettings configures the k8s formats and the apply and drift
+// commands
+type KubernetesSettings struct {
+	// SecretName names the Kubernetes secret when --secret-name isn't given,
+	// with {app}, {env}, and {target} standing for the context (e.g.
+	// "{app}-{env}")
+	SecretName string `yaml:"secret_name,omitempty"`
+	// TLS names the keys holding the certificate and private key of
+	// kubernetes.io/tls secrets
+	TLS TLSSecretKeys `yaml:"tls,omitempty"`
+	// DockerConfig names the keys assembled into the .dockerconfigjson of
+	// kubernetes.io/dockerconfigjson secrets
+	DockerConfig DockerConfigSecretKeys `yaml:"docker_config,omitempty"`
+}
+
+// TLSSecretKeys are the config keys that become tls.crt and tls.key
+type TLSSecretKeys struct {
+	Cert string `yaml:"cert,omitempty"` // Defaults to TLS_CERT
+	Key  string `yaml:"key,omitempty"`  // Defaults to TLS_KEY
+}
+
+// WithDefaults returns the keys with the defaults filled in
+func (t TLSSecretKeys) WithDefaults() TLSSecretKeys {
+	if t.Cert == "" {
+		t.Cert = "TLS_CERT"
+	}
+	if t.Key == "" {
+		t.Key = "TLS_KEY"
+	}
+	return t
+}
+
+// DockerConfigSecretKeys are the config keys holding the registry
+// credentials of a .dockerconfigjson
+type DockerConfigSecretKeys struct {
+	Registry string `yaml:"registry,omitempty"` // Defaults to DOCKER_REGISTRY
+	Username string `yaml:"username,omitempty"` // Defaults to DOCKER_USERNAME
+	Password string `yaml:"password,omitempty"` // Defaults to DOCKER_PASSWORD
+	Email    string `yaml:"email,omitempty"`    // Defaults to DOCKER_EMAIL, which is optional
+}
+
+// WithDefaults returns the keys with the defaults filled in
+func (d DockerConfigSecretKeys) WithDefaults() DockerConfigSecretKeys {
+	if d.Registry == "" {
+		d.Registry = "DOCKER_REGISTRY"
+	}
+	if d.Username == "" {
+		d.Username = "DOCKER_USERNAME"
+	}
+	if d.Password == "" {
+		d.Password = "DOCKER_PASSWORD"
+	}
+	if d.Email == "" {
+		d.Email = "DOCKER_EMAIL"
+	}
+	return d
+}
+
+// AuditSettings controls the audit log kept in the audit directory
+type AuditSettings struct {
+	// Enabled makes set, unset, prune, encrypt, mv, app create/rm/rename, env
+	// create/rm, and keys add/rm record their changes
+	Enabled bool `yaml:"enabled"`
+	// Encrypt encrypts each record with the directory's encryption keys
+	Encrypt bool `yaml:"encrypt"`
+}
+
+// Severities a lint rule can be given
+const (
+	LintError   = "error"
+	LintWarning = "warning"
+	LintOff     = "off"
+)
+
+// LintSettings configures the lint rules
+type LintSettings struct {
+	// Rules sets the severity of rules by name: error, warning, or off.
+	// Rules not listed keep their default severity.
+	Rules map[string]string `yaml:"rules"`
+	// KeyPattern is a regular expression every key name must match.
+	// Defaults to UPPER_SNAKE_CASE, with a leading _ for internal variables.
+	KeyPattern string `yaml:"key_pattern,omitempty"`
+}
+
+// Dimension is an extra layer in the precedence order, selected by a value
+// given on the command line (e.g. --region eu-west-1). Each layer holds a
+// shared.yml and per-app files, like the env and target layers.
+type Dimension struct {
+	Name string `yaml:"name"`
+	// Dir is the layer's directory relative to the config root, with {NAME}
+	// standing for the dimension's value and {env} for the environment.
+	// Defaults to "NAME/{NAME}".
+	Dir string `yaml:"dir,omitempty"`
+	// After is the layer the dimension directly follows: base, env (the
+	// default), or target. Dimensions in the same position apply in the
+	// order they are declared.
+	After string `yaml:"after,omitempty"`
+}
+
+// LoadProject reads .puff.yaml from the config root. A missing file yields an
+// empty project.
+func LoadProject(rootDir string) (*Project, error) {
+	return loadProject(rootDir, os.ReadFile)
+}
+
+// LoadProjectWith reads .puff.yaml with the given function, e.g. from a git
+// revision. Missing files must yield an error satisfying os.IsNotExist.
+func LoadProjectWith(rootDir string, readFile func(string) ([]byte, error)) (*Project, error) {
+	return loadProject(rootDir, readFile)
+}
+
+// loadProject reads .puff.yaml with the given function, e.g. from a past git
+// revision
+func loadProject(rootDir string, readFile func(string) ([]byte, error)) (*Project, error) {
+	data, err := readFile(filepath.Join(rootDir, ProjectFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Project{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", ProjectFile, err)
+	}
+
+	var project Project
+	if err := yaml.Unmarshal(data, &project); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", ProjectFile, err)
+	}
+
+	if err := checkFormat(project.Format); err != nil {
+		return nil, fmt.Errorf("invalid format in %s: %w", ProjectFile, err)
+	}
+
+	seen := make(map[string]bool)
+	for i := range project.Dimensions {
+		dim := &project.Dimensions[i]
+		if dim.Dir == "" {
+			dim.Dir = fmt.Sprintf("%s/{%s}", dim.Name, dim.Name)
+		}
+		if dim.After == "" {
+			dim.After = AfterEnv
+		}
+		if err := dim.validate(); err != nil {
+			return nil, fmt.Errorf("invalid dimension in %s: %w", ProjectFile, err)
+		}
+		if seen[dim.Name] {
+			return nil, fmt.Errorf("invalid dimension in %s: %s is declared twice", ProjectFile, dim.Name)
+		}
+		seen[dim.Name] = true
+	}
+	if project.Audit.Enabled && project.TopLevelDirs()[AuditDir] {
+		return nil, fmt.Errorf("invalid dimension in %s: the %s directory holds the audit log", ProjectFile, AuditDir)
+	}
+	if err := project.Lint.validate(); err != nil {
+		return nil, fmt.Errorf("invalid lint settings in %s: %w", ProjectFile, err)
+	}
+	if err := project.Kubernetes.validate(); err != nil {
+		return nil, fmt.Errorf("invalid kubernetes settings in %s: %w", ProjectFile, err)
+	}
+	for name, profile := range project.Profiles {
+		if err := project.checkValues(profile.Dimensions); err != nil {
+			return nil, fmt.Errorf("invalid profile %s in %s: %w", name, ProjectFile, err)
+		}
+	}
+	if err := project.Layout.validate(); err != nil {
+		return nil, fmt.Errorf("invalid layout in %s: %w", ProjectFile, err)
+	}
+	if err := project.Stores.validate(); err != nil {
+		return nil, fmt.Errorf("invalid stores in %s: %w", ProjectFile, err)
+	}
+	for _, root := range project.Workspace {
+		if err := validateWorkspaceRoot(root); err != nil {
+			return nil, fmt.Errorf("invalid workspace in %s: %w", ProjectFile, err)
+		}
+	}
+
+	return &project, nil
+}
+
+// FindRoot walks up from dir to the nearest directory holding .sops.yaml or
+// .puff.yaml, as git finds a repository, and returns the config root it sets
+// (see ResolveRoot). It returns dir if there is none. A relative dir gives a
+// relative root, such as "../..".
+func FindRoot(dir string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for current := dir; ; current = filepath.Join(current, "..") {
+		for _, marker := range []string{".sops.yaml", ProjectFile} {
+			if _, err := os.Stat(filepath.Join(current, marker)); err == nil {
+				return ResolveRoot(current)
+			}
+		}
+		parent := filepath.Dir(absDir)
+		if parent == absDir {
+			return dir, nil
+		}
+		absDir = parent
+	}
+}
+
+// ResolveRoot returns the config root set by defaults.root in the .puff.yaml
+// of dir, or dir itself if there is none
+func ResolveRoot(dir string) (string, error) {
+	project, err := LoadProject(dir)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case project.Defaults.Root == "":
+		return dir, nil
+	case filepath.IsAbs(project.Defaults.Root):
+		return project.Defaults.Root, nil
+	}
+	return filepath.Join(dir, project.Defaults.Root), nil
+}
+
+// WorkspaceRoots returns the config roots listed by the workspace in the
+// .puff.yaml of dir, joined to dir, in the order they are declared. Glob
+// patterns match the directories holding a .sops.yaml. It returns nil if dir
+// isn't a workspace.
+func WorkspaceRoots(dir string) ([]string, error) {
+	project, err := LoadProject(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var roots []string
+	seen := make(map[string]bool)
+	for _, entry := range project.Workspace {
+		matches, err := filepath.Glob(filepath.Join(dir, entry))
+		if err != nil {
+			return nil, fmt.Errorf("invalid workspace root %q: %w", entry, err)
+		}
+		var found []string
+		for _, match := range matches {
+			if _, err := os.Stat(filepath.Join(match, ".sops.yaml")); err == nil {
+				found = append(found, match)
+			}
+		}
+		if len(found) == 0 {
+			return nil, fmt.Errorf("workspace root %s in %s is not a config root (no .sops.yaml)", entry, filepath.Join(dir, ProjectFile))
+		}
+		for _, root := range found {
+			if !seen[root] {
+				seen[root] = true
+				roots = append(roots, root)
+			}
+		}
+	}
+	return roots, nil
+}
+
+// validateWorkspaceRoot checks that a workspace entry is a relative path or
+// glob pattern
+func validateWorkspaceRoot(root string) error {
+	if root == "" {
+		return fmt.Errorf("empty root")
+	}
+	if filepath.IsAbs(root) {
+		return fmt.Errorf("root %s must be relative to the workspace", root)
+	}
+	if _, err := filepath.Match(root, ""); err != nil {
+		return fmt.Errorf("root %q is not a valid pattern: %w", root, err)
+	}
+	return nil
+}
+
+// Profile returns the profile with the given name
+func (p *Project) Profile(name string) (Profile, error) {
+	profile, ok := p.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown profile %q (not declared in %s)", name, ProjectFile)
+	}
+	return profile, nil
+}
+
+// Flags returns the values the profile sets, by the name of the flag they set
+func (p Profile) Flags() map[string]string {
+	flags := map[string]string{
+		"app":         p.App,
+		"env":         p.Env,
+		"target":      p.Target,
+		"format":      p.Format,
+		"secret-name": p.SecretName,
+		"output":      p.Output,
+	}
+	for name, value := range p.Dimensions {
+		flags[name] = value
+	}
+	for name, value := range flags {
+		if value == "" {
+			delete(flags, name)
+		}
+	}
+	return flags
+}
+
+// SecretNameFor returns the secret name the naming convention gives a
+// context, or "" if there is no convention
+func (k KubernetesSettings) SecretNameFor(app, env, target string) string {
+	if k.SecretName == "" {
+		return ""
+	}
+	return strings.NewReplacer("{app}", app, "{env}", env, "{target}", target).Replace(k.SecretName)
+}
+
+// Dimension returns the dimension with the given name, or nil if it isn't
+// declared
+func (p *Project) Dimension(name string) *Dimension {
+	for i := range p.Dimensions {
+		if p.Dimensions[i].Name == name {
+			return &p.Dimensions[i]
+		}
+	}
+	return nil
+}
+
+// TopLevelDirs returns the top-level directories that hold dimension layers
+// rather than environments
+func (p *Project) TopLevelDirs() map[string]bool {
+	dirs := make(map[string]bool)
+	for _, dim := range p.Dimensions {
+		first := strings.Split(dim.Dir, "/")[0]
+		if first != "base" && first != "target-overrides" && !placeholderRegex.MatchString(first) {
+			dirs[first] = true
+		}
+	}
+	return dirs
+}
+
+// Path returns the directory of the dimension's layer for a value and
+// environment. An empty environment uses the "base" directory, as targets do.
+func (d Dimension) Path(rootDir, env, value string) string {
+	if env == "" {
+		env = "base"
+	}
+	dir := strings.NewReplacer("{"+d.Name+"}", value, "{env}", env).Replace(d.Dir)
+	return filepath.Join(rootDir, filepath.FromSlash(dir))
+}
+
+// ValidateValue checks that a value selects a single directory
+func (d Dimension) ValidateValue(value string) error {
+	if value == "." || value == ".." || strings.ContainsAny(value, `/\`) {
+		return fmt.Errorf("invalid %s: %q", d.Name, value)
+	}
+	return nil
+}
+
+// layerFiles returns the shared and app files of the layers of dimensions
+// in the given position that have a value in ctx
+func (p *Project) layerFiles(ctx LoadContext, after string) []string {
+	var files []string
+	for _, dim := range p.Dimensions {
+		value := ctx.Dimensions[dim.Name]
+		if dim.After != after || value == "" {
+			continue
+		}
+		level := Level{Env: ctx.Env, Dimension: dim.Name, Value: value}
+		files = append(files, ctx.existingVariant(p.levelFile(ctx.RootDir, level)))
+		if ctx.App != "" {
+			level.App = ctx.App
+			files = append(files, ctx.existingVariant(p.levelFile(ctx.RootDir, level)))
+		}
+	}
+	return files
+}
+
+// checkValues checks that every dimension value is for a declared dimension
+// and selects a single directory
+func (p *Project) checkValues(values map[string]string) error {
+	for name, value := range values {
+		dim := p.Dimension(name)
+		if dim == nil {
+			return fmt.Errorf("unknown dimension %q (not declared in %s)", name, ProjectFile)
+		}
+		if err := dim.ValidateValue(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validate checks a dimension's name, directory layout and position
+func (d Dimension) validate() error {
+	if !dimensionNameRegex.MatchString(d.Name) {
+		return fmt.Errorf("invalid name %q (use lowercase letters, digits and dashes)", d.Name)
+	}
+	if reservedDimensionNames[d.Name] {
+		return fmt.Errorf("%s is a reserved name", d.Name)
+	}
+
+	if filepath.IsAbs(d.Dir) || strings.HasPrefix(d.Dir, "/") {
+		return fmt.Errorf("dir of %s must be relative to the config root", d.Name)
+	}
+	for _, element := range strings.Split(d.Dir, "/") {
+		if element == "" || element == "." || element == ".." {
+			return fmt.Errorf("invalid dir %q for %s", d.Dir, d.Name)
+		}
+	}
+	if !strings.Contains(d.Dir, "{"+d.Name+"}") {
+		return fmt.Errorf("dir of %s must contain {%s}", d.Name, d.Name)
+	}
+	for _, match := range placeholderRegex.FindAllStringSubmatch(d.Dir, -1) {
+		if match[1] != d.Name && match[1] != "env" {
+			return fmt.Errorf("unknown placeholder {%s} in dir of %s (use {%s} or {env})", match[1], d.Name, d.Name)
+		}
+	}
+	// A top-level value directory would be mistaken for an environment
+	if strings.Split(d.Dir, "/")[0] == "{"+d.Name+"}" {
+		return fmt.Errorf("dir of %s must not start with {%s}", d.Name, d.Name)
+	}
+
+	switch d.After {
+	case AfterBase, AfterEnv, AfterTarget:
+	default:
+		return fmt.Errorf("invalid position %q for %s (use base, env, or target)", d.After, d.Name)
+	}
+	return nil
+}
+
+// validate checks the rule severities and the key pattern. Rule names are
+// checked by the linter, which defines them.
+func (l LintSettings) validate() error {
+	for rule, severity := range l.Rules {
+		switch severity {
+		case LintError, LintWarning, LintOff:
+		default:
+			return fmt.Errorf("invalid severity %q for %s (use error, warning, or off)", severity, rule)
+		}
+	}
+	if l.KeyPattern != "" {
+		if _, err := regexp.Compile(l.KeyPattern); err != nil {
+			return fmt.Errorf("invalid key_pattern: %w", err)
+		}
+	}
+	return nil
+}
+
+// validate checks the extension and the placeholders of the patterns
+func (l FileLayout) validate() error {
+	switch l.Extension {
+	case "", "yml", "yaml":
+	default:
+		return fmt.Errorf("invalid extension %q (use yml or yaml)", l.Extension)
+	}
+
+	for _, pattern := range l.patterns() {
+		if filepath.IsAbs(pattern.pattern) || strings.HasPrefix(pattern.pattern, "/") {
+			return fmt.Errorf("%s must be relative to the config root", pattern.name)
+		}
+		for _, element := range strings.Split(pattern.pattern, "/") {
+			if element == "" || element == "." || element == ".." {
+				return fmt.Errorf("invalid %s %q", pattern.name, pattern.pattern)
+			}
+		}
+		if !IsConfigFileName(path.Base(pattern.pattern)) {
+			return fmt.Errorf("%s %q must end in .yml or .yaml", pattern.name, pattern.pattern)
+		}
+		counts := make(map[string]int)
+		for _, match := range placeholderRegex.FindAllStringSubmatch(pattern.pattern, -1) {
+			if !slices.Contains(pattern.placeholders, match[1]) {
+				return fmt.Errorf("unknown placeholder {%s} in %s (use {%s})", match[1], pattern.name, strings.Join(pattern.placeholders, "}, {"))
+			}
+			counts[match[1]]++
+		}
+		for _, placeholder := range pattern.placeholders {
+			if counts[placeholder] != 1 {
+				return fmt.Errorf("%s must contain {%s} once", pattern.name, placeholder)
+			}
+		}
+	}
+	return nil
+}
+
+// extension returns the extension of the files puff creates, with its dot
+func (l FileLayout) extension() string {
+	if l.Extension == "" {
+		return ".yml"
+	}
+	return "." + l.Extension
+}
+
+// patterns returns the patterns in the order files are matched against
+// them, with the standard layout's for those not given. Target patterns come
+// first, since the standard env patterns would match target-overrides too.
+func (l FileLayout) patterns() []layoutPattern {
+	patterns := []layoutPattern{
+		{name: "target_shared", pattern: l.TargetShared, placeholders: []string{"target", "env"}, standard: "target-overrides/{target}/{env}/shared"},
+		{name: "target_app", pattern: l.TargetApp, placeholders: []string{"target", "env", "app"}, standard: "target-overrides/{target}/{env}/{app}"},
+		{name: "shared", pattern: l.Shared, placeholders: []string{"env"}, standard: "{env}/shared"},
+		{name: "app", pattern: l.App, placeholders: []string{"env", "app"}, standard: "{env}/{app}"},
+	}
+	for i := range patterns {
+		if patterns[i].pattern == "" {
+			patterns[i].pattern = patterns[i].standard + l.extension()
+		}
+	}
+	return patterns
+}
+
+// Custom reports whether the layout places files other than the standard
+// layout does, apart from their extension
+func (l FileLayout) Custom() bool {
+	for _, pattern := range l.patterns() {
+		if TrimConfigExt(pattern.pattern) != pattern.standard {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks the placeholders in the secret naming convention
+func (k KubernetesSettings) validate() error {
+	for _, match := range placeholderRegex.FindAllStringSubmatch(k.SecretName, -1) {
+		switch match[1] {
+		case "app", "env", "target":
+		default:
+			return fmt.Errorf("unknown placeholder {%s} in secret_name (use {app}, {env}, or {target})", match[1])
+		}
+	}
+	return nil
+}
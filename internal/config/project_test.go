@@ -0,0 +1,424 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadProject(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "puff-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// A missing .puff.yaml declares no dimensions
+	project, err := LoadProject(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadProject failed: %v", err)
+	}
+	if len(project.Dimensions) != 0 {
+		t.Errorf("Expected no dimensions, got %v", project.Dimensions)
+	}
+
+	os.WriteFile(filepath.Join(tmpDir, ProjectFile), []byte(`dimensions:
+  - name: region
+  - name: cluster
+    dir: "{env}/clusters/{cluster}"
+    after: target
+`), 0644)
+	project, err = LoadProject(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadProject failed: %v", err)
+	}
+	expected := []Dimension{
+		{Name: "region", Dir: "region/{region}", After: AfterEnv},
+		{Name: "cluster", Dir: "{env}/clusters/{cluster}", After: AfterTarget},
+	}
+	if !reflect.DeepEqual(project.Dimensions, expected) {
+		t.Errorf("Expected %v, got %v", expected, project.Dimensions)
+	}
+	if !reflect.DeepEqual(project.TopLevelDirs(), map[string]bool{"region": true}) {
+		t.Errorf("Unexpected top-level dirs: %v", project.TopLevelDirs())
+	}
+
+	invalid := map[string]string{
+		"- name: Region":                               "invalid name",
+		"- name: env":                                  "reserved name",
+		"- name: region\n  dir: regions":               "must contain {region}",
+		"- name: region\n  dir: \"{region}\"":          "must not start with {region}",
+		"- name: region\n  dir: \"../{region}\"":       "invalid dir",
+		"- name: region\n  dir: \"r/{zone}/{region}\"": "unknown placeholder {zone}",
+		"- name: region\n  after: app":                 "invalid position",
+		"- name: region\n- name: region":               "declared twice",
+	}
+	for dimensions, want := range invalid {
+		os.WriteFile(filepath.Join(tmpDir, ProjectFile), []byte("dimensions:\n"+dimensions+"\n"), 0644)
+		if _, err := LoadProject(tmpDir); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: expected error containing %q, got %v", dimensions, want, err)
+		}
+	}
+}
+
+func TestLoadProjectLint(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	os.WriteFile(filepath.Join(tmpDir, ProjectFile), []byte(`lint:
+  rules:
+    key_naming: error
+    empty_file: "off"
+  key_pattern: "^[a-z_]+$"
+`), 0644)
+	project, err := LoadProject(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadProject failed: %v", err)
+	}
+	expected := LintSettings{Rules: map[string]string{"key_naming": LintError, "empty_file": LintOff}, KeyPattern: "^[a-z_]+$"}
+	if !reflect.DeepEqual(project.Lint, expected) {
+		t.Errorf("Expected %v, got %v", expected, project.Lint)
+	}
+
+	invalid := map[string]string{
+		"rules:\n    key_naming: fatal": "invalid severity",
+		"key_pattern: \"[A-Z\"":         "invalid key_pattern",
+	}
+	for lint, want := range invalid {
+		os.WriteFile(filepath.Join(tmpDir, ProjectFile), []byte("lint:\n  "+lint+"\n"), 0644)
+		if _, err := LoadProject(tmpDir); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: expected error containing %q, got %v", lint, want, err)
+		}
+	}
+}
+
+func TestLoadProjectDefaults(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	os.WriteFile(filepath.Join(tmpDir, ProjectFile), []byte(`defaults:
+  root: config
+  env: dev
+  format: env,json
+kubernetes:
+  secret_name: "{app}-{env}"
+`), 0644)
+	project, err := LoadProject(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadProject failed: %v", err)
+	}
+	expected := Defaults{Root: "config", Env: "dev", Format: "env,json"}
+	if project.Defaults != expected {
+		t.Errorf("Expected %v, got %v", expected, project.Defaults)
+	}
+	if name := project.Kubernetes.SecretNameFor("api", "prod", ""); name != "api-prod" {
+		t.Errorf("Expected api-prod, got %q", name)
+	}
+	if name := (KubernetesSettings{}).SecretNameFor("api", "prod", ""); name != "" {
+		t.Errorf("Expected no name without a convention, got %q", name)
+	}
+
+	root, err := ResolveRoot(tmpDir)
+	if err != nil || root != filepath.Join(tmpDir, "config") {
+		t.Errorf("Expected the root to be %s, got %q (%v)", filepath.Join(tmpDir, "config"), root, err)
+	}
+	if root, err := ResolveRoot(filepath.Join(tmpDir, "config")); err != nil || root != filepath.Join(tmpDir, "config") {
+		t.Errorf("Expected a directory without .puff.yaml to be its own root, got %q (%v)", root, err)
+	}
+
+	os.WriteFile(filepath.Join(tmpDir, ProjectFile), []byte("kubernetes:\n  secret_name: \"{app}-{cluster}\"\n"), 0644)
+	if _, err := LoadProject(tmpDir); err == nil || !strings.Contains(err.Error(), "unknown placeholder {cluster}") {
+		t.Errorf("Expected an unknown placeholder error, got %v", err)
+	}
+}
+
+func TestFindRoot(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "config", "dev"), 0755)
+	os.MkdirAll(filepath.Join(tmpDir, "tools", "bin"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "config", ".sops.yaml"), []byte("creation_rules: []\n"), 0644)
+
+	// The nearest .sops.yaml above the directory is the root
+	root, err := FindRoot(filepath.Join(tmpDir, "config", "dev"))
+	if err != nil || root != filepath.Join(tmpDir, "config") {
+		t.Errorf("Expected %s, got %q (%v)", filepath.Join(tmpDir, "config"), root, err)
+	}
+
+	// A .puff.yaml further up can point at a root elsewhere
+	os.WriteFile(filepath.Join(tmpDir, ProjectFile), []byte("defaults:\n  root: config\n"), 0644)
+	root, err = FindRoot(filepath.Join(tmpDir, "tools", "bin"))
+	if err != nil || root != filepath.Join(tmpDir, "config") {
+		t.Errorf("Expected the root set in .puff.yaml, got %q (%v)", root, err)
+	}
+
+	// Relative directories give relative roots
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(filepath.Join(tmpDir, "config", "dev"))
+	if root, err := FindRoot("."); err != nil || root != ".." {
+		t.Errorf("Expected .., got %q (%v)", root, err)
+	}
+}
+
+func TestLoadProjectProfiles(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	os.WriteFile(filepath.Join(tmpDir, ProjectFile), []byte(`dimensions:
+  - name: region
+profiles:
+  api-prod-k8s:
+    app: api
+    env: prod
+    format: k8s
+    secret_name: api-secrets
+    dimensions:
+      region: eu
+`), 0644)
+	project, err := LoadProject(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadProject failed: %v", err)
+	}
+	profile, err := project.Profile("api-prod-k8s")
+	if err != nil {
+		t.Fatalf("Profile failed: %v", err)
+	}
+	expected := map[string]string{"app": "api", "env": "prod", "format": "k8s", "secret-name": "api-secrets", "region": "eu"}
+	if !reflect.DeepEqual(profile.Flags(), expected) {
+		t.Errorf("Expected %v, got %v", expected, profile.Flags())
+	}
+	if _, err := project.Profile("missing"); err == nil || !strings.Contains(err.Error(), "unknown profile") {
+		t.Errorf("Expected an unknown profile error, got %v", err)
+	}
+
+	os.WriteFile(filepath.Join(tmpDir, ProjectFile), []byte("profiles:\n  ci:\n    dimensions:\n      zone: a\n"), 0644)
+	if _, err := LoadProject(tmpDir); err == nil || !strings.Contains(err.Error(), "unknown dimension") {
+		t.Errorf("Expected an unknown dimension error, got %v", err)
+	}
+}
+
+func TestWorkspaceRoots(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, root := range []string{"infra/puff-platform", "infra/puff-data", "services/billing/config"} {
+		os.MkdirAll(filepath.Join(tmpDir, root), 0755)
+		os.WriteFile(filepath.Join(tmpDir, root, ".sops.yaml"), []byte("creation_rules: []\n"), 0644)
+	}
+	os.MkdirAll(filepath.Join(tmpDir, "infra", "puff-docs"), 0755)
+
+	// A directory without a workspace has no roots
+	if roots, err := WorkspaceRoots(tmpDir); err != nil || roots != nil {
+		t.Errorf("Expected no roots, got %v (%v)", roots, err)
+	}
+
+	// Patterns only match config roots, and roots are listed once
+	os.WriteFile(filepath.Join(tmpDir, ProjectFile), []byte("workspace:\n  - services/billing/config\n  - infra/puff-*\n  - infra/puff-data\n"), 0644)
+	roots, err := WorkspaceRoots(tmpDir)
+	if err != nil {
+		t.Fatalf("WorkspaceRoots failed: %v", err)
+	}
+	expected := []string{
+		filepath.Join(tmpDir, "services/billing/config"),
+		filepath.Join(tmpDir, "infra/puff-data"),
+		filepath.Join(tmpDir, "infra/puff-platform"),
+	}
+	if !reflect.DeepEqual(roots, expected) {
+		t.Errorf("Expected %v, got %v", expected, roots)
+	}
+
+	os.WriteFile(filepath.Join(tmpDir, ProjectFile), []byte("workspace:\n  - infra/puff-docs\n"), 0644)
+	if _, err := WorkspaceRoots(tmpDir); err == nil || !strings.Contains(err.Error(), "not a config root") {
+		t.Errorf("Expected a not a config root error, got %v", err)
+	}
+
+	os.WriteFile(filepath.Join(tmpDir, ProjectFile), []byte("workspace:\n  - /etc/puff\n"), 0644)
+	if _, err := LoadProject(tmpDir); err == nil || !strings.Contains(err.Error(), "must be relative") {
+		t.Errorf("Expected a relative path error, got %v", err)
+	}
+}
+
+func TestLoadProjectLayout(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// Without a layout, new files get the standard layout's paths
+	project, err := LoadProject(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadProject failed: %v", err)
+	}
+	if project.Layout.Custom() {
+		t.Error("Expected the standard layout")
+	}
+	if file := project.LevelFile(tmpDir, Level{App: "api", Env: "dev", Target: "k8s"}); file != filepath.Join(tmpDir, "target-overrides/k8s/dev/api.yml") {
+		t.Errorf("Expected the standard target file, got %s", file)
+	}
+
+	// The extension only changes the files puff creates
+	os.WriteFile(filepath.Join(tmpDir, ProjectFile), []byte("layout:\n  extension: yaml\n"), 0644)
+	project, err = LoadProject(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadProject failed: %v", err)
+	}
+	if project.Layout.Custom() {
+		t.Error("Expected a different extension to keep the standard layout")
+	}
+	if file := project.LevelFile(tmpDir, Level{}); file != filepath.Join(tmpDir, "base/shared.yaml") {
+		t.Errorf("Expected base/shared.yaml, got %s", file)
+	}
+
+	for content, message := range map[string]string{
+		"layout:\n  extension: json\n":                "invalid extension",
+		"layout:\n  app: apps/{app}.yml\n":            "must contain {env} once",
+		"layout:\n  shared: shared/{env}.json\n":      "must end in .yml or .yaml",
+		"layout:\n  shared: \"{region}/{env}.yml\"\n": "unknown placeholder {region}",
+		"layout:\n  app: /apps/{app}/{env}.yml\n":     "must be relative",
+		"layout:\n  app: ../{app}/{env}.yml\n":        "invalid app",
+	} {
+		os.WriteFile(filepath.Join(tmpDir, ProjectFile), []byte(content), 0644)
+		if _, err := LoadProject(tmpDir); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("%q: expected an error containing %q, got %v", content, message, err)
+		}
+	}
+}
+
+func TestLoadWithDimensions(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "puff-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	files := map[string]string{
+		ProjectFile: `dimensions:
+  - name: region
+    dir: "{env}/regions/{region}"
+  - name: cluster
+    after: target
+`,
+		"base/api.yml":                      "LEVEL: base_api\nREGION: none",
+		"prod/api.yml":                      "LEVEL: prod_api",
+		"prod/regions/eu-west-1/shared.yml": "REGION: eu-west-1\nLEVEL: region_shared",
+		"prod/regions/eu-west-1/api.yml":    "LEVEL: region_api",
+		"target-overrides/k8s/prod/api.yml": "LEVEL: target_api",
+		"cluster/blue/api.yml":              "LEVEL: cluster_api",
+	}
+	for file, content := range files {
+		path := filepath.Join(tmpDir, file)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+
+	tests := []struct {
+		name       string
+		target     string
+		dimensions map[string]string
+		expected   map[string]string
+	}{
+		{"no dimensions", "", nil, map[string]string{"LEVEL": "prod_api", "REGION": "none"}},
+		{"region after env", "", map[string]string{"region": "eu-west-1"}, map[string]string{"LEVEL": "region_api", "REGION": "eu-west-1"}},
+		{"target overrides region", "k8s", map[string]string{"region": "eu-west-1"}, map[string]string{"LEVEL": "target_api", "REGION": "eu-west-1"}},
+		{"cluster after target", "k8s", map[string]string{"region": "eu-west-1", "cluster": "blue"}, map[string]string{"LEVEL": "cluster_api", "REGION": "eu-west-1"}},
+		{"missing layer is skipped", "", map[string]string{"region": "us-east-1"}, map[string]string{"LEVEL": "prod_api", "REGION": "none"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(LoadContext{RootDir: tmpDir, App: "api", Env: "prod", Target: tt.target, Dimensions: tt.dimensions})
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			for key, want := range tt.expected {
+				if got, _ := cfg.GetString(key); got != want {
+					t.Errorf("%s: expected %q, got %q", key, want, got)
+				}
+			}
+		})
+	}
+
+	for _, dimensions := range []map[string]string{{"zone": "a"}, {"region": "../prod"}} {
+		if _, err := Load(LoadContext{RootDir: tmpDir, App: "api", Env: "prod", Dimensions: dimensions}); err == nil {
+			t.Errorf("Expected an error for dimensions %v", dimensions)
+		}
+	}
+
+	// Dimension directories aren't environments
+	layout, err := Discover(tmpDir)
+	if err != nil {
+		t.Fatalf("Discover failed: %v", err)
+	}
+	if !reflect.DeepEqual(layout.Envs, []string{"prod"}) {
+		t.Errorf("Expected envs [prod], got %v", layout.Envs)
+	}
+}
+
+func TestLoadProjectStores(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, ProjectFile), []byte("stores:\n  split: true\n  secret_keys: (KEY|TOKEN|PASSWORD)$\n"), 0644)
+	project, err := LoadProject(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadProject failed: %v", err)
+	}
+	for key, secret := range map[string]bool{"API_KEY": true, "DB_PASSWORD": true, "PORT": false, "LOG_LEVEL": false} {
+		if project.Stores.IsSecret(key) != secret {
+			t.Errorf("IsSecret(%s): expected %v", key, secret)
+		}
+	}
+
+	// Without a pattern, every key is a secret
+	if !(StoreSettings{Split: true}).IsSecret("PORT") {
+		t.Error("Expected keys to be secrets without a secret_keys pattern")
+	}
+
+	for content, message := range map[string]string{
+		"stores:\n  secret_keys: KEY$\n":                 "needs split: true",
+		"stores:\n  split: true\n  secret_keys: \"(\"\n": "invalid secret_keys",
+	} {
+		os.WriteFile(filepath.Join(tmpDir, ProjectFile), []byte(content), 0644)
+		if _, err := LoadProject(tmpDir); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("%q: expected an error containing %q, got %v", content, message, err)
+		}
+	}
+}
+
+func TestWriteFormat(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	// A new .puff.yaml holds just the format
+	if err := WriteFormat(tmpDir, 1); err != nil {
+		t.Fatalf("WriteFormat failed: %v", err)
+	}
+	project, err := LoadProject(tmpDir)
+	if err != nil {
+		t.Fatalf("LoadProject failed: %v", err)
+	}
+	if project.Format != 1 {
+		t.Errorf("Expected format 1, got %d", project.Format)
+	}
+
+	// An existing file keeps its comments and settings, and nested format
+	// settings are left alone
+	content := "# Project settings\ndefaults:\n  format: env\n"
+	os.WriteFile(filepath.Join(tmpDir, ProjectFile), []byte(content), 0644)
+	if err := WriteFormat(tmpDir, 1); err != nil {
+		t.Fatalf("WriteFormat failed: %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(tmpDir, ProjectFile))
+	if want := "# Project settings\nformat: 1\ndefaults:\n  format: env\n"; string(data) != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, data)
+	}
+
+	// The format is updated in place
+	os.WriteFile(filepath.Join(tmpDir, ProjectFile), []byte("defaults:\n  env: dev\nformat: 0 # legacy\n"), 0644)
+	if err := WriteFormat(tmpDir, 1); err != nil {
+		t.Fatalf("WriteFormat failed: %v", err)
+	}
+	data, _ = os.ReadFile(filepath.Join(tmpDir, ProjectFile))
+	if want := "defaults:\n  env: dev\nformat: 1\n"; string(data) != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, data)
+	}
+
+	// Repositories from a newer puff are refused
+	if err := WriteFormat(tmpDir, CurrentFormat+1); err != nil {
+		t.Fatalf("WriteFormat failed: %v", err)
+	}
+	if _, err := LoadProject(tmpDir); err == nil || !strings.Contains(err.Error(), "upgrade puff") {
+		t.Errorf("Expected a newer format to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Redact returns a config file with every value replaced, keeping its keys
+// and their order. Top-level keys with an entry in examples get that value,
+// and every other value becomes placeholder. The SOPS metadata and all
+// comments, which SOPS may have left in plaintext, are dropped. The key names
+// of encrypted files are stored in plaintext, so no key is needed.
+func Redact(data []byte, placeholder string, examples map[string]string) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return []byte{}, nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("expected a mapping of keys to values at line %d", root.Line)
+	}
+	var content []*yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		if key.Value == "sops" {
+			continue
+		}
+		stripComments(key)
+		if example, ok := examples[key.Value]; ok {
+			*value = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: example}
+		} else {
+			redactNode(value, placeholder)
+		}
+		content = append(content, key, value)
+	}
+	root.Content = content
+	stripComments(&doc)
+	stripComments(root)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to marshal YAML: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// redactNode replaces every scalar under a node with placeholder, keeping
+// the keys of mappings and the length of sequences
+func redactNode(node *yaml.Node, placeholder string) {
+	stripComments(node)
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			stripComments(node.Content[i])
+			redactNode(node.Content[i+1], placeholder)
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			redactNode(item, placeholder)
+		}
+	default:
+		*node = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: placeholder}
+	}
+}
+
+// stripComments drops the comments attached to a node
+func stripComments(node *yaml.Node) {
+	node.HeadComment = ""
+	node.LineComment = ""
+	node.FootComment = ""
+}
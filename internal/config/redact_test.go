@@ -0,0 +1,45 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	input := `# Database settings
+DB_HOST: ENC[AES256_GCM,data:abc,iv:def,tag:ghi,type:str]
+DB_PORT: 5432 # the default port
+_DB_URL: postgres://${DB_HOST}:${DB_PORT}
+FEATURES:
+  beta: true
+  regions: [us, eu]
+sops:
+  age:
+    - recipient: age1abc
+  mac: ENC[AES256_GCM,data:mac]
+`
+	output, err := Redact([]byte(input), "CHANGEME", map[string]string{"DB_PORT": "5432"})
+	if err != nil {
+		t.Fatalf("Redact failed: %v", err)
+	}
+
+	expected := `DB_HOST: CHANGEME
+DB_PORT: "5432"
+_DB_URL: CHANGEME
+FEATURES:
+  beta: CHANGEME
+  regions: [CHANGEME, CHANGEME]
+`
+	if string(output) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, output)
+	}
+	for _, leaked := range []string{"sops", "age1abc", "Database", "default port", "postgres"} {
+		if strings.Contains(string(output), leaked) {
+			t.Errorf("Redacted file contains %q", leaked)
+		}
+	}
+
+	if _, err := Redact([]byte("- a\n- b\n"), "CHANGEME", nil); err == nil {
+		t.Error("Expected a file that isn't a mapping to be rejected")
+	}
+}
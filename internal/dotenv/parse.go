@@ -0,0 +1,121 @@
+package dotenv
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Entry is a single KEY=VALUE assignment from a .env file
+type Entry struct {
+	Key   string
+	Value string
+	Line  int // Line number the entry starts on (1-based)
+}
+
+// Parse reads a .env file and returns its entries in file order.
+//
+// Supported syntax:
+//   - blank lines and lines starting with # are ignored
+//   - an optional leading "export " is stripped
+//   - unquoted values are trimmed and may have a trailing " # comment"
+//   - single-quoted values are taken literally
+//   - double-quoted values support \n, \r, \t, \" and \\ escapes and may span lines
+func Parse(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+
+		idx := strings.Index(line, "=")
+		if idx < 0 {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineNum)
+		}
+
+		key := strings.TrimSpace(line[:idx])
+		if key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("line %d: invalid key %q", lineNum, key)
+		}
+
+		startLine := lineNum
+		raw := strings.TrimSpace(line[idx+1:])
+
+		var value string
+		switch {
+		case strings.HasPrefix(raw, `"`):
+			// Double-quoted values may continue onto following lines
+			body := raw[1:]
+			for {
+				parsed, ok := parseDoubleQuoted(body)
+				if ok {
+					value = parsed
+					break
+				}
+				if !scanner.Scan() {
+					return nil, fmt.Errorf("line %d: unterminated double-quoted value for %s", startLine, key)
+				}
+				lineNum++
+				body += "\n" + scanner.Text()
+			}
+		case strings.HasPrefix(raw, "'"):
+			end := strings.Index(raw[1:], "'")
+			if end < 0 {
+				return nil, fmt.Errorf("line %d: unterminated single-quoted value for %s", startLine, key)
+			}
+			value = raw[1 : end+1]
+		default:
+			if i := strings.Index(raw, " #"); i >= 0 {
+				raw = raw[:i]
+			}
+			value = strings.TrimSpace(raw)
+		}
+
+		entries = append(entries, Entry{Key: key, Value: value, Line: startLine})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read .env data: %w", err)
+	}
+
+	return entries, nil
+}
+
+// parseDoubleQuoted unescapes the body of a double-quoted value (without the
+// opening quote). It returns false if the closing quote has not been found.
+func parseDoubleQuoted(body string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(body); i++ {
+		ch := body[i]
+		switch {
+		case ch == '\\' && i+1 < len(body):
+			i++
+			switch body[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				b.WriteByte(body[i])
+			}
+		case ch == '"':
+			return b.String(), true
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,70 @@
+package dotenv
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	input := `# Database settings
+DB_HOST=localhost
+export DB_PORT=5432
+EMPTY=
+SPACED = value with spaces # trailing comment
+SINGLE='literal $value # not a comment'
+DOUBLE="line1\nline2 \"quoted\" \\ done"
+MULTI="first
+second"
+URL=https://example.com/#anchor
+`
+
+	entries, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	expected := []struct {
+		key   string
+		value string
+	}{
+		{"DB_HOST", "localhost"},
+		{"DB_PORT", "5432"},
+		{"EMPTY", ""},
+		{"SPACED", "value with spaces"},
+		{"SINGLE", "literal $value # not a comment"},
+		{"DOUBLE", "line1\nline2 \"quoted\" \\ done"},
+		{"MULTI", "first\nsecond"},
+		{"URL", "https://example.com/#anchor"},
+	}
+
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d entries, got %d: %+v", len(expected), len(entries), entries)
+	}
+
+	for i, tt := range expected {
+		if entries[i].Key != tt.key || entries[i].Value != tt.value {
+			t.Errorf("Entry %d: expected %s=%q, got %s=%q", i, tt.key, tt.value, entries[i].Key, entries[i].Value)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"missing equals", "JUST_A_KEY\n"},
+		{"empty key", "=value\n"},
+		{"key with space", "MY KEY=value\n"},
+		{"unterminated double quote", "KEY=\"value\n"},
+		{"unterminated single quote", "KEY='value\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(strings.NewReader(tt.input)); err == nil {
+				t.Error("Expected error but got none")
+			}
+		})
+	}
+}
@@ -0,0 +1,627 @@
+// Package git reads the history of config files from the git repository
+// holding them with go-git, so commands that use it, such as history,
+// diff --git and generate --git-ref, read past revisions without a checkout
+// and without the git command line tool.
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// ErrNotFound is returned by Show when a file doesn't exist at a revision
+var ErrNotFound = errors.New("file not found at revision")
+
+// Commit is a commit that touched a file
+type Commit struct {
+	SHA    string
+	Author string
+	Date   string // YYYY-MM-DD
+	// Subject is the first line of the commit message
+	Subject string
+}
+
+// Short returns the abbreviated commit SHA
+func (c Commit) Short() string {
+	if len(c.SHA) > 7 {
+		return c.SHA[:7]
+	}
+	return c.SHA
+}
+
+// Repo is the git repository holding a config root. Its methods may be
+// called concurrently.
+type Repo struct {
+	root   string // Config root as given; paths passed in are under it
+	top    string // Top-level directory of the repository
+	prefix string // Config root relative to the top-level directory
+
+	mu      sync.Mutex // Guards repo, which go-git doesn't make safe for concurrent use
+	repo    *gogit.Repository
+	changes []change          // Changes to the config root, newest first, once loaded
+	blobs   map[string]string // Contents of the blobs read by FirstSeen
+}
+
+// change is a change a commit made to a file under the config root, with the
+// hashes of the file's blob before and after; a zero hash means the file
+// didn't exist
+type change struct {
+	date     string
+	from, to plumbing.Hash
+}
+
+// Open finds the git repository holding the config root
+func Open(rootDir string) (*Repo, error) {
+	abs, err := filepath.Abs(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	repo, err := gogit.PlainOpenWithOptions(abs, &gogit.PlainOpenOptions{DetectDotGit: true, EnableDotGitCommonDir: true})
+	if err != nil {
+		return nil, fmt.Errorf("%s is not in a git repository: %w", rootDir, err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("%s is not in a git working tree: %w", rootDir, err)
+	}
+	top := worktree.Filesystem.Root()
+	prefix, err := filepath.Rel(top, abs)
+	if err != nil {
+		return nil, err
+	}
+	r := &Repo{root: rootDir, top: top, repo: repo}
+	if prefix != "." {
+		r.prefix = filepath.ToSlash(prefix)
+	}
+	return r, nil
+}
+
+// Log returns the commits that touched a file under the config root,
+// newest first
+func (r *Repo) Log(file string) ([]Commit, error) {
+	name, err := r.name(file)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	head, err := r.head()
+	if err != nil || head == nil {
+		return nil, err
+	}
+	iter, err := r.repo.Log(&gogit.LogOptions{From: head.Hash, Order: gogit.LogOrderCommitterTime, FileName: &name})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	var commits []Commit
+	err = iter.ForEach(func(commit *object.Commit) error {
+		subject, _, _ := strings.Cut(commit.Message, "\n")
+		commits = append(commits, Commit{
+			SHA:     commit.Hash.String(),
+			Author:  commit.Author.Name,
+			Date:    commit.Author.When.Format("2006-01-02"),
+			Subject: strings.TrimSpace(subject),
+		})
+		return nil
+	})
+	return commits, err
+}
+
+// FirstSeen returns the date of the first commit that added text to a file
+// under the config root, or "" if no commit has. Like git log -S, it looks
+// for commits changing how often the text occurs, leaving out merges.
+func (r *Repo) FirstSeen(text string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.changes == nil {
+		if err := r.loadChanges(); err != nil {
+			return "", err
+		}
+	}
+	for i := len(r.changes) - 1; i >= 0; i-- {
+		before, err := r.count(r.changes[i].from, text)
+		if err != nil {
+			return "", err
+		}
+		after, err := r.count(r.changes[i].to, text)
+		if err != nil {
+			return "", err
+		}
+		if before != after {
+			return r.changes[i].date, nil
+		}
+	}
+	return "", nil
+}
+
+// loadChanges lists the changes every commit but merges made to the files
+// under the config root, newest first
+func (r *Repo) loadChanges() error {
+	r.changes = []change{}
+	r.blobs = make(map[string]string)
+	head, err := r.head()
+	if err != nil || head == nil {
+		return err
+	}
+	iter, err := r.repo.Log(&gogit.LogOptions{From: head.Hash, Order: gogit.LogOrderCommitterTime})
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	return iter.ForEach(func(commit *object.Commit) error {
+		if commit.NumParents() > 1 {
+			return nil
+		}
+		tree, err := r.subtree(commit)
+		if err != nil {
+			return err
+		}
+		var parentTree *object.Tree
+		if commit.NumParents() == 1 {
+			parent, err := commit.Parent(0)
+			if err != nil {
+				return err
+			}
+			if parentTree, err = r.subtree(parent); err != nil {
+				return err
+			}
+		}
+		if tree == nil && parentTree == nil || tree != nil && parentTree != nil && tree.Hash == parentTree.Hash {
+			return nil
+		}
+		changes, err := object.DiffTree(parentTree, tree)
+		if err != nil {
+			return err
+		}
+		date := commit.Author.When.Format("2006-01-02")
+		for _, c := range changes {
+			r.changes = append(r.changes, change{date: date, from: c.From.TreeEntry.Hash, to: c.To.TreeEntry.Hash})
+		}
+		return nil
+	})
+}
+
+// count returns how often text occurs in a blob, or 0 for the zero hash
+func (r *Repo) count(hash plumbing.Hash, text string) (int, error) {
+	if hash.IsZero() {
+		return 0, nil
+	}
+	contents, ok := r.blobs[hash.String()]
+	if !ok {
+		data, err := r.readBlob(hash)
+		if err != nil {
+			return 0, err
+		}
+		contents = string(data)
+		r.blobs[hash.String()] = contents
+	}
+	return strings.Count(contents, text), nil
+}
+
+// Show returns the contents of a file under the config root at a revision,
+// or ErrNotFound if the file didn't exist then
+func (r *Repo) Show(revision, file string) ([]byte, error) {
+	name, err := r.name(file)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	commit, err := r.commit(revision)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	entry, err := tree.FindEntry(name)
+	if errors.Is(err, object.ErrEntryNotFound) || errors.Is(err, object.ErrDirectoryNotFound) || err == nil && !entry.Mode.IsFile() {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return r.readBlob(entry.Hash)
+}
+
+// FilesAt returns the files under the config root at a revision, relative to
+// the config root and with forward slashes
+func (r *Repo) FilesAt(revision string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	commit, err := r.commit(revision)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := r.subtree(commit)
+	if err != nil || tree == nil {
+		return nil, err
+	}
+
+	var files []string
+	err = tree.Files().ForEach(func(file *object.File) error {
+		files = append(files, file.Name)
+		return nil
+	})
+	return files, err
+}
+
+// StagedFiles returns the files under the config root that are added,
+// copied, modified, or renamed in the index
+func (r *Repo) StagedFiles() ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	index, err := r.repo.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+	committed := make(map[string]plumbing.Hash)
+	head, err := r.head()
+	if err != nil {
+		return nil, err
+	}
+	if head != nil {
+		tree, err := head.Tree()
+		if err != nil {
+			return nil, err
+		}
+		err = tree.Files().ForEach(func(file *object.File) error {
+			committed[file.Name] = file.Hash
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var files []string
+	for _, entry := range index.Entries {
+		rel, ok := r.relative(entry.Name)
+		if !ok {
+			continue
+		}
+		if hash, exists := committed[entry.Name]; exists && hash == entry.Hash {
+			continue
+		}
+		files = append(files, filepath.Join(r.root, filepath.FromSlash(rel)))
+	}
+	return files, nil
+}
+
+// Modified reports whether any file under the config root differs from the
+// last commit, staged or not, or is untracked and not ignored
+func (r *Repo) Modified() (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	worktree, err := r.repo.Worktree()
+	if err != nil {
+		return false, err
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		return false, err
+	}
+	for name, file := range status {
+		if _, ok := r.relative(name); ok && (file.Staging != gogit.Unmodified || file.Worktree != gogit.Unmodified) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ReadStaged returns the contents of a file under the config root as it is
+// staged in the index
+func (r *Repo) ReadStaged(file string) ([]byte, error) {
+	name, err := r.name(file)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	index, err := r.repo.Storer.Index()
+	if err != nil {
+		return nil, err
+	}
+	entry, err := index.Entry(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not in the index", name)
+	}
+	return r.readBlob(entry.Hash)
+}
+
+// HooksDir returns the directory git runs hooks from, honoring core.hooksPath
+func (r *Repo) HooksDir() (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := r.repo.ConfigScoped(config.SystemScope)
+	if err != nil {
+		return "", err
+	}
+	if dir := cfg.Raw.Section("core").Option("hooksPath"); dir != "" {
+		if rest, ok := strings.CutPrefix(dir, "~/"); ok {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", err
+			}
+			dir = filepath.Join(home, rest)
+		}
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(r.top, dir)
+		}
+		return dir, nil
+	}
+	gitDir, err := commonDir(r.top)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(gitDir, "hooks"), nil
+}
+
+// Prefix returns the config root relative to the top-level directory of the
+// repository, or "." if they are the same
+func (r *Repo) Prefix() string {
+	if r.prefix == "" {
+		return "."
+	}
+	return r.prefix
+}
+
+// ReadFileAt returns a function that reads files under the config root as
+// they were at a revision, such as for config.LoadContext.ReadFile. Files
+// that didn't exist then yield an error satisfying os.IsNotExist.
+func (r *Repo) ReadFileAt(revision string) func(string) ([]byte, error) {
+	return func(file string) ([]byte, error) {
+		data, err := r.Show(revision, file)
+		if errors.Is(err, ErrNotFound) {
+			return nil, &fs.PathError{Op: "read", Path: file, Err: fs.ErrNotExist}
+		}
+		return data, err
+	}
+}
+
+// ResolveRevision returns the full SHA of the commit a revision names
+func (r *Repo) ResolveRevision(revision string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	commit, err := r.commit(revision)
+	if err != nil {
+		return "", err
+	}
+	return commit.Hash.String(), nil
+}
+
+// Identity returns the configured git user as "Name <email>", or an empty
+// string if neither is set. dir need not be in a repository.
+func Identity(dir string) string {
+	var cfg *config.Config
+	if repo, err := gogit.PlainOpenWithOptions(dir, &gogit.PlainOpenOptions{DetectDotGit: true, EnableDotGitCommonDir: true}); err == nil {
+		cfg, _ = repo.ConfigScoped(config.SystemScope)
+	}
+	if cfg == nil {
+		var err error
+		if cfg, err = config.LoadConfig(config.GlobalScope); err != nil {
+			return ""
+		}
+	}
+
+	var parts []string
+	if cfg.User.Name != "" {
+		parts = append(parts, cfg.User.Name)
+	}
+	if cfg.User.Email != "" {
+		parts = append(parts, "<"+cfg.User.Email+">")
+	}
+	return strings.Join(parts, " ")
+}
+
+// Config returns the value of a setting in the repository's local config
+func (r *Repo) Config(key string) (string, bool) {
+	section, subsection, option, err := splitKey(key)
+	if err != nil {
+		return "", false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := r.repo.Config()
+	if err != nil || !cfg.Raw.HasSection(section) {
+		return "", false
+	}
+	if subsection == "" {
+		s := cfg.Raw.Section(section)
+		return s.Option(option), s.HasOption(option)
+	}
+	if !cfg.Raw.Section(section).HasSubsection(subsection) {
+		return "", false
+	}
+	s := cfg.Raw.Section(section).Subsection(subsection)
+	return s.Option(option), s.HasOption(option)
+}
+
+// SetConfig sets a setting in the repository's local config
+func (r *Repo) SetConfig(key, value string) error {
+	section, subsection, option, err := splitKey(key)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := r.repo.Config()
+	if err != nil {
+		return err
+	}
+	cfg.Raw.SetOption(section, subsection, option, value)
+	return r.repo.SetConfig(cfg)
+}
+
+// RemoveConfigSection removes a section, such as "merge.puff", from the
+// repository's local config. A missing section is not an error.
+func (r *Repo) RemoveConfigSection(name string) error {
+	section, subsection, _ := strings.Cut(name, ".")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg, err := r.repo.Config()
+	if err != nil || !cfg.Raw.HasSection(section) {
+		return err
+	}
+	if subsection == "" {
+		cfg.Raw.RemoveSection(section)
+	} else if cfg.Raw.Section(section).HasSubsection(subsection) {
+		cfg.Raw.RemoveSubsection(section, subsection)
+		if s := cfg.Raw.Section(section); len(s.Options) == 0 && len(s.Subsections) == 0 {
+			cfg.Raw.RemoveSection(section)
+		}
+	} else {
+		return nil
+	}
+	return r.repo.SetConfig(cfg)
+}
+
+// splitKey splits a config key, such as merge.puff.driver, into its section,
+// subsection and option
+func splitKey(key string) (section, subsection, option string, err error) {
+	first, last := strings.Index(key, "."), strings.LastIndex(key, ".")
+	if first <= 0 || last == len(key)-1 {
+		return "", "", "", fmt.Errorf("invalid git config key: %s", key)
+	}
+	section, option = key[:first], key[last+1:]
+	if first != last {
+		subsection = key[first+1 : last]
+	}
+	return section, subsection, option, nil
+}
+
+// head returns the commit HEAD points to, or nil in a repository without
+// commits
+func (r *Repo) head() (*object.Commit, error) {
+	ref, err := r.repo.Head()
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return r.repo.CommitObject(ref.Hash())
+}
+
+// commit returns the commit a revision names
+func (r *Repo) commit(revision string) (*object.Commit, error) {
+	hash, err := r.repo.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		return nil, fmt.Errorf("unknown git revision: %s", revision)
+	}
+	commit, err := r.repo.CommitObject(*hash)
+	if err != nil {
+		return nil, fmt.Errorf("unknown git revision: %s", revision)
+	}
+	return commit, nil
+}
+
+// subtree returns the tree of the config root at a commit, or nil if the
+// config root didn't exist then
+func (r *Repo) subtree(commit *object.Commit) (*object.Tree, error) {
+	tree, err := commit.Tree()
+	if err != nil || r.prefix == "" {
+		return tree, err
+	}
+	subtree, err := tree.Tree(r.prefix)
+	if errors.Is(err, object.ErrDirectoryNotFound) || errors.Is(err, object.ErrEntryNotFound) {
+		return nil, nil
+	}
+	return subtree, err
+}
+
+// readBlob returns the contents of a blob
+func (r *Repo) readBlob(hash plumbing.Hash) ([]byte, error) {
+	blob, err := r.repo.BlobObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// commonDir returns the git directory shared by the working trees of the
+// repository at top: .git, or for a linked working tree, the directory its
+// .git file points to the common directory of
+func commonDir(top string) (string, error) {
+	dir := filepath.Join(top, ".git")
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return dir, nil
+	}
+	data, err := os.ReadFile(dir)
+	if err != nil {
+		return "", err
+	}
+	gitDir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+	if !ok {
+		return "", fmt.Errorf("unexpected contents of %s", dir)
+	}
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(top, gitDir)
+	}
+	common, err := os.ReadFile(filepath.Join(gitDir, "commondir"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return gitDir, nil
+	} else if err != nil {
+		return "", err
+	}
+	commonDir := strings.TrimSpace(string(common))
+	if !filepath.IsAbs(commonDir) {
+		commonDir = filepath.Join(gitDir, commonDir)
+	}
+	return commonDir, nil
+}
+
+// relative returns a path relative to the top-level directory, with forward
+// slashes, relative to the config root, and whether it is under it
+func (r *Repo) relative(name string) (string, bool) {
+	if r.prefix == "" {
+		return name, true
+	}
+	rel, ok := strings.CutPrefix(name, r.prefix+"/")
+	return rel, ok
+}
+
+// name returns the path of a file under the config root relative to the
+// top-level directory, as git expects it
+func (r *Repo) name(file string) (string, error) {
+	rel, err := filepath.Rel(r.root, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the config root", file)
+	}
+	return path.Join(r.prefix, filepath.ToSlash(rel)), nil
+}
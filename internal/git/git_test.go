@@ -0,0 +1,189 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestRepo(t *testing.T) {
+	// Nothing runs the git command line tool
+	t.Setenv("PATH", t.TempDir())
+
+	top := t.TempDir()
+	root := filepath.Join(top, "config")
+	os.MkdirAll(filepath.Join(root, "dev"), 0755)
+	file := filepath.Join(root, "dev", "api.yml")
+
+	fixture, err := gogit.PlainInit(top, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := fixture.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	add := func() {
+		t.Helper()
+		if err := worktree.AddWithOptions(&gogit.AddOptions{All: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	when := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	commit := func(message string) {
+		t.Helper()
+		add()
+		when = when.Add(24 * time.Hour)
+		if _, err := worktree.Commit(message, &gogit.CommitOptions{Author: &object.Signature{Name: "Bob", Email: "bob@example.com", When: when}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.WriteFile(file, []byte("PORT: 80\n"), 0644)
+	commit("First")
+	os.WriteFile(file, []byte("PORT: 8080\n"), 0644)
+	commit("Second\n\nWith a body")
+
+	repo, err := Open(root)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if repo.prefix != "config" {
+		t.Errorf("Expected prefix config, got %q", repo.prefix)
+	}
+
+	commits, err := repo.Log(file)
+	if err != nil {
+		t.Fatalf("Log failed: %v", err)
+	}
+	if len(commits) != 2 || commits[0].Subject != "Second" || commits[1].Author != "Bob" || commits[1].Date != "2024-03-02" || len(commits[0].Short()) != 7 {
+		t.Fatalf("Unexpected commits: %+v", commits)
+	}
+
+	if date, err := repo.FirstSeen("PORT: 8080"); err != nil || date != commits[0].Date {
+		t.Errorf("Expected PORT: 8080 to be first seen on %s, got %q (%v)", commits[0].Date, date, err)
+	}
+	if date, err := repo.FirstSeen("PORT: 443"); err != nil || date != "" {
+		t.Errorf("Expected PORT: 443 never to be seen, got %q (%v)", date, err)
+	}
+
+	data, err := repo.Show(commits[1].SHA, file)
+	if err != nil || string(data) != "PORT: 80\n" {
+		t.Errorf("Expected the first revision, got %q (%v)", data, err)
+	}
+	if _, err := repo.Show("HEAD", filepath.Join(root, "prod", "api.yml")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if _, err := repo.Show("no-such-branch", file); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected an unknown revision error, got %v", err)
+	}
+	if data, err := repo.Show("HEAD~1", file); err != nil || string(data) != "PORT: 80\n" {
+		t.Errorf("Expected HEAD~1 to be the first revision, got %q (%v)", data, err)
+	}
+	if sha, err := repo.ResolveRevision(commits[1].Short()); err != nil || sha != commits[1].SHA {
+		t.Errorf("Expected the abbreviated SHA to resolve to %s, got %q (%v)", commits[1].SHA, sha, err)
+	}
+	if files, err := repo.FilesAt("HEAD"); err != nil || len(files) != 1 || files[0] != "dev/api.yml" {
+		t.Errorf("Expected dev/api.yml relative to the config root, got %v (%v)", files, err)
+	}
+	if _, err := repo.Log(filepath.Join(top, "outside.yml")); err == nil {
+		t.Error("Expected an error for a file outside the config root")
+	}
+
+	// Changes outside the config root don't modify it
+	os.WriteFile(filepath.Join(top, "outside.yml"), []byte("A: 1\n"), 0644)
+	if modified, err := repo.Modified(); err != nil || modified {
+		t.Errorf("Expected the config root to be unmodified, got %v (%v)", modified, err)
+	}
+
+	// Only staged files under the config root are listed
+	os.WriteFile(file, []byte("PORT: 9090\n"), 0644)
+	add()
+	os.WriteFile(file, []byte("PORT: 1\n"), 0644)
+	staged, err := repo.StagedFiles()
+	if err != nil || len(staged) != 1 || staged[0] != file {
+		t.Errorf("Expected %s to be staged, got %v (%v)", file, staged, err)
+	}
+	if data, err := repo.ReadStaged(file); err != nil || string(data) != "PORT: 9090\n" {
+		t.Errorf("Expected the staged contents, got %q (%v)", data, err)
+	}
+	if modified, err := repo.Modified(); err != nil || !modified {
+		t.Errorf("Expected the config root to be modified, got %v (%v)", modified, err)
+	}
+	if dir, err := repo.HooksDir(); err != nil || dir != filepath.Join(top, ".git", "hooks") {
+		t.Errorf("Unexpected hooks dir %q (%v)", dir, err)
+	}
+
+	if err := repo.SetConfig("merge.test.driver", "cat"); err != nil {
+		t.Fatalf("SetConfig failed: %v", err)
+	}
+	if value, ok := repo.Config("merge.test.driver"); !ok || value != "cat" {
+		t.Errorf("Expected the setting to be cat, got %q", value)
+	}
+	for i := 0; i < 2; i++ {
+		if err := repo.RemoveConfigSection("merge.test"); err != nil {
+			t.Fatalf("RemoveConfigSection failed: %v", err)
+		}
+	}
+	if _, ok := repo.Config("merge.test.driver"); ok {
+		t.Error("Expected the setting to be removed")
+	}
+	if err := repo.SetConfig("core.hooksPath", "hooks"); err != nil {
+		t.Fatalf("SetConfig failed: %v", err)
+	}
+	if dir, err := repo.HooksDir(); err != nil || dir != filepath.Join(top, "hooks") {
+		t.Errorf("Expected core.hooksPath to be honored, got %q (%v)", dir, err)
+	}
+}
+
+func TestMergeFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(content), 0644)
+		return path
+	}
+	labels := [3]string{"ours", "base", "theirs"}
+
+	base := write("base", "a\nb\nc\n")
+	current := write("current", "A\nb\nc\n")
+	conflicts, err := MergeFile(current, base, write("other", "a\nb\nC\n"), labels)
+	if err != nil || conflicts {
+		t.Fatalf("Expected a clean merge, got %v, %v", conflicts, err)
+	}
+	if data, _ := os.ReadFile(current); string(data) != "A\nb\nC\n" {
+		t.Errorf("Unexpected merge result: %q", data)
+	}
+
+	conflicts, err = MergeFile(current, base, write("other", "a\nb\nX\n"), labels)
+	if err != nil || !conflicts {
+		t.Errorf("Expected conflicts, got %v, %v", conflicts, err)
+	}
+	want := "A\nb\n<<<<<<< ours\nC\n||||||| base\nc\n=======\nX\n>>>>>>> theirs\n"
+	if data, _ := os.ReadFile(current); string(data) != want {
+		t.Errorf("Unexpected conflict markers:\n%s", data)
+	}
+
+	// Lines added at the same place on both sides conflict unless they're
+	// the same, and a missing final newline doesn't run into a marker
+	current = write("current", "a\nb\nc\nnew")
+	conflicts, err = MergeFile(current, base, write("other", "a\nb\nc\nnew"), labels)
+	if data, _ := os.ReadFile(current); err != nil || conflicts || string(data) != "a\nb\nc\nnew" {
+		t.Errorf("Expected the same addition to merge cleanly, got %q, %v, %v", data, conflicts, err)
+	}
+	conflicts, err = MergeFile(current, base, write("other", "a\nb\nc\nother\n"), labels)
+	if data, _ := os.ReadFile(current); err != nil || !conflicts || !strings.Contains(string(data), "new\n||||||| base\n") {
+		t.Errorf("Expected a conflict with the marker on its own line, got %q, %v, %v", data, conflicts, err)
+	}
+}
+
+func TestOpenOutsideRepository(t *testing.T) {
+	if _, err := Open(t.TempDir()); err == nil || !strings.Contains(err.Error(), "is not in a git repository") {
+		t.Errorf("Expected an error outside a repository, got %v", err)
+	}
+}
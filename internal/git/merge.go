@@ -0,0 +1,122 @@
+package git
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// MergeFile merges the changes from base to other into current, as
+// `git merge-file --diff3` does, and reports whether the merge left
+// conflicts. The labels name current, base, and other in conflict markers.
+func MergeFile(current, base, other string, labels [3]string) (conflicts bool, err error) {
+	versions := make([][]string, 3)
+	for i, file := range []string{current, base, other} {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return false, err
+		}
+		versions[i] = splitLines(string(data))
+	}
+	merged, conflicts := merge3(versions[0], versions[1], versions[2], labels)
+	return conflicts, os.WriteFile(current, []byte(strings.Join(merged, "")), 0644)
+}
+
+// merge3 merges the lines of two versions of a file with their common base.
+// Runs of lines both versions kept from the base split the files into hunks;
+// a hunk only one side changed takes that side's lines, and a hunk both
+// changed differently is a conflict, written between markers.
+func merge3(current, base, other []string, labels [3]string) ([]string, bool) {
+	currentMatch := matchLines(base, current)
+	otherMatch := matchLines(base, other)
+
+	var merged []string
+	conflicts := false
+	b, c, o := 0, 0, 0
+	for {
+		// Lines kept on both sides
+		for b < len(base) && currentMatch[b] == c && otherMatch[b] == o {
+			merged = append(merged, base[b])
+			b, c, o = b+1, c+1, o+1
+		}
+		if b == len(base) && c == len(current) && o == len(other) {
+			return merged, conflicts
+		}
+
+		// The hunk runs to the next base line both sides kept
+		next := b
+		for next < len(base) && (currentMatch[next] < 0 || otherMatch[next] < 0) {
+			next++
+		}
+		currentEnd, otherEnd := len(current), len(other)
+		if next < len(base) {
+			currentEnd, otherEnd = currentMatch[next], otherMatch[next]
+		}
+		baseHunk, currentHunk, otherHunk := base[b:next], current[c:currentEnd], other[o:otherEnd]
+
+		switch {
+		case slices.Equal(currentHunk, baseHunk):
+			merged = append(merged, otherHunk...)
+		case slices.Equal(otherHunk, baseHunk), slices.Equal(currentHunk, otherHunk):
+			merged = append(merged, currentHunk...)
+		default:
+			conflicts = true
+			merged = append(merged, "<<<<<<< "+labels[0]+"\n")
+			merged = append(merged, terminated(currentHunk)...)
+			merged = append(merged, "||||||| "+labels[1]+"\n")
+			merged = append(merged, terminated(baseHunk)...)
+			merged = append(merged, "=======\n")
+			merged = append(merged, terminated(otherHunk)...)
+			merged = append(merged, ">>>>>>> "+labels[2]+"\n")
+		}
+		b, c, o = next, currentEnd, otherEnd
+	}
+}
+
+// matchLines returns, for each line of base, the index of the line it
+// matches in a changed version, or -1 if the line was removed or changed
+func matchLines(base, changed []string) []int {
+	dmp := diffmatchpatch.New()
+	baseRunes, changedRunes, _ := dmp.DiffLinesToRunes(strings.Join(base, ""), strings.Join(changed, ""))
+	match := make([]int, len(base))
+	for i := range match {
+		match[i] = -1
+	}
+	b, c := 0, 0
+	for _, diff := range dmp.DiffMainRunes(baseRunes, changedRunes, false) {
+		n := utf8.RuneCountInString(diff.Text)
+		switch diff.Type {
+		case diffmatchpatch.DiffEqual:
+			for i := 0; i < n; i++ {
+				match[b+i] = c + i
+			}
+			b, c = b+n, c+n
+		case diffmatchpatch.DiffDelete:
+			b += n
+		case diffmatchpatch.DiffInsert:
+			c += n
+		}
+	}
+	return match
+}
+
+// splitLines splits text into lines, keeping their line endings
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// terminated returns lines with a line ending added to the last one if it
+// has none, so a conflict marker after it starts a line
+func terminated(lines []string) []string {
+	if len(lines) == 0 || strings.HasSuffix(lines[len(lines)-1], "\n") {
+		return lines
+	}
+	return append(slices.Clone(lines[:len(lines)-1]), lines[len(lines)-1]+"\n")
+}
@@ -0,0 +1,151 @@
+package keys
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/teamcurri/puff/internal/config"
+)
+
+// AuditReport describes which keys can decrypt which files
+type AuditReport struct {
+	Files []AuditFile `json:"files"`
+	// Recipients lists the keys in .sops.yaml followed by any other keys
+	// found in the files
+	Recipients []string `json:"recipients"`
+	// Unconfigured lists keys that files are encrypted to but that are
+	// missing from .sops.yaml
+	Unconfigured []string `json:"unconfigured"`
+}
+
+// AuditFile holds the recipients of one encrypted file
+type AuditFile struct {
+	Path       string   `json:"path"` // Relative to the config root
+	Env        string   `json:"env"`
+	Recipients []string `json:"recipients"`
+	// Missing lists the required keys the file is not encrypted to
+	Missing []string `json:"missing"`
+}
+
+// HasRecipient reports whether key is one of the file's recipients
+func (f AuditFile) HasRecipient(key string) bool {
+	for _, recipient := range f.Recipients {
+		if recipient == key {
+			return true
+		}
+	}
+	return false
+}
+
+// HasFindings reports whether any file is missing a required key or any
+// key is missing from .sops.yaml
+func (r *AuditReport) HasFindings() bool {
+	if len(r.Unconfigured) > 0 {
+		return true
+	}
+	for _, file := range r.Files {
+		if len(file.Missing) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Audit reads the recipients of every encrypted file without decrypting
+// anything, and checks them against .sops.yaml and the required keys
+func Audit(rootDir string, required []string) (*AuditReport, error) {
+	sopsConfig, err := LoadSOPSConfig(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	configured := sopsConfig.AllKeys()
+
+	files, err := findEncryptedFiles(rootDir, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find encrypted files: %w", err)
+	}
+	sort.Strings(files)
+	project, err := config.LoadProject(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &AuditReport{
+		Files:        make([]AuditFile, 0, len(files)),
+		Recipients:   append([]string{}, configured...),
+		Unconfigured: []string{},
+	}
+	known := make(map[string]bool)
+	for _, key := range configured {
+		known[key] = true
+	}
+
+	for _, path := range files {
+		groups, err := ReadKeyGroups(path)
+		if err != nil {
+			return nil, err
+		}
+
+		file := AuditFile{
+			Path:       relativePath(rootDir, path),
+			Env:        fileEnv(project, rootDir, path),
+			Recipients: []string{},
+			Missing:    []string{},
+		}
+		for _, group := range groups.Groups {
+			for _, key := range group {
+				if file.HasRecipient(key) {
+					continue
+				}
+				file.Recipients = append(file.Recipients, key)
+				if !known[key] {
+					known[key] = true
+					report.Recipients = append(report.Recipients, key)
+					report.Unconfigured = append(report.Unconfigured, key)
+				}
+			}
+		}
+		for _, key := range required {
+			if !file.HasRecipient(key) {
+				file.Missing = append(file.Missing, key)
+			}
+		}
+
+		report.Files = append(report.Files, file)
+	}
+
+	return report, nil
+}
+
+// fileEnv returns the environment a config file belongs to: "base", the
+// environment name, or "target:NAME" for target overrides
+func fileEnv(project *config.Project, rootDir, path string) string {
+	relPath, _ := filepath.Rel(rootDir, path)
+	if project.Layout.Custom() {
+		level, _ := project.FileLevel(relPath)
+		switch {
+		case level.Target != "":
+			return fmt.Sprintf("target:%s", level.Target)
+		case level.Env == "":
+			return "base"
+		}
+		return level.Env
+	}
+	env := filepath.Dir(relPath)
+	if env == "base" || env == "." {
+		return "base"
+	}
+	if filepath.Dir(env) == "target-overrides" {
+		return fmt.Sprintf("target:%s", filepath.Base(env))
+	}
+	return env
+}
+
+// relativePath returns path relative to the config root
+func relativePath(rootDir, path string) string {
+	if rel, err := filepath.Rel(rootDir, path); err == nil {
+		return rel
+	}
+	return path
+}
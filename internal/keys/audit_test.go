@@ -0,0 +1,61 @@
+package keys
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	dir := t.TempDir()
+	write := func(path, content string) {
+		t.Helper()
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only SOPS metadata is read, so the files need no real ciphertext
+	write(".sops.yaml", "creation_rules:\n  - path_regex: .*\\.yml$\n    age: age1team,age1deploy\n")
+	write("base/shared.yml", "sops:\n  age:\n    - recipient: age1team\n")
+	write("prod/api.yml", "sops:\n  age:\n    - recipient: age1team\n    - recipient: age1deploy\n")
+	write("target-overrides/k8s/api.yml", "sops:\n  age:\n    - recipient: age1team\n    - recipient: age1stale\n")
+	write("dev/notes.yml", "plain: true\n")
+
+	report, err := Audit(dir, []string{"age1deploy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Files) != 3 {
+		t.Fatalf("Expected 3 encrypted files, got %+v", report.Files)
+	}
+	expected := []struct {
+		path, env string
+		missing   int
+	}{
+		{"base/shared.yml", "base", 1},
+		{"prod/api.yml", "prod", 0},
+		{filepath.Join("target-overrides", "k8s", "api.yml"), "target:k8s", 1},
+	}
+	for i, want := range expected {
+		file := report.Files[i]
+		if file.Path != want.path || file.Env != want.env || len(file.Missing) != want.missing {
+			t.Errorf("Expected %s (%s) missing %d key(s), got %+v", want.path, want.env, want.missing, file)
+		}
+	}
+
+	if len(report.Recipients) != 3 || report.Recipients[2] != "age1stale" {
+		t.Errorf("Expected configured keys followed by age1stale, got %v", report.Recipients)
+	}
+	if len(report.Unconfigured) != 1 || report.Unconfigured[0] != "age1stale" {
+		t.Errorf("Expected age1stale to be flagged as unconfigured, got %v", report.Unconfigured)
+	}
+	if !report.HasFindings() {
+		t.Error("Expected the report to have findings")
+	}
+}
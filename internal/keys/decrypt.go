@@ -0,0 +1,75 @@
+package keys
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/getsops/sops/v3/aes"
+	"github.com/getsops/sops/v3/age"
+	"github.com/getsops/sops/v3/keyservice"
+	sopsyaml "github.com/getsops/sops/v3/stores/yaml"
+)
+
+// IdentityDecrypter returns a function that decrypts SOPS-encrypted YAML with
+// the given age identities in place of those SOPS finds in the environment,
+// for config.LoadContext.Decrypt. Files encrypted with other kinds of keys,
+// such as KMS, are decrypted as SOPS always does.
+func IdentityDecrypter(identities ...string) (func(data []byte) ([]byte, error), error) {
+	var parsed age.ParsedIdentities
+	if err := parsed.Import(identities...); err != nil {
+		return nil, fmt.Errorf("failed to parse age identity: %w", err)
+	}
+	services := []keyservice.KeyServiceClient{
+		keyservice.NewCustomLocalClient(identityKeyService{identities: parsed}),
+	}
+
+	return func(data []byte) ([]byte, error) {
+		store := sopsyaml.Store{}
+		tree, err := store.LoadEncryptedFile(data)
+		if err != nil {
+			return nil, err
+		}
+		dataKey, err := tree.Metadata.GetDataKeyWithKeyServices(services, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		cipher := aes.NewCipher()
+		mac, err := tree.Decrypt(dataKey, cipher)
+		if err != nil {
+			return nil, err
+		}
+		// As in SOPS, check the MAC so a tampered file isn't accepted
+		originalMac, err := cipher.Decrypt(tree.Metadata.MessageAuthenticationCode, dataKey, tree.Metadata.LastModified.Format(time.RFC3339))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt MAC: %w", err)
+		}
+		if originalMac != mac {
+			return nil, fmt.Errorf("failed to verify data integrity: MAC mismatch")
+		}
+		return store.EmitPlainFile(tree.Branches)
+	}, nil
+}
+
+// identityKeyService is a SOPS key service that decrypts age keys with its
+// own identities and hands every other request to the default local server
+type identityKeyService struct {
+	keyservice.Server
+	identities age.ParsedIdentities
+}
+
+// Decrypt decrypts a data key, using only the service's identities for age
+func (s identityKeyService) Decrypt(ctx context.Context, req *keyservice.DecryptRequest) (*keyservice.DecryptResponse, error) {
+	ageKey, ok := req.Key.KeyType.(*keyservice.Key_AgeKey)
+	if !ok {
+		return s.Server.Decrypt(ctx, req)
+	}
+	key := age.MasterKey{Recipient: ageKey.AgeKey.Recipient, EncryptedKey: string(req.Ciphertext)}
+	s.identities.ApplyToMasterKey(&key)
+	plaintext, err := key.Decrypt()
+	if err != nil {
+		return nil, err
+	}
+	return &keyservice.DecryptResponse{Plaintext: plaintext}, nil
+}
@@ -0,0 +1,322 @@
+package keys
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/getsops/sops/v3"
+	"github.com/getsops/sops/v3/keyservice"
+	sopsyaml "github.com/getsops/sops/v3/stores/yaml"
+	"github.com/teamcurri/puff/internal/parallel"
+	"github.com/teamcurri/puff/internal/safefile"
+	"gopkg.in/yaml.v3"
+)
+
+// KeyGroups describes how a file's data key is protected. With a single
+// group any one key can decrypt; with several, the data key is split with
+// Shamir's secret sharing and Threshold groups are needed to decrypt.
+type KeyGroups struct {
+	Groups    [][]string
+	Threshold int
+}
+
+// FileKeyGroups holds the key groups of one encrypted file
+type FileKeyGroups struct {
+	Path string
+	KeyGroups
+}
+
+// SingleGroup returns key groups where any of the given keys can decrypt
+func SingleGroup(keys []string) KeyGroups {
+	return KeyGroups{Groups: [][]string{keys}}
+}
+
+// IsShamir reports whether decrypting requires keys from more than one group
+func (g KeyGroups) IsShamir() bool {
+	return len(g.Groups) > 1
+}
+
+// EffectiveThreshold returns the number of groups needed to decrypt. SOPS
+// requires all groups when no threshold is set.
+func (g KeyGroups) EffectiveThreshold() int {
+	if !g.IsShamir() {
+		return 1
+	}
+	if g.Threshold == 0 {
+		return len(g.Groups)
+	}
+	return g.Threshold
+}
+
+// validate checks that every group has keys and the threshold can be met
+func (g KeyGroups) validate() error {
+	if len(g.Groups) == 0 {
+		return fmt.Errorf("at least one key group is required")
+	}
+	for i, group := range g.Groups {
+		if len(group) == 0 {
+			return fmt.Errorf("key group %d is empty", i+1)
+		}
+	}
+	if !g.IsShamir() {
+		return nil
+	}
+	if g.Threshold == 1 {
+		return fmt.Errorf("a threshold of 1 is not supported; put the keys in a single group instead")
+	}
+	if g.Threshold < 0 || g.Threshold > len(g.Groups) {
+		return fmt.Errorf("threshold %d is out of range for %d key groups", g.Threshold, len(g.Groups))
+	}
+	return nil
+}
+
+// ExtractKeyGroups extracts the key groups and Shamir threshold from parsed
+// SOPS YAML metadata. Files without key_groups have a single group.
+func ExtractKeyGroups(yamlData map[string]interface{}) KeyGroups {
+	sopsData, ok := yamlData["sops"].(map[string]interface{})
+	if !ok {
+		return KeyGroups{}
+	}
+
+	groupList, ok := sopsData["key_groups"].([]interface{})
+	if !ok {
+		return SingleGroup(ExtractKeys(yamlData))
+	}
+
+	var result KeyGroups
+	for _, item := range groupList {
+		if group, ok := item.(map[string]interface{}); ok {
+			result.Groups = append(result.Groups, extractGroupKeys(group))
+		}
+	}
+	if threshold, ok := sopsData["shamir_threshold"].(int); ok {
+		result.Threshold = threshold
+	}
+
+	return result
+}
+
+// ReadKeyGroups returns the key groups of an encrypted file
+func ReadKeyGroups(filePath string) (KeyGroups, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return KeyGroups{}, err
+	}
+
+	var yamlData map[string]interface{}
+	if err := yaml.Unmarshal(data, &yamlData); err != nil {
+		return KeyGroups{}, fmt.Errorf("failed to parse %s: %w", filePath, err)
+	}
+
+	return ExtractKeyGroups(yamlData), nil
+}
+
+// DirectoryKeyGroups returns the key groups of the first encrypted file in
+// dir that uses Shamir key groups, so new files in the directory get the
+// same protection as their siblings. found is false if there is none.
+func DirectoryKeyGroups(dir string) (groups KeyGroups, found bool, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return KeyGroups{}, false, nil
+		}
+		return KeyGroups{}, false, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !isYAMLFile(entry.Name()) {
+			continue
+		}
+		groups, err := ReadKeyGroups(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue // Skip files we can't read
+		}
+		if groups.IsShamir() {
+			return groups, true, nil
+		}
+	}
+
+	return KeyGroups{}, false, nil
+}
+
+// ListKeyGroups returns the key groups of every encrypted file, optionally
+// filtered by environment
+func ListKeyGroups(rootDir, env string) ([]FileKeyGroups, error) {
+	files, err := findEncryptedFiles(rootDir, env)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find encrypted files: %w", err)
+	}
+
+	result := make([]FileKeyGroups, 0, len(files))
+	for _, file := range files {
+		groups, err := ReadKeyGroups(file)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, FileKeyGroups{Path: file, KeyGroups: groups})
+	}
+
+	return result, nil
+}
+
+// AddKeyGroup adds a key group made of the given keys to all encrypted
+// files, optionally filtering by environment. A threshold of 0 keeps the
+// current threshold.
+func AddKeyGroup(rootDir string, groupKeys []string, threshold int, env string) error {
+	if len(groupKeys) == 0 {
+		return fmt.Errorf("a key group needs at least one key")
+	}
+	for _, key := range groupKeys {
+		if err := ValidateKey(key); err != nil {
+			return err
+		}
+	}
+
+	return updateKeyGroups(rootDir, env, func(groups *KeyGroups) {
+		groups.Groups = append(groups.Groups, groupKeys)
+		if threshold > 0 {
+			groups.Threshold = threshold
+		}
+	})
+}
+
+// RemoveKeyGroup removes the key group at index (1-based) from all encrypted
+// files, optionally filtering by environment. A threshold of 0 keeps the
+// current threshold, lowered if fewer groups remain.
+func RemoveKeyGroup(rootDir string, index, threshold int, env string) error {
+	return updateKeyGroupsChecked(rootDir, env, func(groups *KeyGroups) error {
+		if index < 1 || index > len(groups.Groups) {
+			return fmt.Errorf("key group %d does not exist (file has %d)", index, len(groups.Groups))
+		}
+		if len(groups.Groups) == 1 {
+			return fmt.Errorf("cannot remove the last key group")
+		}
+		groups.Groups = append(groups.Groups[:index-1], groups.Groups[index:]...)
+		if threshold > 0 {
+			groups.Threshold = threshold
+		} else if groups.Threshold > len(groups.Groups) {
+			groups.Threshold = len(groups.Groups)
+		}
+		return nil
+	})
+}
+
+// SetThreshold sets the number of key groups needed to decrypt all
+// encrypted files, optionally filtering by environment
+func SetThreshold(rootDir string, threshold int, env string) error {
+	return updateKeyGroups(rootDir, env, func(groups *KeyGroups) {
+		groups.Threshold = threshold
+	})
+}
+
+// updateKeyGroups applies update to the key groups of every encrypted file
+func updateKeyGroups(rootDir, env string, update func(*KeyGroups)) error {
+	return updateKeyGroupsChecked(rootDir, env, func(groups *KeyGroups) error {
+		update(groups)
+		return nil
+	})
+}
+
+// updateKeyGroupsChecked applies update to the key groups of every encrypted
+// file. All files are checked before any is rewritten.
+func updateKeyGroupsChecked(rootDir, env string, update func(*KeyGroups) error) error {
+	files, err := findEncryptedFiles(rootDir, env)
+	if err != nil {
+		return fmt.Errorf("failed to find encrypted files: %w", err)
+	}
+
+	if len(files) == 0 {
+		return fmt.Errorf("no encrypted files found in %s", rootDir)
+	}
+
+	lock, err := safefile.Acquire(files...)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	updated := make(map[string]KeyGroups, len(files))
+	for _, file := range files {
+		groups, err := ReadKeyGroups(file)
+		if err != nil {
+			return err
+		}
+		if err := update(&groups); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		if !groups.IsShamir() {
+			groups.Threshold = 0
+		}
+		if err := groups.validate(); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		updated[file] = groups
+	}
+
+	return parallel.Each(len(files), func(i int) error {
+		if err := rewriteKeyGroups(files[i], updated[files[i]]); err != nil {
+			return fmt.Errorf("failed to update key groups of %s: %w", files[i], err)
+		}
+		return nil
+	})
+}
+
+// rewriteKeyGroups re-protects a file's existing data key with new key
+// groups. The file's values are not re-encrypted.
+func rewriteKeyGroups(filePath string, groups KeyGroups) error {
+	store := sopsyaml.Store{}
+
+	fileBytes, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	tree, err := store.LoadEncryptedFile(fileBytes)
+	if err != nil {
+		return fmt.Errorf("failed to load encrypted file: %w", err)
+	}
+
+	dataKey, err := tree.Metadata.GetDataKey()
+	if err != nil {
+		return fmt.Errorf("failed to get data key: %w", err)
+	}
+
+	keyGroups, err := buildKeyGroups(groups)
+	if err != nil {
+		return err
+	}
+	tree.Metadata.KeyGroups = keyGroups
+	tree.Metadata.ShamirThreshold = groups.Threshold
+
+	errs := tree.Metadata.UpdateMasterKeysWithKeyServices(dataKey, []keyservice.KeyServiceClient{
+		keyservice.NewLocalClient(),
+	})
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to update master keys: %v", errs[0])
+	}
+
+	encryptedFile, err := store.EmitEncryptedFile(tree)
+	if err != nil {
+		return fmt.Errorf("failed to emit encrypted file: %w", err)
+	}
+
+	return safefile.Write(filePath, encryptedFile, 0600)
+}
+
+// buildKeyGroups creates SOPS key groups from key strings
+func buildKeyGroups(groups KeyGroups) ([]sops.KeyGroup, error) {
+	keyGroups := make([]sops.KeyGroup, 0, len(groups.Groups))
+	for _, group := range groups.Groups {
+		keyGroup := sops.KeyGroup{}
+		for _, key := range group {
+			masterKey, err := masterKeyFromString(key)
+			if err != nil {
+				return nil, err
+			}
+			keyGroup = append(keyGroup, masterKey)
+		}
+		keyGroups = append(keyGroups, keyGroup)
+	}
+	return keyGroups, nil
+}
@@ -0,0 +1,63 @@
+package keys
+
+import (
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestExtractKeyGroups(t *testing.T) {
+	var yamlData map[string]interface{}
+	metadata := `
+sops:
+  shamir_threshold: 2
+  key_groups:
+    - age:
+        - recipient: age1first
+    - age:
+        - recipient: age1second
+      pgp:
+        - fp: 7CF7474237B03AB4999406B74A2AC3A23F5D4F53
+    - age:
+        - recipient: age1first
+`
+	if err := yaml.Unmarshal([]byte(metadata), &yamlData); err != nil {
+		t.Fatal(err)
+	}
+
+	groups := ExtractKeyGroups(yamlData)
+	if len(groups.Groups) != 3 || groups.Threshold != 2 {
+		t.Fatalf("Expected 3 groups with threshold 2, got %+v", groups)
+	}
+	if len(groups.Groups[1]) != 2 || groups.Groups[1][1] != "7CF7474237B03AB4999406B74A2AC3A23F5D4F53" {
+		t.Errorf("Expected the second group to hold an age and a PGP key, got %v", groups.Groups[1])
+	}
+
+	// ExtractKeys lists each key once across groups
+	if keys := ExtractKeys(yamlData); len(keys) != 3 {
+		t.Errorf("Expected 3 distinct keys, got %v", keys)
+	}
+}
+
+func TestKeyGroupsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		groups  KeyGroups
+		wantErr bool
+	}{
+		{"single group", SingleGroup([]string{"age1a"}), false},
+		{"all groups by default", KeyGroups{Groups: [][]string{{"age1a"}, {"age1b"}}}, false},
+		{"2 of 3", KeyGroups{Groups: [][]string{{"age1a"}, {"age1b"}, {"age1c"}}, Threshold: 2}, false},
+		{"threshold above groups", KeyGroups{Groups: [][]string{{"age1a"}, {"age1b"}}, Threshold: 3}, true},
+		{"threshold of 1", KeyGroups{Groups: [][]string{{"age1a"}, {"age1b"}}, Threshold: 1}, true},
+		{"empty group", KeyGroups{Groups: [][]string{{"age1a"}, {}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.groups.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package keys
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+)
+
+// DefaultIdentityFile returns the file SOPS reads age private keys from:
+// $SOPS_AGE_KEY_FILE, or sops/age/keys.txt in the user config directory
+func DefaultIdentityFile() (string, error) {
+	if path := os.Getenv("SOPS_AGE_KEY_FILE"); path != "" {
+		return path, nil
+	}
+	return userIdentityFile()
+}
+
+// userIdentityFile returns sops/age/keys.txt in the user config directory,
+// which SOPS reads whether or not SOPS_AGE_KEY_FILE is set
+func userIdentityFile() (string, error) {
+	// As in SOPS, XDG_CONFIG_HOME is honored on macOS too
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if runtime.GOOS != "darwin" || configDir == "" {
+		var err error
+		if configDir, err = os.UserConfigDir(); err != nil {
+			return "", fmt.Errorf("failed to find the user config directory: %w", err)
+		}
+	}
+	return filepath.Join(configDir, "sops", "age", "keys.txt"), nil
+}
+
+// IdentitySource is a place SOPS reads age identities from
+type IdentitySource struct {
+	Name       string   // The environment variable or file
+	Path       string   // The file holding the identities, if any
+	Recipients []string // Public keys of the identities found
+	Err        error    // Why the identities couldn't be read
+}
+
+// FindIdentities returns the places SOPS reads age identities from that are
+// set or exist, in the order SOPS reads them. A command in SOPS_AGE_KEY_CMD
+// is run, as SOPS would. SSH keys may be protected by a passphrase, so their
+// recipient is read from the public key beside them, if there is one.
+func FindIdentities() []IdentitySource {
+	var sources []IdentitySource
+	if path := os.Getenv("SOPS_AGE_SSH_PRIVATE_KEY_FILE"); path != "" {
+		sources = append(sources, sshIdentity("SOPS_AGE_SSH_PRIVATE_KEY_FILE", path))
+	}
+	if home, err := os.UserHomeDir(); err == nil && home != "" {
+		for _, name := range []string{"id_ed25519", "id_rsa"} {
+			path := filepath.Join(home, ".ssh", name)
+			if _, err := os.Stat(path); err == nil {
+				sources = append(sources, sshIdentity(path, path))
+			}
+		}
+	}
+
+	if key := os.Getenv("SOPS_AGE_KEY"); key != "" {
+		source := IdentitySource{Name: "SOPS_AGE_KEY"}
+		source.Recipients, source.Err = ageRecipients(strings.NewReader(key))
+		sources = append(sources, source)
+	}
+	if path := os.Getenv("SOPS_AGE_KEY_FILE"); path != "" {
+		sources = append(sources, ageIdentityFile("SOPS_AGE_KEY_FILE", path))
+	}
+	if command := os.Getenv("SOPS_AGE_KEY_CMD"); command != "" {
+		source := IdentitySource{Name: "SOPS_AGE_KEY_CMD"}
+		if args := strings.Fields(command); len(args) == 0 {
+			source.Err = fmt.Errorf("SOPS_AGE_KEY_CMD is empty")
+		} else if out, err := exec.Command(args[0], args[1:]...).Output(); err != nil {
+			source.Err = fmt.Errorf("failed to run %s: %w", command, err)
+		} else {
+			source.Recipients, source.Err = ageRecipients(bytes.NewReader(out))
+		}
+		sources = append(sources, source)
+	}
+	if path, err := userIdentityFile(); err == nil {
+		if _, err := os.Stat(path); err == nil {
+			sources = append(sources, ageIdentityFile(path, path))
+		}
+	}
+	return sources
+}
+
+// ageIdentityFile reads the age identities in a file
+func ageIdentityFile(name, path string) IdentitySource {
+	source := IdentitySource{Name: name, Path: path}
+	f, err := os.Open(path)
+	if err != nil {
+		source.Err = err
+		return source
+	}
+	defer f.Close()
+	source.Recipients, source.Err = ageRecipients(f)
+	return source
+}
+
+// ageRecipients returns the public keys of the age identities in r
+func ageRecipients(r io.Reader) ([]string, error) {
+	identities, err := age.ParseIdentities(r)
+	if err != nil {
+		return nil, err
+	}
+	var recipients []string
+	for _, identity := range identities {
+		if x25519, ok := identity.(*age.X25519Identity); ok {
+			recipients = append(recipients, x25519.Recipient().String())
+		}
+	}
+	return recipients, nil
+}
+
+// sshIdentity returns an SSH private key as an identity source, with the
+// recipient in the .pub file beside it
+func sshIdentity(name, path string) IdentitySource {
+	source := IdentitySource{Name: name, Path: path}
+	if _, err := os.Stat(path); err != nil {
+		source.Err = err
+		return source
+	}
+	if data, err := os.ReadFile(path + ".pub"); err == nil {
+		source.Recipients = []string{NormalizeKey(string(data))}
+	}
+	return source
+}
+
+// GenerateIdentity generates an age key pair, appends the private key to the
+// identity file at path in the format written by age-keygen, and returns the
+// public key. The file is created readable only by its owner, and an existing
+// file that others can read is refused rather than added to.
+func GenerateIdentity(path string, now time.Time) (string, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("%s can be read by other users (permissions %04o); restrict it with 'chmod 600' first", path, info.Mode().Perm())
+	}
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate age key: %w", err)
+	}
+	publicKey := identity.Recipient().String()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	entry := fmt.Sprintf("# created: %s\n# public key: %s\n%s\n", now.Format(time.RFC3339), publicKey, identity.String())
+	if _, err := file.WriteString(entry); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return publicKey, nil
+}
+
+// LoadIdentities returns the age identities in the given files, followed by
+// those SOPS would use: SOPS_AGE_KEY, SOPS_AGE_KEY_FILE, and the user's
+// identity file. Sources that aren't set or don't exist are skipped, but a
+// given file that can't be read is an error.
+func LoadIdentities(files []string) ([]age.Identity, error) {
+	var identities []age.Identity
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read identity file: %w", err)
+		}
+		parsed, err := age.ParseIdentities(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse identity file %s: %w", path, err)
+		}
+		identities = append(identities, parsed...)
+	}
+
+	if key := os.Getenv("SOPS_AGE_KEY"); key != "" {
+		parsed, err := age.ParseIdentities(strings.NewReader(key))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse SOPS_AGE_KEY: %w", err)
+		}
+		identities = append(identities, parsed...)
+	}
+	paths := []string{os.Getenv("SOPS_AGE_KEY_FILE")}
+	if path, err := userIdentityFile(); err == nil {
+		paths = append(paths, path)
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if parsed, err := age.ParseIdentities(bytes.NewReader(data)); err == nil {
+			identities = append(identities, parsed...)
+		}
+	}
+	return identities, nil
+}
@@ -0,0 +1,75 @@
+package keys
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+)
+
+func TestGenerateIdentity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sops", "age", "keys.txt")
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	first, err := GenerateIdentity(path, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := GenerateIdentity(path, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second || TypeOf(first) != KeyTypeAge {
+		t.Fatalf("Expected two different age keys, got %s and %s", first, second)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected permissions 0600, got %04o", info.Mode().Perm())
+	}
+
+	// Both private keys are kept, each with the age-keygen header
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "# created: 2024-03-01T12:00:00Z\n# public key: "+first+"\n") {
+		t.Errorf("Unexpected identity file:\n%s", data)
+	}
+	identities, err := age.ParseIdentities(strings.NewReader(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 2 || identities[1].(*age.X25519Identity).Recipient().String() != second {
+		t.Errorf("Expected both identities in the file, got %d", len(identities))
+	}
+
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GenerateIdentity(path, now); err == nil {
+		t.Error("Expected a readable identity file to be refused")
+	}
+}
+
+func TestDefaultIdentityFile(t *testing.T) {
+	t.Setenv("SOPS_AGE_KEY_FILE", "/keys/age.txt")
+	if path, err := DefaultIdentityFile(); err != nil || path != "/keys/age.txt" {
+		t.Errorf("Expected $SOPS_AGE_KEY_FILE, got %q (%v)", path, err)
+	}
+
+	t.Setenv("SOPS_AGE_KEY_FILE", "")
+	path, err := DefaultIdentityFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(path, filepath.Join("sops", "age", "keys.txt")) {
+		t.Errorf("Expected the SOPS key file in the user config directory, got %s", path)
+	}
+}
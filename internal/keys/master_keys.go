@@ -0,0 +1,235 @@
+package keys
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/getsops/sops/v3/age"
+	"github.com/getsops/sops/v3/azkv"
+	"github.com/getsops/sops/v3/gcpkms"
+	sopskeys "github.com/getsops/sops/v3/keys"
+	"github.com/getsops/sops/v3/kms"
+	"github.com/getsops/sops/v3/pgp"
+)
+
+// KeyType identifies the kind of a master key. Values are the field names
+// used for the key type in .sops.yaml creation rules.
+type KeyType string
+
+const (
+	KeyTypeAge     KeyType = "age"
+	KeyTypeKMS     KeyType = "kms"
+	KeyTypeGCPKMS  KeyType = "gcp_kms"
+	KeyTypeAzureKV KeyType = "azure_keyvault"
+	KeyTypePGP     KeyType = "pgp"
+)
+
+// keyTypes lists the supported key types in the order they are written
+var keyTypes = []KeyType{KeyTypeAge, KeyTypePGP, KeyTypeKMS, KeyTypeGCPKMS, KeyTypeAzureKV}
+
+var (
+	// kmsArnPattern matches an AWS KMS key or alias ARN, optionally followed by
+	// "+" and the ARN of an IAM role to assume when using the key
+	kmsArnPattern = regexp.MustCompile(`^arn:aws[\w-]*:kms:[^:]+:[0-9]+:(key|alias)/[^+]+(\+arn:aws[\w-]*:iam::[0-9]+:role/.+)?$`)
+
+	// gcpKMSPattern matches a GCP KMS crypto key resource ID
+	gcpKMSPattern = regexp.MustCompile(`^projects/[^/]+/locations/[^/]+/keyRings/[^/]+/cryptoKeys/[^/]+$`)
+
+	// azureKVPattern matches an Azure Key Vault key URL with an optional version
+	azureKVPattern = regexp.MustCompile(`^https://[^/]+/keys/[^/]+(/[^/]*)?$`)
+
+	// pgpFingerprintPattern matches a full PGP key fingerprint
+	pgpFingerprintPattern = regexp.MustCompile(`^[0-9A-Fa-f]{40}$`)
+)
+
+// TypeOf returns the type of a key string. Anything that isn't recognizably
+// a PGP fingerprint or cloud KMS key is treated as an age recipient, which
+// includes SSH public keys.
+func TypeOf(key string) KeyType {
+	switch {
+	case pgpFingerprintPattern.MatchString(key):
+		return KeyTypePGP
+	case strings.HasPrefix(key, "arn:"):
+		return KeyTypeKMS
+	case strings.HasPrefix(key, "projects/"):
+		return KeyTypeGCPKMS
+	case strings.HasPrefix(key, "https://"):
+		return KeyTypeAzureKV
+	default:
+		return KeyTypeAge
+	}
+}
+
+// NormalizeKey trims a key and drops the trailing comment (such as
+// "user@host") from an SSH public key, so each key has a single string form
+func NormalizeKey(key string) string {
+	key = strings.TrimSpace(key)
+	if strings.HasPrefix(key, "ssh-") {
+		if fields := strings.Fields(key); len(fields) > 2 {
+			return fields[0] + " " + fields[1]
+		}
+	}
+	return key
+}
+
+// ValidateKey checks that key is a valid age recipient (including SSH
+// ed25519 and RSA public keys), PGP fingerprint, AWS
+// KMS ARN, GCP KMS resource ID, or Azure Key Vault key URL without contacting
+// any key service
+func ValidateKey(key string) error {
+	switch TypeOf(key) {
+	case KeyTypePGP:
+		// TypeOf only matches valid fingerprints
+	case KeyTypeKMS:
+		if !kmsArnPattern.MatchString(key) {
+			return fmt.Errorf("invalid AWS KMS ARN: %s", key)
+		}
+	case KeyTypeGCPKMS:
+		if !gcpKMSPattern.MatchString(key) {
+			return fmt.Errorf("invalid GCP KMS resource ID: %s (expected projects/P/locations/L/keyRings/R/cryptoKeys/K)", key)
+		}
+	case KeyTypeAzureKV:
+		if !azureKVPattern.MatchString(key) {
+			return fmt.Errorf("invalid Azure Key Vault key URL: %s (expected https://VAULT/keys/NAME[/VERSION])", key)
+		}
+	default:
+		if _, err := age.MasterKeyFromRecipient(key); err != nil {
+			return fmt.Errorf("failed to create master key from recipient %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// masterKeyFromString creates a SOPS master key from a key string. Azure Key
+// Vault URLs without a version are resolved to the key's latest version.
+func masterKeyFromString(key string) (sopskeys.MasterKey, error) {
+	if err := ValidateKey(key); err != nil {
+		return nil, err
+	}
+
+	switch TypeOf(key) {
+	case KeyTypePGP:
+		return pgp.NewMasterKeyFromFingerprint(key), nil
+	case KeyTypeKMS:
+		return kms.NewMasterKeyFromArn(key, nil, ""), nil
+	case KeyTypeGCPKMS:
+		return gcpkms.NewMasterKeyFromResourceID(key), nil
+	case KeyTypeAzureKV:
+		masterKey, err := azkv.NewMasterKeyFromURL(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve Azure Key Vault key %s: %w", key, err)
+		}
+		return masterKey, nil
+	default:
+		return age.MasterKeyFromRecipient(key)
+	}
+}
+
+// keyMatches reports whether a master key in a file is the key named by key.
+// PGP fingerprints are compared case-insensitively, and an Azure Key Vault
+// URL without a version matches every version of the key.
+func keyMatches(masterKey sopskeys.MasterKey, key string) bool {
+	if masterKey.ToString() == key {
+		return true
+	}
+	if _, ok := masterKey.(*pgp.MasterKey); ok {
+		return strings.EqualFold(masterKey.ToString(), key)
+	}
+	if _, ok := masterKey.(*azkv.MasterKey); ok && strings.Count(strings.TrimSuffix(key, "/"), "/") == 4 {
+		return strings.HasPrefix(masterKey.ToString(), strings.TrimSuffix(key, "/")+"/")
+	}
+	return false
+}
+
+// ExtractKeys extracts the age recipients, PGP fingerprints, and cloud KMS
+// keys from parsed SOPS YAML metadata, across all key groups. AWS KMS keys
+// that assume a role are returned as "ARN+ROLE_ARN" and Azure Key Vault keys
+// as versioned URLs.
+func ExtractKeys(yamlData map[string]interface{}) []string {
+	sopsData, ok := yamlData["sops"].(map[string]interface{})
+	if !ok {
+		return []string{}
+	}
+
+	groupList, ok := sopsData["key_groups"].([]interface{})
+	if !ok {
+		return extractGroupKeys(sopsData)
+	}
+
+	keys := []string{}
+	seen := make(map[string]bool)
+	for _, item := range groupList {
+		group, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, key := range extractGroupKeys(group) {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	return keys
+}
+
+// extractGroupKeys extracts the keys of one key group. Files with a single
+// group store its keys directly in the sops metadata.
+func extractGroupKeys(group map[string]interface{}) []string {
+	keys := []string{}
+
+	for _, entry := range metadataEntries(group, "age") {
+		if recipient, _ := entry["recipient"].(string); recipient != "" {
+			keys = append(keys, recipient)
+		}
+	}
+
+	for _, entry := range metadataEntries(group, "pgp") {
+		if fingerprint, _ := entry["fp"].(string); fingerprint != "" {
+			keys = append(keys, fingerprint)
+		}
+	}
+
+	for _, entry := range metadataEntries(group, "kms") {
+		arn, _ := entry["arn"].(string)
+		if arn == "" {
+			continue
+		}
+		if role, _ := entry["role"].(string); role != "" {
+			arn += "+" + role
+		}
+		keys = append(keys, arn)
+	}
+
+	for _, entry := range metadataEntries(group, "gcp_kms") {
+		if resourceID, _ := entry["resource_id"].(string); resourceID != "" {
+			keys = append(keys, resourceID)
+		}
+	}
+
+	for _, entry := range metadataEntries(group, "azure_kv") {
+		vaultURL, _ := entry["vault_url"].(string)
+		name, _ := entry["name"].(string)
+		version, _ := entry["version"].(string)
+		if vaultURL != "" && name != "" {
+			keys = append(keys, fmt.Sprintf("%s/keys/%s/%s", vaultURL, name, version))
+		}
+	}
+
+	return keys
+}
+
+// metadataEntries returns the entries of a key list in SOPS metadata
+func metadataEntries(group map[string]interface{}, field string) []map[string]interface{} {
+	var entries []map[string]interface{}
+	if list, ok := group[field].([]interface{}); ok {
+		for _, item := range list {
+			if entry, ok := item.(map[string]interface{}); ok {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	return entries
+}
@@ -0,0 +1,201 @@
+package keys
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/getsops/sops/v3/azkv"
+	"github.com/getsops/sops/v3/decrypt"
+	"gopkg.in/yaml.v3"
+)
+
+const testKMSArn = "arn:aws:kms:us-east-1:123456789012:key/1234abcd-12ab-34cd-56ef-1234567890ab"
+
+const testSSHKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIMYKBjxb4X7OnnCunPAhIulU0VVjrAfi95CsuM7k4nDT"
+
+// fakeKMS serves KMS Encrypt and Decrypt requests, "encrypting" data keys
+// by prefixing them, and points the AWS SDK at itself
+func fakeKMS(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.Encrypt":
+			// Blobs are base64 on the wire; prefixing keeps them valid base64
+			json.NewEncoder(w).Encode(map[string]string{"KeyId": body["KeyId"], "CiphertextBlob": "ZmFr" + body["Plaintext"]})
+		case "TrentService.Decrypt":
+			json.NewEncoder(w).Encode(map[string]string{"KeyId": testKMSArn, "Plaintext": strings.TrimPrefix(body["CiphertextBlob"], "ZmFr")})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("AWS_ENDPOINT_URL", server.URL)
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+}
+
+func TestEncryptDataWithKMS(t *testing.T) {
+	fakeKMS(t)
+
+	encrypted, err := EncryptData([]byte("PORT: \"8080\"\n"), "dev/api.yml", []string{testKMSArn})
+	if err != nil {
+		t.Fatalf("EncryptData failed: %v", err)
+	}
+
+	var yamlData map[string]interface{}
+	if err := yaml.Unmarshal(encrypted, &yamlData); err != nil {
+		t.Fatalf("Failed to parse encrypted file: %v", err)
+	}
+	if got := ExtractKeys(yamlData); len(got) != 1 || got[0] != testKMSArn {
+		t.Errorf("Expected the KMS ARN in the metadata, got %v", got)
+	}
+
+	decrypted, err := decrypt.Data(encrypted, "yaml")
+	if err != nil {
+		t.Fatalf("Failed to decrypt: %v", err)
+	}
+	if !strings.Contains(string(decrypted), "8080") {
+		t.Errorf("Expected decrypted value, got %s", decrypted)
+	}
+}
+
+func TestValidateKey(t *testing.T) {
+	valid := []string{
+		"age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p",
+		testKMSArn,
+		"arn:aws:kms:eu-west-1:123456789012:alias/puff",
+		testKMSArn + "+arn:aws:iam::123456789012:role/puff-decrypt",
+		"projects/acme/locations/global/keyRings/puff/cryptoKeys/prod",
+		"https://acme.vault.azure.net/keys/puff",
+		"https://acme.vault.azure.net/keys/puff/0123456789abcdef",
+		"7CF7474237B03AB4999406B74A2AC3A23F5D4F53",
+		testSSHKey,
+	}
+	for _, key := range valid {
+		if err := ValidateKey(key); err != nil {
+			t.Errorf("Expected %s to be valid, got %v", key, err)
+		}
+	}
+
+	invalid := []string{
+		"age1invalid",
+		"arn:aws:kms:us-east-1:key/missing-account",
+		"arn:aws:s3:::bucket",
+		"projects/acme/keyRings/puff",
+		"https://acme.vault.azure.net/secrets/puff",
+		"ssh-ed25519 AAAAinvalid",
+	}
+	for _, key := range invalid {
+		if err := ValidateKey(key); err == nil {
+			t.Errorf("Expected %s to be invalid", key)
+		}
+	}
+}
+
+func TestNormalizeKey(t *testing.T) {
+	if got := NormalizeKey("  " + testSSHKey + " bob@desk\n"); got != testSSHKey {
+		t.Errorf("Expected the SSH key comment to be dropped, got %q", got)
+	}
+	if got := NormalizeKey(testKMSArn + " "); got != testKMSArn {
+		t.Errorf("Expected other keys to be trimmed only, got %q", got)
+	}
+	if TypeOf(testSSHKey) != KeyTypeAge || !isKeyString(testSSHKey) {
+		t.Errorf("Expected an SSH key to be handled as an age recipient")
+	}
+}
+
+func TestExtractKeys(t *testing.T) {
+	var yamlData map[string]interface{}
+	metadata := `
+sops:
+  age:
+    - recipient: age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p
+  pgp:
+    - fp: 7CF7474237B03AB4999406B74A2AC3A23F5D4F53
+  kms:
+    - arn: ` + testKMSArn + `
+      role: arn:aws:iam::123456789012:role/puff
+  gcp_kms:
+    - resource_id: projects/acme/locations/global/keyRings/puff/cryptoKeys/prod
+  azure_kv:
+    - vault_url: https://acme.vault.azure.net
+      name: puff
+      version: v1
+`
+	if err := yaml.Unmarshal([]byte(metadata), &yamlData); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p",
+		"7CF7474237B03AB4999406B74A2AC3A23F5D4F53",
+		testKMSArn + "+arn:aws:iam::123456789012:role/puff",
+		"projects/acme/locations/global/keyRings/puff/cryptoKeys/prod",
+		"https://acme.vault.azure.net/keys/puff/v1",
+	}
+	got := ExtractKeys(yamlData)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestKeyMatchesUnversionedAzureKey(t *testing.T) {
+	key := azkv.NewMasterKey("https://acme.vault.azure.net", "puff", "v1")
+
+	for _, name := range []string{"https://acme.vault.azure.net/keys/puff", "https://acme.vault.azure.net/keys/puff/v1"} {
+		if !keyMatches(key, name) {
+			t.Errorf("Expected %s to match", name)
+		}
+	}
+	for _, name := range []string{"https://acme.vault.azure.net/keys/puff/v2", "https://acme.vault.azure.net/keys/pu"} {
+		if keyMatches(key, name) {
+			t.Errorf("Expected %s not to match", name)
+		}
+	}
+}
+
+func TestSOPSConfigWithKMS(t *testing.T) {
+	rootDir := t.TempDir()
+	ageKey := "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"
+	initial := "creation_rules:\n  - path_regex: .*\\.yml$\n    age: " + ageKey + "\n"
+	if err := os.WriteFile(filepath.Join(rootDir, ".sops.yaml"), []byte(initial), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := AddKeyToSOPSConfig(rootDir, testKMSArn, "Production KMS"); err != nil {
+		t.Fatalf("AddKeyToSOPSConfig failed: %v", err)
+	}
+	gcpKey := "projects/acme/locations/global/keyRings/puff/cryptoKeys/prod"
+	if err := AddKeyToSOPSConfig(rootDir, gcpKey, "GCP"); err != nil {
+		t.Fatalf("AddKeyToSOPSConfig failed: %v", err)
+	}
+
+	config, err := LoadSOPSConfig(rootDir)
+	if err != nil {
+		t.Fatalf("LoadSOPSConfig failed: %v", err)
+	}
+	rule := config.CreationRules[0]
+	if rule.Age != ageKey || rule.KMS != testKMSArn || rule.GCPKMS != gcpKey {
+		t.Errorf("Expected keys split by type, got %+v", rule)
+	}
+	if config.KeyComments[testKMSArn] != "Production KMS" || config.KeyComments[gcpKey] != "GCP" {
+		t.Errorf("Expected the KMS key comment to be kept, got %v", config.KeyComments)
+	}
+
+	if err := RemoveKeyFromSOPSConfig(rootDir, testKMSArn); err != nil {
+		t.Fatalf("RemoveKeyFromSOPSConfig failed: %v", err)
+	}
+	config, _ = LoadSOPSConfig(rootDir)
+	if config.CreationRules[0].KMS != "" {
+		t.Errorf("Expected the kms field to be removed, got %q", config.CreationRules[0].KMS)
+	}
+}
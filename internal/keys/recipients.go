@@ -0,0 +1,56 @@
+package keys
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Recipient is a key together with its comment
+type Recipient struct {
+	Key     string
+	Comment string
+}
+
+// ParseRecipients parses an age recipients file: one key per line, with
+// blank lines and "#" comment lines ignored. A comment line directly above a
+// key becomes its comment; SSH keys without one use their trailing
+// "user@host" comment. Keys listed twice are returned once.
+func ParseRecipients(data []byte) ([]Recipient, error) {
+	var recipients []Recipient
+	seen := make(map[string]bool)
+	comment := ""
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			comment = ""
+			continue
+		case strings.HasPrefix(line, "#"):
+			comment = strings.TrimSpace(strings.TrimPrefix(line, "#"))
+			continue
+		}
+
+		key := NormalizeKey(line)
+		if err := ValidateKey(key); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		if comment == "" && key != line {
+			comment = strings.TrimSpace(strings.TrimPrefix(line, key))
+		}
+
+		if !seen[key] {
+			seen[key] = true
+			recipients = append(recipients, Recipient{Key: key, Comment: comment})
+		}
+		comment = ""
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read recipients: %w", err)
+	}
+
+	return recipients, nil
+}
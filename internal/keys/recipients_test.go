@@ -0,0 +1,44 @@
+package keys
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRecipients(t *testing.T) {
+	const aliceKey = "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"
+	data := `# Platform team keys
+
+# Alice's laptop
+` + aliceKey + `
+` + testSSHKey + ` bob@desk
+# CI deploy
+  ` + testKMSArn + `
+
+` + aliceKey + `
+`
+
+	recipients, err := ParseRecipients([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Recipient{
+		{Key: aliceKey, Comment: "Alice's laptop"},
+		{Key: testSSHKey, Comment: "bob@desk"},
+		{Key: testKMSArn, Comment: "CI deploy"},
+	}
+	if len(recipients) != len(expected) {
+		t.Fatalf("Expected %d recipients, got %+v", len(expected), recipients)
+	}
+	for i, want := range expected {
+		if recipients[i] != want {
+			t.Errorf("Recipient %d: expected %+v, got %+v", i+1, want, recipients[i])
+		}
+	}
+
+	_, err = ParseRecipients([]byte("# Alice\n" + aliceKey + "\nnot-a-key\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("Expected an error pointing at line 3, got %v", err)
+	}
+}
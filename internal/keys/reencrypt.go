@@ -0,0 +1,150 @@
+package keys
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/getsops/sops/v3/decrypt"
+	"github.com/teamcurri/puff/internal/parallel"
+	"github.com/teamcurri/puff/internal/safefile"
+)
+
+// Outcomes of re-encrypting a file
+const (
+	ReencryptUpdated   = "updated"
+	ReencryptRotated   = "rotated"
+	ReencryptUnchanged = "unchanged"
+	ReencryptFailed    = "failed"
+)
+
+// ReencryptResult is the outcome of re-encrypting one file
+type ReencryptResult struct {
+	Path    string   `json:"path"` // Relative to the config root
+	Status  string   `json:"status"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// FileKeys returns the keys SOPS would encrypt a new file to, given its path
+// relative to .sops.yaml: those of the first creation rule matching it, or
+// the default keys
+func (c *SOPSConfig) FileKeys(relPath string) []string {
+	if keys, ok := c.RuleKeys(relPath); ok {
+		return keys
+	}
+	return c.Keys()
+}
+
+// Reencrypt brings the recipients of every encrypted file, optionally
+// filtered by environment, in line with the creation rules in .sops.yaml.
+// Files whose recipients change have their data key re-wrapped, and files
+// that already match are left alone. With rotate, every file is re-encrypted
+// under a fresh data key, as 'keys rotate' does. Files using Shamir key
+// groups keep their groups, since creation rules can't express them. A file
+// that can't be re-encrypted is reported as failed, and the rest are still
+// processed.
+func Reencrypt(rootDir, env string, rotate bool) ([]ReencryptResult, error) {
+	sopsConfig, err := LoadSOPSConfig(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := findEncryptedFiles(rootDir, env)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find encrypted files: %w", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no encrypted files found in %s", rootDir)
+	}
+	sort.Strings(files)
+
+	results := make([]ReencryptResult, len(files))
+	parallel.Each(len(files), func(i int) error {
+		result := ReencryptResult{Path: relativePath(rootDir, files[i]), Added: []string{}, Removed: []string{}}
+		if err := reencryptFile(files[i], sopsConfig.FileKeys(result.Path), rotate, &result); err != nil {
+			result.Status = ReencryptFailed
+			result.Error = err.Error()
+		}
+		results[i] = result
+		return nil
+	})
+	return results, nil
+}
+
+// reencryptFile re-encrypts one file to the declared keys, recording the
+// recipients it gains and loses in result
+func reencryptFile(file string, declared []string, rotate bool, result *ReencryptResult) error {
+	if len(declared) == 0 {
+		return fmt.Errorf("no keys for %s in .sops.yaml", result.Path)
+	}
+	lock, err := safefile.Acquire(file)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	current, err := ReadKeyGroups(file)
+	if err != nil {
+		return err
+	}
+
+	target := SingleGroup(declared)
+	if current.IsShamir() {
+		target = current
+	} else {
+		result.Added, result.Removed = recipientChanges(current.Groups, declared)
+	}
+
+	switch {
+	case rotate:
+		plaintext, err := decrypt.File(file, "yaml")
+		if err != nil {
+			return fmt.Errorf("failed to decrypt: %w", err)
+		}
+		encrypted, err := EncryptDataWithGroups(plaintext, file, target)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt: %w", err)
+		}
+		if err := safefile.Write(file, encrypted, 0600); err != nil {
+			return err
+		}
+		result.Status = ReencryptRotated
+	case len(result.Added) > 0 || len(result.Removed) > 0:
+		if err := rewriteKeyGroups(file, target); err != nil {
+			return err
+		}
+		result.Status = ReencryptUpdated
+	default:
+		result.Status = ReencryptUnchanged
+	}
+	return nil
+}
+
+// recipientChanges returns the declared keys missing from a file's key
+// groups, and the keys in them that aren't declared
+func recipientChanges(groups [][]string, declared []string) (added, removed []string) {
+	current := make(map[string]bool)
+	for _, group := range groups {
+		for _, key := range group {
+			current[key] = true
+		}
+	}
+	wanted := make(map[string]bool)
+	added = []string{}
+	for _, key := range declared {
+		wanted[key] = true
+		if !current[key] {
+			added = append(added, key)
+		}
+	}
+	removed = []string{}
+	for _, group := range groups {
+		for _, key := range group {
+			if !wanted[key] {
+				removed = append(removed, key)
+			}
+		}
+	}
+	return added, removed
+}
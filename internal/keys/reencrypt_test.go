@@ -0,0 +1,36 @@
+package keys
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFileKeys(t *testing.T) {
+	rootDir := writeTestSOPSConfig(t)
+	config, err := LoadSOPSConfig(rootDir)
+	if err != nil {
+		t.Fatalf("LoadSOPSConfig failed: %v", err)
+	}
+	if err := config.AddEnvRule("prod", []string{testProdAgeKey}); err != nil {
+		t.Fatalf("AddEnvRule failed: %v", err)
+	}
+
+	if keys := config.FileKeys("prod/api.yml"); !reflect.DeepEqual(keys, []string{testProdAgeKey}) {
+		t.Errorf("Expected prod files to use the prod rule, got %v", keys)
+	}
+	if keys := config.FileKeys("dev/api.yml"); !reflect.DeepEqual(keys, []string{testDefaultAgeKey}) {
+		t.Errorf("Expected dev files to use the default rule, got %v", keys)
+	}
+}
+
+func TestRecipientChanges(t *testing.T) {
+	added, removed := recipientChanges([][]string{{"age1team", "age1stale"}}, []string{"age1team", "age1deploy"})
+	if !reflect.DeepEqual(added, []string{"age1deploy"}) || !reflect.DeepEqual(removed, []string{"age1stale"}) {
+		t.Errorf("Expected +age1deploy -age1stale, got +%v -%v", added, removed)
+	}
+
+	added, removed = recipientChanges([][]string{{"age1team"}}, []string{"age1team"})
+	if len(added) != 0 || len(removed) != 0 {
+		t.Errorf("Expected no changes, got +%v -%v", added, removed)
+	}
+}
@@ -0,0 +1,193 @@
+package keys
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/teamcurri/puff/internal/safefile"
+	"gopkg.in/yaml.v3"
+)
+
+// RegistryFile is the name of the key registry in the config root
+const RegistryFile = "keys.yml"
+
+// DateFormat is the format of dates in the key registry
+const DateFormat = "2006-01-02"
+
+// RegistryEntry records who a key belongs to and how long it is valid
+type RegistryEntry struct {
+	Key     string `yaml:"key"`
+	Comment string `yaml:"comment,omitempty"`
+	Owner   string `yaml:"owner,omitempty"`
+	Team    string `yaml:"team,omitempty"`
+	Added   string `yaml:"added,omitempty"`
+	Expires string `yaml:"expires,omitempty"`
+}
+
+// Registry is the set of keys recorded in keys.yml
+type Registry struct {
+	Keys []RegistryEntry `yaml:"keys"`
+
+	// exists is false if keys.yml has not been created yet
+	exists bool
+}
+
+// LoadRegistry reads keys.yml from the config root. A missing file yields an
+// empty registry.
+func LoadRegistry(rootDir string) (*Registry, error) {
+	data, err := os.ReadFile(filepath.Join(rootDir, RegistryFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Registry{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", RegistryFile, err)
+	}
+
+	var registry Registry
+	if err := yaml.Unmarshal(data, &registry); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", RegistryFile, err)
+	}
+	for _, entry := range registry.Keys {
+		if err := entry.validate(); err != nil {
+			return nil, fmt.Errorf("invalid entry in %s: %w", RegistryFile, err)
+		}
+	}
+	registry.exists = true
+
+	return &registry, nil
+}
+
+// Save writes the registry to keys.yml in the config root
+func (r *Registry) Save(rootDir string) error {
+	data, err := yaml.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", RegistryFile, err)
+	}
+
+	header := "# Puff key registry: who each encryption key belongs to and when it expires\n"
+	if err := safefile.Write(filepath.Join(rootDir, RegistryFile), append([]byte(header), data...), 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", RegistryFile, err)
+	}
+
+	r.exists = true
+	return nil
+}
+
+// Exists reports whether keys.yml has been created
+func (r *Registry) Exists() bool {
+	return r.exists
+}
+
+// Get returns the entry for a key, or nil if it isn't registered
+func (r *Registry) Get(key string) *RegistryEntry {
+	for i := range r.Keys {
+		if r.Keys[i].Key == key {
+			return &r.Keys[i]
+		}
+	}
+	return nil
+}
+
+// Put adds an entry or updates the registered one. Empty fields in entry
+// keep their current values.
+func (r *Registry) Put(entry RegistryEntry) error {
+	if err := entry.validate(); err != nil {
+		return err
+	}
+
+	existing := r.Get(entry.Key)
+	if existing == nil {
+		r.Keys = append(r.Keys, entry)
+		return nil
+	}
+
+	// Re-adding a key keeps the date it was first added
+	if existing.Added != "" {
+		entry.Added = ""
+	}
+	for _, field := range []struct {
+		dst *string
+		src string
+	}{
+		{&existing.Comment, entry.Comment},
+		{&existing.Owner, entry.Owner},
+		{&existing.Team, entry.Team},
+		{&existing.Added, entry.Added},
+		{&existing.Expires, entry.Expires},
+	} {
+		if field.src != "" {
+			*field.dst = field.src
+		}
+	}
+	return nil
+}
+
+// Remove deletes the entry for a key
+func (r *Registry) Remove(key string) {
+	for i := range r.Keys {
+		if r.Keys[i].Key == key {
+			r.Keys = append(r.Keys[:i], r.Keys[i+1:]...)
+			return
+		}
+	}
+}
+
+// Comments returns the comment of each key, preferring keys.yml over the
+// comments in .sops.yaml. Either may be nil.
+func Comments(sopsConfig *SOPSConfig, registry *Registry) map[string]string {
+	comments := map[string]string{}
+	if sopsConfig != nil {
+		for key, comment := range sopsConfig.KeyComments {
+			comments[key] = comment
+		}
+	}
+	if registry != nil {
+		for _, entry := range registry.Keys {
+			if entry.Comment != "" {
+				comments[entry.Key] = entry.Comment
+			}
+		}
+	}
+	return comments
+}
+
+// Warnings describes problems with a key as of now: an expiry date in the
+// past, or no recorded owner
+func (r *Registry) Warnings(key string, now time.Time) []string {
+	entry := r.Get(key)
+	if entry == nil {
+		return []string{"not in " + RegistryFile}
+	}
+
+	var warnings []string
+	if entry.Expires != "" {
+		expires, _ := time.Parse(DateFormat, entry.Expires)
+		if !now.Before(expires.AddDate(0, 0, 1)) {
+			warnings = append(warnings, "expired on "+entry.Expires)
+		}
+	}
+	if entry.Owner == "" {
+		warnings = append(warnings, "no owner")
+	}
+	return warnings
+}
+
+// validate checks that an entry names a key and has well-formed dates
+func (e RegistryEntry) validate() error {
+	if e.Key == "" {
+		return fmt.Errorf("entry has no key")
+	}
+	for _, date := range []string{e.Added, e.Expires} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse(DateFormat, date); err != nil {
+			return fmt.Errorf("invalid date %q for %s (expected YYYY-MM-DD)", date, e.Key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package keys
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	dir := t.TempDir()
+
+	registry, err := LoadRegistry(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if registry.Exists() {
+		t.Fatal("Expected no registry before keys.yml is created")
+	}
+
+	if err := registry.Put(RegistryEntry{Key: "age1alice", Owner: "alice", Added: "2024-01-10", Expires: "2025-01-10"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Put(RegistryEntry{Key: "age1ci", Team: "platform", Added: "2024-02-01"}); err != nil {
+		t.Fatal(err)
+	}
+	// Re-adding a key updates it but keeps the date it was first added
+	if err := registry.Put(RegistryEntry{Key: "age1alice", Team: "payments", Added: "2024-06-01"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Put(RegistryEntry{Key: "age1bob", Expires: "next year"}); err == nil {
+		t.Error("Expected an invalid expiry date to be rejected")
+	}
+	if err := registry.Save(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	registry, err = LoadRegistry(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := registry.Get("age1alice")
+	if alice == nil || alice.Owner != "alice" || alice.Team != "payments" || alice.Added != "2024-01-10" {
+		t.Fatalf("Unexpected entry after reload: %+v", alice)
+	}
+
+	now := time.Date(2025, 1, 10, 15, 0, 0, 0, time.UTC)
+	if warnings := registry.Warnings("age1alice", now); len(warnings) != 0 {
+		t.Errorf("Expected a key to be valid on its expiry date, got %v", warnings)
+	}
+	if warnings := registry.Warnings("age1alice", now.AddDate(0, 0, 1)); len(warnings) != 1 || warnings[0] != "expired on 2025-01-10" {
+		t.Errorf("Expected an expiry warning, got %v", warnings)
+	}
+	if warnings := registry.Warnings("age1ci", now); len(warnings) != 1 || warnings[0] != "no owner" {
+		t.Errorf("Expected an unowned warning, got %v", warnings)
+	}
+	if warnings := registry.Warnings("age1unknown", now); len(warnings) != 1 {
+		t.Errorf("Expected a warning for an unregistered key, got %v", warnings)
+	}
+
+	registry.Remove("age1ci")
+	if registry.Get("age1ci") != nil || len(registry.Keys) != 1 {
+		t.Errorf("Expected age1ci to be removed, got %+v", registry.Keys)
+	}
+}
+
+func TestLoadRegistryRejectsBadDates(t *testing.T) {
+	dir := t.TempDir()
+	content := "keys:\n  - key: age1alice\n    expires: 01/02/2025\n"
+	if err := os.WriteFile(filepath.Join(dir, RegistryFile), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadRegistry(dir); err == nil {
+		t.Error("Expected an error for a malformed date")
+	}
+}
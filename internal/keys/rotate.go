@@ -0,0 +1,68 @@
+package keys
+
+import (
+	"fmt"
+
+	"github.com/getsops/sops/v3/decrypt"
+	"github.com/teamcurri/puff/internal/parallel"
+	"github.com/teamcurri/puff/internal/safefile"
+)
+
+// RotateDataKeys re-encrypts every encrypted file, optionally filtered by
+// environment, under a freshly generated data key. Unlike adding or removing
+// keys, which re-wrap the existing data key, this means old copies of a file
+// and old key material can't be used to decrypt new versions. Files keep
+// their key groups. All files are decrypted before any is rewritten.
+func RotateDataKeys(rootDir, env string) ([]string, error) {
+	files, err := findEncryptedFiles(rootDir, env)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find encrypted files: %w", err)
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no encrypted files found in %s", rootDir)
+	}
+
+	// Hold every file until all are rewritten, so changes made meanwhile
+	// aren't overwritten with the values decrypted here
+	lock, err := safefile.Acquire(files...)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
+	plaintexts := make([][]byte, len(files))
+	groups := make([]KeyGroups, len(files))
+	err = parallel.Each(len(files), func(i int) error {
+		fileGroups, err := ReadKeyGroups(files[i])
+		if err != nil {
+			return err
+		}
+		plaintext, err := decrypt.File(files[i], "yaml")
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %s: %w", files[i], err)
+		}
+		groups[i] = fileGroups
+		plaintexts[i] = plaintext
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = parallel.Each(len(files), func(i int) error {
+		encrypted, err := EncryptDataWithGroups(plaintexts[i], files[i], groups[i])
+		if err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", files[i], err)
+		}
+		if err := safefile.Write(files[i], encrypted, 0600); err != nil {
+			return fmt.Errorf("failed to write %s: %w", files[i], err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
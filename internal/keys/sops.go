@@ -1,16 +1,22 @@
 package keys
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/getsops/sops/v3"
-	"github.com/getsops/sops/v3/age"
 	"github.com/getsops/sops/v3/aes"
 	"github.com/getsops/sops/v3/cmd/sops/common"
 	"github.com/getsops/sops/v3/keyservice"
 	sopsyaml "github.com/getsops/sops/v3/stores/yaml"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/parallel"
+	"github.com/teamcurri/puff/internal/safefile"
 	"gopkg.in/yaml.v3"
 )
 
@@ -18,47 +24,87 @@ import (
 type KeyInfo struct {
 	Key     string
 	Comment string
-	Envs    []string // Environments this key has access to
+	Envs    []string // Environments with files encrypted to the key
+	// Declared is set for keys in a creation rule of .sops.yaml
+	Declared bool
 }
 
-// EncryptFile encrypts a YAML file using SOPS with the specified age keys
+// Unused reports whether a key is declared in .sops.yaml but no file is
+// encrypted to it
+func (k KeyInfo) Unused() bool {
+	return k.Declared && len(k.Envs) == 0
+}
+
+// Undeclared reports whether files are encrypted to a key that is missing
+// from .sops.yaml, so files created from now on won't be
+func (k KeyInfo) Undeclared() bool {
+	return !k.Declared && len(k.Envs) > 0
+}
+
+// EncryptFile encrypts a YAML file using SOPS with the specified keys, which
+// may be age recipients or cloud KMS keys
 func EncryptFile(filePath string, ageKeys []string) error {
+	return EncryptFileWithGroups(filePath, SingleGroup(ageKeys))
+}
+
+// EncryptFileWithGroups encrypts a YAML file in place using the given key groups
+func EncryptFileWithGroups(filePath string, groups KeyGroups) error {
 	// Read the plain file
 	fileBytes, err := os.ReadFile(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to read file: %w", err)
 	}
 
+	encryptedFile, err := EncryptDataWithGroups(fileBytes, filePath, groups)
+	if err != nil {
+		return err
+	}
+
+	// Ensure directory exists with restrictive permissions
+	dir := filepath.Dir(filePath)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	// Write encrypted file back with restricted permissions
+	return safefile.Write(filePath, encryptedFile, 0600)
+}
+
+// EncryptData encrypts plain YAML data using SOPS with the specified keys
+// and returns the encrypted file contents. filePath is recorded in the SOPS
+// tree but nothing is read from or written to disk.
+func EncryptData(fileBytes []byte, filePath string, ageKeys []string) ([]byte, error) {
+	return EncryptDataWithGroups(fileBytes, filePath, SingleGroup(ageKeys))
+}
+
+// EncryptDataWithGroups encrypts plain YAML data like EncryptData, splitting
+// the data key between several key groups if more than one is given
+func EncryptDataWithGroups(fileBytes []byte, filePath string, groups KeyGroups) ([]byte, error) {
 	// Load plain YAML into SOPS tree
 	store := sopsyaml.Store{}
 	branches, err := store.LoadPlainFile(fileBytes)
 	if err != nil {
-		return fmt.Errorf("failed to parse YAML: %w", err)
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
 	}
 
-	// Create age master keys from recipients
-	var ageMasterKeys []age.MasterKey
-	for _, key := range ageKeys {
-		masterKey, err := age.MasterKeyFromRecipient(key)
-		if err != nil {
-			return fmt.Errorf("failed to create master key from recipient %s: %w", key, err)
-		}
-		ageMasterKeys = append(ageMasterKeys, *masterKey)
+	// Build KeyGroups for metadata from age recipients and cloud KMS keys
+	if err := groups.validate(); err != nil {
+		return nil, err
 	}
-
-	// Build KeyGroups for metadata
-	var keyGroups []sops.KeyGroup
-	keyGroup := sops.KeyGroup{}
-	for i := range ageMasterKeys {
-		keyGroup = append(keyGroup, &ageMasterKeys[i])
+	keyGroups, err := buildKeyGroups(groups)
+	if err != nil {
+		return nil, err
+	}
+	if !groups.IsShamir() {
+		groups.Threshold = 0
 	}
-	keyGroups = append(keyGroups, keyGroup)
 
 	// Create tree with metadata
 	tree := sops.Tree{
 		Branches: branches,
 		Metadata: sops.Metadata{
 			KeyGroups:      keyGroups,
+			ShamirThreshold: groups.Threshold,
 			UnencryptedSuffix: "_unencrypted",
 			EncryptedSuffix:   "",
 			Version:           "3.9.0",
@@ -73,7 +119,7 @@ func EncryptFile(filePath string, ageKeys []string) error {
 		},
 	)
 	if len(errs) > 0 {
-		return fmt.Errorf("failed to generate data key (%d errors)", len(errs))
+		return nil, fmt.Errorf("failed to generate data key: %v", errs[0])
 	}
 
 	// Encrypt the tree
@@ -84,48 +130,50 @@ func EncryptFile(filePath string, ageKeys []string) error {
 		Cipher:  cipher,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to encrypt tree: %w", err)
+		return nil, fmt.Errorf("failed to encrypt tree: %w", err)
 	}
 
 	// Emit encrypted file
 	encryptedFile, err := store.EmitEncryptedFile(tree)
 	if err != nil {
-		return fmt.Errorf("failed to emit encrypted file: %w", err)
+		return nil, fmt.Errorf("failed to emit encrypted file: %w", err)
 	}
 
-	// Ensure directory exists with restrictive permissions
-	dir := filepath.Dir(filePath)
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
-	}
-
-	// Write encrypted file back with restricted permissions
-	err = os.WriteFile(filePath, encryptedFile, 0600)
-	if err != nil {
-		return fmt.Errorf("failed to write encrypted file: %w", err)
-	}
-
-	return nil
+	return encryptedFile, nil
 }
 
 
-// ListKeys lists all keys from SOPS-encrypted files in the config directory
+// ListKeys lists the keys declared in .sops.yaml followed by any other keys
+// the files are encrypted to, with their comments and the environments of
+// the files encrypted to each
 func ListKeys(rootDir string) ([]KeyInfo, error) {
-	keyMap := make(map[string]*KeyInfo)
+	var result []KeyInfo
+	index := make(map[string]int)
 
-	// Walk through all .yml files in the config directory
-	err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	sopsConfig, err := LoadSOPSConfig(rootDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if sopsConfig != nil {
+		for _, key := range sopsConfig.AllKeys() {
+			index[key] = len(result)
+			result = append(result, KeyInfo{Key: key, Envs: []string{}, Declared: true})
 		}
+	}
 
-		// Skip directories and non-yml files
-		if info.IsDir() || filepath.Ext(path) != ".yml" {
-			return nil
+	project, err := config.LoadProject(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Walk through all .yml and .yaml files in the config directory
+	err = filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
 		}
 
-		// Skip .sops.yaml
-		if filepath.Base(path) == ".sops.yaml" {
+		// Skip directories, non-YAML files, and .sops.yaml
+		if info.IsDir() || !isYAMLFile(info.Name()) {
 			return nil
 		}
 
@@ -142,49 +190,21 @@ func ListKeys(rootDir string) ([]KeyInfo, error) {
 		}
 
 		// Check if this is a SOPS file
-		sopsData, ok := yamlData["sops"]
-		if !ok {
+		if _, ok := yamlData["sops"].(map[string]interface{}); !ok {
 			return nil // Not a SOPS file, skip
 		}
 
-		// Extract age keys from SOPS metadata
-		if sopsMap, ok := sopsData.(map[string]interface{}); ok {
-			if ageArray, ok := sopsMap["age"].([]interface{}); ok {
-				// Determine which env this file belongs to
-				relPath, _ := filepath.Rel(rootDir, path)
-				env := filepath.Dir(relPath)
-				if env == "base" || env == "." {
-					env = "base"
-				} else if filepath.Dir(env) == "target-overrides" {
-					env = fmt.Sprintf("target:%s", filepath.Base(env))
-				}
-
-				// Process each age key
-				for _, ageEntry := range ageArray {
-					if ageMap, ok := ageEntry.(map[string]interface{}); ok {
-						recipient, _ := ageMap["recipient"].(string)
-						if recipient != "" {
-							if _, exists := keyMap[recipient]; !exists {
-								keyMap[recipient] = &KeyInfo{
-									Key:  recipient,
-									Envs: []string{},
-								}
-							}
-							// Add env if not already present
-							keyInfo := keyMap[recipient]
-							found := false
-							for _, e := range keyInfo.Envs {
-								if e == env {
-									found = true
-									break
-								}
-							}
-							if !found {
-								keyInfo.Envs = append(keyInfo.Envs, env)
-							}
-						}
-					}
-				}
+		// Record the file's environment for each of its keys
+		env := fileEnv(project, rootDir, path)
+		for _, recipient := range ExtractKeys(yamlData) {
+			i, exists := index[recipient]
+			if !exists {
+				i = len(result)
+				index[recipient] = i
+				result = append(result, KeyInfo{Key: recipient, Envs: []string{}})
+			}
+			if !slices.Contains(result[i].Envs, env) {
+				result[i].Envs = append(result[i].Envs, env)
 			}
 		}
 
@@ -195,110 +215,186 @@ func ListKeys(rootDir string) ([]KeyInfo, error) {
 		return nil, fmt.Errorf("failed to walk directory: %w", err)
 	}
 
-	// Convert map to slice
-	result := make([]KeyInfo, 0, len(keyMap))
-	for _, info := range keyMap {
-		result = append(result, *info)
+	registry, err := LoadRegistry(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	comments := Comments(sopsConfig, registry)
+	for i := range result {
+		result[i].Comment = comments[result[i].Key]
 	}
 
 	return result, nil
 }
 
-// AddKey adds an age key to all encrypted files, optionally filtering by environment
+// AddKey adds an age key or cloud KMS key to all encrypted files, optionally filtering by environment
 func AddKey(rootDir, ageKey, comment, env string) error {
+	return AddKeys(rootDir, []Recipient{{Key: ageKey, Comment: comment}}, env)
+}
+
+// AddKeys adds several keys to all encrypted files in a single pass,
+// optionally filtering by environment. Without an environment, files of
+// environments with their own keys in .sops.yaml are left alone.
+func AddKeys(rootDir string, recipients []Recipient, env string) error {
+	files, newKeys, err := keysToAdd(rootDir, recipients, env)
+	if err != nil {
+		return err
+	}
+
+	// Update .sops.yaml with the new keys
+	if err := addKeysToSOPSRule(rootDir, env, recipients); err != nil {
+		return fmt.Errorf("failed to update .sops.yaml: %w", err)
+	}
+
+	// Process the files in parallel
+	return parallel.Each(len(files), func(i int) error {
+		if err := addKeysToFile(files[i], newKeys); err != nil {
+			return fmt.Errorf("failed to add keys to %s: %w", files[i], err)
+		}
+		return nil
+	})
+}
+
+// PlanAddKeys returns the encrypted files AddKeys would update, those
+// missing any of the keys, without changing anything
+func PlanAddKeys(rootDir string, recipients []Recipient, env string) ([]string, error) {
+	files, newKeys, err := keysToAdd(rootDir, recipients, env)
+	if err != nil {
+		return nil, err
+	}
+	return filesMatching(files, func(keyGroups []sops.KeyGroup) (bool, error) {
+		for _, key := range newKeys {
+			if !fileHasKey(keyGroups, key) {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+}
+
+// keysToAdd returns the files AddKeys updates and the keys it adds to them,
+// validating the key formats before anything is changed
+func keysToAdd(rootDir string, recipients []Recipient, env string) ([]string, []string, error) {
 	files, err := findEncryptedFiles(rootDir, env)
 	if err != nil {
-		return fmt.Errorf("failed to find encrypted files: %w", err)
+		return nil, nil, fmt.Errorf("failed to find encrypted files: %w", err)
+	}
+	if env == "" {
+		if files, err = filesUsingDefaultKeys(rootDir, files); err != nil {
+			return nil, nil, err
+		}
 	}
 
 	if len(files) == 0 {
-		return fmt.Errorf("no encrypted files found in %s", rootDir)
+		return nil, nil, fmt.Errorf("no encrypted files found in %s", rootDir)
+	}
+
+	newKeys := make([]string, 0, len(recipients))
+	for _, recipient := range recipients {
+		if err := ValidateKey(recipient.Key); err != nil {
+			if TypeOf(recipient.Key) != KeyTypeAge {
+				return nil, nil, err
+			}
+			return nil, nil, fmt.Errorf("invalid age key: %w", err)
+		}
+		newKeys = append(newKeys, recipient.Key)
 	}
+	return files, newKeys, nil
+}
 
-	// Validate the age key format
-	_, err = age.MasterKeyFromRecipient(ageKey)
+// RemoveKey removes an age key or cloud KMS key from all encrypted files, optionally filtering by environment
+func RemoveKey(rootDir, ageKey, env string) error {
+	files, err := filesToRemoveKey(rootDir, env)
 	if err != nil {
-		return fmt.Errorf("invalid age key: %w", err)
+		return err
 	}
 
-	// Update .sops.yaml with the new key
-	if err := AddKeyToSOPSConfig(rootDir, ageKey, comment); err != nil {
+	// Update .sops.yaml to remove the key
+	if err := removeKeyFromSOPSRules(rootDir, env, ageKey); err != nil {
 		return fmt.Errorf("failed to update .sops.yaml: %w", err)
 	}
 
-	// Process each file
-	for _, file := range files {
-		if err := addKeyToFile(file, ageKey); err != nil {
-			return fmt.Errorf("failed to add key to %s: %w", file, err)
+	// Process the files in parallel
+	return parallel.Each(len(files), func(i int) error {
+		if err := removeKeyFromFile(files[i], ageKey); err != nil {
+			return fmt.Errorf("failed to remove key from %s: %w", files[i], err)
 		}
-	}
+		return nil
+	})
+}
 
-	return nil
+// PlanRemoveKey returns the encrypted files RemoveKey would update, those
+// encrypted to the key, without changing anything
+func PlanRemoveKey(rootDir, ageKey, env string) ([]string, error) {
+	files, err := filesToRemoveKey(rootDir, env)
+	if err != nil {
+		return nil, err
+	}
+	return filesMatching(files, func(keyGroups []sops.KeyGroup) (bool, error) {
+		_, found, err := withoutKey(keyGroups, ageKey)
+		return found, err
+	})
 }
 
-// RemoveKey removes an age key from all encrypted files, optionally filtering by environment
-func RemoveKey(rootDir, ageKey, env string) error {
+// filesToRemoveKey returns the encrypted files RemoveKey looks at
+func filesToRemoveKey(rootDir, env string) ([]string, error) {
 	files, err := findEncryptedFiles(rootDir, env)
 	if err != nil {
-		return fmt.Errorf("failed to find encrypted files: %w", err)
+		return nil, fmt.Errorf("failed to find encrypted files: %w", err)
 	}
 
 	if len(files) == 0 {
-		return fmt.Errorf("no encrypted files found in %s", rootDir)
-	}
-
-	// Update .sops.yaml to remove the key
-	if err := RemoveKeyFromSOPSConfig(rootDir, ageKey); err != nil {
-		return fmt.Errorf("failed to update .sops.yaml: %w", err)
+		return nil, fmt.Errorf("no encrypted files found in %s", rootDir)
 	}
+	return files, nil
+}
 
-	// Process each file
+// filesMatching returns the encrypted files whose key groups match
+func filesMatching(files []string, match func([]sops.KeyGroup) (bool, error)) ([]string, error) {
+	store := sopsyaml.Store{}
+	var matched []string
 	for _, file := range files {
-		if err := removeKeyFromFile(file, ageKey); err != nil {
-			return fmt.Errorf("failed to remove key from %s: %w", file, err)
+		fileBytes, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		tree, err := store.LoadEncryptedFile(fileBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %w", file, err)
+		}
+		ok, err := match(tree.Metadata.KeyGroups)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if ok {
+			matched = append(matched, file)
 		}
 	}
-
-	return nil
+	return matched, nil
 }
 
 // findEncryptedFiles finds all SOPS-encrypted YAML files in the directory
 func findEncryptedFiles(rootDir, envFilter string) ([]string, error) {
 	var files []string
 
-	err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
+	project, err := config.LoadProject(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
-		// Skip directories and non-yml files
-		if info.IsDir() || filepath.Ext(path) != ".yml" {
-			return nil
-		}
-
-		// Skip .sops.yaml
-		if filepath.Base(path) == ".sops.yaml" {
+		// Skip directories, non-YAML files, and .sops.yaml
+		if info.IsDir() || !isYAMLFile(info.Name()) {
 			return nil
 		}
 
 		// If env filter is specified, check if file is in that env
-		if envFilter != "" {
-			relPath, _ := filepath.Rel(rootDir, path)
-			fileEnv := filepath.Dir(relPath)
-
-			// Check if this matches the env filter
-			match := false
-			if envFilter == "base" && (fileEnv == "base" || fileEnv == ".") {
-				match = true
-			} else if fileEnv == envFilter {
-				match = true
-			} else if filepath.Dir(fileEnv) == "target-overrides" && filepath.Base(fileEnv) == envFilter {
-				match = true
-			}
-
-			if !match {
-				return nil
-			}
+		if envFilter != "" && !inEnv(project, rootDir, path, envFilter) {
+			return nil
 		}
 
 		// Check if file is SOPS-encrypted
@@ -323,9 +419,61 @@ func findEncryptedFiles(rootDir, envFilter string) ([]string, error) {
 	return files, err
 }
 
-// addKeyToFile adds an age key to a single encrypted file
-func addKeyToFile(filePath, recipientKey string) error {
-	store := sopsyaml.Store{}
+// isYAMLFile reports whether a file name is that of a .yml or .yaml file
+// other than a hidden file, such as .sops.yaml
+func isYAMLFile(name string) bool {
+	ext := filepath.Ext(name)
+	return (ext == ".yml" || ext == ".yaml") && !strings.HasPrefix(name, ".")
+}
+
+// inEnv reports whether a file belongs to an environment, "base" for the
+// base layer. Files of a custom layout in .puff.yaml are placed by their
+// level.
+func inEnv(project *config.Project, rootDir, path, env string) bool {
+	relPath, _ := filepath.Rel(rootDir, path)
+	if project.Layout.Custom() {
+		level, ok := project.FileLevel(relPath)
+		return ok && (level.Env == env || (env == "base" && level.Env == ""))
+	}
+
+	fileEnv := filepath.Dir(relPath)
+	switch {
+	case env == "base" && (fileEnv == "base" || fileEnv == "."):
+		return true
+	case fileEnv == env:
+		return true
+	case filepath.Dir(fileEnv) == "target-overrides" && filepath.Base(fileEnv) == env:
+		return true
+	case filepath.Dir(filepath.Dir(fileEnv)) == "target-overrides" && filepath.Base(fileEnv) == env:
+		// target-overrides/{target}/{env}
+		return true
+	}
+	return false
+}
+
+// filesUsingDefaultKeys drops the files of environments with their own keys
+// in .sops.yaml
+func filesUsingDefaultKeys(rootDir string, files []string) ([]string, error) {
+	config, err := LoadSOPSConfig(rootDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SOPS config: %w", err)
+	}
+	kept := files[:0]
+	for _, file := range files {
+		if _, ok := config.RuleKeys(relativePath(rootDir, file)); !ok {
+			kept = append(kept, file)
+		}
+	}
+	return kept, nil
+}
+
+// addKeysToFile adds age keys or cloud KMS keys to a single encrypted file
+func addKeysToFile(filePath string, recipientKeys []string) error {
+	lock, err := safefile.Acquire(filePath)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
 
 	// Read file and load it properly
 	fileBytes, err := os.ReadFile(filePath)
@@ -333,39 +481,63 @@ func addKeyToFile(filePath, recipientKey string) error {
 		return fmt.Errorf("failed to read file: %w", err)
 	}
 
-	tree, err := store.LoadEncryptedFile(fileBytes)
-	if err != nil {
-		return fmt.Errorf("failed to load encrypted file: %w", err)
+	encryptedFile, added, err := addKeysToData(fileBytes, recipientKeys)
+	if err != nil || added == 0 {
+		return err
 	}
 
-	// Create new master key
-	newMasterKey, err := age.MasterKeyFromRecipient(recipientKey)
-	if err != nil {
-		return fmt.Errorf("failed to create master key: %w", err)
+	// Ensure directory exists with restrictive permissions
+	dir := filepath.Dir(filePath)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	// Check if key already exists
-	for _, group := range tree.Metadata.KeyGroups {
-		for _, key := range group {
-			if existingAgeKey, ok := key.(*age.MasterKey); ok {
-				if existingAgeKey.Recipient == newMasterKey.Recipient {
-					// Key already exists, skip
-					return nil
-				}
-			}
-		}
+	// Write back to file with restricted permissions
+	return safefile.Write(filePath, encryptedFile, 0600)
+}
+
+// AddKeysToData adds age keys or cloud KMS keys to the contents of an
+// encrypted file, returning the contents unchanged if it already has them
+func AddKeysToData(fileBytes []byte, recipientKeys []string) ([]byte, error) {
+	encryptedFile, _, err := addKeysToData(fileBytes, recipientKeys)
+	return encryptedFile, err
+}
+
+// addKeysToData adds keys to the contents of an encrypted file, returning
+// the new contents and the number of keys added
+func addKeysToData(fileBytes []byte, recipientKeys []string) ([]byte, int, error) {
+	store := sopsyaml.Store{}
+
+	tree, err := store.LoadEncryptedFile(fileBytes)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load encrypted file: %w", err)
 	}
 
-	// Add the new key to the first key group (or create one if none exist)
+	// Add the new keys to the first key group (or create one if none exist)
 	if len(tree.Metadata.KeyGroups) == 0 {
 		tree.Metadata.KeyGroups = append(tree.Metadata.KeyGroups, sops.KeyGroup{})
 	}
-	tree.Metadata.KeyGroups[0] = append(tree.Metadata.KeyGroups[0], newMasterKey)
+	added := 0
+	for _, recipientKey := range recipientKeys {
+		if fileHasKey(tree.Metadata.KeyGroups, recipientKey) {
+			continue // Key already exists, skip
+		}
+
+		newMasterKey, err := masterKeyFromString(recipientKey)
+		if err != nil {
+			return nil, 0, err
+		}
+		tree.Metadata.KeyGroups[0] = append(tree.Metadata.KeyGroups[0], newMasterKey)
+		added++
+	}
+	if added == 0 {
+		return fileBytes, 0, nil
+	}
 
 	// Get existing data key
 	dataKey, err := tree.Metadata.GetDataKey()
 	if err != nil {
-		return fmt.Errorf("failed to get data key: %w", err)
+		return nil, 0, fmt.Errorf("failed to get data key: %w", err)
 	}
 
 	// Update all master keys with the data key (including the new one)
@@ -373,31 +545,37 @@ func addKeyToFile(filePath, recipientKey string) error {
 		keyservice.NewLocalClient(),
 	})
 	if len(errs) > 0 {
-		return fmt.Errorf("failed to update master keys (%d errors)", len(errs))
+		return nil, 0, fmt.Errorf("failed to update master keys: %v", errs[0])
 	}
 
 	// Emit the updated encrypted file
 	encryptedFile, err := store.EmitEncryptedFile(tree)
 	if err != nil {
-		return fmt.Errorf("failed to emit encrypted file: %w", err)
-	}
-
-	// Ensure directory exists with restrictive permissions
-	dir := filepath.Dir(filePath)
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
+		return nil, 0, fmt.Errorf("failed to emit encrypted file: %w", err)
 	}
+	return encryptedFile, added, nil
+}
 
-	// Write back to file with restricted permissions
-	if err := os.WriteFile(filePath, encryptedFile, 0600); err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+// fileHasKey reports whether any of a file's key groups contains key
+func fileHasKey(keyGroups []sops.KeyGroup, key string) bool {
+	for _, group := range keyGroups {
+		for _, masterKey := range group {
+			if keyMatches(masterKey, key) {
+				return true
+			}
+		}
 	}
-
-	return nil
+	return false
 }
 
-// removeKeyFromFile removes an age key from a single encrypted file
+// removeKeyFromFile removes an age key or cloud KMS key from a single encrypted file
 func removeKeyFromFile(filePath, ageKey string) error {
+	lock, err := safefile.Acquire(filePath)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
 	// Load the encrypted file
 	store := sopsyaml.Store{}
 
@@ -412,39 +590,15 @@ func removeKeyFromFile(filePath, ageKey string) error {
 	}
 
 	// Remove the key from all key groups
-	found := false
-	for i, group := range tree.Metadata.KeyGroups {
-		newGroup := sops.KeyGroup{}
-		for _, key := range group {
-			if ageMasterKey, ok := key.(*age.MasterKey); ok {
-				if ageMasterKey.Recipient != ageKey {
-					newGroup = append(newGroup, key)
-				} else {
-					found = true
-				}
-			} else {
-				newGroup = append(newGroup, key)
-			}
-		}
-		tree.Metadata.KeyGroups[i] = newGroup
+	keyGroups, found, err := withoutKey(tree.Metadata.KeyGroups, ageKey)
+	if err != nil {
+		return err
 	}
-
 	if !found {
 		// Key wasn't in this file, skip
 		return nil
 	}
-
-	// Ensure at least one key remains
-	hasKeys := false
-	for _, group := range tree.Metadata.KeyGroups {
-		if len(group) > 0 {
-			hasKeys = true
-			break
-		}
-	}
-	if !hasKeys {
-		return fmt.Errorf("cannot remove the last key from file")
-	}
+	tree.Metadata.KeyGroups = keyGroups
 
 	// Get existing data key and update master keys
 	dataKey, err := tree.Metadata.GetDataKey()
@@ -457,7 +611,7 @@ func removeKeyFromFile(filePath, ageKey string) error {
 		keyservice.NewLocalClient(),
 	})
 	if len(errs) > 0 {
-		return fmt.Errorf("failed to update master keys after removal (%d errors)", len(errs))
+		return fmt.Errorf("failed to update master keys after removal: %v", errs[0])
 	}
 
 	// Emit the updated encrypted file
@@ -473,11 +627,40 @@ func removeKeyFromFile(filePath, ageKey string) error {
 	}
 
 	// Write back to file with restricted permissions
-	if err := os.WriteFile(filePath, encryptedFile, 0600); err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+	return safefile.Write(filePath, encryptedFile, 0600)
+}
+
+// withoutKey returns key groups with a key removed from every group, and
+// whether any group held it. Every group must keep at least one key.
+func withoutKey(keyGroups []sops.KeyGroup, ageKey string) ([]sops.KeyGroup, bool, error) {
+	found := false
+	newGroups := make([]sops.KeyGroup, 0, len(keyGroups))
+	for _, group := range keyGroups {
+		newGroup := sops.KeyGroup{}
+		for _, key := range group {
+			if !keyMatches(key, ageKey) {
+				newGroup = append(newGroup, key)
+			} else {
+				found = true
+			}
+		}
+		newGroups = append(newGroups, newGroup)
+	}
+	if !found {
+		return keyGroups, false, nil
 	}
 
-	return nil
+	// Ensure every key group keeps at least one key
+	for i, group := range newGroups {
+		if len(group) > 0 {
+			continue
+		}
+		if len(newGroups) > 1 {
+			return nil, true, fmt.Errorf("cannot remove the last key from key group %d (use 'puff keys group rm' to remove the group)", i+1)
+		}
+		return nil, true, fmt.Errorf("cannot remove the last key from file")
+	}
+	return newGroups, true, nil
 }
 
 // ExtractAgeKeys extracts age keys from parsed SOPS YAML metadata
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
+	"github.com/teamcurri/puff/internal/safefile"
 	"gopkg.in/yaml.v3"
 )
 
@@ -17,10 +19,33 @@ type SOPSConfig struct {
 
 // CreationRule represents a single creation rule in SOPS config
 type CreationRule struct {
-	PathRegex string `yaml:"path_regex"`
-	Age       string `yaml:"age"`
+	PathRegex     string `yaml:"path_regex"`
+	Age           string `yaml:"age,omitempty"`
+	KMS           string `yaml:"kms,omitempty"`
+	GCPKMS        string `yaml:"gcp_kms,omitempty"`
+	AzureKeyVault string `yaml:"azure_keyvault,omitempty"`
+	PGP           string `yaml:"pgp,omitempty"`
 }
 
+// keyField returns the field holding keys of the given type
+func (r *CreationRule) keyField(keyType KeyType) *string {
+	switch keyType {
+	case KeyTypeKMS:
+		return &r.KMS
+	case KeyTypeGCPKMS:
+		return &r.GCPKMS
+	case KeyTypeAzureKV:
+		return &r.AzureKeyVault
+	case KeyTypePGP:
+		return &r.PGP
+	default:
+		return &r.Age
+	}
+}
+
+// noComment stands in for the comment of a key without one in .sops.yaml
+const noComment = "No comment"
+
 // LoadSOPSConfig loads and parses the .sops.yaml file
 func LoadSOPSConfig(rootDir string) (*SOPSConfig, error) {
 	sopsPath := filepath.Join(rootDir, ".sops.yaml")
@@ -36,13 +61,15 @@ func LoadSOPSConfig(rootDir string) (*SOPSConfig, error) {
 	for _, line := range lines {
 		trimmed := strings.TrimSpace(line)
 
-		// Parse comment format: # age1... (Comment Text)
-		if strings.HasPrefix(trimmed, "# age1") {
+		// Parse comment format: # age1... (Comment Text), with any key type
+		if strings.HasPrefix(trimmed, "# ") {
 			content := strings.TrimPrefix(trimmed, "# ")
-			if idx := strings.Index(content, " ("); idx > 0 {
+			if idx := strings.Index(content, " ("); idx > 0 && isKeyString(content[:idx]) {
 				key := content[:idx]
 				comment := strings.TrimSuffix(content[idx+2:], ")")
-				keyComments[key] = comment
+				if comment != noComment {
+					keyComments[key] = comment
+				}
 			}
 		}
 	}
@@ -65,14 +92,15 @@ func SaveSOPSConfig(rootDir string, config *SOPSConfig) error {
 
 	// Write commented keys at the top
 	output.WriteString("# SOPS configuration for Puff\n")
-	output.WriteString("# Age encryption keys with their associated comments\n")
+	output.WriteString("# Encryption keys with their associated comments\n")
 
-	// Get all keys from the first creation rule
-	keys := getKeysFromConfig(config)
+	// List the keys of every creation rule, so environments with their own
+	// keys keep their comments too
+	keys := config.AllKeys()
 	for _, key := range keys {
 		comment := config.KeyComments[key]
 		if comment == "" {
-			comment = "No comment"
+			comment = noComment
 		}
 		output.WriteString(fmt.Sprintf("# %s (%s)\n", key, comment))
 	}
@@ -88,99 +116,293 @@ func SaveSOPSConfig(rootDir string, config *SOPSConfig) error {
 	output.Write(yamlData)
 
 	// Write with restricted permissions
-	if err := os.WriteFile(sopsPath, []byte(output.String()), 0600); err != nil {
+	if err := safefile.Write(sopsPath, []byte(output.String()), 0600); err != nil {
 		return fmt.Errorf("failed to write .sops.yaml: %w", err)
 	}
 
 	return nil
 }
 
-// AddKeyToSOPSConfig adds an age key to the SOPS configuration
+// AddKeyToSOPSConfig adds an age key or cloud KMS key to the SOPS configuration
 func AddKeyToSOPSConfig(rootDir, ageKey, comment string) error {
+	return AddKeysToSOPSConfig(rootDir, []Recipient{{Key: ageKey, Comment: comment}})
+}
+
+// AddKeysToSOPSConfig adds keys to the SOPS configuration. Comments of keys
+// that are already present are updated if provided.
+func AddKeysToSOPSConfig(rootDir string, recipients []Recipient) error {
+	return addKeysToSOPSRule(rootDir, "", recipients)
+}
+
+// addKeysToSOPSRule adds keys to the creation rule of an environment with its
+// own keys, or to the default rule if env is empty or has none
+func addKeysToSOPSRule(rootDir, env string, recipients []Recipient) error {
+	lock, err := safefile.Acquire(filepath.Join(rootDir, ".sops.yaml"))
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
 	config, err := LoadSOPSConfig(rootDir)
 	if err != nil {
 		return fmt.Errorf("failed to load SOPS config: %w", err)
 	}
 
 	// Get existing keys
-	keys := getKeysFromConfig(config)
-
-	// Check if key already exists
+	rule := config.keyRule(env)
+	keys := ruleKeys(rule)
+	existing := make(map[string]bool, len(keys))
 	for _, k := range keys {
-		if k == ageKey {
-			// Update comment if provided
-			if comment != "" {
-				config.KeyComments[ageKey] = comment
-			}
-			return SaveSOPSConfig(rootDir, config)
-		}
+		existing[k] = true
 	}
 
-	// Add new key
-	keys = append(keys, ageKey)
-	if comment != "" {
-		config.KeyComments[ageKey] = comment
+	for _, recipient := range recipients {
+		if !existing[recipient.Key] {
+			existing[recipient.Key] = true
+			keys = append(keys, recipient.Key)
+		}
+		if recipient.Comment != "" {
+			config.KeyComments[recipient.Key] = recipient.Comment
+		}
 	}
 
-	// Update the first creation rule
-	if len(config.CreationRules) > 0 {
-		config.CreationRules[0].Age = formatAgeKeys(keys)
-	}
+	setRuleKeys(rule, keys)
 
 	return SaveSOPSConfig(rootDir, config)
 }
 
-// RemoveKeyFromSOPSConfig removes an age key from the SOPS configuration
+// RemoveKeyFromSOPSConfig removes an age key or cloud KMS key from every
+// creation rule in the SOPS configuration
 func RemoveKeyFromSOPSConfig(rootDir, ageKey string) error {
+	return removeKeyFromSOPSRules(rootDir, "", ageKey)
+}
+
+// removeKeyFromSOPSRules removes a key from the creation rule of an
+// environment with its own keys, or from every rule if env is empty or has
+// none of its own
+func removeKeyFromSOPSRules(rootDir, env, ageKey string) error {
+	lock, err := safefile.Acquire(filepath.Join(rootDir, ".sops.yaml"))
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
 	config, err := LoadSOPSConfig(rootDir)
 	if err != nil {
 		return fmt.Errorf("failed to load SOPS config: %w", err)
 	}
 
-	// Get existing keys
-	keys := getKeysFromConfig(config)
+	rules := make([]*CreationRule, 0, len(config.CreationRules))
+	if index := config.envRuleIndex(env); index >= 0 {
+		rules = append(rules, &config.CreationRules[index])
+	} else {
+		for i := range config.CreationRules {
+			rules = append(rules, &config.CreationRules[i])
+		}
+	}
 
 	// Remove the key
-	newKeys := []string{}
 	found := false
-	for _, k := range keys {
-		if k != ageKey {
-			newKeys = append(newKeys, k)
-		} else {
-			found = true
+	for _, rule := range rules {
+		newKeys := []string{}
+		for _, k := range ruleKeys(rule) {
+			if k != ageKey {
+				newKeys = append(newKeys, k)
+			} else {
+				found = true
+			}
 		}
+		setRuleKeys(rule, newKeys)
 	}
 
 	if !found {
 		return fmt.Errorf("key not found in .sops.yaml: %s", ageKey)
 	}
 
-	// Remove from comments
-	delete(config.KeyComments, ageKey)
-
-	// Update the first creation rule
-	if len(config.CreationRules) > 0 {
-		config.CreationRules[0].Age = formatAgeKeys(newKeys)
+	// Keep the comment while another rule still uses the key
+	stillUsed := false
+	for _, k := range config.AllKeys() {
+		if k == ageKey {
+			stillUsed = true
+		}
+	}
+	if !stillUsed {
+		delete(config.KeyComments, ageKey)
 	}
 
 	return SaveSOPSConfig(rootDir, config)
 }
 
-// getKeysFromConfig extracts age keys from the SOPS config
-func getKeysFromConfig(config *SOPSConfig) []string {
-	if len(config.CreationRules) == 0 {
-		return []string{}
+// Keys returns the age keys and cloud KMS keys new files are encrypted to
+// unless an environment has its own keys
+func (c *SOPSConfig) Keys() []string {
+	return getKeysFromConfig(c)
+}
+
+// EnvRulePathRegex returns the path_regex of the creation rule that gives an
+// environment its own keys. It matches the environment's files and its
+// target overrides, with either extension, .yml or .yaml.
+func EnvRulePathRegex(env string) string {
+	return `^(target-overrides/[^/]+/)?` + regexp.QuoteMeta(env) + `/[^/]+\.ya?ml$`
+}
+
+// EnvKeys returns the keys of an environment's own creation rule. ok is false
+// if the environment uses the default keys.
+func (c *SOPSConfig) EnvKeys(env string) (keys []string, ok bool) {
+	index := c.envRuleIndex(env)
+	if index < 0 {
+		return nil, false
+	}
+	return ruleKeys(&c.CreationRules[index]), true
+}
+
+// AddEnvRule adds a creation rule encrypting an environment's files to its own
+// keys. It goes ahead of the default rule, since SOPS uses the first rule
+// matching a file.
+func (c *SOPSConfig) AddEnvRule(env string, keys []string) error {
+	if len(c.CreationRules) == 0 {
+		return fmt.Errorf(".sops.yaml has no creation rules")
+	}
+	if c.envRuleIndex(env) >= 0 {
+		return fmt.Errorf("environment %s already has its own keys in .sops.yaml", env)
+	}
+
+	rule := CreationRule{PathRegex: EnvRulePathRegex(env)}
+	setRuleKeys(&rule, keys)
+	last := len(c.CreationRules) - 1
+	c.CreationRules = append(c.CreationRules[:last], rule, c.CreationRules[last])
+	return nil
+}
+
+// RemoveEnvRule removes an environment's own creation rule, reporting whether
+// it had one
+func (c *SOPSConfig) RemoveEnvRule(env string) bool {
+	index := c.envRuleIndex(env)
+	if index < 0 {
+		return false
 	}
+	c.CreationRules = append(c.CreationRules[:index], c.CreationRules[index+1:]...)
+	return true
+}
 
-	ageStr := config.CreationRules[0].Age
+// RuleKeys returns the keys of the creation rule SOPS would use for a file,
+// given its path relative to .sops.yaml. ok is false if the file falls through
+// to the default rule.
+func (c *SOPSConfig) RuleKeys(relPath string) (keys []string, ok bool) {
+	relPath = filepath.ToSlash(relPath)
+	for i := 0; i < len(c.CreationRules)-1; i++ {
+		rule := &c.CreationRules[i]
+		if rule.PathRegex == "" {
+			return nil, false
+		}
+		pattern, err := regexp.Compile(rule.PathRegex)
+		if err != nil {
+			continue
+		}
+		if pattern.MatchString(relPath) {
+			return ruleKeys(rule), true
+		}
+	}
+	return nil, false
+}
+
+// RuleKeysForFile returns RuleKeys for a file using the nearest .sops.yaml in
+// its directory or above. ok is false if there is none or the file falls
+// through to the default rule.
+func RuleKeysForFile(filePath string) (keys []string, ok bool, err error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, false, err
+	}
+	for dir := filepath.Dir(absPath); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, ".sops.yaml")); err == nil {
+			config, err := LoadSOPSConfig(dir)
+			if err != nil {
+				return nil, false, err
+			}
+			rel, err := filepath.Rel(dir, absPath)
+			if err != nil {
+				return nil, false, err
+			}
+			keys, ok := config.RuleKeys(rel)
+			return keys, ok, nil
+		}
+		if filepath.Dir(dir) == dir {
+			return nil, false, nil
+		}
+	}
+}
+
+// envRuleIndex returns the index of an environment's own creation rule, or -1
+func (c *SOPSConfig) envRuleIndex(env string) int {
+	if env == "" {
+		return -1
+	}
+	// Rules written before .yaml files were read only match .yml files
+	pathRegex := EnvRulePathRegex(env)
+	ymlOnly := strings.Replace(pathRegex, `\.ya?ml$`, `\.yml$`, 1)
+	for i := 0; i < len(c.CreationRules)-1; i++ {
+		if c.CreationRules[i].PathRegex == pathRegex || c.CreationRules[i].PathRegex == ymlOnly {
+			return i
+		}
+	}
+	return -1
+}
+
+// defaultRule returns the catch-all creation rule. It is the last rule, so
+// rules for environments with their own keys can come before it.
+func (c *SOPSConfig) defaultRule() *CreationRule {
+	if len(c.CreationRules) == 0 {
+		return nil
+	}
+	return &c.CreationRules[len(c.CreationRules)-1]
+}
+
+// keyRule returns the creation rule keys of an environment are kept in: its
+// own rule if it has one, otherwise the default rule
+func (c *SOPSConfig) keyRule(env string) *CreationRule {
+	if index := c.envRuleIndex(env); index >= 0 {
+		return &c.CreationRules[index]
+	}
+	return c.defaultRule()
+}
+
+// AllKeys returns the keys of every creation rule without duplicates
+func (c *SOPSConfig) AllKeys() []string {
+	seen := make(map[string]bool)
+	keys := []string{}
+	for i := len(c.CreationRules) - 1; i >= 0; i-- {
+		for _, key := range ruleKeys(&c.CreationRules[i]) {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+// getKeysFromConfig extracts age keys and cloud KMS keys from the default
+// creation rule of the SOPS config
+func getKeysFromConfig(config *SOPSConfig) []string {
+	return ruleKeys(config.defaultRule())
+}
+
+// ruleKeys extracts age keys and cloud KMS keys from a creation rule
+func ruleKeys(rule *CreationRule) []string {
 	keys := []string{}
+	if rule == nil {
+		return keys
+	}
 
 	// Parse comma-separated or newline-separated keys
-	for _, part := range strings.Split(ageStr, ",") {
-		for _, line := range strings.Split(part, "\n") {
-			trimmed := strings.TrimSpace(line)
-			if trimmed != "" && strings.HasPrefix(trimmed, "age1") {
-				keys = append(keys, trimmed)
+	for _, keyType := range keyTypes {
+		for _, part := range strings.Split(*rule.keyField(keyType), ",") {
+			for _, line := range strings.Split(part, "\n") {
+				trimmed := strings.TrimSpace(line)
+				if isKeyString(trimmed) && TypeOf(trimmed) == keyType {
+					keys = append(keys, trimmed)
+				}
 			}
 		}
 	}
@@ -188,6 +410,32 @@ func getKeysFromConfig(config *SOPSConfig) []string {
 	return keys
 }
 
+// setRuleKeys replaces the keys in a creation rule, splitting them between
+// the fields for each key type
+func setRuleKeys(rule *CreationRule, keys []string) {
+	if rule == nil {
+		return
+	}
+
+	byType := make(map[KeyType][]string)
+	for _, key := range keys {
+		byType[TypeOf(key)] = append(byType[TypeOf(key)], key)
+	}
+
+	for _, keyType := range keyTypes {
+		if keyType == KeyTypeAge {
+			*rule.keyField(keyType) = formatAgeKeys(byType[keyType])
+		} else {
+			*rule.keyField(keyType) = strings.Join(byType[keyType], ",")
+		}
+	}
+}
+
+// isKeyString reports whether s looks like a key rather than arbitrary text
+func isKeyString(s string) bool {
+	return strings.HasPrefix(s, "age1") || strings.HasPrefix(s, "ssh-") || (s != "" && TypeOf(s) != KeyTypeAge)
+}
+
 // formatAgeKeys formats age keys for the YAML age field
 func formatAgeKeys(keys []string) string {
 	if len(keys) == 0 {
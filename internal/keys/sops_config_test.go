@@ -0,0 +1,145 @@
+package keys
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const (
+	testDefaultAgeKey = "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"
+	testProdAgeKey    = "age1jham8xmshay2ngem8y35q7dmk3mhan84zrte9d4ms93yyc2tj4mssazms3"
+)
+
+func writeTestSOPSConfig(t *testing.T) string {
+	t.Helper()
+	rootDir := t.TempDir()
+	initial := "creation_rules:\n  - path_regex: .*\\.yml$\n    age: " + testDefaultAgeKey + "\n"
+	if err := os.WriteFile(filepath.Join(rootDir, ".sops.yaml"), []byte(initial), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return rootDir
+}
+
+func TestEnvRules(t *testing.T) {
+	rootDir := writeTestSOPSConfig(t)
+
+	config, err := LoadSOPSConfig(rootDir)
+	if err != nil {
+		t.Fatalf("LoadSOPSConfig failed: %v", err)
+	}
+	if err := config.AddEnvRule("prod", []string{testProdAgeKey}); err != nil {
+		t.Fatalf("AddEnvRule failed: %v", err)
+	}
+	if err := config.AddEnvRule("prod", []string{testProdAgeKey}); err == nil {
+		t.Error("Expected adding a second rule for prod to fail")
+	}
+	config.KeyComments[testProdAgeKey] = "Prod"
+	if err := SaveSOPSConfig(rootDir, config); err != nil {
+		t.Fatalf("SaveSOPSConfig failed: %v", err)
+	}
+
+	config, err = LoadSOPSConfig(rootDir)
+	if err != nil {
+		t.Fatalf("LoadSOPSConfig failed: %v", err)
+	}
+	if len(config.CreationRules) != 2 || config.CreationRules[0].PathRegex != EnvRulePathRegex("prod") {
+		t.Fatalf("Expected the prod rule ahead of the default rule, got %+v", config.CreationRules)
+	}
+	if !reflect.DeepEqual(config.Keys(), []string{testDefaultAgeKey}) {
+		t.Errorf("Expected the default keys to be unchanged, got %v", config.Keys())
+	}
+	if keys, ok := config.EnvKeys("prod"); !ok || !reflect.DeepEqual(keys, []string{testProdAgeKey}) {
+		t.Errorf("Expected the prod keys, got %v %v", keys, ok)
+	}
+	if _, ok := config.EnvKeys("dev"); ok {
+		t.Error("Expected dev to use the default keys")
+	}
+	if config.KeyComments[testProdAgeKey] != "Prod" {
+		t.Errorf("Expected the prod key comment to be kept, got %v", config.KeyComments)
+	}
+	if comment, ok := config.KeyComments[testDefaultAgeKey]; ok {
+		t.Errorf("Expected a key saved without a comment to have none, got %q", comment)
+	}
+
+	for path, want := range map[string]bool{
+		"prod/api.yml":                      true,
+		"target-overrides/k8s/prod/api.yml": true,
+		"dev/api.yml":                       false,
+		"base/shared.yml":                   false,
+		"production/api.yml":                false,
+		"target-overrides/prod/api.yml":     false,
+	} {
+		if _, ok := config.RuleKeys(path); ok != want {
+			t.Errorf("RuleKeys(%s): expected %v, got %v", path, want, ok)
+		}
+	}
+
+	if !config.RemoveEnvRule("prod") || config.RemoveEnvRule("prod") {
+		t.Error("Expected the prod rule to be removed once")
+	}
+	if len(config.CreationRules) != 1 {
+		t.Errorf("Expected only the default rule to be left, got %+v", config.CreationRules)
+	}
+}
+
+func TestRuleKeysForFile(t *testing.T) {
+	rootDir := writeTestSOPSConfig(t)
+	config, _ := LoadSOPSConfig(rootDir)
+	if err := config.AddEnvRule("prod", []string{testProdAgeKey}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveSOPSConfig(rootDir, config); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, ok, err := RuleKeysForFile(filepath.Join(rootDir, "prod", "api.yml"))
+	if err != nil || !ok || !reflect.DeepEqual(keys, []string{testProdAgeKey}) {
+		t.Errorf("Expected the prod keys, got %v %v %v", keys, ok, err)
+	}
+	if _, ok, err := RuleKeysForFile(filepath.Join(rootDir, "dev", "api.yml")); err != nil || ok {
+		t.Errorf("Expected dev to fall through to the default rule, got %v %v", ok, err)
+	}
+}
+
+func TestEnvRuleKeys(t *testing.T) {
+	rootDir := writeTestSOPSConfig(t)
+	config, _ := LoadSOPSConfig(rootDir)
+	if err := config.AddEnvRule("prod", []string{testProdAgeKey}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveSOPSConfig(rootDir, config); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys added for an environment with its own rule go to that rule
+	if err := addKeysToSOPSRule(rootDir, "prod", []Recipient{{Key: testSSHKey}}); err != nil {
+		t.Fatalf("addKeysToSOPSRule failed: %v", err)
+	}
+	config, _ = LoadSOPSConfig(rootDir)
+	if keys, _ := config.EnvKeys("prod"); !reflect.DeepEqual(keys, []string{testProdAgeKey, testSSHKey}) {
+		t.Errorf("Expected the key in the prod rule, got %v", keys)
+	}
+	if !reflect.DeepEqual(config.Keys(), []string{testDefaultAgeKey}) {
+		t.Errorf("Expected the default keys to be unchanged, got %v", config.Keys())
+	}
+
+	// Without an environment, a key is removed from every rule
+	if err := addKeysToSOPSRule(rootDir, "", []Recipient{{Key: testSSHKey}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveKeyFromSOPSConfig(rootDir, testSSHKey); err != nil {
+		t.Fatalf("RemoveKeyFromSOPSConfig failed: %v", err)
+	}
+	config, _ = LoadSOPSConfig(rootDir)
+	if keys, _ := config.EnvKeys("prod"); !reflect.DeepEqual(keys, []string{testProdAgeKey}) {
+		t.Errorf("Expected the key to be removed from the prod rule, got %v", keys)
+	}
+	if !reflect.DeepEqual(config.Keys(), []string{testDefaultAgeKey}) {
+		t.Errorf("Expected the key to be removed from the default rule, got %v", config.Keys())
+	}
+	if err := RemoveKeyFromSOPSConfig(rootDir, testSSHKey); err == nil {
+		t.Error("Expected removing a missing key to fail")
+	}
+}
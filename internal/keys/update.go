@@ -0,0 +1,135 @@
+package keys
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/getsops/sops/v3"
+	"github.com/getsops/sops/v3/aes"
+	"github.com/getsops/sops/v3/cmd/sops/common"
+	"github.com/getsops/sops/v3/keyservice"
+	sopsyaml "github.com/getsops/sops/v3/stores/yaml"
+)
+
+// Equal reports whether two sets of key groups hold the same keys, in any
+// order within a group, and need the same number of groups to decrypt
+func (g KeyGroups) Equal(other KeyGroups) bool {
+	if len(g.Groups) != len(other.Groups) || g.EffectiveThreshold() != other.EffectiveThreshold() {
+		return false
+	}
+	for i := range g.Groups {
+		a, b := slices.Clone(g.Groups[i]), slices.Clone(other.Groups[i])
+		slices.Sort(a)
+		slices.Sort(b)
+		if !slices.Equal(slices.Compact(a), slices.Compact(b)) {
+			return false
+		}
+	}
+	return true
+}
+
+// UpdateEncryptedData encrypts plain YAML data in place of the contents of an
+// encrypted file, keeping the file's data key, recipients and settings.
+// Values that haven't changed keep their ciphertext, so a diff of the file
+// shows only the values that did, along with the MAC and modification time.
+func UpdateEncryptedData(encrypted, fileBytes []byte, filePath string) ([]byte, error) {
+	store := sopsyaml.Store{}
+
+	// One copy of the old tree is decrypted, the other keeps the ciphertext
+	tree, err := store.LoadEncryptedFile(encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load encrypted file: %w", err)
+	}
+	old, err := store.LoadEncryptedFile(encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load encrypted file: %w", err)
+	}
+	cipher := aes.NewCipher()
+	dataKey, err := common.DecryptTree(common.DecryptTreeOpts{
+		Tree:        &tree,
+		KeyServices: []keyservice.KeyServiceClient{keyservice.NewLocalClient()},
+		Cipher:      cipher,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt file: %w", err)
+	}
+	oldPlain := tree.Branches
+
+	branches, err := store.LoadPlainFile(fileBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	newPlain, err := store.LoadPlainFile(fileBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+
+	tree.Branches = branches
+	tree.FilePath = filePath
+	if err := common.EncryptTree(common.EncryptTreeOpts{DataKey: dataKey, Tree: &tree, Cipher: cipher}); err != nil {
+		return nil, fmt.Errorf("failed to encrypt tree: %w", err)
+	}
+	for i := range tree.Branches {
+		if i < len(oldPlain) {
+			keepCiphertext(tree.Branches[i], newPlain[i], old.Branches[i], oldPlain[i])
+		}
+	}
+
+	encryptedFile, err := store.EmitEncryptedFile(tree)
+	if err != nil {
+		return nil, fmt.Errorf("failed to emit encrypted file: %w", err)
+	}
+	return encryptedFile, nil
+}
+
+// keepCiphertext puts the old ciphertext back for the values of a branch
+// whose plaintext hasn't changed. SOPS encrypts each value with its path as
+// additional data, so old ciphertext stays valid at the same path under the
+// same data key. The MAC is computed over the plaintext, so it still holds.
+func keepCiphertext(newEnc, newPlain, oldEnc, oldPlain sops.TreeBranch) {
+	oldIndex := make(map[string]int, len(oldPlain))
+	for i, item := range oldPlain {
+		if key, ok := item.Key.(string); ok {
+			oldIndex[key] = i
+		}
+	}
+	for i, item := range newPlain {
+		key, ok := item.Key.(string)
+		if !ok {
+			continue
+		}
+		if j, found := oldIndex[key]; found {
+			newEnc[i].Value = keptValue(newEnc[i].Value, item.Value, oldEnc[j].Value, oldPlain[j].Value)
+		}
+	}
+}
+
+// keptValue returns the old ciphertext of a value if its plaintext hasn't
+// changed, or the new ciphertext if it has. Maps and lists are compared
+// value by value.
+func keptValue(newEnc, newPlain, oldEnc, oldPlain interface{}) interface{} {
+	switch plain := newPlain.(type) {
+	case sops.TreeBranch:
+		if old, ok := oldPlain.(sops.TreeBranch); ok {
+			keepCiphertext(newEnc.(sops.TreeBranch), plain, oldEnc.(sops.TreeBranch), old)
+		}
+		return newEnc
+	case []interface{}:
+		if old, ok := oldPlain.([]interface{}); ok {
+			encList, oldEncList := newEnc.([]interface{}), oldEnc.([]interface{})
+			for i := range plain {
+				if i < len(old) {
+					encList[i] = keptValue(encList[i], plain[i], oldEncList[i], old[i])
+				}
+			}
+		}
+		return newEnc
+	case sops.Comment:
+		return newEnc
+	}
+	if _, ok := oldPlain.(sops.Comment); ok || !reflect.DeepEqual(newPlain, oldPlain) {
+		return newEnc
+	}
+	return oldEnc
+}
@@ -0,0 +1,65 @@
+package keys
+
+import (
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/getsops/sops/v3/decrypt"
+)
+
+func TestUpdateEncryptedData(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SOPS_AGE_KEY", identity.String())
+	recipient := identity.Recipient().String()
+
+	encrypted, err := EncryptData([]byte("A: one\nB: two\nDB:\n  host: db\n  port: 5432\nHOSTS:\n  - a\n  - b\n"), "dev/api.yml", []string{recipient})
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, err := UpdateEncryptedData(encrypted, []byte("A: one\nB: three\nDB:\n  host: db\n  port: 6543\nHOSTS:\n  - a\n  - c\nC: new\n"), "dev/api.yml")
+	if err != nil {
+		t.Fatalf("UpdateEncryptedData failed: %v", err)
+	}
+
+	// Only the changed values get new ciphertext
+	before := make(map[string]bool)
+	for _, line := range strings.Split(string(encrypted), "\n") {
+		before[line] = true
+	}
+	var changed []string
+	for _, line := range strings.Split(string(updated), "\n") {
+		// The modification time only changes with the second
+		if field := strings.Fields(line); !before[line] && field[0] != "lastmodified:" {
+			changed = append(changed, field[0])
+		}
+	}
+	if want := "B: port: - C: mac:"; strings.Join(changed, " ") != want {
+		t.Errorf("Expected only %s to change, got %v", want, changed)
+	}
+
+	decrypted, err := decrypt.Data(updated, "yaml")
+	if err != nil {
+		t.Fatalf("Failed to decrypt the updated file: %v", err)
+	}
+	if got := string(decrypted); !strings.Contains(got, "B: three") || !strings.Contains(got, "port: 6543") || !strings.Contains(got, "- c") || !strings.Contains(got, "C: new") {
+		t.Errorf("Unexpected decrypted contents:\n%s", got)
+	}
+}
+
+func TestKeyGroupsEqual(t *testing.T) {
+	a := SingleGroup([]string{"age1first", "age1second"})
+	if !a.Equal(SingleGroup([]string{"age1second", "age1first"})) {
+		t.Error("Expected key order not to matter")
+	}
+	if a.Equal(SingleGroup([]string{"age1first"})) {
+		t.Error("Expected a missing key to differ")
+	}
+	shamir := KeyGroups{Groups: [][]string{{"age1first"}, {"age1second"}}}
+	if a.Equal(shamir) || !shamir.Equal(KeyGroups{Groups: [][]string{{"age1first"}, {"age1second"}}, Threshold: 2}) {
+		t.Error("Expected groups to be compared by their effective threshold")
+	}
+}
@@ -0,0 +1,122 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"maps"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// managedByLabel marks Secrets created by puff
+const managedByLabel = "app.kubernetes.io/managed-by"
+
+// ClientOptions selects the cluster and namespace to connect to
+type ClientOptions struct {
+	Kubeconfig string // Path to the kubeconfig file (defaults to $KUBECONFIG or ~/.kube/config)
+	Context    string // Kubeconfig context (defaults to the current context)
+	Namespace  string // Namespace (defaults to the context's namespace)
+}
+
+// NewClient creates a Kubernetes client from kubeconfig and returns it along
+// with the namespace to use
+func NewClient(opts ClientOptions) (kubernetes.Interface, string, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if opts.Kubeconfig != "" {
+		loadingRules.ExplicitPath = opts.Kubeconfig
+	}
+
+	overrides := &clientcmd.ConfigOverrides{
+		CurrentContext: opts.Context,
+	}
+	overrides.Context.Namespace = opts.Namespace
+
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides)
+
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to determine namespace: %w", err)
+	}
+
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+
+	return client, namespace, nil
+}
+
+// GetSecretData returns the decoded data of a Secret. The returned bool is
+// false if the Secret does not exist.
+func GetSecretData(ctx context.Context, client kubernetes.Interface, namespace, name string) (map[string]string, bool, error) {
+	secret, err := client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get secret %s/%s: %w", namespace, name, err)
+	}
+
+	data := make(map[string]string, len(secret.Data)+len(secret.StringData))
+	for key, value := range secret.Data {
+		data[key] = string(value)
+	}
+	maps.Copy(data, secret.StringData)
+
+	return data, true, nil
+}
+
+// ApplySecret creates the Secret with the given data, or updates it if it
+// already exists. Keys in the existing Secret that are not in data are kept
+// unless prune is set.
+func ApplySecret(ctx context.Context, client kubernetes.Interface, namespace, name string, data map[string]string, prune bool) error {
+	secrets := client.CoreV1().Secrets(namespace)
+
+	secret, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels:    map[string]string{managedByLabel: "puff"},
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: secretData(data),
+		}
+		if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create secret %s/%s: %w", namespace, name, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get secret %s/%s: %w", namespace, name, err)
+	}
+
+	if prune || secret.Data == nil {
+		secret.Data = make(map[string][]byte, len(data))
+	}
+	maps.Copy(secret.Data, secretData(data))
+
+	if _, err := secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update secret %s/%s: %w", namespace, name, err)
+	}
+	return nil
+}
+
+// secretData converts string values to Secret data
+func secretData(values map[string]string) map[string][]byte {
+	data := make(map[string][]byte, len(values))
+	for key, value := range values {
+		data[key] = []byte(value)
+	}
+	return data
+}
@@ -0,0 +1,69 @@
+package kube
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestApplySecret(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewClientset()
+
+	// Creates the secret when it does not exist
+	if err := ApplySecret(ctx, client, "prod", "api", map[string]string{"A": "1", "B": "2"}, false); err != nil {
+		t.Fatalf("ApplySecret failed: %v", err)
+	}
+
+	secret, err := client.CoreV1().Secrets("prod").Get(ctx, "api", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Secret was not created: %v", err)
+	}
+	if secret.Labels[managedByLabel] != "puff" {
+		t.Errorf("Expected managed-by label, got %v", secret.Labels)
+	}
+
+	// Keeps keys missing from the source unless pruning
+	if err := ApplySecret(ctx, client, "prod", "api", map[string]string{"A": "changed"}, false); err != nil {
+		t.Fatalf("ApplySecret failed: %v", err)
+	}
+	data, found, err := GetSecretData(ctx, client, "prod", "api")
+	if err != nil || !found {
+		t.Fatalf("GetSecretData failed: %v (found: %v)", err, found)
+	}
+	if expected := map[string]string{"A": "changed", "B": "2"}; !reflect.DeepEqual(data, expected) {
+		t.Errorf("Expected %v, got %v", expected, data)
+	}
+
+	if err := ApplySecret(ctx, client, "prod", "api", map[string]string{"A": "changed"}, true); err != nil {
+		t.Fatalf("ApplySecret failed: %v", err)
+	}
+	data, _, _ = GetSecretData(ctx, client, "prod", "api")
+	if expected := map[string]string{"A": "changed"}; !reflect.DeepEqual(data, expected) {
+		t.Errorf("Expected pruned data %v, got %v", expected, data)
+	}
+}
+
+func TestGetSecretData(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "prod"},
+		Data:       map[string][]byte{"KEY": []byte("value")},
+	})
+
+	data, found, err := GetSecretData(ctx, client, "prod", "api")
+	if err != nil || !found {
+		t.Fatalf("GetSecretData failed: %v (found: %v)", err, found)
+	}
+	if data["KEY"] != "value" {
+		t.Errorf("Expected decoded value, got %v", data)
+	}
+
+	if _, found, err := GetSecretData(ctx, client, "dev", "api"); err != nil || found {
+		t.Errorf("Expected missing secret to be reported as not found, got found=%v err=%v", found, err)
+	}
+}
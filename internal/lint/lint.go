@@ -0,0 +1,313 @@
+// Package lint checks config files for problems that don't stop them from
+// loading, such as badly named keys and values that are never used
+package lint
+
+import (
+	"fmt"
+	"maps"
+	"path"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/templating"
+)
+
+// Rule names, as used in .puff.yaml
+const (
+	RuleKeyNaming      = "key_naming"
+	RuleDuplicateValue = "duplicate_value"
+	RuleUnusedInternal = "unused_internal"
+	RuleShadowedKey    = "shadowed_key"
+	RuleEmptyFile      = "empty_file"
+)
+
+// DefaultKeyPattern matches UPPER_SNAKE_CASE keys, with a leading _ for
+// internal variables
+const DefaultKeyPattern = `^_?[A-Z][A-Z0-9_]*$`
+
+// puffPrefix starts the internal variables puff writes itself, such as the
+// _PUFF_INITIALIZED marker written by 'puff init', which are never referenced
+const puffPrefix = "_PUFF_"
+
+// defaultSeverities holds every rule and its severity unless .puff.yaml
+// sets another
+var defaultSeverities = map[string]string{
+	RuleKeyNaming:      config.LintError,
+	RuleDuplicateValue: config.LintWarning,
+	RuleUnusedInternal: config.LintWarning,
+	RuleShadowedKey:    config.LintWarning,
+	RuleEmptyFile:      config.LintWarning,
+}
+
+// File is a config file and its decrypted values
+type File struct {
+	// Path is relative to the config root, with forward slashes
+	Path   string
+	Values map[string]interface{}
+	// Shared is the shared file of the file's level, such as dev/shared.yml
+	// for dev/api.yml. If empty, it is the shared.yml in the file's directory.
+	Shared string
+}
+
+// Finding is a problem found by a rule
+type Finding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	File     string `json:"file"`
+	Key      string `json:"key,omitempty"`
+	Message  string `json:"message"`
+}
+
+// Run checks the files and returns the findings of every enabled rule,
+// ordered by file and key. chains holds the files that make up each config
+// context, in precedence order; they are used to find keys that are always
+// overridden.
+func Run(files []File, chains [][]string, settings config.LintSettings) ([]Finding, error) {
+	severities := maps.Clone(defaultSeverities)
+	for rule, severity := range settings.Rules {
+		if _, ok := defaultSeverities[rule]; !ok {
+			return nil, fmt.Errorf("unknown lint rule %q in %s (available: %s)", rule, config.ProjectFile, strings.Join(Rules(), ", "))
+		}
+		severities[rule] = severity
+	}
+
+	keyPattern := DefaultKeyPattern
+	if settings.KeyPattern != "" {
+		keyPattern = settings.KeyPattern
+	}
+	keyRegex, err := regexp.Compile(keyPattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key_pattern in %s: %w", config.ProjectFile, err)
+	}
+
+	checks := map[string]func() []Finding{
+		RuleKeyNaming:      func() []Finding { return checkKeyNaming(files, keyRegex) },
+		RuleDuplicateValue: func() []Finding { return checkDuplicateValues(files) },
+		RuleUnusedInternal: func() []Finding { return checkUnusedInternal(files) },
+		RuleShadowedKey:    func() []Finding { return checkShadowedKeys(files, chains) },
+		RuleEmptyFile:      func() []Finding { return checkEmptyFiles(files) },
+	}
+
+	findings := []Finding{}
+	for _, rule := range Rules() {
+		if severities[rule] == config.LintOff {
+			continue
+		}
+		for _, finding := range checks[rule]() {
+			finding.Rule = rule
+			finding.Severity = severities[rule]
+			findings = append(findings, finding)
+		}
+	}
+
+	sortFindings(findings)
+	return findings, nil
+}
+
+// Removable returns the keys that can be removed without changing any
+// resolved config, ordered by file and key: keys that are always overridden,
+// and internal variables that are never referenced. Removing them can leave
+// more internal variables unreferenced, so check again after removing keys.
+func Removable(files []File, chains [][]string) []Finding {
+	var findings []Finding
+	for _, finding := range checkShadowedKeys(files, chains) {
+		finding.Rule = RuleShadowedKey
+		findings = append(findings, finding)
+	}
+	for _, finding := range checkUnusedInternal(files) {
+		finding.Rule = RuleUnusedInternal
+		findings = append(findings, finding)
+	}
+	sortFindings(findings)
+	return findings
+}
+
+// Rules returns the names of every rule, sorted
+func Rules() []string {
+	return slices.Sorted(maps.Keys(defaultSeverities))
+}
+
+// checkKeyNaming reports keys that don't match the key pattern
+func checkKeyNaming(files []File, keyRegex *regexp.Regexp) []Finding {
+	var findings []Finding
+	for _, file := range files {
+		for _, key := range slices.Sorted(maps.Keys(file.Values)) {
+			if !keyRegex.MatchString(key) {
+				findings = append(findings, Finding{File: file.Path, Key: key,
+					Message: fmt.Sprintf("%s does not match %s", key, keyRegex)})
+			}
+		}
+	}
+	return findings
+}
+
+// checkDuplicateValues reports keys given the same value by several app
+// files of one level, which could be set once in the level's shared file
+// instead
+func checkDuplicateValues(files []File) []Finding {
+	levels := make(map[string][]File)
+	var levelOrder []string
+	for _, file := range files {
+		shared := file.Shared
+		if shared == "" {
+			shared = path.Join(path.Dir(file.Path), "shared.yml")
+		}
+		if file.Path == shared {
+			continue
+		}
+		if _, ok := levels[shared]; !ok {
+			levelOrder = append(levelOrder, shared)
+		}
+		levels[shared] = append(levels[shared], file)
+	}
+
+	var findings []Finding
+	for _, shared := range levelOrder {
+		siblings := levels[shared]
+		reported := make(map[string]bool)
+		for i, file := range siblings {
+			for _, key := range slices.Sorted(maps.Keys(file.Values)) {
+				value := file.Values[key]
+				if value == nil || value == "" || reported[key+"\x00"+file.Path] {
+					continue
+				}
+				names := []string{siblingName(file.Path, shared)}
+				for _, other := range siblings[i+1:] {
+					if otherValue, ok := other.Values[key]; ok && reflect.DeepEqual(value, otherValue) {
+						names = append(names, siblingName(other.Path, shared))
+						reported[key+"\x00"+other.Path] = true
+					}
+				}
+				if len(names) > 1 {
+					findings = append(findings, Finding{File: file.Path, Key: key,
+						Message: fmt.Sprintf("%s has the same value in %s; set it once in %s", key, strings.Join(names, ", "), shared)})
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// siblingName names a file in a finding about its level: by its base name if
+// it is in the same directory as the level's shared file, as in the standard
+// layout, or by its path otherwise
+func siblingName(file, shared string) string {
+	if path.Dir(file) == path.Dir(shared) {
+		return path.Base(file)
+	}
+	return file
+}
+
+// checkUnusedInternal reports internal (_-prefixed) variables that no
+// template references
+func checkUnusedInternal(files []File) []Finding {
+	referenced := make(map[string]bool)
+	for _, file := range files {
+		for _, value := range file.Values {
+			forEachString(value, func(s string) {
+				for _, name := range templating.References(s) {
+					referenced[name] = true
+				}
+			})
+		}
+	}
+
+	var findings []Finding
+	for _, file := range files {
+		for _, key := range slices.Sorted(maps.Keys(file.Values)) {
+			if strings.HasPrefix(key, "_") && !strings.HasPrefix(key, puffPrefix) && !referenced[key] {
+				findings = append(findings, Finding{File: file.Path, Key: key,
+					Message: fmt.Sprintf("internal variable %s is never referenced", key)})
+			}
+		}
+	}
+	return findings
+}
+
+// checkShadowedKeys reports keys whose value never takes effect, because a
+// later file overrides them in every context the file is part of. Nested
+// maps are merged rather than overridden, so they aren't reported.
+func checkShadowedKeys(files []File, chains [][]string) []Finding {
+	values := make(map[string]map[string]interface{})
+	for _, file := range files {
+		values[file.Path] = file.Values
+	}
+
+	var findings []Finding
+	for _, file := range files {
+		for _, key := range slices.Sorted(maps.Keys(file.Values)) {
+			if _, isMap := file.Values[key].(map[string]interface{}); isMap {
+				continue
+			}
+
+			used := false
+			overriders := make(map[string]bool)
+			for _, chain := range chains {
+				position := slices.Index(chain, file.Path)
+				if position < 0 {
+					continue
+				}
+				overrider := ""
+				for _, later := range chain[position+1:] {
+					if _, ok := values[later][key]; ok {
+						overrider = later
+					}
+				}
+				if overrider == "" {
+					used = true
+					break
+				}
+				overriders[overrider] = true
+			}
+
+			if !used && len(overriders) > 0 {
+				findings = append(findings, Finding{File: file.Path, Key: key,
+					Message: fmt.Sprintf("%s is always overridden, by %s", key, strings.Join(slices.Sorted(maps.Keys(overriders)), ", "))})
+			}
+		}
+	}
+	return findings
+}
+
+// checkEmptyFiles reports files without any keys
+func checkEmptyFiles(files []File) []Finding {
+	var findings []Finding
+	for _, file := range files {
+		if len(file.Values) == 0 {
+			findings = append(findings, Finding{File: file.Path, Message: "file has no keys"})
+		}
+	}
+	return findings
+}
+
+// sortFindings orders findings by file and key, keeping the order of
+// findings for the same key
+func sortFindings(findings []Finding) {
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		return findings[i].Key < findings[j].Key
+	})
+}
+
+// forEachString calls fn with every string in a value, including those
+// nested in maps and lists
+func forEachString(value interface{}, fn func(string)) {
+	switch v := value.(type) {
+	case string:
+		fn(v)
+	case map[string]interface{}:
+		for _, nested := range v {
+			forEachString(nested, fn)
+		}
+	case []interface{}:
+		for _, nested := range v {
+			forEachString(nested, fn)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package lint
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/teamcurri/puff/internal/config"
+)
+
+func TestRun(t *testing.T) {
+	files := []File{
+		{Path: "base/shared.yml", Values: map[string]interface{}{"LOG_LEVEL": "info", "_DOMAIN": "example.com", "_UNUSED": "x", "_PUFF_INITIALIZED": "true"}},
+		{Path: "base/api.yml", Values: map[string]interface{}{"URL": "https://api.${_DOMAIN}", "PORT": 8080, "db": map[string]interface{}{"host": "db"}}},
+		{Path: "dev/api.yml", Values: map[string]interface{}{"LOG_LEVEL": "debug", "DB_HOST": "dev-db", "PORT": 9090}},
+		{Path: "dev/worker.yml", Values: map[string]interface{}{"LOG_LEVEL": "debug", "DB_HOST": "dev-db"}},
+		{Path: "dev/empty.yml", Values: map[string]interface{}{}},
+		{Path: "prod/api.yml", Values: map[string]interface{}{"PORT": 80, "DB_HOST": "prod-db"}},
+	}
+	// base/api.yml's PORT is overridden in both environments, while
+	// base/shared.yml's LOG_LEVEL is used in prod
+	chains := [][]string{
+		{"base/shared.yml", "base/api.yml", "dev/api.yml"},
+		{"base/shared.yml", "dev/worker.yml"},
+		{"base/shared.yml", "dev/empty.yml"},
+		{"base/shared.yml", "base/api.yml", "prod/api.yml"},
+	}
+
+	findings, err := Run(files, chains, config.LintSettings{})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	var got []string
+	for _, finding := range findings {
+		got = append(got, finding.Severity+" "+finding.Rule+" "+finding.File+" "+finding.Key)
+	}
+	expected := []string{
+		"warning shadowed_key base/api.yml PORT",
+		"error key_naming base/api.yml db",
+		"warning unused_internal base/shared.yml _UNUSED",
+		"warning duplicate_value dev/api.yml DB_HOST",
+		"warning duplicate_value dev/api.yml LOG_LEVEL",
+		"warning empty_file dev/empty.yml ",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected findings:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+	for _, finding := range findings {
+		if finding.Rule == RuleDuplicateValue && !strings.Contains(finding.Message, "api.yml, worker.yml; set it once in dev/shared.yml") {
+			t.Errorf("Unexpected message: %s", finding.Message)
+		}
+	}
+
+	// Rules can be turned off or made errors, and the key pattern replaced
+	findings, err = Run(files, chains, config.LintSettings{
+		Rules: map[string]string{
+			RuleDuplicateValue: config.LintOff, RuleShadowedKey: config.LintOff,
+			RuleUnusedInternal: config.LintOff, RuleEmptyFile: config.LintError,
+		},
+		KeyPattern: `^[A-Za-z_]+$`,
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(findings) != 1 || findings[0].Rule != RuleEmptyFile || findings[0].Severity != config.LintError {
+		t.Errorf("Expected only an empty file error, got %+v", findings)
+	}
+
+	if _, err := Run(files, chains, config.LintSettings{Rules: map[string]string{"tabs": config.LintError}}); err == nil || !strings.Contains(err.Error(), "unknown lint rule") {
+		t.Errorf("Expected an unknown rule error, got %v", err)
+	}
+}
+
+func TestRemovable(t *testing.T) {
+	files := []File{
+		{Path: "base/shared.yml", Values: map[string]interface{}{"_HOST": "db", "_PORT": "5432", "_PUFF_INITIALIZED": "true"}},
+		{Path: "base/api.yml", Values: map[string]interface{}{"DB_URL": "${_HOST}:${_PORT}", "NAME": "api"}},
+		{Path: "dev/api.yml", Values: map[string]interface{}{"DB_URL": "localhost:${_PORT}"}},
+	}
+	chains := [][]string{{"base/shared.yml", "base/api.yml", "dev/api.yml"}}
+
+	var got []string
+	for _, finding := range Removable(files, chains) {
+		got = append(got, finding.Rule+" "+finding.File+" "+finding.Key)
+	}
+	// _HOST is still referenced by the overridden DB_URL, until that is removed
+	expected := []string{"shadowed_key base/api.yml DB_URL"}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	delete(files[1].Values, "DB_URL")
+	got = nil
+	for _, finding := range Removable(files, chains) {
+		got = append(got, finding.Rule+" "+finding.File+" "+finding.Key)
+	}
+	expected = []string{"unused_internal base/shared.yml _HOST"}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,79 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+)
+
+// ecsEnvironmentEntry is an entry in an ECS container definition's environment array
+type ecsEnvironmentEntry struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// ecsSecretEntry is an entry in an ECS container definition's secrets array
+type ecsSecretEntry struct {
+	Name      string `json:"name"`
+	ValueFrom string `json:"valueFrom"`
+}
+
+// ecsContainerEnv is the environment/secrets fragment of an ECS container definition
+type ecsContainerEnv struct {
+	Environment []ecsEnvironmentEntry `json:"environment"`
+	Secrets     []ecsSecretEntry      `json:"secrets,omitempty"`
+}
+
+// formatECS formats values as the environment and secrets arrays of an ECS
+// container definition. Keys matching opts.SensitiveKeys are emitted as
+// secrets referencing SSM parameters under opts.SSMArnPrefix instead of
+// plain environment values.
+func formatECS(values map[string]interface{}, opts FormatOptions) (string, error) {
+	if len(opts.SensitiveKeys) > 0 && opts.SSMArnPrefix == "" {
+		return "", fmt.Errorf("ssm-arn-prefix is required when sensitive keys are set for ecs format")
+	}
+
+	result := ecsContainerEnv{
+		Environment: []ecsEnvironmentEntry{},
+	}
+
+	for _, key := range sortedKeys(values) {
+		sensitive, err := matchesAny(key, opts.SensitiveKeys)
+		if err != nil {
+			return "", err
+		}
+
+		if sensitive {
+			result.Secrets = append(result.Secrets, ecsSecretEntry{
+				Name:      key,
+				ValueFrom: opts.SSMArnPrefix + key,
+			})
+		} else {
+			result.Environment = append(result.Environment, ecsEnvironmentEntry{
+				Name:  key,
+				Value: stringValue(values[key]),
+			})
+		}
+	}
+
+	jsonBytes, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal ECS container environment: %w", err)
+	}
+
+	return string(jsonBytes), nil
+}
+
+// matchesAny reports whether key matches any of the given glob patterns
+func matchesAny(key string, patterns []string) (bool, error) {
+	for _, pattern := range patterns {
+		matched, err := path.Match(pattern, key)
+		if err != nil {
+			return false, fmt.Errorf("invalid key pattern %q: %w", pattern, err)
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
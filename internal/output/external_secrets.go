@@ -0,0 +1,118 @@
+package output
+
+import (
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	externalSecretAPIVersion = "external-secrets.io/v1beta1"
+	pushSecretAPIVersion     = "external-secrets.io/v1alpha1"
+	defaultSecretStoreKind   = "SecretStore"
+)
+
+// formatExternalSecret formats values as an External Secrets Operator
+// ExternalSecret that pulls each key from the configured SecretStore into a
+// Kubernetes Secret. Only key names are emitted - values live in the store.
+func formatExternalSecret(values map[string]interface{}, opts FormatOptions) (string, error) {
+	data := make([]interface{}, 0, len(values))
+	for _, key := range sortedKeys(values) {
+		data = append(data, map[string]interface{}{
+			"secretKey": key,
+			"remoteRef": map[string]interface{}{
+				"key": opts.RemoteKeyPrefix + key,
+			},
+		})
+	}
+
+	externalSecret := map[string]interface{}{
+		"apiVersion": externalSecretAPIVersion,
+		"kind":       "ExternalSecret",
+		"metadata":   manifestMetadata(opts.SecretName, opts),
+		"spec": map[string]interface{}{
+			"refreshInterval": "1h",
+			"secretStoreRef":  secretStoreRef(opts),
+			"target": map[string]interface{}{
+				"name":           opts.SecretName,
+				"creationPolicy": "Owner",
+			},
+			"data": data,
+		},
+	}
+
+	yamlBytes, err := yaml.Marshal(externalSecret)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal ExternalSecret: %w", err)
+	}
+
+	return string(yamlBytes), nil
+}
+
+// formatPushSecret formats values as a Kubernetes Secret followed by an
+// External Secrets Operator PushSecret that pushes every key of that Secret
+// to the configured SecretStore.
+func formatPushSecret(values map[string]interface{}, opts FormatOptions) (string, error) {
+	secret, err := formatK8s(values, opts)
+	if err != nil {
+		return "", err
+	}
+
+	data := make([]interface{}, 0, len(values))
+	for _, key := range sortedKeys(values) {
+		data = append(data, map[string]interface{}{
+			"match": map[string]interface{}{
+				"secretKey": key,
+				"remoteRef": map[string]interface{}{
+					"remoteKey": opts.RemoteKeyPrefix + key,
+				},
+			},
+		})
+	}
+
+	pushSecret := map[string]interface{}{
+		"apiVersion": pushSecretAPIVersion,
+		"kind":       "PushSecret",
+		"metadata":   manifestMetadata(opts.SecretName, opts),
+		"spec": map[string]interface{}{
+			"refreshInterval": "1h",
+			"secretStoreRefs": []interface{}{secretStoreRef(opts)},
+			"selector": map[string]interface{}{
+				"secret": map[string]interface{}{
+					"name": opts.SecretName,
+				},
+			},
+			"data": data,
+		},
+	}
+
+	yamlBytes, err := yaml.Marshal(pushSecret)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal PushSecret: %w", err)
+	}
+
+	return secret + "---\n" + string(yamlBytes), nil
+}
+
+// secretStoreRef builds the reference to the configured SecretStore
+func secretStoreRef(opts FormatOptions) map[string]interface{} {
+	kind := opts.SecretStoreKind
+	if kind == "" {
+		kind = defaultSecretStoreKind
+	}
+	return map[string]interface{}{
+		"name": opts.SecretStore,
+		"kind": kind,
+	}
+}
+
+// sortedKeys returns the keys of values in sorted order
+func sortedKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
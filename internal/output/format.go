@@ -18,6 +18,20 @@ const (
 	FormatJSON Format = "json"
 	FormatYAML Format = "yaml"
 	FormatK8s  Format = "k8s"
+
+	FormatExternalSecret Format = "external-secret"
+	FormatPushSecret     Format = "push-secret"
+
+	FormatTfvars     Format = "tfvars"
+	FormatTfvarsJSON Format = "tfvars-json"
+
+	FormatECS Format = "ecs"
+
+	FormatNomad Format = "nomad"
+
+	FormatTemplate Format = "template"
+
+	FormatGitHubEnv Format = "github-env"
 )
 
 // FormatOptions holds options for output formatting
@@ -25,30 +39,131 @@ type FormatOptions struct {
 	Format     Format
 	SecretName string // For k8s format
 	Base64     bool   // For k8s format
+
+	// For k8s format: keys holding base64-encoded binary values, which go
+	// into the Secret's data as they are
+	BinaryKeys []string
+
+	// For k8s format: the secret type, Opaque by default, and the keys that
+	// typed secrets are built from
+	SecretType string
+	TypeKeys   SecretTypeKeys
+
+	// For Kubernetes manifest formats (k8s, external-secret, push-secret):
+	// metadata added to each manifest
+	Namespace   string
+	Labels      map[string]string
+	Annotations map[string]string
+	// Checksum annotates Secrets with the checksum of their data (k8s and
+	// push-secret formats)
+	Checksum bool
+
+	// For json and yaml formats: split keys on this delimiter into nested objects
+	NestDelimiter string
+
+	// For env and yaml formats: the file each key came from, written as a
+	// comment above the key
+	Sources map[string]string
+
+	// For env format: a comment written above each key, such as its
+	// description. Comments spanning several lines are written as several
+	// comment lines.
+	Comments map[string]string
+
+	// For external-secret and push-secret formats
+	SecretStore     string // Name of the SecretStore to reference
+	SecretStoreKind string // SecretStore or ClusterSecretStore (defaults to SecretStore)
+	RemoteKeyPrefix string // Prefix for keys in the external store
+
+	// For ecs format
+	SensitiveKeys []string // Key names or glob patterns emitted as secrets
+	SSMArnPrefix  string   // SSM parameter ARN prefix for sensitive keys
+
+	// For nomad format: a Variables spec for the variable at NomadPath, or
+	// a template block writing the values to NomadDestination. Namespace is
+	// also used for the Variables spec.
+	NomadKind        string
+	NomadPath        string
+	NomadDestination string
+
+	// For template format
+	Template string // Go template text to render values with
+
+	// For plugin formats
+	PluginEnv []string // Extra KEY=VALUE environment variables for the plugin
+
+	// Stamp, if set, is written as a comment header for the formats that
+	// CanStamp, and as annotations in Kubernetes manifests
+	Stamp *Stamp
 }
 
 // FormatOutput formats the given config values according to the specified format
 func FormatOutput(values map[string]interface{}, opts FormatOptions) (string, error) {
+	formatted, err := formatOutput(values, opts)
+	if err != nil || opts.Stamp == nil || !CanStamp(opts.Format) {
+		return formatted, err
+	}
+	return opts.Stamp.header() + formatted, nil
+}
+
+// formatOutput formats values without the stamp's header
+func formatOutput(values map[string]interface{}, opts FormatOptions) (string, error) {
 	switch opts.Format {
 	case FormatEnv:
-		return formatEnv(values), nil
-	case FormatJSON:
-		return formatJSON(values)
-	case FormatYAML:
-		return formatYAML(values)
+		return formatEnv(values, opts.Sources, opts.Comments), nil
+	case FormatJSON, FormatYAML:
+		if opts.NestDelimiter != "" {
+			nested, err := Unflatten(values, opts.NestDelimiter)
+			if err != nil {
+				return "", err
+			}
+			values = nested
+		}
+		if opts.Format == FormatJSON {
+			return formatJSON(values)
+		}
+		return formatYAML(values, opts.Sources)
 	case FormatK8s:
 		if opts.SecretName == "" {
 			return "", fmt.Errorf("secret-name is required for k8s format")
 		}
-		return formatK8s(values, opts.SecretName, opts.Base64)
+		return formatK8s(values, opts)
+	case FormatExternalSecret:
+		if opts.SecretName == "" || opts.SecretStore == "" {
+			return "", fmt.Errorf("secret-name and secret-store are required for external-secret format")
+		}
+		return formatExternalSecret(values, opts)
+	case FormatPushSecret:
+		if opts.SecretName == "" || opts.SecretStore == "" {
+			return "", fmt.Errorf("secret-name and secret-store are required for push-secret format")
+		}
+		return formatPushSecret(values, opts)
+	case FormatTfvars:
+		return formatTfvars(values)
+	case FormatTfvarsJSON:
+		return formatTfvarsJSON(values)
+	case FormatECS:
+		return formatECS(values, opts)
+	case FormatNomad:
+		return formatNomad(values, opts)
+	case FormatGitHubEnv:
+		return formatGitHubEnv(values)
+	case FormatTemplate:
+		if opts.Template == "" {
+			return "", fmt.Errorf("template is required for template format")
+		}
+		return formatTemplate(values, opts.Template)
 	default:
+		if name, ok := pluginName(opts.Format); ok {
+			return formatPlugin(values, name, opts)
+		}
 		return "", fmt.Errorf("unknown format: %s", opts.Format)
 	}
 }
 
 // formatEnv formats values as a .env file
 // Nested values are converted to JSON
-func formatEnv(values map[string]interface{}) string {
+func formatEnv(values map[string]interface{}, sources, comments map[string]string) string {
 	var lines []string
 
 	// Sort keys for consistent output
@@ -62,33 +177,54 @@ func formatEnv(values map[string]interface{}) string {
 		value := values[key]
 
 		// Convert value to string
-		var valueStr string
-		switch v := value.(type) {
-		case string:
-			valueStr = v
-		case map[string]interface{}, []interface{}:
-			// Nested structures: convert to JSON
-			jsonBytes, err := json.Marshal(v)
-			if err != nil {
-				valueStr = fmt.Sprintf("%v", v)
-			} else {
-				valueStr = string(jsonBytes)
-			}
-		default:
-			valueStr = fmt.Sprintf("%v", v)
-		}
+		valueStr := stringValue(value)
 
 		// Quote value if it contains special characters or spaces
 		if needsQuoting(valueStr) {
 			valueStr = quoteValue(valueStr)
 		}
 
+		if comment, ok := comments[key]; ok {
+			for _, line := range strings.Split(strings.TrimRight(comment, "\n"), "\n") {
+				lines = append(lines, strings.TrimRight("# "+line, " "))
+			}
+		}
+		if source, ok := sources[key]; ok {
+			lines = append(lines, sourceComment(source))
+		}
 		lines = append(lines, fmt.Sprintf("%s=%s", key, valueStr))
 	}
 
 	return strings.Join(lines, "\n")
 }
 
+// stringValue converts a config value to a string.
+// Nested structures are converted to JSON.
+func stringValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		jsonBytes, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(jsonBytes)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// StringValues converts config values to strings the way they are rendered
+// in env files and Kubernetes secrets
+func StringValues(values map[string]interface{}) map[string]string {
+	result := make(map[string]string, len(values))
+	for key, value := range values {
+		result[key] = stringValue(value)
+	}
+	return result
+}
+
 // needsQuoting determines if a value needs to be quoted in .env format
 func needsQuoting(value string) bool {
 	// Quote if contains spaces, quotes, or special characters
@@ -112,69 +248,78 @@ func formatJSON(values map[string]interface{}) (string, error) {
 	return string(jsonBytes), nil
 }
 
-// formatYAML formats values as YAML
-func formatYAML(values map[string]interface{}) (string, error) {
-	yamlBytes, err := yaml.Marshal(values)
+// formatYAML formats values as YAML, with a comment above each key that
+// has a source
+func formatYAML(values map[string]interface{}, sources map[string]string) (string, error) {
+	var doc yaml.Node
+	if err := doc.Encode(values); err != nil {
+		return "", fmt.Errorf("failed to marshal YAML: %w", err)
+	}
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if source, ok := sources[doc.Content[i].Value]; ok {
+			doc.Content[i].HeadComment = sourceComment(source)
+		}
+	}
+
+	yamlBytes, err := yaml.Marshal(&doc)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal YAML: %w", err)
 	}
 	return string(yamlBytes), nil
 }
 
-// formatK8s formats values as a Kubernetes secret
-func formatK8s(values map[string]interface{}, secretName string, encodeBase64 bool) (string, error) {
-	// Build the secret data
-	data := make(map[string]interface{})
+// sourceComment is the comment naming the file a key came from
+func sourceComment(source string) string {
+	return "# source: " + source
+}
 
-	// Sort keys for consistent output
-	keys := make([]string, 0, len(values))
-	for k := range values {
-		keys = append(keys, k)
+// formatK8s formats values as a Kubernetes secret of the type in opts,
+// annotated with the stamp if there is one. Values go into stringData, or
+// base64-encoded into data with opts.Base64. Binary values are already
+// base64-encoded, so they always go into data as they are.
+func formatK8s(values map[string]interface{}, opts FormatOptions) (string, error) {
+	entries, binary, err := k8sSecretEntries(values, opts)
+	if err != nil {
+		return "", err
 	}
-	sort.Strings(keys)
 
-	for _, key := range keys {
-		value := values[key]
-
-		// Convert value to string
-		var valueStr string
-		switch v := value.(type) {
-		case string:
-			valueStr = v
-		case map[string]interface{}, []interface{}:
-			// Nested structures: convert to JSON
-			jsonBytes, err := json.Marshal(v)
-			if err != nil {
-				valueStr = fmt.Sprintf("%v", v)
-			} else {
-				valueStr = string(jsonBytes)
+	data := make(map[string]interface{})
+	stringData := make(map[string]interface{})
+	for key, valueStr := range entries {
+		switch {
+		case binary[key]:
+			if _, err := base64.StdEncoding.DecodeString(valueStr); err != nil {
+				return "", fmt.Errorf("%s is marked binary but isn't valid base64: %w", key, err)
 			}
+			data[key] = valueStr
+		case opts.Base64:
+			data[key] = base64.StdEncoding.EncodeToString([]byte(valueStr))
 		default:
-			valueStr = fmt.Sprintf("%v", v)
-		}
-
-		// Base64 encode if requested
-		if encodeBase64 {
-			valueStr = base64.StdEncoding.EncodeToString([]byte(valueStr))
+			stringData[key] = valueStr
 		}
+	}
 
-		data[key] = valueStr
+	secretType := opts.SecretType
+	if secretType == "" {
+		secretType = SecretTypeOpaque
+	}
+	metadata := manifestMetadata(opts.SecretName, opts)
+	if opts.Checksum {
+		annotate(metadata, ChecksumAnnotation, dataChecksum(entries))
 	}
 
 	// Build the Kubernetes secret structure
 	secret := map[string]interface{}{
 		"apiVersion": "v1",
 		"kind":       "Secret",
-		"type":       "Opaque",
-		"metadata": map[string]interface{}{
-			"name": secretName,
-		},
+		"type":       secretType,
+		"metadata":   metadata,
 	}
-
-	if encodeBase64 {
+	if len(data) > 0 || opts.Base64 {
 		secret["data"] = data
-	} else {
-		secret["stringData"] = data
+	}
+	if len(stringData) > 0 || !opts.Base64 && len(data) == 0 {
+		secret["stringData"] = stringData
 	}
 
 	// Marshal to YAML
@@ -0,0 +1,82 @@
+package output
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// formatGitHubEnv formats values for appending to $GITHUB_ENV in GitHub
+// Actions. Multi-line values use the heredoc syntax with a random delimiter
+// so a value can't end the block early and inject other variables.
+func formatGitHubEnv(values map[string]interface{}) (string, error) {
+	var lines []string
+
+	for _, key := range sortedKeys(values) {
+		valueStr := stringValue(values[key])
+
+		if !strings.ContainsAny(valueStr, "\r\n") {
+			lines = append(lines, fmt.Sprintf("%s=%s", key, valueStr))
+			continue
+		}
+
+		delimiter, err := githubDelimiter(valueStr)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, fmt.Sprintf("%s<<%s", key, delimiter), valueStr, delimiter)
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// githubDelimiter returns a random heredoc delimiter that does not occur in value
+func githubDelimiter(value string) (string, error) {
+	for {
+		buf := make([]byte, 16)
+		if _, err := rand.Read(buf); err != nil {
+			return "", fmt.Errorf("failed to generate delimiter: %w", err)
+		}
+		delimiter := "ghadelimiter_" + hex.EncodeToString(buf)
+		if !strings.Contains(value, delimiter) {
+			return delimiter, nil
+		}
+	}
+}
+
+// commandDataEscaper escapes the data of a workflow command as @actions/core
+// does, so GitHub reads back the value it was given
+var commandDataEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+
+// GitHubMaskCommand returns the ::add-mask:: workflow command that hides a
+// value in GitHub Actions logs. The value is escaped, since GitHub unescapes
+// it, and a % in it would otherwise mask something else.
+func GitHubMaskCommand(value string) string {
+	return "::add-mask::" + commandDataEscaper.Replace(value)
+}
+
+// GitHubMaskCommands returns the ::add-mask:: workflow commands that hide the
+// values of keys matching patterns in GitHub Actions logs. Each line of a
+// multi-line value is masked separately, as GitHub masks line by line.
+func GitHubMaskCommands(values map[string]interface{}, patterns []string) ([]string, error) {
+	var commands []string
+
+	for _, key := range sortedKeys(values) {
+		matched, err := matchesAny(key, patterns)
+		if err != nil {
+			return nil, err
+		}
+		if !matched {
+			continue
+		}
+
+		for _, line := range strings.Split(stringValue(values[key]), "\n") {
+			if line = strings.TrimRight(line, "\r"); line != "" {
+				commands = append(commands, GitHubMaskCommand(line))
+			}
+		}
+	}
+
+	return commands, nil
+}
@@ -0,0 +1,66 @@
+package output
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+)
+
+// ChecksumAnnotation holds the checksum of a Secret's data, so a change to
+// the data can be spotted, and copied into a pod template to roll it out
+const ChecksumAnnotation = StampAnnotationPrefix + "checksum"
+
+// manifestMetadata returns the metadata of a Kubernetes manifest: its name,
+// and the namespace, labels, and annotations in opts, with the stamp's
+// annotations if there is one
+func manifestMetadata(name string, opts FormatOptions) map[string]interface{} {
+	metadata := map[string]interface{}{"name": name}
+	if opts.Namespace != "" {
+		metadata["namespace"] = opts.Namespace
+	}
+	if len(opts.Labels) > 0 {
+		labels := make(map[string]interface{}, len(opts.Labels))
+		for key, value := range opts.Labels {
+			labels[key] = value
+		}
+		metadata["labels"] = labels
+	}
+	for key, value := range opts.Annotations {
+		annotate(metadata, key, value)
+	}
+	if annotations := opts.Stamp.annotations(); annotations != nil {
+		for key, value := range annotations {
+			annotate(metadata, key, value)
+		}
+	}
+	return metadata
+}
+
+// annotate adds an annotation to the metadata of a manifest
+func annotate(metadata map[string]interface{}, key string, value interface{}) {
+	annotations, ok := metadata["annotations"].(map[string]interface{})
+	if !ok {
+		annotations = make(map[string]interface{})
+		metadata["annotations"] = annotations
+	}
+	annotations[key] = value
+}
+
+// dataChecksum returns the SHA-256 of a Secret's entries, in key order. It
+// doesn't depend on whether the values end up in data or stringData.
+func dataChecksum(entries map[string]string) string {
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	for _, key := range keys {
+		hash.Write([]byte(key))
+		hash.Write([]byte{0})
+		hash.Write([]byte(entries[key]))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
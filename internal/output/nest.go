@@ -0,0 +1,75 @@
+package output
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Unflatten converts flat keys containing delimiter into nested maps, so with
+// delimiter "__" the key DB__HOST becomes {"DB": {"HOST": ...}}. Keys without
+// the delimiter are kept as-is. It returns an error if a key is used both as a
+// plain value and as a parent of nested keys.
+func Unflatten(values map[string]interface{}, delimiter string) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+
+	for _, key := range sortedKeys(values) {
+		parts := strings.Split(key, delimiter)
+		for _, part := range parts {
+			if part == "" {
+				return nil, fmt.Errorf("key %q has an empty segment when split on %q", key, delimiter)
+			}
+		}
+
+		// Walk down to the parent map, creating intermediate maps as needed
+		current := result
+		for i, part := range parts[:len(parts)-1] {
+			existing, exists := current[part]
+			if !exists {
+				child := make(map[string]interface{})
+				current[part] = child
+				current = child
+				continue
+			}
+			child, ok := existing.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("key %q conflicts with value at %q", key, strings.Join(parts[:i+1], delimiter))
+			}
+			current = child
+		}
+
+		leaf := parts[len(parts)-1]
+		value := values[key]
+		if existing, exists := current[leaf]; exists {
+			existingMap, existingIsMap := existing.(map[string]interface{})
+			valueMap, valueIsMap := value.(map[string]interface{})
+			if !existingIsMap || !valueIsMap {
+				return nil, fmt.Errorf("key %q conflicts with nested keys under it", key)
+			}
+			// A nested map value merges with keys nested under it
+			for k, v := range valueMap {
+				if _, taken := existingMap[k]; taken {
+					return nil, fmt.Errorf("key %q conflicts with nested key %q", key, k)
+				}
+				existingMap[k] = v
+			}
+			continue
+		}
+		current[leaf] = copyValue(value)
+	}
+
+	return result, nil
+}
+
+// copyValue returns a deep copy of nested maps so unflattening never
+// modifies the caller's values
+func copyValue(value interface{}) interface{} {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	copied := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		copied[k] = copyValue(v)
+	}
+	return copied
+}
@@ -0,0 +1,89 @@
+package output
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kinds of output the nomad format can write
+const (
+	// NomadVariable is a Nomad Variables spec, for nomad var put
+	NomadVariable = "var"
+	// NomadTemplate is a job spec template block that renders the values
+	// into an env file
+	NomadTemplate = "template"
+)
+
+// NomadKinds lists the kinds of output the nomad format can write
+var NomadKinds = []string{NomadVariable, NomadTemplate}
+
+// formatNomad formats values as a Nomad Variables spec or as a template
+// block for a Nomad job spec, depending on opts.NomadKind
+func formatNomad(values map[string]interface{}, opts FormatOptions) (string, error) {
+	switch opts.NomadKind {
+	case "", NomadVariable:
+		if opts.NomadPath == "" {
+			return "", fmt.Errorf("variable path is required for nomad format")
+		}
+		return formatNomadVariable(values, opts)
+	case NomadTemplate:
+		if opts.NomadDestination == "" {
+			return "", fmt.Errorf("template destination is required for nomad format")
+		}
+		return formatNomadTemplate(values, opts.NomadDestination), nil
+	default:
+		return "", fmt.Errorf("unsupported nomad output %q (use %s)", opts.NomadKind, strings.Join(NomadKinds, " or "))
+	}
+}
+
+// formatNomadVariable formats values as the items of a Nomad Variables spec,
+// as read by nomad var put. Item names must be HCL identifiers.
+func formatNomadVariable(values map[string]interface{}, opts FormatOptions) (string, error) {
+	keys := sortedKeys(values)
+	width := 0
+	for _, key := range keys {
+		if !terraformIdentifierRegex.MatchString(key) {
+			return "", fmt.Errorf("key %q is not a valid Nomad variable item name", key)
+		}
+		width = max(width, len(key))
+	}
+
+	var b strings.Builder
+	if opts.Namespace != "" {
+		fmt.Fprintf(&b, "namespace = %s\n", hclString(opts.Namespace))
+	}
+	fmt.Fprintf(&b, "path = %s\n\nitems {\n", hclString(opts.NomadPath))
+	for _, key := range keys {
+		fmt.Fprintf(&b, "  %-*s = %s\n", width, key, hclString(stringValue(values[key])))
+	}
+	b.WriteString("}\n")
+	return b.String(), nil
+}
+
+// formatNomadTemplate formats values as a template block that writes them
+// to an env file at destination and exports them to the task. The data is
+// an HCL heredoc rendered by Nomad's template engine, so interpolation and
+// template delimiters in values are escaped, and multi-line values are
+// written as quoted escapes to keep one key per line.
+func formatNomadTemplate(values map[string]interface{}, destination string) string {
+	escaper := strings.NewReplacer(
+		"${", "$${",
+		"%{", "%%{",
+		"{{", `{{ "{{" }}`,
+	)
+
+	var b strings.Builder
+	b.WriteString("template {\n")
+	fmt.Fprintf(&b, "  destination = %s\n", hclString(destination))
+	b.WriteString("  env         = true\n")
+	b.WriteString("  data        = <<EOT\n")
+	for _, key := range sortedKeys(values) {
+		value := stringValue(values[key])
+		if needsQuoting(value) {
+			value = strings.NewReplacer("\n", `\n`, "\r", `\r`).Replace(quoteValue(value))
+		}
+		fmt.Fprintf(&b, "%s=%s\n", key, escaper.Replace(value))
+	}
+	b.WriteString("EOT\n}\n")
+	return b.String()
+}
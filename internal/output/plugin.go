@@ -0,0 +1,74 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	// pluginFormatPrefix marks a format as dispatched to an external plugin,
+	// e.g. "plugin:nginx" runs the puff-format-nginx binary
+	pluginFormatPrefix = "plugin:"
+
+	// pluginBinaryPrefix is prepended to the plugin name to find its binary on PATH
+	pluginBinaryPrefix = "puff-format-"
+)
+
+// PluginFormat returns the format that dispatches to the named plugin
+func PluginFormat(name string) Format {
+	return Format(pluginFormatPrefix + name)
+}
+
+// pluginName returns the plugin name for a plugin format
+func pluginName(format Format) (string, bool) {
+	if !strings.HasPrefix(string(format), pluginFormatPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(string(format), pluginFormatPrefix), true
+}
+
+// formatPlugin formats values by running an external plugin binary.
+//
+// Plugin protocol:
+//   - the binary is named puff-format-<name> and found on PATH
+//   - resolved values are written to its stdin as a JSON object
+//   - opts.PluginEnv is added to its environment (PUFF_APP, PUFF_ENV, ...)
+//   - whatever it writes to stdout is the formatted output
+//   - a non-zero exit status is an error; stderr is included in the message
+func formatPlugin(values map[string]interface{}, name string, opts FormatOptions) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid plugin name: %q", name)
+	}
+
+	binary := pluginBinaryPrefix + name
+	path, err := exec.LookPath(binary)
+	if err != nil {
+		return "", fmt.Errorf("format plugin %s not found on PATH: %w", binary, err)
+	}
+
+	input, err := json.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal values for plugin: %w", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(path)
+	cmd.Env = append(os.Environ(), opts.PluginEnv...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			return "", fmt.Errorf("format plugin %s failed: %w: %s", binary, err, msg)
+		}
+		return "", fmt.Errorf("format plugin %s failed: %w", binary, err)
+	}
+
+	return strings.TrimRight(stdout.String(), "\n"), nil
+}
@@ -0,0 +1,110 @@
+package output
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Kubernetes secret types the k8s format can write
+const (
+	SecretTypeOpaque           = "Opaque"
+	SecretTypeTLS              = "kubernetes.io/tls"
+	SecretTypeDockerConfigJSON = "kubernetes.io/dockerconfigjson"
+)
+
+// SecretTypes lists the supported Kubernetes secret types
+var SecretTypes = []string{SecretTypeOpaque, SecretTypeTLS, SecretTypeDockerConfigJSON}
+
+// SecretTypeKeys names the config keys that typed Kubernetes secrets are
+// built from
+type SecretTypeKeys struct {
+	// For kubernetes.io/tls: the keys that become tls.crt and tls.key
+	TLSCert string
+	TLSKey  string
+
+	// For kubernetes.io/dockerconfigjson: the keys holding the registry
+	// credentials. The email is optional.
+	DockerRegistry string
+	DockerUsername string
+	DockerPassword string
+	DockerEmail    string
+}
+
+// k8sSecretEntries returns the entries of a Kubernetes secret of the type in
+// opts, and which of them hold base64-encoded binary values. Opaque secrets
+// hold every value under its key; typed secrets hold only the entries their
+// type defines.
+func k8sSecretEntries(values map[string]interface{}, opts FormatOptions) (map[string]string, map[string]bool, error) {
+	binaryKeys := make(map[string]bool, len(opts.BinaryKeys))
+	for _, key := range opts.BinaryKeys {
+		binaryKeys[key] = true
+	}
+
+	entries := make(map[string]string)
+	binary := make(map[string]bool)
+	switch opts.SecretType {
+	case "", SecretTypeOpaque:
+		for key, value := range values {
+			entries[key] = stringValue(value)
+			binary[key] = binaryKeys[key]
+		}
+	case SecretTypeTLS:
+		for _, entry := range []struct{ name, key string }{
+			{"tls.crt", opts.TypeKeys.TLSCert},
+			{"tls.key", opts.TypeKeys.TLSKey},
+		} {
+			value, ok := values[entry.key]
+			if !ok {
+				return nil, nil, fmt.Errorf("%s secrets need %s for %s", SecretTypeTLS, entry.key, entry.name)
+			}
+			entries[entry.name] = stringValue(value)
+			binary[entry.name] = binaryKeys[entry.key]
+		}
+	case SecretTypeDockerConfigJSON:
+		config, err := dockerConfigJSON(values, opts.TypeKeys)
+		if err != nil {
+			return nil, nil, err
+		}
+		entries[".dockerconfigjson"] = config
+	default:
+		return nil, nil, fmt.Errorf("unsupported secret type %q (use %s)", opts.SecretType, strings.Join(SecretTypes, ", "))
+	}
+	return entries, binary, nil
+}
+
+// dockerConfigJSON assembles the .dockerconfigjson of a registry login, in
+// the format written by docker login
+func dockerConfigJSON(values map[string]interface{}, keys SecretTypeKeys) (string, error) {
+	credentials := make(map[string]string)
+	for _, field := range []struct{ name, key string }{
+		{"registry", keys.DockerRegistry},
+		{"username", keys.DockerUsername},
+		{"password", keys.DockerPassword},
+	} {
+		value, ok := values[field.key]
+		if !ok {
+			return "", fmt.Errorf("%s secrets need %s for the %s", SecretTypeDockerConfigJSON, field.key, field.name)
+		}
+		credentials[field.name] = stringValue(value)
+	}
+
+	auth := map[string]string{
+		"username": credentials["username"],
+		"password": credentials["password"],
+		"auth":     base64.StdEncoding.EncodeToString([]byte(credentials["username"] + ":" + credentials["password"])),
+	}
+	if email, ok := values[keys.DockerEmail]; ok {
+		auth["email"] = stringValue(email)
+	}
+	config := map[string]interface{}{
+		"auths": map[string]interface{}{credentials["registry"]: auth},
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal .dockerconfigjson: %w", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,79 @@
+package output
+
+import (
+	"strings"
+	"time"
+)
+
+// StampAnnotationPrefix prefixes the annotations a stamp adds to Kubernetes
+// manifests
+const StampAnnotationPrefix = "puff/"
+
+// Stamp records where generated output came from, so deployed artifacts can
+// be traced back to their source revision
+type Stamp struct {
+	App    string
+	Env    string
+	Target string
+	// Commit is the git commit of the config root, with a -dirty suffix if
+	// it has uncommitted changes. Empty outside a git repository.
+	Commit    string
+	Generated time.Time
+}
+
+// stampFormats are the formats that can hold a stamp as comments
+var stampFormats = map[Format]bool{
+	FormatEnv:            true,
+	FormatYAML:           true,
+	FormatTfvars:         true,
+	FormatK8s:            true,
+	FormatExternalSecret: true,
+	FormatPushSecret:     true,
+}
+
+// CanStamp reports whether a format can hold a stamp. JSON has no comments,
+// and template and plugin output is up to its author.
+func CanStamp(format Format) bool {
+	return stampFormats[format]
+}
+
+// fields returns the stamp's fields in order, leaving out empty ones
+func (s *Stamp) fields() [][2]string {
+	var fields [][2]string
+	for _, field := range [][2]string{
+		{"app", s.App},
+		{"env", s.Env},
+		{"target", s.Target},
+		{"commit", s.Commit},
+		{"generated", s.Generated.UTC().Format(time.RFC3339)},
+	} {
+		if field[1] != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// header returns the stamp as comment lines, for formats where # starts a
+// comment
+func (s *Stamp) header() string {
+	var b strings.Builder
+	b.WriteString("# Generated by puff; do not edit\n")
+	for _, field := range s.fields() {
+		b.WriteString("# " + field[0] + ": " + field[1] + "\n")
+	}
+	return b.String()
+}
+
+// annotations returns the stamp as Kubernetes annotations, or nil for no
+// stamp
+func (s *Stamp) annotations() map[string]interface{} {
+	if s == nil {
+		return nil
+	}
+	annotations := make(map[string]interface{})
+	for _, field := range s.fields() {
+		annotations[StampAnnotationPrefix+field[0]] = field[1]
+	}
+	return annotations
+}
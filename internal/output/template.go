@@ -0,0 +1,52 @@
+package output
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// templateFuncs are the helper functions available to custom output templates
+var templateFuncs = template.FuncMap{
+	"quote": func(value interface{}) string {
+		return strconv.Quote(stringValue(value))
+	},
+	"base64": func(value interface{}) string {
+		return base64.StdEncoding.EncodeToString([]byte(stringValue(value)))
+	},
+	"indent": func(spaces int, value interface{}) string {
+		pad := strings.Repeat(" ", spaces)
+		return pad + strings.ReplaceAll(stringValue(value), "\n", "\n"+pad)
+	},
+	"toJson": func(value interface{}) (string, error) {
+		jsonBytes, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		return string(jsonBytes), nil
+	},
+}
+
+// formatTemplate renders values through a user-provided Go template.
+// The template data is the values map, so keys are accessed as {{ .KEY }}
+// and {{ range $key, $value := . }} iterates in sorted key order.
+// Referencing a key that doesn't exist is an error.
+func formatTemplate(values map[string]interface{}, templateText string) (string, error) {
+	tmpl, err := template.New("output").
+		Option("missingkey=error").
+		Funcs(templateFuncs).
+		Parse(templateText)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, values); err != nil {
+		return "", fmt.Errorf("failed to render template: %w", err)
+	}
+
+	return b.String(), nil
+}
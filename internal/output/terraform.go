@@ -0,0 +1,99 @@
+package output
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// terraformIdentifierRegex matches valid Terraform variable names
+var terraformIdentifierRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// formatTfvars formats values as a Terraform .tfvars file
+func formatTfvars(values map[string]interface{}) (string, error) {
+	if err := validateTerraformNames(values); err != nil {
+		return "", err
+	}
+
+	keys := sortedKeys(values)
+
+	// Align the = signs like terraform fmt does
+	width := 0
+	for _, key := range keys {
+		if len(key) > width {
+			width = len(key)
+		}
+	}
+
+	var lines []string
+	for _, key := range keys {
+		lines = append(lines, fmt.Sprintf("%-*s = %s", width, key, hclValue(values[key], "")))
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// formatTfvarsJSON formats values as a Terraform .tfvars.json file
+func formatTfvarsJSON(values map[string]interface{}) (string, error) {
+	if err := validateTerraformNames(values); err != nil {
+		return "", err
+	}
+	return formatJSON(values)
+}
+
+// validateTerraformNames ensures every key can be used as a Terraform variable name
+func validateTerraformNames(values map[string]interface{}) error {
+	for _, key := range sortedKeys(values) {
+		if !terraformIdentifierRegex.MatchString(key) {
+			return fmt.Errorf("key %q is not a valid Terraform variable name", key)
+		}
+	}
+	return nil
+}
+
+// hclValue renders a config value as an HCL expression
+func hclValue(value interface{}, indent string) string {
+	switch v := value.(type) {
+	case string:
+		return hclString(v)
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprintf("%v", v)
+	case nil:
+		return "null"
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, hclValue(item, indent))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return "{}"
+		}
+		inner := indent + "  "
+		var b strings.Builder
+		b.WriteString("{\n")
+		for _, key := range sortedKeys(v) {
+			b.WriteString(fmt.Sprintf("%s%s = %s\n", inner, hclString(key), hclValue(v[key], inner)))
+		}
+		b.WriteString(indent + "}")
+		return b.String()
+	default:
+		return hclString(fmt.Sprintf("%v", v))
+	}
+}
+
+// hclString quotes a string for HCL, escaping template sequences so values
+// are taken literally
+func hclString(s string) string {
+	replacer := strings.NewReplacer(
+		`\`, `\\`,
+		`"`, `\"`,
+		"\n", `\n`,
+		"\r", `\r`,
+		"\t", `\t`,
+		"${", "$${",
+		"%{", "%%{",
+	)
+	return `"` + replacer.Replace(s) + `"`
+}
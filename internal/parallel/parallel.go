@@ -0,0 +1,40 @@
+// Package parallel runs independent per-file operations, such as SOPS
+// decryption and re-encryption, on a bounded number of goroutines
+package parallel
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+)
+
+// Jobs is the most operations run at once. It defaults to the number of CPUs
+// and is set by the global --jobs flag.
+var Jobs = runtime.NumCPU()
+
+// Each calls fn for every index from 0 to n-1, running at most Jobs calls at
+// once. It waits for all of them, even after a failure, and returns their
+// errors joined in index order, or nil if every call succeeded.
+func Each(n int, fn func(i int) error) error {
+	workers := min(max(Jobs, 1), n)
+	errs := make([]error, n)
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				errs[i] = fn(i)
+			}
+		}()
+	}
+	for i := range n {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
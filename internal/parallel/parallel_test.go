@@ -0,0 +1,61 @@
+package parallel
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEach(t *testing.T) {
+	defer func(jobs int) { Jobs = jobs }(Jobs)
+	Jobs = 3
+
+	var running, peak atomic.Int32
+	done := make([]bool, 20)
+	err := Each(len(done), func(i int) error {
+		now := running.Add(1)
+		for {
+			old := peak.Load()
+			if now <= old || peak.CompareAndSwap(old, now) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		running.Add(-1)
+		done[i] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Each failed: %v", err)
+	}
+	for i, ok := range done {
+		if !ok {
+			t.Errorf("Expected index %d to be processed", i)
+		}
+	}
+	if peak.Load() > 3 {
+		t.Errorf("Expected at most 3 calls at once, got %d", peak.Load())
+	}
+}
+
+func TestEachErrors(t *testing.T) {
+	calls := atomic.Int32{}
+	err := Each(5, func(i int) error {
+		calls.Add(1)
+		if i == 1 || i == 3 {
+			return errors.New("failed " + string(rune('0'+i)))
+		}
+		return nil
+	})
+	if calls.Load() != 5 {
+		t.Errorf("Expected every call to run despite failures, got %d", calls.Load())
+	}
+	if err == nil || err.Error() != "failed 1\nfailed 3" {
+		t.Errorf("Expected both errors in index order, got %v", err)
+	}
+
+	if err := Each(0, func(int) error { return errors.New("unexpected") }); err != nil {
+		t.Errorf("Expected no calls for n=0, got %v", err)
+	}
+}
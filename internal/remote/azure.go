@@ -0,0 +1,189 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azsecrets"
+)
+
+// AzureNaming is a convention for converting config keys to Key Vault
+// secret names, which may only contain letters, digits, and dashes
+type AzureNaming string
+
+const (
+	AzureNamingDashes      AzureNaming = "dashes"       // DB_PASSWORD -> DB-PASSWORD
+	AzureNamingLowerDashes AzureNaming = "lower-dashes" // DB_PASSWORD -> db-password
+)
+
+// azureSecretNameRegex matches valid Key Vault secret names
+var azureSecretNameRegex = regexp.MustCompile(`^[0-9A-Za-z-]{1,127}$`)
+
+// azureSecretsAPI is the subset of the Key Vault secrets client used by AzureKVStore
+type azureSecretsAPI interface {
+	NewListSecretPropertiesPager(options *azsecrets.ListSecretPropertiesOptions) *runtime.Pager[azsecrets.ListSecretPropertiesResponse]
+	GetSecret(ctx context.Context, name string, version string, options *azsecrets.GetSecretOptions) (azsecrets.GetSecretResponse, error)
+	SetSecret(ctx context.Context, name string, parameters azsecrets.SetSecretParameters, options *azsecrets.SetSecretOptions) (azsecrets.SetSecretResponse, error)
+	DeleteSecret(ctx context.Context, name string, options *azsecrets.DeleteSecretOptions) (azsecrets.DeleteSecretResponse, error)
+}
+
+// AzureKVOptions configures an AzureKVStore
+type AzureKVOptions struct {
+	Vault  string            // Vault name or URL
+	Prefix string            // Prefix for secret names, e.g. "api-prod-"
+	Naming AzureNaming       // Key to secret name convention (defaults to dashes)
+	Tags   map[string]string // Tags applied to every secret written
+}
+
+// AzureKVStore stores values as secrets in an Azure Key Vault, one secret per
+// key. Only secrets carrying all of the store's tags are treated as existing
+// values, so secrets puff did not write for this app and env are never pruned.
+type AzureKVStore struct {
+	client azureSecretsAPI
+	prefix string
+	naming AzureNaming
+	tags   map[string]*string
+}
+
+// NewAzureKVStore creates an AzureKVStore using the default Azure credential chain
+func NewAzureKVStore(opts AzureKVOptions) (*AzureKVStore, error) {
+	vaultURL := opts.Vault
+	if !strings.Contains(vaultURL, "://") {
+		vaultURL = fmt.Sprintf("https://%s.vault.azure.net/", opts.Vault)
+	}
+
+	credential, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Azure credentials: %w", err)
+	}
+
+	client, err := azsecrets.NewClient(vaultURL, credential, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Key Vault client: %w", err)
+	}
+
+	return newAzureKVStore(client, opts)
+}
+
+// newAzureKVStore creates an AzureKVStore with the given client
+func newAzureKVStore(client azureSecretsAPI, opts AzureKVOptions) (*AzureKVStore, error) {
+	naming := opts.Naming
+	if naming == "" {
+		naming = AzureNamingDashes
+	}
+	if naming != AzureNamingDashes && naming != AzureNamingLowerDashes {
+		return nil, fmt.Errorf("invalid naming convention: %s (must be %s or %s)", naming, AzureNamingDashes, AzureNamingLowerDashes)
+	}
+
+	tags := make(map[string]*string, len(opts.Tags))
+	for key, value := range opts.Tags {
+		tags[key] = &value
+	}
+
+	return &AzureKVStore{
+		client: client,
+		prefix: opts.Prefix,
+		naming: naming,
+		tags:   tags,
+	}, nil
+}
+
+// secretName converts a config key to a Key Vault secret name
+func (s *AzureKVStore) secretName(key string) (string, error) {
+	name := s.prefix + strings.ReplaceAll(key, "_", "-")
+	if s.naming == AzureNamingLowerDashes {
+		name = strings.ToLower(name)
+	}
+	if !azureSecretNameRegex.MatchString(name) {
+		return "", fmt.Errorf("key %q cannot be stored in Key Vault: secret name %q may only contain letters, digits, and dashes", key, name)
+	}
+	return name, nil
+}
+
+// keyName converts a Key Vault secret name back to a config key
+func (s *AzureKVStore) keyName(name string) string {
+	key := strings.ReplaceAll(strings.TrimPrefix(name, s.prefix), "-", "_")
+	if s.naming == AzureNamingLowerDashes {
+		key = strings.ToUpper(key)
+	}
+	return key
+}
+
+// hasTags reports whether a secret carries all of the store's tags
+func (s *AzureKVStore) hasTags(tags map[string]*string) bool {
+	for key, value := range s.tags {
+		if tag, ok := tags[key]; !ok || tag == nil || *tag != *value {
+			return false
+		}
+	}
+	return true
+}
+
+// Values returns the values of the secrets written by puff under the prefix
+func (s *AzureKVStore) Values(ctx context.Context) (map[string]string, error) {
+	values := make(map[string]string)
+
+	pager := s.client.NewListSecretPropertiesPager(nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list Key Vault secrets: %w", err)
+		}
+
+		for _, props := range page.Value {
+			if props.ID == nil || (props.Managed != nil && *props.Managed) {
+				continue
+			}
+			name := props.ID.Name()
+			if !strings.HasPrefix(name, s.prefix) || !s.hasTags(props.Tags) {
+				continue
+			}
+
+			secret, err := s.client.GetSecret(ctx, name, "", nil)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get Key Vault secret %s: %w", name, err)
+			}
+			if secret.Value != nil {
+				values[s.keyName(name)] = *secret.Value
+			}
+		}
+	}
+
+	return values, nil
+}
+
+// Put writes a value as a new version of the key's secret
+func (s *AzureKVStore) Put(ctx context.Context, key, value string) error {
+	name, err := s.secretName(key)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.client.SetSecret(ctx, name, azsecrets.SetSecretParameters{
+		Value: &value,
+		Tags:  s.tags,
+	}, nil); err != nil {
+		return fmt.Errorf("failed to set Key Vault secret %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// Delete deletes the key's secret. Vaults with soft delete enabled keep the
+// secret recoverable for the retention period.
+func (s *AzureKVStore) Delete(ctx context.Context, key string) error {
+	name, err := s.secretName(key)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.client.DeleteSecret(ctx, name, nil); err != nil {
+		return fmt.Errorf("failed to delete Key Vault secret %s: %w", name, err)
+	}
+
+	return nil
+}
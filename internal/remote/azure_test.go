@@ -0,0 +1,118 @@
+package remote
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azsecrets"
+)
+
+// fakeKeyVault is an in-memory Key Vault secrets client
+type fakeKeyVault struct {
+	secrets map[string]azsecrets.SetSecretParameters
+}
+
+func (f *fakeKeyVault) NewListSecretPropertiesPager(options *azsecrets.ListSecretPropertiesOptions) *runtime.Pager[azsecrets.ListSecretPropertiesResponse] {
+	var props []*azsecrets.SecretProperties
+	for name, secret := range f.secrets {
+		id := azsecrets.ID("https://test.vault.azure.net/secrets/" + name + "/1")
+		props = append(props, &azsecrets.SecretProperties{ID: &id, Tags: secret.Tags})
+	}
+	return runtime.NewPager(runtime.PagingHandler[azsecrets.ListSecretPropertiesResponse]{
+		More: func(azsecrets.ListSecretPropertiesResponse) bool { return false },
+		Fetcher: func(ctx context.Context, _ *azsecrets.ListSecretPropertiesResponse) (azsecrets.ListSecretPropertiesResponse, error) {
+			return azsecrets.ListSecretPropertiesResponse{
+				SecretPropertiesListResult: azsecrets.SecretPropertiesListResult{Value: props},
+			}, nil
+		},
+	})
+}
+
+func (f *fakeKeyVault) GetSecret(ctx context.Context, name string, version string, options *azsecrets.GetSecretOptions) (azsecrets.GetSecretResponse, error) {
+	return azsecrets.GetSecretResponse{Secret: azsecrets.Secret{Value: f.secrets[name].Value}}, nil
+}
+
+func (f *fakeKeyVault) SetSecret(ctx context.Context, name string, parameters azsecrets.SetSecretParameters, options *azsecrets.SetSecretOptions) (azsecrets.SetSecretResponse, error) {
+	f.secrets[name] = parameters
+	return azsecrets.SetSecretResponse{}, nil
+}
+
+func (f *fakeKeyVault) DeleteSecret(ctx context.Context, name string, options *azsecrets.DeleteSecretOptions) (azsecrets.DeleteSecretResponse, error) {
+	delete(f.secrets, name)
+	return azsecrets.DeleteSecretResponse{}, nil
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestAzureKVStore(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeKeyVault{secrets: map[string]azsecrets.SetSecretParameters{
+		"api-OLD-KEY":  {Value: stringPtr("old"), Tags: map[string]*string{"app": stringPtr("api"), "env": stringPtr("prod")}},
+		"api-UNTAGGED": {Value: stringPtr("manual")},
+		"other-KEY":    {Value: stringPtr("x"), Tags: map[string]*string{"app": stringPtr("api"), "env": stringPtr("prod")}},
+	}}
+
+	store, err := newAzureKVStore(client, AzureKVOptions{
+		Prefix: "api-",
+		Tags:   map[string]string{"app": "api", "env": "prod"},
+	})
+	if err != nil {
+		t.Fatalf("newAzureKVStore failed: %v", err)
+	}
+
+	values, err := store.Values(ctx)
+	if err != nil {
+		t.Fatalf("Values failed: %v", err)
+	}
+	if expected := map[string]string{"OLD_KEY": "old"}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected only tagged secrets under the prefix %v, got %v", expected, values)
+	}
+
+	if err := store.Put(ctx, "DB_PASSWORD", "secret"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	secret, ok := client.secrets["api-DB-PASSWORD"]
+	if !ok || *secret.Value != "secret" || *secret.Tags["env"] != "prod" {
+		t.Errorf("Expected tagged secret api-DB-PASSWORD, got %+v", client.secrets)
+	}
+
+	if err := store.Delete(ctx, "OLD_KEY"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	var names []string
+	for name := range client.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if expected := []string{"api-DB-PASSWORD", "api-UNTAGGED", "other-KEY"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected secrets %v, got %v", expected, names)
+	}
+
+	if err := store.Put(ctx, "my.key", "value"); err == nil {
+		t.Error("Expected error for key that is not a valid secret name")
+	}
+}
+
+func TestAzureKVNaming(t *testing.T) {
+	store, err := newAzureKVStore(&fakeKeyVault{}, AzureKVOptions{Naming: AzureNamingLowerDashes})
+	if err != nil {
+		t.Fatalf("newAzureKVStore failed: %v", err)
+	}
+
+	name, err := store.secretName("DB_PASSWORD")
+	if err != nil || name != "db-password" {
+		t.Errorf("Expected db-password, got %q (err: %v)", name, err)
+	}
+	if key := store.keyName("db-password"); key != "DB_PASSWORD" {
+		t.Errorf("Expected DB_PASSWORD, got %q", key)
+	}
+
+	if _, err := newAzureKVStore(&fakeKeyVault{}, AzureKVOptions{Naming: "camel"}); err == nil {
+		t.Error("Expected error for unknown naming convention")
+	}
+}
@@ -0,0 +1,245 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"golang.org/x/oauth2/google"
+)
+
+// DefaultCloudRunAPIURL is the Cloud Run Admin API used when no URL is
+// configured
+const DefaultCloudRunAPIURL = "https://run.googleapis.com"
+
+// cloudRunScope is the OAuth scope requested for Application Default
+// Credentials
+const cloudRunScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// CloudRunOptions configures a CloudRunStore
+type CloudRunOptions struct {
+	APIURL     string // API URL (defaults to DefaultCloudRunAPIURL)
+	Token      string // OAuth access token (defaults to Application Default Credentials)
+	Project    string // Google Cloud project ID
+	Region     string // Region of the service, e.g. "us-central1"
+	Service    string // Service name
+	Container  string // Container to configure (defaults to the only container)
+	HTTPClient *http.Client
+}
+
+// CloudRunStore stores values as the environment variables of a container
+// of a Cloud Run service. All changes are applied with a single update of the
+// service, which rolls out a new revision. The update carries the etag read
+// by Values, so it fails instead of overwriting a service changed
+// concurrently by someone else. Variables that reference Secret Manager are
+// left alone.
+type CloudRunStore struct {
+	client    *http.Client
+	url       string
+	token     string
+	service   string
+	container string
+	spec      map[string]interface{}
+}
+
+// NewCloudRunStore creates a CloudRunStore. Without a token or HTTP client,
+// requests are authorized with Application Default Credentials.
+func NewCloudRunStore(ctx context.Context, opts CloudRunOptions) (*CloudRunStore, error) {
+	if opts.Project == "" {
+		return nil, fmt.Errorf("a project is required for Cloud Run")
+	}
+	if opts.Region == "" {
+		return nil, fmt.Errorf("a region is required for Cloud Run")
+	}
+	if opts.Service == "" {
+		return nil, fmt.Errorf("a service is required for Cloud Run")
+	}
+
+	apiURL := opts.APIURL
+	if apiURL == "" {
+		apiURL = DefaultCloudRunAPIURL
+	}
+
+	client := opts.HTTPClient
+	if client == nil && opts.Token == "" {
+		var err error
+		client, err = google.DefaultClient(ctx, cloudRunScope)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find Google Cloud credentials (set --token or run gcloud auth application-default login): %w", err)
+		}
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &CloudRunStore{
+		client: client,
+		url: fmt.Sprintf("%s/v2/projects/%s/locations/%s/services/%s", strings.TrimSuffix(apiURL, "/"),
+			url.PathEscape(opts.Project), url.PathEscape(opts.Region), url.PathEscape(opts.Service)),
+		token:     opts.Token,
+		service:   opts.Service,
+		container: opts.Container,
+	}, nil
+}
+
+// Values returns the plain environment variables of the container and
+// records the service for the update
+func (s *CloudRunStore) Values(ctx context.Context) (map[string]string, error) {
+	var spec map[string]interface{}
+	if err := s.do(ctx, http.MethodGet, nil, &spec); err != nil {
+		return nil, fmt.Errorf("failed to read Cloud Run service %s: %w", s.service, err)
+	}
+
+	template, _ := spec["template"].(map[string]interface{})
+	if template == nil {
+		return nil, fmt.Errorf("Cloud Run service %s has no revision template", s.service)
+	}
+	containers, _ := template["containers"].([]interface{})
+	container, err := s.findContainer(containers)
+	if err != nil {
+		return nil, err
+	}
+
+	env, _ := container["env"].([]interface{})
+	values := make(map[string]string)
+	for _, entry := range env {
+		variable, _ := entry.(map[string]interface{})
+		if _, ok := variable["valueSource"]; ok {
+			continue
+		}
+		name, _ := variable["name"].(string)
+		value, _ := variable["value"].(string)
+		values[name] = value
+	}
+
+	s.spec = spec
+	return values, nil
+}
+
+// Release sets and removes environment variables in a single update of the
+// service, keeping the container's other variables. It fails if the service
+// has changed since Values was called.
+func (s *CloudRunStore) Release(ctx context.Context, set map[string]string, remove []string) error {
+	if s.spec == nil {
+		return fmt.Errorf("Cloud Run service %s must be read before it is updated", s.service)
+	}
+
+	template := s.spec["template"].(map[string]interface{})
+	container, err := s.findContainer(template["containers"].([]interface{}))
+	if err != nil {
+		return err
+	}
+	current, _ := container["env"].([]interface{})
+
+	removed := make(map[string]bool, len(remove))
+	for _, key := range remove {
+		removed[key] = true
+	}
+
+	// Existing variables keep their position, so the update only shows the
+	// changed values
+	env := make([]interface{}, 0, len(current)+len(set))
+	written := make(map[string]bool, len(set))
+	for _, entry := range current {
+		variable, _ := entry.(map[string]interface{})
+		name, _ := variable["name"].(string)
+		switch value, ok := set[name]; {
+		case ok:
+			env = append(env, map[string]interface{}{"name": name, "value": value})
+			written[name] = true
+		case !removed[name]:
+			env = append(env, entry)
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(set)) {
+		if !written[key] {
+			env = append(env, map[string]interface{}{"name": key, "value": set[key]})
+		}
+	}
+
+	// A revision name in the template would have to be unique, so it's
+	// cleared to let Cloud Run name the new revision
+	delete(template, "revision")
+	container["env"] = env
+
+	var operation struct {
+		Name string `json:"name"`
+	}
+	if err := s.do(ctx, http.MethodPatch, s.spec, &operation); err != nil {
+		return fmt.Errorf("failed to update Cloud Run service %s: %w", s.service, err)
+	}
+	return nil
+}
+
+// findContainer returns the container to configure: the one named in the
+// options, or the only one
+func (s *CloudRunStore) findContainer(containers []interface{}) (map[string]interface{}, error) {
+	names := make([]string, 0, len(containers))
+	for _, entry := range containers {
+		container, _ := entry.(map[string]interface{})
+		name, _ := container["name"].(string)
+		names = append(names, name)
+		if s.container != "" && name == s.container {
+			return container, nil
+		}
+	}
+	switch {
+	case s.container != "":
+		return nil, fmt.Errorf("Cloud Run service %s has no container %s (containers: %s)", s.service, s.container, strings.Join(names, ", "))
+	case len(containers) != 1:
+		return nil, fmt.Errorf("Cloud Run service %s has %d containers; choose one of %s", s.service, len(containers), strings.Join(names, ", "))
+	}
+	container, _ := containers[0].(map[string]interface{})
+	return container, nil
+}
+
+// do sends an authenticated request for the service to the Cloud Run API,
+// decoding the response into result
+func (s *CloudRunStore) do(ctx context.Context, method string, body interface{}, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.url, reader)
+	if err != nil {
+		return err
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Cloud Run request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// An update with a stale etag is rejected as aborted
+	if resp.StatusCode == http.StatusConflict || resp.StatusCode == http.StatusPreconditionFailed {
+		return fmt.Errorf("the service was modified since it was read; re-run sync to review the new changes")
+	}
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("Cloud Run API returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to parse Cloud Run response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCloudRunStore(t *testing.T) {
+	ctx := context.Background()
+
+	// A minimal Cloud Run API holding a single service
+	etag := `"v1"`
+	var patched map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/projects/acme/locations/us-central1/services/api" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodGet {
+			fmt.Fprintf(w, `{"name":"api","etag":%q,"ingress":"INGRESS_TRAFFIC_ALL","template":{"revision":"api-00001","containers":[{"name":"api","image":"api:1","env":[
+				{"name":"PORT","value":"3000"},
+				{"name":"OLD","value":"x"},
+				{"name":"API_KEY","valueSource":{"secretKeyRef":{"secret":"api-key","version":"latest"}}}
+			]}]}}`, etag)
+			return
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["etag"] != etag {
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprint(w, `{"error":{"status":"ABORTED"}}`)
+			return
+		}
+		patched = body
+		fmt.Fprint(w, `{"name":"operations/1"}`)
+	}))
+	defer server.Close()
+
+	store, err := NewCloudRunStore(ctx, CloudRunOptions{
+		APIURL:  server.URL,
+		Token:   "test",
+		Project: "acme",
+		Region:  "us-central1",
+		Service: "api",
+	})
+	if err != nil {
+		t.Fatalf("NewCloudRunStore failed: %v", err)
+	}
+
+	// Secret Manager references aren't values puff can compare
+	values, err := store.Values(ctx)
+	if err != nil {
+		t.Fatalf("Values failed: %v", err)
+	}
+	if expected := map[string]string{"PORT": "3000", "OLD": "x"}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v, got %v", expected, values)
+	}
+
+	if err := store.Release(ctx, map[string]string{"PORT": "8080", "HOST": "0.0.0.0"}, []string{"OLD"}); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if patched["ingress"] != "INGRESS_TRAFFIC_ALL" {
+		t.Errorf("Service settings were not kept: %v", patched)
+	}
+	template := patched["template"].(map[string]interface{})
+	if _, ok := template["revision"]; ok {
+		t.Errorf("Expected the revision name to be cleared, got %v", template["revision"])
+	}
+	container := template["containers"].([]interface{})[0].(map[string]interface{})
+	env, _ := json.Marshal(container["env"])
+	expected := `[{"name":"PORT","value":"8080"},{"name":"API_KEY","valueSource":{"secretKeyRef":{"secret":"api-key","version":"latest"}}},{"name":"HOST","value":"0.0.0.0"}]`
+	if string(env) != expected {
+		t.Errorf("Expected env %s, got %s", expected, env)
+	}
+
+	// Someone else updates the service after we read
+	if _, err := store.Values(ctx); err != nil {
+		t.Fatalf("Values failed: %v", err)
+	}
+	etag = `"v2"`
+	patched = nil
+
+	err = store.Release(ctx, map[string]string{"PORT": "5000"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "modified since it was read") {
+		t.Fatalf("Expected etag check failure, got %v", err)
+	}
+	if patched != nil {
+		t.Errorf("Concurrent update was clobbered: %v", patched)
+	}
+}
@@ -0,0 +1,193 @@
+package remote
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultConsulAddress is the Consul agent used when no address is configured
+const DefaultConsulAddress = "http://127.0.0.1:8500"
+
+// ConsulKVOptions configures a ConsulKVStore
+type ConsulKVOptions struct {
+	Address    string // Consul HTTP address (defaults to DefaultConsulAddress)
+	Token      string // ACL token with write access to the prefix
+	Datacenter string // Datacenter to write to (defaults to the agent's)
+	Prefix     string // Key prefix, e.g. "apps/api/prod"
+	HTTPClient *http.Client
+}
+
+// consulKVPair is an entry as returned by the Consul KV API
+type consulKVPair struct {
+	Key         string `json:"Key"`
+	Value       string `json:"Value"` // base64-encoded, empty for null values
+	ModifyIndex uint64 `json:"ModifyIndex"`
+}
+
+// ConsulKVStore stores values as Consul KV entries under a prefix, one entry
+// per key, as read by consul-template. Entries nested deeper under the prefix
+// are not config keys and are left alone. Writes and deletes use
+// check-and-set against the index read by Values, so a change fails instead
+// of overwriting an entry written concurrently by someone else.
+type ConsulKVStore struct {
+	client     *http.Client
+	baseURL    string
+	token      string
+	datacenter string
+	prefix     string
+	indexes    map[string]uint64
+}
+
+// NewConsulKVStore creates a ConsulKVStore
+func NewConsulKVStore(opts ConsulKVOptions) (*ConsulKVStore, error) {
+	prefix := strings.Trim(opts.Prefix, "/")
+	if prefix == "" {
+		return nil, fmt.Errorf("a key prefix is required for Consul KV")
+	}
+
+	// CONSUL_HTTP_ADDR is often set without a scheme
+	address := opts.Address
+	if address == "" {
+		address = DefaultConsulAddress
+	}
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+
+	client := opts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &ConsulKVStore{
+		client:     client,
+		baseURL:    strings.TrimSuffix(address, "/") + "/v1/kv/",
+		token:      opts.Token,
+		datacenter: opts.Datacenter,
+		prefix:     prefix,
+	}, nil
+}
+
+// Values returns the entries directly under the prefix and records their
+// indexes for check-and-set
+func (s *ConsulKVStore) Values(ctx context.Context) (map[string]string, error) {
+	values := make(map[string]string)
+
+	resp, err := s.do(ctx, http.MethodGet, s.prefix+"/", url.Values{"recurse": {"true"}}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Consul prefix %s: %w", s.prefix, err)
+	}
+	defer resp.Body.Close()
+
+	s.indexes = make(map[string]uint64)
+	// The prefix doesn't exist yet
+	if resp.StatusCode == http.StatusNotFound {
+		return values, nil
+	}
+
+	var pairs []consulKVPair
+	if err := json.NewDecoder(resp.Body).Decode(&pairs); err != nil {
+		return nil, fmt.Errorf("failed to parse Consul entries: %w", err)
+	}
+
+	for _, pair := range pairs {
+		key := strings.TrimPrefix(pair.Key, s.prefix+"/")
+		if key == "" || strings.Contains(key, "/") {
+			continue
+		}
+		value, err := base64.StdEncoding.DecodeString(pair.Value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode Consul entry %s: %w", pair.Key, err)
+		}
+		values[key] = string(value)
+		s.indexes[key] = pair.ModifyIndex
+	}
+
+	return values, nil
+}
+
+// Put creates or updates the entry for key. It fails if the entry has
+// changed since Values was called, or was created if it didn't exist then.
+func (s *ConsulKVStore) Put(ctx context.Context, key, value string) error {
+	return s.checkAndSet(ctx, http.MethodPut, key, strings.NewReader(value))
+}
+
+// Delete removes the entry for key. It fails if the entry has changed since
+// Values was called.
+func (s *ConsulKVStore) Delete(ctx context.Context, key string) error {
+	return s.checkAndSet(ctx, http.MethodDelete, key, nil)
+}
+
+// checkAndSet writes or deletes the entry for key with the index read by
+// Values. An index of 0 only allows the write if the entry doesn't exist.
+func (s *ConsulKVStore) checkAndSet(ctx context.Context, method, key string, body io.Reader) error {
+	if s.indexes == nil {
+		return fmt.Errorf("Consul prefix %s must be read before it is written", s.prefix)
+	}
+	name := s.prefix + "/" + key
+	index := s.indexes[key]
+
+	resp, err := s.do(ctx, method, name, url.Values{"cas": {strconv.FormatUint(index, 10)}}, body)
+	if err == nil && resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		err = fmt.Errorf("Consul API returned %s", resp.Status)
+	}
+	if err != nil {
+		if method == http.MethodDelete {
+			return fmt.Errorf("failed to delete Consul entry %s: %w", name, err)
+		}
+		return fmt.Errorf("failed to write Consul entry %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+
+	// The API answers true or false for whether the check-and-set succeeded
+	result, err := io.ReadAll(io.LimitReader(resp.Body, 64))
+	if err != nil {
+		return fmt.Errorf("failed to read Consul response for %s: %w", name, err)
+	}
+	if strings.TrimSpace(string(result)) != "true" {
+		return fmt.Errorf("Consul entry %s was modified since it was read (expected index %d); re-run sync to review the new changes", name, index)
+	}
+	return nil
+}
+
+// do sends an authenticated request for a key to the KV API. Not found
+// responses are returned for the caller to handle; other failures are errors.
+func (s *ConsulKVStore) do(ctx context.Context, method, key string, query url.Values, body io.Reader) (*http.Response, error) {
+	if s.datacenter != "" {
+		query.Set("dc", s.datacenter)
+	}
+
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+strings.Join(segments, "/")+"?"+query.Encode(), body)
+	if err != nil {
+		return nil, err
+	}
+	if s.token != "" {
+		req.Header.Set("X-Consul-Token", s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Consul request failed: %w", err)
+	}
+
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("Consul API returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	return resp, nil
+}
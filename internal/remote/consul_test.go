@@ -0,0 +1,147 @@
+package remote
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeConsul serves a KV store and enforces check-and-set
+type fakeConsul struct {
+	entries map[string]consulKVPair
+	index   uint64
+}
+
+func (f *fakeConsul) set(key, value string) {
+	f.index++
+	f.entries[key] = consulKVPair{Key: key, Value: base64.StdEncoding.EncodeToString([]byte(value)), ModifyIndex: f.index}
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Consul-Token") != "token" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+
+	switch r.Method {
+	case http.MethodGet:
+		var pairs []consulKVPair
+		for name, pair := range f.entries {
+			if strings.HasPrefix(name, key) {
+				pairs = append(pairs, pair)
+			}
+		}
+		if len(pairs) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+		json.NewEncoder(w).Encode(pairs)
+	case http.MethodPut, http.MethodDelete:
+		cas, _ := strconv.ParseUint(r.URL.Query().Get("cas"), 10, 64)
+		if f.entries[key].ModifyIndex != cas {
+			io.WriteString(w, "false")
+			return
+		}
+		if r.Method == http.MethodDelete {
+			delete(f.entries, key)
+		} else {
+			value, _ := io.ReadAll(r.Body)
+			f.set(key, string(value))
+		}
+		io.WriteString(w, "true")
+	}
+}
+
+func TestConsulKVStore(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeConsul{entries: make(map[string]consulKVPair)}
+	fake.set("apps/api/prod/PORT", "3000")
+	fake.set("apps/api/prod/OLD", "x")
+	fake.set("apps/api/prod/nested/KEY", "left alone")
+	fake.set("apps/api/staging/PORT", "4000")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	store, err := NewConsulKVStore(ConsulKVOptions{Address: server.URL, Token: "token", Prefix: "/apps/api/prod/"})
+	if err != nil {
+		t.Fatalf("NewConsulKVStore failed: %v", err)
+	}
+
+	if err := store.Put(ctx, "PORT", "8080"); err == nil {
+		t.Fatal("Expected Put before Values to fail")
+	}
+
+	// Only the entries directly under the prefix are values
+	values, err := store.Values(ctx)
+	if err != nil {
+		t.Fatalf("Values failed: %v", err)
+	}
+	if expected := map[string]string{"PORT": "3000", "OLD": "x"}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v, got %v", expected, values)
+	}
+
+	if err := store.Put(ctx, "PORT", "8080"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := store.Put(ctx, "HOST", "api.internal"); err != nil {
+		t.Fatalf("Put of a new key failed: %v", err)
+	}
+	if err := store.Delete(ctx, "OLD"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	values, err = store.Values(ctx)
+	if err != nil {
+		t.Fatalf("Values failed: %v", err)
+	}
+	if expected := map[string]string{"PORT": "8080", "HOST": "api.internal"}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v, got %v", expected, values)
+	}
+	if _, ok := fake.entries["apps/api/prod/nested/KEY"]; !ok {
+		t.Error("Nested entry was removed")
+	}
+
+	// Someone else writes an entry after we read, or creates one we didn't see
+	fake.set("apps/api/prod/PORT", "9090")
+	fake.set("apps/api/prod/DEBUG", "true")
+
+	err = store.Put(ctx, "PORT", "5000")
+	if err == nil || !strings.Contains(err.Error(), "modified since it was read") {
+		t.Fatalf("Expected check-and-set failure, got %v", err)
+	}
+	if err := store.Put(ctx, "DEBUG", "false"); err == nil {
+		t.Fatal("Expected creating an entry that appeared since the read to fail")
+	}
+	if value, _ := base64.StdEncoding.DecodeString(fake.entries["apps/api/prod/PORT"].Value); string(value) != "9090" {
+		t.Errorf("Concurrent write was clobbered: %s", value)
+	}
+}
+
+func TestConsulKVStoreMissingPrefix(t *testing.T) {
+	server := httptest.NewServer(&fakeConsul{entries: make(map[string]consulKVPair)})
+	defer server.Close()
+
+	// CONSUL_HTTP_ADDR is often just host:port
+	store, err := NewConsulKVStore(ConsulKVOptions{Address: strings.TrimPrefix(server.URL, "http://"), Token: "token", Prefix: "apps/api/prod"})
+	if err != nil {
+		t.Fatalf("NewConsulKVStore failed: %v", err)
+	}
+	values, err := store.Values(context.Background())
+	if err != nil || len(values) != 0 {
+		t.Fatalf("Expected empty values for missing prefix, got %v (err: %v)", values, err)
+	}
+
+	if _, err := NewConsulKVStore(ConsulKVOptions{Prefix: "/"}); err == nil {
+		t.Error("Expected an empty prefix to be rejected")
+	}
+}
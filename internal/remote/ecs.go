@@ -0,0 +1,242 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// ecsAPI is the subset of the ECS client used by ECSServiceStore
+type ecsAPI interface {
+	DescribeServices(ctx context.Context, params *ecs.DescribeServicesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeServicesOutput, error)
+	DescribeTaskDefinition(ctx context.Context, params *ecs.DescribeTaskDefinitionInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTaskDefinitionOutput, error)
+	RegisterTaskDefinition(ctx context.Context, params *ecs.RegisterTaskDefinitionInput, optFns ...func(*ecs.Options)) (*ecs.RegisterTaskDefinitionOutput, error)
+	UpdateService(ctx context.Context, params *ecs.UpdateServiceInput, optFns ...func(*ecs.Options)) (*ecs.UpdateServiceOutput, error)
+}
+
+// ECSServiceOptions configures an ECSServiceStore
+type ECSServiceOptions struct {
+	Cluster   string // Cluster name or ARN (defaults to the default cluster)
+	Service   string // Service name or ARN
+	Container string // Container to configure (defaults to the only container)
+	Region    string // AWS region (defaults to the SDK's region resolution)
+
+	// SecretKeys are the keys whose values are SSM parameter names, written
+	// to the container's secrets instead of its environment
+	SecretKeys map[string]bool
+}
+
+// ECSServiceStore stores values as the environment and secrets of a
+// container of an ECS service's task definition. Changes are applied by
+// registering a new revision of the task definition and deploying it to the
+// service, so all changes roll out in a single deployment. Secrets hold the
+// names of the SSM parameters ECS reads their values from.
+type ECSServiceStore struct {
+	client         ecsAPI
+	cluster        *string
+	service        string
+	container      string
+	secretKeys     map[string]bool
+	taskDefinition *types.TaskDefinition
+	tags           []types.Tag
+	containerIndex int
+}
+
+// NewECSServiceStore creates an ECSServiceStore using the default AWS
+// credential chain
+func NewECSServiceStore(ctx context.Context, opts ECSServiceOptions) (*ECSServiceStore, error) {
+	var loadOpts []func(*awsconfig.LoadOptions) error
+	if opts.Region != "" {
+		loadOpts = append(loadOpts, awsconfig.WithRegion(opts.Region))
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, loadOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	return newECSServiceStore(ecs.NewFromConfig(cfg), opts)
+}
+
+// newECSServiceStore creates an ECSServiceStore with the given client
+func newECSServiceStore(client ecsAPI, opts ECSServiceOptions) (*ECSServiceStore, error) {
+	if opts.Service == "" {
+		return nil, fmt.Errorf("a service is required for ECS")
+	}
+	store := &ECSServiceStore{
+		client:     client,
+		service:    opts.Service,
+		container:  opts.Container,
+		secretKeys: opts.SecretKeys,
+	}
+	if opts.Cluster != "" {
+		store.cluster = aws.String(opts.Cluster)
+	}
+	return store, nil
+}
+
+// Values returns the environment and secrets of the container in the
+// service's current task definition
+func (s *ECSServiceStore) Values(ctx context.Context) (map[string]string, error) {
+	arn, err := s.serviceTaskDefinition(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := s.client.DescribeTaskDefinition(ctx, &ecs.DescribeTaskDefinitionInput{
+		TaskDefinition: aws.String(arn),
+		Include:        []types.TaskDefinitionField{types.TaskDefinitionFieldTags},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ECS task definition %s: %w", arn, err)
+	}
+
+	index, err := s.findContainer(output.TaskDefinition.ContainerDefinitions)
+	if err != nil {
+		return nil, err
+	}
+	s.taskDefinition = output.TaskDefinition
+	s.tags = output.Tags
+	s.containerIndex = index
+
+	values := make(map[string]string)
+	container := output.TaskDefinition.ContainerDefinitions[index]
+	for _, variable := range container.Environment {
+		values[aws.ToString(variable.Name)] = aws.ToString(variable.Value)
+	}
+	for _, secret := range container.Secrets {
+		values[aws.ToString(secret.Name)] = aws.ToString(secret.ValueFrom)
+	}
+	return values, nil
+}
+
+// Release registers a new revision of the task definition with the values
+// in set and without the keys in remove, keeping the container's other
+// variables, and deploys it to the service. It fails if the service has
+// moved to another task definition since Values was called.
+func (s *ECSServiceStore) Release(ctx context.Context, set map[string]string, remove []string) error {
+	if s.taskDefinition == nil {
+		return fmt.Errorf("ECS service %s must be read before it is updated", s.service)
+	}
+
+	current, err := s.serviceTaskDefinition(ctx)
+	if err != nil {
+		return err
+	}
+	if current != aws.ToString(s.taskDefinition.TaskDefinitionArn) {
+		return fmt.Errorf("ECS service %s was modified since it was read (now running %s); re-run sync to review the new changes", s.service, current)
+	}
+
+	definitions := append([]types.ContainerDefinition{}, s.taskDefinition.ContainerDefinitions...)
+	container := &definitions[s.containerIndex]
+
+	environment := make(map[string]string)
+	for _, variable := range container.Environment {
+		environment[aws.ToString(variable.Name)] = aws.ToString(variable.Value)
+	}
+	secrets := make(map[string]string)
+	for _, secret := range container.Secrets {
+		secrets[aws.ToString(secret.Name)] = aws.ToString(secret.ValueFrom)
+	}
+	for key, value := range set {
+		delete(environment, key)
+		delete(secrets, key)
+		if s.secretKeys[key] {
+			secrets[key] = value
+		} else {
+			environment[key] = value
+		}
+	}
+	for _, key := range remove {
+		delete(environment, key)
+		delete(secrets, key)
+	}
+
+	container.Environment = nil
+	for _, key := range slices.Sorted(maps.Keys(environment)) {
+		container.Environment = append(container.Environment, types.KeyValuePair{Name: aws.String(key), Value: aws.String(environment[key])})
+	}
+	container.Secrets = nil
+	for _, key := range slices.Sorted(maps.Keys(secrets)) {
+		container.Secrets = append(container.Secrets, types.Secret{Name: aws.String(key), ValueFrom: aws.String(secrets[key])})
+	}
+
+	definition := s.taskDefinition
+	registered, err := s.client.RegisterTaskDefinition(ctx, &ecs.RegisterTaskDefinitionInput{
+		Family:                  definition.Family,
+		ContainerDefinitions:    definitions,
+		Cpu:                     definition.Cpu,
+		Memory:                  definition.Memory,
+		EnableFaultInjection:    definition.EnableFaultInjection,
+		EphemeralStorage:        definition.EphemeralStorage,
+		ExecutionRoleArn:        definition.ExecutionRoleArn,
+		TaskRoleArn:             definition.TaskRoleArn,
+		InferenceAccelerators:   definition.InferenceAccelerators,
+		IpcMode:                 definition.IpcMode,
+		PidMode:                 definition.PidMode,
+		NetworkMode:             definition.NetworkMode,
+		PlacementConstraints:    definition.PlacementConstraints,
+		ProxyConfiguration:      definition.ProxyConfiguration,
+		RequiresCompatibilities: definition.RequiresCompatibilities,
+		RuntimePlatform:         definition.RuntimePlatform,
+		Volumes:                 definition.Volumes,
+		Tags:                    s.tags,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to register ECS task definition %s: %w", aws.ToString(definition.Family), err)
+	}
+
+	arn := registered.TaskDefinition.TaskDefinitionArn
+	if _, err := s.client.UpdateService(ctx, &ecs.UpdateServiceInput{
+		Cluster:        s.cluster,
+		Service:        aws.String(s.service),
+		TaskDefinition: arn,
+	}); err != nil {
+		return fmt.Errorf("failed to deploy %s to ECS service %s: %w", aws.ToString(arn), s.service, err)
+	}
+
+	s.taskDefinition = registered.TaskDefinition
+	return nil
+}
+
+// serviceTaskDefinition returns the ARN of the task definition the service
+// runs
+func (s *ECSServiceStore) serviceTaskDefinition(ctx context.Context) (string, error) {
+	output, err := s.client.DescribeServices(ctx, &ecs.DescribeServicesInput{
+		Cluster:  s.cluster,
+		Services: []string{s.service},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read ECS service %s: %w", s.service, err)
+	}
+	if len(output.Services) == 0 {
+		return "", fmt.Errorf("ECS service %s not found", s.service)
+	}
+	return aws.ToString(output.Services[0].TaskDefinition), nil
+}
+
+// findContainer returns the index of the container to configure: the one
+// named in the options, or the only one
+func (s *ECSServiceStore) findContainer(containers []types.ContainerDefinition) (int, error) {
+	names := make([]string, len(containers))
+	for i, container := range containers {
+		names[i] = aws.ToString(container.Name)
+		if s.container != "" && names[i] == s.container {
+			return i, nil
+		}
+	}
+	switch {
+	case s.container != "":
+		return 0, fmt.Errorf("ECS service %s has no container %s (containers: %s)", s.service, s.container, strings.Join(names, ", "))
+	case len(containers) != 1:
+		return 0, fmt.Errorf("ECS service %s has %d containers; choose one of %s", s.service, len(containers), strings.Join(names, ", "))
+	}
+	return 0, nil
+}
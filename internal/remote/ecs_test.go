@@ -0,0 +1,152 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ecs"
+	"github.com/aws/aws-sdk-go-v2/service/ecs/types"
+)
+
+// fakeECS holds the revisions of a single task family and the service
+// running one of them
+type fakeECS struct {
+	revisions []types.TaskDefinition
+	running   string
+}
+
+func (f *fakeECS) register(definition types.TaskDefinition) *types.TaskDefinition {
+	definition.Revision = int32(len(f.revisions) + 1)
+	definition.TaskDefinitionArn = aws.String(fmt.Sprintf("arn:aws:ecs:us-east-1:123456789012:task-definition/%s:%d", aws.ToString(definition.Family), definition.Revision))
+	f.revisions = append(f.revisions, definition)
+	return &f.revisions[len(f.revisions)-1]
+}
+
+func (f *fakeECS) DescribeServices(ctx context.Context, params *ecs.DescribeServicesInput, optFns ...func(*ecs.Options)) (*ecs.DescribeServicesOutput, error) {
+	return &ecs.DescribeServicesOutput{Services: []types.Service{{ServiceName: aws.String(params.Services[0]), TaskDefinition: aws.String(f.running)}}}, nil
+}
+
+func (f *fakeECS) DescribeTaskDefinition(ctx context.Context, params *ecs.DescribeTaskDefinitionInput, optFns ...func(*ecs.Options)) (*ecs.DescribeTaskDefinitionOutput, error) {
+	for i := range f.revisions {
+		if aws.ToString(f.revisions[i].TaskDefinitionArn) == aws.ToString(params.TaskDefinition) {
+			return &ecs.DescribeTaskDefinitionOutput{TaskDefinition: &f.revisions[i], Tags: []types.Tag{{Key: aws.String("team"), Value: aws.String("core")}}}, nil
+		}
+	}
+	return nil, fmt.Errorf("task definition %s not found", aws.ToString(params.TaskDefinition))
+}
+
+func (f *fakeECS) RegisterTaskDefinition(ctx context.Context, params *ecs.RegisterTaskDefinitionInput, optFns ...func(*ecs.Options)) (*ecs.RegisterTaskDefinitionOutput, error) {
+	if len(params.Tags) == 0 {
+		return nil, fmt.Errorf("tags were not copied")
+	}
+	definition := f.register(types.TaskDefinition{
+		Family:               params.Family,
+		ContainerDefinitions: params.ContainerDefinitions,
+		Cpu:                  params.Cpu,
+		Memory:               params.Memory,
+	})
+	return &ecs.RegisterTaskDefinitionOutput{TaskDefinition: definition}, nil
+}
+
+func (f *fakeECS) UpdateService(ctx context.Context, params *ecs.UpdateServiceInput, optFns ...func(*ecs.Options)) (*ecs.UpdateServiceOutput, error) {
+	f.running = aws.ToString(params.TaskDefinition)
+	return &ecs.UpdateServiceOutput{}, nil
+}
+
+func TestECSServiceStore(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeECS{}
+	client.running = aws.ToString(client.register(types.TaskDefinition{
+		Family: aws.String("api"),
+		Cpu:    aws.String("256"),
+		ContainerDefinitions: []types.ContainerDefinition{
+			{
+				Name:        aws.String("api"),
+				Image:       aws.String("api:1"),
+				Environment: []types.KeyValuePair{{Name: aws.String("PORT"), Value: aws.String("3000")}, {Name: aws.String("OLD"), Value: aws.String("x")}},
+				Secrets:     []types.Secret{{Name: aws.String("API_KEY"), ValueFrom: aws.String("/api/prod/API_KEY")}},
+			},
+			{Name: aws.String("datadog-agent"), Image: aws.String("datadog/agent")},
+		},
+	}).TaskDefinitionArn)
+
+	// The container must be chosen when the task has several
+	store, err := newECSServiceStore(client, ECSServiceOptions{Service: "api"})
+	if err != nil {
+		t.Fatalf("newECSServiceStore failed: %v", err)
+	}
+	if _, err := store.Values(ctx); err == nil || !strings.Contains(err.Error(), "api, datadog-agent") {
+		t.Fatalf("Expected container choice error, got %v", err)
+	}
+
+	store, err = newECSServiceStore(client, ECSServiceOptions{
+		Service:    "api",
+		Container:  "api",
+		SecretKeys: map[string]bool{"DB_PASSWORD": true},
+	})
+	if err != nil {
+		t.Fatalf("newECSServiceStore failed: %v", err)
+	}
+
+	values, err := store.Values(ctx)
+	if err != nil {
+		t.Fatalf("Values failed: %v", err)
+	}
+	expected := map[string]string{"PORT": "3000", "OLD": "x", "API_KEY": "/api/prod/API_KEY"}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v, got %v", expected, values)
+	}
+
+	// Variables that aren't changed or removed are kept, and the new
+	// revision is deployed
+	set := map[string]string{"PORT": "8080", "DB_PASSWORD": "/api/prod/DB_PASSWORD"}
+	if err := store.Release(ctx, set, []string{"OLD"}); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if !strings.HasSuffix(client.running, "task-definition/api:2") {
+		t.Fatalf("Expected revision 2 to be deployed, got %s", client.running)
+	}
+	deployed := client.revisions[1]
+	if aws.ToString(deployed.Cpu) != "256" || aws.ToString(deployed.ContainerDefinitions[1].Name) != "datadog-agent" {
+		t.Errorf("Task definition settings were not kept: %+v", deployed)
+	}
+	container := deployed.ContainerDefinitions[0]
+	if aws.ToString(container.Image) != "api:1" {
+		t.Errorf("Container settings were not kept: %+v", container)
+	}
+	environment := map[string]string{}
+	for _, variable := range container.Environment {
+		environment[aws.ToString(variable.Name)] = aws.ToString(variable.Value)
+	}
+	if expected := map[string]string{"PORT": "8080"}; !reflect.DeepEqual(environment, expected) {
+		t.Errorf("Expected environment %v, got %v", expected, environment)
+	}
+	secrets := map[string]string{}
+	for _, secret := range container.Secrets {
+		secrets[aws.ToString(secret.Name)] = aws.ToString(secret.ValueFrom)
+	}
+	if expected := map[string]string{"API_KEY": "/api/prod/API_KEY", "DB_PASSWORD": "/api/prod/DB_PASSWORD"}; !reflect.DeepEqual(secrets, expected) {
+		t.Errorf("Expected secrets %v, got %v", expected, secrets)
+	}
+	if len(client.revisions[0].ContainerDefinitions[0].Environment) != 2 {
+		t.Errorf("The previous revision was modified: %+v", client.revisions[0])
+	}
+
+	// Someone else deploys after we read
+	if _, err := store.Values(ctx); err != nil {
+		t.Fatalf("Values failed: %v", err)
+	}
+	client.running = aws.ToString(client.register(client.revisions[1]).TaskDefinitionArn)
+
+	err = store.Release(ctx, map[string]string{"PORT": "5000"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "modified since it was read") {
+		t.Fatalf("Expected deployment check failure, got %v", err)
+	}
+	if len(client.revisions) != 3 {
+		t.Errorf("Expected no revision to be registered, got %d revisions", len(client.revisions))
+	}
+}
@@ -0,0 +1,182 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// DefaultFlyAPIURL is the Fly.io API used when no URL is configured
+const DefaultFlyAPIURL = "https://api.fly.io"
+
+// FlyOptions configures a FlyStore
+type FlyOptions struct {
+	APIURL     string // API URL (defaults to DefaultFlyAPIURL)
+	Token      string // Access token, as printed by fly auth token or fly tokens create
+	App        string // Fly.io app name
+	HTTPClient *http.Client
+}
+
+// FlyStore stores values as the secrets of a Fly.io app. Fly.io never
+// returns secret values, only their digests, so the store is write-only and
+// a sync writes the keys whose digests differ from the config. All changes
+// are applied with a single mutation, which creates a single release.
+type FlyStore struct {
+	client *http.Client
+	url    string
+	token  string
+	app    string
+}
+
+// NewFlyStore creates a FlyStore
+func NewFlyStore(opts FlyOptions) (*FlyStore, error) {
+	if opts.App == "" {
+		return nil, fmt.Errorf("an app is required for Fly.io secrets")
+	}
+	if opts.Token == "" {
+		return nil, fmt.Errorf("a Fly.io access token is required")
+	}
+
+	apiURL := opts.APIURL
+	if apiURL == "" {
+		apiURL = DefaultFlyAPIURL
+	}
+
+	client := opts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &FlyStore{
+		client: client,
+		url:    strings.TrimSuffix(apiURL, "/") + "/graphql",
+		token:  opts.Token,
+		app:    opts.App,
+	}, nil
+}
+
+// WriteOnly marks FlyStore as write-only, as secret values can't be read
+func (s *FlyStore) WriteOnly() {}
+
+// Values returns the names of the app's secrets, with their digests as
+// values
+func (s *FlyStore) Values(ctx context.Context) (map[string]string, error) {
+	var data struct {
+		App struct {
+			Secrets []struct {
+				Name   string `json:"name"`
+				Digest string `json:"digest"`
+			} `json:"secrets"`
+		} `json:"app"`
+	}
+	query := `query($appName: String!) { app(name: $appName) { secrets { name digest } } }`
+	if err := s.graphql(ctx, query, map[string]interface{}{"appName": s.app}, &data); err != nil {
+		return nil, fmt.Errorf("failed to list Fly.io secrets of %s: %w", s.app, err)
+	}
+
+	values := make(map[string]string, len(data.App.Secrets))
+	for _, secret := range data.App.Secrets {
+		values[secret.Name] = secret.Digest
+	}
+	return values, nil
+}
+
+// MatchesDigest reports whether a secret's digest is that of value. Fly.io
+// digests are the hex SHA-256 of the value, possibly truncated; an empty or
+// unrecognised digest never matches, so the key is written.
+func (s *FlyStore) MatchesDigest(digest, value string) bool {
+	if len(digest) < 16 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(value))
+	return strings.HasPrefix(hex.EncodeToString(sum[:]), strings.ToLower(digest))
+}
+
+// Release sets and removes secrets in a single release. When keys are
+// removed, set holds every key in the config, and all secrets are replaced
+// with set.
+func (s *FlyStore) Release(ctx context.Context, set map[string]string, remove []string) error {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	secrets := make([]map[string]string, 0, len(keys))
+	for _, key := range keys {
+		secrets = append(secrets, map[string]string{"key": key, "value": set[key]})
+	}
+
+	mutation := `mutation($input: SetSecretsInput!) { setSecrets(input: $input) { release { version } } }`
+	input := map[string]interface{}{
+		"appId":      s.app,
+		"secrets":    secrets,
+		"replaceAll": len(remove) > 0,
+	}
+	if err := s.graphql(ctx, mutation, map[string]interface{}{"input": input}, nil); err != nil {
+		return fmt.Errorf("failed to set Fly.io secrets of %s: %w", s.app, err)
+	}
+	return nil
+}
+
+// graphql sends an authenticated GraphQL request, decoding the response data
+// into result if it's set
+func (s *FlyStore) graphql(ctx context.Context, query string, variables map[string]interface{}, result interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	// Tokens from fly tokens create carry their own scheme
+	if strings.HasPrefix(s.token, "FlyV1 ") {
+		req.Header.Set("Authorization", s.token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Fly.io request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("Fly.io API returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	var response struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("failed to parse Fly.io response: %w", err)
+	}
+	if len(response.Errors) > 0 {
+		messages := make([]string, len(response.Errors))
+		for i, e := range response.Errors {
+			messages[i] = e.Message
+		}
+		return fmt.Errorf("Fly.io API error: %s", strings.Join(messages, "; "))
+	}
+	if result != nil {
+		if err := json.Unmarshal(response.Data, result); err != nil {
+			return fmt.Errorf("failed to parse Fly.io response: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestFlyStore(t *testing.T) {
+	ctx := context.Background()
+
+	var inputs []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/graphql" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("Authorization") != "FlyV1 fm2_token" {
+			fmt.Fprint(w, `{"errors":[{"message":"You must be authenticated to view this."}]}`)
+			return
+		}
+		var body struct {
+			Variables map[string]interface{} `json:"variables"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if input, ok := body.Variables["input"].(map[string]interface{}); ok {
+			inputs = append(inputs, input)
+			fmt.Fprint(w, `{"data":{"setSecrets":{"release":{"version":4}}}}`)
+			return
+		}
+		fmt.Fprint(w, `{"data":{"app":{"secrets":[{"name":"PORT","digest":"6C237681E7092160"},{"name":"OLD","digest":""}]}}}`)
+	}))
+	defer server.Close()
+
+	store, err := NewFlyStore(FlyOptions{APIURL: server.URL, Token: "FlyV1 fm2_token", App: "my-api"})
+	if err != nil {
+		t.Fatalf("NewFlyStore failed: %v", err)
+	}
+
+	// Only the names and digests of secrets can be read
+	values, err := store.Values(ctx)
+	if err != nil {
+		t.Fatalf("Values failed: %v", err)
+	}
+	if expected := map[string]string{"PORT": "6C237681E7092160", "OLD": ""}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v, got %v", expected, values)
+	}
+	if !store.MatchesDigest(values["PORT"], "8080") {
+		t.Error("Expected the digest of PORT to match 8080")
+	}
+	if store.MatchesDigest(values["PORT"], "8081") || store.MatchesDigest(values["OLD"], "") {
+		t.Error("Expected other values and empty digests not to match")
+	}
+
+	if err := store.Release(ctx, map[string]string{"PORT": "8080"}, nil); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	// Removing keys replaces every secret in the same release
+	if err := store.Release(ctx, map[string]string{"PORT": "8080"}, []string{"OLD"}); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if len(inputs) != 2 || inputs[0]["replaceAll"] != false || inputs[1]["replaceAll"] != true || inputs[1]["appId"] != "my-api" {
+		t.Errorf("Unexpected mutations: %v", inputs)
+	}
+	secrets, _ := inputs[1]["secrets"].([]interface{})
+	if expected := []interface{}{map[string]interface{}{"key": "PORT", "value": "8080"}}; !reflect.DeepEqual(secrets, expected) {
+		t.Errorf("Expected secrets %v, got %v", expected, secrets)
+	}
+
+	badToken, _ := NewFlyStore(FlyOptions{APIURL: server.URL, Token: "wrong", App: "my-api"})
+	if _, err := badToken.Values(ctx); err == nil {
+		t.Error("Expected GraphQL errors to fail")
+	}
+}
@@ -0,0 +1,199 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// DefaultGitLabURL is the GitLab instance used when no URL is configured
+const DefaultGitLabURL = "https://gitlab.com"
+
+// GitLabOptions configures a GitLabStore
+type GitLabOptions struct {
+	URL              string   // GitLab instance URL (defaults to DefaultGitLabURL)
+	Token            string   // Personal, project, or group access token with api scope
+	Project          string   // Project ID or path (e.g. group/project)
+	Group            string   // Group ID or path, used instead of Project
+	EnvironmentScope string   // Environment scope of the variables (e.g. production)
+	MaskedKeys       []string // Key names or glob patterns to mark as masked
+	ProtectedKeys    []string // Key names or glob patterns to mark as protected
+	HTTPClient       *http.Client
+}
+
+// gitlabVariable is a CI/CD variable as returned by the GitLab API
+type gitlabVariable struct {
+	Key              string `json:"key"`
+	Value            string `json:"value"`
+	EnvironmentScope string `json:"environment_scope"`
+}
+
+// GitLabStore stores values as GitLab project or group CI/CD variables
+// scoped to a single environment, one variable per key
+type GitLabStore struct {
+	client        *http.Client
+	baseURL       string
+	token         string
+	scope         string
+	maskedKeys    []string
+	protectedKeys []string
+	existing      map[string]bool
+}
+
+// NewGitLabStore creates a GitLabStore
+func NewGitLabStore(opts GitLabOptions) (*GitLabStore, error) {
+	if (opts.Project == "") == (opts.Group == "") {
+		return nil, fmt.Errorf("exactly one of project or group is required for GitLab variables")
+	}
+	if opts.Token == "" {
+		return nil, fmt.Errorf("a GitLab access token is required")
+	}
+
+	for _, pattern := range append(append([]string{}, opts.MaskedKeys...), opts.ProtectedKeys...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid key pattern %q: %w", pattern, err)
+		}
+	}
+
+	instanceURL := opts.URL
+	if instanceURL == "" {
+		instanceURL = DefaultGitLabURL
+	}
+
+	resource := "projects/" + url.PathEscape(opts.Project)
+	if opts.Group != "" {
+		resource = "groups/" + url.PathEscape(opts.Group)
+	}
+
+	client := opts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	scope := opts.EnvironmentScope
+	if scope == "" {
+		scope = "*"
+	}
+
+	return &GitLabStore{
+		client:        client,
+		baseURL:       strings.TrimSuffix(instanceURL, "/") + "/api/v4/" + resource + "/variables",
+		token:         opts.Token,
+		scope:         scope,
+		maskedKeys:    opts.MaskedKeys,
+		protectedKeys: opts.ProtectedKeys,
+	}, nil
+}
+
+// Values returns the variables in the store's environment scope
+func (s *GitLabStore) Values(ctx context.Context) (map[string]string, error) {
+	values := make(map[string]string)
+	s.existing = make(map[string]bool)
+
+	for page := "1"; page != ""; {
+		resp, err := s.do(ctx, http.MethodGet, "?per_page=100&page="+page, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var variables []gitlabVariable
+		err = json.NewDecoder(resp.Body).Decode(&variables)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse GitLab variables: %w", err)
+		}
+
+		for _, variable := range variables {
+			if variable.EnvironmentScope == s.scope {
+				values[variable.Key] = variable.Value
+				s.existing[variable.Key] = true
+			}
+		}
+
+		page = resp.Header.Get("X-Next-Page")
+	}
+
+	return values, nil
+}
+
+// Put creates or updates the variable for key in the store's environment scope
+func (s *GitLabStore) Put(ctx context.Context, key, value string) error {
+	body := map[string]interface{}{
+		"value":             value,
+		"environment_scope": s.scope,
+		"variable_type":     "env_var",
+		"masked":            matchesPattern(key, s.maskedKeys),
+		"protected":         matchesPattern(key, s.protectedKeys),
+		"raw":               true,
+	}
+
+	var resp *http.Response
+	var err error
+	if s.existing[key] {
+		resp, err = s.do(ctx, http.MethodPut, "/"+url.PathEscape(key)+"?filter[environment_scope]="+url.QueryEscape(s.scope), body)
+	} else {
+		body["key"] = key
+		resp, err = s.do(ctx, http.MethodPost, "", body)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write GitLab variable %s: %w", key, err)
+	}
+	resp.Body.Close()
+
+	if s.existing != nil {
+		s.existing[key] = true
+	}
+	return nil
+}
+
+// do sends an authenticated request to the variables API and returns the
+// response if it succeeded
+func (s *GitLabStore) do(ctx context.Context, method, suffix string, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+suffix, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("PRIVATE-TOKEN", s.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("GitLab request failed: %w", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("GitLab API returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	return resp, nil
+}
+
+// matchesPattern reports whether key matches any of the given glob patterns.
+// Patterns are validated when the store is created.
+func matchesPattern(key string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, key); matched {
+			return true
+		}
+	}
+	return false
+}
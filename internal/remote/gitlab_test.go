@@ -0,0 +1,98 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// fakeGitLabVariable is a variable held by the fake GitLab server
+type fakeGitLabVariable struct {
+	Key              string `json:"key"`
+	Value            string `json:"value"`
+	EnvironmentScope string `json:"environment_scope"`
+	Masked           bool   `json:"masked"`
+	Protected        bool   `json:"protected"`
+}
+
+func TestGitLabStore(t *testing.T) {
+	ctx := context.Background()
+	variables := []*fakeGitLabVariable{
+		{Key: "PORT", Value: "3000", EnvironmentScope: "production"},
+		{Key: "PORT", Value: "4000", EnvironmentScope: "staging"},
+	}
+
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		methods = append(methods, r.Method+" "+r.URL.Path)
+
+		var body fakeGitLabVariable
+		json.NewDecoder(r.Body).Decode(&body)
+
+		switch r.Method {
+		case http.MethodGet:
+			json.NewEncoder(w).Encode(variables)
+		case http.MethodPost:
+			variables = append(variables, &body)
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodPut:
+			for _, v := range variables {
+				if v.Key == "PORT" && v.EnvironmentScope == r.URL.Query().Get("filter[environment_scope]") {
+					v.Value, v.Masked, v.Protected = body.Value, body.Masked, body.Protected
+				}
+			}
+		}
+	}))
+	defer server.Close()
+
+	store, err := NewGitLabStore(GitLabOptions{
+		URL:              server.URL,
+		Token:            "token",
+		Project:          "group/project",
+		EnvironmentScope: "production",
+		MaskedKeys:       []string{"*_TOKEN"},
+		ProtectedKeys:    []string{"*"},
+	})
+	if err != nil {
+		t.Fatalf("NewGitLabStore failed: %v", err)
+	}
+
+	values, err := store.Values(ctx)
+	if err != nil {
+		t.Fatalf("Values failed: %v", err)
+	}
+	if expected := map[string]string{"PORT": "3000"}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected only production-scoped variables %v, got %v", expected, values)
+	}
+
+	if err := store.Put(ctx, "PORT", "8080"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := store.Put(ctx, "API_TOKEN", "abcdefgh1234"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	// The server sees the decoded path, so group%2Fproject appears as group/project
+	if len(methods) != 3 || methods[1] != "PUT /api/v4/projects/group/project/variables/PORT" || methods[2] != "POST /api/v4/projects/group/project/variables" {
+		t.Errorf("Unexpected requests: %v", methods)
+	}
+
+	if variables[0].Value != "8080" || variables[1].Value != "4000" {
+		t.Errorf("Expected only the production PORT to change, got %+v %+v", variables[0], variables[1])
+	}
+	created := variables[2]
+	if created.Key != "API_TOKEN" || created.EnvironmentScope != "production" || !created.Masked || !created.Protected {
+		t.Errorf("Unexpected created variable: %+v", created)
+	}
+
+	if _, err := NewGitLabStore(GitLabOptions{Token: "token"}); err == nil {
+		t.Error("Expected error without project or group")
+	}
+}
@@ -0,0 +1,125 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultHerokuAPIURL is the Heroku Platform API used when no URL is configured
+const DefaultHerokuAPIURL = "https://api.heroku.com"
+
+// HerokuOptions configures a HerokuStore
+type HerokuOptions struct {
+	APIURL     string // Platform API URL (defaults to DefaultHerokuAPIURL)
+	Token      string // API key or OAuth token
+	App        string // Heroku app name or ID
+	HTTPClient *http.Client
+}
+
+// HerokuStore stores values as the config vars of a Heroku app. All changes
+// are applied with a single update, which creates a single release.
+type HerokuStore struct {
+	client *http.Client
+	url    string
+	token  string
+	app    string
+}
+
+// NewHerokuStore creates a HerokuStore
+func NewHerokuStore(opts HerokuOptions) (*HerokuStore, error) {
+	if opts.App == "" {
+		return nil, fmt.Errorf("an app is required for Heroku config vars")
+	}
+	if opts.Token == "" {
+		return nil, fmt.Errorf("a Heroku API key is required")
+	}
+
+	apiURL := opts.APIURL
+	if apiURL == "" {
+		apiURL = DefaultHerokuAPIURL
+	}
+
+	client := opts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &HerokuStore{
+		client: client,
+		url:    strings.TrimSuffix(apiURL, "/") + "/apps/" + url.PathEscape(opts.App) + "/config-vars",
+		token:  opts.Token,
+		app:    opts.App,
+	}, nil
+}
+
+// Values returns the config vars of the app
+func (s *HerokuStore) Values(ctx context.Context) (map[string]string, error) {
+	values := make(map[string]string)
+	if err := s.do(ctx, http.MethodGet, nil, &values); err != nil {
+		return nil, fmt.Errorf("failed to read Heroku config vars of %s: %w", s.app, err)
+	}
+	return values, nil
+}
+
+// Release sets and removes config vars in a single update. Heroku removes
+// the config vars that are set to null.
+func (s *HerokuStore) Release(ctx context.Context, set map[string]string, remove []string) error {
+	update := make(map[string]*string, len(set)+len(remove))
+	for key, value := range set {
+		update[key] = &value
+	}
+	for _, key := range remove {
+		update[key] = nil
+	}
+
+	if err := s.do(ctx, http.MethodPatch, update, nil); err != nil {
+		return fmt.Errorf("failed to update Heroku config vars of %s: %w", s.app, err)
+	}
+	return nil
+}
+
+// do sends an authenticated request to the config vars endpoint, decoding
+// the response into result if it's set
+func (s *HerokuStore) do(ctx context.Context, method string, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.url, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.heroku+json; version=3")
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Heroku request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("Heroku API returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	if result != nil {
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return fmt.Errorf("failed to parse Heroku response: %w", err)
+		}
+	}
+	return nil
+}
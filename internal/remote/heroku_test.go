@@ -0,0 +1,65 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestHerokuStore(t *testing.T) {
+	ctx := context.Background()
+	configVars := map[string]string{"PORT": "3000", "OLD": "x"}
+
+	var updates []map[string]*string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer key" || r.URL.Path != "/apps/my-api/config-vars" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodPatch {
+			var update map[string]*string
+			json.NewDecoder(r.Body).Decode(&update)
+			updates = append(updates, update)
+			for key, value := range update {
+				if value == nil {
+					delete(configVars, key)
+				} else {
+					configVars[key] = *value
+				}
+			}
+		}
+		json.NewEncoder(w).Encode(configVars)
+	}))
+	defer server.Close()
+
+	store, err := NewHerokuStore(HerokuOptions{APIURL: server.URL, Token: "key", App: "my-api"})
+	if err != nil {
+		t.Fatalf("NewHerokuStore failed: %v", err)
+	}
+
+	values, err := store.Values(ctx)
+	if err != nil {
+		t.Fatalf("Values failed: %v", err)
+	}
+	if expected := map[string]string{"PORT": "3000", "OLD": "x"}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v, got %v", expected, values)
+	}
+
+	// Every change goes into a single update, and so a single release
+	if err := store.Release(ctx, map[string]string{"PORT": "8080", "HOST": "api"}, []string{"OLD"}); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if len(updates) != 1 {
+		t.Fatalf("Expected a single update, got %d", len(updates))
+	}
+	if expected := map[string]string{"PORT": "8080", "HOST": "api"}; !reflect.DeepEqual(configVars, expected) {
+		t.Errorf("Expected %v, got %v", expected, configVars)
+	}
+
+	if _, err := NewHerokuStore(HerokuOptions{App: "my-api"}); err == nil {
+		t.Error("Expected an error without a token")
+	}
+}
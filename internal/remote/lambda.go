@@ -0,0 +1,128 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// LambdaEnvironmentLimit is the most bytes the environment variables of a
+// Lambda function can hold, counting keys and values
+const LambdaEnvironmentLimit = 4096
+
+// lambdaAPI is the subset of the Lambda client used by LambdaStore
+type lambdaAPI interface {
+	GetFunctionConfiguration(ctx context.Context, params *lambda.GetFunctionConfigurationInput, optFns ...func(*lambda.Options)) (*lambda.GetFunctionConfigurationOutput, error)
+	UpdateFunctionConfiguration(ctx context.Context, params *lambda.UpdateFunctionConfigurationInput, optFns ...func(*lambda.Options)) (*lambda.UpdateFunctionConfigurationOutput, error)
+}
+
+// LambdaOptions configures a LambdaStore
+type LambdaOptions struct {
+	FunctionName string // Function name or ARN
+	Region       string // AWS region (defaults to the SDK's region resolution)
+}
+
+// LambdaStore stores values as the environment variables of an AWS Lambda
+// function. All changes are applied with a single configuration update,
+// which uses the revision read by Values, so it fails instead of
+// overwriting a configuration changed concurrently by someone else.
+type LambdaStore struct {
+	client   lambdaAPI
+	function string
+	current  map[string]string
+	revision *string
+	read     bool
+}
+
+// NewLambdaStore creates a LambdaStore using the default AWS credential chain
+func NewLambdaStore(ctx context.Context, opts LambdaOptions) (*LambdaStore, error) {
+	var loadOpts []func(*awsconfig.LoadOptions) error
+	if opts.Region != "" {
+		loadOpts = append(loadOpts, awsconfig.WithRegion(opts.Region))
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, loadOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	return newLambdaStore(lambda.NewFromConfig(cfg), opts)
+}
+
+// newLambdaStore creates a LambdaStore with the given client
+func newLambdaStore(client lambdaAPI, opts LambdaOptions) (*LambdaStore, error) {
+	if opts.FunctionName == "" {
+		return nil, fmt.Errorf("a function name is required for Lambda")
+	}
+	return &LambdaStore{client: client, function: opts.FunctionName}, nil
+}
+
+// Values returns the environment variables of the function and records its
+// revision
+func (s *LambdaStore) Values(ctx context.Context) (map[string]string, error) {
+	output, err := s.client.GetFunctionConfiguration(ctx, &lambda.GetFunctionConfigurationInput{
+		FunctionName: aws.String(s.function),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Lambda function %s: %w", s.function, err)
+	}
+
+	s.current = make(map[string]string)
+	if output.Environment != nil {
+		maps.Copy(s.current, output.Environment.Variables)
+	}
+	s.revision = output.RevisionId
+	s.read = true
+
+	return maps.Clone(s.current), nil
+}
+
+// Release sets and removes environment variables in a single configuration
+// update, keeping the other variables. It fails if the function's
+// configuration has changed since Values was called.
+func (s *LambdaStore) Release(ctx context.Context, set map[string]string, remove []string) error {
+	if !s.read {
+		return fmt.Errorf("Lambda function %s must be read before it is updated", s.function)
+	}
+
+	variables := maps.Clone(s.current)
+	maps.Copy(variables, set)
+	for _, key := range remove {
+		delete(variables, key)
+	}
+
+	_, err := s.client.UpdateFunctionConfiguration(ctx, &lambda.UpdateFunctionConfigurationInput{
+		FunctionName: aws.String(s.function),
+		Environment:  &types.Environment{Variables: variables},
+		RevisionId:   s.revision,
+	})
+	var preconditionErr *types.PreconditionFailedException
+	var conflictErr *types.ResourceConflictException
+	switch {
+	case errors.As(err, &preconditionErr):
+		return fmt.Errorf("Lambda function %s was modified since it was read; re-run sync to review the new changes", s.function)
+	case errors.As(err, &conflictErr):
+		return fmt.Errorf("Lambda function %s is being updated; re-run sync when the update has finished: %w", s.function, err)
+	case err != nil:
+		return fmt.Errorf("failed to update Lambda function %s: %w", s.function, err)
+	}
+
+	s.current = variables
+	return nil
+}
+
+// LambdaEnvironmentSize returns the size of environment variables as counted
+// against LambdaEnvironmentLimit
+func LambdaEnvironmentSize(variables map[string]string) int {
+	size := 0
+	for key, value := range variables {
+		size += len(key) + len(value)
+	}
+	return size
+}
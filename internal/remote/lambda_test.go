@@ -0,0 +1,84 @@
+package remote
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/lambda/types"
+)
+
+// fakeLambda holds the environment of a single function and enforces
+// revision checks
+type fakeLambda struct {
+	variables map[string]string
+	revision  int
+}
+
+func (f *fakeLambda) revisionID() *string {
+	return aws.String(strings.Repeat("r", f.revision+1))
+}
+
+func (f *fakeLambda) GetFunctionConfiguration(ctx context.Context, params *lambda.GetFunctionConfigurationInput, optFns ...func(*lambda.Options)) (*lambda.GetFunctionConfigurationOutput, error) {
+	return &lambda.GetFunctionConfigurationOutput{
+		Environment: &types.EnvironmentResponse{Variables: f.variables},
+		RevisionId:  f.revisionID(),
+	}, nil
+}
+
+func (f *fakeLambda) UpdateFunctionConfiguration(ctx context.Context, params *lambda.UpdateFunctionConfigurationInput, optFns ...func(*lambda.Options)) (*lambda.UpdateFunctionConfigurationOutput, error) {
+	if aws.ToString(params.RevisionId) != aws.ToString(f.revisionID()) {
+		return nil, &types.PreconditionFailedException{Message: aws.String("revision mismatch")}
+	}
+	f.variables = params.Environment.Variables
+	f.revision++
+	return &lambda.UpdateFunctionConfigurationOutput{RevisionId: f.revisionID()}, nil
+}
+
+func TestLambdaStore(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeLambda{variables: map[string]string{"PORT": "3000", "OLD": "x", "DD_SITE": "datadoghq.com"}}
+
+	store, err := newLambdaStore(client, LambdaOptions{FunctionName: "api"})
+	if err != nil {
+		t.Fatalf("newLambdaStore failed: %v", err)
+	}
+
+	if err := store.Release(ctx, map[string]string{"PORT": "8080"}, nil); err == nil {
+		t.Fatal("Expected Release before Values to fail")
+	}
+
+	values, err := store.Values(ctx)
+	if err != nil {
+		t.Fatalf("Values failed: %v", err)
+	}
+	if !reflect.DeepEqual(values, client.variables) {
+		t.Errorf("Expected %v, got %v", client.variables, values)
+	}
+
+	// Variables that aren't changed or removed are kept
+	if err := store.Release(ctx, map[string]string{"PORT": "8080"}, []string{"OLD"}); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if expected := map[string]string{"PORT": "8080", "DD_SITE": "datadoghq.com"}; !reflect.DeepEqual(client.variables, expected) {
+		t.Errorf("Expected %v, got %v", expected, client.variables)
+	}
+
+	// Someone else updates the function after we read
+	if _, err := store.Values(ctx); err != nil {
+		t.Fatalf("Values failed: %v", err)
+	}
+	client.variables = map[string]string{"PORT": "4000"}
+	client.revision++
+
+	err = store.Release(ctx, map[string]string{"PORT": "5000"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "modified since it was read") {
+		t.Fatalf("Expected revision check failure, got %v", err)
+	}
+	if client.variables["PORT"] != "4000" {
+		t.Errorf("Concurrent update was clobbered: %v", client.variables)
+	}
+}
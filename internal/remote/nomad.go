@@ -0,0 +1,191 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultNomadAddress is the Nomad agent used when no address is configured
+const DefaultNomadAddress = "http://127.0.0.1:4646"
+
+// NomadVariableOptions configures a NomadVariableStore
+type NomadVariableOptions struct {
+	Address    string // Nomad HTTP address (defaults to DefaultNomadAddress)
+	Token      string // ACL token with write access to the variable
+	Namespace  string // Namespace of the variable (defaults to the default namespace)
+	Region     string // Region to write to (defaults to the agent's)
+	Path       string // Variable path, e.g. "nomad/jobs/api"
+	HTTPClient *http.Client
+}
+
+// nomadVariable is a variable as sent to and returned by the Nomad API
+type nomadVariable struct {
+	Namespace   string            `json:"Namespace,omitempty"`
+	Path        string            `json:"Path"`
+	Items       map[string]string `json:"Items"`
+	ModifyIndex uint64            `json:"ModifyIndex,omitempty"`
+}
+
+// NomadVariableStore stores all values as the items of a single Nomad
+// variable. Writes use check-and-set against the index read by Values, so a
+// write fails instead of overwriting a version written concurrently by
+// someone else.
+type NomadVariableStore struct {
+	client    *http.Client
+	url       string
+	token     string
+	namespace string
+	region    string
+	path      string
+	index     uint64
+	read      bool
+}
+
+// NewNomadVariableStore creates a NomadVariableStore
+func NewNomadVariableStore(opts NomadVariableOptions) (*NomadVariableStore, error) {
+	path := strings.Trim(opts.Path, "/")
+	if path == "" {
+		return nil, fmt.Errorf("a variable path is required for Nomad variables")
+	}
+
+	// NOMAD_ADDR is sometimes set without a scheme
+	address := opts.Address
+	if address == "" {
+		address = DefaultNomadAddress
+	}
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	client := opts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &NomadVariableStore{
+		client:    client,
+		url:       strings.TrimSuffix(address, "/") + "/v1/var/" + strings.Join(segments, "/"),
+		token:     opts.Token,
+		namespace: opts.Namespace,
+		region:    opts.Region,
+		path:      path,
+	}, nil
+}
+
+// Values returns the items of the variable and records its index for
+// check-and-set
+func (s *NomadVariableStore) Values(ctx context.Context) (map[string]string, error) {
+	values := make(map[string]string)
+
+	resp, err := s.do(ctx, http.MethodGet, url.Values{}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Nomad variable %s: %w", s.path, err)
+	}
+	defer resp.Body.Close()
+
+	// A check-and-set index of 0 only allows the write if the variable
+	// still doesn't exist
+	if resp.StatusCode == http.StatusNotFound {
+		s.index = 0
+		s.read = true
+		return values, nil
+	}
+
+	var variable nomadVariable
+	if err := json.NewDecoder(resp.Body).Decode(&variable); err != nil {
+		return nil, fmt.Errorf("failed to parse Nomad variable %s: %w", s.path, err)
+	}
+	s.index = variable.ModifyIndex
+	s.read = true
+
+	for key, value := range variable.Items {
+		values[key] = value
+	}
+	return values, nil
+}
+
+// Replace writes values as the items of the variable. It fails if the
+// variable has changed since Values was called.
+func (s *NomadVariableStore) Replace(ctx context.Context, values map[string]string) error {
+	if !s.read {
+		return fmt.Errorf("Nomad variable %s must be read before it is replaced", s.path)
+	}
+
+	body, err := json.Marshal(nomadVariable{Namespace: s.namespace, Path: s.path, Items: values})
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, url.Values{"cas": {strconv.FormatUint(s.index, 10)}}, body)
+	if err != nil {
+		return fmt.Errorf("failed to write Nomad variable %s: %w", s.path, err)
+	}
+	defer resp.Body.Close()
+
+	// A failed check-and-set is answered with a conflict and the current
+	// variable
+	if resp.StatusCode == http.StatusConflict {
+		return fmt.Errorf("Nomad variable %s was modified since it was read (expected index %d); re-run sync to review the new changes", s.path, s.index)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("failed to write Nomad variable %s: Nomad API returned %s", s.path, resp.Status)
+	}
+
+	var variable nomadVariable
+	if err := json.NewDecoder(resp.Body).Decode(&variable); err == nil {
+		s.index = variable.ModifyIndex
+	}
+	return nil
+}
+
+// do sends an authenticated request for the variable to the Nomad API. Not
+// found and conflict responses are returned for the caller to handle; other
+// failures are errors.
+func (s *NomadVariableStore) do(ctx context.Context, method string, query url.Values, body []byte) (*http.Response, error) {
+	if s.namespace != "" {
+		query.Set("namespace", s.namespace)
+	}
+	if s.region != "" {
+		query.Set("region", s.region)
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.url+"?"+query.Encode(), reader)
+	if err != nil {
+		return nil, err
+	}
+	if s.token != "" {
+		req.Header.Set("X-Nomad-Token", s.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Nomad request failed: %w", err)
+	}
+
+	if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusConflict {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("Nomad API returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	return resp, nil
+}
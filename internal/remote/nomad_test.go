@@ -0,0 +1,104 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeNomad serves a single variable and enforces check-and-set
+type fakeNomad struct {
+	variable *nomadVariable
+	index    uint64
+}
+
+func (f *fakeNomad) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Nomad-Token") != "token" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if r.URL.Path != "/v1/var/nomad/jobs/api" || r.URL.Query().Get("namespace") != "prod" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if f.variable == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(f.variable)
+	case http.MethodPut:
+		cas, _ := strconv.ParseUint(r.URL.Query().Get("cas"), 10, 64)
+		var current uint64
+		if f.variable != nil {
+			current = f.variable.ModifyIndex
+		}
+		if cas != current {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(f.variable)
+			return
+		}
+		var variable nomadVariable
+		json.NewDecoder(r.Body).Decode(&variable)
+		f.index++
+		variable.ModifyIndex = f.index
+		f.variable = &variable
+		json.NewEncoder(w).Encode(f.variable)
+	}
+}
+
+func TestNomadVariableStore(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeNomad{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	store, err := NewNomadVariableStore(NomadVariableOptions{Address: server.URL, Token: "token", Namespace: "prod", Path: "/nomad/jobs/api/"})
+	if err != nil {
+		t.Fatalf("NewNomadVariableStore failed: %v", err)
+	}
+
+	if err := store.Replace(ctx, map[string]string{"PORT": "3000"}); err == nil {
+		t.Fatal("Expected Replace before Values to fail")
+	}
+
+	// A missing variable reads as empty and can be created
+	values, err := store.Values(ctx)
+	if err != nil || len(values) != 0 {
+		t.Fatalf("Expected empty values for missing variable, got %v (err: %v)", values, err)
+	}
+	if err := store.Replace(ctx, map[string]string{"PORT": "3000"}); err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+	if fake.variable.Path != "nomad/jobs/api" || fake.variable.Namespace != "prod" {
+		t.Errorf("Unexpected variable written: %+v", fake.variable)
+	}
+
+	values, err = store.Values(ctx)
+	if err != nil {
+		t.Fatalf("Values failed: %v", err)
+	}
+	if expected := map[string]string{"PORT": "3000"}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v, got %v", expected, values)
+	}
+
+	// Someone else writes a new version after we read
+	fake.index++
+	fake.variable.ModifyIndex = fake.index
+	fake.variable.Items = map[string]string{"PORT": "4000"}
+
+	err = store.Replace(ctx, map[string]string{"PORT": "5000"})
+	if err == nil || !strings.Contains(err.Error(), "modified since it was read") {
+		t.Fatalf("Expected check-and-set failure, got %v", err)
+	}
+	if fake.variable.Items["PORT"] != "4000" {
+		t.Errorf("Concurrent write was clobbered: %v", fake.variable.Items)
+	}
+}
@@ -0,0 +1,64 @@
+// Package remote pushes resolved config values to external secret stores.
+package remote
+
+import "context"
+
+// Store is an external secret store that resolved config can be synced to
+type Store interface {
+	// Values returns the values currently in the store, keyed by config key
+	Values(ctx context.Context) (map[string]string, error)
+}
+
+// KeyWriter is a Store that holds one entry per key, written individually
+type KeyWriter interface {
+	Store
+
+	// Put creates or updates a single value
+	Put(ctx context.Context, key, value string) error
+}
+
+// Pruner is a KeyWriter that can delete values that are no longer in the config
+type Pruner interface {
+	KeyWriter
+
+	// Delete removes a single value
+	Delete(ctx context.Context, key string) error
+}
+
+// Replacer is a Store that holds all values in a single secret, which is
+// replaced as a whole
+type Replacer interface {
+	Store
+
+	// Replace overwrites the stored values with values
+	Replace(ctx context.Context, values map[string]string) error
+}
+
+// Releaser is a Store on a platform where every change rolls out a new
+// release of an app, so all changes are applied together in a single release
+type Releaser interface {
+	Store
+
+	// Release sets the values in set and removes the keys in remove
+	Release(ctx context.Context, set map[string]string, remove []string) error
+}
+
+// WriteOnly is a Store whose values can't be read back, only its keys.
+// Values returns the keys with empty values, and a sync writes every key as
+// it can't tell which ones changed, unless the store is a Digester.
+type WriteOnly interface {
+	Store
+
+	// WriteOnly marks the store as write-only
+	WriteOnly()
+}
+
+// Digester is a WriteOnly store that returns a digest of each value in place
+// of the value, so a sync only writes the keys whose digests differ
+type Digester interface {
+	WriteOnly
+
+	// MatchesDigest reports whether digest, as returned by Values, is the
+	// digest of value
+	MatchesDigest(digest, value string) bool
+}
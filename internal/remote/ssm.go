@@ -0,0 +1,136 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// ssmAPI is the subset of the SSM client used by SSMStore
+type ssmAPI interface {
+	ssm.GetParametersByPathAPIClient
+	PutParameter(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error)
+	AddTagsToResource(ctx context.Context, params *ssm.AddTagsToResourceInput, optFns ...func(*ssm.Options)) (*ssm.AddTagsToResourceOutput, error)
+}
+
+// SSMOptions configures an SSMStore
+type SSMOptions struct {
+	Path     string            // Parameter path prefix, e.g. /app/prod/
+	KMSKeyID string            // KMS key for SecureString parameters (defaults to the account's aws/ssm key)
+	Region   string            // AWS region (defaults to the SDK's region resolution)
+	Tags     map[string]string // Tags applied to every parameter written
+}
+
+// SSMStore stores values as SecureString parameters under a path in AWS SSM
+// Parameter Store, one parameter per key
+type SSMStore struct {
+	client   ssmAPI
+	prefix   string
+	kmsKeyID string
+	tags     []types.Tag
+}
+
+// NewSSMStore creates an SSMStore using the default AWS credential chain
+func NewSSMStore(ctx context.Context, opts SSMOptions) (*SSMStore, error) {
+	var loadOpts []func(*awsconfig.LoadOptions) error
+	if opts.Region != "" {
+		loadOpts = append(loadOpts, awsconfig.WithRegion(opts.Region))
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, loadOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	return newSSMStore(ssm.NewFromConfig(cfg), opts)
+}
+
+// newSSMStore creates an SSMStore with the given client
+func newSSMStore(client ssmAPI, opts SSMOptions) (*SSMStore, error) {
+	if !strings.HasPrefix(opts.Path, "/") || opts.Path == "/" {
+		return nil, fmt.Errorf("invalid SSM path %q: must start with / and name a hierarchy, e.g. /app/prod/", opts.Path)
+	}
+
+	tagKeys := make([]string, 0, len(opts.Tags))
+	for key := range opts.Tags {
+		tagKeys = append(tagKeys, key)
+	}
+	sort.Strings(tagKeys)
+
+	tags := make([]types.Tag, 0, len(tagKeys))
+	for _, key := range tagKeys {
+		tags = append(tags, types.Tag{Key: aws.String(key), Value: aws.String(opts.Tags[key])})
+	}
+
+	return &SSMStore{
+		client:   client,
+		prefix:   strings.TrimSuffix(opts.Path, "/") + "/",
+		kmsKeyID: opts.KMSKeyID,
+		tags:     tags,
+	}, nil
+}
+
+// Values returns the decrypted values of the parameters directly under the path
+func (s *SSMStore) Values(ctx context.Context) (map[string]string, error) {
+	values := make(map[string]string)
+
+	paginator := ssm.NewGetParametersByPathPaginator(s.client, &ssm.GetParametersByPathInput{
+		Path:           aws.String(strings.TrimSuffix(s.prefix, "/")),
+		WithDecryption: aws.Bool(true),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SSM parameters under %s: %w", s.prefix, err)
+		}
+		for _, param := range page.Parameters {
+			key := strings.TrimPrefix(aws.ToString(param.Name), s.prefix)
+			values[key] = aws.ToString(param.Value)
+		}
+	}
+
+	return values, nil
+}
+
+// ParameterName returns the name of the parameter holding key
+func (s *SSMStore) ParameterName(key string) string {
+	return s.prefix + key
+}
+
+// Put writes a value as a SecureString parameter and tags it
+func (s *SSMStore) Put(ctx context.Context, key, value string) error {
+	name := s.ParameterName(key)
+
+	input := &ssm.PutParameterInput{
+		Name:      aws.String(name),
+		Value:     aws.String(value),
+		Type:      types.ParameterTypeSecureString,
+		Overwrite: aws.Bool(true),
+	}
+	if s.kmsKeyID != "" {
+		input.KeyId = aws.String(s.kmsKeyID)
+	}
+
+	if _, err := s.client.PutParameter(ctx, input); err != nil {
+		return fmt.Errorf("failed to put SSM parameter %s: %w", name, err)
+	}
+
+	// Tags can't be passed to PutParameter when overwriting, so apply them separately
+	if len(s.tags) > 0 {
+		if _, err := s.client.AddTagsToResource(ctx, &ssm.AddTagsToResourceInput{
+			ResourceType: types.ResourceTypeForTaggingParameter,
+			ResourceId:   aws.String(name),
+			Tags:         s.tags,
+		}); err != nil {
+			return fmt.Errorf("failed to tag SSM parameter %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package remote
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// fakeSSM is an in-memory SSM client
+type fakeSSM struct {
+	params map[string]*ssm.PutParameterInput
+	tags   map[string][]types.Tag
+}
+
+func newFakeSSM() *fakeSSM {
+	return &fakeSSM{
+		params: make(map[string]*ssm.PutParameterInput),
+		tags:   make(map[string][]types.Tag),
+	}
+}
+
+func (f *fakeSSM) GetParametersByPath(ctx context.Context, params *ssm.GetParametersByPathInput, optFns ...func(*ssm.Options)) (*ssm.GetParametersByPathOutput, error) {
+	var result []types.Parameter
+	for name, param := range f.params {
+		if len(name) > len(*params.Path) && name[:len(*params.Path)+1] == *params.Path+"/" {
+			result = append(result, types.Parameter{Name: aws.String(name), Value: param.Value})
+		}
+	}
+	return &ssm.GetParametersByPathOutput{Parameters: result}, nil
+}
+
+func (f *fakeSSM) PutParameter(ctx context.Context, params *ssm.PutParameterInput, optFns ...func(*ssm.Options)) (*ssm.PutParameterOutput, error) {
+	f.params[*params.Name] = params
+	return &ssm.PutParameterOutput{}, nil
+}
+
+func (f *fakeSSM) AddTagsToResource(ctx context.Context, params *ssm.AddTagsToResourceInput, optFns ...func(*ssm.Options)) (*ssm.AddTagsToResourceOutput, error) {
+	f.tags[*params.ResourceId] = params.Tags
+	return &ssm.AddTagsToResourceOutput{}, nil
+}
+
+func TestSSMStore(t *testing.T) {
+	ctx := context.Background()
+	client := newFakeSSM()
+	client.params["/app/prod/EXISTING"] = &ssm.PutParameterInput{Value: aws.String("old")}
+	client.params["/app/staging/OTHER"] = &ssm.PutParameterInput{Value: aws.String("other")}
+
+	store, err := newSSMStore(client, SSMOptions{
+		Path:     "/app/prod",
+		KMSKeyID: "alias/puff",
+		Tags:     map[string]string{"env": "prod", "app": "api"},
+	})
+	if err != nil {
+		t.Fatalf("newSSMStore failed: %v", err)
+	}
+
+	values, err := store.Values(ctx)
+	if err != nil {
+		t.Fatalf("Values failed: %v", err)
+	}
+	if expected := map[string]string{"EXISTING": "old"}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v, got %v", expected, values)
+	}
+
+	if err := store.Put(ctx, "DB_PASSWORD", "secret"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	param := client.params["/app/prod/DB_PASSWORD"]
+	if param == nil {
+		t.Fatal("Expected parameter to be written under the path")
+	}
+	if param.Type != types.ParameterTypeSecureString || aws.ToString(param.KeyId) != "alias/puff" || !aws.ToBool(param.Overwrite) {
+		t.Errorf("Unexpected parameter input: %+v", param)
+	}
+
+	expectedTags := []types.Tag{
+		{Key: aws.String("app"), Value: aws.String("api")},
+		{Key: aws.String("env"), Value: aws.String("prod")},
+	}
+	if !reflect.DeepEqual(client.tags["/app/prod/DB_PASSWORD"], expectedTags) {
+		t.Errorf("Expected tags %v, got %v", expectedTags, client.tags["/app/prod/DB_PASSWORD"])
+	}
+
+	if _, err := newSSMStore(client, SSMOptions{Path: "app/prod"}); err == nil {
+		t.Error("Expected error for relative path")
+	}
+}
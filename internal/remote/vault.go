@@ -0,0 +1,117 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+// VaultKVOptions configures a VaultKVStore
+type VaultKVOptions struct {
+	Address string // Vault address (defaults to VAULT_ADDR)
+	Mount   string // KV v2 mount path, e.g. "kv"
+	Path    string // Secret path within the mount, e.g. "apps/api/prod"
+}
+
+// VaultKVStore stores all values as a single HashiCorp Vault KV v2 secret.
+// Writes use check-and-set against the version read by Values, so a write
+// fails instead of overwriting a version written concurrently by someone else.
+type VaultKVStore struct {
+	kv      *vault.KVv2
+	path    string
+	version int
+	read    bool
+}
+
+// NewVaultKVStore creates a VaultKVStore. The token and namespace are read
+// from VAULT_TOKEN and VAULT_NAMESPACE.
+func NewVaultKVStore(opts VaultKVOptions) (*VaultKVStore, error) {
+	cfg := vault.DefaultConfig()
+	if cfg.Error != nil {
+		return nil, fmt.Errorf("failed to load Vault config: %w", cfg.Error)
+	}
+	if opts.Address != "" {
+		cfg.Address = opts.Address
+	}
+
+	client, err := vault.NewClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Vault client: %w", err)
+	}
+
+	mount := strings.Trim(opts.Mount, "/")
+	path := strings.Trim(opts.Path, "/")
+	if mount == "" || path == "" {
+		return nil, fmt.Errorf("mount and path are required for Vault KV")
+	}
+
+	return &VaultKVStore{
+		kv:   client.KVv2(mount),
+		path: path,
+	}, nil
+}
+
+// Values returns the data of the latest version of the secret and records
+// its version for check-and-set
+func (s *VaultKVStore) Values(ctx context.Context) (map[string]string, error) {
+	values := make(map[string]string)
+
+	secret, err := s.kv.Get(ctx, s.path)
+	if errors.Is(err, vault.ErrSecretNotFound) {
+		// A check-and-set version of 0 only allows the write if the secret
+		// still doesn't exist
+		s.version = 0
+		s.read = true
+		return values, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Vault secret %s: %w", s.path, err)
+	}
+
+	if secret.VersionMetadata != nil {
+		s.version = secret.VersionMetadata.Version
+	}
+	s.read = true
+
+	for key, value := range secret.Data {
+		if str, ok := value.(string); ok {
+			values[key] = str
+		} else {
+			values[key] = fmt.Sprintf("%v", value)
+		}
+	}
+
+	return values, nil
+}
+
+// Replace writes values as a new version of the secret. It fails if the
+// secret has changed since Values was called.
+func (s *VaultKVStore) Replace(ctx context.Context, values map[string]string) error {
+	if !s.read {
+		return fmt.Errorf("secret %s must be read before it is replaced", s.path)
+	}
+
+	data := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		data[key] = value
+	}
+
+	secret, err := s.kv.Put(ctx, s.path, data, vault.WithCheckAndSet(s.version))
+	if err != nil {
+		var respErr *vault.ResponseError
+		if errors.As(err, &respErr) && respErr.StatusCode == http.StatusBadRequest && strings.Contains(err.Error(), "check-and-set") {
+			return fmt.Errorf("secret %s was modified since it was read (expected version %d); re-run sync to review the new changes", s.path, s.version)
+		}
+		return fmt.Errorf("failed to write Vault secret %s: %w", s.path, err)
+	}
+
+	if secret.VersionMetadata != nil {
+		s.version = secret.VersionMetadata.Version
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeVault serves a single KV v2 secret and enforces check-and-set
+type fakeVault struct {
+	data    map[string]interface{}
+	version int
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.URL.Path != "/v1/kv/data/apps/api" {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"errors":[]}`)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if f.version == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors":[]}`)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"data":     f.data,
+				"metadata": map[string]interface{}{"version": f.version},
+			},
+		})
+	case http.MethodPut, http.MethodPost:
+		var body struct {
+			Data    map[string]interface{} `json:"data"`
+			Options struct {
+				CAS *int `json:"cas"`
+			} `json:"options"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Options.CAS == nil || *body.Options.CAS != f.version {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"errors":["check-and-set parameter did not match the current version"]}`)
+			return
+		}
+		f.data = body.Data
+		f.version++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"version": f.version},
+		})
+	}
+}
+
+func TestVaultKVStore(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeVault{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	t.Setenv("VAULT_TOKEN", "test")
+
+	store, err := NewVaultKVStore(VaultKVOptions{Address: server.URL, Mount: "kv", Path: "/apps/api/"})
+	if err != nil {
+		t.Fatalf("NewVaultKVStore failed: %v", err)
+	}
+
+	// A missing secret reads as empty and can be created
+	values, err := store.Values(ctx)
+	if err != nil || len(values) != 0 {
+		t.Fatalf("Expected empty values for missing secret, got %v (err: %v)", values, err)
+	}
+	if err := store.Replace(ctx, map[string]string{"PORT": "3000"}); err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+
+	values, err = store.Values(ctx)
+	if err != nil {
+		t.Fatalf("Values failed: %v", err)
+	}
+	if expected := map[string]string{"PORT": "3000"}; !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v, got %v", expected, values)
+	}
+
+	// Someone else writes a new version after we read
+	fake.data = map[string]interface{}{"PORT": "4000"}
+	fake.version++
+
+	err = store.Replace(ctx, map[string]string{"PORT": "5000"})
+	if err == nil || !strings.Contains(err.Error(), "modified since it was read") {
+		t.Fatalf("Expected check-and-set failure, got %v", err)
+	}
+	if fake.data["PORT"] != "4000" {
+		t.Errorf("Concurrent write was clobbered: %v", fake.data)
+	}
+}
@@ -0,0 +1,124 @@
+// Package resolve loads configs and resolves the template variables in them,
+// including ${app:NAME:KEY} references to other apps
+package resolve
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/templating"
+)
+
+// Config loads and resolves the config for a context
+func Config(ctx config.LoadContext) (map[string]interface{}, error) {
+	return newAppResolver(ctx).resolve(ctx.App)
+}
+
+// Loaded resolves a config already loaded for ctx
+func Loaded(ctx config.LoadContext, cfg *config.Config) (map[string]interface{}, error) {
+	apps := newAppResolver(ctx)
+	apps.loading[ctx.App] = true
+	resolved, err := apps.newResolver(cfg).Resolve()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve templates: %w", err)
+	}
+	return resolved, nil
+}
+
+// Explain resolves a single key of a config already loaded for ctx,
+// recording each substitution
+func Explain(ctx config.LoadContext, cfg *config.Config, key string) (interface{}, []templating.Step, error) {
+	apps := newAppResolver(ctx)
+	apps.loading[ctx.App] = true
+	return apps.newResolver(cfg).Explain(key)
+}
+
+// appResolver resolves apps within one env and target, loading other apps'
+// file chains on demand for ${app:NAME:KEY} references
+type appResolver struct {
+	ctx      config.LoadContext
+	resolved map[string]map[string]interface{}
+	loading  map[string]bool // Apps currently being resolved, to detect cycles
+}
+
+func newAppResolver(ctx config.LoadContext) *appResolver {
+	// Apps referenced with ${app:...} share files such as base/shared.yml,
+	// so decrypt them once
+	if ctx.Cache == nil {
+		ctx.Cache = config.NewFileCache()
+	}
+	return &appResolver{
+		ctx:      ctx,
+		resolved: make(map[string]map[string]interface{}),
+		loading:  make(map[string]bool),
+	}
+}
+
+// resolve loads and resolves the config for an app, at most once per app
+func (a *appResolver) resolve(app string) (map[string]interface{}, error) {
+	if resolved, ok := a.resolved[app]; ok {
+		return resolved, nil
+	}
+	if a.loading[app] {
+		return nil, fmt.Errorf("circular app reference detected for app: %s", app)
+	}
+	a.loading[app] = true
+	defer delete(a.loading, app)
+
+	ctx := a.ctx
+	ctx.App = app
+
+	// Load configuration
+	cfg, err := config.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if app != a.ctx.App {
+		found, err := hasAppFile(cfg, ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, fmt.Errorf("no config files found for app: %s", app)
+		}
+	}
+
+	// Resolve template variables
+	resolved, err := a.newResolver(cfg).Resolve()
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve templates: %w", err)
+	}
+
+	a.resolved[app] = resolved
+	return resolved, nil
+}
+
+// newResolver returns a template resolver for a loaded config that looks up
+// ${env:NAME} and ${app:NAME:KEY} references as the context asks
+func (a *appResolver) newResolver(cfg *config.Config) *templating.Resolver {
+	resolver := templating.NewResolver(cfg.Values)
+	if a.ctx.NoHostEnv {
+		resolver.SetHostEnv(nil)
+	} else if a.ctx.LookupHostEnv != nil {
+		resolver.SetHostEnv(a.ctx.LookupHostEnv)
+	}
+	resolver.SetAppLookup(a.resolve)
+	return resolver
+}
+
+// hasAppFile reports whether any of the files a config was loaded from
+// belongs to the app of ctx, rather than being shared
+func hasAppFile(cfg *config.Config, ctx config.LoadContext) (bool, error) {
+	ctx.App = ""
+	sharedFiles, err := config.Chain(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, file := range cfg.Files() {
+		if !slices.Contains(sharedFiles, file) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,144 @@
+// Package safefile writes files atomically and serializes changes to them
+// with advisory locks, so concurrent puff invocations, such as CI jobs
+// fanned out over the same checkout, neither lose writes nor leave partial
+// files behind.
+package safefile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Timeout is how long Lock waits for another process to release a lock
+var Timeout = 30 * time.Second
+
+// pollInterval is how often Lock retries a held lock
+const pollInterval = 50 * time.Millisecond
+
+// Write writes data to a temporary file in the same directory and renames it
+// over path, so readers see either the old or the new file, never a partial
+// one
+func Write(path string, data []byte, perm os.FileMode) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmpFile.Chmod(perm); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to set file mode: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace file: %w", err)
+	}
+	return nil
+}
+
+// Lock holds advisory locks on one or more files
+type Lock struct {
+	files []*os.File
+}
+
+// LockFile returns the lock file guarding path: a hidden file beside it,
+// such as .api.yml.lock for api.yml
+func LockFile(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".lock")
+}
+
+// Acquire locks the given files for a read-modify-write, waiting up to
+// Timeout for other processes holding them. Files are locked in path order,
+// so processes locking overlapping sets of files can't deadlock. Directories
+// of files that don't exist yet are created.
+func Acquire(paths ...string) (*Lock, error) {
+	sorted := make([]string, 0, len(paths))
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[abs] {
+			seen[abs] = true
+			sorted = append(sorted, abs)
+		}
+	}
+	sort.Strings(sorted)
+
+	lock := &Lock{}
+	for _, path := range sorted {
+		file, err := lockFile(path)
+		if err != nil {
+			lock.Release()
+			return nil, err
+		}
+		lock.files = append(lock.files, file)
+	}
+	return lock, nil
+}
+
+// Release unlocks the files and removes their lock files
+func (l *Lock) Release() error {
+	var firstErr error
+	for i := len(l.files) - 1; i >= 0; i-- {
+		// Remove the lock file while still holding it; a process waiting on
+		// the removed file notices and retries on a new one
+		os.Remove(l.files[i].Name())
+		if err := l.files[i].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	l.files = nil
+	return firstErr
+}
+
+// lockFile takes the lock guarding path, retrying until Timeout
+func lockFile(path string) (*os.File, error) {
+	name := LockFile(path)
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	deadline := time.Now().Add(Timeout)
+	for {
+		file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open lock file: %w", err)
+		}
+		locked, err := tryLock(file)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if locked {
+			// The lock is only good if the previous holder didn't remove
+			// the file before we locked it
+			if held, err := file.Stat(); err == nil {
+				if current, err := os.Stat(name); err == nil && os.SameFile(held, current) {
+					return file, nil
+				}
+			}
+		}
+		file.Close()
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for another puff process to finish with %s (remove %s if no process is running)", path, name)
+		}
+		time.Sleep(pollInterval)
+	}
+}
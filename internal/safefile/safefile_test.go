@@ -0,0 +1,98 @@
+package safefile
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "api.yml")
+	os.WriteFile(path, []byte("old"), 0600)
+
+	if err := Write(path, []byte("new"), 0644); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "new" {
+		t.Errorf("Expected new content, got %q (%v)", data, err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("Expected mode 0644, got %v (%v)", info.Mode().Perm(), err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected no temporary files to be left behind, got %v", entries)
+	}
+}
+
+func TestAcquire(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dev", "api.yml")
+	defer func(timeout time.Duration) { Timeout = timeout }(Timeout)
+	Timeout = 200 * time.Millisecond
+
+	lock, err := Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	if _, err := os.Stat(LockFile(path)); err != nil {
+		t.Errorf("Expected a lock file beside %s: %v", path, err)
+	}
+
+	// A held lock times out, even when taken together with other files
+	if _, err := Acquire(filepath.Join(dir, "base", "shared.yml"), path); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected a timeout while the lock is held, got %v", err)
+	}
+	if _, err := os.Stat(LockFile(filepath.Join(dir, "base", "shared.yml"))); !os.IsNotExist(err) {
+		t.Error("Expected locks taken before the timeout to be released")
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if _, err := os.Stat(LockFile(path)); !os.IsNotExist(err) {
+		t.Error("Expected the lock file to be removed on release")
+	}
+	lock, err = Acquire(path)
+	if err != nil {
+		t.Fatalf("Expected the lock to be free after release: %v", err)
+	}
+	lock.Release()
+}
+
+func TestAcquireSerializesUpdates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "counter")
+	Write(path, []byte("0"), 0600)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				lock, err := Acquire(path)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				data, _ := os.ReadFile(path)
+				n, _ := strconv.Atoi(string(data))
+				Write(path, []byte(strconv.Itoa(n+1)), 0600)
+				lock.Release()
+			}
+		}()
+	}
+	wg.Wait()
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "80" {
+		t.Errorf("Expected 80 increments, got %s", data)
+	}
+}
@@ -0,0 +1,215 @@
+// Package scan finds secrets that were written in plain text, using
+// patterns for well-known credential formats and the entropy of values
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Severity is how likely a finding is to be a live secret, and how bad
+// leaking it would be
+type Severity string
+
+// Severities, from least to most severe
+const (
+	SeverityLow      Severity = "low"
+	SeverityMedium   Severity = "medium"
+	SeverityHigh     Severity = "high"
+	SeverityCritical Severity = "critical"
+)
+
+// severityRanks orders the severities
+var severityRanks = map[Severity]int{SeverityLow: 1, SeverityMedium: 2, SeverityHigh: 3, SeverityCritical: 4}
+
+// ParseSeverity parses a severity name
+func ParseSeverity(name string) (Severity, error) {
+	severity := Severity(strings.ToLower(name))
+	if severityRanks[severity] == 0 {
+		return "", fmt.Errorf("invalid severity %q (use low, medium, high, or critical)", name)
+	}
+	return severity, nil
+}
+
+// AtLeast reports whether s is at least as severe as min
+func (s Severity) AtLeast(min Severity) bool {
+	return severityRanks[s] >= severityRanks[min]
+}
+
+// AllowComment on a line suppresses findings on it
+const AllowComment = "puff:allow"
+
+// Finding is a suspected secret
+type Finding struct {
+	File     string   `json:"file"`
+	Line     int      `json:"line"`
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	// Match is the suspected secret, redacted
+	Match string `json:"match"`
+}
+
+// rule detects one kind of secret. If group is set, that submatch is the
+// secret; if minEntropy is set, secrets with lower entropy are ignored.
+type rule struct {
+	id         string
+	severity   Severity
+	pattern    *regexp.Regexp
+	group      int
+	minEntropy float64
+	// check, if set, must accept the secret
+	check func(string) bool
+}
+
+// rules are applied to each line in order; a span of a line is reported by
+// the first rule that matches it
+var rules = []rule{
+	{id: "private-key", severity: SeverityCritical, pattern: regexp.MustCompile(`-----BEGIN (?:[A-Z]+ )*PRIVATE KEY(?: BLOCK)?-----`)},
+	{id: "age-secret-key", severity: SeverityCritical, pattern: regexp.MustCompile(`AGE-SECRET-KEY-1[0-9A-Z]{58}`)},
+	{id: "aws-access-key-id", severity: SeverityHigh, pattern: regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[A-Z0-9]{16}\b`)},
+	{id: "aws-secret-access-key", severity: SeverityHigh, pattern: regexp.MustCompile(`(?i)aws.{0,20}?(?:secret|sk).{0,20}?[:=]\s*["']?([A-Za-z0-9/+]{40})\b`), group: 1, minEntropy: 4},
+	{id: "github-token", severity: SeverityHigh, pattern: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{60,})\b`)},
+	{id: "slack-token", severity: SeverityHigh, pattern: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+	{id: "jwt", severity: SeverityMedium, pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+	{
+		id:         "secret-assignment",
+		severity:   SeverityMedium,
+		pattern:    regexp.MustCompile(`(?i)(?:password|passwd|secret|token|api[_-]?key|access[_-]?key|private[_-]?key|credentials?)["']?\s*[:=]\s*["']?([^\s"',;]{8,})`),
+		group:      1,
+		minEntropy: 3,
+		check:      notPlaceholder,
+	},
+	{
+		id:         "high-entropy-string",
+		severity:   SeverityLow,
+		pattern:    regexp.MustCompile(`[A-Za-z0-9+/_=-]{32,}`),
+		minEntropy: 4.5,
+		check:      mixedCharacters,
+	},
+}
+
+// sopsValueRegex matches values encrypted by SOPS, which are never secrets
+var sopsValueRegex = regexp.MustCompile(`ENC\[[^\]]*\]`)
+
+// Scan returns the suspected secrets in a file's contents, in line order.
+// file is only used to fill in the findings.
+func Scan(file string, data []byte) []Finding {
+	var findings []Finding
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if strings.Contains(line, AllowComment) {
+			continue
+		}
+		line = sopsValueRegex.ReplaceAllString(line, "")
+
+		var claimed [][2]int
+		for _, r := range rules {
+			for _, match := range r.pattern.FindAllStringSubmatchIndex(line, -1) {
+				start, end := match[2*r.group], match[2*r.group+1]
+				if start < 0 || overlaps(claimed, start, end) {
+					continue
+				}
+				secret := line[start:end]
+				if r.minEntropy > 0 && Entropy(secret) < r.minEntropy {
+					continue
+				}
+				if r.check != nil && !r.check(secret) {
+					continue
+				}
+				claimed = append(claimed, [2]int{match[0], match[1]})
+				findings = append(findings, Finding{
+					File:     file,
+					Line:     lineNumber,
+					Rule:     r.id,
+					Severity: r.severity,
+					Match:    redact(secret),
+				})
+			}
+		}
+	}
+
+	return findings
+}
+
+// IsBinary reports whether data looks like a binary file, which isn't
+// scanned
+func IsBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// Entropy returns the Shannon entropy of s in bits per character
+func Entropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	total := 0
+	for _, r := range s {
+		counts[r]++
+		total++
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// overlaps reports whether the span from start to end overlaps a claimed span
+func overlaps(claimed [][2]int, start, end int) bool {
+	for _, span := range claimed {
+		if start < span[1] && end > span[0] {
+			return true
+		}
+	}
+	return false
+}
+
+// notPlaceholder rejects values that refer to a secret instead of holding
+// one, such as template references and environment variables
+func notPlaceholder(value string) bool {
+	lower := strings.ToLower(value)
+	for _, marker := range []string{"${", "{{", "$(", "<", "process.env", "os.getenv", "changeme", "example", "xxxx", "****"} {
+		if strings.Contains(lower, marker) {
+			return false
+		}
+	}
+	return !strings.HasPrefix(value, "$")
+}
+
+// mixedCharacters accepts strings with upper case letters, lower case
+// letters, and digits, like random tokens. It rejects hex digests, which
+// are rarely secret, and identifiers such as age public keys.
+func mixedCharacters(value string) bool {
+	var upper, lower, digit bool
+	for _, r := range value {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= '0' && r <= '9':
+			digit = true
+		}
+	}
+	return upper && lower && digit
+}
+
+// redact keeps the first four characters of a secret
+func redact(secret string) string {
+	if len(secret) <= 4 {
+		return strings.Repeat("*", len(secret))
+	}
+	return secret[:4] + strings.Repeat("*", min(len(secret)-4, 16))
+}
@@ -0,0 +1,248 @@
+// Package snapshot writes the files of a config root to a single
+// age-encrypted tar archive, and restores them from one
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"github.com/teamcurri/puff/internal/keys"
+	"github.com/teamcurri/puff/internal/safefile"
+	"gopkg.in/yaml.v3"
+)
+
+// Options configures Create
+type Options struct {
+	// Recipients can decrypt the archive
+	Recipients []age.Recipient
+	// ExtraKeys are added to every SOPS-encrypted file in the archive, so
+	// the values can be decrypted with them alone. Files on disk are left
+	// alone.
+	ExtraKeys []string
+	// Exclude is a file to leave out, such as the archive itself
+	Exclude string
+}
+
+// File is a file in an archive
+type File struct {
+	Path string // Relative to the config root, with forward slashes
+	Mode fs.FileMode
+	Data []byte
+}
+
+// ParseRecipients returns the age and SSH keys among keys as archive
+// recipients, along with the keys that can't be used, such as cloud KMS keys
+func ParseRecipients(keyStrings []string) (recipients []age.Recipient, skipped []string) {
+	for _, key := range keyStrings {
+		var recipient age.Recipient
+		var err error
+		switch {
+		case strings.HasPrefix(key, "age1"):
+			recipient, err = age.ParseX25519Recipient(key)
+		case strings.HasPrefix(key, "ssh-"):
+			recipient, err = agessh.ParseRecipient(key)
+		default:
+			err = errors.New("not an age key")
+		}
+		if err != nil {
+			skipped = append(skipped, key)
+			continue
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, skipped
+}
+
+// Create writes every file under rootDir, except those in .git directories,
+// to w as a tar archive encrypted to opts.Recipients, and returns the files
+// written
+func Create(rootDir string, w io.Writer, opts Options) ([]File, error) {
+	if len(opts.Recipients) == 0 {
+		return nil, fmt.Errorf("an archive needs at least one recipient")
+	}
+
+	files, err := readFiles(rootDir, opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.ExtraKeys) > 0 {
+		for i := range files {
+			if !isEncrypted(files[i]) {
+				continue
+			}
+			if files[i].Data, err = keys.AddKeysToData(files[i].Data, opts.ExtraKeys); err != nil {
+				return nil, fmt.Errorf("failed to re-encrypt %s: %w", files[i].Path, err)
+			}
+		}
+	}
+
+	encrypted, err := age.Encrypt(w, opts.Recipients...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt archive: %w", err)
+	}
+	archive := tar.NewWriter(encrypted)
+	for _, file := range files {
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     file.Path,
+			Mode:     int64(file.Mode.Perm()),
+			Size:     int64(len(file.Data)),
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			return nil, fmt.Errorf("failed to write archive: %w", err)
+		}
+		if _, err := archive.Write(file.Data); err != nil {
+			return nil, fmt.Errorf("failed to write archive: %w", err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := encrypted.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encrypt archive: %w", err)
+	}
+	return files, nil
+}
+
+// Read decrypts an archive with the first of identities that can, and
+// returns its files. Entries that aren't regular files or directories, or
+// whose paths leave the archive, are refused.
+func Read(r io.Reader, identities []age.Identity) ([]File, error) {
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("no age identities found to decrypt the archive (set SOPS_AGE_KEY_FILE or pass --identity)")
+	}
+	decrypted, err := age.Decrypt(r, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt archive: %w", err)
+	}
+
+	var files []File
+	archive := tar.NewReader(decrypted)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if !filepath.IsLocal(filepath.FromSlash(header.Name)) {
+			return nil, fmt.Errorf("archive entry %q is outside the config root", header.Name)
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			continue
+		case tar.TypeReg:
+		default:
+			return nil, fmt.Errorf("archive entry %q is not a regular file", header.Name)
+		}
+
+		data, err := io.ReadAll(archive)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from archive: %w", header.Name, err)
+		}
+		files = append(files, File{Path: header.Name, Mode: fs.FileMode(header.Mode).Perm(), Data: data})
+	}
+	return files, nil
+}
+
+// Restore writes files under rootDir. Unless overwrite is set, it fails
+// before writing anything if any of them already exists.
+func Restore(rootDir string, files []File, overwrite bool) error {
+	if !overwrite {
+		var existing []string
+		for _, file := range files {
+			if _, err := os.Stat(filepath.Join(rootDir, filepath.FromSlash(file.Path))); err == nil {
+				existing = append(existing, file.Path)
+			}
+		}
+		if len(existing) > 0 {
+			return fmt.Errorf("%d file(s) already exist in %s, including %s (use --force to overwrite them)", len(existing), rootDir, existing[0])
+		}
+	}
+
+	for _, file := range files {
+		path := filepath.Join(rootDir, filepath.FromSlash(file.Path))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", file.Path, err)
+		}
+		if err := safefile.Write(path, file.Data, file.Mode); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", file.Path, err)
+		}
+	}
+	return nil
+}
+
+// readFiles reads the regular files under rootDir, skipping .git directories
+// and exclude
+func readFiles(rootDir, exclude string) ([]File, error) {
+	if exclude != "" {
+		if abs, err := filepath.Abs(exclude); err == nil {
+			exclude = abs
+		}
+	}
+
+	var files []File
+	err := filepath.WalkDir(rootDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		if abs, err := filepath.Abs(path); err == nil && abs == exclude {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(rootDir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, File{Path: filepath.ToSlash(relPath), Mode: info.Mode().Perm(), Data: data})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", rootDir, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files found in %s", rootDir)
+	}
+	return files, nil
+}
+
+// isEncrypted reports whether a file is a SOPS-encrypted YAML file
+func isEncrypted(file File) bool {
+	ext := filepath.Ext(file.Path)
+	if ext != ".yml" && ext != ".yaml" || !bytes.Contains(file.Data, []byte("sops:")) {
+		return false
+	}
+	var data map[string]interface{}
+	if err := yaml.Unmarshal(file.Data, &data); err != nil {
+		return false
+	}
+	_, ok := data["sops"]
+	return ok
+}
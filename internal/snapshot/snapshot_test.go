@@ -0,0 +1,113 @@
+package snapshot
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func TestCreateAndRestore(t *testing.T) {
+	root := t.TempDir()
+	for path, content := range map[string]string{
+		".puff.yaml":        "version: 1\n",
+		"base/shared.yml":   "PORT: \"8080\"\n",
+		"prod/api.yml":      "LOG_LEVEL: info\n",
+		".git/HEAD":         "ref: refs/heads/main\n",
+		"backups/today.age": "old snapshot",
+	} {
+		if err := os.MkdirAll(filepath.Join(root, filepath.Dir(path)), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, path), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+	files, err := Create(root, &archive, Options{
+		Recipients: []age.Recipient{identity.Recipient()},
+		Exclude:    filepath.Join(root, "backups/today.age"),
+	})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("Expected 3 files without .git and the excluded file, got %v", files)
+	}
+	if bytes.Contains(archive.Bytes(), []byte("LOG_LEVEL")) {
+		t.Fatal("Archive is not encrypted")
+	}
+
+	other, _ := age.GenerateX25519Identity()
+	if _, err := Read(bytes.NewReader(archive.Bytes()), []age.Identity{other}); err == nil {
+		t.Fatal("Expected an archive to be unreadable without its recipient's identity")
+	}
+
+	restored, err := Read(bytes.NewReader(archive.Bytes()), []age.Identity{other, identity})
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	target := t.TempDir()
+	if err := Restore(target, restored, false); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(target, "prod/api.yml"))
+	if err != nil || string(data) != "LOG_LEVEL: info\n" {
+		t.Errorf("Unexpected restored file: %q, %v", data, err)
+	}
+	if info, err := os.Stat(filepath.Join(target, "base/shared.yml")); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600 to be kept, got %v, %v", info, err)
+	}
+
+	// Existing files are only overwritten when asked to
+	os.WriteFile(filepath.Join(target, "prod/api.yml"), []byte("LOG_LEVEL: debug\n"), 0600)
+	if err := Restore(target, restored, false); err == nil || !strings.Contains(err.Error(), "already exist") {
+		t.Fatalf("Expected existing files to be refused, got %v", err)
+	}
+	if err := Restore(target, restored, true); err != nil {
+		t.Fatalf("Restore with overwrite failed: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(target, "prod/api.yml")); string(data) != "LOG_LEVEL: info\n" {
+		t.Errorf("Expected the file to be overwritten, got %q", data)
+	}
+}
+
+func TestReadRefusesEntriesOutsideRoot(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"../escape.yml", "/etc/passwd"} {
+		var archive bytes.Buffer
+		encrypted, _ := age.Encrypt(&archive, identity.Recipient())
+		writer := tar.NewWriter(encrypted)
+		writer.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0600, Size: 1})
+		writer.Write([]byte("x"))
+		writer.Close()
+		encrypted.Close()
+
+		if _, err := Read(&archive, []age.Identity{identity}); err == nil || !strings.Contains(err.Error(), "outside the config root") {
+			t.Errorf("Expected %s to be refused, got %v", name, err)
+		}
+	}
+}
+
+func TestParseRecipients(t *testing.T) {
+	identity, _ := age.GenerateX25519Identity()
+	recipients, skipped := ParseRecipients([]string{identity.Recipient().String(), "arn:aws:kms:us-east-1:123456789012:key/abc"})
+	if len(recipients) != 1 || len(skipped) != 1 {
+		t.Errorf("Expected the age key to be used and the KMS key skipped, got %v and %v", recipients, skipped)
+	}
+}
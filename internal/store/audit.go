@@ -0,0 +1,67 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/teamcurri/puff/internal/audit"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/git"
+)
+
+// RecordAudit appends records to the audit log if it is enabled in
+// .puff.yaml, filling in the time and actor. Value hashes are dropped unless
+// records are encrypted, as anyone who can read the log could otherwise
+// test guesses of short values against them. The change has already been
+// made, so errors say so.
+func RecordAudit(rootDir, command string, records ...audit.Record) error {
+	project, err := config.LoadProject(rootDir)
+	if err != nil {
+		return err
+	}
+	if !project.Audit.Enabled || len(records) == 0 {
+		return nil
+	}
+
+	var recipients []string
+	if project.Audit.Encrypt {
+		if recipients, err = DirectoryKeys(rootDir); err != nil {
+			return fmt.Errorf("change was made but the audit log was not written: %w", err)
+		}
+		if len(recipients) == 0 {
+			return fmt.Errorf("change was made but the audit log was not written: no encryption keys found")
+		}
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	actor := actor(rootDir)
+	for i := range records {
+		records[i].Time = now
+		records[i].Actor = actor
+		records[i].Command = command
+		if !project.Audit.Encrypt {
+			records[i].OldHash, records[i].NewHash = "", ""
+		}
+	}
+	if err := audit.Append(rootDir, records, recipients); err != nil {
+		return fmt.Errorf("change was made but the audit log was not written: %w", err)
+	}
+	return nil
+}
+
+// actor returns who is making a change: PUFF_ACTOR if set, otherwise the
+// git user, otherwise the login name
+func actor(rootDir string) string {
+	if actor := os.Getenv("PUFF_ACTOR"); actor != "" {
+		return actor
+	}
+	if identity := git.Identity(rootDir); identity != "" {
+		return identity
+	}
+	if current, err := user.Current(); err == nil {
+		return current.Username
+	}
+	return "unknown"
+}
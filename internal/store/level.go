@@ -0,0 +1,123 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/safefile"
+)
+
+// LevelStores returns the files of the level filePath is the file of: the
+// file itself or, if .puff.yaml splits levels into stores, its plaintext
+// and encrypted stores, in the order they're merged
+func LevelStores(rootDir, filePath string) ([]string, error) {
+	project, err := config.LoadProject(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	if !project.Stores.Split {
+		return []string{filePath}, nil
+	}
+	plainPath, err := PlainFile(project, rootDir, filePath)
+	if err != nil {
+		return nil, err
+	}
+	return []string{plainPath, filePath}, nil
+}
+
+// ReadStores reads the given files, with an empty map for those that don't
+// exist, and reports whether any of them does
+func ReadStores(paths []string) ([]map[string]interface{}, bool, error) {
+	values := make([]map[string]interface{}, len(paths))
+	found := false
+	for i, path := range paths {
+		fileValues, err := Read(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				return nil, false, err
+			}
+			fileValues = make(map[string]interface{})
+		} else {
+			found = true
+		}
+		values[i] = fileValues
+	}
+	return values, found, nil
+}
+
+// Update is a file for WriteFiles to write
+type Update struct {
+	Path   string
+	Values map[string]interface{}
+}
+
+// WriteFiles writes files in order with Write. If one can't be written, the
+// files written before it are restored, so a change spanning several files,
+// such as a key moving between the stores of a split level, is made in all
+// of them or in none. Callers should hold the files' locks.
+func WriteFiles(rootDir string, updates []Update, ageKeys []string) error {
+	written := make([]original, 0, len(updates))
+	for _, update := range updates {
+		file, err := saveOriginal(update.Path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", relativePath(rootDir, update.Path), err)
+		}
+		if err := Write(update.Path, update.Values, ageKeys); err != nil {
+			err = fmt.Errorf("%s: %w", relativePath(rootDir, update.Path), err)
+			if restoreErr := restore(rootDir, written); restoreErr != nil {
+				return errors.Join(err, restoreErr)
+			}
+			if len(written) > 0 {
+				return fmt.Errorf("%w (the files written before it were restored)", err)
+			}
+			return err
+		}
+		written = append(written, file)
+	}
+	return nil
+}
+
+// original is a file as it was before WriteFiles wrote it
+type original struct {
+	path   string
+	exists bool
+	data   []byte
+	perm   os.FileMode
+}
+
+// saveOriginal records a file's current contents, so they can be restored
+func saveOriginal(path string) (original, error) {
+	file := original{path: path}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return file, nil
+	} else if err != nil {
+		return file, err
+	}
+	if file.data, err = os.ReadFile(path); err != nil {
+		return file, err
+	}
+	file.exists, file.perm = true, info.Mode().Perm()
+	return file, nil
+}
+
+// restore puts back files as they were before a failed WriteFiles, removing
+// those that didn't exist, and returns an error naming the files it couldn't
+// restore
+func restore(rootDir string, files []original) error {
+	var errs []error
+	for _, file := range files {
+		var err error
+		if file.exists {
+			err = safefile.Write(file.path, file.data, file.perm)
+		} else {
+			err = os.Remove(file.path)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to restore %s: %w", relativePath(rootDir, file.path), err))
+		}
+	}
+	return errors.Join(errs...)
+}
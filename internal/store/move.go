@@ -0,0 +1,124 @@
+package store
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/teamcurri/puff/internal/audit"
+	"github.com/teamcurri/puff/internal/safefile"
+)
+
+// Move moves top-level keys from the file of one level to the file of
+// another, or if .puff.yaml splits levels into stores, between the levels'
+// stores, keeping each key in the kind of store it was in. A key the
+// destination has with a different value is refused unless force is set.
+// The files are locked until they're written. The destination is written
+// first, so a failure never loses a value, and files already written are
+// restored if a later one can't be. It returns audit records for the
+// changes, which the caller records.
+func Move(rootDir, fromPath, toPath string, keys []string, force bool) ([]audit.Record, error) {
+	fromName := relativePath(rootDir, fromPath)
+
+	ageKeys, err := DirectoryKeys(rootDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check directory encryption: %w", err)
+	}
+	if len(ageKeys) == 0 {
+		return nil, fmt.Errorf("no encryption keys found in directory - run 'puff init' first to initialize with encryption keys")
+	}
+
+	fromStores, err := LevelStores(rootDir, fromPath)
+	if err != nil {
+		return nil, err
+	}
+	toStores, err := LevelStores(rootDir, toPath)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := safefile.Acquire(append(append([]string(nil), fromStores...), toStores...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
+	source, found, err := ReadStores(fromStores)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("config file does not exist: %s", fromName)
+	}
+	dest, _, err := ReadStores(toStores)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check every key before changing anything. A key in both stores of a
+	// split level takes its value from the secret store, the last one.
+	from := make(map[string]int, len(keys))
+	for _, key := range keys {
+		index := -1
+		for i := range source {
+			if _, exists := source[i][key]; exists {
+				index = i
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("key not found in %s: %s", fromName, key)
+		}
+		from[key] = index
+		for i := range dest {
+			if existing, exists := dest[i][key]; exists && !reflect.DeepEqual(existing, source[index][key]) && !force {
+				return nil, fmt.Errorf("%s already has %s with a different value (use --force to overwrite it)", relativePath(rootDir, toStores[i]), key)
+			}
+		}
+	}
+
+	var records []audit.Record
+	fromChanged := make([]bool, len(source))
+	toChanged := make([]bool, len(dest))
+	for _, key := range keys {
+		value := source[from[key]][key]
+		for i := range dest {
+			existing, exists := dest[i][key]
+			if i == from[key] {
+				record := audit.Record{File: relativePath(rootDir, toStores[i]), Key: key, NewHash: audit.Hash(value)}
+				if exists {
+					record.OldHash = audit.Hash(existing)
+				}
+				records = append(records, record)
+				dest[i][key] = value
+				toChanged[i] = true
+			} else if exists {
+				// The key moves out of the destination's other store
+				records = append(records, audit.Record{File: relativePath(rootDir, toStores[i]), Key: key, OldHash: audit.Hash(existing)})
+				delete(dest[i], key)
+				toChanged[i] = true
+			}
+		}
+		for i := range source {
+			if old, exists := source[i][key]; exists {
+				records = append(records, audit.Record{File: relativePath(rootDir, fromStores[i]), Key: key, OldHash: audit.Hash(old)})
+				delete(source[i], key)
+				fromChanged[i] = true
+			}
+		}
+	}
+
+	var updates []Update
+	for i, path := range toStores {
+		if toChanged[i] {
+			updates = append(updates, Update{Path: path, Values: dest[i]})
+		}
+	}
+	for i, path := range fromStores {
+		if fromChanged[i] {
+			updates = append(updates, Update{Path: path, Values: source[i]})
+		}
+	}
+	if err := WriteFiles(rootDir, updates, ageKeys); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
@@ -0,0 +1,207 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+
+	"github.com/teamcurri/puff/internal/audit"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/dotenv"
+	"github.com/teamcurri/puff/internal/safefile"
+)
+
+// Placement chooses which store of a split level a key is set in
+type Placement int
+
+const (
+	// PlaceByName follows the naming convention in .puff.yaml
+	PlaceByName Placement = iota
+	// PlaceSecret sets keys in the encrypted store
+	PlaceSecret
+	// PlacePlain sets keys in the plaintext store
+	PlacePlain
+)
+
+// Change is a file Set wrote, or left alone because its keys already had
+// the values given
+type Change struct {
+	Path      string
+	Plain     bool
+	Set       []dotenv.Entry // Pairs set in the file
+	Moved     []string       // Keys removed because they moved to the other store
+	Unchanged []string       // Keys that already had the value given
+}
+
+// Set sets pairs in the file of a level, or if .puff.yaml splits levels into
+// stores, in its plaintext and encrypted stores, moving keys out of the store
+// they no longer belong in. Dotted keys set values nested in maps. The files
+// are locked until they're written, so concurrent sets don't lose each
+// other's changes. A file whose keys all have their values already isn't
+// written. A store gaining keys is written before the one they move out of,
+// and is restored if that one can't be written, so a failure never loses a
+// value. It returns the files written, in order, along with audit records
+// for the changes, which the caller records.
+func Set(rootDir, filePath string, pairs []dotenv.Entry, placement Placement) ([]Change, []audit.Record, error) {
+	ageKeys, stores, err := prepareSet(rootDir, filePath, pairs, placement)
+	if err != nil {
+		return nil, nil, err
+	}
+	paths := make([]string, 0, len(stores))
+	for _, store := range stores {
+		paths = append(paths, store.Path)
+	}
+	lock, err := safefile.Acquire(paths...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer lock.Release()
+
+	var changes []Change
+	var records []audit.Record
+	var gaining, losing []Update
+	for _, store := range stores {
+		values, change, fileRecords, err := applySet(rootDir, store)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(change.Set) == 0 && len(change.Moved) == 0 {
+			if len(change.Unchanged) > 0 {
+				changes = append(changes, change)
+			}
+			continue
+		}
+
+		if len(change.Set) > 0 {
+			gaining = append(gaining, Update{Path: change.Path, Values: values})
+		} else {
+			losing = append(losing, Update{Path: change.Path, Values: values})
+		}
+		changes = append(changes, change)
+		records = append(records, fileRecords...)
+	}
+	if err := WriteFiles(rootDir, append(gaining, losing...), ageKeys); err != nil {
+		return nil, nil, err
+	}
+	return changes, records, nil
+}
+
+// PlanSet returns the changes Set would make, without writing anything
+func PlanSet(rootDir, filePath string, pairs []dotenv.Entry, placement Placement) ([]Change, error) {
+	_, stores, err := prepareSet(rootDir, filePath, pairs, placement)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	for _, store := range stores {
+		_, change, _, err := applySet(rootDir, store)
+		if err != nil {
+			return nil, err
+		}
+		if len(change.Set) > 0 || len(change.Moved) > 0 || len(change.Unchanged) > 0 {
+			changes = append(changes, change)
+		}
+	}
+	return changes, nil
+}
+
+// prepareSet returns the directory's keys and the files Set writes
+func prepareSet(rootDir, filePath string, pairs []dotenv.Entry, placement Placement) ([]string, []Change, error) {
+	// ALWAYS encrypt - new files need the directory's keys
+	ageKeys, err := DirectoryKeys(rootDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to check directory encryption: %w", err)
+	}
+	if len(ageKeys) == 0 {
+		return nil, nil, fmt.Errorf("no encryption keys found in directory - run 'puff init' first to initialize with encryption keys")
+	}
+
+	stores, err := storesToSet(rootDir, filePath, pairs, placement)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ageKeys, stores, nil
+}
+
+// applySet sets the pairs of a store in its current values, decrypting the
+// file once. Keys that already have their value are left alone. It returns
+// the new values and what changed, with audit records for the changes.
+func applySet(rootDir string, store Change) (map[string]interface{}, Change, []audit.Record, error) {
+	if len(store.Set) == 0 && len(store.Moved) == 0 {
+		return nil, store, nil, nil
+	}
+
+	// Load existing config or create new one
+	values, err := Read(store.Path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, store, nil, err
+		}
+		values = make(map[string]interface{})
+	}
+
+	var records []audit.Record
+	var set []dotenv.Entry
+	var unchanged []string
+	for _, pair := range store.Set {
+		record := audit.Record{File: relativePath(rootDir, store.Path), Key: pair.Key, NewHash: audit.Hash(pair.Value)}
+		if old, exists := config.Lookup(values, pair.Key); exists {
+			if reflect.DeepEqual(old, pair.Value) {
+				unchanged = append(unchanged, pair.Key)
+				continue
+			}
+			record.OldHash = audit.Hash(old)
+		}
+		if err := config.SetPath(values, pair.Key, pair.Value); err != nil {
+			return nil, store, nil, err
+		}
+		set = append(set, pair)
+		records = append(records, record)
+	}
+
+	// Keys set in the other store of a split level move out of this one
+	var moved []string
+	for _, key := range store.Moved {
+		if old, exists := config.Lookup(values, key); exists {
+			records = append(records, audit.Record{File: relativePath(rootDir, store.Path), Key: key, OldHash: audit.Hash(old)})
+			config.DeletePath(values, key)
+			moved = append(moved, key)
+		}
+	}
+	store.Set, store.Moved, store.Unchanged = set, moved, unchanged
+	return values, store, records, nil
+}
+
+// storesToSet returns the files Set writes the pairs to: the level's file or,
+// if .puff.yaml splits levels into stores, its plaintext and encrypted
+// stores, with the keys each sets and the keys that move out of it
+func storesToSet(rootDir, filePath string, pairs []dotenv.Entry, placement Placement) ([]Change, error) {
+	project, err := config.LoadProject(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	if !project.Stores.Split {
+		if placement != PlaceByName {
+			return nil, fmt.Errorf("choosing the store of a key needs stores.split in %s", config.ProjectFile)
+		}
+		return []Change{{Path: filePath, Set: pairs}}, nil
+	}
+
+	plainPath, err := PlainFile(project, rootDir, filePath)
+	if err != nil {
+		return nil, err
+	}
+	plain := Change{Path: plainPath, Plain: true}
+	secret := Change{Path: filePath}
+	for _, pair := range pairs {
+		if placement == PlacePlain || (placement == PlaceByName && !project.Stores.IsSecret(pair.Key)) {
+			plain.Set = append(plain.Set, pair)
+			secret.Moved = append(secret.Moved, pair.Key)
+		} else {
+			secret.Set = append(secret.Set, pair)
+			plain.Moved = append(plain.Moved, pair.Key)
+		}
+	}
+	return []Change{plain, secret}, nil
+}
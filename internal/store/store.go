@@ -0,0 +1,247 @@
+// Package store reads and writes the files of config levels, encrypting
+// them as .sops.yaml and their siblings ask, and records the changes in the
+// audit log. It is shared by the CLI and the Go SDK in pkg/puff.
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/getsops/sops/v3/decrypt"
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/keys"
+	"github.com/teamcurri/puff/internal/safefile"
+	"gopkg.in/yaml.v3"
+)
+
+// LevelFile returns the config file that holds values for the given
+// app/env/target combination, laid out as .puff.yaml maps the levels to files
+func LevelFile(rootDir, app, env, target string) (string, error) {
+	project, err := config.LoadProject(rootDir)
+	if err != nil {
+		return "", err
+	}
+	return project.LevelFile(rootDir, config.Level{App: app, Env: env, Target: target}), nil
+}
+
+// ContextFile returns the config file that holds values for the given
+// app/env/target combination, or for a dimension's layer if a dimension
+// value is given
+func ContextFile(rootDir, app, env, target string, dimensions map[string]string) (string, error) {
+	if len(dimensions) == 0 {
+		return LevelFile(rootDir, app, env, target)
+	}
+	if len(dimensions) > 1 || target != "" {
+		return "", fmt.Errorf("only one of a target and a dimension value can select the file to write")
+	}
+
+	project, err := config.LoadProject(rootDir)
+	if err != nil {
+		return "", err
+	}
+	for name, value := range dimensions {
+		dim := project.Dimension(name)
+		if dim == nil {
+			return "", fmt.Errorf("unknown dimension %q (not declared in %s)", name, config.ProjectFile)
+		}
+		if err := dim.ValidateValue(value); err != nil {
+			return "", err
+		}
+		return project.LevelFile(rootDir, config.Level{App: app, Env: env, Dimension: name, Value: value}), nil
+	}
+	return "", nil
+}
+
+// PlainFile returns the plaintext store of the split level filePath is
+// the encrypted store of
+func PlainFile(project *config.Project, rootDir, filePath string) (string, error) {
+	level, ok := project.FileLevel(relativePath(rootDir, filePath))
+	if !ok {
+		return "", fmt.Errorf("%s is not part of the config hierarchy", relativePath(rootDir, filePath))
+	}
+	level.Plain = true
+	return project.LevelFile(rootDir, level), nil
+}
+
+// Read reads a config file, decrypting it if it is SOPS-encrypted.
+// The returned error satisfies os.IsNotExist if the file does not exist.
+func Read(filePath string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	// Check if file is SOPS-encrypted
+	var checkMap map[string]interface{}
+	if err := yaml.Unmarshal(data, &checkMap); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	if _, hasSops := checkMap["sops"]; hasSops {
+		// Decrypt the file
+		decryptedData, err := decrypt.File(filePath, "yaml")
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt file: %w", err)
+		}
+		data = decryptedData
+	}
+
+	// Parse the (possibly decrypted) YAML
+	var config map[string]interface{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	if config == nil {
+		config = make(map[string]interface{})
+	}
+	// Remove SOPS metadata if it exists
+	delete(config, "sops")
+
+	return config, nil
+}
+
+// Write writes values to a config file and encrypts it with the given age keys.
+// Values of an existing file that haven't changed keep their ciphertext when
+// the file's keys stay the same. Files protected by Shamir key groups keep their groups, and new files inherit
+// the groups of a sibling that has them. Files matching a creation rule of
+// their own in .sops.yaml, such as an environment created with its own keys,
+// are encrypted to that rule's keys instead. The plaintext store of a split
+// level is written as it is.
+func Write(filePath string, values map[string]interface{}, ageKeys []string) error {
+	yamlData, err := yaml.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("failed to marshal YAML: %w", err)
+	}
+
+	groups, plain, err := Groups(filePath, ageKeys)
+	if err != nil {
+		return err
+	}
+	if plain {
+		if err := os.MkdirAll(filepath.Dir(filePath), 0700); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		return safefile.Write(filePath, yamlData, 0644)
+	}
+	current, _ := keys.ReadKeyGroups(filePath)
+
+	// ALWAYS encrypt - encryption is mandatory. The values are encrypted in
+	// memory, so plaintext never reaches the disk. A file that stays
+	// encrypted to the same keys keeps its data key and the ciphertext of
+	// unchanged values, so its git diff shows only what changed.
+	var encrypted []byte
+	if existing, readErr := os.ReadFile(filePath); readErr == nil && len(current.Groups) > 0 && current.Equal(groups) {
+		encrypted, err = keys.UpdateEncryptedData(existing, yamlData, filePath)
+	} else {
+		encrypted, err = keys.EncryptDataWithGroups(yamlData, filePath, groups)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encrypt file: %w", err)
+	}
+
+	// Ensure parent directory exists
+	if err := os.MkdirAll(filepath.Dir(filePath), 0700); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	return safefile.Write(filePath, encrypted, 0600)
+}
+
+// Groups returns the key groups Write encrypts a file to given the
+// directory's age keys, or reports that the file is the plaintext store of a
+// split level
+func Groups(filePath string, ageKeys []string) (groups keys.KeyGroups, plain bool, err error) {
+	if plain, err := config.IsPlainStore(filePath); err != nil || plain {
+		return keys.KeyGroups{}, plain, err
+	}
+
+	groups, err = keys.ReadKeyGroups(filePath)
+	if os.IsNotExist(err) {
+		groups, _, err = keys.DirectoryKeyGroups(filepath.Dir(filePath))
+	}
+	if err != nil {
+		return keys.KeyGroups{}, false, fmt.Errorf("failed to read key groups: %w", err)
+	}
+	if !groups.IsShamir() {
+		if ruleKeys, ok, err := keys.RuleKeysForFile(filePath); err != nil {
+			return keys.KeyGroups{}, false, err
+		} else if ok {
+			ageKeys = ruleKeys
+		}
+		groups = keys.SingleGroup(ageKeys)
+	}
+	return groups, false, nil
+}
+
+// DirectoryKeys scans the directory for any encrypted files and returns their age keys.
+// Files of environments with their own keys in .sops.yaml are skipped, so
+// their keys don't spread to other environments.
+func DirectoryKeys(rootDir string) ([]string, error) {
+	keySet := make(map[string]bool)
+	sopsConfig, _ := keys.LoadSOPSConfig(rootDir)
+
+	err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Another process may rename its temporary file away mid-walk
+			if os.IsNotExist(err) && path != rootDir {
+				return nil
+			}
+			return err
+		}
+
+		// Skip directories, non-YAML files, and .sops.yaml
+		if info.IsDir() || !config.IsConfigFileName(info.Name()) {
+			return nil
+		}
+
+		// Check if file is SOPS-encrypted
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil // Skip files we can't read
+		}
+
+		var yamlData map[string]interface{}
+		if err := yaml.Unmarshal(data, &yamlData); err != nil {
+			return nil // Skip files that aren't valid YAML
+		}
+
+		if sopsConfig != nil {
+			if _, ok := sopsConfig.RuleKeys(relativePath(rootDir, path)); ok {
+				return nil
+			}
+		}
+
+		// If this is a SOPS file, extract its keys
+		if _, hasSops := yamlData["sops"]; hasSops {
+			fileKeys := keys.ExtractKeys(yamlData)
+			for _, key := range fileKeys {
+				keySet[key] = true
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert set to slice
+	result := make([]string, 0, len(keySet))
+	for key := range keySet {
+		result = append(result, key)
+	}
+
+	return result, nil
+}
+
+// relativePath returns path relative to the config root, or path itself if
+// it can't be made relative
+func relativePath(rootDir, path string) string {
+	if rel, err := filepath.Rel(rootDir, path); err == nil {
+		return rel
+	}
+	return path
+}
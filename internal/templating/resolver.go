@@ -2,27 +2,136 @@ package templating
 
 import (
 	"fmt"
+	"os"
 	"regexp"
 	"strings"
 )
 
 var (
-	// templateVarRegex matches ${VAR_NAME} patterns
+	// templateVarRegex matches ${VAR_NAME}, ${VAR_NAME:-default} and
+	// ${fn(VAR_NAME)} patterns, where VAR_NAME may be namespaced as in
+	// ${env:NAME} or ${app:NAME:KEY}
 	templateVarRegex = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+	// functionCallRegex matches a function applied to the rest of a reference
+	functionCallRegex = regexp.MustCompile(`^([a-z0-9]+)\((.*)\)$`)
 )
 
+// defaultSeparator separates a variable name from its default value
+const defaultSeparator = ":-"
+
+// hostEnvPrefix marks references to the invoking process's environment, as
+// in ${env:HOSTNAME}
+const hostEnvPrefix = "env:"
+
+// appPrefix marks references to another app's resolved values, as in
+// ${app:payments:PUBLIC_URL}
+const appPrefix = "app:"
+
+// reference is the parsed inside of a ${...} template reference
+type reference struct {
+	funcs        []string // Outermost first
+	name         string
+	defaultValue string
+	hasDefault   bool
+}
+
+// parseReference splits the inside of a ${...} reference into the functions
+// applied to it, the variable name, and its default value, if any
+func parseReference(ref string) reference {
+	var parsed reference
+	for {
+		match := functionCallRegex.FindStringSubmatch(ref)
+		if match == nil {
+			break
+		}
+		parsed.funcs = append(parsed.funcs, match[1])
+		ref = match[2]
+	}
+	parsed.name, parsed.defaultValue, parsed.hasDefault = strings.Cut(ref, defaultSeparator)
+	return parsed
+}
+
+// String formats the reference as it appears inside ${...}
+func (ref reference) String() string {
+	result := ref.name
+	if ref.hasDefault {
+		result += defaultSeparator + ref.defaultValue
+	}
+	for i := len(ref.funcs) - 1; i >= 0; i-- {
+		result = ref.funcs[i] + "(" + result + ")"
+	}
+	return result
+}
+
+// apply runs the reference's functions on value, innermost first
+func (ref reference) apply(value, key string) (string, error) {
+	for i := len(ref.funcs) - 1; i >= 0; i-- {
+		fn, ok := functions[ref.funcs[i]]
+		if !ok {
+			return "", fmt.Errorf("unknown template function %q (in %s); available: %s", ref.funcs[i], key, strings.Join(functionNames(), ", "))
+		}
+		value = fn(value)
+	}
+	return value, nil
+}
+
+// valueOrDefault converts a resolved value to a string for substitution. As
+// in the shell, the default also applies to empty (or null) values.
+func (ref reference) valueOrDefault(resolvedVarValue interface{}) string {
+	varStr := fmt.Sprintf("%v", resolvedVarValue)
+	if ref.hasDefault && (resolvedVarValue == nil || varStr == "") {
+		return ref.defaultValue
+	}
+	return varStr
+}
+
 // Resolver handles template variable resolution
 type Resolver struct {
 	values map[string]interface{}
+
+	// lookupEnv looks up ${env:NAME} references; nil disables them
+	lookupEnv func(string) (string, bool)
+
+	// lookupApp returns another app's resolved values for ${app:NAME:KEY}
+	// references; nil disables them
+	lookupApp func(string) (map[string]interface{}, error)
+
+	// steps records substitutions while explaining a value; nil otherwise
+	steps *[]Step
 }
 
-// NewResolver creates a new template resolver with the given values
+// Step is one template reference substituted while resolving a value
+type Step struct {
+	// Depth is 0 for references in the explained value, and one more for
+	// each level of references inside referenced values
+	Depth     int
+	Key       string // Variable whose value contains the reference
+	Reference string // The reference as written, e.g. ${DB_HOST}
+	Value     string // What the reference was replaced with
+}
+
+// NewResolver creates a new template resolver with the given values.
+// ${env:NAME} references read the process environment.
 func NewResolver(values map[string]interface{}) *Resolver {
 	return &Resolver{
-		values: values,
+		values:    values,
+		lookupEnv: os.LookupEnv,
 	}
 }
 
+// SetHostEnv sets how ${env:NAME} references are looked up. A nil lookup
+// disables them for hermetic builds, leaving only their defaults.
+func (r *Resolver) SetHostEnv(lookup func(string) (string, bool)) {
+	r.lookupEnv = lookup
+}
+
+// SetAppLookup sets how ${app:NAME:KEY} references load the resolved values
+// of another app
+func (r *Resolver) SetAppLookup(lookup func(app string) (map[string]interface{}, error)) {
+	r.lookupApp = lookup
+}
+
 // Resolve resolves all template variables in the given values map
 // Returns a new map with resolved values
 func (r *Resolver) Resolve() (map[string]interface{}, error) {
@@ -66,23 +175,31 @@ func (r *Resolver) resolveValue(key string, value interface{}, resolving map[str
 
 	result := strValue
 	for _, match := range matches {
-		fullMatch := match[0]  // ${VAR_NAME}
-		varName := match[1]    // VAR_NAME
+		fullMatch := match[0] // ${VAR_NAME}, ${VAR_NAME:-default} or ${fn(...)}
+		ref := parseReference(match[1])
 
-		// Look up the variable value
-		varValue, exists := r.values[varName]
-		if !exists {
-			return nil, fmt.Errorf("undefined variable referenced: %s (in %s)", varName, key)
+		// Record the step before looking up the reference, so it comes
+		// before the steps of any references inside the referenced value
+		step := -1
+		if r.steps != nil {
+			step = len(*r.steps)
+			*r.steps = append(*r.steps, Step{Depth: len(resolving) - 1, Key: key, Reference: fullMatch})
 		}
 
-		// Recursively resolve the referenced variable
-		resolvedVarValue, err := r.resolveValue(varName, varValue, resolving)
+		varStr, err := r.lookup(ref, key, resolving)
+		if err == nil {
+			varStr, err = ref.apply(varStr, key)
+		}
 		if err != nil {
+			// Only completed substitutions are reported
+			if step >= 0 {
+				*r.steps = (*r.steps)[:step]
+			}
 			return nil, err
 		}
-
-		// Convert to string for substitution
-		varStr := fmt.Sprintf("%v", resolvedVarValue)
+		if step >= 0 {
+			(*r.steps)[step].Value = varStr
+		}
 
 		// Replace the template variable with its value
 		result = strings.ReplaceAll(result, fullMatch, varStr)
@@ -91,6 +208,98 @@ func (r *Resolver) resolveValue(key string, value interface{}, resolving map[str
 	return result, nil
 }
 
+// lookup returns the value a reference in key stands for, before any
+// functions are applied, falling back to the reference's default literal
+func (r *Resolver) lookup(ref reference, key string, resolving map[string]bool) (string, error) {
+	if hostName, ok := strings.CutPrefix(ref.name, hostEnvPrefix); ok {
+		var value string
+		found := false
+		if r.lookupEnv != nil {
+			value, found = r.lookupEnv(hostName)
+		}
+		switch {
+		case found && (value != "" || !ref.hasDefault):
+			return value, nil
+		case ref.hasDefault:
+			return ref.defaultValue, nil
+		case r.lookupEnv == nil:
+			return "", fmt.Errorf("host environment references are disabled: %s (in %s)", ref.name, key)
+		default:
+			return "", fmt.Errorf("undefined host environment variable referenced: %s (in %s)", hostName, key)
+		}
+	}
+
+	if appRef, ok := strings.CutPrefix(ref.name, appPrefix); ok {
+		return r.lookupAppValue(ref, appRef, key)
+	}
+
+	varValue, exists := r.values[ref.name]
+	if !exists {
+		if ref.hasDefault {
+			return ref.defaultValue, nil
+		}
+		return "", fmt.Errorf("undefined variable referenced: %s (in %s)", ref.name, key)
+	}
+
+	// Recursively resolve the referenced variable
+	resolvedVarValue, err := r.resolveValue(ref.name, varValue, resolving)
+	if err != nil {
+		return "", err
+	}
+
+	return ref.valueOrDefault(resolvedVarValue), nil
+}
+
+// lookupAppValue looks up an ${app:NAME:KEY} reference in the other app's
+// resolved values. Internal (_-prefixed) variables stay private to their app.
+func (r *Resolver) lookupAppValue(ref reference, appRef, key string) (string, error) {
+	app, name, ok := strings.Cut(appRef, ":")
+	if !ok || app == "" || name == "" {
+		return "", fmt.Errorf("invalid app reference: %s (in %s); expected app:NAME:KEY", ref.name, key)
+	}
+	if strings.HasPrefix(name, "_") {
+		return "", fmt.Errorf("cannot reference internal variable of another app: %s (in %s)", ref.name, key)
+	}
+	if r.lookupApp == nil {
+		return "", fmt.Errorf("app references are not supported here: %s (in %s)", ref.name, key)
+	}
+
+	values, err := r.lookupApp(app)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve app %s (in %s): %w", app, key, err)
+	}
+	value, exists := values[name]
+	if !exists {
+		if ref.hasDefault {
+			return ref.defaultValue, nil
+		}
+		return "", fmt.Errorf("undefined variable referenced: %s (in %s)", ref.name, key)
+	}
+
+	return ref.valueOrDefault(value), nil
+}
+
+// Explain resolves a single variable and returns its value together with
+// every substitution made along the way, in the order they were made. If
+// resolution fails, the substitutions completed before the failure are
+// returned with the error.
+func (r *Resolver) Explain(key string) (interface{}, []Step, error) {
+	value, ok := r.values[key]
+	if !ok {
+		return nil, nil, fmt.Errorf("undefined variable referenced: %s", key)
+	}
+
+	steps := []Step{}
+	r.steps = &steps
+	defer func() { r.steps = nil }()
+
+	resolved, err := r.resolveValue(key, value, make(map[string]bool))
+	if err != nil {
+		return nil, steps, err
+	}
+	return resolved, steps, nil
+}
+
 // ResolveString resolves template variables in a single string value
 func (r *Resolver) ResolveString(value string) (string, error) {
 	resolved, err := r.resolveValue("", value, make(map[string]bool))
@@ -99,3 +308,41 @@ func (r *Resolver) ResolveString(value string) (string, error) {
 	}
 	return resolved.(string), nil
 }
+
+// RenameVariable rewrites every ${oldName} reference in value to ${newName},
+// keeping any functions and default value
+func RenameVariable(value, oldName, newName string) string {
+	return templateVarRegex.ReplaceAllStringFunc(value, func(match string) string {
+		ref := parseReference(templateVarRegex.FindStringSubmatch(match)[1])
+		if ref.name != oldName {
+			return match
+		}
+		ref.name = newName
+		return "${" + ref.String() + "}"
+	})
+}
+
+// RenameApp rewrites every ${app:oldApp:KEY} reference in value to
+// ${app:newApp:KEY}, keeping any functions and default value
+func RenameApp(value, oldApp, newApp string) string {
+	return templateVarRegex.ReplaceAllStringFunc(value, func(match string) string {
+		ref := parseReference(templateVarRegex.FindStringSubmatch(match)[1])
+		rest, ok := strings.CutPrefix(ref.name, appPrefix+oldApp+":")
+		if !ok {
+			return match
+		}
+		ref.name = appPrefix + newApp + ":" + rest
+		return "${" + ref.String() + "}"
+	})
+}
+
+// References returns the names of the variables referenced in value, in
+// order, without functions or defaults. Namespaced references keep their
+// prefix, as in env:HOSTNAME.
+func References(value string) []string {
+	var names []string
+	for _, match := range templateVarRegex.FindAllStringSubmatch(value, -1) {
+		names = append(names, parseReference(match[1]).name)
+	}
+	return names
+}
@@ -1,6 +1,9 @@
 package templating
 
 import (
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -78,6 +81,57 @@ func TestResolve(t *testing.T) {
 			},
 			expectErr: false,
 		},
+		{
+			name: "default values",
+			values: map[string]interface{}{
+				"HOST":   "db.internal",
+				"EMPTY":  "",
+				"URL":    "postgres://${HOST:-localhost}:${PORT:-5432}/${DB_NAME:-app}",
+				"BLANK":  "${EMPTY:-fallback}",
+				"NO_DEF": "${EMPTY:-}",
+			},
+			expected: map[string]interface{}{
+				"URL":    "postgres://db.internal:5432/app",
+				"BLANK":  "fallback",
+				"NO_DEF": "",
+			},
+			expectErr: false,
+		},
+		{
+			name: "default values still detect cycles",
+			values: map[string]interface{}{
+				"A": "${B:-x}",
+				"B": "${A:-y}",
+			},
+			expectErr: true,
+		},
+		{
+			name: "functions",
+			values: map[string]interface{}{
+				"_USER":     "admin",
+				"_PASSWORD": "p@ss word/1",
+				"ENV_NAME":  "  staging ",
+				"AUTH":      "Basic ${b64(_USER)}",
+				"DB_URL":    "postgres://${_USER}:${urlencode(_PASSWORD)}@db/app",
+				"BANNER":    "${upper(trim(ENV_NAME))}",
+				"REGION":    "${lower(AWS_REGION:-US-EAST-1)}",
+			},
+			expected: map[string]interface{}{
+				"AUTH":   "Basic YWRtaW4=",
+				"DB_URL": "postgres://admin:p%40ss+word%2F1@db/app",
+				"BANNER": "STAGING",
+				"REGION": "us-east-1",
+			},
+			expectErr: false,
+		},
+		{
+			name: "unknown function",
+			values: map[string]interface{}{
+				"A": "value",
+				"B": "${reverse(A)}",
+			},
+			expectErr: true,
+		},
 		{
 			name: "underscore-prefixed variables",
 			values: map[string]interface{}{
@@ -147,3 +201,182 @@ func TestResolveString(t *testing.T) {
 		})
 	}
 }
+
+func TestResolveHostEnv(t *testing.T) {
+	values := map[string]interface{}{
+		"HOST":  "${env:HOSTNAME}",
+		"SHA":   "${upper(env:CI_COMMIT_SHA:-dev)}",
+		"LOCAL": "${HOSTNAME:-none}",
+	}
+	hostEnv := map[string]string{"HOSTNAME": "build-1", "CI_COMMIT_SHA": "abc123"}
+
+	resolver := NewResolver(values)
+	resolver.SetHostEnv(func(name string) (string, bool) {
+		value, ok := hostEnv[name]
+		return value, ok
+	})
+	resolved, err := resolver.Resolve()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// ${HOSTNAME} without the env: namespace is a config variable
+	if resolved["HOST"] != "build-1" || resolved["SHA"] != "ABC123" || resolved["LOCAL"] != "none" {
+		t.Errorf("Unexpected values: %v", resolved)
+	}
+
+	// Disabled host env falls back to defaults and fails without one
+	resolver.SetHostEnv(nil)
+	if _, err := resolver.Resolve(); err == nil {
+		t.Error("Expected an error for ${env:HOSTNAME} with host env disabled")
+	}
+	delete(values, "HOST")
+	resolved, err = resolver.Resolve()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resolved["SHA"] != "DEV" {
+		t.Errorf("Expected the default with host env disabled, got %v", resolved["SHA"])
+	}
+}
+
+func TestResolveAppReferences(t *testing.T) {
+	apps := map[string]map[string]interface{}{
+		"payments": {"PUBLIC_URL": "https://pay.example.com", "EMPTY": "", "_TOKEN": "secret"},
+	}
+	lookupApp := func(app string) (map[string]interface{}, error) {
+		values, ok := apps[app]
+		if !ok {
+			return nil, fmt.Errorf("no config files found for app: %s", app)
+		}
+		return values, nil
+	}
+
+	resolver := NewResolver(map[string]interface{}{
+		"CALLBACK_URL": "${app:payments:PUBLIC_URL}/callback",
+		"UPPER":        "${upper(app:payments:PUBLIC_URL)}",
+		"FALLBACK":     "${app:payments:EMPTY:-none}",
+	})
+	resolver.SetAppLookup(lookupApp)
+	resolved, err := resolver.Resolve()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resolved["CALLBACK_URL"] != "https://pay.example.com/callback" ||
+		resolved["UPPER"] != "HTTPS://PAY.EXAMPLE.COM" ||
+		resolved["FALLBACK"] != "none" {
+		t.Errorf("Unexpected values: %v", resolved)
+	}
+
+	errorCases := map[string]string{
+		"${app:payments:MISSING}": "undefined variable referenced: app:payments:MISSING",
+		"${app:payments:_TOKEN}":  "cannot reference internal variable",
+		"${app:billing:URL}":      "no config files found for app: billing",
+		"${app:payments}":         "invalid app reference",
+	}
+	for value, want := range errorCases {
+		resolver := NewResolver(map[string]interface{}{"KEY": value})
+		resolver.SetAppLookup(lookupApp)
+		if _, err := resolver.Resolve(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error containing %q, got %v", value, want, err)
+		}
+	}
+
+	// Without a lookup, app references are an error
+	if _, err := NewResolver(map[string]interface{}{"KEY": "${app:payments:PUBLIC_URL}"}).Resolve(); err == nil {
+		t.Error("Expected an error without an app lookup")
+	}
+}
+
+func TestExplain(t *testing.T) {
+	resolver := NewResolver(map[string]interface{}{
+		"URL":     "https://${HOST}/${upper(PATH:-api)}",
+		"HOST":    "${_REGION}.example.com",
+		"_REGION": "eu",
+		"BROKEN":  "${HOST}-${MISSING}",
+	})
+
+	value, steps, err := resolver.Explain("URL")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if value != "https://eu.example.com/API" {
+		t.Errorf("Unexpected value: %v", value)
+	}
+	expected := []Step{
+		{Depth: 0, Key: "URL", Reference: "${HOST}", Value: "eu.example.com"},
+		{Depth: 1, Key: "HOST", Reference: "${_REGION}", Value: "eu"},
+		{Depth: 0, Key: "URL", Reference: "${upper(PATH:-api)}", Value: "API"},
+	}
+	if !reflect.DeepEqual(steps, expected) {
+		t.Errorf("Expected steps %v, got %v", expected, steps)
+	}
+
+	// Only completed substitutions are reported with an error
+	_, steps, err = resolver.Explain("BROKEN")
+	if err == nil {
+		t.Fatal("Expected an error for an undefined variable")
+	}
+	if len(steps) != 2 || steps[0].Reference != "${HOST}" {
+		t.Errorf("Unexpected steps: %v", steps)
+	}
+
+	// Explaining doesn't leave tracing switched on
+	if _, err := resolver.Resolve(); err == nil {
+		t.Fatal("Expected an error for an undefined variable")
+	}
+	if resolver.steps != nil {
+		t.Error("Expected tracing to be switched off after Explain")
+	}
+}
+
+func TestRenameVariable(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"${OLD}", "${NEW}"},
+		{"http://${OLD}:${PORT}/${OLD}", "http://${NEW}:${PORT}/${NEW}"},
+		{"${OLD_SUFFIX}", "${OLD_SUFFIX}"},
+		{"${OLD:-fallback}", "${NEW:-fallback}"},
+		{"${upper(trim(OLD:-x))}", "${upper(trim(NEW:-x))}"},
+		{"${b64(OLD_SUFFIX)}", "${b64(OLD_SUFFIX)}"},
+		{"no references", "no references"},
+	}
+
+	for _, tt := range tests {
+		if result := RenameVariable(tt.value, "OLD", "NEW"); result != tt.expected {
+			t.Errorf("RenameVariable(%q): expected %q, got %q", tt.value, tt.expected, result)
+		}
+	}
+}
+
+func TestRenameApp(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"${app:api:URL}", "${app:gateway:URL}"},
+		{"${app:api:URL}/v1?k=${app:api:KEY:-none}", "${app:gateway:URL}/v1?k=${app:gateway:KEY:-none}"},
+		{"${lower(app:api:HOST)}", "${lower(app:gateway:HOST)}"},
+		{"${app:api-v2:URL}", "${app:api-v2:URL}"},
+		{"${api:URL}", "${api:URL}"},
+		{"${URL}", "${URL}"},
+	}
+
+	for _, tt := range tests {
+		if result := RenameApp(tt.value, "api", "gateway"); result != tt.expected {
+			t.Errorf("RenameApp(%q): expected %q, got %q", tt.value, tt.expected, result)
+		}
+	}
+}
+
+func TestReferences(t *testing.T) {
+	got := References("http://${_HOST}:${upper(PORT:-80)}/${env:USER}${_HOST}")
+	expected := []string{"_HOST", "PORT", "env:USER", "_HOST"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+	if got := References("no references"); len(got) != 0 {
+		t.Errorf("Expected no references, got %v", got)
+	}
+}
@@ -15,14 +15,59 @@ func main() {
 		Name:    "puff",
 		Usage:   "GitOps secret and environment variable management tool",
 		Version: version,
+		Flags:   []cli.Flag{commands.OutputFlag(), commands.JobsFlag()},
 		Commands: []*cli.Command{
 			commands.InitCommand(),
+			commands.StatusCommand(),
+			commands.DoctorCommand(),
+			commands.MigrateCommand(),
+			commands.AppsCommand(),
+			commands.AppCommand(),
+			commands.EnvsCommand(),
+			commands.EnvCommand(),
+			commands.TargetsCommand(),
 			commands.KeysCommand(),
 			commands.GetCommand(),
+			commands.ListCommand(),
+			commands.GrepCommand(),
+			commands.ExplainCommand(),
+			commands.HistoryCommand(),
+			commands.RotateReportCommand(),
+			commands.AuditCommand(),
+			commands.DiffCommand(),
+			commands.PromoteCommand(),
 			commands.SetCommand(),
+			commands.UnsetCommand(),
+			commands.ImportCommand(),
+			commands.RenameCommand(),
+			commands.MvCommand(),
 			commands.GenerateCommand(),
+			commands.TemplateCommand(),
+			commands.SampleCommand(),
+			commands.DocsCommand(),
+			commands.RunCommand(),
+			commands.MaskCommand(),
+			commands.AgentCommand(),
+			commands.ApplyCommand(),
+			commands.DriftCommand(),
+			commands.SyncCommand(),
+			commands.EditCommand(),
+			commands.CatCommand(),
 			commands.DecryptCommand(),
 			commands.EncryptCommand(),
+			commands.ReencryptCommand(),
+			commands.VerifyCommand(),
+			commands.ScanCommand(),
+			commands.LintCommand(),
+			commands.CICheckCommand(),
+			commands.PruneCommand(),
+			commands.SnapshotCommand(),
+			commands.RestoreCommand(),
+			commands.ExportCommand(),
+			commands.HooksCommand(),
+			commands.GitConfigCommand(),
+			commands.GitTextconvCommand(),
+			commands.GitMergeCommand(),
 		},
 		Before: func(c *cli.Context) error {
 			// Set up color output
@@ -31,6 +76,21 @@ func main() {
 		},
 	}
 
+	// Defaults in .puff.yaml become flag defaults, dimensions declared there
+	// become flags such as --region, and --profile selects a named set of flags
+	if err := commands.ApplyDefaults(app.Commands, os.Args); err != nil {
+		color.Red("Error: %v", err)
+		os.Exit(1)
+	}
+	if err := commands.AddDimensionFlags(app.Commands, os.Args); err != nil {
+		color.Red("Error: %v", err)
+		os.Exit(1)
+	}
+	if err := commands.ApplyProfile(app.Commands, os.Args); err != nil {
+		color.Red("Error: %v", err)
+		os.Exit(1)
+	}
+
 	if err := app.Run(os.Args); err != nil {
 		color.Red("Error: %v", err)
 		os.Exit(1)
@@ -0,0 +1,183 @@
+package puff
+
+import (
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/output"
+)
+
+// Format is an output format for Config.Format
+type Format string
+
+// Output formats, as accepted by 'puff generate --format'
+const (
+	FormatEnv            Format = "env"
+	FormatJSON           Format = "json"
+	FormatYAML           Format = "yaml"
+	FormatK8s            Format = "k8s"
+	FormatExternalSecret Format = "external-secret"
+	FormatPushSecret     Format = "push-secret"
+	FormatTfvars         Format = "tfvars"
+	FormatTfvarsJSON     Format = "tfvars-json"
+	FormatECS            Format = "ecs"
+	FormatNomad          Format = "nomad"
+	FormatGitHubEnv      Format = "github-env"
+	FormatTemplate       Format = "template"
+)
+
+// Kubernetes secret types the k8s format can write, as accepted by
+// 'puff generate --type'
+const (
+	SecretTypeOpaque           = output.SecretTypeOpaque
+	SecretTypeTLS              = output.SecretTypeTLS
+	SecretTypeDockerConfigJSON = output.SecretTypeDockerConfigJSON
+)
+
+// SecretTypeKeys names the config keys that typed Kubernetes secrets are
+// built from. Keys left empty come from the kubernetes settings in
+// .puff.yaml, or their defaults, such as TLS_CERT and TLS_KEY.
+type SecretTypeKeys struct {
+	// For kubernetes.io/tls: the keys that become tls.crt and tls.key
+	TLSCert string
+	TLSKey  string
+
+	// For kubernetes.io/dockerconfigjson: the keys holding the registry
+	// credentials. The email is optional.
+	DockerRegistry string
+	DockerUsername string
+	DockerPassword string
+	DockerEmail    string
+}
+
+// PluginFormat returns the format rendered by the puff-format-NAME plugin
+// on PATH
+func PluginFormat(name string) Format {
+	return Format(output.PluginFormat(name))
+}
+
+// FormatOptions holds the settings some formats need, matching the flags of
+// 'puff generate'
+type FormatOptions struct {
+	// SecretName names the Kubernetes secret of the k8s, external-secret and
+	// push-secret formats
+	SecretName string
+	// Base64 encodes k8s secret values
+	Base64 bool
+	// SecretType is the type of the k8s format's secret, SecretTypeOpaque by
+	// default, and TypeKeys the keys typed secrets are built from
+	SecretType string
+	TypeKeys   SecretTypeKeys
+	// BinaryKeys are the keys holding base64-encoded binary values, which
+	// the k8s format puts in the secret's data as they are. Nil means the
+	// keys meta.yml records as binary, as set with 'puff set --binary'.
+	BinaryKeys []string
+
+	// Namespace is the namespace of the Kubernetes manifests or the Nomad
+	// variable
+	Namespace string
+	// Labels and Annotations are added to the metadata of the k8s,
+	// external-secret and push-secret manifests, and Checksum annotates the
+	// k8s and push-secret formats' secrets with the checksum of their data
+	Labels      map[string]string
+	Annotations map[string]string
+	Checksum    bool
+
+	// NestDelimiter splits keys into nested objects in the json and yaml
+	// formats, e.g. "__"
+	NestDelimiter string
+
+	// SecretStore, SecretStoreKind and RemoteKeyPrefix configure the
+	// external-secret and push-secret formats
+	SecretStore     string
+	SecretStoreKind string
+	RemoteKeyPrefix string
+
+	// SensitiveKeys and SSMArnPrefix configure the ecs format
+	SensitiveKeys []string
+	SSMArnPrefix  string
+
+	// NomadKind is what the nomad format writes: "var" (the default), a
+	// Nomad Variables spec for nomad var put, or "template", a job spec
+	// template block. NomadPath is the variable's path, nomad/jobs/APP by
+	// default, and NomadDestination the file the template block writes,
+	// secrets/APP.env by default.
+	NomadKind        string
+	NomadPath        string
+	NomadDestination string
+
+	// Template is the Go template text of the template format
+	Template string
+}
+
+// Format resolves the config and renders its values in a format, leaving out
+// underscore-prefixed internal variables, as 'puff generate' does
+func (c *Config) Format(format Format, opts FormatOptions) (string, error) {
+	resolved, err := c.Resolve()
+	if err != nil {
+		return "", err
+	}
+	values := make(map[string]interface{})
+	for key, value := range resolved {
+		if len(key) > 0 && key[0] != '_' {
+			values[key] = value
+		}
+	}
+
+	if opts.NomadPath == "" {
+		opts.NomadPath = "nomad/jobs/" + c.ctx.App
+	}
+	if opts.NomadDestination == "" {
+		opts.NomadDestination = "secrets/" + c.ctx.App + ".env"
+	}
+	if opts.BinaryKeys == nil {
+		metadata, err := config.LoadMetadata(c.ctx.RootDir)
+		if err != nil {
+			return "", err
+		}
+		opts.BinaryKeys = metadata.BinaryKeys()
+	}
+	project, err := config.LoadProject(c.ctx.RootDir)
+	if err != nil {
+		return "", err
+	}
+	tlsKeys := project.Kubernetes.TLS.WithDefaults()
+	dockerKeys := project.Kubernetes.DockerConfig.WithDefaults()
+	typeKeys := output.SecretTypeKeys{
+		TLSCert:        valueOr(opts.TypeKeys.TLSCert, tlsKeys.Cert),
+		TLSKey:         valueOr(opts.TypeKeys.TLSKey, tlsKeys.Key),
+		DockerRegistry: valueOr(opts.TypeKeys.DockerRegistry, dockerKeys.Registry),
+		DockerUsername: valueOr(opts.TypeKeys.DockerUsername, dockerKeys.Username),
+		DockerPassword: valueOr(opts.TypeKeys.DockerPassword, dockerKeys.Password),
+		DockerEmail:    valueOr(opts.TypeKeys.DockerEmail, dockerKeys.Email),
+	}
+
+	return output.FormatOutput(values, output.FormatOptions{
+		Format:           output.Format(format),
+		SecretName:       opts.SecretName,
+		Base64:           opts.Base64,
+		BinaryKeys:       opts.BinaryKeys,
+		SecretType:       opts.SecretType,
+		TypeKeys:         typeKeys,
+		Namespace:        opts.Namespace,
+		Labels:           opts.Labels,
+		Annotations:      opts.Annotations,
+		Checksum:         opts.Checksum,
+		NestDelimiter:    opts.NestDelimiter,
+		SecretStore:      opts.SecretStore,
+		SecretStoreKind:  opts.SecretStoreKind,
+		RemoteKeyPrefix:  opts.RemoteKeyPrefix,
+		SensitiveKeys:    opts.SensitiveKeys,
+		SSMArnPrefix:     opts.SSMArnPrefix,
+		NomadKind:        opts.NomadKind,
+		NomadPath:        opts.NomadPath,
+		NomadDestination: opts.NomadDestination,
+		Template:         opts.Template,
+	})
+}
+
+// valueOr returns value, or fallback if value is empty
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,176 @@
+// Package puff is the Go API for puff configuration directories. It lets Go
+// services and tools load, resolve, format and change config the way the puff
+// command does, without running the binary and parsing its output.
+//
+// The API follows semantic versioning along with the puff module: exported
+// names in this package are not removed or changed incompatibly within a
+// major version. Everything under internal/ may change at any time.
+//
+//	cfg, err := puff.Load(puff.Context{RootDir: "config", App: "api", Env: "prod"})
+//	if err != nil {
+//		return err
+//	}
+//	values, err := cfg.Resolve()
+//
+// Decrypting files needs the same keys as the puff command, e.g. an age
+// identity in SOPS_AGE_KEY or SOPS_AGE_KEY_FILE.
+package puff
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/dotenv"
+	"github.com/teamcurri/puff/internal/keys"
+	"github.com/teamcurri/puff/internal/resolve"
+	"github.com/teamcurri/puff/internal/store"
+)
+
+// Context selects the config to load
+type Context struct {
+	// RootDir is the config root, the directory holding .sops.yaml. It
+	// defaults to the current directory.
+	RootDir string
+
+	App    string
+	Env    string
+	Target string
+
+	// Dimensions holds values for the extra precedence dimensions declared
+	// in .puff.yaml, such as a region, keyed by dimension name
+	Dimensions map[string]string
+
+	// HostEnv, if set, is used for ${env:NAME} references instead of this
+	// process's environment
+	HostEnv map[string]string
+
+	// NoHostEnv disables ${env:NAME} references, for hermetic builds
+	NoHostEnv bool
+
+	// Identity, if set, is an age identity (AGE-SECRET-KEY-1...) to decrypt
+	// with instead of those SOPS finds in the environment. It applies to
+	// this load only.
+	Identity string
+}
+
+// Config is the merged, unresolved config of a context. Its methods may be
+// called concurrently, except for Set, which must not run alongside any
+// other method.
+type Config struct {
+	ctx config.LoadContext
+	cfg *config.Config
+}
+
+// Load reads and decrypts the files of a context and merges them in order of
+// precedence
+func Load(ctx Context) (*Config, error) {
+	rootDir := ctx.RootDir
+	if rootDir == "" {
+		rootDir = "."
+	}
+	loadCtx := config.LoadContext{
+		RootDir:    rootDir,
+		App:        ctx.App,
+		Env:        ctx.Env,
+		Target:     ctx.Target,
+		Dimensions: ctx.Dimensions,
+		NoHostEnv:  ctx.NoHostEnv,
+		Cache:      config.NewFileCache(),
+	}
+	if hostEnv := ctx.HostEnv; hostEnv != nil {
+		loadCtx.LookupHostEnv = func(name string) (string, bool) {
+			value, ok := hostEnv[name]
+			return value, ok
+		}
+	}
+	if ctx.Identity != "" {
+		decrypt, err := keys.IdentityDecrypter(ctx.Identity)
+		if err != nil {
+			return nil, err
+		}
+		loadCtx.Decrypt = decrypt
+	}
+	cfg, err := config.Load(loadCtx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	return &Config{ctx: loadCtx, cfg: cfg}, nil
+}
+
+// Keys returns the sorted names of the config's top-level keys, leaving out
+// underscore-prefixed internal variables
+func (c *Config) Keys() []string {
+	keys := c.cfg.ExportKeys()
+	sort.Strings(keys)
+	return keys
+}
+
+// Get returns the value of a key or dotted path, such as DB.host, before
+// template variables are resolved
+func (c *Config) Get(key string) (interface{}, bool) {
+	return config.Lookup(c.cfg.Values, key)
+}
+
+// Source returns the file a top-level key comes from, relative to the config
+// root
+func (c *Config) Source(key string) (string, bool) {
+	source, ok := c.cfg.Source(key)
+	if !ok {
+		return "", false
+	}
+	return relativeSource(c.ctx.RootDir, source), true
+}
+
+// Files returns the files the config was merged from, lowest precedence
+// first, relative to the config root
+func (c *Config) Files() []string {
+	files := c.cfg.Files()
+	for i, file := range files {
+		files[i] = relativeSource(c.ctx.RootDir, file)
+	}
+	return files
+}
+
+// Resolve returns the config's values with template variables such as
+// ${DB_HOST}, ${env:NAME} and ${app:NAME:KEY} resolved. Internal variables
+// are included.
+func (c *Config) Resolve() (map[string]interface{}, error) {
+	return resolve.Loaded(c.ctx, c.cfg)
+}
+
+// Set sets a key or dotted path in the file of the config's context, or in
+// the store the naming convention in .puff.yaml picks if levels are split
+// into plaintext and encrypted stores. The file is encrypted like the rest of
+// the directory, the change is recorded in the audit log if that is enabled,
+// and the config is reloaded. A context can select a file by a target or a
+// dimension value, not both.
+func (c *Config) Set(key, value string) error {
+	filePath, err := store.ContextFile(c.ctx.RootDir, c.ctx.App, c.ctx.Env, c.ctx.Target, c.ctx.Dimensions)
+	if err != nil {
+		return err
+	}
+	_, records, err := store.Set(c.ctx.RootDir, filePath, []dotenv.Entry{{Key: key, Value: value}}, store.PlaceByName)
+	if err != nil {
+		return err
+	}
+	if err := store.RecordAudit(c.ctx.RootDir, "set", records...); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(c.ctx)
+	if err != nil {
+		return fmt.Errorf("failed to reload config: %w", err)
+	}
+	c.cfg = cfg
+	return nil
+}
+
+// relativeSource returns a file relative to the config root
+func relativeSource(rootDir, source string) string {
+	if rel, err := filepath.Rel(rootDir, source); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return source
+}
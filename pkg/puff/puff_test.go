@@ -0,0 +1,190 @@
+package puff
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/teamcurri/puff/internal/keys"
+)
+
+// newTestRoot creates a config root encrypted to a fresh age key, with
+// shared values, an app referencing another app, and the key in SOPS_AGE_KEY
+func newTestRoot(t *testing.T) string {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SOPS_AGE_KEY", identity.String())
+	recipient := identity.Recipient().String()
+
+	rootDir := t.TempDir()
+	os.WriteFile(filepath.Join(rootDir, ".sops.yaml"), []byte("creation_rules:\n  - age: "+recipient+"\n"), 0644)
+	for file, content := range map[string]string{
+		"base/shared.yml": "DB_HOST: localhost\n_PREFIX: app\n",
+		"base/api.yml":    "NAME: ${_PREFIX}-api\nDB_URL: postgres://${DB_HOST}/api\n",
+		"base/web.yml":    "API_NAME: ${app:api:NAME}\n",
+		"dev/shared.yml":  "DB_HOST: db.dev\n",
+	} {
+		path := filepath.Join(rootDir, file)
+		os.MkdirAll(filepath.Dir(path), 0700)
+		encrypted, err := keys.EncryptData([]byte(content), path, []string{recipient})
+		if err != nil {
+			t.Fatalf("Failed to encrypt %s: %v", file, err)
+		}
+		os.WriteFile(path, encrypted, 0600)
+	}
+	return rootDir
+}
+
+func TestLoadAndResolve(t *testing.T) {
+	rootDir := newTestRoot(t)
+
+	cfg, err := Load(Context{RootDir: rootDir, App: "api", Env: "dev"})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if keys := cfg.Keys(); !reflect.DeepEqual(keys, []string{"DB_HOST", "DB_URL", "NAME"}) {
+		t.Errorf("Expected sorted keys without internal variables, got %v", keys)
+	}
+	if value, ok := cfg.Get("DB_URL"); !ok || value != "postgres://${DB_HOST}/api" {
+		t.Errorf("Expected the unresolved value, got %v", value)
+	}
+	if source, ok := cfg.Source("DB_HOST"); !ok || source != "dev/shared.yml" {
+		t.Errorf("Expected DB_HOST from dev/shared.yml, got %q", source)
+	}
+
+	values, err := cfg.Resolve()
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if values["DB_URL"] != "postgres://db.dev/api" || values["NAME"] != "app-api" {
+		t.Errorf("Unexpected resolved values: %v", values)
+	}
+
+	web, err := Load(Context{RootDir: rootDir, App: "web", Env: "dev"})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if values, err := web.Resolve(); err != nil || values["API_NAME"] != "app-api" {
+		t.Errorf("Expected ${app:api:NAME} to resolve, got %v (%v)", values, err)
+	}
+
+	out, err := cfg.Format(FormatEnv, FormatOptions{})
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+	if !strings.Contains(out, "DB_URL=postgres://db.dev/api") || strings.Contains(out, "_PREFIX") {
+		t.Errorf("Unexpected env output:\n%s", out)
+	}
+	if _, err := cfg.Format(FormatK8s, FormatOptions{}); err == nil {
+		t.Error("Expected k8s format without a secret name to fail")
+	}
+
+	// The nomad paths default to the app's, as in 'puff generate'
+	if out, err := cfg.Format(FormatNomad, FormatOptions{}); err != nil || !strings.Contains(out, `path = "nomad/jobs/api"`) {
+		t.Errorf("Unexpected nomad output (%v):\n%s", err, out)
+	}
+	if out, err := cfg.Format(FormatNomad, FormatOptions{NomadKind: "template"}); err != nil || !strings.Contains(out, `destination = "secrets/api.env"`) {
+		t.Errorf("Unexpected nomad template output (%v):\n%s", err, out)
+	}
+}
+
+func TestSet(t *testing.T) {
+	rootDir := newTestRoot(t)
+
+	cfg, err := Load(Context{RootDir: rootDir, App: "api", Env: "dev"})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if err := cfg.Set("API_KEY", "secret"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if value, ok := cfg.Get("API_KEY"); !ok || value != "secret" {
+		t.Errorf("Expected the config to be reloaded, got %v", value)
+	}
+	if source, _ := cfg.Source("API_KEY"); source != "dev/api.yml" {
+		t.Errorf("Expected API_KEY in dev/api.yml, got %q", source)
+	}
+
+	data, err := os.ReadFile(filepath.Join(rootDir, "dev", "api.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret") || !strings.Contains(string(data), "sops:") {
+		t.Errorf("Expected dev/api.yml to be encrypted:\n%s", data)
+	}
+
+	reloaded, err := Load(Context{RootDir: rootDir, App: "api", Env: "dev"})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if value, _ := reloaded.Get("API_KEY"); value != "secret" {
+		t.Errorf("Expected API_KEY to be persisted, got %v", value)
+	}
+}
+
+func TestFormatKubernetes(t *testing.T) {
+	rootDir := newTestRoot(t)
+
+	cfg, err := Load(Context{RootDir: rootDir, App: "api", Env: "dev"})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	for key, value := range map[string]string{"TLS_CERT": "cert", "TLS_KEY": "key", "CERT_PEM": "other-cert"} {
+		if err := cfg.Set(key, value); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	// Typed secrets take their keys from the defaults unless given
+	out, err := cfg.Format(FormatK8s, FormatOptions{SecretName: "api-tls", SecretType: SecretTypeTLS})
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+	if !strings.Contains(out, "type: kubernetes.io/tls") || !strings.Contains(out, "tls.crt: cert") || strings.Contains(out, "DB_URL") {
+		t.Errorf("Unexpected TLS secret:\n%s", out)
+	}
+	out, err = cfg.Format(FormatK8s, FormatOptions{SecretName: "api-tls", SecretType: SecretTypeTLS, TypeKeys: SecretTypeKeys{TLSCert: "CERT_PEM"}})
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+	if !strings.Contains(out, "tls.crt: other-cert") || !strings.Contains(out, "tls.key: key") {
+		t.Errorf("Expected tls.crt from CERT_PEM, got:\n%s", out)
+	}
+	if _, err := cfg.Format(FormatK8s, FormatOptions{SecretName: "api", SecretType: "kubernetes.io/ssh-auth"}); err == nil {
+		t.Error("Expected an unsupported secret type to fail")
+	}
+
+	// Binary values recorded in meta.yml go into the data as they are,
+	// not encoded a second time
+	os.WriteFile(filepath.Join(rootDir, "meta.yml"), []byte("keys:\n  KEYSTORE:\n    encoding: base64\n"), 0644)
+	if err := cfg.Set("KEYSTORE", "AAEC"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	out, err = cfg.Format(FormatK8s, FormatOptions{
+		SecretName:  "api",
+		Base64:      true,
+		Labels:      map[string]string{"team": "payments"},
+		Annotations: map[string]string{"owner": "ops"},
+		Checksum:    true,
+	})
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+	for _, want := range []string{"KEYSTORE: AAEC", "team: payments", "owner: ops", "puff/checksum:"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %q in the secret:\n%s", want, out)
+		}
+	}
+	out, err = cfg.Format(FormatK8s, FormatOptions{SecretName: "api", Base64: true, BinaryKeys: []string{}})
+	if err != nil {
+		t.Fatalf("Format failed: %v", err)
+	}
+	if !strings.Contains(out, "KEYSTORE: QUFFQw==") {
+		t.Errorf("Expected KEYSTORE encoded as text without binary keys:\n%s", out)
+	}
+}
@@ -0,0 +1,216 @@
+// Package runtime loads an application's puff config at startup and keeps it
+// up to date while the application runs. It is built on package puff and
+// shares its compatibility promise. Import it under another name to avoid
+// confusion with the standard library:
+//
+//	import puffruntime "github.com/teamcurri/puff/pkg/runtime"
+//
+//	cfg, err := puffruntime.Load(puffruntime.Options{
+//		Context: puff.Context{RootDir: "/etc/app/config", App: "api", Env: "prod"},
+//	})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	dbURL, _ := cfg.Get("DATABASE_URL")
+//	go cfg.Watch(ctx, func(values map[string]interface{}, err error) { ... })
+package runtime
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/teamcurri/puff/internal/config"
+	"github.com/teamcurri/puff/internal/output"
+	"github.com/teamcurri/puff/pkg/puff"
+)
+
+// DefaultInterval is how often Watch checks for changes unless
+// Options.Interval is set
+const DefaultInterval = 5 * time.Second
+
+// Options configures a runtime config
+type Options struct {
+	// Context selects the app, environment and target to load. Its
+	// Identity, if set, decrypts this config on every reload; the process
+	// environment is left alone.
+	puff.Context
+
+	// Interval is how often Watch checks the config files for changes
+	Interval time.Duration
+}
+
+// Config is the resolved config of an application. It is safe for concurrent
+// use.
+type Config struct {
+	opts Options
+
+	mu          sync.RWMutex
+	values      map[string]interface{}
+	fingerprint [sha256.Size]byte
+}
+
+// Load loads and resolves the config selected by opts. Underscore-prefixed
+// internal variables are left out, as in 'puff generate'.
+func Load(opts Options) (*Config, error) {
+	if opts.RootDir == "" {
+		opts.RootDir = "."
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+
+	c := &Config{opts: opts}
+	fingerprint, err := c.scan()
+	if err != nil {
+		return nil, err
+	}
+	values, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	c.values = values
+	c.fingerprint = fingerprint
+	return c, nil
+}
+
+// Values returns the config's values. Nested maps and lists are shared and
+// must not be modified.
+func (c *Config) Values() map[string]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	values := make(map[string]interface{}, len(c.values))
+	for key, value := range c.values {
+		values[key] = value
+	}
+	return values
+}
+
+// Get returns the value of a key as a string, as it would appear in a .env
+// file: maps and lists are encoded as JSON
+func (c *Config) Get(key string) (string, bool) {
+	c.mu.RLock()
+	value, ok := c.values[key]
+	c.mu.RUnlock()
+	if !ok {
+		return "", false
+	}
+	return output.StringValues(map[string]interface{}{key: value})[key], true
+}
+
+// Watch checks the config files for changes every Options.Interval until ctx
+// is done, and reloads the config when they change. onChange is called with
+// the new values when they differ from the old ones, or with the error if the
+// changed files can't be loaded, e.g. while a file is being edited. The
+// previous values are kept until a reload succeeds. Watch returns ctx's error.
+func (c *Config) Watch(ctx context.Context, onChange func(values map[string]interface{}, err error)) error {
+	ticker := time.NewTicker(c.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		fingerprint, err := c.scan()
+		if err != nil {
+			onChange(nil, err)
+			continue
+		}
+		c.mu.RLock()
+		changed := fingerprint != c.fingerprint
+		c.mu.RUnlock()
+		if !changed {
+			continue
+		}
+
+		// Errors are reported once per change to the files, not every tick
+		values, err := c.load()
+		c.mu.Lock()
+		c.fingerprint = fingerprint
+		unchanged := err == nil && reflect.DeepEqual(values, c.values)
+		if err == nil {
+			c.values = values
+		}
+		c.mu.Unlock()
+
+		switch {
+		case err != nil:
+			onChange(nil, err)
+		case !unchanged:
+			onChange(c.Values(), nil)
+		}
+	}
+}
+
+// load loads and resolves the config, leaving out internal variables
+func (c *Config) load() (map[string]interface{}, error) {
+	cfg, err := puff.Load(c.opts.Context)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := cfg.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]interface{})
+	for key, value := range resolved {
+		if !strings.HasPrefix(key, "_") {
+			values[key] = value
+		}
+	}
+	return values, nil
+}
+
+// scan fingerprints the size and modification time of every config file in
+// the root, along with .puff.yaml and .sops.yaml. Every file counts, not just
+// the app's, since ${app:NAME:KEY} references read other apps' files.
+func (c *Config) scan() ([sha256.Size]byte, error) {
+	hash := sha256.New()
+	rootDir := c.opts.RootDir
+	err := filepath.WalkDir(rootDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Files can be renamed away mid-walk while they're written
+			if os.IsNotExist(err) && path != rootDir {
+				return nil
+			}
+			return err
+		}
+		name := entry.Name()
+		if entry.IsDir() {
+			if path != rootDir && (strings.HasPrefix(name, ".") || path == filepath.Join(rootDir, config.AuditDir)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !config.IsConfigFileName(name) && name != config.ProjectFile && name != ".sops.yaml" {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		fmt.Fprintf(hash, "%s\x00%d\x00%d\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return [sha256.Size]byte{}, fmt.Errorf("failed to scan %s: %w", rootDir, err)
+	}
+
+	var fingerprint [sha256.Size]byte
+	hash.Sum(fingerprint[:0])
+	return fingerprint, nil
+}
@@ -0,0 +1,105 @@
+package runtime
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/teamcurri/puff/internal/keys"
+	"github.com/teamcurri/puff/pkg/puff"
+)
+
+func TestLoadAndWatch(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the identity given to Load can decrypt
+	t.Setenv("SOPS_AGE_KEY", "")
+	t.Setenv("SOPS_AGE_KEY_FILE", filepath.Join(t.TempDir(), "keys.txt"))
+	recipient := identity.Recipient().String()
+
+	rootDir := t.TempDir()
+	os.WriteFile(filepath.Join(rootDir, ".sops.yaml"), []byte("creation_rules:\n  - age: "+recipient+"\n"), 0644)
+	os.MkdirAll(filepath.Join(rootDir, "base"), 0700)
+	sharedPath := filepath.Join(rootDir, "base", "shared.yml")
+	encrypted, err := keys.EncryptData([]byte("_HOST: db\nDB_URL: postgres://${_HOST}\nDB:\n  host: db\nPORT: 5432\n"), sharedPath, []string{recipient})
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(sharedPath, encrypted, 0600)
+
+	cfg, err := Load(Options{
+		Context:  puff.Context{RootDir: rootDir, App: "api", Env: "dev", Identity: identity.String()},
+		Interval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if key := os.Getenv("SOPS_AGE_KEY"); key != "" {
+		t.Error("Expected Load to leave SOPS_AGE_KEY unset")
+	}
+	if port, ok := cfg.Get("PORT"); !ok || port != "5432" {
+		t.Errorf("Expected PORT 5432, got %q", port)
+	}
+	if url, _ := cfg.Get("DB_URL"); url != "postgres://db" {
+		t.Errorf("Expected DB_URL to be resolved, got %q", url)
+	}
+	if db, _ := cfg.Get("DB"); db != `{"host":"db"}` {
+		t.Errorf("Expected DB as JSON, got %q", db)
+	}
+	if _, ok := cfg.Get("_HOST"); ok {
+		t.Error("Expected internal variables to be left out")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := make(chan map[string]interface{}, 10)
+	done := make(chan error)
+	go func() {
+		done <- cfg.Watch(ctx, func(values map[string]interface{}, err error) {
+			if err != nil {
+				t.Errorf("Unexpected reload error: %v", err)
+				return
+			}
+			updates <- values
+		})
+	}()
+
+	sdk, err := puff.Load(puff.Context{RootDir: rootDir, App: "api", Env: "dev", Identity: identity.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sdk.Set("PORT", "6543"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case values := <-updates:
+		if values["PORT"] != "6543" {
+			t.Errorf("Expected the updated PORT, got %v", values["PORT"])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a change to be reported")
+	}
+	if port, _ := cfg.Get("PORT"); port != "6543" {
+		t.Errorf("Expected Get to return the updated PORT, got %q", port)
+	}
+
+	// Touching a file without changing its values isn't reported
+	now := time.Now().Add(time.Second)
+	os.Chtimes(sharedPath, now, now)
+	select {
+	case values := <-updates:
+		t.Errorf("Expected no report for unchanged values, got %v", values)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Expected Watch to return the context's error, got %v", err)
+	}
+}
@@ -12,10 +12,10 @@ func TestEdgeCase_InitWithoutAgeKeys(t *testing.T) {
 	env := helpers.NewTestEnv(t)
 	defer env.Cleanup()
 
-	// Try to init without providing age keys (should fail since -k is required)
+	// Try to init without providing age keys or KMS ARNs
 	result := env.Run("init", "-d", ".")
 	result.AssertFailure()
-	result.AssertStderrContains("Required flag")
+	result.AssertStderrContains("at least one age public key")
 }
 
 // TestEdgeCase_InitInNonEmptyDirectory tests initialization in a directory with existing files
@@ -224,6 +224,26 @@ func TestEdgeCase_OverwriteExistingKey(t *testing.T) {
 		AssertStdoutEquals("updated_value")
 }
 
+// TestEdgeCase_UnsetNonExistentKey tests removing a key that doesn't exist
+func TestEdgeCase_UnsetNonExistentKey(t *testing.T) {
+	env := helpers.NewTestEnv(t)
+	defer env.Cleanup()
+
+	env.Init().AssertSuccess()
+
+	env.Set("KEY", "value", "-a", "api", "-e", "dev").
+		AssertSuccess()
+
+	env.Unset("MISSING", "-a", "api", "-e", "dev").
+		AssertFailure().
+		AssertStderrContains("key not found")
+
+	// File that doesn't exist
+	env.Unset("KEY", "-a", "worker", "-e", "dev").
+		AssertFailure().
+		AssertStderrContains("does not exist")
+}
+
 // TestEdgeCase_GenerateNonExistentApp tests generating config for non-existent app
 func TestEdgeCase_GenerateNonExistentApp(t *testing.T) {
 	env := helpers.NewTestEnv(t)
@@ -261,6 +281,31 @@ func TestEdgeCase_GenerateWithoutRequiredK8sSecretName(t *testing.T) {
 	result.AssertStderrContains("secret-name is required")
 }
 
+// TestEdgeCase_ApplyWithMissingKubeconfig tests apply when the kubeconfig cannot be loaded
+func TestEdgeCase_ApplyWithMissingKubeconfig(t *testing.T) {
+	env := helpers.NewTestEnv(t)
+	defer env.Cleanup()
+
+	env.Init().AssertSuccess()
+	env.Set("KEY", "value", "-a", "api", "-e", "dev").AssertSuccess()
+
+	env.Run("apply", "-a", "api", "-e", "dev", "--secret-name", "api", "--kubeconfig", "missing-kubeconfig", "-r", ".").
+		AssertFailure().
+		AssertStderrContains("failed to load kubeconfig")
+}
+
+// TestEdgeCase_SyncAzureKVInvalidNaming tests azure-kv sync with an unknown naming convention
+func TestEdgeCase_SyncAzureKVInvalidNaming(t *testing.T) {
+	env := helpers.NewTestEnv(t)
+	defer env.Cleanup()
+
+	env.Init().AssertSuccess()
+
+	env.Run("sync", "azure-kv", "-a", "api", "-e", "dev", "--vault", "myvault", "--naming", "camel", "-r", ".").
+		AssertFailure().
+		AssertStderrContains("invalid naming convention")
+}
+
 // TestEdgeCase_DecryptNonEncryptedFile tests decrypting a file that isn't encrypted
 func TestEdgeCase_DecryptNonEncryptedFile(t *testing.T) {
 	env := helpers.NewTestEnv(t)
@@ -432,6 +477,94 @@ func TestEdgeCase_UndefinedTemplateVariable(t *testing.T) {
 	}
 }
 
+// TestEdgeCase_TemplateDefaultValue tests ${VAR:-default} fallbacks in shared templates
+func TestEdgeCase_TemplateDefaultValue(t *testing.T) {
+	env := helpers.NewTestEnv(t)
+	defer env.Cleanup()
+
+	env.Init().AssertSuccess()
+
+	// One shared template, with inputs only the api defines
+	env.Set("DATABASE_URL", "postgres://${DB_HOST:-localhost}:5432/${DB_NAME:-app}").AssertSuccess()
+	env.Set("DB_HOST", "db.internal", "-a", "api", "-e", "dev").AssertSuccess()
+	env.Set("PORT", "9000", "-a", "worker", "-e", "dev").AssertSuccess()
+
+	env.Get("DATABASE_URL", "-a", "api", "-e", "dev").
+		AssertSuccess().
+		AssertStdoutEquals("postgres://db.internal:5432/app")
+	env.Get("DATABASE_URL", "-a", "worker", "-e", "dev").
+		AssertSuccess().
+		AssertStdoutEquals("postgres://localhost:5432/app")
+}
+
+// TestEdgeCase_HostEnvReferences tests ${env:NAME} references and --no-host-env
+func TestEdgeCase_HostEnvReferences(t *testing.T) {
+	env := helpers.NewTestEnv(t)
+	defer env.Cleanup()
+
+	env.Init().AssertSuccess()
+	env.Set("IMAGE_TAG", "${env:PUFF_TEST_SHA:-latest}", "-a", "api", "-e", "dev").AssertSuccess()
+	env.Set("DEPLOYED_BY", "${env:PUFF_TEST_USER}", "-a", "api", "-e", "dev").AssertSuccess()
+
+	hostEnv := map[string]string{"PUFF_TEST_SHA": "abc123", "PUFF_TEST_USER": "ci"}
+	env.RunWithEnv(hostEnv, "get", "-k", "IMAGE_TAG", "-a", "api", "-e", "dev", "-r", ".").
+		AssertSuccess().
+		AssertStdoutEquals("abc123")
+
+	// A missing variable without a default is an error
+	env.Get("DEPLOYED_BY", "-a", "api", "-e", "dev").
+		AssertFailure().
+		AssertStderrContains("undefined host environment variable referenced: PUFF_TEST_USER")
+
+	// Hermetic builds ignore the environment, so only defaults apply
+	env.RunWithEnv(hostEnv, "generate", "-a", "api", "-e", "dev", "-f", "env", "--no-host-env", "-r", ".").
+		AssertFailure().
+		AssertStderrContains("host environment references are disabled")
+	env.Set("DEPLOYED_BY", "${env:PUFF_TEST_USER:-unknown}", "-a", "api", "-e", "dev").AssertSuccess()
+	env.RunWithEnv(hostEnv, "generate", "-a", "api", "-e", "dev", "-f", "env", "--no-host-env", "-r", ".").
+		AssertSuccess().
+		AssertStdoutContains("IMAGE_TAG=latest").
+		AssertStdoutContains("DEPLOYED_BY=unknown")
+}
+
+// TestEdgeCase_AppReferences tests ${app:NAME:KEY} references to another
+// app's resolved values
+func TestEdgeCase_AppReferences(t *testing.T) {
+	env := helpers.NewTestEnv(t)
+	defer env.Cleanup()
+
+	env.Init().AssertSuccess()
+	env.Set("DOMAIN", "example.com", "-e", "prod").AssertSuccess()
+	env.Set("PUBLIC_URL", "https://pay.${DOMAIN}", "-a", "payments", "-e", "prod").AssertSuccess()
+	env.Set("_SIGNING_KEY", "secret", "-a", "payments", "-e", "prod").AssertSuccess()
+	env.Set("CALLBACK_URL", "${app:payments:PUBLIC_URL}/callback", "-a", "api", "-e", "prod").AssertSuccess()
+
+	// The other app's chain is resolved in the same env
+	env.Get("CALLBACK_URL", "-a", "api", "-e", "prod").
+		AssertSuccess().
+		AssertStdoutEquals("https://pay.example.com/callback")
+
+	// Internal variables stay private to their app
+	env.Set("SIGNING_KEY", "${app:payments:_SIGNING_KEY}", "-a", "api", "-e", "prod").AssertSuccess()
+	env.Get("SIGNING_KEY", "-a", "api", "-e", "prod").
+		AssertFailure().
+		AssertStderrContains("cannot reference internal variable")
+	env.Run("unset", "-k", "SIGNING_KEY", "-a", "api", "-e", "prod", "-r", ".").AssertSuccess()
+
+	// Unknown apps are reported rather than resolved from shared files
+	env.Set("BILLING_URL", "${app:billing:DOMAIN}", "-a", "api", "-e", "prod").AssertSuccess()
+	env.Get("BILLING_URL", "-a", "api", "-e", "prod").
+		AssertFailure().
+		AssertStderrContains("no config files found for app: billing")
+	env.Run("unset", "-k", "BILLING_URL", "-a", "api", "-e", "prod", "-r", ".").AssertSuccess()
+
+	// Apps referencing each other are a cycle
+	env.Set("API_URL", "${app:api:CALLBACK_URL}", "-a", "payments", "-e", "prod").AssertSuccess()
+	env.Get("CALLBACK_URL", "-a", "api", "-e", "prod").
+		AssertFailure().
+		AssertStderrContains("circular app reference detected for app: api")
+}
+
 // TestEdgeCase_DeepNestedDirectories tests creating config in deeply nested directories
 func TestEdgeCase_DeepNestedDirectories(t *testing.T) {
 	env := helpers.NewTestEnv(t)
@@ -544,3 +677,21 @@ func TestEdgeCase_InvalidYAMLInDecryptedFile(t *testing.T) {
 		}
 	}
 }
+
+// TestEdgeCase_InitWithInvalidCloudKeys tests that malformed cloud KMS keys are rejected before anything is written
+func TestEdgeCase_InitWithInvalidCloudKeys(t *testing.T) {
+	env := helpers.NewTestEnv(t)
+	defer env.Cleanup()
+
+	env.Run("init", "-k", env.AgeKey, "--gcp-kms", "projects/acme/keyRings/puff").
+		AssertFailure().
+		AssertStderrContains("invalid GCP KMS resource ID")
+
+	env.Run("init", "-k", env.AgeKey, "--kms", "https://acme.vault.azure.net/keys/puff").
+		AssertFailure().
+		AssertStderrContains("invalid --kms key")
+
+	if env.FileExists(".sops.yaml") {
+		t.Error("Expected no .sops.yaml to be written")
+	}
+}
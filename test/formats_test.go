@@ -534,6 +534,24 @@ func TestFormat_TemplatesResolved(t *testing.T) {
 	}
 }
 
+// TestFormat_TemplateFunctions tests that template functions compute derived values at generate time
+func TestFormat_TemplateFunctions(t *testing.T) {
+	env := helpers.NewTestEnv(t)
+	defer env.Cleanup()
+
+	env.Init().AssertSuccess()
+
+	env.Set("_TOKEN", "deploy:s3cret", "-a", "api", "-e", "dev").AssertSuccess()
+	env.Set("_PASSWORD", "p@ss/word", "-a", "api", "-e", "dev").AssertSuccess()
+	env.Set("AUTH_HEADER", "Basic ${b64(_TOKEN)}", "-a", "api", "-e", "dev").AssertSuccess()
+	env.Set("DATABASE_URL", "postgres://app:${urlencode(_PASSWORD)}@db/app", "-a", "api", "-e", "dev").AssertSuccess()
+
+	result := env.Generate("api", "dev", "env")
+	result.AssertSuccess()
+	result.AssertStdoutContains("Basic ZGVwbG95OnMzY3JldA==")
+	result.AssertStdoutContains("postgres://app:p%40ss%2Fword@db/app")
+}
+
 // TestFormat_InvalidFormatName tests error handling for invalid format
 func TestFormat_InvalidFormatName(t *testing.T) {
 	env := helpers.NewTestEnv(t)
@@ -595,3 +613,166 @@ func TestFormat_ConsistencyAcrossFormats(t *testing.T) {
 		}
 	}
 }
+
+// TestFormat_ExternalSecretsOutput tests ExternalSecret and PushSecret manifests
+func TestFormat_ExternalSecretsOutput(t *testing.T) {
+	env := helpers.NewTestEnv(t)
+	defer env.Cleanup()
+
+	env.Init().AssertSuccess()
+	env.Set("DB_PASSWORD", "hunter2", "-a", "api", "-e", "prod").AssertSuccess()
+
+	// ExternalSecret references keys but never contains values
+	result := env.Generate("api", "prod", "external-secret", "--secret-name", "api-secrets", "--secret-store", "vault")
+	result.AssertSuccess().
+		AssertStdoutContains("kind: ExternalSecret").
+		AssertStdoutContains("secretKey: DB_PASSWORD").
+		AssertStdoutNotContains("hunter2")
+
+	// PushSecret includes the source Secret
+	result = env.Generate("api", "prod", "push-secret", "--secret-name", "api-secrets", "--secret-store", "vault", "--remote-key-prefix", "prod/")
+	result.AssertSuccess().
+		AssertStdoutContains("kind: Secret").
+		AssertStdoutContains("kind: PushSecret").
+		AssertStdoutContains("remoteKey: prod/DB_PASSWORD")
+
+	env.Generate("api", "prod", "external-secret", "--secret-name", "api-secrets").
+		AssertFailure().
+		AssertStderrContains("--secret-store is required")
+}
+
+// TestFormat_TfvarsOutput tests Terraform variable file output
+func TestFormat_TfvarsOutput(t *testing.T) {
+	env := helpers.NewTestEnv(t)
+	defer env.Cleanup()
+
+	env.Init().AssertSuccess()
+	env.Set("region", "us-east-1", "-a", "infra", "-e", "prod").AssertSuccess()
+
+	env.Generate("infra", "prod", "tfvars").
+		AssertSuccess().
+		AssertStdoutContains(`region = "us-east-1"`)
+
+	result := env.Generate("infra", "prod", "tfvars-json").AssertSuccess()
+
+	var parsed map[string]interface{}
+	if err := json.Unmarshal([]byte(result.GetStdout()), &parsed); err != nil {
+		t.Fatalf("tfvars-json output is not valid JSON: %v", err)
+	}
+	if parsed["region"] != "us-east-1" {
+		t.Errorf("Unexpected region: %v", parsed["region"])
+	}
+}
+
+// TestFormat_ECSOutput tests ECS container definition environment output
+func TestFormat_ECSOutput(t *testing.T) {
+	env := helpers.NewTestEnv(t)
+	defer env.Cleanup()
+
+	env.Init().AssertSuccess()
+	env.Set("PORT", "8080", "-a", "api", "-e", "prod").AssertSuccess()
+	env.Set("DB_PASSWORD", "hunter2", "-a", "api", "-e", "prod").AssertSuccess()
+
+	env.Generate("api", "prod", "ecs", "--secret-keys", "DB_PASSWORD", "--ssm-arn-prefix", "arn:aws:ssm:us-east-1:1:parameter/prod/").
+		AssertSuccess().
+		AssertStdoutContains(`"valueFrom": "arn:aws:ssm:us-east-1:1:parameter/prod/DB_PASSWORD"`).
+		AssertStdoutContains(`"value": "8080"`).
+		AssertStdoutNotContains("hunter2")
+
+	env.Generate("api", "prod", "ecs", "--secret-keys", "DB_PASSWORD").
+		AssertFailure().
+		AssertStderrContains("--ssm-arn-prefix is required")
+}
+
+// TestFormat_NestedOutput tests unflattening keys with --nest-delimiter
+func TestFormat_NestedOutput(t *testing.T) {
+	env := helpers.NewTestEnv(t)
+	defer env.Cleanup()
+
+	env.Init().AssertSuccess()
+	env.Set("DB__HOST", "localhost", "-a", "api", "-e", "dev").AssertSuccess()
+	env.Set("DB__PORT", "5432", "-a", "api", "-e", "dev").AssertSuccess()
+
+	result := env.Generate("api", "dev", "json", "--nest-delimiter", "__").AssertSuccess()
+
+	var parsed map[string]interface{}
+	if err := json.Unmarshal([]byte(result.GetStdout()), &parsed); err != nil {
+		t.Fatalf("Output is not valid JSON: %v", err)
+	}
+	db, ok := parsed["DB"].(map[string]interface{})
+	if !ok || db["HOST"] != "localhost" || db["PORT"] != "5432" {
+		t.Errorf("Expected nested DB object, got %v", parsed)
+	}
+
+	env.Generate("api", "dev", "env", "--nest-delimiter", "__").
+		AssertFailure().
+		AssertStderrContains("only supported for json and yaml")
+}
+
+// TestFormat_TemplateOutput tests rendering values through a custom Go template
+func TestFormat_TemplateOutput(t *testing.T) {
+	env := helpers.NewTestEnv(t)
+	defer env.Cleanup()
+
+	env.Init().AssertSuccess()
+	env.Set("DB_HOST", "localhost", "-a", "api", "-e", "dev").AssertSuccess()
+
+	env.WriteFile("app.conf.tmpl", "[db]\nhost = {{ quote .DB_HOST }}\n")
+
+	env.Generate("api", "dev", "template", "--template-file", "app.conf.tmpl").
+		AssertSuccess().
+		AssertStdoutEquals("[db]\nhost = \"localhost\"")
+
+	env.Generate("api", "dev", "template").
+		AssertFailure().
+		AssertStderrContains("--template-file is required")
+}
+
+// TestFormat_GitHubEnvOutput tests the GitHub Actions env file format with log masking
+func TestFormat_GitHubEnvOutput(t *testing.T) {
+	env := helpers.NewTestEnv(t)
+	defer env.Cleanup()
+
+	env.Init().AssertSuccess()
+	env.Set("API_TOKEN", "abc123", "-a", "api", "-e", "prod").AssertSuccess()
+	env.Set("PORT", "3000", "-a", "api", "-e", "prod").AssertSuccess()
+
+	env.Generate("api", "prod", "github-env", "--mask-keys", "*_TOKEN", "-o", "github.env").
+		AssertSuccess().
+		AssertStdoutContains("::add-mask::abc123").
+		AssertStdoutNotContains("3000")
+
+	if got := env.ReadFile("github.env"); got != "API_TOKEN=abc123\nPORT=3000" {
+		t.Errorf("Unexpected github-env output: %q", got)
+	}
+
+	env.Generate("api", "prod", "github-env", "--mask-keys", "*").
+		AssertFailure().
+		AssertStderrContains("--mask-keys requires --output")
+}
+
+// TestFormat_AnnotateSources tests source comments in env and yaml output
+func TestFormat_AnnotateSources(t *testing.T) {
+	env := helpers.NewTestEnv(t)
+	defer env.Cleanup()
+
+	env.Init().AssertSuccess()
+	env.Set("LOG_LEVEL", "info").AssertSuccess()
+	env.Set("PORT", "8080", "-a", "api", "-e", "dev").AssertSuccess()
+	env.Set("_SECRET", "hidden", "-a", "api", "-e", "dev").AssertSuccess()
+
+	env.Generate("api", "dev", "env", "--annotate-sources").
+		AssertSuccess().
+		AssertStdoutContains("# source: base/shared.yml\nLOG_LEVEL=info").
+		AssertStdoutContains("# source: dev/api.yml\nPORT=8080").
+		AssertStdoutNotContains("_SECRET")
+
+	env.Generate("api", "dev", "yaml", "--annotate-sources").
+		AssertSuccess().
+		AssertStdoutContains("# source: dev/api.yml\nPORT: \"8080\"")
+
+	// Formats without comments are rejected
+	env.Generate("api", "dev", "json", "--annotate-sources").
+		AssertFailure().
+		AssertStderrContains("only supported for env and yaml formats")
+}
@@ -193,6 +193,30 @@ func (e *TestEnv) Get(key string, opts ...string) *CommandResult {
 	return e.Run(args...)
 }
 
+// Unset removes a configuration value
+func (e *TestEnv) Unset(key string, opts ...string) *CommandResult {
+	e.t.Helper()
+	args := []string{"unset", "-k", key, "-r", "."}
+	args = append(args, opts...)
+	return e.Run(args...)
+}
+
+// List lists all keys for a context
+func (e *TestEnv) List(opts ...string) *CommandResult {
+	e.t.Helper()
+	args := []string{"list", "-r", "."}
+	args = append(args, opts...)
+	return e.Run(args...)
+}
+
+// Diff compares an app's config between two environments
+func (e *TestEnv) Diff(from, to string, opts ...string) *CommandResult {
+	e.t.Helper()
+	args := []string{"diff", "--from", from, "--to", to, "-r", "."}
+	args = append(args, opts...)
+	return e.Run(args...)
+}
+
 // Generate generates configuration in the specified format
 func (e *TestEnv) Generate(app, env, format string, opts ...string) *CommandResult {
 	e.t.Helper()
@@ -225,6 +249,12 @@ func (e *TestEnv) KeysList(opts ...string) *CommandResult {
 	return e.Run(args...)
 }
 
+// Edit edits an encrypted file in place using the given editor command
+func (e *TestEnv) Edit(file, editor string) *CommandResult {
+	e.t.Helper()
+	return e.RunWithEnv(map[string]string{"VISUAL": "", "EDITOR": editor}, "edit", "-f", file)
+}
+
 // Decrypt decrypts a file for bulk editing
 func (e *TestEnv) Decrypt(file string) *CommandResult {
 	e.t.Helper()
@@ -252,6 +252,65 @@ func TestSecurity_KeyRotation(t *testing.T) {
 	result.AssertSuccess().AssertStdoutEquals("sensitive1")
 }
 
+// TestSecurity_DataKeyRotation verifies that rotation replaces the data key,
+// which removing a key alone does not
+func TestSecurity_DataKeyRotation(t *testing.T) {
+	env := helpers.NewTestEnv(t)
+	defer env.Cleanup()
+
+	env.Init().AssertSuccess()
+	env.Set("SECRET1", "sensitive1", "-a", "api", "-e", "dev").AssertSuccess()
+	env.Set("SECRET2", "sensitive2", "-a", "api", "-e", "prod").AssertSuccess()
+
+	encryptedValue := func(path string) string {
+		for _, line := range strings.Split(env.ReadFile(path), "\n") {
+			if strings.HasPrefix(line, "SECRET") {
+				return line
+			}
+		}
+		t.Fatalf("No encrypted value in %s", path)
+		return ""
+	}
+
+	// Removing a key re-wraps the same data key, so values are untouched
+	result := env.RunSystem("age-keygen")
+	var otherKey string
+	for _, line := range strings.Split(result.GetStdout(), "\n") {
+		if strings.HasPrefix(line, "# public key:") {
+			otherKey = strings.TrimSpace(strings.TrimPrefix(line, "# public key:"))
+		}
+	}
+	env.KeysAdd(otherKey, "Departing").AssertSuccess()
+	before := encryptedValue("dev/api.yml")
+	prodBefore := encryptedValue("prod/api.yml")
+	env.KeysRemove(otherKey).AssertSuccess()
+	if encryptedValue("dev/api.yml") != before {
+		t.Fatal("Expected keys rm alone to keep the data key")
+	}
+
+	env.Run("keys", "rotate", "-e", "dev").
+		AssertSuccess().
+		AssertStdoutContains("dev/api.yml").
+		AssertStdoutContains("Rotated data keys of 1 file(s)")
+
+	if encryptedValue("dev/api.yml") == before {
+		t.Error("Expected values to be re-encrypted under a new data key")
+	}
+	env.Get("SECRET1", "-a", "api", "-e", "dev").AssertSuccess().AssertStdoutEquals("sensitive1")
+
+	// Other environments are untouched
+	if encryptedValue("prod/api.yml") != prodBefore {
+		t.Error("Expected prod to keep its data key")
+	}
+
+	// keys rm --rotate does both in one step
+	env.KeysAdd(otherKey, "Departing").AssertSuccess()
+	env.Run("keys", "rm", "-k", otherKey, "--rotate").AssertSuccess()
+	if encryptedValue("prod/api.yml") == prodBefore {
+		t.Error("Expected keys rm --rotate to re-encrypt prod")
+	}
+}
+
 // TestSecurity_NoPlaintextInGeneratedK8sSecrets verifies k8s secrets don't leak plaintext
 func TestSecurity_NoPlaintextInGeneratedK8sSecrets(t *testing.T) {
 	env := helpers.NewTestEnv(t)